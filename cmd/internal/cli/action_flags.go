@@ -18,8 +18,12 @@ var (
 	AppName         string
 	BindPaths       []string
 	HomePath        string
+	HomeMode        string
+	PasswdEntries   []string
 	OverlayPath     []string
+	ComposePath     string
 	ScratchPath     []string
+	TmpPolicy       []string
 	WorkdirPath     string
 	PwdPath         string
 	ShellPath       string
@@ -32,27 +36,57 @@ var (
 	VMRAM           string
 	VMCPU           string
 	ContainLibsPath []string
+	OciPatchPaths   []string
+	RecordPath      string
+	PtyTiming       string
+	RusageFile      string
+	StageTo         string
+	ExecTimeout     string
+	ExecStopSignal  string
+	THP             string
+	MemPolicy       string
+	ObserveFile     string
 
 	IsBoot          bool
 	IsFakeroot      bool
 	IsCleanEnv      bool
 	IsContained     bool
 	IsContainAll    bool
+	IsPrivateTmp    bool
+	IsPrivateDevs   bool
+	NoInitNet       bool
 	IsWritable      bool
 	IsWritableTmpfs bool
 	Nvidia          bool
+	HostSingularity bool
+	Krb5            bool
+	JobTemplates    bool
+	SessionBus      bool
+	XDGRuntimeDir   bool
+	GUI             bool
+	ALSA            bool
+	Pulse           bool
+	Video           bool
+	Pty             bool
+	Rusage          bool
+	Observe         bool
 	NoHome          bool
 	NoInit          bool
 	NoNvidia        bool
+	NoLabelFlags    bool
+	NoImageSeccomp  bool
+	EnvViaFile      bool
 	VM              bool
 	VMErr           bool
 	IsSyOS          bool
+	DryRun          bool
 
-	NetNamespace  bool
-	UtsNamespace  bool
-	UserNamespace bool
-	PidNamespace  bool
-	IpcNamespace  bool
+	NetNamespace    bool
+	UtsNamespace    bool
+	UserNamespace   bool
+	PidNamespace    bool
+	IpcNamespace    bool
+	CgroupNamespace bool
 
 	AllowSUID bool
 	KeepPrivs bool
@@ -97,16 +131,36 @@ func initPathVars() {
 	actionFlags.SetAnnotation("home", "argtag", []string{"<spec>"})
 	actionFlags.SetAnnotation("home", "envkey", []string{"HOME"})
 
+	// --home-mode
+	actionFlags.StringVar(&HomeMode, "home-mode", "", "control how the home directory is provided, mode is host (bind of the host home, default), tmpfs[:<size>] (empty tmpfs), skel[:<size>] (tmpfs populated from /etc/skel of the image) or image (home directory of the image)")
+	actionFlags.SetAnnotation("home-mode", "argtag", []string{"<mode>"})
+	actionFlags.SetAnnotation("home-mode", "envkey", []string{"HOME_MODE"})
+
+	// --add-passwd-entry
+	actionFlags.StringArrayVar(&PasswdEntries, "add-passwd-entry", []string{}, "add an entry to the container passwd file, entry is a user name or uid resolved by the host name services, or a complete name:x:uid:gid:gecos:dir:shell line")
+	actionFlags.SetAnnotation("add-passwd-entry", "argtag", []string{"<entry>"})
+	actionFlags.SetAnnotation("add-passwd-entry", "envkey", []string{"ADD_PASSWD_ENTRY"})
+
 	// -o|--overlay
 	actionFlags.StringSliceVarP(&OverlayPath, "overlay", "o", []string{}, "use an overlayFS image for persistent data storage or as read-only layer of container")
 	actionFlags.SetAnnotation("overlay", "argtag", []string{"<path>"})
 	actionFlags.SetAnnotation("overlay", "envkey", []string{"OVERLAY", "OVERLAYIMAGE"})
 
+	// --compose
+	actionFlags.StringVar(&ComposePath, "compose", "", "stack read-only SIF or squashfs images, separated by colons, on top of the container image, later images take precedence (with overlay support only)")
+	actionFlags.SetAnnotation("compose", "argtag", []string{"<path[:path...]>"})
+	actionFlags.SetAnnotation("compose", "envkey", []string{"COMPOSE"})
+
 	// -S|--scratch
-	actionFlags.StringSliceVarP(&ScratchPath, "scratch", "S", []string{}, "include a scratch directory within the container that is linked to a temporary dir (use -W to force location)")
+	actionFlags.StringSliceVarP(&ScratchPath, "scratch", "S", []string{}, "include a scratch directory within the container that is linked to a temporary dir (use -W to force location), auto binds a per-job scratch directory at /scratch removed once the container stopped")
 	actionFlags.SetAnnotation("scratch", "argtag", []string{"<path>"})
 	actionFlags.SetAnnotation("scratch", "envkey", []string{"SCRATCH", "SCRATCHDIR"})
 
+	// --tmp-policy
+	actionFlags.StringSliceVar(&TmpPolicy, "tmp-policy", []string{}, "control how /tmp, /var/tmp and /dev/shm are provided with <path>=<policy>, policy is tmpfs[:<size>], host or scratch:<path>")
+	actionFlags.SetAnnotation("tmp-policy", "argtag", []string{"<path>=<policy>"})
+	actionFlags.SetAnnotation("tmp-policy", "envkey", []string{"TMP_POLICY"})
+
 	// -W|--workdir
 	actionFlags.StringVarP(&WorkdirPath, "workdir", "W", "", "working directory to be used for /tmp, /var/tmp and $HOME (if -c/--contain was also used)")
 	actionFlags.SetAnnotation("workdir", "argtag", []string{"<path>"})
@@ -151,6 +205,16 @@ func initPathVars() {
 	actionFlags.SetAnnotation("apply-cgroups", "argtag", []string{"<path>"})
 	actionFlags.SetAnnotation("apply-cgroups", "envkey", []string{"APPLY_CGROUPS"})
 
+	// --thp
+	actionFlags.StringVar(&THP, "thp", "", "set the transparent hugepage mode of the container processes, mode is never (no hugepages) or madvise (only for regions advised with madvise(MADV_HUGEPAGE), requires Linux 6.18)")
+	actionFlags.SetAnnotation("thp", "argtag", []string{"<mode>"})
+	actionFlags.SetAnnotation("thp", "envkey", []string{"THP"})
+
+	// --mempolicy
+	actionFlags.StringVar(&MemPolicy, "mempolicy", "", "set the NUMA memory policy of the container processes, policy is default, local, bind:<nodes>, interleave:<nodes> or preferred:<node> where nodes is a list like 0,2-3")
+	actionFlags.SetAnnotation("mempolicy", "argtag", []string{"<policy>"})
+	actionFlags.SetAnnotation("mempolicy", "envkey", []string{"MEMPOLICY"})
+
 	// --vm-ram
 	actionFlags.StringVar(&VMRAM, "vm-ram", "1024", "Amount of RAM in MiB to allocate to Virtual Machine (implies --vm)")
 	actionFlags.SetAnnotation("vm-ram", "argtag", []string{"<size>"})
@@ -179,6 +243,45 @@ func initPathVars() {
 	actionFlags.StringVar(&tmpDir, "tmpdir", "", "specify a temporary directory to use for build")
 	actionFlags.Lookup("tmpdir").Hidden = true
 	actionFlags.SetAnnotation("tmpdir", "envkey", []string{"TMPDIR"})
+
+	// --oci-patch
+	actionFlags.StringSliceVar(&OciPatchPaths, "oci-patch", []string{}, "apply a JSON merge patch (RFC 7386) file to the generated OCI runtime specification, multiple patches are applied in order")
+	actionFlags.SetAnnotation("oci-patch", "argtag", []string{"<path>"})
+	actionFlags.SetAnnotation("oci-patch", "envkey", []string{"OCI_PATCH"})
+
+	// --record
+	actionFlags.StringVar(&RecordPath, "record", "", "write the invocation record (command line, environment, image digest and binds) to a JSON file usable with singularity rerun")
+	actionFlags.SetAnnotation("record", "argtag", []string{"<path>"})
+
+	// --pty-timing
+	actionFlags.StringVar(&PtyTiming, "pty-timing", "", "write pseudo-terminal output timing information to a file in scriptreplay format, implies --pty")
+	actionFlags.SetAnnotation("pty-timing", "argtag", []string{"<path>"})
+	actionFlags.SetAnnotation("pty-timing", "envkey", []string{"PTY_TIMING"})
+
+	// --usage-file
+	actionFlags.StringVar(&RusageFile, "usage-file", "", "write the resource usage summary of the container process tree to a file in JSON format, implies --usage")
+	actionFlags.SetAnnotation("usage-file", "argtag", []string{"<path>"})
+	actionFlags.SetAnnotation("usage-file", "envkey", []string{"USAGE_FILE"})
+
+	// --stage-to
+	actionFlags.StringVar(&StageTo, "stage-to", "", "copy the image, or extract it when a sandbox is required, to a node-local directory before running the container, copies are shared by digest between containers of the same user and removed at exit of the last one, unless a plugin ties staged images to the job lifetime")
+	actionFlags.SetAnnotation("stage-to", "argtag", []string{"<dir>"})
+	actionFlags.SetAnnotation("stage-to", "envkey", []string{"STAGE_TO"})
+
+	// --platform
+	actionFlags.StringVar(&imagePlatform, "platform", "", "select the image matching os/arch[/variant] from docker manifest lists, defaults to the host platform")
+	actionFlags.SetAnnotation("platform", "argtag", []string{"<os/arch[/variant]>"})
+	actionFlags.SetAnnotation("platform", "envkey", []string{"PLATFORM"})
+
+	// --timeout
+	actionFlags.StringVar(&ExecTimeout, "timeout", "", "stop the container process tree with the --stop-signal once the wall-clock duration expires (e.g. 90s, 30m, 2h, plain numbers are seconds), then SIGKILL if still running 10 seconds later, singularity exits with status 193")
+	actionFlags.SetAnnotation("timeout", "argtag", []string{"<duration>"})
+	actionFlags.SetAnnotation("timeout", "envkey", []string{"TIMEOUT"})
+
+	// --stop-signal
+	actionFlags.StringVar(&ExecStopSignal, "stop-signal", "SIGTERM", "signal sent to the container process tree when the --timeout expires")
+	actionFlags.SetAnnotation("stop-signal", "argtag", []string{"<signal>"})
+	actionFlags.SetAnnotation("stop-signal", "envkey", []string{"CONTAINER_STOP_SIGNAL"})
 }
 
 // initBoolVars initializes flags that take a boolean argument
@@ -196,18 +299,87 @@ func initBoolVars() {
 	actionFlags.BoolVarP(&IsCleanEnv, "cleanenv", "e", false, "clean environment before running container")
 	actionFlags.SetAnnotation("cleanenv", "envkey", []string{"CLEANENV"})
 
+	// --no-host-env
+	actionFlags.BoolVar(&IsCleanEnv, "no-host-env", false, "do NOT pass the host environment to the container, same as --cleanenv")
+	actionFlags.SetAnnotation("no-host-env", "envkey", []string{"NO_HOST_ENV"})
+
 	// -c|--contain
-	actionFlags.BoolVarP(&IsContained, "contain", "c", false, "use minimal /dev and empty other directories (e.g. /tmp and $HOME) instead of sharing filesystems from your host")
+	actionFlags.BoolVarP(&IsContained, "contain", "c", false, "use minimal /dev and empty other directories (e.g. /tmp and $HOME) instead of sharing filesystems from your host, implies --private-tmp and --private-devs")
 	actionFlags.SetAnnotation("contain", "envkey", []string{"CONTAIN"})
 
 	// -C|--containall
-	actionFlags.BoolVarP(&IsContainAll, "containall", "C", false, "contain not only file systems, but also PID, IPC, and environment")
+	actionFlags.BoolVarP(&IsContainAll, "containall", "C", false, "contain not only file systems, but also PID, IPC, and environment, same as --contain --pid --ipc --no-host-env")
 	actionFlags.SetAnnotation("containall", "envkey", []string{"CONTAINALL"})
 
+	// --private-tmp
+	actionFlags.BoolVar(&IsPrivateTmp, "private-tmp", false, "use empty /tmp and /var/tmp directories, created in --workdir when set, instead of the host ones")
+	actionFlags.SetAnnotation("private-tmp", "envkey", []string{"PRIVATE_TMP"})
+
+	// --private-devs
+	actionFlags.BoolVar(&IsPrivateDevs, "private-devs", false, "use a minimal /dev instead of the host /dev")
+	actionFlags.SetAnnotation("private-devs", "envkey", []string{"PRIVATE_DEVS"})
+
+	// --no-init-net
+	actionFlags.BoolVar(&NoInitNet, "no-init-net", false, "run in a new network namespace with only a loopback interface, no network is set up")
+	actionFlags.SetAnnotation("no-init-net", "envkey", []string{"NO_INIT_NET"})
+
 	// --nv
 	actionFlags.BoolVar(&Nvidia, "nv", false, "enable experimental Nvidia support")
 	actionFlags.SetAnnotation("nv", "envkey", []string{"NV"})
 
+	// --host-singularity
+	actionFlags.BoolVar(&HostSingularity, "host-singularity", false, "bind the host singularity binary, configuration and starter binaries read-only into the container at their host location")
+	actionFlags.SetAnnotation("host-singularity", "envkey", []string{"HOST_SINGULARITY"})
+
+	// --job-templates
+	actionFlags.BoolVar(&JobTemplates, "job-templates", false, "expand job scheduler {{.Name}} templates and $VAR references in bind paths, and templates in SINGULARITYENV_ values")
+	actionFlags.SetAnnotation("job-templates", "envkey", []string{"JOB_TEMPLATES"})
+
+	// --krb5
+	actionFlags.BoolVar(&Krb5, "krb5", false, "provide the Kerberos credential cache of KRB5CCNAME and the host krb5.conf to the container")
+	actionFlags.SetAnnotation("krb5", "envkey", []string{"KRB5"})
+
+	// --dbus
+	actionFlags.BoolVar(&SessionBus, "dbus", false, "bind the session D-Bus socket of DBUS_SESSION_BUS_ADDRESS into the container")
+	actionFlags.SetAnnotation("dbus", "envkey", []string{"DBUS"})
+
+	// --xdg-runtime-dir
+	actionFlags.BoolVar(&XDGRuntimeDir, "xdg-runtime-dir", false, "bind the user runtime directory XDG_RUNTIME_DIR, holding the Wayland, PulseAudio and systemd user sockets, into the container")
+	actionFlags.SetAnnotation("xdg-runtime-dir", "envkey", []string{"XDG_RUNTIME_DIR"})
+
+	// --gui
+	actionFlags.BoolVar(&GUI, "gui", false, "run graphical applications, the X11 or Wayland display of the session and the rendering devices are provided to the container")
+	actionFlags.SetAnnotation("gui", "envkey", []string{"GUI"})
+
+	// --alsa
+	actionFlags.BoolVar(&ALSA, "alsa", false, "provide the ALSA sound devices of /dev/snd to the container")
+	actionFlags.SetAnnotation("alsa", "envkey", []string{"ALSA"})
+
+	// --pulse
+	actionFlags.BoolVar(&Pulse, "pulse", false, "bind the PulseAudio server socket of the session and the user cookie into the container")
+	actionFlags.SetAnnotation("pulse", "envkey", []string{"PULSE"})
+
+	// --video
+	actionFlags.BoolVar(&Video, "video", false, "provide the /dev/video* capture devices, like webcams, and /dev/media* devices to the container")
+	actionFlags.SetAnnotation("video", "envkey", []string{"VIDEO"})
+
+	// --pty
+	actionFlags.BoolVar(&Pty, "pty", false, "attach the container process to a pseudo-terminal even if standard input/output are not terminals, output is still written to standard output")
+	actionFlags.SetAnnotation("pty", "envkey", []string{"PTY"})
+
+	// --usage
+	actionFlags.BoolVar(&Rusage, "usage", false, "print a resource usage summary (wall time, max RSS, CPU time, I/O bytes and page faults) of the container process tree on exit")
+	actionFlags.SetAnnotation("usage", "envkey", []string{"USAGE"})
+
+	// --observe
+	actionFlags.BoolVar(&Observe, "observe", false, "print a summary of the system calls, file opens and network connections of the container processes on exit, requires root or setuid mode")
+	actionFlags.SetAnnotation("observe", "envkey", []string{"OBSERVE"})
+
+	// --observe-file
+	actionFlags.StringVar(&ObserveFile, "observe-file", "", "write the --observe report to a file in JSON format, implies --observe")
+	actionFlags.SetAnnotation("observe-file", "argtag", []string{"<path>"})
+	actionFlags.SetAnnotation("observe-file", "envkey", []string{"OBSERVE_FILE"})
+
 	// -w|--writable
 	actionFlags.BoolVarP(&IsWritable, "writable", "w", false, "by default all Singularity containers are available as read only. This option makes the file system accessible as read/write.")
 	actionFlags.SetAnnotation("writable", "envkey", []string{"WRITABLE"})
@@ -232,11 +404,27 @@ func initBoolVars() {
 	actionFlags.BoolVar(&dockerLogin, "docker-login", false, "login to a Docker Repository interactively")
 	actionFlags.SetAnnotation("docker-login", "envkey", []string{"DOCKER_LOGIN"})
 
+	// --strict-platform
+	actionFlags.BoolVar(&strictPlatform, "strict-platform", false, "refuse images which don't match exactly the requested platform and running images built for another architecture under emulation")
+	actionFlags.SetAnnotation("strict-platform", "envkey", []string{"STRICT_PLATFORM"})
+
 	// hidden flag to disable nvidia bindings when 'always use nv = yes'
 	actionFlags.BoolVar(&NoNvidia, "no-nv", false, "")
 	actionFlags.Lookup("no-nv").Hidden = true
 	actionFlags.SetAnnotation("no-nv", "envkey", []string{"NV_OFF", "NO_NV"})
 
+	// --no-label-flags
+	actionFlags.BoolVar(&NoLabelFlags, "no-label-flags", false, "don't enable options requested by image labels (org.sylabs.needs.gpu, org.sylabs.needs.net)")
+	actionFlags.SetAnnotation("no-label-flags", "envkey", []string{"NO_LABEL_FLAGS"})
+
+	// --no-image-seccomp
+	actionFlags.BoolVar(&NoImageSeccomp, "no-image-seccomp", false, "don't apply the seccomp profile recommended by the image")
+	actionFlags.SetAnnotation("no-image-seccomp", "envkey", []string{"NO_IMAGE_SECCOMP"})
+
+	// --env-via-file
+	actionFlags.BoolVar(&EnvViaFile, "env-via-file", false, "pass the container environment through a file sourced by /bin/sh in the container instead of the process environment, done automatically when it's too big")
+	actionFlags.SetAnnotation("env-via-file", "envkey", []string{"ENV_VIA_FILE"})
+
 	// --vm
 	actionFlags.BoolVar(&VM, "vm", false, "enable VM support")
 	actionFlags.SetAnnotation("vm", "envkey", []string{"VM"})
@@ -245,6 +433,10 @@ func initBoolVars() {
 	actionFlags.BoolVar(&VMErr, "vm-err", false, "enable attaching stderr from VM")
 	actionFlags.SetAnnotation("vm-err", "envkey", []string{"VMERROR"})
 
+	// --dry-run
+	actionFlags.BoolVar(&DryRun, "dry-run", false, "print the final OCI runtime specification and exit without running the container")
+	actionFlags.SetAnnotation("dry-run", "envkey", []string{"DRY_RUN"})
+
 	// --syos
 	// TODO: Keep this in production?
 	actionFlags.BoolVar(&IsSyOS, "syos", false, "execute SyOS shell")
@@ -271,6 +463,10 @@ func initNamespaceVars() {
 	actionFlags.BoolVar(&UtsNamespace, "uts", false, "run container in a new UTS namespace")
 	actionFlags.SetAnnotation("uts", "envkey", []string{"UTS", "UNSHARE_UTS"})
 
+	// --cgroupns
+	actionFlags.BoolVar(&CgroupNamespace, "cgroupns", false, "run container in a new cgroup namespace, /sys/fs/cgroup shows only the container cgroup subtree, read-only")
+	actionFlags.SetAnnotation("cgroupns", "envkey", []string{"CGROUPNS", "UNSHARE_CGROUPNS"})
+
 	// -u|--userns
 	actionFlags.BoolVarP(&UserNamespace, "userns", "u", false, "run container in a new user namespace, allowing Singularity to run completely unprivileged on recent kernels. This disables some features of Singularity, for example it only works with sandbox images.")
 	actionFlags.SetAnnotation("userns", "envkey", []string{"USERNS", "UNSHARE_USERNS"})
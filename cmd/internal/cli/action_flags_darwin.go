@@ -14,6 +14,8 @@ var platformActionFlags = []string{
 	"docker-username",
 	"home",
 	"nohttps",
+	"platform",
+	"strict-platform",
 	"tmpdir",
 	"vm",
 	"vm-cpu",
@@ -9,41 +9,77 @@ package cli
 // target platform
 var platformActionFlags = []string{
 	"add-caps",
+	"add-passwd-entry",
 	"allow-setuid",
+	"alsa",
 	"app",
 	"apply-cgroups",
 	"bind",
+	"cgroupns",
 	"cleanenv",
+	"compose",
 	"contain",
 	"containall",
 	"containlibs",
+	"dbus",
 	"dns",
 	"docker-login",
 	"docker-password",
 	"docker-username",
 	"drop-caps",
+	"dry-run",
 	"fakeroot",
+	"gui",
 	"home",
+	"home-mode",
+	"host-singularity",
 	"hostname",
 	"ipc",
+	"job-templates",
 	"keep-privs",
+	"krb5",
+	"mempolicy",
 	"net",
 	"network",
 	"network-args",
 	"no-home",
+	"no-host-env",
 	"nohttps",
+	"no-image-seccomp",
+	"env-via-file",
 	"no-init",
+	"no-init-net",
+	"no-label-flags",
 	"no-nv",
 	"no-privs",
 	"nv",
+	"observe",
+	"observe-file",
+	"oci-patch",
 	"overlay",
 	"pid",
+	"platform",
+	"private-devs",
+	"private-tmp",
+	"pty",
+	"pty-timing",
+	"pulse",
 	"pwd",
+	"record",
 	"scratch",
 	"security",
+	"stage-to",
+	"stop-signal",
+	"strict-platform",
+	"thp",
+	"timeout",
+	"tmp-policy",
 	"tmpdir",
+	"usage",
+	"usage-file",
 	"userns",
 	"uts",
+	"video",
 	"vm",
 	"vm-cpu",
 	"vm-err",
@@ -51,6 +87,7 @@ var platformActionFlags = []string{
 	"workdir",
 	"writable",
 	"writable-tmpfs",
+	"xdg-runtime-dir",
 }
 
 // initPlatformDefaults customizes the default values for the flags in
@@ -20,6 +20,8 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/plugin"
 	scs "github.com/sylabs/singularity/internal/pkg/remote"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/errctx"
+	"github.com/sylabs/singularity/internal/pkg/util/exitcode"
 	"github.com/sylabs/singularity/internal/pkg/util/uri"
 	"github.com/sylabs/singularity/pkg/build/types"
 	library "github.com/sylabs/singularity/pkg/client/library"
@@ -82,7 +84,7 @@ func handleOCI(cmd *cobra.Command, u string) (string, error) {
 		DockerAuthConfig:            authConf,
 	}
 
-	sum, err := ociclient.ImageSHA(u, sysCtx)
+	sum, err := ociclient.ImageSHA(u, sysCtx, requestedPlatform(), strictPlatform)
 	if err != nil {
 		return "", fmt.Errorf("failed to get SHA of %v: %v", u, err)
 	}
@@ -104,6 +106,8 @@ func handleOCI(cmd *cobra.Command, u string) (string, error) {
 					NoTest:           true,
 					NoHTTPS:          noHTTPS,
 					DockerAuthConfig: authConf,
+					Platform:         imagePlatform,
+					StrictPlatform:   strictPlatform,
 				},
 			},
 		)
@@ -212,8 +216,11 @@ func replaceURIWithImage(cmd *cobra.Command, args []string) {
 		sylog.Fatalf("Unsupported transport type: %s", t)
 	}
 
-	if err != nil {
-		sylog.Fatalf("Unable to handle %s uri: %v", args[0], err)
+	if err == library.ErrNotFound {
+		err = errctx.WithHint(err, "check the image reference with 'singularity search'")
+		errctx.Fatal(exitcode.Wrap(exitcode.ImageNotFound, errctx.Wrap(err, "Unable to handle", args[0]+" uri")))
+	} else if err != nil {
+		errctx.Fatal(errctx.Wrap(err, "Unable to handle", args[0]+" uri"))
 	}
 
 	args[0] = image
@@ -21,6 +21,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/plugin"
 	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/image/unpacker"
+	"github.com/sylabs/singularity/pkg/util/features"
 	"github.com/sylabs/singularity/pkg/util/nvidia"
 
 	"github.com/spf13/cobra"
@@ -31,10 +32,17 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/security"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/internal/pkg/util/errctx"
 	"github.com/sylabs/singularity/internal/pkg/util/exec"
+	"github.com/sylabs/singularity/internal/pkg/util/exitcode"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/gui"
+	"github.com/sylabs/singularity/internal/pkg/util/krb5"
+	"github.com/sylabs/singularity/internal/pkg/util/scheduler"
+	"github.com/sylabs/singularity/internal/pkg/util/signal"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+	"golang.org/x/sys/unix"
 )
 
 // EnsureRootPriv ensures that a command is executed with root privileges.
@@ -51,7 +59,7 @@ func EnsureRootPriv(cmd *cobra.Command, args []string) {
 	}
 }
 
-func convertImage(filename string, unsquashfsPath string) (string, error) {
+func convertImage(filename string, unsquashfsPath string, tmpdir string) (string, error) {
 	img, err := image.Init(filename, false)
 	if err != nil {
 		return "", fmt.Errorf("could not open image %s: %s", filename, err)
@@ -78,7 +86,9 @@ func convertImage(filename string, unsquashfsPath string) (string, error) {
 	}
 
 	// keep compatibility with v2
-	tmpdir := os.Getenv("SINGULARITY_LOCALCACHEDIR")
+	if tmpdir == "" {
+		tmpdir = os.Getenv("SINGULARITY_LOCALCACHEDIR")
+	}
 	if tmpdir == "" {
 		tmpdir = os.Getenv("SINGULARITY_CACHEDIR")
 	}
@@ -194,7 +204,33 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		if err != nil {
 			sylog.Fatalf("Failed to determine image absolute path for %s: %s", image, err)
 		}
+		if _, err := os.Stat(abspath); os.IsNotExist(err) {
+			err = errctx.WithHint(errctx.Wrap(err, "image", image+" not found"), "check the image path or pull the image first with 'singularity pull'")
+			errctx.Fatal(exitcode.Wrap(exitcode.ImageNotFound, err))
+		}
 		engineConfig.SetImage(abspath)
+		applyLabelFlags(engineConfig, abspath)
+
+		if ComposePath != "" {
+			paths, err := composeImages(abspath, ComposePath)
+			if err != nil {
+				sylog.Fatalf("%s", err)
+			}
+			engineConfig.SetComposeImage(paths)
+		}
+	}
+
+	// bind paths can refer to the job of the scheduler running singularity
+	// with --job-templates
+	jobVars := scheduler.Detect(os.Getenv)
+	if JobTemplates {
+		for i, bind := range BindPaths {
+			p, err := jobVars.ExpandPath(bind, os.Getenv)
+			if err != nil {
+				sylog.Fatalf("Invalid bind path %s: %s", bind, err)
+			}
+			BindPaths[i] = p
+		}
 	}
 
 	if !NoNvidia && (Nvidia || engineConfig.File.AlwaysUseNv) {
@@ -238,6 +274,62 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	engineConfig.SetWritableImage(IsWritable)
 	engineConfig.SetNoHome(NoHome)
 	engineConfig.SetNv(Nvidia)
+	engineConfig.SetHostSingularity(HostSingularity)
+
+	if PtyTiming != "" {
+		abspath, err := filepath.Abs(PtyTiming)
+		if err != nil {
+			sylog.Fatalf("failed to determine %s absolute path: %s", PtyTiming, err)
+		}
+		engineConfig.SetPtyTiming(abspath)
+		Pty = true
+	}
+	engineConfig.SetPty(Pty)
+	if RusageFile != "" {
+		abspath, err := filepath.Abs(RusageFile)
+		if err != nil {
+			sylog.Fatalf("failed to determine %s absolute path: %s", RusageFile, err)
+		}
+		engineConfig.SetRusageFile(abspath)
+		Rusage = true
+	}
+	engineConfig.SetRusage(Rusage)
+	if ObserveFile != "" {
+		abspath, err := filepath.Abs(ObserveFile)
+		if err != nil {
+			sylog.Fatalf("failed to determine %s absolute path: %s", ObserveFile, err)
+		}
+		engineConfig.SetObserveFile(abspath)
+		Observe = true
+	}
+	if Observe && engineConfig.GetInstanceJoin() {
+		sylog.Fatalf("--observe is not supported with a running instance, use it with instance start")
+	}
+	engineConfig.SetObserve(Observe)
+	if ExecTimeout != "" {
+		timeout, err := parseTimeout(ExecTimeout)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		stopSig, err := signal.Convert(ExecStopSignal)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		engineConfig.SetTimeout(timeout)
+		engineConfig.SetStopSignal(int(stopSig))
+	}
+	engineConfig.SetStrictPlatform(strictPlatform)
+
+	if err := config.ParseTHP(THP); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	engineConfig.SetTHP(THP)
+	if _, err := config.ParseMemPolicy(MemPolicy); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	engineConfig.SetMemPolicy(MemPolicy)
+	engineConfig.SetNoImageSeccomp(NoImageSeccomp)
+	engineConfig.SetEnvViaFile(EnvViaFile)
 	engineConfig.SetAddCaps(AddCaps)
 	engineConfig.SetDropCaps(DropCaps)
 
@@ -298,8 +390,12 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 
 	checkPrivileges(IsBoot, "--boot", func() {})
 
+	// --contain and --containall are compositions of the finer
+	// grained containment flags
 	if IsContained || IsContainAll || IsBoot {
 		engineConfig.SetContain(true)
+		IsPrivateTmp = true
+		IsPrivateDevs = true
 
 		if IsContainAll {
 			PidNamespace = true
@@ -307,8 +403,23 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			IsCleanEnv = true
 		}
 	}
+	engineConfig.SetPrivateTmp(IsPrivateTmp)
+	engineConfig.SetPrivateDevs(IsPrivateDevs)
 
-	engineConfig.SetScratchDir(ScratchPath)
+	if NoInitNet {
+		if cobraCmd.Flag("network").Changed && Network != "none" {
+			sylog.Fatalf("--no-init-net doesn't set up any network, --network %s can't be used with it", Network)
+		}
+		NetNamespace = true
+		engineConfig.SetNetwork("none")
+	}
+
+	engineConfig.SetScratchDir(setAutoScratch(engineConfig, ScratchPath))
+
+	if _, err := config.ParseTmpPolicies(TmpPolicy); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	engineConfig.SetTmpPolicy(TmpPolicy)
 	engineConfig.SetWorkdir(WorkdirPath)
 
 	homeSlice := strings.Split(HomePath, ":")
@@ -317,6 +428,16 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		sylog.Fatalf("home argument has incorrect number of elements: %v", len(homeSlice))
 	}
 
+	homeMode, err := config.ParseHomeMode(HomeMode)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if NoHome && homeMode.Type != config.HostHome {
+		sylog.Fatalf("--no-home and --home-mode %s are mutually exclusive", homeMode.Type)
+	}
+	engineConfig.SetHomeMode(HomeMode)
+	engineConfig.SetPasswdEntries(PasswdEntries)
+
 	engineConfig.SetHomeSource(homeSlice[0])
 	if len(homeSlice) == 1 {
 		engineConfig.SetHomeDest(homeSlice[0])
@@ -335,6 +456,27 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		engineConfig.SetInstance(true)
 		engineConfig.SetBootInstance(IsBoot)
 
+		// relay sd_notify messages when started by a Type=notify unit
+		if notifySocket := os.Getenv("NOTIFY_SOCKET"); notifySocket != "" {
+			engineConfig.SetNotifySocket(notifySocket)
+		}
+		engineConfig.SetNotifyURLs(instanceNotifyURLs)
+		engineConfig.SetNotifyCommands(instanceNotifyCommands)
+
+		// stop parameters are recorded in the instance file and
+		// used by instance stop
+		if cobraCmd.Flags().Changed("stop-signal") {
+			stopSig, err := signal.Convert(ExecStopSignal)
+			if err != nil {
+				sylog.Fatalf("%s", err)
+			}
+			engineConfig.SetStopSignal(int(stopSig))
+		}
+		if instanceStopTimeout < 0 {
+			sylog.Fatalf("invalid --stop-timeout %d, expected a positive number of seconds", instanceStopTimeout)
+		}
+		engineConfig.SetStopTimeout(instanceStopTimeout)
+
 		_, err := instance.Get(name, instance.SingSubDir)
 		if err == nil {
 			sylog.Fatalf("instance %s already exists", name)
@@ -377,9 +519,19 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	if IpcNamespace {
 		generator.AddOrReplaceLinuxNamespace("ipc", "")
 	}
+	if CgroupNamespace {
+		generator.AddOrReplaceLinuxNamespace("cgroup", "")
+	}
 	if !UserNamespace {
-		if _, err := os.Stat(starter); os.IsNotExist(err) {
-			sylog.Verbosef("starter-suid not found, using user namespace")
+		// root only needs starter-suid to be installed, users also need
+		// the setuid workflow to be usable
+		matrix := features.Detect(engineConfig.File)
+		setuid := matrix.Get(features.Setuid)
+		if _, err := os.Stat(starter); os.IsNotExist(err) || (os.Getuid() != 0 && !setuid.Available) {
+			if userns := matrix.Get(features.UserNamespace); !userns.Available {
+				sylog.Fatalf("Setuid workflow not available (%s) and user namespace not available (%s)", setuid.Reason, userns.Reason)
+			}
+			sylog.Verbosef("Setuid workflow not available (%s), using user namespace", setuid.Reason)
 			UserNamespace = true
 		}
 	}
@@ -399,9 +551,29 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 
 	// Copy and cache environment
 	environment := os.Environ()
+	if JobTemplates {
+		environment = expandEnvTemplates(environment, jobVars)
+	}
 
 	// Clean environment
 	env.SetContainerEnv(&generator, environment, IsCleanEnv, engineConfig.GetHomeDest())
+	for _, e := range jobVars.Environ() {
+		kv := strings.SplitN(e, "=", 2)
+		generator.AddProcessEnv(kv[0], kv[1])
+	}
+
+	if Krb5 {
+		setKrb5(&generator, engineConfig)
+	}
+	if XDGRuntimeDir || SessionBus {
+		setDesktopSession(&generator, engineConfig)
+	}
+	if GUI {
+		setGUI(&generator, engineConfig)
+	}
+	if ALSA || Pulse || Video {
+		setMedia(&generator, engineConfig)
+	}
 
 	// force to use getwd syscall
 	os.Unsetenv("PWD")
@@ -420,31 +592,60 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		sylog.Warningf("can't determine current working directory: %s", err)
 	}
 
-	Env := []string{sylog.GetEnvVar()}
+	Env := []string{sylog.GetEnvVar(), sylog.GetJSONErrorsEnvVar()}
 
 	generator.AddProcessEnv("SINGULARITY_APPNAME", AppName)
 
+	unsquashfsPath := ""
+	if engineConfig.File.MksquashfsPath != "" {
+		d := filepath.Dir(engineConfig.File.MksquashfsPath)
+		unsquashfsPath = filepath.Join(d, "unsquashfs")
+	}
+
 	// convert image file to sandbox if image contains
 	// a squashfs filesystem
-	if UserNamespace && fs.IsFile(image) {
-		unsquashfsPath := ""
-		if engineConfig.File.MksquashfsPath != "" {
-			d := filepath.Dir(engineConfig.File.MksquashfsPath)
-			unsquashfsPath = filepath.Join(d, "unsquashfs")
-		}
+	if StageTo != "" && fs.IsFile(image) && !DryRun {
+		stageImage(engineConfig, image, UserNamespace, unsquashfsPath)
+	} else if UserNamespace && fs.IsFile(image) && !DryRun {
 		sylog.Verbosef("User namespace requested, convert image %s to sandbox", image)
 		sylog.Infof("Convert SIF file to sandbox...")
-		dir, err := convertImage(image, unsquashfsPath)
+		dir, err := convertImage(image, unsquashfsPath, "")
 		if err != nil {
 			sylog.Fatalf("while extracting %s: %s", image, err)
 		}
 		engineConfig.SetImage(dir)
 		engineConfig.SetDeleteImage(true)
 		generator.AddProcessEnv("SINGULARITY_CONTAINER", dir)
+	} else if engineConfig.File.CopyNFSImages && fs.IsFile(image) && !DryRun {
+		copyNFSImage(engineConfig, image)
 	}
 
 	plugin.FlagHookCallbacks(engineConfig)
 
+	for _, path := range OciPatchPaths {
+		patch, err := ioutil.ReadFile(path)
+		if err != nil {
+			sylog.Fatalf("failed to read OCI patch file: %s", err)
+		}
+		if err := ociConfig.ApplyMergePatch(patch); err != nil {
+			sylog.Fatalf("failed to apply OCI patch file %s: %s", path, err)
+		}
+	}
+
+	if DryRun {
+		for k, v := range containmentAnnotations(engineConfig, NetNamespace) {
+			generator.AddAnnotation(k, v)
+		}
+		b, err := json.MarshalIndent(&ociConfig.Spec, "", "\t")
+		if err != nil {
+			sylog.Fatalf("failed to marshal OCI runtime specification: %s", err)
+		}
+		fmt.Println(string(b))
+		os.Exit(0)
+	}
+
+	recordInvocation(cobraCmd, engineConfig)
+
 	cfg := &config.Common{
 		EngineName:   singularityConfig.Name,
 		ContainerID:  name,
@@ -506,3 +707,432 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		}
 	}
 }
+
+// setAutoScratch allocates the job scratch directory if --scratch auto
+// was requested and returns the remaining scratch directories. The
+// directory is provided by a plugin if any, otherwise it's created in
+// the scratch auto path set in configuration file
+func setAutoScratch(engineConfig *singularityConfig.EngineConfig, scratch []string) []string {
+	var dirs []string
+	auto := false
+
+	for _, s := range scratch {
+		for _, dir := range strings.Split(s, ",") {
+			if dir == "auto" {
+				auto = true
+			} else if dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	if !auto {
+		return dirs
+	}
+
+	if p := plugin.ScratchProvider(); p != nil {
+		sylog.Debugf("Allocating scratch directory with plugin %s", p.Name)
+		dir, err := p.Allocate(engineConfig)
+		if err != nil {
+			sylog.Fatalf("scratch provider %s failed to allocate scratch directory: %s", p.Name, err)
+		}
+		engineConfig.SetAutoScratch(dir)
+		return dirs
+	}
+
+	pw, err := user.GetPwUID(uint32(os.Getuid()))
+	if err != nil {
+		sylog.Fatalf("failed to retrieve user information: %s", err)
+	}
+
+	jobID := "local"
+	for _, e := range []string{"SLURM_JOB_ID", "PBS_JOBID", "LSB_JOBID", "JOB_ID"} {
+		if id := os.Getenv(e); id != "" {
+			jobID = strings.Replace(id, "/", "_", -1)
+			break
+		}
+	}
+
+	dir, err := ioutil.TempDir(engineConfig.File.ScratchAutoPath, "singularity-scratch-"+pw.Name+"-"+jobID+"-")
+	if err != nil {
+		sylog.Fatalf("failed to allocate scratch directory: %s", err)
+	}
+	if err := checkScratchOwner(dir); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	sylog.Verbosef("Allocated scratch directory %s", dir)
+	engineConfig.SetAutoScratch(dir)
+
+	return dirs
+}
+
+// checkScratchOwner ensures the allocated scratch directory is a directory
+// owned by the user and not accessible to others
+func checkScratchOwner(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check scratch directory %s: %s", dir, err)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !fi.IsDir() || !ok || int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("scratch directory %s is not a directory owned by the user", dir)
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("scratch directory %s is accessible to other users", dir)
+	}
+	return nil
+}
+
+// setKrb5 provides the user Kerberos credential cache and configuration
+// to the container. KCM and keyring caches are copied to a file cache by
+// the translation helper set in configuration file if any, otherwise
+// they are used through the KCM socket or the shared kernel keyring
+func setKrb5(generator *generate.Generator, engineConfig *singularityConfig.EngineConfig) {
+	conf := krb5.Conf()
+	cache := krb5.ParseCache(krb5.CacheName(conf, os.Getuid()))
+
+	switch cache.Type {
+	case krb5.FileCache, krb5.DirCache:
+	case krb5.KCMCache, krb5.KeyringCache:
+		helper := engineConfig.File.Krb5CCacheHelper
+		if helper == "" {
+			break
+		}
+		c, err := krb5.Translate(helper, cache)
+		if err != nil {
+			sylog.Fatalf("Failed to translate Kerberos credential cache %s: %s", cache, err)
+		}
+		sylog.Verbosef("Kerberos credential cache %s copied to %s", cache, c.Residual)
+		engineConfig.SetKrb5CCacheTemp(true)
+		cache = c
+	default:
+		sylog.Fatalf("Kerberos credential cache type %s is not supported by --krb5", cache.Type)
+	}
+
+	engineConfig.SetKrb5CCache(cache.String())
+	if cache.IsPath() {
+		if _, err := os.Stat(cache.Residual); err != nil {
+			sylog.Fatalf("Kerberos credential cache %s not found, run kinit first", cache)
+		}
+		// the cache is bound at the same path whatever its host location
+		cache.Residual = krb5.ContainerCache
+	}
+	generator.AddProcessEnv("KRB5CCNAME", cache.String())
+
+	if conf != "" {
+		engineConfig.SetKrb5Conf(conf)
+	} else {
+		sylog.Warningf("No Kerberos configuration found, container will use its own")
+	}
+}
+
+// setDesktopSession provides the user runtime directory and the session
+// D-Bus socket requested with --xdg-runtime-dir and --dbus to the
+// container, they are bound at their host location so the variables
+// pointing to them stay valid
+func setDesktopSession(generator *generate.Generator, engineConfig *singularityConfig.EngineConfig) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+
+	if XDGRuntimeDir {
+		if !fs.IsDir(runtimeDir) {
+			sylog.Fatalf("User runtime directory %s doesn't exist, is a desktop session running?", runtimeDir)
+		}
+		engineConfig.SetXDGRuntimeDir(runtimeDir)
+		generator.AddProcessEnv("XDG_RUNTIME_DIR", runtimeDir)
+		if display := os.Getenv("WAYLAND_DISPLAY"); display != "" {
+			generator.AddProcessEnv("WAYLAND_DISPLAY", display)
+		}
+	}
+
+	if !SessionBus {
+		return
+	}
+
+	address := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	if address == "" {
+		address = "unix:path=" + filepath.Join(runtimeDir, "bus")
+	}
+	socket, abstract := sessionBusSocket(address)
+	switch {
+	case socket != "":
+		if _, err := os.Stat(socket); err != nil {
+			sylog.Fatalf("Session D-Bus socket %s not found: %s", socket, err)
+		}
+		engineConfig.SetSessionBus(socket)
+		generator.AddProcessEnv("DBUS_SESSION_BUS_ADDRESS", "unix:path="+socket)
+	case abstract:
+		// abstract sockets are reachable from the host network namespace
+		// without bind
+		if NetNamespace {
+			sylog.Warningf("Session D-Bus abstract socket isn't reachable from a new network namespace")
+		}
+		generator.AddProcessEnv("DBUS_SESSION_BUS_ADDRESS", address)
+	default:
+		sylog.Fatalf("Session D-Bus address %q doesn't provide a unix socket", address)
+	}
+}
+
+// setGUI provides the X11 and Wayland displays of the session to the
+// container, with the environment variables needed to reach them
+func setGUI(generator *generate.Generator, engineConfig *singularityConfig.EngineConfig) {
+	display := os.Getenv("DISPLAY")
+	wayland := os.Getenv("WAYLAND_DISPLAY")
+	if display == "" && wayland == "" {
+		sylog.Fatalf("--gui requires a graphical session, neither DISPLAY nor WAYLAND_DISPLAY is set")
+	}
+	engineConfig.SetGUI(true)
+
+	if wayland != "" {
+		runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+		if runtimeDir == "" {
+			runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+		}
+		socket := gui.WaylandSocket(wayland, runtimeDir)
+		if _, err := os.Stat(socket); err != nil {
+			sylog.Warningf("Wayland display socket %s not found, ignoring WAYLAND_DISPLAY", socket)
+		} else {
+			engineConfig.SetWaylandSocket(socket)
+			generator.AddProcessEnv("XDG_RUNTIME_DIR", runtimeDir)
+			generator.AddProcessEnv("WAYLAND_DISPLAY", wayland)
+		}
+	}
+
+	if display == "" {
+		return
+	}
+	d, err := gui.ParseDisplay(display)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if d.IsLocal() {
+		// X servers also listen on an abstract socket reachable
+		// from the host network namespace
+		if _, err := os.Stat(d.Socket()); err == nil {
+			engineConfig.SetX11Socket(d.Socket())
+		} else if NetNamespace {
+			sylog.Warningf("X11 display socket %s not found, display %s is not reachable from a new network namespace", d.Socket(), display)
+		}
+	} else if NetNamespace && (d.Host == "localhost" || strings.HasPrefix(d.Host, "127.")) {
+		sylog.Warningf("Display %s forwarded by ssh is not reachable from a new network namespace", display)
+	}
+	if xauth := gui.XAuthority(getHomeDir()); fs.IsFile(xauth) {
+		engineConfig.SetXAuthority(xauth)
+		generator.AddProcessEnv("XAUTHORITY", gui.ContainerXAuthority)
+	}
+	generator.AddProcessEnv("DISPLAY", display)
+	if IpcNamespace {
+		// the MIT-SHM extension requires the IPC namespace of the X server
+		generator.AddProcessEnv("QT_X11_NO_MITSHM", "1")
+	}
+}
+
+// setMedia provides the sound and video devices and the PulseAudio server
+// of the session to the container
+func setMedia(generator *generate.Generator, engineConfig *singularityConfig.EngineConfig) {
+	var devices []string
+	if ALSA {
+		if !fs.IsDir(gui.SoundDir) {
+			sylog.Fatalf("--alsa requires sound devices, %s not found", gui.SoundDir)
+		}
+		devices = append(devices, gui.SoundDir)
+	}
+	if Video {
+		video := gui.VideoDevices()
+		if len(video) == 0 {
+			sylog.Fatalf("--video requires video devices, no /dev/video* device found")
+		}
+		devices = append(devices, video...)
+	}
+	for _, dev := range devices {
+		checkDeviceAccess(dev)
+	}
+	engineConfig.SetMediaDevices(devices)
+
+	if !Pulse {
+		return
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	socket := gui.PulseSocket(runtimeDir)
+	if socket == "" {
+		// remote servers are reached through the network, PULSE_SERVER
+		// is passed with the host environment
+		sylog.Verbosef("PulseAudio server %s is not a local socket, not binding it", os.Getenv("PULSE_SERVER"))
+		return
+	}
+	if _, err := os.Stat(socket); err != nil {
+		sylog.Fatalf("--pulse requires a PulseAudio server, socket %s not found", socket)
+	}
+	engineConfig.SetPulseSocket(socket)
+	generator.AddProcessEnv("PULSE_SERVER", "unix:"+socket)
+	if cookie := gui.PulseCookie(getHomeDir()); fs.IsFile(cookie) {
+		engineConfig.SetPulseCookie(cookie)
+		generator.AddProcessEnv("PULSE_COOKIE", gui.ContainerPulseCookie)
+	}
+}
+
+// checkDeviceAccess warns when the user can't open the sound or video
+// device path, access is granted by the group owning the devices
+func checkDeviceAccess(path string) {
+	dev := path
+	if path == gui.SoundDir {
+		dev = filepath.Join(path, "controlC0")
+	}
+	if unix.Access(dev, unix.R_OK|unix.W_OK) == nil {
+		return
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(dev, &st); err != nil {
+		return
+	}
+	group := strconv.FormatUint(uint64(st.Gid), 10)
+	if gr, err := user.GetGrGID(st.Gid); err == nil {
+		group = gr.Name
+	}
+	sylog.Warningf("%s is not accessible, the user must be a member of the %s group", path, group)
+}
+
+// sessionBusSocket returns the socket path of the first unix:path address
+// of the D-Bus address list, or if the first unix address is abstract
+func sessionBusSocket(address string) (string, bool) {
+	for _, addr := range strings.Split(address, ";") {
+		if !strings.HasPrefix(addr, "unix:") {
+			continue
+		}
+		for _, kv := range strings.Split(strings.TrimPrefix(addr, "unix:"), ",") {
+			switch {
+			case strings.HasPrefix(kv, "path="):
+				return strings.TrimPrefix(kv, "path="), false
+			case strings.HasPrefix(kv, "abstract="):
+				return "", true
+			}
+		}
+	}
+	return "", false
+}
+
+// expandEnvTemplates expands the job scheduler templates in the values of
+// SINGULARITYENV_ variables of environ
+func expandEnvTemplates(environ []string, jobVars scheduler.Vars) []string {
+	for i, e := range environ {
+		if !strings.HasPrefix(e, "SINGULARITYENV_") {
+			continue
+		}
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v, err := jobVars.ExpandTemplate(kv[1])
+		if err != nil {
+			sylog.Fatalf("Invalid value of environment variable %s: %s", kv[0], err)
+		}
+		environ[i] = kv[0] + "=" + v
+	}
+	return environ
+}
+
+// parseTimeout returns the wall-clock duration of the --timeout value,
+// either a Go duration (e.g. 90s, 30m, 2h) or a plain number of seconds
+func parseTimeout(s string) (time.Duration, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid --timeout %s, expected a positive duration such as 90s, 30m or 2h", s)
+	}
+	return d, nil
+}
+
+// containmentAnnotations describes the host resources shared with the
+// container, they are added to the --dry-run output as the mounts they
+// select are only known once the container is created
+func containmentAnnotations(engineConfig *singularityConfig.EngineConfig, netNamespace bool) map[string]string {
+	const prefix = "io.sylabs.singularity.containment."
+	file := engineConfig.File
+
+	home := "host"
+	if engineConfig.GetNoHome() || !file.MountHome {
+		home = "none"
+	} else if mode, err := config.ParseHomeMode(engineConfig.GetHomeMode()); err == nil && mode.Type != config.HostHome {
+		home = mode.String()
+	} else if engineConfig.GetCustomHome() {
+		home = engineConfig.GetHomeSource()
+	} else if engineConfig.GetContain() {
+		home = "private"
+	}
+
+	tmp := "host"
+	if !file.MountTmp {
+		tmp = "image"
+	} else if engineConfig.GetPrivateTmp() {
+		tmp = "private"
+		if w := engineConfig.GetWorkdir(); w != "" {
+			tmp = w
+		}
+	}
+
+	dev := "host"
+	if file.MountDev == "minimal" || engineConfig.GetPrivateDevs() {
+		dev = "minimal"
+	} else if file.MountDev == "no" {
+		dev = "image"
+	}
+
+	binds := "host"
+	if engineConfig.GetContain() {
+		binds = "none"
+	}
+
+	network := "host"
+	if netNamespace {
+		network = engineConfig.GetNetwork()
+	}
+
+	return map[string]string{
+		prefix + "home":    home,
+		prefix + "tmp":     tmp,
+		prefix + "dev":     dev,
+		prefix + "binds":   binds,
+		prefix + "network": network,
+	}
+}
+
+// composeImages returns the absolute paths of the images of the --compose
+// value, stacked in order on top of the container image
+func composeImages(image, value string) ([]string, error) {
+	if IsWritable {
+		return nil, fmt.Errorf("--compose can't be used with --writable, compose images are read-only")
+	}
+
+	seen := map[string]bool{image: true}
+	for _, o := range OverlayPath {
+		if abspath, err := filepath.Abs(strings.SplitN(o, ":", 2)[0]); err == nil {
+			seen[abspath] = true
+		}
+	}
+
+	var paths []string
+	for _, p := range strings.Split(value, ":") {
+		if p == "" {
+			return nil, fmt.Errorf("empty image path in --compose %s", value)
+		}
+		abspath, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine compose image absolute path for %s: %s", p, err)
+		}
+		if seen[abspath] {
+			return nil, fmt.Errorf("image %s is already the container image, an overlay or a compose image", p)
+		}
+		seen[abspath] = true
+		if _, err := os.Stat(abspath); err != nil {
+			return nil, fmt.Errorf("compose image %s: %s", p, err)
+		}
+		paths = append(paths, abspath)
+	}
+	return paths, nil
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckScratchOwner(t *testing.T) {
+	base, err := ioutil.TempDir("", "scratch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	private := filepath.Join(base, "private")
+	shared := filepath.Join(base, "shared")
+	link := filepath.Join(base, "link")
+
+	if err := os.Mkdir(private, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(shared, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(shared, 0777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(private, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkScratchOwner(private); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	for _, dir := range []string{shared, link, filepath.Join(base, "missing")} {
+		if err := checkScratchOwner(dir); err == nil {
+			t.Errorf("unexpected success for %s", dir)
+		}
+	}
+}
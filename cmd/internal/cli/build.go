@@ -7,17 +7,29 @@ package cli
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	ocitypes "github.com/containers/image/types"
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/build"
+	"github.com/sylabs/singularity/internal/pkg/build/assemblers"
+	"github.com/sylabs/singularity/internal/pkg/build/optimize"
+	"github.com/sylabs/singularity/internal/pkg/plugin"
 	scs "github.com/sylabs/singularity/internal/pkg/remote"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/platform"
 	legacytypes "github.com/sylabs/singularity/pkg/build/legacy"
 	legacyparser "github.com/sylabs/singularity/pkg/build/legacy/parser"
+	"github.com/sylabs/singularity/pkg/build/types/parser"
 	"github.com/sylabs/singularity/pkg/sypgp"
 )
 
@@ -31,6 +43,9 @@ var (
 	force          bool
 	update         bool
 	noTest         bool
+	testTimeout    time.Duration
+	testRetries    int
+	keepFailed     bool
 	sections       []string
 	noHTTPS        bool
 	tmpDir         string
@@ -38,6 +53,28 @@ var (
 	dockerPassword string
 	dockerLogin    bool
 	noCleanUp      bool
+	disableCache   bool
+	cacheSections  bool
+	buildArgs      []string
+	buildArgFile   string
+	buildSecrets   []string
+	imagePlatform  string
+	buildArch      string
+	strictPlatform bool
+	reproducible   bool
+	expectDigest   string
+	optimizeSpec   string
+	blockSize      string
+	mksquashfsProc uint
+	mksquashfsMem  string
+	lint           bool
+	contextLimit   string
+	attachID       string
+	buildNetwork   string
+	buildDNS       string
+	resolvConf     string
+	buildFakeroot  bool
+	buildProot     bool
 )
 
 func init() {
@@ -49,7 +86,7 @@ func init() {
 	BuildCmd.Flags().StringSliceVar(&sections, "section", []string{"all"}, "only run specific section(s) of deffile (setup, post, files, environment, test, labels, none)")
 	BuildCmd.Flags().SetAnnotation("section", "envkey", []string{"SECTION"})
 
-	BuildCmd.Flags().BoolVar(&isJSON, "json", false, "interpret build definition as JSON")
+	BuildCmd.Flags().BoolVar(&isJSON, "json", false, "interpret build definition as JSON, see 'singularity def schema'")
 	BuildCmd.Flags().SetAnnotation("json", "envkey", []string{"JSON"})
 
 	BuildCmd.Flags().BoolVarP(&force, "force", "F", false, "delete and overwrite an image if it currently exists")
@@ -61,6 +98,17 @@ func init() {
 	BuildCmd.Flags().BoolVarP(&noTest, "notest", "T", false, "build without running tests in %test section")
 	BuildCmd.Flags().SetAnnotation("notest", "envkey", []string{"NOTEST"})
 
+	BuildCmd.Flags().DurationVar(&testTimeout, "test-timeout", 0, "kill the %test section after this duration (e.g. 90s, 30m), overrides the TestTimeout header")
+	BuildCmd.Flags().SetAnnotation("test-timeout", "argtag", []string{"<duration>"})
+	BuildCmd.Flags().SetAnnotation("test-timeout", "envkey", []string{"TEST_TIMEOUT"})
+
+	BuildCmd.Flags().IntVar(&testRetries, "test-retries", 0, "run the %test section again up to N times when it fails, overrides the TestRetries header")
+	BuildCmd.Flags().SetAnnotation("test-retries", "argtag", []string{"<N>"})
+	BuildCmd.Flags().SetAnnotation("test-retries", "envkey", []string{"TEST_RETRIES"})
+
+	BuildCmd.Flags().BoolVar(&keepFailed, "keep-failed", false, "assemble the image even when the %test section fails, the build still exits with an error")
+	BuildCmd.Flags().SetAnnotation("keep-failed", "envkey", []string{"KEEP_FAILED"})
+
 	BuildCmd.Flags().BoolVarP(&remote, "remote", "r", false, "build image remotely (does not require root)")
 	BuildCmd.Flags().SetAnnotation("remote", "envkey", []string{"REMOTE"})
 
@@ -70,6 +118,14 @@ func init() {
 	BuildCmd.Flags().StringVar(&builderURL, "builder", "https://build.sylabs.io", "remote Build Service URL, setting this implies --remote")
 	BuildCmd.Flags().SetAnnotation("builder", "envkey", []string{"BUILDER"})
 
+	BuildCmd.Flags().StringVar(&contextLimit, "context-limit", "128MiB", "size limit of the local %files sources uploaded by remote builds, files listed in .singularityignore are excluded")
+	BuildCmd.Flags().SetAnnotation("context-limit", "argtag", []string{"<size>"})
+	BuildCmd.Flags().SetAnnotation("context-limit", "envkey", []string{"CONTEXT_LIMIT"})
+
+	// no environment variable, a build ID is only valid for one build
+	BuildCmd.Flags().StringVar(&attachID, "attach", "", "attach to a remote build submitted earlier, stream its output and download the image given as only argument, this implies --remote")
+	BuildCmd.Flags().SetAnnotation("attach", "argtag", []string{"<build ID>"})
+
 	BuildCmd.Flags().StringVar(&libraryURL, "library", "https://library.sylabs.io", "container Library URL")
 	BuildCmd.Flags().SetAnnotation("library", "envkey", []string{"LIBRARY"})
 
@@ -82,9 +138,75 @@ func init() {
 	BuildCmd.Flags().BoolVar(&noCleanUp, "no-cleanup", false, "do NOT clean up bundle after failed build, can be helpul for debugging")
 	BuildCmd.Flags().SetAnnotation("no-cleanup", "envkey", []string{"NO_CLEANUP"})
 
+	BuildCmd.Flags().BoolVar(&disableCache, "disable-cache", false, "do NOT use or store cached results of %files and %post sections, and squashfs images of sandboxes")
+	BuildCmd.Flags().SetAnnotation("disable-cache", "envkey", []string{"DISABLE_CACHE"})
+
+	BuildCmd.Flags().BoolVar(&cacheSections, "cache-sections", false, "use and store cached results of %files and %post sections of stages without %setup section")
+	BuildCmd.Flags().SetAnnotation("cache-sections", "envkey", []string{"CACHE_SECTIONS"})
+
+	BuildCmd.Flags().StringArrayVar(&buildArgs, "build-arg", []string{}, "set the value of a {{ name }} placeholder of the definition file, as name=value")
+	BuildCmd.Flags().SetAnnotation("build-arg", "envkey", []string{"BUILD_ARG"})
+
+	BuildCmd.Flags().StringVar(&buildArgFile, "build-arg-file", "", "read name=value build arguments from a file, --build-arg values take precedence")
+	BuildCmd.Flags().SetAnnotation("build-arg-file", "envkey", []string{"BUILD_ARG_FILE"})
+
+	// no environment variable, SINGULARITY_SECRET is used by key list
+	BuildCmd.Flags().StringArrayVar(&buildSecrets, "secret", []string{}, "mount a secret file in /run/secrets during %post, as id=<id>,src=<path>")
+
+	BuildCmd.Flags().BoolVar(&reproducible, "reproducible", false, "produce identical images from the same definition, timestamps are set to SOURCE_DATE_EPOCH")
+	BuildCmd.Flags().SetAnnotation("reproducible", "envkey", []string{"REPRODUCIBLE"})
+
+	BuildCmd.Flags().StringVar(&expectDigest, "expect-digest", "", "fail a reproducible build if the SIF image digest differs from sha256:<hex>")
+	BuildCmd.Flags().SetAnnotation("expect-digest", "argtag", []string{"<digest>"})
+	BuildCmd.Flags().SetAnnotation("expect-digest", "envkey", []string{"EXPECT_DIGEST"})
+
+	BuildCmd.Flags().StringVar(&optimizeSpec, "optimize", "", "run optimization passes before assembling the image, as a comma separated list of profiles (safe, small), passes and compress=<alg>, 'help' lists them")
+	BuildCmd.Flags().SetAnnotation("optimize", "argtag", []string{"<profile>"})
+	BuildCmd.Flags().SetAnnotation("optimize", "envkey", []string{"OPTIMIZE"})
+
+	BuildCmd.Flags().StringVar(&blockSize, "squashfs-block-size", "", "block size of the squashfs file system of SIF images, a power of two between 4K and 1M")
+	BuildCmd.Flags().SetAnnotation("squashfs-block-size", "argtag", []string{"<size>"})
+	BuildCmd.Flags().SetAnnotation("squashfs-block-size", "envkey", []string{"SQUASHFS_BLOCK_SIZE"})
+
+	BuildCmd.Flags().UintVar(&mksquashfsProc, "mksquashfs-procs", 0, "number of CPUs used by mksquashfs to create SIF images, overrides the singularity.conf value (default all CPUs)")
+	BuildCmd.Flags().SetAnnotation("mksquashfs-procs", "argtag", []string{"<N>"})
+	BuildCmd.Flags().SetAnnotation("mksquashfs-procs", "envkey", []string{"MKSQUASHFS_PROCS"})
+
+	BuildCmd.Flags().StringVar(&mksquashfsMem, "mksquashfs-mem", "", "memory used by mksquashfs to create SIF images (e.g. 4G), overrides the singularity.conf value")
+	BuildCmd.Flags().SetAnnotation("mksquashfs-mem", "argtag", []string{"<size>"})
+	BuildCmd.Flags().SetAnnotation("mksquashfs-mem", "envkey", []string{"MKSQUASHFS_MEM"})
+
+	// no environment variable, arguments are validated before they are read
+	BuildCmd.Flags().BoolVar(&lint, "lint", false, "check the definition file given as only argument for errors without building it")
+
+	// distinct environment variables, SINGULARITY_NETWORK and
+	// SINGULARITY_DNS are used by actions
+	BuildCmd.Flags().StringVar(&buildNetwork, "network", "host", "network of the %post and %test sections: host, none for a loopback interface only, or comma separated CNI networks")
+	BuildCmd.Flags().SetAnnotation("network", "argtag", []string{"<name>"})
+	BuildCmd.Flags().SetAnnotation("network", "envkey", []string{"BUILD_NETWORK"})
+
+	BuildCmd.Flags().StringVar(&buildDNS, "dns", "", "comma separated list of DNS servers written to the resolv.conf of the %post and %test sections")
+	BuildCmd.Flags().SetAnnotation("dns", "envkey", []string{"BUILD_DNS"})
+
+	BuildCmd.Flags().StringVar(&resolvConf, "resolv-conf", "", "bind this file at /etc/resolv.conf during the %post and %test sections instead of the host resolv.conf")
+	BuildCmd.Flags().SetAnnotation("resolv-conf", "argtag", []string{"<path>"})
+	BuildCmd.Flags().SetAnnotation("resolv-conf", "envkey", []string{"RESOLV_CONF"})
+
+	BuildCmd.Flags().BoolVarP(&buildFakeroot, "fakeroot", "f", false, "build as a fake root user without root privileges, with the first available of user namespaces, fakechroot or proot")
+	BuildCmd.Flags().SetAnnotation("fakeroot", "envkey", []string{"FAKEROOT"})
+
+	BuildCmd.Flags().BoolVar(&buildProot, "proot", false, "build as a fake root user with proot, even when user namespaces or fakechroot are available")
+	BuildCmd.Flags().SetAnnotation("proot", "envkey", []string{"BUILD_PROOT"})
+
 	BuildCmd.Flags().AddFlag(actionFlags.Lookup("docker-username"))
 	BuildCmd.Flags().AddFlag(actionFlags.Lookup("docker-password"))
 	BuildCmd.Flags().AddFlag(actionFlags.Lookup("docker-login"))
+	BuildCmd.Flags().AddFlag(actionFlags.Lookup("platform"))
+	BuildCmd.Flags().AddFlag(actionFlags.Lookup("strict-platform"))
+
+	BuildCmd.Flags().StringVar(&buildArch, "arch", "", "build a linux image for this architecture (like arm64) with build scripts run under qemu emulation, shorthand for --platform linux/<arch>")
+	BuildCmd.Flags().SetAnnotation("arch", "argtag", []string{"<arch>"})
+	BuildCmd.Flags().SetAnnotation("arch", "envkey", []string{"BUILD_ARCH"})
 
 	SingularityCmd.AddCommand(BuildCmd)
 }
@@ -92,7 +214,12 @@ func init() {
 // BuildCmd represents the build command
 var BuildCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
-	Args:                  cobra.ExactArgs(2),
+	Args: func(cmd *cobra.Command, args []string) error {
+		if lint || attachID != "" {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
 
 	Use:              docs.BuildUse,
 	Short:            docs.BuildShort,
@@ -105,7 +232,7 @@ var BuildCmd = &cobra.Command{
 
 func preRun(cmd *cobra.Command, args []string) {
 	// Always perform remote build when builder flag is set
-	if cmd.Flags().Lookup("builder").Changed {
+	if cmd.Flags().Lookup("builder").Changed || attachID != "" {
 		cmd.Flags().Lookup("remote").Value.Set("true")
 	}
 
@@ -113,11 +240,14 @@ func preRun(cmd *cobra.Command, args []string) {
 }
 
 // checkTargetCollision makes sure output target doesn't exist, or is ok to overwrite
-func checkBuildTarget(path string, update bool) bool {
+func checkBuildTarget(path string, update bool, spec string) bool {
 	if f, err := os.Stat(path); err == nil {
 		if update && !f.IsDir() {
 			sylog.Fatalf("Only sandbox updating is supported.")
 		}
+		if !update && !force && spec == build.StdinSpec {
+			sylog.Fatalf("Build target already exists, use --force to overwrite it when reading the definition from standard input")
+		}
 		if !update && !force {
 			reader := bufio.NewReader(os.Stdin)
 			fmt.Print("Build target already exists. Do you want to overwrite? [N/y] ")
@@ -136,9 +266,213 @@ func checkBuildTarget(path string, update bool) bool {
 	return true
 }
 
+// buildArgsMap returns the build arguments read from --build-arg-file
+// and set with --build-arg
+func buildArgsMap() map[string]string {
+	args := make(map[string]string)
+
+	if buildArgFile != "" {
+		f, err := os.Open(buildArgFile)
+		if err != nil {
+			sylog.Fatalf("Unable to open build argument file: %s", err)
+		}
+		args, err = parser.ReadBuildArgs(f)
+		f.Close()
+		if err != nil {
+			sylog.Fatalf("While reading build argument file %s: %s", buildArgFile, err)
+		}
+	}
+
+	for _, arg := range buildArgs {
+		a, err := parser.ReadBuildArgs(strings.NewReader(arg))
+		if err != nil || len(a) != 1 {
+			sylog.Fatalf("Invalid build argument %q, expected name=value", arg)
+		}
+		for k, v := range a {
+			args[k] = v
+		}
+	}
+	return args
+}
+
+// secretsMap returns the secret files set with --secret by id
+func secretsMap() map[string]string {
+	if len(buildSecrets) == 0 {
+		return nil
+	}
+	secrets := make(map[string]string)
+	for _, s := range buildSecrets {
+		id, src, err := build.ParseSecret(s)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		if _, ok := secrets[id]; ok {
+			sylog.Fatalf("Secret %s set more than once", id)
+		}
+		secrets[id] = src
+	}
+	return secrets
+}
+
+// lintDefinition reports the problems found in the definition file spec,
+// or read from standard input, and exits with an error if there are any
+func lintDefinition(spec string) {
+	r := os.Stdin
+	if spec != build.StdinSpec {
+		f, err := os.Open(spec)
+		if err != nil {
+			sylog.Fatalf("Unable to open definition file: %s", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		sylog.Fatalf("While reading %s: %s", spec, err)
+	}
+
+	problems, err := parser.Lint(bytes.NewReader(data), "")
+	if err != nil {
+		sylog.Fatalf("While checking %s: %s", spec, err)
+	}
+	for _, p := range problems {
+		fmt.Printf("%s: %s\n", spec, p)
+	}
+
+	// included files are checked by expanding them
+	path := spec
+	if spec == build.StdinSpec {
+		path = ""
+	}
+	n := len(problems)
+	if _, err := parser.ExpandIncludes(bytes.NewReader(data), path); err != nil {
+		fmt.Printf("%s\n", err)
+		n++
+	}
+
+	if n > 0 {
+		sylog.Fatalf("Found %d problem(s) in %s", n, spec)
+	}
+	sylog.Infof("No problem found in %s", spec)
+}
+
+// sourceDateEpoch returns the time set by the SOURCE_DATE_EPOCH
+// environment variable for reproducible builds, or the Unix epoch
+func sourceDateEpoch() int64 {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return 0
+	}
+	epoch, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || epoch < 0 {
+		sylog.Fatalf("Invalid SOURCE_DATE_EPOCH %q, expected a number of seconds since the Unix epoch", v)
+	}
+	return epoch
+}
+
+// digestRegexp matches the SHA256 image digests of --expect-digest
+var digestRegexp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// expectedDigest returns the image digest set with --expect-digest in
+// lower case, reproducible builds of SIF images are required
+func expectedDigest(format string) string {
+	if expectDigest == "" {
+		return ""
+	}
+	if !reproducible {
+		sylog.Fatalf("--expect-digest requires --reproducible")
+	}
+	if format != "sif" {
+		sylog.Fatalf("--expect-digest is only supported by SIF images")
+	}
+	digest := strings.ToLower(expectDigest)
+	if !digestRegexp.MatchString(digest) {
+		sylog.Fatalf("Invalid digest %q, expected sha256:<64 hexadecimal digits>", expectDigest)
+	}
+	return digest
+}
+
+// optimizePlan returns the optimization passes and the compression
+// selected with --optimize, passes registered by plugins can be selected
+// by name
+func optimizePlan() optimize.Plan {
+	if optimizeSpec == "" {
+		return optimize.Plan{}
+	}
+	for _, p := range plugin.OptimizePasses() {
+		err := optimize.Register(optimize.Pass{
+			Name:        p.Name,
+			Description: "provided by a plugin",
+			Run:         p.Run,
+		})
+		if err != nil {
+			sylog.Fatalf("Unable to register optimization pass of plugin: %s", err)
+		}
+	}
+	if optimizeSpec == "help" {
+		fmt.Print(optimize.Help())
+		os.Exit(0)
+	}
+	plan, err := optimize.Parse(optimizeSpec)
+	if err != nil {
+		sylog.Fatalf("Invalid --optimize value: %s", err)
+	}
+	return plan
+}
+
+// checkMksquashfsFlags validates the squashfs block size and the
+// mksquashfs memory set on the command line
+func checkMksquashfsFlags() {
+	if blockSize != "" {
+		if _, err := assemblers.ParseBlockSize(blockSize); err != nil {
+			sylog.Fatalf("Invalid --squashfs-block-size value: %s", err)
+		}
+	}
+	if mksquashfsMem != "" {
+		if _, err := assemblers.ParseMksquashfsMem(mksquashfsMem); err != nil {
+			sylog.Fatalf("Invalid --mksquashfs-mem value: %s", err)
+		}
+	}
+}
+
+// requestedPlatform returns the platform set with --platform, or the
+// host platform
+func requestedPlatform() platform.Platform {
+	if imagePlatform == "" {
+		return platform.Host()
+	}
+	p, err := platform.Parse(imagePlatform)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	return p
+}
+
 // definitionFromSpec is specifically for parsing specs for the remote builder
 // it uses a different version the the definition struct and parser
 func definitionFromSpec(spec string) (def legacytypes.Definition, err error) {
+	var r io.Reader
+
+	// Read definition from standard input or download it
+	if build.IsStreamSpec(spec) {
+		var rc io.ReadCloser
+		rc, err = build.OpenStream(spec)
+		if err != nil {
+			return
+		}
+		defer rc.Close()
+		r, err = parser.ExpandIncludes(rc, "")
+		if err != nil {
+			return
+		}
+		r, err = parser.ApplyBuildArgs(r, buildArgsMap())
+		if err != nil {
+			return
+		}
+		def, err = legacyparser.ParseDefinitionFile(r)
+		return
+	}
 
 	// Try spec as URI first
 	def, err = legacytypes.NewDefinitionFromURI(spec)
@@ -146,25 +480,45 @@ func definitionFromSpec(spec string) (def legacytypes.Definition, err error) {
 		return
 	}
 
+	if parser.IsDockerfile(spec) {
+		err = fmt.Errorf("building from a Dockerfile is not supported by remote builds")
+		return
+	}
+
 	// Try spec as local file
 	var isValid bool
 	isValid, err = legacyparser.IsValidDefinition(spec)
 	if err != nil {
-		return
+		// the legacy parser doesn't know about includes, they are
+		// expanded before parsing the definition again
+		var raw []byte
+		if raw, _ = ioutil.ReadFile(spec); !parser.HasIncludes(raw) {
+			return
+		}
+		r, err = parser.ExpandIncludes(bytes.NewReader(raw), spec)
+		if err != nil {
+			return
+		}
+		isValid = true
 	}
 
 	if isValid {
 		sylog.Debugf("Found valid definition: %s\n", spec)
 		// File exists and contains valid definition
-		var defFile *os.File
-		defFile, err = os.Open(spec)
+		if r == nil {
+			var defFile *os.File
+			defFile, err = os.Open(spec)
+			if err != nil {
+				return
+			}
+			defer defFile.Close()
+			r = defFile
+		}
+		r, err = parser.ApplyBuildArgs(r, buildArgsMap())
 		if err != nil {
 			return
 		}
-
-		defer defFile.Close()
-		def, err = legacyparser.ParseDefinitionFile(defFile)
-
+		def, err = legacyparser.ParseDefinitionFile(r)
 		return
 	}
 
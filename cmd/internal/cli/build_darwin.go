@@ -15,11 +15,16 @@ import (
 )
 
 func run(cmd *cobra.Command, args []string) {
+	if lint {
+		lintDefinition(args[0])
+		return
+	}
+
 	dest := args[0]
 	spec := args[1]
 
 	// check if target collides with existing file
-	if ok := checkBuildTarget(dest, false); !ok {
+	if ok := checkBuildTarget(dest, false, spec); !ok {
 		os.Exit(1)
 	}
 
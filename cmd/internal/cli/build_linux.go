@@ -10,16 +10,39 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
+	units "github.com/docker/go-units"
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/internal/pkg/build"
+	"github.com/sylabs/singularity/internal/pkg/build/assemblers"
+	"github.com/sylabs/singularity/internal/pkg/build/fakeroot"
+	"github.com/sylabs/singularity/internal/pkg/build/hooks"
+	"github.com/sylabs/singularity/internal/pkg/build/optimize"
 	"github.com/sylabs/singularity/internal/pkg/build/remotebuilder"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	scs "github.com/sylabs/singularity/internal/pkg/remote"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/files"
+	legacytypes "github.com/sylabs/singularity/pkg/build/legacy"
 	"github.com/sylabs/singularity/pkg/build/types"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+	"github.com/sylabs/singularity/pkg/util/features"
 )
 
 func run(cmd *cobra.Command, args []string) {
+	if lint {
+		lintDefinition(args[0])
+		return
+	}
+	if attachID != "" {
+		attachRemoteBuild(cmd, args[0])
+		return
+	}
+
 	buildFormat := "sif"
 	if sandbox {
 		buildFormat = "sandbox"
@@ -28,12 +51,65 @@ func run(cmd *cobra.Command, args []string) {
 	dest := args[0]
 	spec := args[1]
 
-	// check if target collides with existing file
-	if ok := checkBuildTarget(dest, update); !ok {
-		os.Exit(1)
+	if assemblers.IsOCIDestination(dest) {
+		if sandbox || update {
+			sylog.Fatalf("--sandbox and --update are not supported with %s and %s destinations", assemblers.OCIArchivePrefix, assemblers.DockerPrefix)
+		}
+		if remote {
+			sylog.Fatalf("%s and %s destinations are not supported by remote builds", assemblers.OCIArchivePrefix, assemblers.DockerPrefix)
+		}
+		buildFormat = "oci"
 	}
 
+	// check if target collides with existing file, images pushed to a
+	// registry are overwritten
+	if !strings.HasPrefix(dest, assemblers.DockerPrefix) {
+		target := dest
+		if strings.HasPrefix(dest, assemblers.OCIArchivePrefix) {
+			target = strings.SplitN(strings.TrimPrefix(dest, assemblers.OCIArchivePrefix), ":", 2)[0]
+		}
+		if ok := checkBuildTarget(target, update, spec); !ok {
+			os.Exit(1)
+		}
+	}
+
+	if buildArch != "" {
+		if imagePlatform != "" {
+			sylog.Fatalf("--arch and --platform are mutually exclusive")
+		}
+		imagePlatform = "linux/" + buildArch
+	}
+
+	// validate --platform early
+	requestedPlatform()
+	checkBuildNetwork()
+	checkMksquashfsFlags()
+
 	if remote {
+		if imagePlatform != "" || strictPlatform {
+			sylog.Fatalf("--platform, --arch and --strict-platform are not supported by remote builds")
+		}
+		if len(buildSecrets) > 0 {
+			sylog.Fatalf("--secret is not supported by remote builds")
+		}
+		if reproducible || expectDigest != "" {
+			sylog.Fatalf("--reproducible and --expect-digest are not supported by remote builds")
+		}
+		if optimizeSpec != "" {
+			sylog.Fatalf("--optimize is not supported by remote builds")
+		}
+		if isJSON {
+			sylog.Fatalf("--json is not supported by remote builds")
+		}
+		if blockSize != "" || mksquashfsProc != 0 || mksquashfsMem != "" {
+			sylog.Fatalf("--squashfs-block-size, --mksquashfs-procs and --mksquashfs-mem are not supported by remote builds")
+		}
+		if buildNetwork != "host" || buildDNS != "" || resolvConf != "" {
+			sylog.Fatalf("--network, --dns and --resolv-conf are not supported by remote builds")
+		}
+		if buildFakeroot || buildProot {
+			sylog.Fatalf("--fakeroot and --proot are not supported by remote builds")
+		}
 		handleRemoteBuildFlags(cmd)
 
 		// Submiting a remote build requires a valid authToken
@@ -46,6 +122,12 @@ func run(cmd *cobra.Command, args []string) {
 			sylog.Fatalf("Unable to build from %s: %v", spec, err)
 		}
 
+		// detached builds don't download the image
+		if !detached {
+			runBuildHooks(hooks.PreBuild, spec, args[0], buildFormat)
+			defer runBuildHooks(hooks.PostBuild, spec, args[0], buildFormat)
+		}
+
 		if sandbox {
 			// create temporary file to download sif
 			f, err := ioutil.TempFile(tmpDir, "remote-build-")
@@ -92,6 +174,16 @@ func run(cmd *cobra.Command, args []string) {
 		if err != nil {
 			sylog.Fatalf("Failed to create builder: %v", err)
 		}
+		// %files sources are relative to the current directory like
+		// local builds
+		if b.ContextDir, err = os.Getwd(); err != nil {
+			sylog.Fatalf("Could not determine current directory: %v", err)
+		}
+		limit, err := units.RAMInBytes(contextLimit)
+		if err != nil {
+			sylog.Fatalf("Bad --context-limit value %s: %v", contextLimit, err)
+		}
+		b.ContextLimit = limit
 		err = b.Build(context.TODO())
 		if err != nil {
 			sylog.Fatalf("While performing build: %v", err)
@@ -107,10 +199,22 @@ func run(cmd *cobra.Command, args []string) {
 			sylog.Fatalf("While creating Docker credentials: %v", err)
 		}
 
+		fakerootMode := buildFakerootMode()
+
 		// parse definition to determine build source
-		defs, err := build.MakeAllDefs(spec, false)
-		if err != nil {
-			sylog.Fatalf("Unable to build from %s: %v", spec, err)
+		var defs []types.Definition
+		if isJSON {
+			defs = definitionsFromJSON(spec)
+		} else if build.IsStreamSpec(spec) {
+			var dir string
+			if defs, dir = definitionsFromStream(spec, fakerootMode != ""); dir != "" {
+				defer os.RemoveAll(dir)
+			}
+		} else {
+			defs, err = build.MakeAllDefs(spec, false, fakerootMode != "", buildArgsMap())
+			if err != nil {
+				sylog.Fatalf("Unable to build from %s: %v", spec, err)
+			}
 		}
 
 		// only resolve remote endpoints if library is a build source
@@ -121,6 +225,32 @@ func run(cmd *cobra.Command, args []string) {
 			}
 		}
 
+		if testTimeout < 0 || testRetries < 0 {
+			sylog.Fatalf("--test-timeout and --test-retries must not be negative")
+		}
+
+		plan := optimizePlan()
+		if buildFormat != "sif" {
+			for _, p := range optimize.SIFOnly {
+				if plan.Remove(p) {
+					sylog.Warningf("Optimization pass %s is only applied to SIF images", p)
+				}
+			}
+		}
+
+		var epoch int64
+		if reproducible || plan.ResetTimestamps {
+			epoch = sourceDateEpoch()
+		}
+		if plan.Compression != "" && buildFormat != "sif" {
+			sylog.Warningf("Compression %s is only applied to SIF images", plan.Compression)
+		}
+		if blockSize != "" && buildFormat != "sif" {
+			sylog.Warningf("Block size %s is only applied to SIF images", blockSize)
+		}
+
+		runBuildHooks(hooks.PreBuild, spec, dest, buildFormat)
+
 		b, err := build.New(
 			defs,
 			build.Config{
@@ -128,15 +258,36 @@ func run(cmd *cobra.Command, args []string) {
 				Format:    buildFormat,
 				NoCleanUp: noCleanUp,
 				Opts: types.Options{
-					TmpDir:           tmpDir,
-					Update:           update,
-					Force:            force,
-					Sections:         sections,
-					NoTest:           noTest,
-					NoHTTPS:          noHTTPS,
-					LibraryURL:       libraryURL,
-					LibraryAuthToken: authToken,
-					DockerAuthConfig: authConf,
+					TmpDir:            tmpDir,
+					Update:            update,
+					Force:             force,
+					Sections:          sections,
+					NoTest:            noTest,
+					TestTimeout:       testTimeout,
+					TestRetries:       testRetries,
+					KeepFailed:        keepFailed,
+					NoHTTPS:           noHTTPS,
+					LibraryURL:        libraryURL,
+					LibraryAuthToken:  authToken,
+					DockerAuthConfig:  authConf,
+					NoCache:           disableCache,
+					CacheSections:     cacheSections,
+					Platform:          imagePlatform,
+					StrictPlatform:    strictPlatform,
+					Secrets:           secretsMap(),
+					Reproducible:      reproducible,
+					SourceDateEpoch:   epoch,
+					ExpectedDigest:    expectedDigest(buildFormat),
+					ResetTimestamps:   plan.ResetTimestamps,
+					OptimizePasses:    plan.Passes,
+					Compression:       plan.Compression,
+					SquashfsBlockSize: blockSize,
+					MksquashfsProcs:   mksquashfsProc,
+					MksquashfsMem:     mksquashfsMem,
+					Network:           buildNetwork,
+					DNS:               buildDNS,
+					ResolvConf:        resolvConf,
+					FakerootMode:      string(fakerootMode),
 				},
 			})
 		if err != nil {
@@ -146,6 +297,63 @@ func run(cmd *cobra.Command, args []string) {
 		if err = b.Full(); err != nil {
 			sylog.Fatalf("While performing build: %v", err)
 		}
+
+		runBuildHooks(hooks.PostBuild, spec, dest, buildFormat)
+	}
+}
+
+// runBuildHooks runs the hooks of stage set in singularity.conf, local
+// definition files and images are passed as absolute paths
+func runBuildHooks(stage hooks.Stage, spec, dest, format string) {
+	c := &singularityConfig.FileConfig{}
+	if err := config.Parser(buildcfg.SYSCONFDIR+"/singularity/singularity.conf", c); err != nil {
+		sylog.Fatalf("Unable to parse singularity.conf file: %s", err)
+	}
+	scripts := c.BuildPreHook
+	if stage == hooks.PostBuild {
+		scripts = c.BuildPostHook
+	}
+	if len(scripts) == 0 {
+		return
+	}
+
+	b := hooks.Build{Definition: spec, Dest: dest, Format: format}
+	if fs.IsFile(spec) || fs.IsDir(spec) {
+		if abs, err := filepath.Abs(spec); err == nil {
+			b.Definition = abs
+		}
+	}
+	if !assemblers.IsOCIDestination(dest) {
+		if abs, err := filepath.Abs(dest); err == nil {
+			b.Dest = abs
+		}
+	}
+	if err := hooks.Run(stage, scripts, b); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+}
+
+// attachRemoteBuild streams the output of the remote build attachID and
+// downloads its image to dest
+func attachRemoteBuild(cmd *cobra.Command, dest string) {
+	if sandbox {
+		sylog.Fatalf("--sandbox is not supported with --attach")
+	}
+	if ok := checkBuildTarget(dest, false, ""); !ok {
+		os.Exit(1)
+	}
+
+	handleRemoteBuildFlags(cmd)
+	if authToken == "" {
+		sylog.Fatalf("Unable to attach to build job: %v", remoteWarning)
+	}
+
+	b, err := remotebuilder.New(dest, libraryURL, legacytypes.Definition{}, false, force, builderURL, authToken)
+	if err != nil {
+		sylog.Fatalf("Failed to create builder: %v", err)
+	}
+	if err := b.Attach(context.TODO(), attachID); err != nil {
+		sylog.Fatalf("While attaching to build %s: %v", attachID, err)
 	}
 }
 
@@ -192,3 +400,113 @@ func handleBuildFlags(cmd *cobra.Command) {
 		}
 	}
 }
+
+// definitionsFromStream parses definitions read from standard input or
+// downloaded, it also returns the directory holding extracted context
+// files if any. Definitions can be read by users without root privileges
+// when unprivileged is set.
+func definitionsFromStream(spec string, unprivileged bool) ([]types.Definition, string) {
+	r, err := build.OpenStream(spec)
+	if err != nil {
+		sylog.Fatalf("Unable to read build spec %s: %v", spec, err)
+	}
+	defer r.Close()
+
+	defs, dir, err := build.MakeAllDefsFromStream(r, tmpDir, false, unprivileged, buildArgsMap())
+	if err != nil {
+		sylog.Fatalf("Unable to build from %s: %v", spec, err)
+	}
+	if dir != "" {
+		sylog.Debugf("Extracted build context in %s", dir)
+	}
+	return defs, dir
+}
+
+// definitionsFromJSON parses the definitions of the JSON file spec, or
+// read from standard input
+func definitionsFromJSON(spec string) []types.Definition {
+	r := os.Stdin
+	if spec != build.StdinSpec {
+		f, err := os.Open(spec)
+		if err != nil {
+			sylog.Fatalf("Unable to open JSON definition: %s", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	defs, err := types.NewDefinitionsFromJSON(r)
+	if err != nil {
+		sylog.Fatalf("Unable to build from %s: %v", spec, err)
+	}
+	return defs
+}
+
+// checkBuildNetwork validates the network options of build scripts
+func checkBuildNetwork() {
+	networks := strings.Split(buildNetwork, ",")
+	for _, n := range networks {
+		switch n {
+		case "":
+			sylog.Fatalf("Empty network name in --network %q", buildNetwork)
+		case "host", "none":
+			if len(networks) > 1 {
+				sylog.Fatalf("--network %s can't be combined with other networks", n)
+			}
+		}
+	}
+
+	if buildDNS != "" && resolvConf != "" {
+		sylog.Fatalf("--dns and --resolv-conf are mutually exclusive")
+	}
+	if buildDNS != "" {
+		if _, err := files.ResolvConf(strings.Split(strings.Replace(buildDNS, " ", "", -1), ",")); err != nil {
+			sylog.Fatalf("Invalid --dns: %s", err)
+		}
+	}
+	if resolvConf != "" {
+		abs, err := filepath.Abs(resolvConf)
+		if err != nil || !fs.IsFile(abs) {
+			sylog.Fatalf("--resolv-conf %s is not a file", resolvConf)
+		}
+		resolvConf = abs
+	}
+}
+
+// buildFakerootMode returns the privilege mode of builds run without
+// root privileges with --fakeroot or --proot, the modes are probed in
+// order unless --proot is set. The selected mode and its limitations are
+// reported, it's empty when building as root.
+func buildFakerootMode() fakeroot.Mode {
+	if !buildFakeroot && !buildProot {
+		return ""
+	}
+	if os.Getuid() == 0 {
+		sylog.Verbosef("Building as root, ignoring --fakeroot and --proot")
+		return ""
+	}
+	if buildNetwork != "host" {
+		sylog.Fatalf("--network is not supported by builds without root privileges, build scripts share the host network")
+	}
+
+	fileConfig := &singularityConfig.FileConfig{}
+	if err := config.Parser(buildcfg.SYSCONFDIR+"/singularity/singularity.conf", fileConfig); err != nil {
+		sylog.Warningf("Unable to parse singularity.conf file, configuration is ignored: %s", err)
+		fileConfig = nil
+	}
+	matrix := features.Detect(fileConfig)
+
+	var selection *fakeroot.Selection
+	var err error
+	if buildProot {
+		selection, err = fakeroot.Force(matrix, fakeroot.Proot)
+	} else {
+		selection, err = fakeroot.Select(matrix)
+	}
+	if err != nil {
+		sylog.Fatalf("Unable to build as fake root: %s", err)
+	}
+	sylog.Infof("%s", selection.Report())
+	build.WarnFakerootLimitations(selection.Mode)
+	return selection.Mode
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/build"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/build/types/parser"
+)
+
+func init() {
+	SingularityCmd.AddCommand(DefCmd)
+
+	DefCmd.AddCommand(DefConvertCmd)
+	DefCmd.AddCommand(DefSchemaCmd)
+
+	DefConvertCmd.Flags().AddFlag(BuildCmd.Flags().Lookup("build-arg"))
+	DefConvertCmd.Flags().AddFlag(BuildCmd.Flags().Lookup("build-arg-file"))
+}
+
+// DefCmd is the 'def' command that allows conversion of definition files
+var DefCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("Invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:           docs.DefUse,
+	Short:         docs.DefShort,
+	Long:          docs.DefLong,
+	Example:       docs.DefExample,
+	SilenceErrors: true,
+}
+
+// DefConvertCmd is 'singularity def convert' and converts a definition
+// file to JSON or JSON to a definition file
+var DefConvertCmd = &cobra.Command{
+	Args:                  cobra.RangeArgs(1, 2),
+	DisableFlagsInUseLine: true,
+	Run:                   defConvertRun,
+
+	Use:     docs.DefConvertUse,
+	Short:   docs.DefConvertShort,
+	Long:    docs.DefConvertLong,
+	Example: docs.DefConvertExample,
+}
+
+// DefSchemaCmd is 'singularity def schema' and prints the JSON schema of
+// definitions
+var DefSchemaCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Print(types.DefinitionSchema)
+	},
+
+	Use:     docs.DefSchemaUse,
+	Short:   docs.DefSchemaShort,
+	Long:    docs.DefSchemaLong,
+	Example: docs.DefSchemaExample,
+}
+
+func defConvertRun(cmd *cobra.Command, args []string) {
+	var in io.Reader = os.Stdin
+	if args[0] != build.StdinSpec {
+		f, err := os.Open(args[0])
+		if err != nil {
+			sylog.Fatalf("Unable to open %s: %s", args[0], err)
+		}
+		defer f.Close()
+		in = f
+	}
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		sylog.Fatalf("While reading %s: %s", args[0], err)
+	}
+
+	var out bytes.Buffer
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		defs, err := types.NewDefinitionsFromJSON(bytes.NewReader(data))
+		if err != nil {
+			sylog.Fatalf("While parsing JSON definition %s: %s", args[0], err)
+		}
+		types.WriteDefinitionFile(&out, defs...)
+	} else {
+		spec := args[0]
+		if spec == build.StdinSpec {
+			spec = ""
+		}
+		r, err := parser.ExpandIncludes(bytes.NewReader(data), spec)
+		if err != nil {
+			sylog.Fatalf("While including files: %s", err)
+		}
+		r, err = parser.ApplyBuildArgs(r, buildArgsMap())
+		if err != nil {
+			sylog.Fatalf("While applying build arguments: %s", err)
+		}
+		defs, err := parser.All(r)
+		if err != nil {
+			sylog.Fatalf("While parsing definition %s: %s", args[0], err)
+		}
+		// raw data is only a copy of the definition file
+		for i := range defs {
+			defs[i].Raw = nil
+		}
+		var v interface{} = defs
+		if len(defs) == 1 {
+			v = defs[0]
+		}
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			sylog.Fatalf("While converting definition to JSON: %s", err)
+		}
+		out.Write(append(b, '\n'))
+	}
+
+	if len(args) == 1 {
+		os.Stdout.Write(out.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(args[1], out.Bytes(), 0644); err != nil {
+		sylog.Fatalf("While writing %s: %s", args[1], err)
+	}
+}
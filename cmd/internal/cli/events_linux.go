@@ -0,0 +1,77 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+var (
+	eventsSince  string
+	eventsFollow bool
+	eventsJSON   bool
+	eventsUser   string
+)
+
+func init() {
+	EventsCmd.Flags().SetInterspersed(false)
+
+	// --since
+	EventsCmd.Flags().StringVar(&eventsSince, "since", "", "display events since a duration (like 10m or 2h) or an RFC 3339 timestamp")
+	EventsCmd.Flags().SetAnnotation("since", "argtag", []string{"<duration|time>"})
+	EventsCmd.Flags().SetAnnotation("since", "envkey", []string{"SINCE"})
+
+	// -f|--follow
+	EventsCmd.Flags().BoolVarP(&eventsFollow, "follow", "f", false, "wait for new events")
+	EventsCmd.Flags().SetAnnotation("follow", "envkey", []string{"FOLLOW"})
+
+	// -j|--json
+	EventsCmd.Flags().BoolVarP(&eventsJSON, "json", "j", false, "print events in JSON format, one per line")
+	EventsCmd.Flags().SetAnnotation("json", "envkey", []string{"JSON"})
+
+	// -u|--user
+	EventsCmd.Flags().StringVarP(&eventsUser, "user", "u", "", `if running as root, display events of "<username>"`)
+	EventsCmd.Flags().SetAnnotation("user", "argtag", []string{"<username>"})
+	EventsCmd.Flags().SetAnnotation("user", "envkey", []string{"USER"})
+
+	SingularityCmd.AddCommand(EventsCmd)
+}
+
+// EventsCmd singularity events
+var EventsCmd = &cobra.Command{
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if eventsUser != "" && os.Getuid() != 0 {
+			sylog.Fatalf("only root user can display user's events")
+		}
+
+		var since time.Time
+
+		if eventsSince != "" {
+			if d, err := time.ParseDuration(eventsSince); err == nil {
+				since = time.Now().Add(-d)
+			} else if since, err = time.Parse(time.RFC3339, eventsSince); err != nil {
+				sylog.Fatalf("--since value %q is neither a duration nor an RFC 3339 timestamp", eventsSince)
+			}
+		}
+
+		if err := singularity.Events(os.Stdout, eventsUser, since, eventsFollow, eventsJSON); err != nil {
+			sylog.Fatalf("Failed to read events: %s", err)
+		}
+	},
+
+	Use:     docs.EventsUse,
+	Short:   docs.EventsShort,
+	Long:    docs.EventsLong,
+	Example: docs.EventsExample,
+}
@@ -10,11 +10,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/opencontainers/runtime-tools/generate"
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
@@ -37,6 +39,43 @@ var (
 	jsonfmt     bool
 )
 
+// inspectMaxOutput is the maximum size of metadata read from the
+// inspection helper
+const inspectMaxOutput = 16 * 1024 * 1024
+
+// inspectDeniedSyscalls lists system calls denied to the inspection
+// helper, none of them is required to read metadata files
+var inspectDeniedSyscalls = []string{
+	"accept",
+	"accept4",
+	"add_key",
+	"bind",
+	"bpf",
+	"chroot",
+	"connect",
+	"delete_module",
+	"finit_module",
+	"init_module",
+	"kexec_file_load",
+	"kexec_load",
+	"keyctl",
+	"listen",
+	"mount",
+	"open_by_handle_at",
+	"perf_event_open",
+	"pivot_root",
+	"process_vm_readv",
+	"process_vm_writev",
+	"ptrace",
+	"request_key",
+	"setns",
+	"socket",
+	"socketpair",
+	"umount2",
+	"unshare",
+	"userfaultfd",
+}
+
 type inspectAttributes struct {
 	Labels      map[string]string `json:"labels,omitempty"`
 	Deffile     string            `json:"deffile,omitempty"`
@@ -78,6 +117,11 @@ func init() {
 	InspectCmd.Flags().BoolVarP(&jsonfmt, "json", "j", false, "print structured json instead of sections")
 	InspectCmd.Flags().SetAnnotation("json", "envkey", []string{"JSON"})
 
+	InspectCmd.Flags().AddFlag(actionFlags.Lookup("docker-username"))
+	InspectCmd.Flags().AddFlag(actionFlags.Lookup("docker-password"))
+	InspectCmd.Flags().AddFlag(actionFlags.Lookup("docker-login"))
+	InspectCmd.Flags().AddFlag(actionFlags.Lookup("nohttps"))
+
 	SingularityCmd.AddCommand(InspectCmd)
 }
 
@@ -163,6 +207,7 @@ var InspectCmd = &cobra.Command{
 	Long:    docs.InspectLong,
 	Example: docs.InspectExample,
 
+	PreRun: replaceURIWithImage,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		// Sanity check
@@ -237,7 +282,7 @@ var InspectCmd = &cobra.Command{
 			if len(parts) == 2 {
 				label := parts[0]
 				sizeData, errConv := strconv.Atoi(parts[1])
-				if errConv != nil {
+				if errConv != nil || sizeData < 0 || sizeData > len(fileContents) {
 					sylog.Fatalf("Badly formatted content, can't recover: %v", parts)
 				}
 				sylog.Debugf("Section %s found with %d bytes of data.", label, sizeData)
@@ -303,6 +348,8 @@ func getFileContent(abspath, name string, args []string) (string, error) {
 	generator.SetProcessCwd("/")
 	engineConfig.SetImage(abspath)
 
+	sandboxInspect(engineConfig, &generator)
+
 	cfg := &config.Common{
 		EngineName:   singularityConfig.Name,
 		ContainerID:  name,
@@ -321,10 +368,58 @@ func getFileContent(abspath, name string, args []string) (string, error) {
 		sylog.Fatalf("%s: %s", err, cmd.Args)
 	}
 
-	b, err := cmd.Output()
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if err := cmd.Start(); err != nil {
+		sylog.Fatalf("%s: %s", err, cmd.Args)
+	}
+
+	// metadata come from an untrusted image, don't let it
+	// exhaust memory
+	b, err := ioutil.ReadAll(io.LimitReader(stdout, inspectMaxOutput+1))
+	if err != nil {
+		sylog.Fatalf("failed to read metadata: %s", err)
+	}
+	if len(b) > inspectMaxOutput {
+		cmd.Process.Kill()
+		cmd.Wait()
+		sylog.Fatalf("image metadata exceed %d bytes", inspectMaxOutput)
+	}
+	if err := cmd.Wait(); err != nil {
 		sylog.Fatalf("%s: %s", err, b)
 	}
 
 	return string(b), nil
 }
+
+// sandboxInspect restricts the container process extracting metadata
+// from a possibly untrusted image: isolated namespaces without network,
+// no privileges, no host directories and a seccomp filter denying system
+// calls not required to read files
+func sandboxInspect(engineConfig *singularityConfig.EngineConfig, generator *generate.Generator) {
+	engineConfig.SetContain(true)
+	engineConfig.SetPrivateTmp(true)
+	engineConfig.SetPrivateDevs(true)
+	engineConfig.SetNoHome(true)
+	engineConfig.SetNoPrivs(true)
+	engineConfig.SetNetwork("none")
+	// the image recommended profile would replace the deny list below
+	engineConfig.SetNoImageSeccomp(true)
+
+	for _, ns := range []string{"pid", "ipc", "uts", "network"} {
+		generator.AddOrReplaceLinuxNamespace(ns, "")
+	}
+	generator.SetProcessNoNewPrivileges(true)
+
+	generator.Config.Linux.Seccomp = &specs.LinuxSeccomp{
+		DefaultAction: specs.ActAllow,
+		Syscalls: []specs.LinuxSyscall{
+			{
+				Names:  inspectDeniedSyscalls,
+				Action: specs.ActErrno,
+			},
+		},
+	}
+}
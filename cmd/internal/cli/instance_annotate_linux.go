@@ -0,0 +1,34 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+)
+
+func init() {
+	InstanceAnnotateCmd.Flags().SetInterspersed(false)
+
+	// -u|--user
+	InstanceAnnotateCmd.Flags().StringVarP(&username, "user", "u", "", `If running as root, annotate instance from "<username>"`)
+	InstanceAnnotateCmd.Flags().SetAnnotation("user", "argtag", []string{"<username>"})
+	InstanceAnnotateCmd.Flags().SetAnnotation("user", "envkey", []string{"USER"})
+}
+
+// InstanceAnnotateCmd singularity instance annotate
+var InstanceAnnotateCmd = &cobra.Command{
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		annotateInstance(args[0], args[1:])
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.InstanceAnnotateUse,
+	Short:   docs.InstanceAnnotateShort,
+	Long:    docs.InstanceAnnotateLong,
+	Example: docs.InstanceAnnotateExample,
+}
@@ -10,14 +10,24 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/cgroups"
+	"github.com/sylabs/singularity/internal/pkg/events"
 	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/signal"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
 	"github.com/sylabs/singularity/pkg/util/fs/proc"
 )
 
@@ -26,6 +36,7 @@ var username string
 
 // instance list options
 var jsonFormat bool
+var listFormat string
 
 // instance stop options
 var stopSignal string
@@ -38,6 +49,8 @@ func init() {
 	InstanceCmd.AddCommand(InstanceStartCmd)
 	InstanceCmd.AddCommand(InstanceStopCmd)
 	InstanceCmd.AddCommand(InstanceListCmd)
+	InstanceCmd.AddCommand(InstanceAnnotateCmd)
+	InstanceCmd.AddCommand(InstanceTopCmd)
 }
 
 // InstanceCmd singularity instance
@@ -63,7 +76,18 @@ func listInstance() {
 	if err != nil {
 		sylog.Fatalf("failed to retrieve instance list: %s", err)
 	}
-	if !jsonFormat {
+	if listFormat != "" {
+		tmpl, err := template.New("format").Parse(listFormat)
+		if err != nil {
+			sylog.Fatalf("failed to parse format template: %s", err)
+		}
+		for _, file := range files {
+			if err := tmpl.Execute(os.Stdout, file); err != nil {
+				sylog.Fatalf("failed to format instance %s: %s", file.Name, err)
+			}
+			fmt.Println()
+		}
+	} else if !jsonFormat {
 		fmt.Printf("%-16s %-8s %s\n", "INSTANCE NAME", "PID", "IMAGE")
 		for _, file := range files {
 			fmt.Printf("%-16s %-8d %s\n", file.Name, file.Pid, file.Image)
@@ -76,17 +100,133 @@ func listInstance() {
 			output["instances"][i].Image = files[i].Image
 			output["instances"][i].Pid = files[i].Pid
 			output["instances"][i].Instance = files[i].Name
+			output["instances"][i].Annotations = files[i].Annotations
+		}
+
+		c, err := json.MarshalIndent(output, "", "\t")
+		if err != nil {
+			sylog.Fatalf("error while printing structured JSON: %s", err)
+		}
+		fmt.Println(string(c))
+	}
+}
+
+func annotateInstance(name string, annotations []string) {
+	uid := os.Getuid()
+	if username != "" && uid != 0 {
+		sylog.Fatalf("only root user can annotate user's instances")
+	}
+	files, err := instance.List(username, name, instance.SingSubDir)
+	if err != nil {
+		sylog.Fatalf("failed to retrieve instance list: %s", err)
+	}
+	if len(files) != 1 {
+		sylog.Fatalf("no instance found with name %s", name)
+	}
+	file := files[0]
+
+	set := make(map[string]string)
+	for _, annotation := range annotations {
+		kv := strings.SplitN(annotation, "=", 2)
+		if len(kv) != 2 {
+			sylog.Fatalf("annotation %q is not in the key=value format", annotation)
+		}
+		set[kv[0]] = kv[1]
+	}
+	if err := file.UpdateAnnotations(set); err != nil {
+		sylog.Fatalf("could not annotate instance %s: %s", name, err)
+	}
+}
+
+// instancePids returns the process IDs of the instance cgroup if
+// cgroups were applied, otherwise the instance process and all its
+// descendants
+func instancePids(file *instance.File) ([]int, error) {
+	engineConfig := singularityConfig.NewConfig()
+	cfg := &config.Common{EngineConfig: engineConfig}
+	if err := json.Unmarshal(file.Config, cfg); err != nil {
+		return nil, fmt.Errorf("failed to read instance configuration: %s", err)
+	}
+
+	if engineConfig.GetCgroupsPath() != "" {
+		cgroupPath := filepath.Join("/singularity", strconv.Itoa(file.Pid))
+		manager := &cgroups.Manager{Pid: file.Pid, Path: cgroupPath}
+		pids, err := manager.Pids()
+		if err == nil {
+			return pids, nil
+		}
+		sylog.Debugf("Could not read instance cgroup processes: %s", err)
+	}
+	return proc.Descendants(file.Pid)
+}
+
+func topInstance(name string) {
+	uid := os.Getuid()
+	if username != "" && uid != 0 {
+		sylog.Fatalf("only root user can display processes of user's instances")
+	}
+	files, err := instance.List(username, name, instance.SingSubDir)
+	if err != nil {
+		sylog.Fatalf("failed to retrieve instance list: %s", err)
+	}
+	if len(files) != 1 {
+		sylog.Fatalf("no instance found with name %s", name)
+	}
+
+	pids, err := instancePids(files[0])
+	if err != nil {
+		sylog.Fatalf("could not list processes of instance %s: %s", name, err)
+	}
+
+	users := make(map[uint32]string)
+	processes := make([]jsonProcess, 0, len(pids))
+
+	for _, pid := range pids {
+		p, err := proc.GetProcess(pid)
+		if err != nil {
+			// process may have exited
+			continue
 		}
+		if _, ok := users[p.UID]; !ok {
+			users[p.UID] = strconv.FormatUint(uint64(p.UID), 10)
+			if pw, err := user.GetPwUID(p.UID); err == nil {
+				users[p.UID] = pw.Name
+			}
+		}
+		processes = append(processes, jsonProcess{
+			Pid:     p.Pid,
+			NsPid:   p.NsPid,
+			PPid:    p.PPid,
+			User:    users[p.UID],
+			State:   p.State,
+			RSS:     p.RSS,
+			Time:    p.Time.Seconds(),
+			Command: p.Command,
+		})
+	}
+
+	if jsonFormat {
+		output := map[string][]jsonProcess{"processes": processes}
 
 		c, err := json.MarshalIndent(output, "", "\t")
 		if err != nil {
 			sylog.Fatalf("error while printing structured JSON: %s", err)
 		}
 		fmt.Println(string(c))
+		return
 	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PID\tNSPID\tPPID\tUSER\tSTAT\tRSS\tTIME\tCOMMAND")
+	for _, p := range processes {
+		t := int(p.Time)
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%s\t%d\t%02d:%02d:%02d\t%s\n", p.Pid, p.NsPid, p.PPid, p.User, p.State, p.RSS, t/3600, t/60%60, t%60, p.Command)
+	}
+	tw.Flush()
 }
 
 func killInstance(file *instance.File, sig syscall.Signal, fileChan chan *instance.File) {
+	events.Record(&events.Event{Type: events.Kill, Kind: events.KindInstance, ID: file.Name, Pid: file.Pid, Image: file.Image, Details: signal.Name(sig)})
 	syscall.Kill(file.Pid, sig)
 
 	for {
@@ -102,11 +242,11 @@ func killInstance(file *instance.File, sig syscall.Signal, fileChan chan *instan
 	}
 }
 
-func stopInstance(name string) {
-	sig := syscall.SIGINT
+func stopInstance(cmd *cobra.Command, name string) {
+	var sig syscall.Signal
+
 	uid := os.Getuid()
-	fileChan := make(chan *instance.File, 1)
-	stopped := make([]int, 0)
+	stopped := make(map[int]bool)
 
 	if username != "" && uid != 0 {
 		sylog.Fatalf("only root user can list user's instances")
@@ -122,6 +262,8 @@ func stopInstance(name string) {
 	if forceStop {
 		sig = syscall.SIGKILL
 	}
+	timeoutSet := cmd.Flags().Changed("timeout") || cmd.Flags().Changed("stop-timeout")
+
 	files, err := instance.List(username, name, instance.SingSubDir)
 	if err != nil {
 		sylog.Fatalf("failed to retrieve instance list: %s", err)
@@ -130,34 +272,52 @@ func stopInstance(name string) {
 		sylog.Fatalf("no instance found")
 	}
 
+	fileChan := make(chan *instance.File, len(files))
+	killChan := make(chan *instance.File, len(files))
+
 	for _, file := range files {
-		go killInstance(file, sig, fileChan)
+		// signal and timeout given on the command line take
+		// precedence over those recorded at instance start
+		fileSig, timeout := sig, stopTimeout
+		if fileSig == 0 {
+			fileSig = syscall.SIGINT
+			if file.StopSignal != "" {
+				if s, err := signal.Convert(file.StopSignal); err != nil {
+					sylog.Warningf("ignoring stop signal of instance %s: %s", file.Name, err)
+				} else {
+					fileSig = s
+				}
+			}
+		}
+		if !timeoutSet && file.StopTimeout > 0 {
+			timeout = file.StopTimeout
+		}
+
+		go killInstance(file, fileSig, fileChan)
+
+		f := file
+		time.AfterFunc(time.Duration(timeout)*time.Second, func() {
+			killChan <- f
+		})
 	}
 
-	for {
+	for len(stopped) < len(files) {
 		select {
 		case f := <-fileChan:
-			fmt.Printf("Stopping %s instance of %s (PID=%d)\n", f.Name, f.Image, f.Pid)
-			stopped = append(stopped, f.Pid)
-			if len(stopped) == len(files) {
-				os.Exit(0)
+			if stopped[f.Pid] {
+				continue
 			}
-		case <-time.After(time.Duration(stopTimeout) * time.Second):
-			for _, file := range files {
-				kill := true
-				for _, pid := range stopped {
-					if pid == file.Pid {
-						kill = false
-						break
-					}
-				}
-				if !kill {
-					continue
-				}
-				syscall.Kill(file.Pid, syscall.SIGKILL)
-				fmt.Printf("Killing %s instance of %s (PID=%d) (Timeout)\n", file.Name, file.Image, file.Pid)
+			stopped[f.Pid] = true
+			fmt.Printf("Stopping %s instance of %s (PID=%d)\n", f.Name, f.Image, f.Pid)
+		case f := <-killChan:
+			if stopped[f.Pid] {
+				continue
 			}
-			os.Exit(0)
+			stopped[f.Pid] = true
+			events.Record(&events.Event{Type: events.Kill, Kind: events.KindInstance, ID: f.Name, Pid: f.Pid, Image: f.Image, Details: "SIGKILL after stop timeout"})
+			syscall.Kill(f.Pid, syscall.SIGKILL)
+			fmt.Printf("Killing %s instance of %s (PID=%d) (Timeout)\n", f.Name, f.Image, f.Pid)
 		}
 	}
+	os.Exit(0)
 }
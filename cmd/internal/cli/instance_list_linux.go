@@ -11,9 +11,10 @@ import (
 )
 
 type jsonList struct {
-	Instance string `json:"instance"`
-	Pid      int    `json:"pid"`
-	Image    string `json:"img"`
+	Instance    string            `json:"instance"`
+	Pid         int               `json:"pid"`
+	Image       string            `json:"img"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 func init() {
@@ -27,6 +28,11 @@ func init() {
 	// -j|--json
 	InstanceListCmd.Flags().BoolVarP(&jsonFormat, "json", "j", false, "Print structured json instead of list")
 	InstanceListCmd.Flags().SetAnnotation("json", "envkey", []string{"JSON"})
+
+	// --format
+	InstanceListCmd.Flags().StringVar(&listFormat, "format", "", "Print instances using a Go template")
+	InstanceListCmd.Flags().SetAnnotation("format", "argtag", []string{"<template>"})
+	InstanceListCmd.Flags().SetAnnotation("format", "envkey", []string{"FORMAT"})
 }
 
 // InstanceListCmd singularity instance list
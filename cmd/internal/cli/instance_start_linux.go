@@ -6,51 +6,106 @@
 package cli
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/sshd"
+)
+
+var (
+	instanceNotifyURLs     []string
+	instanceNotifyCommands []string
+	instanceSshd           string
+	instanceStopTimeout    int
 )
 
 func init() {
 	options := []string{
 		"add-caps",
+		"add-passwd-entry",
 		"allow-setuid",
+		"alsa",
 		"apply-cgroups",
 		"bind",
 		"boot",
+		"cgroupns",
+		"compose",
 		"contain",
 		"containall",
 		"containlibs",
 		"cleanenv",
+		"dbus",
 		"docker-login",
 		"docker-username",
 		"docker-password",
 		"dns",
 		"drop-caps",
+		"dry-run",
 		"fakeroot",
+		"gui",
 		"home",
+		"home-mode",
+		"host-singularity",
 		"hostname",
+		"job-templates",
 		"keep-privs",
+		"krb5",
 		"net",
 		"network",
 		"network-args",
+		"mempolicy",
 		"no-home",
+		"no-image-seccomp",
+		"env-via-file",
+		"no-label-flags",
 		"no-nv",
 		"no-privs",
 		"nv",
+		"observe",
+		"observe-file",
+		"oci-patch",
 		"overlay",
+		"pulse",
 		"scratch",
 		"security",
+		"stop-signal",
+		"thp",
+		"tmp-policy",
 		"userns",
 		"uts",
+		"video",
 		"workdir",
 		"writable",
 		"writable-tmpfs",
+		"xdg-runtime-dir",
 	}
 
 	for _, opt := range options {
 		InstanceStartCmd.Flags().AddFlag(actionFlags.Lookup(opt))
 	}
 
+	InstanceStartCmd.Flags().StringArrayVar(&instanceNotifyURLs, "notify-url", []string{}, "POST instance start, oom and stop events in JSON format to this URL")
+	InstanceStartCmd.Flags().SetAnnotation("notify-url", "envkey", []string{"NOTIFY_URL"})
+
+	InstanceStartCmd.Flags().StringArrayVar(&instanceNotifyCommands, "notify-exec", []string{}, "run this shell command on instance start, oom and stop events")
+	InstanceStartCmd.Flags().SetAnnotation("notify-exec", "envkey", []string{"NOTIFY_EXEC"})
+
+	InstanceStartCmd.Flags().StringVar(&instanceSshd, "sshd", "", "run an OpenSSH server of the container as the user, listening on 127.0.0.1 and a free port unless [[address]:]port is given, for remote IDEs")
+	InstanceStartCmd.Flags().Lookup("sshd").NoOptDefVal = ":0"
+	InstanceStartCmd.Flags().SetAnnotation("sshd", "argtag", []string{"[[<address>]:<port>]"})
+	InstanceStartCmd.Flags().SetAnnotation("sshd", "envkey", []string{"SSHD"})
+
+	InstanceStartCmd.Flags().IntVar(&instanceStopTimeout, "stop-timeout", 0, "grace period in seconds recorded for instance stop before the instance is killed with SIGKILL, default to the instance stop --timeout")
+	InstanceStartCmd.Flags().SetAnnotation("stop-timeout", "argtag", []string{"<seconds>"})
+	InstanceStartCmd.Flags().SetAnnotation("stop-timeout", "envkey", []string{"STOP_TIMEOUT"})
+
 	InstanceStartCmd.Flags().SetInterspersed(false)
 }
 
@@ -63,10 +118,26 @@ var InstanceStartCmd = &cobra.Command{
 		a := append([]string{"/.singularity.d/actions/start"}, args[2:]...)
 		setVM(cmd)
 		if VM {
+			if instanceSshd != "" {
+				sylog.Fatalf("--sshd is not supported with --vm")
+			}
 			execVM(cmd, args[0], a)
 			return
 		}
+
+		var listen sshd.Listen
+		var hostKey string
+		if instanceSshd != "" {
+			if len(args) > 2 {
+				sylog.Fatalf("--sshd runs the server instead of the startscript, which can't receive arguments")
+			}
+			listen, hostKey = setSshd(args[1])
+			a = sshd.Command()
+		}
 		execStarter(cmd, args[0], a, args[1])
+		if instanceSshd != "" {
+			printSshdInstructions(args[1], listen, hostKey)
+		}
 	},
 
 	Use:     docs.InstanceStartUse,
@@ -74,3 +145,95 @@ var InstanceStartCmd = &cobra.Command{
 	Long:    docs.InstanceStartLong,
 	Example: docs.InstanceStartExample,
 }
+
+// setSshd prepares the server state directory of instance name, holding
+// its configuration and host key, and binds it with the authorized keys
+// of the user. It returns the server address and public host key.
+func setSshd(name string) (sshd.Listen, string) {
+	if IsBoot {
+		sylog.Fatalf("--sshd is not supported with --boot, enable the sshd service of the image instead")
+	}
+	listen, err := sshd.ParseListen(instanceSshd)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if NetNamespace && listen.Port == 0 {
+		sylog.Fatalf("--sshd requires a port with --net, and a port mapping to reach it")
+	} else if NetNamespace {
+		sylog.Warningf("sshd listens in the network namespace of the instance, a port mapping is required to reach it")
+	}
+	if listen, err = listen.Resolve(); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	home := getHomeDir()
+	authorizedKeys := filepath.Join(home, ".ssh", "authorized_keys")
+	if !fs.IsFile(authorizedKeys) {
+		sylog.Fatalf("--sshd requires public keys allowed to log in, %s not found", authorizedKeys)
+	}
+
+	// host keys are kept between restarts of the instance
+	dir := filepath.Join(home, ".singularity", "sshd", name)
+	if err := fs.MkdirAll(dir, 0700); err != nil {
+		sylog.Fatalf("Failed to create sshd directory: %s", err)
+	}
+	hostKey, err := sshd.GenerateHostKey(filepath.Join(dir, sshd.HostKeyFile))
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, sshd.ConfigFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		sylog.Fatalf("Failed to write sshd configuration: %s", err)
+	}
+	err = sshd.WriteConfig(f, listen)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		sylog.Fatalf("Failed to write sshd configuration: %s", err)
+	}
+
+	// mount point of the authorized keys
+	placeholder := filepath.Join(dir, sshd.AuthorizedKeysFile)
+	if err := ioutil.WriteFile(placeholder, nil, 0600); err != nil {
+		sylog.Fatalf("Failed to create %s: %s", placeholder, err)
+	}
+
+	BindPaths = append(BindPaths,
+		dir+":"+sshd.ContainerDir+":ro",
+		authorizedKeys+":"+filepath.Join(sshd.ContainerDir, sshd.AuthorizedKeysFile)+":ro",
+	)
+	return listen, hostKey
+}
+
+// printSshdInstructions prints how to connect to the server of instance
+// name, directly or by jumping through this host
+func printSshdInstructions(name string, listen sshd.Listen, hostKey string) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "<host>"
+	}
+	// loopback addresses are reached by jumping through this host
+	ip := net.ParseIP(listen.Address)
+	address, remote, jump := listen.Address, listen.Address, ""
+	switch {
+	case ip.IsLoopback():
+		address, remote, jump = "localhost", "localhost", hostname
+	case ip.IsUnspecified():
+		address, remote = "localhost", hostname
+	}
+
+	fmt.Printf("sshd of instance %s listening on %s, connect with:\n\n", name, listen)
+	fmt.Printf("    ssh -p %d %s\n\n", listen.Port, address)
+	fmt.Printf("From another host, or for remote IDEs, add to ~/.ssh/config:\n\n")
+	fmt.Printf("    Host %s\n", name)
+	fmt.Printf("        HostName %s\n", remote)
+	fmt.Printf("        Port %d\n", listen.Port)
+	if jump != "" {
+		fmt.Printf("        ProxyJump %s\n", jump)
+	}
+	if fp, err := sshd.Fingerprint(hostKey); err == nil {
+		fmt.Printf("\nHost key fingerprint is %s\n", fp)
+	}
+}
@@ -29,12 +29,22 @@ func init() {
 	InstanceStopCmd.Flags().SetAnnotation("force", "envkey", []string{"FORCE"})
 
 	// -s|--signal
-	InstanceStopCmd.Flags().StringVarP(&stopSignal, "signal", "s", "", "signal sent to the instance")
+	InstanceStopCmd.Flags().StringVarP(&stopSignal, "signal", "s", "", "signal sent to the instance, default to the --stop-signal of instance start or SIGINT")
 	InstanceStopCmd.Flags().SetAnnotation("signal", "argtag", []string{"<signal>"})
 	InstanceStopCmd.Flags().SetAnnotation("signal", "envkey", []string{"SIGNAL"})
 
+	// --stop-signal
+	InstanceStopCmd.Flags().StringVar(&stopSignal, "stop-signal", "", "signal sent to the instance, same as --signal")
+	InstanceStopCmd.Flags().SetAnnotation("stop-signal", "argtag", []string{"<signal>"})
+	InstanceStopCmd.Flags().SetAnnotation("stop-signal", "envkey", []string{"STOP_SIGNAL"})
+
 	// -t|--timeout
-	InstanceStopCmd.Flags().IntVarP(&stopTimeout, "timeout", "t", 10, "force kill non stopped instances after X seconds")
+	InstanceStopCmd.Flags().IntVarP(&stopTimeout, "timeout", "t", 10, "force kill non stopped instances after X seconds, default to the --stop-timeout of instance start or 10 seconds")
+
+	// --stop-timeout
+	InstanceStopCmd.Flags().IntVar(&stopTimeout, "stop-timeout", 10, "grace period in seconds before non stopped instances are killed with SIGKILL, same as --timeout")
+	InstanceStopCmd.Flags().SetAnnotation("stop-timeout", "argtag", []string{"<seconds>"})
+	InstanceStopCmd.Flags().SetAnnotation("stop-timeout", "envkey", []string{"STOP_TIMEOUT"})
 }
 
 // InstanceStopCmd singularity instance stop
@@ -42,10 +52,10 @@ var InstanceStopCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) > 0 && !stopAll {
-			stopInstance(args[0])
+			stopInstance(cmd, args[0])
 			return nil
 		} else if stopAll {
-			stopInstance("*")
+			stopInstance(cmd, "*")
 			return nil
 		} else {
 			return errors.New("Invalid command")
@@ -0,0 +1,49 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+)
+
+type jsonProcess struct {
+	Pid     int     `json:"pid"`
+	NsPid   int     `json:"nspid"`
+	PPid    int     `json:"ppid"`
+	User    string  `json:"user"`
+	State   string  `json:"state"`
+	RSS     uint64  `json:"rss"`
+	Time    float64 `json:"time"`
+	Command string  `json:"command"`
+}
+
+func init() {
+	InstanceTopCmd.Flags().SetInterspersed(false)
+
+	// -u|--user
+	InstanceTopCmd.Flags().StringVarP(&username, "user", "u", "", `If running as root, display processes of instance from "<username>"`)
+	InstanceTopCmd.Flags().SetAnnotation("user", "argtag", []string{"<username>"})
+	InstanceTopCmd.Flags().SetAnnotation("user", "envkey", []string{"USER"})
+
+	// -j|--json
+	InstanceTopCmd.Flags().BoolVarP(&jsonFormat, "json", "j", false, "Print structured json instead of table")
+	InstanceTopCmd.Flags().SetAnnotation("json", "envkey", []string{"JSON"})
+}
+
+// InstanceTopCmd singularity instance top
+var InstanceTopCmd = &cobra.Command{
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		topInstance(args[0])
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.InstanceTopUse,
+	Short:   docs.InstanceTopShort,
+	Long:    docs.InstanceTopLong,
+	Example: docs.InstanceTopExample,
+}
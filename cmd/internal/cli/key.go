@@ -32,6 +32,7 @@ func init() {
 	KeyCmd.AddCommand(KeyImportCmd)
 	KeyCmd.AddCommand(KeyExportCmd)
 	KeyCmd.AddCommand(KeyRemoveCmd)
+	KeyCmd.AddCommand(KeySyncCmd)
 }
 
 // KeyCmd is the 'key' command that allows management of key stores
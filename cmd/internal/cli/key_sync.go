@@ -0,0 +1,147 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/sypgp"
+	"golang.org/x/crypto/openpgp"
+)
+
+var (
+	keySyncFile   string // -f command line option
+	keySyncDryRun bool   // --dry-run command line option
+)
+
+func init() {
+	KeySyncCmd.Flags().SetInterspersed(false)
+
+	KeySyncCmd.Flags().StringVarP(&keyServerURI, "url", "u", defaultKeyServer, "specify the key server URL")
+	KeySyncCmd.Flags().SetAnnotation("url", "envkey", []string{"URL"})
+
+	KeySyncCmd.Flags().StringVarP(&keySyncFile, "file", "f", "", "specify a shared keyring file to synchronize with")
+	KeySyncCmd.Flags().SetAnnotation("file", "argtag", []string{"<path>"})
+
+	KeySyncCmd.Flags().BoolVar(&keySyncDryRun, "dry-run", false, "show keys that would be added without modifying keyrings")
+}
+
+// KeySyncCmd is `singularity key sync' and synchronizes public keys
+// between the local keyring, a key server and a shared keyring file
+var KeySyncCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	PreRun:                sylabsToken,
+	Run: func(cmd *cobra.Command, args []string) {
+		handleKeyFlags(cmd)
+
+		if err := doKeySyncCmd(keyServerURI, keySyncFile, keySyncDryRun); err != nil {
+			sylog.Errorf("sync failed: %s", err)
+			os.Exit(2)
+		}
+	},
+
+	Use:     docs.KeySyncUse,
+	Short:   docs.KeySyncShort,
+	Long:    docs.KeySyncLong,
+	Example: docs.KeySyncExample,
+}
+
+func doKeySyncCmd(url string, file string, dryRun bool) error {
+	local, err := sypgp.LoadPubKeyring()
+	if err != nil {
+		return err
+	}
+
+	keyrings := map[string]openpgp.EntityList{
+		sypgp.PublicPath(): local,
+	}
+
+	if file != "" {
+		shared, err := sypgp.LoadKeyringFromFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not read shared keyring %s: %s", file, err)
+		}
+		keyrings[file] = shared
+	}
+
+	// key servers can't be listed, only keys known locally
+	// or in the shared keyring are looked up
+	var remote openpgp.EntityList
+	known := make(map[[20]byte]bool)
+	for _, el := range keyrings {
+		for _, e := range el {
+			fp := e.PrimaryKey.Fingerprint
+			if known[fp] {
+				continue
+			}
+			known[fp] = true
+
+			fetched, err := sypgp.FetchPubkey(fmt.Sprintf("%X", fp), url, authToken, true)
+			if err == sypgp.ErrKeyNotFound {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("could not fetch key %X from %s: %s", fp, url, err)
+			}
+			remote = append(remote, fetched...)
+		}
+	}
+	keyrings[url] = remote
+
+	missing, conflicts := sypgp.DiffKeyrings(keyrings)
+
+	for _, c := range conflicts {
+		sylog.Warningf("Key ID %X identifies different keys, skipping it:", c.KeyID)
+		for name, fp := range c.Fingerprints {
+			sylog.Warningf("  %X in %s", fp, name)
+		}
+	}
+
+	for name, el := range missing {
+		for _, e := range el {
+			if dryRun {
+				fmt.Printf("would add key %X to %s\n", e.PrimaryKey.Fingerprint, name)
+				continue
+			}
+
+			switch name {
+			case url:
+				err = sypgp.PushPubkey(e, url, authToken)
+			case file:
+				err = appendPubKey(file, e)
+			default:
+				err = sypgp.StorePubKey(e)
+			}
+			if err != nil {
+				return fmt.Errorf("could not add key %X to %s: %s", e.PrimaryKey.Fingerprint, name, err)
+			}
+		}
+		if !dryRun {
+			fmt.Printf("%d key(s) added to %s\n", len(el), name)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%d conflicting key(s) found", len(conflicts))
+	}
+
+	return nil
+}
+
+// appendPubKey appends a public key to a shared keyring file
+func appendPubKey(path string, e *openpgp.Entity) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return e.Serialize(f)
+}
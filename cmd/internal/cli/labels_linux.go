@@ -0,0 +1,116 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/build/types/parser"
+	"github.com/sylabs/singularity/pkg/image"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+const (
+	// labelPrefix may be omitted from image labels enabling flags
+	labelPrefix = "org.sylabs."
+	// labelNeedsGPU set to nvidia enables --nv
+	labelNeedsGPU = "org.sylabs.needs.gpu"
+	// labelNeedsNet set to true enables --net
+	labelNeedsNet = "org.sylabs.needs.net"
+)
+
+// imageLabels returns labels of a sandbox or a SIF image, SIF labels
+// are read from the definition file and the OCI image configuration
+// stored in the image
+func imageLabels(path string) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	img, err := image.Init(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer img.File.Close()
+
+	switch img.Type {
+	case image.SANDBOX:
+		data, err := ioutil.ReadFile(filepath.Join(path, ".singularity.d", "labels.json"))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &labels); err != nil {
+			return nil, fmt.Errorf("could not parse labels: %s", err)
+		}
+	case image.SIF:
+		for i, s := range img.Sections {
+			r, err := image.NewSectionReader(img, "", i)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case s.Type == uint32(sif.DataGenericJSON) && s.Name == "oci-config.json":
+				var config imgspecv1.ImageConfig
+				if err := json.NewDecoder(r).Decode(&config); err != nil {
+					return nil, fmt.Errorf("could not parse OCI image configuration: %s", err)
+				}
+				for k, v := range config.Labels {
+					labels[k] = v
+				}
+			case s.Type == uint32(sif.DataDeffile):
+				def, err := parser.ParseDefinitionFile(r)
+				if err != nil {
+					sylog.Debugf("Ignoring definition file labels: %s", err)
+					continue
+				}
+				for k, v := range def.ImageData.Labels {
+					labels[k] = v
+				}
+			}
+		}
+	}
+
+	return labels, nil
+}
+
+// applyLabelFlags enables options requested by image labels if allowed
+// by the image label flags directive in configuration file
+func applyLabelFlags(engineConfig *singularityConfig.EngineConfig, path string) {
+	allowed := make(map[string]bool)
+	for _, f := range engineConfig.File.ImageLabelFlags {
+		allowed[strings.TrimSpace(f)] = true
+	}
+	if NoLabelFlags || (!allowed["nv"] && !allowed["net"]) {
+		return
+	}
+
+	labels, err := imageLabels(path)
+	if err != nil {
+		sylog.Debugf("Could not read image labels: %s", err)
+		return
+	}
+
+	label := func(key string) string {
+		if v, ok := labels[key]; ok {
+			return strings.TrimSpace(v)
+		}
+		return strings.TrimSpace(labels[strings.TrimPrefix(key, labelPrefix)])
+	}
+
+	if allowed["nv"] && !Nvidia && !NoNvidia && label(labelNeedsGPU) == "nvidia" {
+		sylog.Verbosef("Enabling --nv as requested by image label %s", labelNeedsGPU)
+		Nvidia = true
+	}
+	if allowed["net"] && !NetNamespace && label(labelNeedsNet) == "true" {
+		sylog.Verbosef("Enabling --net as requested by image label %s", labelNeedsNet)
+		NetNamespace = true
+	}
+}
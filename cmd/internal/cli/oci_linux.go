@@ -6,10 +6,18 @@
 package cli
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
 	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config/oci"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/term"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
 )
 
 var ociArgs singularity.OciArgs
@@ -19,9 +27,15 @@ var ociArgs singularity.OciArgs
 // customize the output.
 var ociContext = []string{"oci"}
 
+// ociRuntime is the external OCI runtime set with --runtime
+var ociRuntime string
+
 func init() {
 	SingularityCmd.AddCommand(OciCmd)
 
+	OciCmd.PersistentFlags().StringVar(&ociRuntime, "runtime", "", "delegate the container lifecycle to an external OCI runtime (eg: runc, crun), overrides the oci runtime directive of singularity.conf")
+	OciCmd.PersistentFlags().SetAnnotation("runtime", "argtag", []string{"<runtime>"})
+
 	OciCreateCmd.Flags().SetInterspersed(false)
 	OciCreateCmd.Flags().StringVarP(&ociArgs.BundlePath, "bundle", "b", "", "specify the OCI bundle path")
 	OciCreateCmd.Flags().SetAnnotation("bundle", "argtag", []string{"<path>"})
@@ -32,26 +46,62 @@ func init() {
 	OciCreateCmd.Flags().SetAnnotation("log-path", "argtag", []string{"<path>"})
 	OciCreateCmd.Flags().StringVar(&ociArgs.LogFormat, "log-format", "kubernetes", "specify the log file format. Available formats are basic, kubernetes and json")
 	OciCreateCmd.Flags().SetAnnotation("log-format", "argtag", []string{"<format>"})
+	OciCreateCmd.Flags().StringVar(&ociArgs.StderrLogPath, "stderr-log-path", "", "specify a distinct log file path for the standard error stream")
+	OciCreateCmd.Flags().SetAnnotation("stderr-log-path", "argtag", []string{"<path>"})
+	OciCreateCmd.Flags().StringVar(&ociArgs.StderrLogFormat, "stderr-log-format", "", "specify the standard error log file format, default to --log-format")
+	OciCreateCmd.Flags().SetAnnotation("stderr-log-format", "argtag", []string{"<format>"})
 	OciCreateCmd.Flags().StringVar(&ociArgs.PidFile, "pid-file", "", "specify the pid file")
 	OciCreateCmd.Flags().SetAnnotation("pid-file", "argtag", []string{"<path>"})
+	OciCreateCmd.Flags().StringVar(&ociArgs.ExitDir, "exit-dir", "", "specify the directory where the <container ID>.exitcode file, holding the exit code, and the <container ID>.finished file, holding the termination time, are written when the container process exits")
+	OciCreateCmd.Flags().SetAnnotation("exit-dir", "argtag", []string{"<path>"})
+	OciCreateCmd.Flags().StringSliceVar(&ociArgs.OciPatchPaths, "oci-patch", []string{}, "apply a JSON merge patch (RFC 7386) file to the bundle runtime specification, multiple patches are applied in order")
+	OciCreateCmd.Flags().SetAnnotation("oci-patch", "argtag", []string{"<path>"})
+	OciCreateCmd.Flags().StringSliceVar(&ociArgs.EnvFiles, "env-file", []string{}, "read KEY=VALUE pairs from an environment file and merge them into the container process environment, variables from later files take precedence")
+	OciCreateCmd.Flags().SetAnnotation("env-file", "argtag", []string{"<path>"})
+	OciCreateCmd.Flags().StringSliceVar(&ociArgs.HooksDirs, "hooks-dir", oci.DefaultHooksDirs, "specify directories containing OCI hook definition files, a file overrides the one with the same name from a previous directory")
+	OciCreateCmd.Flags().SetAnnotation("hooks-dir", "argtag", []string{"<path>"})
+	OciCreateCmd.Flags().StringVar(&ociArgs.SocketGroup, "socket-group", "", "specify the group name or ID owning the attach and control sockets")
+	OciCreateCmd.Flags().SetAnnotation("socket-group", "argtag", []string{"<group>"})
+	OciCreateCmd.Flags().StringVar(&ociArgs.SocketMode, "socket-mode", "", "specify the attach and control sockets permissions in octal (eg: 0660), default to owner only")
+	OciCreateCmd.Flags().SetAnnotation("socket-mode", "argtag", []string{"<mode>"})
+	OciCreateCmd.Flags().StringVar(&ociArgs.SocketSecretFile, "socket-secret-file", "", "specify a file containing a shared secret clients must send before using the attach and control sockets")
+	OciCreateCmd.Flags().SetAnnotation("socket-secret-file", "argtag", []string{"<path>"})
+	OciCreateCmd.Flags().StringSliceVar(&ociArgs.TmpPolicy, "tmp-policy", []string{}, "control how /tmp, /var/tmp and /dev/shm are provided with <path>=<policy>, policy is tmpfs[:<size>], host or scratch:<path>, replacing mounts from config.json")
+	OciCreateCmd.Flags().SetAnnotation("tmp-policy", "argtag", []string{"<path>=<policy>"})
+	OciCreateCmd.Flags().BoolVar(&ociArgs.DryRun, "dry-run", false, "print the final OCI runtime specification and exit without creating the container")
+	OciCreateCmd.Flags().BoolVar(&ociArgs.AutoRemove, "rm", false, "automatically delete the container and its image bundle when the container stops")
+	OciCreateCmd.Flags().StringVar(&ociArgs.StopSignal, "stop-signal", "", "signal sent by oci kill when none is given, default to SIGTERM")
+	OciCreateCmd.Flags().SetAnnotation("stop-signal", "argtag", []string{"<signal>"})
+	OciCreateCmd.Flags().Uint32Var(&ociArgs.StopTimeout, "stop-timeout", 0, "grace period in seconds before oci kill sends SIGKILL when no timeout is given")
+	OciCreateCmd.Flags().SetAnnotation("stop-timeout", "argtag", []string{"<seconds>"})
 
 	OciStartCmd.Flags().SetInterspersed(false)
 	OciDeleteCmd.Flags().SetInterspersed(false)
 	OciAttachCmd.Flags().SetInterspersed(false)
+	OciAttachCmd.Flags().StringVar(&ociArgs.DetachKeys, "detach-keys", term.DefaultDetachKeys, "key sequence detaching the console from the container, keys are single characters or ctrl-<char> separated by comma, an empty value disables detaching")
+	OciAttachCmd.Flags().SetAnnotation("detach-keys", "argtag", []string{"<keys>"})
 	OciExecCmd.Flags().SetInterspersed(false)
+	OciExecCmd.Flags().StringSliceVar(&ociArgs.EnvFiles, "env-file", []string{}, "read KEY=VALUE pairs from an environment file and merge them into the container process environment, variables from later files take precedence")
+	OciExecCmd.Flags().SetAnnotation("env-file", "argtag", []string{"<path>"})
 	OciPauseCmd.Flags().SetInterspersed(false)
 	OciResumeCmd.Flags().SetInterspersed(false)
+	OciWaitCmd.Flags().SetInterspersed(false)
 
 	OciStateCmd.Flags().SetInterspersed(false)
 	OciStateCmd.Flags().StringVarP(&ociArgs.SyncSocketPath, "sync-socket", "s", "", "specify the path to unix socket for state synchronization (internal)")
 	OciStateCmd.Flags().SetAnnotation("sync-socket", "argtag", []string{"<path>"})
 
 	OciKillCmd.Flags().SetInterspersed(false)
-	OciKillCmd.Flags().StringVarP(&ociArgs.KillSignal, "signal", "s", "SIGTERM", "signal sent to the container")
+	OciKillCmd.Flags().StringVarP(&ociArgs.KillSignal, "signal", "s", "", "signal sent to the container, default to the --stop-signal given at creation or SIGTERM")
 	OciKillCmd.Flags().SetInterspersed(false)
 	OciKillCmd.Flags().BoolVarP(&ociArgs.ForceKill, "force", "f", false, "kill container process with SIGKILL")
 	OciKillCmd.Flags().SetInterspersed(false)
-	OciKillCmd.Flags().Uint32VarP(&ociArgs.KillTimeout, "timeout", "t", 0, "timeout in second before killing container")
+	OciKillCmd.Flags().Uint32VarP(&ociArgs.KillTimeout, "timeout", "t", 0, "timeout in second before killing container, default to the --stop-timeout given at creation")
+	OciKillCmd.Flags().BoolVarP(&ociArgs.KillAll, "all", "a", false, "send the signal to all processes in the container cgroup")
+	OciKillCmd.Flags().StringVar(&ociArgs.KillSignal, "stop-signal", "", "signal sent to the container, same as --signal")
+	OciKillCmd.Flags().SetAnnotation("stop-signal", "argtag", []string{"<signal>"})
+	OciKillCmd.Flags().Uint32Var(&ociArgs.KillTimeout, "stop-timeout", 0, "grace period in seconds before the container is killed with SIGKILL, same as --timeout")
+	OciKillCmd.Flags().SetAnnotation("stop-timeout", "argtag", []string{"<seconds>"})
 
 	OciRunCmd.Flags().SetInterspersed(false)
 	OciRunCmd.Flags().StringVarP(&ociArgs.BundlePath, "bundle", "b", "", "specify the OCI bundle path")
@@ -60,12 +110,53 @@ func init() {
 	OciRunCmd.Flags().SetAnnotation("log-path", "argtag", []string{"<path>"})
 	OciRunCmd.Flags().StringVar(&ociArgs.LogFormat, "log-format", "kubernetes", "specify the log file format. Available formats are basic, kubernetes and json")
 	OciRunCmd.Flags().SetAnnotation("log-format", "argtag", []string{"<format>"})
+	OciRunCmd.Flags().StringVar(&ociArgs.StderrLogPath, "stderr-log-path", "", "specify a distinct log file path for the standard error stream")
+	OciRunCmd.Flags().SetAnnotation("stderr-log-path", "argtag", []string{"<path>"})
+	OciRunCmd.Flags().StringVar(&ociArgs.StderrLogFormat, "stderr-log-format", "", "specify the standard error log file format, default to --log-format")
+	OciRunCmd.Flags().SetAnnotation("stderr-log-format", "argtag", []string{"<format>"})
 	OciRunCmd.Flags().StringVar(&ociArgs.PidFile, "pid-file", "", "specify the pid file")
 	OciRunCmd.Flags().SetAnnotation("pid-file", "argtag", []string{"<path>"})
+	OciRunCmd.Flags().StringVar(&ociArgs.ExitDir, "exit-dir", "", "specify the directory where the <container ID>.exitcode file, holding the exit code, and the <container ID>.finished file, holding the termination time, are written when the container process exits")
+	OciRunCmd.Flags().SetAnnotation("exit-dir", "argtag", []string{"<path>"})
+	OciRunCmd.Flags().StringSliceVar(&ociArgs.OciPatchPaths, "oci-patch", []string{}, "apply a JSON merge patch (RFC 7386) file to the bundle runtime specification, multiple patches are applied in order")
+	OciRunCmd.Flags().SetAnnotation("oci-patch", "argtag", []string{"<path>"})
+	OciRunCmd.Flags().StringSliceVar(&ociArgs.EnvFiles, "env-file", []string{}, "read KEY=VALUE pairs from an environment file and merge them into the container process environment, variables from later files take precedence")
+	OciRunCmd.Flags().SetAnnotation("env-file", "argtag", []string{"<path>"})
+	OciRunCmd.Flags().StringSliceVar(&ociArgs.HooksDirs, "hooks-dir", oci.DefaultHooksDirs, "specify directories containing OCI hook definition files, a file overrides the one with the same name from a previous directory")
+	OciRunCmd.Flags().SetAnnotation("hooks-dir", "argtag", []string{"<path>"})
+	OciRunCmd.Flags().StringVar(&ociArgs.SocketGroup, "socket-group", "", "specify the group name or ID owning the attach and control sockets")
+	OciRunCmd.Flags().SetAnnotation("socket-group", "argtag", []string{"<group>"})
+	OciRunCmd.Flags().StringVar(&ociArgs.SocketMode, "socket-mode", "", "specify the attach and control sockets permissions in octal (eg: 0660), default to owner only")
+	OciRunCmd.Flags().SetAnnotation("socket-mode", "argtag", []string{"<mode>"})
+	OciRunCmd.Flags().StringVar(&ociArgs.SocketSecretFile, "socket-secret-file", "", "specify a file containing a shared secret clients must send before using the attach and control sockets")
+	OciRunCmd.Flags().SetAnnotation("socket-secret-file", "argtag", []string{"<path>"})
+	OciRunCmd.Flags().StringSliceVar(&ociArgs.TmpPolicy, "tmp-policy", []string{}, "control how /tmp, /var/tmp and /dev/shm are provided with <path>=<policy>, policy is tmpfs[:<size>], host or scratch:<path>, replacing mounts from config.json")
+	OciRunCmd.Flags().SetAnnotation("tmp-policy", "argtag", []string{"<path>=<policy>"})
+	OciRunCmd.Flags().BoolVar(&ociArgs.DryRun, "dry-run", false, "print the final OCI runtime specification and exit without creating the container")
+	OciRunCmd.Flags().BoolVar(&ociArgs.AutoRemove, "rm", false, "automatically delete the container and its image bundle when the container stops")
+	OciRunCmd.Flags().StringVar(&ociArgs.StopSignal, "stop-signal", "", "signal sent by oci kill when none is given, default to SIGTERM")
+	OciRunCmd.Flags().SetAnnotation("stop-signal", "argtag", []string{"<signal>"})
+	OciRunCmd.Flags().Uint32Var(&ociArgs.StopTimeout, "stop-timeout", 0, "grace period in seconds before oci kill sends SIGKILL when no timeout is given")
+	OciRunCmd.Flags().SetAnnotation("stop-timeout", "argtag", []string{"<seconds>"})
+	for _, name := range []string{"docker-login", "docker-username", "docker-password", "nohttps"} {
+		OciRunCmd.Flags().AddFlag(actionFlags.Lookup(name))
+	}
 
 	OciUpdateCmd.Flags().SetInterspersed(false)
 	OciUpdateCmd.Flags().StringVarP(&ociArgs.FromFile, "from-file", "f", "", "specify path to OCI JSON cgroups resource file ('-' to read from STDIN)")
 
+	OciMountCmd.Flags().SetInterspersed(false)
+	OciMountCmd.Flags().StringSliceVar(&ociArgs.EnvFiles, "env-file", []string{}, "read KEY=VALUE pairs from an environment file and merge them into the generated config.json process environment, variables from later files take precedence")
+	OciMountCmd.Flags().SetAnnotation("env-file", "argtag", []string{"<path>"})
+
+	OciSpecCmd.Flags().SetInterspersed(false)
+	OciSpecCmd.Flags().StringVarP(&ociArgs.BundlePath, "bundle", "b", "", "specify the OCI bundle path where config.json is written, default to the current directory")
+	OciSpecCmd.Flags().SetAnnotation("bundle", "argtag", []string{"<path>"})
+	OciSpecCmd.Flags().BoolVar(&ociArgs.Rootless, "rootless", false, "adjust the specification to run the container without privileges")
+	OciSpecCmd.Flags().BoolVar(&ociArgs.CgroupNamespace, "cgroupns", false, "run the container in a new cgroup namespace")
+	OciSpecCmd.Flags().StringVar(&ociArgs.FromImage, "from", "", "set process arguments, working directory, environment and user from a SIF image metadata")
+	OciSpecCmd.Flags().SetAnnotation("from", "argtag", []string{"<sif_image>"})
+
 	OciCmd.AddCommand(OciStartCmd)
 	OciCmd.AddCommand(OciCreateCmd)
 	OciCmd.AddCommand(OciRunCmd)
@@ -73,19 +164,22 @@ func init() {
 	OciCmd.AddCommand(OciKillCmd)
 	OciCmd.AddCommand(OciStateCmd)
 	OciCmd.AddCommand(OciAttachCmd)
+	OciCmd.AddCommand(OciConsoleCmd)
 	OciCmd.AddCommand(OciExecCmd)
 	OciCmd.AddCommand(OciUpdateCmd)
 	OciCmd.AddCommand(OciPauseCmd)
 	OciCmd.AddCommand(OciResumeCmd)
+	OciCmd.AddCommand(OciWaitCmd)
 	OciCmd.AddCommand(OciMountCmd)
 	OciCmd.AddCommand(OciUmountCmd)
+	OciCmd.AddCommand(OciSpecCmd)
 }
 
 // OciCreateCmd represents oci create command.
 var OciCreateCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(1),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := singularity.OciCreate(args[0], &ociArgs); err != nil {
 			sylog.Fatalf("%s", err)
@@ -99,13 +193,35 @@ var OciCreateCmd = &cobra.Command{
 
 // OciRunCmd allow to create/start in row.
 var OciRunCmd = &cobra.Command{
-	Args:                  cobra.ExactArgs(1),
+	Args:                  cobra.RangeArgs(1, 2),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := singularity.OciRun(args[0], &ociArgs); err != nil {
+		containerID := args[0]
+
+		if ociArgs.BundlePath == "" && isOciRunImage(args[0]) {
+			replaceURIWithImage(cmd, args)
+			ociArgs.Image = args[0]
+
+			if len(args) == 2 {
+				containerID = args[1]
+			} else {
+				id := make([]byte, 6)
+				if _, err := rand.Read(id); err != nil {
+					sylog.Fatalf("failed to generate container ID: %s", err)
+				}
+				containerID = hex.EncodeToString(id)
+				sylog.Infof("Running container %s", containerID)
+			}
+		} else if len(args) != 1 {
+			sylog.Fatalf("a single container ID is expected with a bundle")
+		}
+
+		exitCode, err := singularity.OciRun(containerID, &ociArgs)
+		if err != nil {
 			sylog.Fatalf("%s", err)
 		}
+		os.Exit(exitCode)
 	},
 	Use:     docs.OciRunUse,
 	Short:   docs.OciRunShort,
@@ -113,11 +229,22 @@ var OciRunCmd = &cobra.Command{
 	Example: docs.OciRunExample,
 }
 
+// isOciRunImage returns if the oci run argument refers to an image
+// rather than to a container ID, a container ID can't contain a
+// transport or refer to an existing file
+func isOciRunImage(arg string) bool {
+	if t, _ := uri.Split(arg); t != "" {
+		return true
+	}
+	fi, err := os.Stat(arg)
+	return err == nil && !fi.IsDir()
+}
+
 // OciStartCmd represents oci start command.
 var OciStartCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(1),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := singularity.OciStart(args[0]); err != nil {
 			sylog.Fatalf("%s", err)
@@ -133,7 +260,7 @@ var OciStartCmd = &cobra.Command{
 var OciDeleteCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(1),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := singularity.OciDelete(args[0]); err != nil {
 			sylog.Fatalf("%s", err)
@@ -149,9 +276,13 @@ var OciDeleteCmd = &cobra.Command{
 var OciKillCmd = &cobra.Command{
 	Args:                  cobra.MinimumNArgs(1),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
-		timeout := int(ociArgs.KillTimeout)
+		// a negative timeout stands for the one given at creation
+		timeout := -1
+		if cmd.Flags().Changed("timeout") || cmd.Flags().Changed("stop-timeout") {
+			timeout = int(ociArgs.KillTimeout)
+		}
 		killSignal := ""
 		if len(args) > 1 && args[1] != "" {
 			killSignal = args[1]
@@ -161,7 +292,7 @@ var OciKillCmd = &cobra.Command{
 		if ociArgs.ForceKill {
 			killSignal = "SIGKILL"
 		}
-		if err := singularity.OciKill(args[0], killSignal, timeout); err != nil {
+		if err := singularity.OciKill(args[0], killSignal, timeout, ociArgs.KillAll); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 	},
@@ -175,7 +306,7 @@ var OciKillCmd = &cobra.Command{
 var OciStateCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(1),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := singularity.OciState(args[0], &ociArgs); err != nil {
 			sylog.Fatalf("%s", err)
@@ -191,9 +322,9 @@ var OciStateCmd = &cobra.Command{
 var OciAttachCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(1),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := singularity.OciAttach(args[0]); err != nil {
+		if err := singularity.OciAttach(args[0], ociArgs.DetachKeys); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 	},
@@ -203,13 +334,27 @@ var OciAttachCmd = &cobra.Command{
 	Example: docs.OciAttachExample,
 }
 
+// OciConsoleCmd holds the terminal of a container created with an
+// external runtime, it's started by oci create
+var OciConsoleCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Hidden:                true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.RuntimeConsole(args[0]); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+	Use: "console <directory>",
+}
+
 // OciExecCmd represents oci exec command.
 var OciExecCmd = &cobra.Command{
 	Args:                  cobra.MinimumNArgs(1),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := singularity.OciExec(args[0], args[1:]); err != nil {
+		if err := singularity.OciExec(args[0], args[1:], &ociArgs); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 	},
@@ -223,7 +368,7 @@ var OciExecCmd = &cobra.Command{
 var OciUpdateCmd = &cobra.Command{
 	Args:                  cobra.MinimumNArgs(1),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := singularity.OciUpdate(args[0], &ociArgs); err != nil {
 			sylog.Fatalf("%s", err)
@@ -239,7 +384,7 @@ var OciUpdateCmd = &cobra.Command{
 var OciPauseCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(1),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := singularity.OciPauseResume(args[0], true); err != nil {
 			sylog.Fatalf("%s", err)
@@ -255,7 +400,7 @@ var OciPauseCmd = &cobra.Command{
 var OciResumeCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(1),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := singularity.OciPauseResume(args[0], false); err != nil {
 			sylog.Fatalf("%s", err)
@@ -267,13 +412,32 @@ var OciResumeCmd = &cobra.Command{
 	Example: docs.OciResumeExample,
 }
 
+// OciWaitCmd represents oci wait command.
+var OciWaitCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	PreRun:                ociPreRun,
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode, err := singularity.OciWait(args[0])
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		fmt.Println(exitCode)
+		os.Exit(exitCode)
+	},
+	Use:     docs.OciWaitUse,
+	Short:   docs.OciWaitShort,
+	Long:    docs.OciWaitLong,
+	Example: docs.OciWaitExample,
+}
+
 // OciMountCmd represents oci mount command.
 var OciMountCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(2),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := singularity.OciMount(args[0], args[1]); err != nil {
+		if err := singularity.OciMount(args[0], args[1], &ociArgs); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 	},
@@ -287,7 +451,7 @@ var OciMountCmd = &cobra.Command{
 var OciUmountCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(1),
 	DisableFlagsInUseLine: true,
-	PreRun:                func(cmd *cobra.Command, args []string) { EnsureRootPriv(cmd, ociContext) },
+	PreRun:                ociPreRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := singularity.OciUmount(args[0]); err != nil {
 			sylog.Fatalf("%s", err)
@@ -299,6 +463,28 @@ var OciUmountCmd = &cobra.Command{
 	Example: docs.OciUmountExample,
 }
 
+// OciSpecCmd represents oci spec command.
+var OciSpecCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.OciSpec(&ociArgs); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+	Use:     docs.OciSpecUse,
+	Short:   docs.OciSpecShort,
+	Long:    docs.OciSpecLong,
+	Example: docs.OciSpecExample,
+}
+
+// ociPreRun ensures root privileges and sets the external OCI runtime
+// to delegate to, if any
+func ociPreRun(cmd *cobra.Command, args []string) {
+	EnsureRootPriv(cmd, ociContext)
+	singularity.SetOciRuntime(ociRuntime)
+}
+
 // OciCmd singularity oci runtime.
 var OciCmd = &cobra.Command{
 	Run:                   nil,
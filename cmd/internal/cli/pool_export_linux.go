@@ -0,0 +1,33 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+func init() {
+	PoolExportCmd.Flags().SetInterspersed(false)
+}
+
+// PoolExportCmd is `singularity pool export`
+var PoolExportCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.PoolExport(poolDir, args[0], args[1]); err != nil {
+			sylog.Fatalf("Failed to export %s: %s", args[0], err)
+		}
+	},
+
+	Use:     docs.PoolExportUse,
+	Short:   docs.PoolExportShort,
+	Long:    docs.PoolExportLong,
+	Example: docs.PoolExportExample,
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+var poolImageName string
+
+func init() {
+	PoolImportCmd.Flags().SetInterspersed(false)
+
+	PoolImportCmd.Flags().StringVar(&poolImageName, "name", "", "name of the image in the pool (default to the image file name)")
+	PoolImportCmd.Flags().SetAnnotation("name", "envkey", []string{"NAME"})
+}
+
+// PoolImportCmd is `singularity pool import`
+var PoolImportCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.PoolImport(poolDir, poolImageName, args[0]); err != nil {
+			sylog.Fatalf("Failed to import %s: %s", args[0], err)
+		}
+	},
+
+	Use:     docs.PoolImportUse,
+	Short:   docs.PoolImportShort,
+	Long:    docs.PoolImportLong,
+	Example: docs.PoolImportExample,
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+)
+
+var poolDir string
+
+func init() {
+	defaultPoolDir := filepath.Join(buildcfg.LOCALSTATEDIR, "singularity", "pool")
+
+	for _, cmd := range []*cobra.Command{PoolImportCmd, PoolExportCmd} {
+		cmd.Flags().StringVar(&poolDir, "pool-dir", defaultPoolDir, "path to the storage pool directory")
+		cmd.Flags().SetAnnotation("pool-dir", "envkey", []string{"POOL_DIR"})
+	}
+
+	SingularityCmd.AddCommand(PoolCmd)
+	PoolCmd.AddCommand(PoolImportCmd)
+	PoolCmd.AddCommand(PoolExportCmd)
+}
+
+// PoolCmd is `singularity pool`
+var PoolCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("Invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:           docs.PoolUse,
+	Short:         docs.PoolShort,
+	Long:          docs.PoolLong,
+	Example:       docs.PoolExample,
+	SilenceErrors: true,
+}
@@ -7,7 +7,6 @@ package cli
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"os/signal"
 	"syscall"
@@ -19,6 +18,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/libexec"
 	scs "github.com/sylabs/singularity/internal/pkg/remote"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/uri"
 	"github.com/sylabs/singularity/pkg/build/types"
 	client "github.com/sylabs/singularity/pkg/client/library"
@@ -48,6 +48,10 @@ var (
 	KeyServerURL = "https://keys.sylabs.io"
 	// unauthenticatedPull when true; wont ask to keep a unsigned container after pulling it
 	unauthenticatedPull bool
+	// pullDetach queues the pull for the transfer daemon
+	pullDetach bool
+	// pullNotifyURL receives the transfer in JSON format once a detached pull completed
+	pullNotifyURL string
 )
 
 func init() {
@@ -76,8 +80,21 @@ func init() {
 	PullCmd.Flags().AddFlag(actionFlags.Lookup("docker-username"))
 	PullCmd.Flags().AddFlag(actionFlags.Lookup("docker-password"))
 	PullCmd.Flags().AddFlag(actionFlags.Lookup("docker-login"))
+	PullCmd.Flags().AddFlag(actionFlags.Lookup("platform"))
+	PullCmd.Flags().AddFlag(actionFlags.Lookup("strict-platform"))
 
 	PullCmd.Flags().AddFlag(BuildCmd.Flags().Lookup("no-cleanup"))
+	PullCmd.Flags().AddFlag(BuildCmd.Flags().Lookup("optimize"))
+	PullCmd.Flags().AddFlag(BuildCmd.Flags().Lookup("squashfs-block-size"))
+	PullCmd.Flags().AddFlag(BuildCmd.Flags().Lookup("mksquashfs-procs"))
+	PullCmd.Flags().AddFlag(BuildCmd.Flags().Lookup("mksquashfs-mem"))
+
+	PullCmd.Flags().BoolVar(&pullDetach, "detach", false, "queue the pull for a per-user background daemon, use 'singularity transfers list' to follow it")
+	PullCmd.Flags().SetAnnotation("detach", "envkey", []string{"DETACH"})
+
+	PullCmd.Flags().StringVar(&pullNotifyURL, "notify-url", "", "with --detach, POST the transfer in JSON format to <url> once completed")
+	PullCmd.Flags().SetAnnotation("notify-url", "argtag", []string{"<url>"})
+	PullCmd.Flags().SetAnnotation("notify-url", "envkey", []string{"NOTIFY_URL"})
 
 	SingularityCmd.AddCommand(PullCmd)
 }
@@ -116,6 +133,19 @@ func pullRun(cmd *cobra.Command, args []string) {
 		name = PullImageName
 	}
 
+	// images of other sources are downloaded as is
+	if optimizeSpec != "" && ociclient.IsSupported(transport) == "" {
+		sylog.Fatalf("--optimize is only supported when pulling docker and oci images")
+	}
+	if (blockSize != "" || mksquashfsProc != 0 || mksquashfsMem != "") && ociclient.IsSupported(transport) == "" {
+		sylog.Fatalf("--squashfs-block-size, --mksquashfs-procs and --mksquashfs-mem are only supported when pulling docker and oci images")
+	}
+
+	if pullDetach {
+		detachPull(cmd, args, name)
+		return
+	}
+
 	// monitor for OS signals and remove invalid file
 	c := make(chan os.Signal)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -163,22 +193,9 @@ func pullRun(cmd *cobra.Command, args []string) {
 			}
 		}
 
-		// Perms are 777 *prior* to umask
-		dstFile, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0777)
-		if err != nil {
-			sylog.Fatalf("%v\n", err)
-		}
-		defer dstFile.Close()
-
-		srcFile, err := os.OpenFile(imagePath, os.O_RDONLY, 0444)
-		if err != nil {
-			sylog.Fatalf("%v\n", err)
-		}
-		defer srcFile.Close()
-
-		// Copy SIF from cache
-		_, err = io.Copy(dstFile, srcFile)
-		if err != nil {
+		// Copy SIF from cache, data is shared with the cached image on
+		// reflink capable filesystems. Perms are 777 *prior* to umask
+		if err := fs.CopyFile(imagePath, name, 0777); err != nil {
 			sylog.Fatalf("%v\n", err)
 		}
 
@@ -227,13 +244,29 @@ func pullRun(cmd *cobra.Command, args []string) {
 		if err != nil {
 			sylog.Fatalf("While creating Docker credentials: %v", err)
 		}
+		requestedPlatform()
+		checkMksquashfsFlags()
+		plan := optimizePlan()
+		var epoch int64
+		if plan.ResetTimestamps {
+			epoch = sourceDateEpoch()
+		}
 
 		libexec.PullOciImage(name, args[i], types.Options{
-			TmpDir:           tmpDir,
-			Force:            force,
-			NoHTTPS:          noHTTPS,
-			DockerAuthConfig: authConf,
-			NoCleanUp:        noCleanUp,
+			TmpDir:            tmpDir,
+			Force:             force,
+			NoHTTPS:           noHTTPS,
+			DockerAuthConfig:  authConf,
+			NoCleanUp:         noCleanUp,
+			Platform:          imagePlatform,
+			StrictPlatform:    strictPlatform,
+			SourceDateEpoch:   epoch,
+			ResetTimestamps:   plan.ResetTimestamps,
+			OptimizePasses:    plan.Passes,
+			Compression:       plan.Compression,
+			SquashfsBlockSize: blockSize,
+			MksquashfsProcs:   mksquashfsProc,
+			MksquashfsMem:     mksquashfsMem,
 		})
 	default:
 		sylog.Fatalf("Unsupported transport type: %s", transport)
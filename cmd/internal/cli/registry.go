@@ -0,0 +1,83 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+var (
+	registryAddress  string
+	registryHtpasswd string
+	registryTLSCert  string
+	registryTLSKey   string
+)
+
+func init() {
+	RegistryServeCmd.Flags().StringVar(&registryAddress, "address", "127.0.0.1:5000", "address the registry listens on, other than loopback addresses require --htpasswd")
+	RegistryServeCmd.Flags().SetAnnotation("address", "argtag", []string{"<[host]:port>"})
+	RegistryServeCmd.Flags().SetAnnotation("address", "envkey", []string{"REGISTRY_ADDRESS"})
+
+	RegistryServeCmd.Flags().StringVar(&registryHtpasswd, "htpasswd", "", "require basic authentication with the users of an htpasswd file created with htpasswd -B")
+	RegistryServeCmd.Flags().SetAnnotation("htpasswd", "argtag", []string{"<path>"})
+	RegistryServeCmd.Flags().SetAnnotation("htpasswd", "envkey", []string{"REGISTRY_HTPASSWD"})
+
+	RegistryServeCmd.Flags().StringVar(&registryTLSCert, "tls-cert", "", "serve HTTPS with this PEM certificate, requires --tls-key")
+	RegistryServeCmd.Flags().SetAnnotation("tls-cert", "argtag", []string{"<path>"})
+	RegistryServeCmd.Flags().SetAnnotation("tls-cert", "envkey", []string{"REGISTRY_TLS_CERT"})
+
+	RegistryServeCmd.Flags().StringVar(&registryTLSKey, "tls-key", "", "PEM private key of the --tls-cert certificate")
+	RegistryServeCmd.Flags().SetAnnotation("tls-key", "argtag", []string{"<path>"})
+	RegistryServeCmd.Flags().SetAnnotation("tls-key", "envkey", []string{"REGISTRY_TLS_KEY"})
+
+	SingularityCmd.AddCommand(RegistryCmd)
+	RegistryCmd.AddCommand(RegistryServeCmd)
+}
+
+// RegistryCmd singularity registry
+var RegistryCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("Invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:           docs.RegistryUse,
+	Short:         docs.RegistryShort,
+	Long:          docs.RegistryLong,
+	Example:       docs.RegistryExample,
+	SilenceErrors: true,
+}
+
+// RegistryServeCmd singularity registry serve
+var RegistryServeCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if (registryTLSCert == "") != (registryTLSKey == "") {
+			sylog.Fatalf("--tls-cert and --tls-key must be set together")
+		}
+		c := singularity.RegistryServeConfig{
+			Dir:      args[0],
+			Address:  registryAddress,
+			Htpasswd: registryHtpasswd,
+			TLSCert:  registryTLSCert,
+			TLSKey:   registryTLSKey,
+		}
+		if err := singularity.RegistryServe(c); err != nil {
+			sylog.Fatalf("Registry failed: %s", err)
+		}
+	},
+
+	Use:     docs.RegistryServeUse,
+	Short:   docs.RegistryServeShort,
+	Long:    docs.RegistryServeLong,
+	Example: docs.RegistryServeExample,
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+// rerunDigestEnv is set by rerun to the recorded image digest, the
+// image resolved by the re-executed command must match it
+const rerunDigestEnv = "SINGULARITY_RERUN_DIGEST"
+
+var rerunShow bool
+
+func init() {
+	RerunCmd.Flags().SetInterspersed(false)
+	RerunCmd.Flags().BoolVar(&rerunShow, "show", false, "print the invocation record instead of executing it")
+
+	SingularityCmd.AddCommand(RerunCmd)
+}
+
+// RerunCmd reproduces a recorded container execution
+//
+// singularity rerun <instance|record.json>
+var RerunCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		inv := loadInvocation(args[0])
+
+		if rerunShow {
+			b, err := json.MarshalIndent(inv, "", "\t")
+			if err != nil {
+				sylog.Fatalf("failed to marshal invocation record: %s", err)
+			}
+			fmt.Println(string(b))
+			return
+		}
+		rerun(inv)
+	},
+
+	Use:     docs.RerunUse,
+	Short:   docs.RerunShort,
+	Long:    docs.RerunLong,
+	Example: docs.RerunExample,
+}
+
+// loadInvocation returns the invocation record read from the file ref,
+// or from the metadata of the instance named ref
+func loadInvocation(ref string) *singularityConfig.Invocation {
+	if fi, err := os.Stat(ref); err == nil && !fi.IsDir() {
+		data, err := ioutil.ReadFile(ref)
+		if err != nil {
+			sylog.Fatalf("failed to read invocation record: %s", err)
+		}
+		inv := &singularityConfig.Invocation{}
+		if err := json.Unmarshal(data, inv); err != nil {
+			sylog.Fatalf("failed to decode invocation record %s: %s", ref, err)
+		}
+		return inv
+	}
+
+	files, err := instance.List("", ref, instance.SingSubDir)
+	if err != nil {
+		sylog.Fatalf("failed to retrieve instance list: %s", err)
+	}
+	if len(files) != 1 {
+		sylog.Fatalf("%s is neither an invocation record file nor an instance", ref)
+	}
+
+	engineConfig := singularityConfig.NewConfig()
+	cfg := &config.Common{EngineConfig: engineConfig}
+	if err := json.Unmarshal(files[0].Config, cfg); err != nil {
+		sylog.Fatalf("failed to read instance %s configuration: %s", ref, err)
+	}
+	if engineConfig.GetInvocation() == nil {
+		sylog.Fatalf("instance %s has no invocation record", ref)
+	}
+	return engineConfig.GetInvocation()
+}
+
+// rerun executes singularity again with the recorded arguments and
+// environment from the recorded working directory
+func rerun(inv *singularityConfig.Invocation) {
+	if inv.Version != buildcfg.PACKAGE_VERSION {
+		sylog.Warningf("Invocation was recorded with singularity %s, running %s", inv.Version, buildcfg.PACKAGE_VERSION)
+	}
+	if err := os.Chdir(inv.Cwd); err != nil {
+		sylog.Fatalf("failed to change directory to %s: %s", inv.Cwd, err)
+	}
+
+	env := make([]string, 0)
+	for _, e := range os.Environ() {
+		if !isSingularityEnv(e) {
+			env = append(env, e)
+		}
+	}
+	env = append(env, inv.Env...)
+	if inv.ImageDigest != "" {
+		env = append(env, rerunDigestEnv+"="+inv.ImageDigest)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		sylog.Fatalf("failed to determine singularity executable path: %s", err)
+	}
+
+	sylog.Verbosef("Re-running singularity %s", strings.Join(inv.Args, " "))
+
+	args := append([]string{os.Args[0]}, inv.Args...)
+	if err := syscall.Exec(exe, args, env); err != nil {
+		sylog.Fatalf("failed to execute %s: %s", exe, err)
+	}
+}
+
+// isSingularityEnv returns if the environment variable e alters
+// singularity or container environment
+func isSingularityEnv(e string) bool {
+	return strings.HasPrefix(e, "SINGULARITY_") || strings.HasPrefix(e, "SINGULARITYENV_")
+}
+
+// secretFlags are the action flags whose value is a credential, they
+// are not recorded
+var secretFlags = []string{"--docker-password"}
+
+// recordedArgs returns args without the credentials passed with
+// secretFlags, only the first args not counting the positional ones are
+// singularity flags, the positional ones are kept as is
+func recordedArgs(args []string, positional int) []string {
+	recorded := make([]string, 0, len(args))
+	flags := len(args) - positional
+
+	for i := 0; i < flags; i++ {
+		secret := false
+		for _, f := range secretFlags {
+			if args[i] == f {
+				// the value is the next argument
+				i++
+				secret = true
+			} else if strings.HasPrefix(args[i], f+"=") {
+				secret = true
+			}
+		}
+		if !secret {
+			recorded = append(recorded, args[i])
+		}
+	}
+	return append(recorded, args[flags:]...)
+}
+
+// recordInvocation records the command line into the engine configuration
+// for instances, and into the file set with --record. Credentials are
+// not recorded. The image digest is only computed for --record and when
+// executed by rerun, to check it against the recorded one.
+func recordInvocation(cobraCmd *cobra.Command, engineConfig *singularityConfig.EngineConfig) {
+	expected := os.Getenv(rerunDigestEnv)
+	if !engineConfig.GetInstance() && RecordPath == "" && expected == "" {
+		return
+	}
+
+	image := engineConfig.GetImage()
+
+	var digest string
+	if RecordPath != "" || expected != "" {
+		var err error
+		digest, err = imageDigest(image)
+		if err != nil {
+			sylog.Fatalf("failed to compute image %s digest: %s", image, err)
+		}
+	}
+	if expected != "" && digest != expected {
+		sylog.Fatalf("image %s digest %s doesn't match recorded digest %s", image, digest, expected)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		sylog.Fatalf("failed to determine current directory: %s", err)
+	}
+
+	inv := &singularityConfig.Invocation{
+		Args:        recordedArgs(os.Args[1:], len(cobraCmd.Flags().Args())),
+		Cwd:         cwd,
+		Image:       image,
+		ImageDigest: digest,
+		Binds:       engineConfig.GetBindPath(),
+		Version:     buildcfg.PACKAGE_VERSION,
+	}
+	for _, e := range os.Environ() {
+		if isSingularityEnv(e) && !isSecretEnv(e) && !strings.HasPrefix(e, rerunDigestEnv+"=") {
+			inv.Env = append(inv.Env, e)
+		}
+	}
+
+	if engineConfig.GetInstance() {
+		engineConfig.SetInvocation(inv)
+	}
+	if RecordPath != "" {
+		b, err := json.MarshalIndent(inv, "", "\t")
+		if err != nil {
+			sylog.Fatalf("failed to marshal invocation record: %s", err)
+		}
+		f, err := os.OpenFile(RecordPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			sylog.Fatalf("failed to write invocation record: %s", err)
+		}
+		// an existing record keeps its mode otherwise
+		if err := f.Chmod(0600); err != nil {
+			sylog.Fatalf("failed to write invocation record: %s", err)
+		}
+		_, err = f.Write(b)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			sylog.Fatalf("failed to write invocation record: %s", err)
+		}
+	}
+}
+
+// imageDigest returns the sha256 digest of an image file, sandbox
+// directories and instances don't have digest
+func imageDigest(path string) (string, error) {
+	if strings.HasPrefix(path, "instance://") {
+		return "", nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		return "", nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordedArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional int
+		expected   []string
+	}{
+		{
+			"separate value",
+			[]string{"exec", "--docker-password", "secret", "--bind", "/data", "docker://alpine", "true"},
+			2,
+			[]string{"exec", "--bind", "/data", "docker://alpine", "true"},
+		},
+		{
+			"joined value",
+			[]string{"run", "--docker-password=secret", "docker://alpine"},
+			1,
+			[]string{"run", "docker://alpine"},
+		},
+		{
+			"container arguments",
+			[]string{"exec", "image.sif", "login", "--docker-password", "kept"},
+			4,
+			[]string{"exec", "image.sif", "login", "--docker-password", "kept"},
+		},
+	}
+	for _, tt := range tests {
+		if args := recordedArgs(tt.args, tt.positional); !reflect.DeepEqual(args, tt.expected) {
+			t.Errorf("%s: unexpected recorded arguments %v", tt.name, args)
+		}
+	}
+}
+
+func TestIsSecretEnv(t *testing.T) {
+	for e, secret := range map[string]bool{
+		"SINGULARITY_DOCKER_PASSWORD=secret":      true,
+		"SINGULARITYENV_API_TOKEN=secret":         true,
+		"SINGULARITYENV_AWS_SECRET_ACCESS_KEY=id": true,
+		"SINGULARITY_BINDPATH=/data":              false,
+		"SINGULARITYENV_PATH=/bin":                false,
+	} {
+		if isSecretEnv(e) != secret {
+			t.Errorf("%s: expected secret %v", e, secret)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+func init() {
+	SifCloneCmd.Flags().SetInterspersed(false)
+
+	SifCloneCmd.Flags().BoolVarP(&force, "force", "F", false, "overwrite the destination image if it exists")
+	SifCloneCmd.Flags().SetAnnotation("force", "envkey", []string{"FORCE"})
+}
+
+// SifCloneCmd is `singularity sif clone`
+var SifCloneCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.SifClone(args[0], args[1], force); err != nil {
+			sylog.Fatalf("Failed to clone %s: %s", args[0], err)
+		}
+	},
+
+	Use:     docs.SifCloneUse,
+	Short:   docs.SifCloneShort,
+	Long:    docs.SifCloneLong,
+	Example: docs.SifCloneExample,
+}
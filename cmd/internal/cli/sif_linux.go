@@ -0,0 +1,33 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+)
+
+func init() {
+	SingularityCmd.AddCommand(SifCmd)
+	SifCmd.AddCommand(SifCloneCmd)
+	SifCmd.AddCommand(SifVerifyIntegrityCmd)
+}
+
+// SifCmd is `singularity sif`
+var SifCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("Invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:           docs.SifUse,
+	Short:         docs.SifShort,
+	Long:          docs.SifLong,
+	Example:       docs.SifExample,
+	SilenceErrors: true,
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+var repairImage bool
+
+func init() {
+	SifVerifyIntegrityCmd.Flags().SetInterspersed(false)
+
+	SifVerifyIntegrityCmd.Flags().BoolVar(&repairImage, "repair", false, "repair recoverable metadata damages")
+	SifVerifyIntegrityCmd.Flags().SetAnnotation("repair", "envkey", []string{"REPAIR"})
+}
+
+// SifVerifyIntegrityCmd is `singularity sif verify-integrity`
+var SifVerifyIntegrityCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.SifVerifyIntegrity(args[0], repairImage); err != nil {
+			sylog.Fatalf("Integrity check of %s failed: %s", args[0], err)
+		}
+	},
+
+	Use:     docs.SifVerifyIntegrityUse,
+	Short:   docs.SifVerifyIntegrityShort,
+	Long:    docs.SifVerifyIntegrityLong,
+	Example: docs.SifVerifyIntegrityExample,
+}
@@ -31,6 +31,11 @@ var (
 	silent  bool
 	verbose bool
 	quiet   bool
+
+	jsonErrors bool
+
+	versionCapabilities bool
+	versionJSON         bool
 )
 
 var (
@@ -85,10 +90,13 @@ func init() {
 	SingularityCmd.Flags().BoolVarP(&silent, "silent", "s", false, "only print errors")
 	SingularityCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "suppress normal output")
 	SingularityCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "print additional information")
+	SingularityCmd.Flags().BoolVar(&jsonErrors, "json-errors", false, "print fatal errors on stderr as JSON objects with exit code and category")
 	SingularityCmd.Flags().StringVarP(&tokenFile, "tokenfile", "t", defaultTokenFile, "path to the file holding your sylabs authentication token")
 	SingularityCmd.Flags().MarkDeprecated("tokenfile", "Use 'singularity remote' to manage remote endpoints and tokens.")
 
 	VersionCmd.Flags().SetInterspersed(false)
+	VersionCmd.Flags().BoolVar(&versionCapabilities, "capabilities", false, "show which privileged features (setuid, user namespace, overlay, seccomp, cgroups v2) are available on this host")
+	VersionCmd.Flags().BoolVar(&versionJSON, "json", false, "show the version, build tags, available features, plugin ABI and supported image formats in JSON format")
 	SingularityCmd.AddCommand(VersionCmd)
 
 	initializePlugins()
@@ -119,6 +127,12 @@ func setSylogColor(cmd *cobra.Command, args []string) {
 	}
 }
 
+func setSylogJSONErrors(cmd *cobra.Command, args []string) {
+	if jsonErrors {
+		sylog.SetJSONErrors(true)
+	}
+}
+
 // SingularityCmd is the base command when called without any subcommands
 var SingularityCmd = &cobra.Command{
 	TraverseChildren:      true,
@@ -170,6 +184,14 @@ func TraverseParentsUses(cmd *cobra.Command) string {
 var VersionCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	Run: func(cmd *cobra.Command, args []string) {
+		if versionJSON {
+			printVersionJSON()
+			return
+		}
+		if versionCapabilities {
+			printCapabilities()
+			return
+		}
 		fmt.Println(buildcfg.PACKAGE_VERSION)
 	},
 
@@ -202,6 +224,7 @@ func handleEnv(flag *pflag.Flag) {
 func persistentPreRun(cmd *cobra.Command, args []string) {
 	setSylogMessageLevel(cmd, args)
 	setSylogColor(cmd, args)
+	setSylogJSONErrors(cmd, args)
 	updateFlagsFromEnv(cmd)
 }
 
@@ -372,7 +395,9 @@ var flagEnvFuncs = map[string]envHandle{
 	// action flags
 	"bind":          envAppend,
 	"home":          envStringNSlice,
+	"home-mode":     envStringNSlice,
 	"overlay":       envStringNSlice,
+	"compose":       envStringNSlice,
 	"scratch":       envStringNSlice,
 	"workdir":       envStringNSlice,
 	"shell":         envStringNSlice,
@@ -385,25 +410,57 @@ var flagEnvFuncs = map[string]envHandle{
 	"security":      envStringNSlice,
 	"apply-cgroups": envStringNSlice,
 	"app":           envStringNSlice,
-
-	"boot":           envBool,
-	"fakeroot":       envBool,
-	"cleanenv":       envBool,
-	"contain":        envBool,
-	"containall":     envBool,
-	"nv":             envBool,
-	"no-nv":          envBool,
-	"vm":             envBool,
-	"writable":       envBool,
-	"writable-tmpfs": envBool,
-	"no-home":        envBool,
-	"no-init":        envBool,
-
-	"pid":    envBool,
-	"ipc":    envBool,
-	"net":    envBool,
-	"uts":    envBool,
-	"userns": envBool,
+	"pty-timing":    envStringNSlice,
+	"usage-file":    envStringNSlice,
+	"stage-to":      envStringNSlice,
+	"timeout":       envStringNSlice,
+	"stop-signal":   envStringNSlice,
+	"stop-timeout":  envStringNSlice,
+	"platform":      envStringNSlice,
+	"thp":           envStringNSlice,
+	"mempolicy":     envStringNSlice,
+	"observe-file":  envStringNSlice,
+
+	"add-passwd-entry": envStringNSlice,
+
+	"boot":             envBool,
+	"fakeroot":         envBool,
+	"cleanenv":         envBool,
+	"no-host-env":      envBool,
+	"contain":          envBool,
+	"containall":       envBool,
+	"private-tmp":      envBool,
+	"private-devs":     envBool,
+	"no-init-net":      envBool,
+	"nv":               envBool,
+	"host-singularity": envBool,
+	"krb5":             envBool,
+	"job-templates":    envBool,
+	"dbus":             envBool,
+	"xdg-runtime-dir":  envBool,
+	"gui":              envBool,
+	"alsa":             envBool,
+	"pulse":            envBool,
+	"video":            envBool,
+	"pty":              envBool,
+	"usage":            envBool,
+	"observe":          envBool,
+	"no-nv":            envBool,
+	"vm":               envBool,
+	"writable":         envBool,
+	"writable-tmpfs":   envBool,
+	"no-home":          envBool,
+	"no-init":          envBool,
+	"no-label-flags":   envBool,
+	"no-image-seccomp": envBool,
+	"env-via-file":     envBool,
+
+	"pid":      envBool,
+	"ipc":      envBool,
+	"net":      envBool,
+	"uts":      envBool,
+	"userns":   envBool,
+	"cgroupns": envBool,
 
 	"keep-privs":   envBool,
 	"no-privs":     envBool,
@@ -420,20 +477,41 @@ var flagEnvFuncs = map[string]envHandle{
 	"force":           envBool,
 	"update":          envBool,
 	"notest":          envBool,
+	"test-timeout":    envStringNSlice,
+	"test-retries":    envStringNSlice,
+	"keep-failed":     envBool,
 	"remote":          envBool,
 	"detached":        envBool,
 	"builder":         envStringNSlice,
+	"context-limit":   envStringNSlice,
+	"resolv-conf":     envStringNSlice,
+	"proot":           envBool,
 	"library":         envStringNSlice,
 	"nohttps":         envBool,
 	"no-cleanup":      envBool,
+	"disable-cache":   envBool,
+	"cache-sections":  envBool,
+	"build-arg":       envAppend,
+	"build-arg-file":  envStringNSlice,
 	"tmpdir":          envStringNSlice,
 	"docker-username": envStringNSlice,
 	"docker-password": envStringNSlice,
 	"docker-login":    envBool,
+	"strict-platform": envBool,
+	"arch":            envStringNSlice,
+	"reproducible":    envBool,
+	"expect-digest":   envStringNSlice,
+	"optimize":        envStringNSlice,
+
+	"squashfs-block-size": envStringNSlice,
+	"mksquashfs-procs":    envStringNSlice,
+	"mksquashfs-mem":      envStringNSlice,
 
 	// push/pull flags
 	"allow-unauthenticated": envBool,
 	"allow-unsigned":        envBool,
+	"detach":                envBool,
+	"notify-url":            envStringNSlice,
 
 	// capability flags (and others)
 	"user":  envStringNSlice,
@@ -442,12 +520,23 @@ var flagEnvFuncs = map[string]envHandle{
 	"all":   envBool,
 
 	// instance flags
-	"signal": envStringNSlice,
+	"signal":      envStringNSlice,
+	"notify-exec": envAppend,
+	"sshd":        envStringNSlice,
 
 	// keys flags
 	"secret": envBool,
 	"url":    envStringNSlice,
 
+	// pool flags
+	"pool-dir": envStringNSlice,
+
+	// registry flags
+	"address":  envStringNSlice,
+	"htpasswd": envStringNSlice,
+	"tls-cert": envStringNSlice,
+	"tls-key":  envStringNSlice,
+
 	// verify flag
 	"local": envBool,
 
@@ -459,3 +548,19 @@ var flagEnvFuncs = map[string]envHandle{
 	"environment": envBool,
 	"helpfile":    envBool,
 }
+
+// secretEnvWords identify environment variables holding credentials by
+// name, they are neither recorded nor stored in the transfer queue
+var secretEnvWords = []string{"PASSWORD", "PASSPHRASE", "TOKEN", "SECRET", "CREDENTIAL"}
+
+// isSecretEnv returns if the name of the environment variable e looks
+// like the name of a credential
+func isSecretEnv(e string) bool {
+	name := strings.ToUpper(strings.SplitN(e, "=", 2)[0])
+	for _, w := range secretEnvWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
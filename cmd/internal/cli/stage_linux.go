@@ -0,0 +1,187 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/plugin"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	client "github.com/sylabs/singularity/pkg/client/library"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+	"github.com/sylabs/singularity/pkg/util/fs/lock"
+)
+
+// stageImage copies the image to the directory requested with --stage-to,
+// or extracts it there when a sandbox is required by the user namespace.
+// The staged image is named after the image digest and shared by the
+// containers running the same image. Without a stage provider plugin it
+// is staged in a subdirectory owned by the user and removed at exit of
+// its last container, otherwise it's removed by the plugin at job end
+func stageImage(engineConfig *singularityConfig.EngineConfig, image string, extract bool, unsquashfsPath string) {
+	if !fs.IsDir(StageTo) {
+		sylog.Fatalf("stage directory %s doesn't exist", StageTo)
+	}
+
+	if p := plugin.StageProvider(); p != nil {
+		dir, err := p.Allocate(engineConfig, StageTo)
+		if err != nil {
+			sylog.Fatalf("stage provider %s failed: %s", p.Name, err)
+		}
+		staged, err := stageShared(dir, image, extract, unsquashfsPath)
+		if err != nil {
+			sylog.Fatalf("while staging %s to %s: %s", image, dir, err)
+		}
+		engineConfig.SetImage(staged)
+		return
+	}
+
+	dir, err := userStageDir(StageTo)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	// the lock prevents the removal of the staged image by a
+	// container exiting before this one is registered as a user
+	fd, err := lock.Exclusive(dir)
+	if err != nil {
+		sylog.Fatalf("could not lock stage directory %s: %s", dir, err)
+	}
+	defer lock.Release(fd)
+
+	staged, err := stageShared(dir, image, extract, unsquashfsPath)
+	if err != nil {
+		sylog.Fatalf("while staging %s to %s: %s", image, dir, err)
+	}
+	user, err := fs.AddStageUser(staged)
+	if err != nil {
+		sylog.Fatalf("could not register container as user of %s: %s", staged, err)
+	}
+	engineConfig.SetImage(staged)
+	engineConfig.SetStageUser(user)
+}
+
+// copyNFSImage copies the image to the local temporary directory if it
+// resides on NFS, the copy is removed at exit
+func copyNFSImage(engineConfig *singularityConfig.EngineConfig, image string) {
+	if nfs, err := fs.IsNFS(image); err != nil || !nfs {
+		return
+	}
+
+	sylog.Verbosef("Copy image %s residing on NFS to %s", image, os.TempDir())
+	staged, err := stageCopy(os.TempDir(), image)
+	if err != nil {
+		sylog.Fatalf("while copying %s to %s: %s", image, os.TempDir(), err)
+	}
+	engineConfig.SetImage(staged)
+	engineConfig.SetDeleteImage(true)
+}
+
+// stageCopy copies the image to a temporary file created in dir
+func stageCopy(dir string, image string) (string, error) {
+	f, err := ioutil.TempFile(dir, "singularity-stage-")
+	if err != nil {
+		return "", fmt.Errorf("could not create staged image: %s", err)
+	}
+	f.Close()
+
+	if err := fs.CopyFile(image, f.Name(), 0755); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// userStageDir returns the subdirectory of the stage directory base
+// private to the user, it's created if it doesn't exist
+func userStageDir(base string) (string, error) {
+	dir := filepath.Join(base, fmt.Sprintf("singularity-stage-%d", os.Getuid()))
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("could not create stage directory %s: %s", dir, err)
+	}
+	if err := checkStaged(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// checkStaged returns an error if path is a symbolic link, isn't owned by
+// the user or is writable by other users, a staged image must not be
+// reused otherwise
+func checkStaged(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("could not get owner of %s", path)
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s is a symbolic link", path)
+	}
+	if int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not owned by user %d", path, os.Getuid())
+	}
+	if fi.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s is writable by other users", path)
+	}
+	return nil
+}
+
+// stageShared stages the image in dir, the staged image is named after
+// the image digest so it's reused by subsequent containers running the
+// same image
+func stageShared(dir string, image string, extract bool, unsquashfsPath string) (string, error) {
+	digest, err := client.ImageHash(image)
+	if err != nil {
+		return "", fmt.Errorf("could not compute image digest: %s", err)
+	}
+
+	path := filepath.Join(dir, digest)
+	if extract {
+		path += "-rootfs"
+	}
+	if _, err := os.Lstat(path); err == nil {
+		if err := checkStaged(path); err != nil {
+			return "", fmt.Errorf("could not reuse staged image: %s", err)
+		}
+		sylog.Verbosef("Using image %s already staged at %s", image, path)
+		return path, nil
+	}
+
+	var tmp string
+
+	if extract {
+		sylog.Verbosef("User namespace requested, extract image %s to %s", image, dir)
+		tmp, err = convertImage(image, unsquashfsPath, dir)
+	} else {
+		sylog.Verbosef("Copy image %s to %s", image, dir)
+		tmp, err = stageCopy(dir, image)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		// another container of the job may have staged
+		// the same image concurrently
+		os.RemoveAll(tmp)
+		if _, serr := os.Lstat(path); serr == nil {
+			if err := checkStaged(path); err != nil {
+				return "", fmt.Errorf("could not reuse staged image: %s", err)
+			}
+			return path, nil
+		}
+		return "", fmt.Errorf("could not rename staged image: %s", err)
+	}
+	return path, nil
+}
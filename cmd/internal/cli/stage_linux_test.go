@@ -0,0 +1,162 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	client "github.com/sylabs/singularity/pkg/client/library"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+func TestStageImage(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "stage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "image.sif")
+	if err := ioutil.WriteFile(image, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := client.ImageHash(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stageDir := filepath.Join(dir, "stage")
+	if err := os.Mkdir(stageDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(dir string) { StageTo = dir }(StageTo)
+	StageTo = stageDir
+
+	userDir := filepath.Join(stageDir, fmt.Sprintf("singularity-stage-%d", os.Getuid()))
+	staged := filepath.Join(userDir, digest)
+
+	var users []string
+	for i := 0; i < 2; i++ {
+		engineConfig := singularityConfig.NewConfig()
+		stageImage(engineConfig, image, false, "")
+
+		if engineConfig.GetImage() != staged {
+			t.Fatalf("unexpected staged image %s, expected %s", engineConfig.GetImage(), staged)
+		}
+		if engineConfig.GetDeleteImage() {
+			t.Errorf("shared staged image set to be deleted at exit")
+		}
+		if engineConfig.GetStageUser() == "" {
+			t.Fatalf("container not registered as user of %s", staged)
+		}
+		users = append(users, engineConfig.GetStageUser())
+
+		// the second container reuses the staged copy
+		if i == 0 {
+			if err := ioutil.WriteFile(staged, []byte("staged"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	data, err := ioutil.ReadFile(staged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "staged" {
+		t.Errorf("staged image copied again instead of being reused")
+	}
+	entries, err := ioutil.ReadDir(userDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("unexpected stage directory entries %v", entries)
+	}
+
+	// the staged image is removed with its last user
+	for i, user := range users {
+		removed, err := fs.RemoveStageUser(staged, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed != (i == len(users)-1) {
+			t.Errorf("unexpected removal %v after user %d exit", removed, i)
+		}
+	}
+}
+
+func TestStageSharedChecks(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "stage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "image.sif")
+	if err := ioutil.WriteFile(image, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := client.ImageHash(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a staged image writable by other users isn't reused
+	stageDir := filepath.Join(dir, "stage")
+	if err := os.Mkdir(stageDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	staged := filepath.Join(stageDir, digest)
+	if err := ioutil.WriteFile(staged, []byte("staged"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(staged, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stageShared(stageDir, image, false, ""); err == nil {
+		t.Errorf("unexpected reuse of a staged image writable by other users")
+	}
+
+	// nor a symbolic link
+	if err := os.Remove(staged); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(image, staged); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stageShared(stageDir, image, false, ""); err == nil {
+		t.Errorf("unexpected reuse of a symbolic link as staged image")
+	}
+
+	// the user stage directory must not be writable by other users
+	base := filepath.Join(dir, "base")
+	userDir := filepath.Join(base, fmt.Sprintf("singularity-stage-%d", os.Getuid()))
+	if err := os.MkdirAll(userDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := userStageDir(base); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := os.Chmod(userDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := userStageDir(base); err == nil {
+		t.Errorf("unexpected success with a stage directory writable by other users")
+	}
+}
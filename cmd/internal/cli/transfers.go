@@ -0,0 +1,218 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/transfer"
+)
+
+// transferDaemonIdle is how long the transfer daemon waits for new
+// transfers before exiting
+const transferDaemonIdle = time.Minute
+
+var (
+	transfersJSON bool
+	transferID    string
+)
+
+func init() {
+	// -j|--json
+	TransfersListCmd.Flags().BoolVarP(&transfersJSON, "json", "j", false, "print transfers in JSON format, one per line")
+	TransfersListCmd.Flags().SetAnnotation("json", "envkey", []string{"JSON"})
+
+	// --transfer
+	TransfersDaemonCmd.Flags().StringVar(&transferID, "transfer", "", "run only the transfer requiring credentials with this ID")
+
+	SingularityCmd.AddCommand(TransfersCmd)
+	TransfersCmd.AddCommand(TransfersListCmd)
+	TransfersCmd.AddCommand(TransfersCleanCmd)
+	TransfersCmd.AddCommand(TransfersDaemonCmd)
+}
+
+// TransfersCmd singularity transfers
+var TransfersCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("Invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:           docs.TransfersUse,
+	Short:         docs.TransfersShort,
+	Long:          docs.TransfersLong,
+	Example:       docs.TransfersExample,
+	SilenceErrors: true,
+}
+
+// TransfersListCmd singularity transfers list
+var TransfersListCmd = &cobra.Command{
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := singularity.TransfersList(os.Stdout, transfersJSON); err != nil {
+			sylog.Fatalf("Failed to list transfers: %s", err)
+		}
+	},
+
+	Use:     docs.TransfersListUse,
+	Short:   docs.TransfersListShort,
+	Long:    docs.TransfersListLong,
+	Example: docs.TransfersListExample,
+}
+
+// TransfersCleanCmd singularity transfers clean
+var TransfersCleanCmd = &cobra.Command{
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		n, err := singularity.TransfersClean()
+		if err != nil {
+			sylog.Fatalf("Failed to clean transfers: %s", err)
+		}
+		sylog.Infof("Removed %d completed transfer(s)", n)
+	},
+
+	Use:     docs.TransfersCleanUse,
+	Short:   docs.TransfersCleanShort,
+	Long:    docs.TransfersCleanLong,
+	Example: docs.TransfersCleanExample,
+}
+
+// TransfersDaemonCmd runs the queued transfers, it's started by
+// pull --detach
+var TransfersDaemonCmd = &cobra.Command{
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+	Hidden:                true,
+	Run: func(cmd *cobra.Command, args []string) {
+		q, err := transfer.DefaultQueue()
+		if err != nil {
+			sylog.Fatalf("Could not determine transfer queue: %s", err)
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			sylog.Fatalf("Could not determine singularity path: %s", err)
+		}
+
+		d := &transfer.Daemon{
+			Queue: q,
+			Command: func(t *transfer.Transfer) *exec.Cmd {
+				cmd := exec.Command(exe, append([]string{"pull"}, t.Args...)...)
+				cmd.Dir = t.Cwd
+				cmd.Env = t.Env
+				if t.Credentials {
+					// credentials are only in the environment of
+					// the daemon started for the transfer
+					for _, e := range os.Environ() {
+						if isCredentialEnv(e) {
+							cmd.Env = append(cmd.Env, e)
+						}
+					}
+				}
+				return cmd
+			},
+			Idle: transferDaemonIdle,
+			ID:   transferID,
+		}
+		if err := d.Run(); err != nil {
+			sylog.Fatalf("Transfer daemon failed: %s", err)
+		}
+	},
+
+	Use: "daemon",
+}
+
+// isCredentialEnv returns if the environment variable e holds credentials,
+// they are not stored in the transfer queue
+func isCredentialEnv(e string) bool {
+	return isSecretEnv(e) || strings.HasPrefix(e, envPrefix+"DOCKER_USERNAME=")
+}
+
+// detachPull queues the pull of args for the transfer daemon and starts
+// the daemon if it's not running. Pulls requiring credentials are run by
+// a daemon started for them, the credentials are passed through its
+// environment and never written to the queue.
+func detachPull(cmd *cobra.Command, args []string, name string) {
+	if dockerLogin {
+		sylog.Fatalf("--docker-login is interactive and can't be used with --detach")
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		sylog.Fatalf("Could not determine working directory: %s", err)
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(cwd, name)
+	}
+	t := &transfer.Transfer{
+		Source:    args[len(args)-1],
+		Dest:      name,
+		Cwd:       cwd,
+		NotifyURL: pullNotifyURL,
+	}
+
+	var credentials []string
+	for _, e := range os.Environ() {
+		// the daemon must not queue the pull again
+		if strings.HasPrefix(e, envPrefix+"DETACH=") || strings.HasPrefix(e, envPrefix+"NOTIFY_URL=") {
+			continue
+		}
+		if isCredentialEnv(e) {
+			credentials = append(credentials, e)
+		} else {
+			t.Env = append(t.Env, e)
+		}
+	}
+
+	// flags are passed to the pull run by the daemon, docker credentials
+	// through the environment
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		switch f.Name {
+		case "detach", "notify-url":
+		case "docker-username":
+			credentials = append(credentials, envPrefix+"DOCKER_USERNAME="+f.Value.String())
+		case "docker-password":
+			credentials = append(credentials, envPrefix+"DOCKER_PASSWORD="+f.Value.String())
+		default:
+			t.Args = append(t.Args, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	t.Args = append(t.Args, args...)
+	t.Credentials = len(credentials) > 0
+
+	q, err := transfer.DefaultQueue()
+	if err != nil {
+		sylog.Fatalf("Could not determine transfer queue: %s", err)
+	}
+	if err := q.Add(t); err != nil {
+		sylog.Fatalf("Could not queue transfer: %s", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		sylog.Fatalf("Could not determine singularity path: %s", err)
+	}
+	if t.Credentials {
+		err = q.StartTransferDaemon(exe, append(t.Env, credentials...), "transfers", "daemon", "--transfer", t.ID)
+	} else {
+		err = q.StartDaemon(exe, "transfers", "daemon")
+	}
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	sylog.Infof("Queued transfer %s, use 'singularity transfers list' to follow it", t.ID)
+}
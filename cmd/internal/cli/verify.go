@@ -13,6 +13,7 @@ import (
 	"github.com/sylabs/singularity/docs"
 	scs "github.com/sylabs/singularity/internal/pkg/remote"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/exitcode"
 	"github.com/sylabs/singularity/pkg/signing"
 )
 
@@ -75,7 +76,7 @@ func doVerifyCmd(cpath, url string) {
 
 	notLocalKey, err := signing.Verify(cpath, url, id, isGroup, authToken, localVerify, false)
 	if err != nil {
-		sylog.Fatalf("%v", err)
+		exitcode.Fatalf(exitcode.VerificationFailed, "%v", err)
 	}
 	if notLocalKey {
 		os.Exit(1)
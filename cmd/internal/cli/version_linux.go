@@ -0,0 +1,56 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+	"github.com/sylabs/singularity/pkg/util/features"
+	"github.com/sylabs/singularity/pkg/util/version"
+)
+
+// versionFileConfig returns the parsed singularity.conf, or nil when it
+// can't be parsed
+func versionFileConfig() *singularityConfig.FileConfig {
+	fileConfig := &singularityConfig.FileConfig{}
+	configurationFile := buildcfg.SYSCONFDIR + "/singularity/singularity.conf"
+	if err := config.Parser(configurationFile, fileConfig); err != nil {
+		sylog.Warningf("Unable to parse singularity.conf file, configuration is ignored: %s", err)
+		return nil
+	}
+	return fileConfig
+}
+
+// printCapabilities prints the availability of privileged features
+func printCapabilities() {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FEATURE\tAVAILABLE\tREASON")
+	for _, s := range features.Detect(versionFileConfig()) {
+		available := "yes"
+		if !s.Available {
+			available = "no"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Feature, available, s.Reason)
+	}
+	tw.Flush()
+}
+
+// printVersionJSON prints the version, build tags, available features and
+// supported image formats in JSON format
+func printVersionJSON() {
+	b, err := json.MarshalIndent(version.Get(versionFileConfig()), "", "  ")
+	if err != nil {
+		sylog.Fatalf("While encoding version information: %s", err)
+	}
+	fmt.Println(string(b))
+}
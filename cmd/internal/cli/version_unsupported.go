@@ -0,0 +1,20 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package cli
+
+import (
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+func printCapabilities() {
+	sylog.Fatalf("features detection is not supported on this platform")
+}
+
+func printVersionJSON() {
+	sylog.Fatalf("features detection is not supported on this platform")
+}
@@ -19,10 +19,11 @@
 #define warningf(b...)   singularity_message(WARNING, b)
 #define errorf(b...)     singularity_message(ERROR, b)
 
-#define MAX_JSON_SIZE       128*1024
+#define MAX_JSON_SIZE       16*1024*1024
 #define MAX_MAP_SIZE        4096
 #define MAX_NS_PATH_SIZE    PATH_MAX
 #define MAX_GID             32
+#define MAX_TIME_OFFSETS    256
 
 struct fdlist {
     int *fds;
@@ -46,6 +47,8 @@ struct namespace {
     char uts[MAX_NS_PATH_SIZE];
     char cgroup[MAX_NS_PATH_SIZE];
     char pid[MAX_NS_PATH_SIZE];
+    char time[MAX_NS_PATH_SIZE];
+    char timeOffsets[MAX_TIME_OFFSETS];
 };
 
 struct container {
@@ -58,6 +58,10 @@
 #define CLONE_NEWCGROUP     0x02000000
 #endif
 
+#ifndef CLONE_NEWTIME
+#define CLONE_NEWTIME       0x00000080
+#endif
+
 #include "include/capability.h"
 #include "include/message.h"
 #include "include/starter.h"
@@ -289,6 +293,11 @@ static int create_namespace(int nstype) {
         verbosef("Create cgroup namespace\n");
         break;
 #endif /* NS_CLONE_NEWCGROUP */
+#ifdef NS_CLONE_NEWTIME
+    case CLONE_NEWTIME:
+        verbosef("Create time namespace\n");
+        break;
+#endif /* NS_CLONE_NEWTIME */
     default:
         warningf("Skipping unknown namespace creation\n");
         errno = EINVAL;
@@ -348,6 +357,11 @@ static int enter_namespace(char *nspath, int nstype) {
         verbosef("Entering in cgroup namespace\n");
         break;
 #endif /* NS_CLONE_NEWCGROUP */
+#ifdef NS_CLONE_NEWTIME
+    case CLONE_NEWTIME:
+        verbosef("Entering in time namespace\n");
+        break;
+#endif /* NS_CLONE_NEWTIME */
     default:
         verbosef("Entering in unknown namespace\n");
         errno = EINVAL;
@@ -568,13 +582,56 @@ static void cgroup_namespace_init(struct cConfig *config) {
         if ( enter_namespace(config->namespace.cgroup, CLONE_NEWCGROUP) < 0 ) {
             fatalf("Failed to enter in cgroup namespace: %s\n", strerror(errno));
         }
-    } else if ( config->namespace.flags & CLONE_NEWCGROUP ) {
+    }
+}
+
+/*
+ * a new cgroup namespace is rooted at the cgroup of the process creating it,
+ * it's created by stage 2 once the container joined its cgroup during the
+ * container setup
+ */
+static void cgroup_namespace_create(struct cConfig *config) {
+    if ( config->namespace.cgroup[0] == 0 && config->namespace.flags & CLONE_NEWCGROUP ) {
         if ( create_namespace(CLONE_NEWCGROUP) < 0 ) {
             fatalf("Failed to create cgroup namespace: %s\n", strerror(errno));
         }
     }
 }
 
+static void time_namespace_init(struct cConfig *config) {
+    if ( config->namespace.time[0] != 0 ) {
+        if ( enter_namespace(config->namespace.time, CLONE_NEWTIME) < 0 ) {
+            fatalf("Failed to enter in time namespace: %s\n", strerror(errno));
+        }
+    } else if ( config->namespace.flags & CLONE_NEWTIME ) {
+        int fd;
+        size_t len = strlen(config->namespace.timeOffsets);
+
+        /* the time namespace applies to children created after unshare */
+        if ( create_namespace(CLONE_NEWTIME) < 0 ) {
+            fatalf("Failed to create time namespace: %s\n", strerror(errno));
+        }
+
+        /* offsets must be written before any process enters the namespace */
+        if ( len > 0 ) {
+            debugf("Set time namespace offsets\n");
+            fd = open("/proc/self/timens_offsets", O_WRONLY);
+            if ( fd < 0 ) {
+                fatalf("Failed to open time namespace offsets: %s\n", strerror(errno));
+            }
+            if ( write(fd, config->namespace.timeOffsets, len) < 0 ) {
+                fatalf("Failed to write time namespace offsets: %s\n", strerror(errno));
+            }
+            close(fd);
+        }
+
+        /* then enter it to apply it to the current process too */
+        if ( enter_namespace("/proc/self/ns/time_for_children", CLONE_NEWTIME) < 0 ) {
+            fatalf("Failed to enter in time namespace: %s\n", strerror(errno));
+        }
+    }
+}
+
 static void mount_namespace_init(struct cConfig *config) {
     if ( config->namespace.mount[0] != 0 ) {
         if ( enter_namespace(config->namespace.mount, CLONE_NEWNS) < 0 ) {
@@ -934,8 +991,27 @@ __attribute__((constructor)) static void init(void) {
     /* read json configuration from stdin */
     debugf("Read json configuration from pipe\n");
 
-    if ( ( config->json.size = read(pipe_fd, config->json.config, MAX_JSON_SIZE - 1) ) <= 0 ) {
-        fatalf("Read JSON configuration from pipe failed: %s\n", strerror(errno));
+    /*
+     * configuration may not be read at once, shared memory pages are
+     * only allocated for the size of the configuration
+     */
+    config->json.size = 0;
+    while ( config->json.size < MAX_JSON_SIZE - 1 ) {
+        ssize_t n = read(pipe_fd, config->json.config + config->json.size, MAX_JSON_SIZE - 1 - config->json.size);
+        if ( n < 0 ) {
+            if ( errno == EINTR ) {
+                continue;
+            }
+            fatalf("Read JSON configuration from pipe failed: %s\n", strerror(errno));
+        } else if ( n == 0 ) {
+            break;
+        }
+        config->json.size += n;
+    }
+    if ( config->json.size == 0 ) {
+        fatalf("Read JSON configuration from pipe failed: empty configuration\n");
+    } else if ( config->json.size == MAX_JSON_SIZE - 1 ) {
+        fatalf("JSON configuration exceeds %d bytes\n", MAX_JSON_SIZE - 1);
     }
     close(pipe_fd);
 
@@ -1098,6 +1174,8 @@ __attribute__((constructor)) static void init(void) {
 
         cgroup_namespace_init(config);
 
+        time_namespace_init(config);
+
         mount_namespace_init(config);
 
         close(sync_pipe[0]);
@@ -1122,14 +1200,16 @@ __attribute__((constructor)) static void init(void) {
             } else if ( process > 0 ) {
                 int status;
 
-                execute = prepare_stage(STAGE2, config);
-
                 if ( wait(&status) != process ) {
                     fatalf("Error while waiting RPC server: %s\n", strerror(errno));
                 }
                 if ( rpc_socket[1] != -1 ) {
                     close(rpc_socket[1]);
                 }
+
+                cgroup_namespace_create(config);
+
+                execute = prepare_stage(STAGE2, config);
             } else {
                 fatalf("Fork failed: %s\n", strerror(errno));
             }
@@ -21,7 +21,21 @@ Enterprise Performance Computing (EPC)`
   Singularity containers provide an application virtualization layer enabling
   mobility of compute via both application and environment portability. With
   Singularity one is capable of building a root file system that runs on any 
-  other Linux system where Singularity is installed.`
+  other Linux system where Singularity is installed.
+
+  Exit status of container commands:
+
+      0-127    exit status of the container command
+      128+N    container command was terminated by signal N
+      193      container process was stopped after its --timeout expired
+      194      container process was killed by the out of memory killer
+      195      image signature or execution control list verification failed
+      196      container image not found
+      255      any other Singularity failure
+
+  With --json-errors (or SINGULARITY_JSON_ERRORS=1) fatal errors are written
+  on stderr as a JSON object: {"code": 196, "category": "image-not-found",
+  "message": "..."}.`
 	SingularityExample string = `
   $ singularity help <command> [<subcommand>]
   $ singularity help build
@@ -40,6 +54,18 @@ Enterprise Performance Computing (EPC)`
 
       default:    The compressed Singularity read only image format (default)
       sandbox:    This is a read-write container within a directory structure
+      oci-archive:<path>[:tag]
+                  An OCI image archive, as used by Kubernetes and other OCI
+                  runtimes
+      docker://<registry>/<image>:<tag>
+                  An OCI image pushed to a Docker registry, credentials are
+                  set with --docker-login or the docker username and password
+                  options
+
+  OCI images hold the root file system as a single layer, the labels of the
+  image and the environment of docker or oci base images. Their entrypoint is
+  /.singularity.d/actions/run, which sources the container environment and
+  runs the runscript, so it requires /bin/sh in the image.
 
   note: It is a common workflow to use the "sandbox" mode for development of the
   container, and then build it as a default Singularity image for production 
@@ -60,7 +86,297 @@ Enterprise Performance Computing (EPC)`
 
       library://  an image library (default https://cloud.sylabs.io/library)
       docker://   a Docker registry (default Docker Hub)
-      shub://     a Singularity registry (default Singularity Hub)`
+      shub://     a Singularity registry (default Singularity Hub)
+
+  A def file can also be read from standard input with "-" or downloaded
+  from an https URL ending with .def. Instead of a def file, a tar
+  archive (.tar, .tar.gz or .tgz URL) holding a def file named Singularity
+  or a single .def file at its root, and the files it copies in its %files
+  section, can be given. Relative %files sources are resolved from the
+  archive root, symbolic links of the archive must point inside it.
+
+  DOCKERFILE:
+
+  A Dockerfile, named Dockerfile, Dockerfile.<name> or <name>.dockerfile, can
+  be used as def file without Docker installed. Its FROM, RUN, COPY, ADD, ENV,
+  ARG, WORKDIR, LABEL, ENTRYPOINT and CMD instructions are translated to a def
+  file, one stage per FROM, and other instructions are ignored. COPY sources
+  are read from the Dockerfile directory and ARG values are set with
+  --build-arg. The files of a stage are copied before its RUN instructions
+  run, ADD does not extract archives and FROM can't refer to a previous stage.
+  COPY --from copies from a previous stage, or from the docker image of that
+  name when there is no such stage.
+
+  SANDBOX AND INSTANCE SNAPSHOTS:
+
+  'Bootstrap: sandbox' starts from a copy of the sandbox directory of the
+  From header, and 'Bootstrap: instance' from a copy of the root file system
+  of the running instance named in the From header, as seen by its
+  processes, including changes made with --writable-tmpfs or --overlay. The
+  content of directories mounted in the instance (/proc, /dev, the home
+  directory, bind paths...) is not copied. With sudo, the instances of the
+  user running sudo are looked up. Once an interactive session gives the
+  expected result, the def file can record the remaining steps to rebuild
+  the image reproducibly.
+
+  DEBOOTSTRAP OPTIONS:
+
+  'Bootstrap: debootstrap' installs the minbase variant unless the Variant
+  header selects another one. The Components header lists the archive
+  components to use (main only by default), Keyring is the absolute host
+  path of the keyring checking the Release file and Proxy an http(s) URL
+  of the APT proxy used while bootstrapping, it is not written in the
+  image.
+
+  YUM AND ZYPPER REPOSITORIES:
+
+  'Bootstrap: yum' and 'Bootstrap: zypper' install packages from the
+  MirrorURL repository and from the name=url repositories listed in the
+  Repos header, %{OSVERSION} is replaced by the OSVersion header in their
+  URLs. The GPGKey header lists https URLs or absolute host paths of GPG
+  keys imported in the rpm database of the image, they are the only keys
+  trusted by zypper when set. GPGCheck: yes or no enables or disables
+  package signature checks, which are enabled by default with zypper, and
+  with yum when GPG keys are given.
+
+  CONDA BOOTSTRAP:
+
+  'Bootstrap: conda' creates the conda environment described by the
+  environment file of the From header (relative to the current directory)
+  in /opt/conda, with micromamba 1.4 or later. The environment is installed
+  on top of the Base image (docker://debian:stable-slim by default), given
+  as library://, docker:// or oci:// URIs, a local image path or scratch.
+  Channels listed in the Channels header take precedence over the channels
+  of the environment file and are written to /opt/conda/.condarc.
+  micromamba is extracted from the release archive URL of the MirrorURL
+  header, or from the pinned 1.5.8 release of micro.mamba.pm, and copied to
+  /opt/conda/bin. The MicromambaSHA256 header is required and must hold the
+  sha256 checksum of that archive, builds fail on a mismatch. Downloaded
+  packages are kept in the cache to be reused by later builds, use
+  'singularity cache clean --type=conda' to remove them.
+
+  NIX AND GUIX BOOTSTRAPS:
+
+  'Bootstrap: nix' installs the packages of the flake reference of the From
+  header (.#name for a flake of the current directory) in a profile with the
+  nix command of the host, 'Bootstrap: guix' installs the packages of the
+  guix manifest file of the From header, at the revisions of the channels
+  file of the Channels header when set. The store closure of the profile is
+  copied in the image, the profile is linked at /nix/var/nix/profiles/default
+  or /var/guix/profiles/default and its bin directory at /bin, so it must
+  provide a shell for the container actions. The image holds only the
+  closure, it doesn't depend on the host distribution, and the profile store
+  path identifies the build cache entry. Use --reproducible to also fix the
+  times of the files created by the build.
+
+  PLATFORM:
+
+  --platform os/arch[/variant] selects the image bootstrapped from docker
+  and oci multi-platform images, the host platform is used by default. Build
+  scripts of an image for another architecture run under a qemu emulator
+  registered in binfmt_misc, --strict-platform refuses emulation and images
+  which don't match exactly the requested platform.
+
+  --arch <arch> is a shorthand for --platform linux/<arch>. When no emulator
+  is registered for <arch>, the qemu-<arch>-static emulator of the 'qemu
+  static path' directory set in singularity.conf is registered in
+  binfmt_misc with the fix binary flag, so it runs in the container without
+  being copied in it, until the build ends. debootstrap, docker, oci and
+  scratch bootstraps build images for the requested architecture, which is
+  recorded in the SIF header, other bootstrap agents fail.
+
+  BUILD ARGUMENTS:
+
+  A def file can hold {{ name }} placeholders in its header, and
+  {{ args.name }} placeholders anywhere, replaced before parsing by the
+  value given with --build-arg name=value, or read from the name=value
+  lines of the --build-arg-file file. Sections such as %post are left as
+  is except for {{ args.name }} placeholders. Default values are declared
+  as name=value lines of an %arguments section, placeholders without value
+  abort the build.
+
+  INCLUDES:
+
+  An unindented '%include <file>' line between sections is replaced by the
+  content of <file> before build arguments are applied, so sections shared by many def files such as
+  %environment, %labels or %post can be kept in a single fragment. Relative
+  paths are resolved from the directory of the including file, included
+  files may include other files but not themselves, and an %include line
+  must be followed by a section or the end of file.
+
+  SECRETS:
+
+  --secret id=<id>,src=<path> mounts the host file <path> read-only at
+  /run/secrets/<id> while the %post section runs, to give credentials to
+  package managers or git without storing them in the image. The id defaults
+  to the file name. Secrets are unmounted before %test and their mount
+  points are removed before the image is cached or assembled, but files
+  written by %post from their content are kept. Changing the content of a
+  secret doesn't invalidate the --cache-sections cache, use --disable-cache
+  to rerun %post.
+
+  SECCOMP PROFILE:
+
+  A seccomp profile copied at /.singularity.d/seccomp.json, with %files or
+  from a previous build, is stored in SIF images as a seccomp.json data object.
+  It's applied by default when the image runs, unless a profile is given with
+  --security seccomp:<profile>, --no-image-seccomp is set or the 'allow image
+  seccomp' directive of singularity.conf disables image profiles.
+
+  REPRODUCIBLE BUILDS:
+
+  --reproducible builds identical SIF images from the same def file and
+  sources. File times newer than SOURCE_DATE_EPOCH (0 when unset) are set
+  to it, as well as the build date label, the squashfs creation time and
+  the SIF times, owners are set to root and the SIF image ID is derived
+  from the image content. SOURCE_DATE_EPOCH is also set while the build
+  scripts run. The SHA256 digest of the image is printed at the end of the
+  build, --expect-digest sha256:<hex> makes the build fail if it differs,
+  the image is kept for inspection. Scripts downloading packages or writing
+  random data still produce different images.
+
+  TEST SECTION:
+
+  The %test section runs once %setup, %files and %post completed and their
+  result was cached. --test-timeout kills it after a duration, and
+  --test-retries runs it again up to N times when it fails or times out,
+  for flaky or hanging smoke tests. The TestTimeout and TestRetries headers
+  set them per stage, command line flags take precedence, and 'TestSkip:
+  yes' skips the section of a stage like --notest. With --keep-failed the
+  image is still assembled when %test fails, so hours of %post work are not
+  discarded, but the build exits with an error.
+
+  LINT:
+
+  'singularity build --lint <def file>' checks a definition file without
+  building it, '-' reads it from standard input. It reports unknown header
+  keywords and sections, invalid bootstrap agents and their missing
+  headers, %files sources which don't exist, '%files from' sources which
+  are neither a previous stage nor an image, and shell syntax errors of
+  scripts run by sh or bash, with their line number. It exits with an
+  error when problems are found.
+
+  FILES FROM STAGES AND IMAGES:
+
+  A '%files from <source>' section copies files from the root file system of
+  a previous stage named with the Stage header, or from an image given by
+  URI (library://, docker://, oci://...) or by the path of a local image,
+  fetched once per build. A single file can be given on the section line:
+
+      %files from docker://golang:1.21 /usr/local/go /opt/go
+
+      %files from builder
+          /src/hello /usr/local/bin/hello
+
+  OPTIMIZATION:
+
+  --optimize runs optimization passes on the root file system of the last
+  stage before the image is assembled, to reduce its size for diskless
+  nodes. It takes a comma separated list of profiles, passes and
+  compress=<gzip|lzo|lz4|xz|zstd>, the squashfs compression of SIF images.
+  The safe profile sets file times to SOURCE_DATE_EPOCH (0 when unset) and
+  replaces identical files by hard links, the small profile also removes
+  documentation except license files and non English translations, and
+  compresses with xz. Passes always run in the same order, passes added by
+  plugins run last. Use '--optimize help' to list profiles and passes.
+
+  --squashfs-block-size sets the block size of the squashfs file system of
+  SIF images, larger blocks compress better but slow down random reads.
+  --mksquashfs-procs and --mksquashfs-mem set the CPUs and the memory used
+  by mksquashfs to create it. They override the 'mksquashfs block size',
+  'mksquashfs procs' and 'mksquashfs mem' defaults of singularity.conf.
+
+  BUILD NETWORK:
+
+  By default %post and %test share the host network. --network none runs
+  them with a loopback interface only, other values are comma separated
+  CNI networks configured in the same way as the --network option of the
+  run command. --dns replaces the nameservers of the container
+  /etc/resolv.conf with a comma separated list of addresses, --resolv-conf
+  uses a host file instead. %setup runs on the host and isn't isolated.
+
+  BUILD WITHOUT ROOT:
+
+  Users without root privileges can build from a definition file as a fake
+  root user with --fakeroot. The ways to do so are probed in this order and
+  the first one available is used:
+
+      setuid      not used for builds, the setuid workflow would grant real
+                  root privileges to build scripts
+      userns      the build engine runs in an unprivileged user namespace
+                  where the user is mapped to root
+      fakechroot  %post and %test run with the fakeroot command in a
+                  fakechroot environment, both must be found in PATH
+      proot       %post and %test run by proot, found in PATH
+
+  The selected mode is reported along with why the previous ones were not
+  available, --proot selects proot directly. %setup and %pre run on the
+  host as the user. Only simple images can be built this way: files are
+  owned by the user in the image, ownership changes, setuid bits and
+  device files are not kept, privileged operations like mounts fail, and
+  the bootstrap agents which require root (debootstrap, yum, zypper...)
+  can't be used. Build scripts share the host network, and proot slows
+  them down. The limitations of the selected mode are reported when the
+  build starts.
+
+  BUILD HOOKS:
+
+  Administrators can set host scripts run before each build bootstraps and
+  after it created the image with the 'build pre hook' and 'build post
+  hook' directives of singularity.conf, to apply scanning, signing or
+  registration policies. Hooks receive the definition file and the image
+  paths as arguments, a failing pre hook aborts the build and a failing
+  post hook makes it fail. They also run for remote builds which download
+  the image, except --detached ones. Hooks are advisory: they run as the
+  user for 'singularity build' only, not for images converted by pull, run
+  or exec, and can't prevent users from creating images with other tools.
+
+  BUILD CACHE:
+
+  With --cache-sections, when the bootstrap source content can be
+  identified (docker, oci, library and local image files), the root file
+  system resulting from the %files and %post sections is cached. It is
+  reused by builds from the same source with identical header, %files
+  (including the copied files content), %post and app sections, so
+  changing only the %runscript, %environment, %labels, %help or %test
+  sections skips them. Stages with a %setup section are not cached, as
+  it can read any host file. A cached result which can't be restored is
+  ignored and the sections run. Use --disable-cache to ignore the cache,
+  and 'singularity cache clean --type=build' to remove it.
+
+  Converting a sandbox directory to SIF also caches its squashfs image.
+  When the same sandbox is converted again, top level directories whose
+  files kept the same size, mode, owner and modification time are reused
+  from the cached image, only the modified ones are compressed again and
+  appended. Directories modified between conversions are left out of the
+  next cached image, so repeatedly editing /opt of a multi-GB sandbox only
+  recompresses /opt. --reproducible builds always compress the whole
+  image.
+
+  REMOTE BUILD CONTEXT:
+
+  With --remote, the local %files sources, relative to the current
+  directory, are archived and uploaded with the definition to the Build
+  Service. Files and directories matching the patterns of a
+  .singularityignore file of the current directory are left out of
+  directories given as source, one pattern per line:
+
+      # build outputs
+      *.o
+      cache/
+      !keep.o
+
+  Patterns without slash match the file name, a trailing slash only matches
+  directories and '!' includes files excluded by previous patterns. The
+  build fails when the archived files exceed --context-limit (128MiB by
+  default).
+
+  The build ID of a remote build is printed when it's submitted. When the
+  connection to the Build Service is lost, the output is resumed where it
+  stopped after reconnecting, and the image is downloaded once the build
+  completes. If the build service can't be reached anymore, 'singularity
+  build --attach <build ID> <image path>' attaches to the build again and
+  downloads the image.`
 
 	BuildExample string = `
 
@@ -85,11 +401,27 @@ Enterprise Performance Computing (EPC)`
           MirrorURL: http://mirror.centos.org/centos-%{OSVERSION}/%{OSVERSION}/os/x86_64/
           Include: yum
 
+      YUM/RHEL from internal mirrors:
+          Bootstrap: yum
+          OSVersion: 8
+          MirrorURL: https://mirror.example.com/el%{OSVERSION}/baseos/
+          Repos: appstream=https://mirror.example.com/el%{OSVERSION}/appstream/, internal=https://repo.example.com/el%{OSVERSION}/
+          GPGKey: https://mirror.example.com/RPM-GPG-KEY-el8, /etc/pki/rpm-gpg/RPM-GPG-KEY-internal
+          GPGCheck: yes
+
       Debian/Ubuntu:
           Bootstrap: debootstrap
           OSVersion: trusty
           MirrorURL: http://us.archive.ubuntu.com/ubuntu/
 
+      Debian/Ubuntu from internal mirrors:
+          Bootstrap: debootstrap
+          OSVersion: jammy
+          MirrorURL: http://mirror.example.com/ubuntu/
+          Components: main, universe
+          Keyring: /usr/share/keyrings/ubuntu-archive-keyring.gpg
+          Proxy: http://proxy.example.com:3128
+
       Local Image:
           Bootstrap: localimage
           From: /home/dave/starter.img
@@ -97,6 +429,29 @@ Enterprise Performance Computing (EPC)`
       Scratch:
           Bootstrap: scratch # Populate the container with a minimal rootfs in %setup
 
+      Sandbox snapshot:
+          Bootstrap: sandbox
+          From: /tmp/dev-sandbox
+
+      Instance snapshot:
+          Bootstrap: instance
+          From: dev # started with 'singularity instance start --writable-tmpfs'
+
+      Conda:
+          Bootstrap: conda
+          From: environment.yml
+          Base: docker://debian:stable-slim
+          Channels: conda-forge, bioconda
+
+      Nix:
+          Bootstrap: nix
+          From: .#analysis # flake.nix and flake.lock in the current directory
+
+      Guix:
+          Bootstrap: guix
+          From: manifest.scm
+          Channels: channels.scm # pinned with 'guix describe -f channels'
+
   DEFFILE SECTIONS:
 
       %pre
@@ -110,7 +465,10 @@ Enterprise Performance Computing (EPC)`
 
       %post
           echo "This scriptlet section will be executed from within the container after"
-          echo "the bootstrap/base has been created and setup."
+          echo "the bootstrap/base has been created and setup. Scriptlets are run by"
+          echo "/bin/sh -ex, use '%post -i /usr/bin/python3' to select an interpreter"
+          echo "and its arguments. With '-i /bin/bash' the scriptlet is aborted on any"
+          echo "failing command, unset variable or pipe, and the failing line is reported."
 
       %test
           echo "Define any test commands that should be executed after container has been"
@@ -143,6 +501,12 @@ Enterprise Performance Computing (EPC)`
       %help
           This is a text file to be displayed with the run-help command.
 
+      %arguments
+          # default value of the {{ CUDA_VERSION }} placeholders
+          CUDA_VERSION=10.1
+
+      %include common/site.def
+
   COMMANDS:
 
       Build a sif file from a Singularity recipe file:
@@ -154,7 +518,95 @@ Enterprise Performance Computing (EPC)`
       Build a base sandbox from DockerHub, make changes to it, then build sif
           $ singularity build --sandbox /tmp/debian docker://debian:latest
           $ singularity exec --writable /tmp/debian apt-get install python
-          $ singularity build /tmp/debian2.sif /tmp/debian`
+          $ singularity build /tmp/debian2.sif /tmp/debian
+
+      Build a sif file from a recipe file and its context read from stdin:
+          $ tar -cz Singularity files/ | singularity build /tmp/debian3.sif -
+
+      Attach to a remote build after losing the connection:
+          $ singularity build --attach 5d3b1a6e8f1c2a0001a2b3c4 /tmp/app.sif
+
+      Build an aarch64 sif file on an x86_64 host:
+          $ sudo singularity build --arch arm64 /tmp/debian-arm64.sif debian.def
+
+      Build a sif file from a Dockerfile:
+          $ singularity build --build-arg VERSION=1.2 /tmp/app.sif ./Dockerfile
+
+      Build a sif file from a recipe file with {{ CUDA_VERSION }} placeholders:
+          $ singularity build --build-arg CUDA_VERSION=9.2 /tmp/cuda.sif cuda.def
+
+      Check a recipe file for errors before a long build:
+          $ singularity build --lint app.def
+
+      Build a sif file with pip credentials read in %post from /run/secrets/pip.conf:
+          $ singularity build --secret id=pip.conf,src=$HOME/.config/pip/pip.conf /tmp/app.sif app.def
+
+      Build a sif file without network access in %post and %test:
+          $ sudo singularity build --network none /tmp/app.sif app.def
+
+      Build a sif file from a docker base image without root privileges:
+          $ singularity build --fakeroot /tmp/app.sif app.def
+
+      Build a sif file with the nameservers of a corporate network:
+          $ sudo singularity build --dns 10.0.0.53,10.0.1.53 /tmp/app.sif app.def
+
+      Build a small sif file for diskless nodes, compressed with zstd:
+          $ singularity build --optimize small,compress=zstd /tmp/app.sif app.def
+
+      Build a sif file with 1M squashfs blocks on a 128 core build node:
+          $ sudo singularity build --squashfs-block-size 1M --mksquashfs-procs 128 --mksquashfs-mem 16G /tmp/app.sif app.def
+
+      Build an OCI archive and push an OCI image to a registry:
+          $ singularity build oci-archive:/tmp/app.tar app.def
+          $ singularity build --docker-login docker://registry.example.com/app:1.0 app.def`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// def
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	DefUse   string = `def [def options...]`
+	DefShort string = `Manage definition files`
+	DefLong  string = `
+  Convert definition files between the classic format and JSON, and print
+  the JSON schema of definitions, so builds can be generated by programs.`
+	DefExample string = `
+  All group commands have their own help output:
+
+  $ singularity help def convert
+  $ singularity def schema --help`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// def convert
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	DefConvertUse   string = `convert [convert options...] <input> [output]`
+	DefConvertShort string = `Convert a definition file to JSON or JSON to a definition file`
+	DefConvertLong  string = `
+  The 'def convert' command converts a classic definition file to JSON, or
+  JSON to a classic definition file when the input is a JSON object or
+  array. '-' reads the input from standard input, the result is written to
+  standard output unless an output file is given.
+
+  A definition with a single stage is converted to a JSON object, a multi
+  stage definition to an array of objects, one per stage. {{ name }}
+  header placeholders and {{ args.name }} placeholders are replaced by the values of --build-arg and
+  --build-arg-file, or by their default from the %arguments section.
+  Definition files written from JSON have their header keywords, labels
+  and app sections sorted, so the same JSON always gives the same file.
+  'singularity build --json' builds from JSON directly.`
+	DefConvertExample string = `
+  $ singularity def convert app.def app.json
+  $ singularity def convert --build-arg VERSION=1.2 app.def
+  $ generate-build | singularity def convert - app.def`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// def schema
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	DefSchemaUse   string = `schema`
+	DefSchemaShort string = `Print the JSON schema of definitions`
+	DefSchemaLong  string = `
+  The 'def schema' command prints the JSON schema, draft-07, of the
+  definitions produced by 'def convert' and accepted by 'build --json'.`
+	DefSchemaExample string = `
+  $ singularity def schema > definition.schema.json`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Cache
@@ -182,6 +634,8 @@ Enterprise Performance Computing (EPC)`
 
   $ singularity help cache clean --name cache_name.sif
   $ singularity help cache clean --type=library,oci
+  $ singularity cache clean --type=build
+  $ singularity cache clean --type=conda
   $ singularity cache clean --help`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -198,6 +652,96 @@ Enterprise Performance Computing (EPC)`
   $ singularity help cache list --type=library,oci
   $ singularity cache list --help`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Pool
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	PoolUse   string = `pool`
+	PoolShort string = `Manage a deduplicated SIF image storage pool`
+	PoolLong  string = `
+  Store SIF images in a local pool where identical partitions shared by
+  several images are stored only once. Images are split into their data
+  objects which are kept in a content addressed directory, an index records
+  how to reassemble each image byte for byte. On filesystems supporting
+  reflinks (XFS, Btrfs), imports and exports share data extents instead of
+  copying them.
+
+  The pool is stored in the singularity local state directory unless
+  '--pool-dir' or SINGULARITY_POOL_DIR is set.`
+	PoolExample string = `
+  All group commands have their own help output:
+
+  $ singularity pool
+  $ singularity pool --help`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Pool import
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	PoolImportUse   string = `import [import options...] <image path>`
+	PoolImportShort string = `Import a SIF image into the storage pool`
+	PoolImportLong  string = `
+  Import a SIF image into the storage pool, only partitions not already
+  present in the pool consume additional space. The image is stored under
+  its file name unless '--name' is specified.`
+	PoolImportExample string = `
+  $ singularity pool import /tmp/debian.sif
+  $ singularity pool import --name debian-10 /tmp/debian.sif`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Pool export
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	PoolExportUse   string = `export <image name> <image path>`
+	PoolExportShort string = `Export an image from the storage pool`
+	PoolExportLong  string = `
+  Reassemble an image stored in the storage pool at the given path, the
+  exported image is identical to the imported one.`
+	PoolExportExample string = `
+  $ singularity pool export debian.sif /tmp/debian.sif`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// SIF
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	SifUse   string = `sif`
+	SifShort string = `Manage SIF images`
+	SifLong  string = `
+  Operations working on SIF image files.`
+	SifExample string = `
+  All group commands have their own help output:
+
+  $ singularity sif
+  $ singularity sif --help`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// SIF clone
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	SifCloneUse   string = `clone [clone options...] <source image> <destination image>`
+	SifCloneShort string = `Duplicate a SIF image`
+	SifCloneLong  string = `
+  Duplicate a SIF image. On filesystems supporting reflinks (XFS, Btrfs) the
+  copy shares data with the source image until one of them is modified,
+  making the duplication of large images nearly instantaneous. On other
+  filesystems the data is copied by the kernel.`
+	SifCloneExample string = `
+  $ singularity sif clone /tmp/debian.sif /tmp/debian-copy.sif`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// SIF verify-integrity
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	SifVerifyIntegrityUse   string = `verify-integrity [verify-integrity options...] <image path>`
+	SifVerifyIntegrityShort string = `Check the integrity of a SIF image`
+	SifVerifyIntegrityLong  string = `
+  Check the integrity of a SIF image: consistency of the global header with
+  the descriptor table, placement of data objects, data objects hashes
+  recorded in signature blocks and health of squashfs and ext3 partition
+  filesystems (when unsquashfs and e2fsck are installed). Signers are not
+  verified, use the verify command for that.
+
+  With --repair, metadata damages left by an interrupted write, like stale
+  global header counters or unreferenced data at the end of the image, are
+  repaired. Images with other problems are left untouched.`
+	SifVerifyIntegrityExample string = `
+  $ singularity sif verify-integrity /tmp/debian.sif
+  $ singularity sif verify-integrity --repair /tmp/debian.sif`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -307,6 +851,24 @@ Enterprise Performance Computing (EPC)`
 	KeyPushExample string = `
   $ singularity key push 8883491F4268F173C6E5DC49EDECE4F3F38D871E`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// key sync
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeySyncUse   string = `sync [sync options...]`
+	KeySyncShort string = `Synchronize public keys with a key server and a shared keyring`
+	KeySyncLong  string = `
+  The 'key sync' command synchronizes public keys between the local keyring,
+  the key server and optionally a shared keyring file (--file) so a group can
+  maintain the same set of trusted keys across machines. Keys missing from one
+  of them are added to it, key servers are only queried for keys found in the
+  local or shared keyring.
+
+  When a key ID identifies keys with different fingerprints, the key is
+  reported as a conflict and isn't synchronized.`
+	KeySyncExample string = `
+  $ singularity key sync
+  $ singularity key sync --file /project/shared/pgp-public --dry-run`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key remove
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -411,6 +973,137 @@ Enterprise Performance Computing (EPC)`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// exec
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	containment string = `
+
+  CONTAINMENT:
+
+  By default the host environment, home directory, current directory,
+  /tmp, /var/tmp, /dev and the bind paths of singularity.conf are shared
+  with the container. Each can be isolated on its own:
+
+      --no-host-env      start from a clean environment (same as --cleanenv)
+      --no-home          don't mount the home directory
+      --private-tmp      use empty /tmp and /var/tmp, from --workdir if set
+      --private-devs     use a minimal /dev
+      --no-init-net      use a network namespace with only a loopback
+                         interface
+      --pid, --ipc       use new PID and IPC namespaces
+
+  --contain is --private-tmp --private-devs with an empty home directory
+  and without the current directory and singularity.conf bind paths,
+  --containall adds --pid --ipc --no-host-env to it. --dry-run reports the
+  resulting sharing in io.sylabs.singularity.containment.* annotations.
+
+  --home-mode selects what is mounted on the home directory: 'host' binds
+  the host home (default), 'tmpfs' an empty tmpfs owned by the user,
+  'skel' a tmpfs populated from /etc/skel of the image, and 'image' keeps
+  the home directory of the image. tmpfs and skel take a size limit, as
+  in --home-mode skel:512m, their content is lost when the container
+  exits, so every run starts from the same home directory.
+
+  The user and its groups are added to /etc/passwd and /etc/group of the
+  container as resolved by the host name services with getent, so users
+  and groups only known by sssd or LDAP are found. --add-passwd-entry adds
+  other users, given by name, uid or as a complete passwd line. Container
+  entries with the same name or id as an added entry are replaced.
+
+  --krb5 provides the Kerberos credential cache of KRB5CCNAME and the host
+  krb5.conf, so GSSAPI authenticated tools like ssh, kinit or NFS clients
+  work in the container. File and directory caches are bound at
+  /.singularity.d/krb5cc, KCM and keyring caches are copied there by the
+  'krb5 ccache helper' set in singularity.conf to a file removed when the
+  container exits, or used through the host KCM socket and kernel keyring
+  when no helper is set.
+
+  Graphical applications reach the desktop session with --xdg-runtime-dir,
+  which binds the user runtime directory (XDG_RUNTIME_DIR, holding the
+  Wayland, PulseAudio and systemd user sockets), and --dbus, which binds
+  the session D-Bus socket. Both are bound at their host location, only
+  for their owner, and can be disabled in singularity.conf.
+
+  --gui runs graphical applications in one flag: the X11 display socket
+  and X authority file, or the Wayland display socket, are bound into the
+  container with DISPLAY, XAUTHORITY, WAYLAND_DISPLAY and XDG_RUNTIME_DIR
+  set accordingly, and the /dev/dri rendering devices are added when /dev
+  isn't bound from the host. Displays forwarded by ssh -X work as long as
+  the container shares the host network namespace.
+
+  --alsa provides the /dev/snd sound devices, --video the /dev/video* and
+  /dev/media* capture devices, and --pulse binds the PulseAudio server
+  socket and cookie with PULSE_SERVER and PULSE_COOKIE set. Devices are
+  only added when /dev isn't bound from the host and, as on the host,
+  access is granted by membership of their group (usually audio or video).`
+
+	memorySettings string = `
+
+  MEMORY SETTINGS:
+
+  --thp and --mempolicy set the transparent hugepage mode and the NUMA
+  memory policy of the container process tree, without privileges, when
+  an application requires settings different from the host defaults:
+
+      --thp never              no transparent hugepages
+      --thp madvise            hugepages only for regions advised with
+                               madvise(MADV_HUGEPAGE), requires Linux 6.18
+      --mempolicy local        allocate on the node of the running CPU
+      --mempolicy bind:0-1     only allocate on nodes 0 and 1
+      --mempolicy interleave:0,2
+                               interleave allocations over nodes 0 and 2
+      --mempolicy preferred:1  allocate on node 1 first
+
+  Both settings are inherited by all the processes of the container,
+  including those started with exec instance://.`
+
+	observe string = `
+
+  OBSERVE:
+
+  --observe prints a summary of the system calls, opened files and network
+  connections of the container processes when the container exits, the
+  most used entries of each table are listed. --observe-file writes the
+  complete report to a file in JSON format instead. Activity is recorded
+  by eBPF programs attached to kernel tracepoints from the start of the
+  container process, it requires root privileges or setuid mode and must be
+  enabled by the administrator with 'allow observe = yes' in singularity.conf.`
+
+	composition string = `
+
+  IMAGE COMPOSITION:
+
+  --compose stacks read-only SIF or squashfs images, separated by colons, on
+  top of the container image with overlayfs, so a common base image can be
+  extended with small add-on images instead of being rebuilt. Images listed
+  later take precedence, --overlay images are stacked on top of them. With
+  --verbose, files provided by more than one image are listed.
+  Composition requires overlay support in setuid mode and is not available
+  with --writable.`
+
+	jobTemplates string = `
+
+  JOB TEMPLATES:
+
+  With --job-templates, bind paths and SINGULARITYENV_ values can refer to
+  the job of the Slurm, PBS, LSF or SGE scheduler running singularity with
+  {{.Name}} templates:
+
+      {{.Scheduler}}      slurm, pbs, lsf or sge, empty outside of a job
+      {{.JobID}}          job identifier
+      {{.ArrayTaskID}}    index of the task in a job array
+      {{.JobName}}        job name
+      {{.NodeName}}       node running the job, the host name by default
+      {{.TmpDir}}         job temporary directory, TMPDIR or /tmp by default
+      {{.NumTasks}}       number of tasks of the job
+      {{.Rank}}           rank of the task within the job
+
+  $VAR and ${VAR} references of bind paths are also replaced by the host
+  environment variables, so quoted binds like '$SLURM_TMPDIR:/scratch' work
+  from profiles and SINGULARITY_BIND, undefined variables are errors. Without
+  --job-templates, bind paths and values are used as is. Within a job, the
+  same variables are set in the container environment as
+  SINGULARITY_SCHEDULER, SINGULARITY_JOB_ID, SINGULARITY_JOB_ARRAY_TASK_ID,
+  SINGULARITY_JOB_NAME, SINGULARITY_JOB_NODE_NAME, SINGULARITY_JOB_TMPDIR,
+  SINGULARITY_JOB_NUM_TASKS and SINGULARITY_JOB_RANK, for def file scripts
+  written independently of the scheduler.`
 	formats string = `
 
   *.sif               Singularity Image Format (SIF). Native to Singularity 3.0+
@@ -434,14 +1127,28 @@ Enterprise Performance Computing (EPC)`
 	ExecUse   string = `exec [exec options...] <container> <command>`
 	ExecShort string = `Run a command within a container`
 	ExecLong  string = `
-  singularity exec supports the following formats:` + formats
+  singularity exec supports the following formats:` + formats + jobTemplates + containment + composition + memorySettings + observe
 	ExecExamples string = `
   $ singularity exec /tmp/debian.sif cat /etc/debian_version
   $ singularity exec /tmp/debian.sif python ./hello_world.py
   $ cat hello_world.py | singularity exec /tmp/debian.sif python
   $ sudo singularity exec --writable /tmp/debian.sif apt-get update
   $ singularity exec instance://my_instance ps -ef
-  $ singularity exec library://centos cat /etc/os-release`
+  $ singularity exec library://centos cat /etc/os-release
+  $ singularity exec --platform linux/arm64 docker://alpine uname -m
+  $ singularity exec --compose tools.sif:data.sif base.sif ./analysis.sh
+  $ singularity exec --job-templates --bind '{{.TmpDir}}:/scratch' image.sif ./job.sh
+  $ SINGULARITYENV_OUTPUT='/results/{{.JobID}}-{{.ArrayTaskID}}' singularity exec --job-templates image.sif ./job.sh
+  $ singularity exec --timeout 2h --stop-signal SIGINT --usage-file usage.json image.sif ./job.sh
+  $ singularity exec --private-tmp --no-host-env --dry-run image.sif true
+  $ singularity exec --home-mode skel:512m image.sif ./train.sh
+  $ singularity exec --add-passwd-entry slurm image.sif squeue
+  $ singularity exec --krb5 image.sif klist
+  $ singularity exec --xdg-runtime-dir --dbus gimp.sif gimp
+  $ singularity exec --gui --contain paraview.sif paraview
+  $ singularity exec --gui --pulse --video --contain zoom.sif zoom
+  $ singularity exec --thp never --mempolicy interleave:0-3 image.sif ./solver
+  $ singularity exec --observe-file activity.json image.sif ./job.sh`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance
@@ -473,7 +1180,30 @@ Enterprise Performance Computing (EPC)`
   $ sudo singularity instance list -u mibauer
   DAEMON NAME      PID      CONTAINER IMAGE
   test            11963     /home/mibauer/singularity/sinstance/test.sif
-  test2           16219     /home/mibauer/singularity/sinstance/test.sif`
+  test2           16219     /home/mibauer/singularity/sinstance/test.sif
+
+  Print instance name and annotations using a Go template:
+  $ singularity instance list --format '{{.Name}} {{index .Annotations "jobid"}}'
+  test 4242`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance annotate
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceAnnotateUse   string = `annotate [annotate options...] <instance name> <key=value> [key=value...]`
+	InstanceAnnotateShort string = `Attach key/value annotations to a running instance`
+	InstanceAnnotateLong  string = `
+  The instance annotate command stores key/value pairs into the instance file,
+  they are reported by instance list with --json or --format. This allows
+  external tools like job schedulers to keep track of the instances they
+  launch. An annotation with an empty value (key=) is removed.`
+	InstanceAnnotateExample string = `
+  $ singularity instance start my-sql.sif mysql
+  $ singularity instance annotate mysql jobid=4242 owner=scheduler
+  $ singularity instance list --format '{{.Name}} {{index .Annotations "jobid"}}'
+  mysql 4242
+
+  Remove the owner annotation
+  $ singularity instance annotate mysql owner=`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance start
@@ -487,6 +1217,31 @@ Enterprise Performance Computing (EPC)`
   will be executed with the instance start command as well. You can optionally
   pass arguments to startscript
 
+  When started from a systemd unit with Type=notify, the NOTIFY_SOCKET is
+  proxied into the instance and READY/WATCHDOG messages sent by the contained
+  process are relayed to systemd along with the instance process PID, the unit
+  must set NotifyAccess=all.
+
+  The start, oom and stop events of the instance, as recorded by 'singularity
+  events', are posted in JSON format to the --notify-url URLs and given on
+  the standard input of the --notify-exec shell commands, which also find the
+  event type and instance name in the SINGULARITY_EVENT and
+  SINGULARITY_EVENT_ID environment variables. Both options can be repeated,
+  and failures are only reported in the instance log.
+
+  --sshd runs the OpenSSH server of the container, /usr/sbin/sshd, as the
+  instance process instead of the startscript, as the user, for remote IDEs
+  like VS Code. It listens on 127.0.0.1 and a free
+  port, or on the [[address]:]port given as --sshd=value, and only accepts
+  the keys of ~/.ssh/authorized_keys. Its host key is generated on first
+  use and kept in ~/.singularity/sshd/<instance> so it doesn't change
+  between restarts. The ssh command and ~/.ssh/config entry to connect are
+  printed once the instance is started.
+
+  --stop-signal and --stop-timeout are recorded in the instance file and
+  used by 'singularity instance stop' as the signal stopping the instance and
+  the grace period before it's killed with SIGKILL.
+
   singularity instance start accepts the following container formats` + formats
 	InstanceStartExample string = `
   $ singularity instance start /tmp/my-sql.sif mysql
@@ -502,7 +1257,15 @@ Enterprise Performance Computing (EPC)`
   Singularity my-sql.sif>
 
   $ singularity instance stop /tmp/my-sql.sif mysql
-  Stopping /tmp/my-sql.sif mysql`
+  Stopping /tmp/my-sql.sif mysql
+
+  $ singularity instance start --notify-url https://chat.example.com/hooks/ops \
+      --notify-exec 'logger -t singularity "$SINGULARITY_EVENT_ID $SINGULARITY_EVENT"' \
+      /tmp/my-sql.sif mysql
+
+  $ singularity instance start --sshd=2222 dev.sif dev
+
+  $ singularity instance start --stop-signal SIGTERM --stop-timeout 30 /tmp/my-sql.sif mysql`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance stop
@@ -511,7 +1274,13 @@ Enterprise Performance Computing (EPC)`
 	InstanceStopShort string = `Stop a named instance of a given container image`
 	InstanceStopLong  string = `
   The command singularity instance stop allows you to stop and clean up a named,
-  running instance of a given container image.`
+  running instance of a given container image.
+
+  The instance receives the signal given with --stop-signal, and is killed
+  with SIGKILL if it's still running after the --stop-timeout grace period.
+  Without those options, the signal and grace period recorded by 'instance
+  start --stop-signal --stop-timeout' are used, SIGINT and 10 seconds if none
+  were given.`
 	InstanceStopExample string = `
   $ singularity instance start my-sql.sif mysql1
   $ singularity instance start my-sql.sif mysql2
@@ -529,6 +1298,27 @@ Enterprise Performance Computing (EPC)`
   $ singularity instance stop -s TERM mysql1
   $ singularity instance stop -s 15 mysql1`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance top
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceTopUse   string = `top [top options...] <instance name>`
+	InstanceTopShort string = `Display the processes running inside an instance`
+	InstanceTopLong  string = `
+  The instance top command lists the processes running inside an instance.
+  When cgroups were applied to the instance the processes are those of the
+  instance cgroup, otherwise the instance process and all its descendants are
+  listed. The PID column reports the host process ID and the NSPID column the
+  process ID as seen inside the instance PID namespace.`
+	InstanceTopExample string = `
+  $ singularity instance start my-sql.sif mysql
+  $ singularity instance top mysql
+  PID    NSPID  PPID   USER   STAT  RSS     TIME      COMMAND
+  23845  23845  23844  mysql  S     1284    00:00:00  sinit
+  23861  23861  23845  mysql  S     182340  00:00:03  /usr/sbin/mysqld
+
+  As root, list processes of an instance started by another user in JSON:
+  $ sudo singularity instance top -u mysql --json mysql`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// pull
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -545,7 +1335,32 @@ Enterprise Performance Computing (EPC)`
       docker://user/image:tag
     
   shub: Pull an image from Singularity Hub to CWD
-      shub://user/image:tag`
+      shub://user/image:tag
+
+  Docker registry requests which are rate limited (HTTP 429) or fail with
+  server errors (HTTP 5xx) are retried, honoring the Retry-After delay of the
+  registry, and Docker Hub images are pulled from the mirrors configured with
+  'docker mirror' in singularity.conf when Docker Hub fails.
+
+  The image matching the host platform is selected from multi-platform
+  images, --platform os/arch[/variant] selects another one. A compatible
+  platform (linux/386 on a linux/amd64 host, an older ARM variant) is used
+  when the requested one isn't available, unless --strict-platform is set.
+  The architecture is recorded in the SIF image, images built for another
+  architecture run only under a qemu emulator registered in binfmt_misc.
+
+  With --detach the pull is queued for a per-user daemon, started on demand,
+  which runs queued pulls one at a time in the background and exits once the
+  queue is empty. Completion is notified on the desktop when notify-send is
+  available, and to the --notify-url webhook. Detached pulls can't prompt,
+  unsigned library images require --allow-unauthenticated. Docker
+  credentials aren't stored in the queue, pulls using them are run right
+  away by a daemon started for them which holds them in its environment.
+
+  --optimize runs the optimization passes described in 'singularity help
+  build' on docker and oci images before they are converted to SIF, with
+  the squashfs block size and mksquashfs resources set by
+  --squashfs-block-size, --mksquashfs-procs and --mksquashfs-mem.`
 	PullExample string = `
   From Sylabs cloud library
   $ singularity pull alpine.sif library://alpine:latest
@@ -553,8 +1368,18 @@ Enterprise Performance Computing (EPC)`
   From Docker
   $ singularity pull tensorflow.sif docker://tensorflow/tensorflow:latest
 
+  From Docker, without documentation and compressed with xz
+  $ singularity pull --optimize small ubuntu.sif docker://ubuntu:18.04
+
+  From Docker, for a Raspberry Pi
+  $ singularity pull --platform linux/arm/v7 alpine.sif docker://alpine:latest
+
   From Shub
-  $ singularity pull singularity-images.sif shub://vsoch/singularity-images`
+  $ singularity pull singularity-images.sif shub://vsoch/singularity-images
+
+  In the background, with a webhook notification
+  $ singularity pull --detach --notify-url https://hooks.example.com/pulls cuda.sif docker://nvidia/cuda:10.1-devel
+  $ singularity transfers list`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// push
@@ -594,7 +1419,7 @@ Enterprise Performance Computing (EPC)`
   automatically. All arguments following the container name will be passed
   directly to the runscript.
 
-  singularity run accepts the following container formats:` + formats
+  singularity run accepts the following container formats:` + formats + jobTemplates + containment + composition + memorySettings + observe
 	RunExamples string = `
   # Here we see that the runscript prints "Hello world: "
   $ singularity exec /tmp/debian.sif cat /singularity
@@ -606,7 +1431,11 @@ Enterprise Performance Computing (EPC)`
   Hello world: one two three
 
   # Note that this does the same thing
-  $ ./tmp/debian.sif one two three`
+  $ ./tmp/debian.sif one two three
+
+  # Print the resource usage of all container processes on exit, processes
+  # orphaned outside a PID namespace are only accounted by cgroup counters
+  $ singularity run --pid --usage /tmp/debian.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// shell
@@ -614,7 +1443,7 @@ Enterprise Performance Computing (EPC)`
 	ShellUse   string = `shell [shell options...] <container>`
 	ShellShort string = `Run a shell within a container`
 	ShellLong  string = `
-  singularity shell supports the following formats:` + formats
+  singularity shell supports the following formats:` + formats + jobTemplates + containment + composition + memorySettings + observe
 	ShellExamples string = `
   $ singularity shell /tmp/Debian.sif
   Singularity/Debian.sif> pwd
@@ -709,9 +1538,16 @@ Enterprise Performance Computing (EPC)`
 	InspectShort string = `Show metadata for an image`
 	InspectLong  string = `
   Inspect will show you labels, environment variables, and scripts associated 
-  with the image determined by the flags you pass.`
+  with the image determined by the flags you pass.
+
+  Metadata are extracted by a restricted process running in the image
+  without network access, privileges or host directories, and with a
+  seccomp filter denying system calls not required to read files, so
+  images fetched from a remote source (library://, docker://, shub://,
+  http://, https://) can be inspected safely.`
 	InspectExample string = `
-  $ singularity inspect ubuntu.sif`
+  $ singularity inspect ubuntu.sif
+  $ singularity inspect docker://alpine`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Apps
@@ -783,6 +1619,150 @@ found at:
 
       https://www.sylabs.io/docs/`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// rerun
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	RerunUse   string = `rerun [rerun options...] <instance|record.json>`
+	RerunShort string = `Reproduce a recorded container execution`
+	RerunLong  string = `
+  The rerun command executes singularity again with the command line
+  arguments, SINGULARITY_ and SINGULARITYENV_ environment variables and from
+  the working directory recorded in an invocation record. The record also
+  stores the bind paths, and the image sha256 digest for records written
+  with --record, the re-executed command fails if the image doesn't match
+  the recorded digest. The --docker-password value and environment
+  variables named like credentials (PASSWORD, PASSPHRASE, TOKEN, SECRET,
+  CREDENTIAL) are not recorded, they must be set again for rerun.
+
+  Invocation records are written with the --record option of the action
+  commands, readable by the user only, and are stored in the instance
+  metadata by instance start. As an instance name can't be used twice, save
+  the record of a running instance with --show to rerun it once the
+  instance stopped.`
+	RerunExample string = `
+  $ singularity exec --record record.json --bind /data image.sif ./analysis
+  $ singularity rerun record.json
+
+  $ singularity rerun --show myinstance > record.json
+  $ singularity instance stop myinstance
+  $ singularity rerun record.json`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// events
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	EventsUse   string = `events [events options...]`
+	EventsShort string = `Display runtime events of instances and OCI containers`
+	EventsLong  string = `
+  The events command displays the events recorded in the user events journal
+  on this host: creation, start and stop of instances and OCI containers, out
+  of memory kills and signals sent with instance stop or oci kill. The journal
+  is stored in $HOME/.singularity/events and suffixed with the hostname.
+
+  The --since option accepts a duration relative to now or an RFC 3339
+  timestamp, with --follow the command keeps waiting for new events.`
+	EventsExample string = `
+  $ singularity events --since 1h
+  2019-05-14T10:02:11+02:00 instance mysql            start  pid=23845 image=/tmp/my-sql.sif
+  2019-05-14T10:32:40+02:00 instance mysql            kill   pid=23845 image=/tmp/my-sql.sif SIGINT
+  2019-05-14T10:32:41+02:00 instance mysql            stop   pid=23845 image=/tmp/my-sql.sif exit code 0
+
+  Follow events in JSON format
+  $ singularity events --follow --json
+
+  As root, display events of another user since a given time
+  $ sudo singularity events -u mysql --since 2019-05-14T10:00:00+02:00`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// transfers
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	TransfersUse   string = `transfers`
+	TransfersShort string = `Manage pulls running in the background`
+	TransfersLong  string = `
+  Pulls started with 'singularity pull --detach' are queued for a per-user
+  daemon running them one at a time in the background. The queue is stored in
+  $HOME/.singularity/transfers, in a directory named after the hostname.`
+	TransfersExample string = `
+  All group commands have their own help output:
+
+  $ singularity help transfers list
+  $ singularity transfers list --help`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// transfers list
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	TransfersListUse   string = `list [list options...]`
+	TransfersListShort string = `List queued, running and completed background pulls`
+	TransfersListLong  string = `
+  The transfers list command displays the background pulls of the user on
+  this host, the last output line of running pulls and the error of failed
+  ones.`
+	TransfersListExample string = `
+  $ singularity transfers list
+  ID        STATE    ELAPSED  SOURCE                           DESTINATION       DETAILS
+  3f2a9c1e  done     4m12s    docker://tensorflow/tensorflow   /data/tf.sif
+  8b01d7aa  running  21m5s    docker://nvidia/cuda:10.1-devel  /data/cuda.sif    Copying blob sha256:5b7339215d1d
+  c44e0b19  queued   -        library://alpine                 /data/alpine.sif`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// transfers clean
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	TransfersCleanUse   string = `clean`
+	TransfersCleanShort string = `Remove completed background pulls from the list`
+	TransfersCleanLong  string = `
+  The transfers clean command removes the completed and failed background
+  pulls, and their output, from the transfer list.`
+	TransfersCleanExample string = `
+  $ singularity transfers clean`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// registry
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	RegistryUse   string = `registry`
+	RegistryShort string = `Run a local OCI image registry`
+	RegistryLong  string = `
+  Serve OCI images from a directory with the registry API used by docker://
+  URIs, without a container daemon, for air-gapped clusters and local
+  testing.`
+	RegistryExample string = `
+  All group commands have their own help output:
+
+  $ singularity help registry serve
+  $ singularity registry serve --help`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// registry serve
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	RegistryServeUse   string = `serve [serve options...] <directory>`
+	RegistryServeShort string = `Serve the images of a directory with the OCI distribution API`
+	RegistryServeLong  string = `
+  The registry serve command runs a registry until it's interrupted, images
+  are pushed and pulled with docker:// URIs pointing to its address. Each
+  repository is stored as an OCI image layout in a sub directory of the
+  given directory named after the repository, tags are the image reference
+  names of the layout index. Repositories can be copied from or to other
+  hosts as plain directories and used directly with oci: URIs.
+
+  The registry listens on 127.0.0.1:5000 by default, other addresses than
+  loopback ones require --htpasswd. It serves HTTP unless --tls-cert and
+  --tls-key are set, use --nohttps with build and pull to reach an HTTP
+  registry. With --htpasswd every request requires basic authentication
+  with a user of the file, passwords must be created with 'htpasswd -B',
+  'htpasswd -s' or 'htpasswd -p'. Cross repository blob mounts and
+  deletions aren't supported.`
+	RegistryServeExample string = `
+  Serve the images of /srv/registry on localhost port 5000:
+  $ singularity registry serve /srv/registry
+
+  Push an image built from a definition file and run it:
+  $ singularity build --nohttps docker://localhost:5000/tools/app:1.0 app.def
+  $ singularity run --nohttps docker://localhost:5000/tools/app:1.0
+
+  Serve HTTPS to other nodes and require authentication:
+  $ htpasswd -c -B /etc/registry.htpasswd alice
+  $ singularity registry serve --address :5000 --tls-cert cert.pem \
+      --tls-key key.pem --htpasswd /etc/registry.htpasswd /srv/registry
+  $ singularity pull --docker-login docker://registry-host:5000/tools/app:1.0`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// OCI
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -791,19 +1771,63 @@ found at:
 	OciLong  string = `
   Allow you to manage containers from OCI bundle directories.
 
+  With --runtime, or the oci runtime directive of singularity.conf, the
+  container lifecycle is delegated to an external OCI runtime like runc or
+  crun while image bundles are still created by Singularity. Options only
+  handled by the built-in engine (log, exit, socket and tmp options, OCI
+  patches, hooks directories, --empty-process and --dry-run) are refused.
+  Attach requires the container process to have a terminal, it's held for
+  the runtime from oci create to oci delete.
+
   NOTE: all oci commands requires to run as root`
 	OciExample string = `
   All group commands have their own help output:
 
   $ singularity oci create -b ~/bundle mycontainer
-  $ singularity oci start mycontainer`
+  $ singularity oci start mycontainer
+
+  Run a container from a SIF image with crun:
+
+  $ singularity oci --runtime crun run mycontainer image.sif`
 
 	OciCreateUse   string = `create -b <bundle_path> [create options...] <container_ID>`
 	OciCreateShort string = `Create a container from a bundle directory (root user only)`
 	OciCreateLong  string = `
-  Create invoke create operation to create a container instance from an OCI bundle directory`
+  Create invoke create operation to create a container instance from an OCI bundle directory
+
+  Environment variables set with --env-file take precedence over those set
+  by --oci-patch, which take precedence over those from config.json. When
+  multiple environment files define the same variable, the last one wins.
+
+  Hook definition files (*.json) found in --hooks-dir directories (default
+  to /usr/share/containers/oci/hooks.d and /etc/containers/oci/hooks.d) are
+  evaluated against the final specification and matching hooks are added to
+  their stages after the hooks defined in config.json.
+
+  The attach and control sockets are only accessible by their owner, use
+  --socket-group and --socket-mode to let monitoring agents connect to them.
+  With --socket-secret-file, clients must send the secret stored in this file
+  before using the sockets, singularity oci commands read it from the same
+  file.
+
+  --tmp-policy replaces the mounts of /tmp, /var/tmp or /dev/shm defined in
+  config.json: tmpfs[:<size>] mounts a private tmpfs optionally limited in
+  size, host binds the host directory and scratch:<path> binds a directory
+  created under <path>. The applied policies are recorded with the
+  container state.
+
+  A "time" entry in linux.namespaces creates a time namespace, the monotonic
+  and boottime clock offsets set in linux.timeOffsets are applied to it
+  (requires Linux 5.6 or later). Processes added with oci exec join it.
+
+  With --rm, the container is deleted as soon as it stops, there is no need
+  to call oci delete. Its exit code is then only available from the --exit-dir
+  exit file.`
 	OciCreateExample string = `
-  $ singularity oci create -b ~/bundle mycontainer`
+  $ singularity oci create -b ~/bundle mycontainer
+  $ singularity oci create -b ~/bundle --rm --exit-dir /var/run/exits mycontainer
+  $ singularity oci create -b ~/bundle --env-file ~/app.env mycontainer
+  $ singularity oci create -b ~/bundle --socket-group monitor --socket-mode 0660 mycontainer`
 
 	OciStartUse   string = `start <container_ID>`
 	OciStartShort string = `Start container process (root user only)`
@@ -822,36 +1846,80 @@ found at:
 	OciKillUse   string = `kill [kill options...] <container_ID>`
 	OciKillShort string = `Kill a container (root user only)`
 	OciKillLong  string = `
-  Kill invoke kill operation to kill processes running within container identified by container ID.`
+  Kill invoke kill operation to kill processes running within container identified by container ID.
+
+  The container receives the signal given with --stop-signal, and with a
+  --stop-timeout grace period it is killed with SIGKILL if it's still
+  running once the grace period expired. Without those options, the signal
+  and grace period given to 'oci create' or 'oci run' are used, SIGTERM and
+  no grace period if none were given.
+
+  Signals are given by number or by name, names are case insensitive and the
+  SIG prefix is optional. With --all the signal is sent to every process in
+  the container cgroup instead of the container process only.`
 	OciKillExample string = `
   $ singularity oci kill mycontainer INT
-  $ singularity oci kill mycontainer -s INT`
+  $ singularity oci kill --all mycontainer usr1
+  $ singularity oci kill mycontainer -s INT
+  $ singularity oci kill --stop-signal SIGQUIT --stop-timeout 30 mycontainer`
 
 	OciDeleteUse   string = `delete <container_ID>`
 	OciDeleteShort string = `Delete container (root user only)`
 	OciDeleteLong  string = `
-  Delete invoke delete operation to delete resources that were created for container identified by container ID.`
+  Delete invoke delete operation to delete resources that were created for container identified by container ID.
+
+  Poststop hooks are executed by delete with the final container state, their
+  standard error is written to the container log and their failures are
+  reported as warnings. Containers created with --rm execute them when they
+  are automatically deleted.`
 	OciDeleteExample string = `
   $ singularity oci delete mycontainer`
 
 	OciAttachUse   string = `attach <container_ID>`
 	OciAttachShort string = `Attach console to a running container process (root user only)`
 	OciAttachLong  string = `
-  Attach will attach console to a running container process running within container identified by container ID.`
+  Attach will attach console to a running container process running within container identified by container ID.
+
+  Typing the detach key sequence (default to ctrl-p,ctrl-q) detaches the
+  console and leaves the container running, use --detach-keys to change it.`
 	OciAttachExample string = `
-  $ singularity oci attach mycontainer`
+  $ singularity oci attach mycontainer
+  $ singularity oci attach --detach-keys ctrl-x,x mycontainer`
 
-	OciExecUse   string = `exec <container_ID> <command> <args>`
+	OciExecUse   string = `exec [exec options...] <container_ID> <command> <args>`
 	OciExecShort string = `Execute a command within container (root user only)`
 	OciExecLong  string = `
-  Exec will execute the provided command/arguments within container identified by container ID.`
+  Exec will execute the provided command/arguments within container identified by container ID.
+  Variables read with --env-file are merged into the container process environment.`
 	OciExecExample string = `
-  $ singularity oci exec mycontainer id`
+  $ singularity oci exec mycontainer id
+  $ singularity oci exec --env-file ~/debug.env mycontainer env`
 
-	OciRunUse   string = `run -b <bundle_path> [run options...] <container_ID>`
-	OciRunShort string = `Create/start/attach/delete a container from a bundle directory (root user only)`
+	OciRunUse   string = `run -b <bundle_path> [run options...] <container_ID> | run [run options...] <image> [container_ID]`
+	OciRunShort string = `Create/start/attach/delete a container from a bundle directory or an image (root user only)`
 	OciRunLong  string = `
-  Run will invoke equivalent of create/start/attach/delete commands in a row.`
+  Run will invoke equivalent of create/start/attach/delete commands in a row.
+
+  Without --bundle, the first argument can be a SIF image or an image URI
+  (library://, docker://, shub:// ...), the bundle is then created from the
+  image the same way as with oci mount and deleted along with the container.
+  The config.json process, working directory and environment are taken from
+  the image OCI configuration if any, otherwise the image runscript is
+  executed. The container ID is generated if not specified.
+
+  Environment variables set with --env-file take precedence over those set
+  by --oci-patch, which take precedence over those from config.json. When
+  multiple environment files define the same variable, the last one wins.
+
+  Hook definition files (*.json) found in --hooks-dir directories (default
+  to /usr/share/containers/oci/hooks.d and /etc/containers/oci/hooks.d) are
+  evaluated against the final specification and matching hooks are added to
+  their stages after the hooks defined in config.json.
+
+  With --rm, the container and its image bundle are deleted by Singularity
+  as soon as the container stops, even if the oci run command itself is
+  interrupted or killed before, which makes it suitable for one-shot
+  scripted runs.`
 	OciRunExample string = `
   $ singularity oci run -b ~/bundle mycontainer
 
@@ -860,7 +1928,11 @@ found at:
   $ singularity oci create -b ~/bundle mycontainer
   $ singularity oci start mycontainer
   $ singularity oci attach mycontainer
-  $ singularity oci delete mycontainer`
+  $ singularity oci delete mycontainer
+
+  $ singularity oci run docker://alpine
+  $ singularity oci run /tmp/example.sif mycontainer
+  $ singularity oci run --rm docker://alpine`
 
 	OciUpdateUse   string = `update [update options...] <container_ID>`
 	OciUpdateShort string = `Update container cgroups resources (root user only)`
@@ -888,10 +1960,20 @@ found at:
 	OciResumeExample string = `
   $ singularity oci resume mycontainer`
 
-	OciMountUse   string = `mount <sif_image> <bundle_path>`
+	OciWaitUse   string = `wait <container_ID>`
+	OciWaitShort string = `Wait for a container to stop and return its exit code (root user only)`
+	OciWaitLong  string = `
+  Wait blocks until the specified container ID reaches the STOPPED state,
+  then prints the container process exit code and exits with it. It returns
+  immediately for a container already stopped.`
+	OciWaitExample string = `
+  $ singularity oci wait mycontainer`
+
+	OciMountUse   string = `mount [mount options...] <sif_image> <bundle_path>`
 	OciMountShort string = `Mount create an OCI bundle from SIF image (root user only)`
 	OciMountLong  string = `
-  Mount will mount and create an OCI bundle from a SIF image.`
+  Mount will mount and create an OCI bundle from a SIF image. Variables read
+  with --env-file are added to the process environment of the generated config.json.`
 	OciMountExample string = `
   $ singularity oci mount /tmp/example.sif /var/lib/singularity/bundles/example`
 
@@ -901,4 +1983,26 @@ found at:
   Umount will umount an OCI bundle previously mounted with singularity oci mount.`
 	OciUmountExample string = `
   $ singularity oci umount /var/lib/singularity/bundles/example`
+
+	OciSpecUse   string = `spec [spec options...]`
+	OciSpecShort string = `Generate a default OCI runtime specification`
+	OciSpecLong  string = `
+  Spec writes a default config.json in the bundle directory, or in the current
+  directory if --bundle isn't specified, the file must not already exist. The
+  container root filesystem is expected in the rootfs bundle subdirectory.
+
+  With --rootless, the specification is adjusted to run the container without
+  privileges: the current user is mapped to root in a user namespace, the
+  network namespace and cgroups resources are removed.
+
+  With --cgroupns, a cgroup namespace is added to the specification so the
+  container only sees its own cgroup subtree in /proc/self/cgroup and in the
+  cgroup mount.
+
+  With --from, the process arguments, working directory, environment and user
+  are set from the OCI image configuration stored in the SIF image, or the
+  image runscript is executed if the SIF image doesn't have one.`
+	OciSpecExample string = `
+  $ singularity oci spec --bundle /var/lib/singularity/bundles/example
+  $ singularity oci spec --rootless --from /tmp/example.sif`
 )
@@ -49,6 +49,28 @@ func cleanBlobCache() error {
 
 }
 
+func cleanBuildCache() error {
+	sylog.Debugf("Removing: %v", cache.Build())
+
+	err := os.RemoveAll(cache.Build())
+	if err != nil {
+		return fmt.Errorf("unable to clean build cache: %v", err)
+	}
+
+	return nil
+}
+
+func cleanCondaCache() error {
+	sylog.Debugf("Removing: %v", cache.Conda())
+
+	err := os.RemoveAll(cache.Conda())
+	if err != nil {
+		return fmt.Errorf("unable to clean conda cache: %v", err)
+	}
+
+	return nil
+}
+
 // CleanCache : clean a type of cache (cacheType string). will return a error if one occurs.
 func CleanCache(cacheType string) error {
 	switch cacheType {
@@ -61,6 +83,12 @@ func CleanCache(cacheType string) error {
 	case "blob", "blobs":
 		err := cleanBlobCache()
 		return err
+	case "build":
+		err := cleanBuildCache()
+		return err
+	case "conda":
+		err := cleanCondaCache()
+		return err
 	case "all":
 		err := cache.Clean()
 		return err
@@ -164,6 +192,7 @@ func CleanSingularityCache(cleanAll bool, cacheCleanTypes []string, cacheName st
 	libraryClean := false
 	ociClean := false
 	blobClean := false
+	buildClean := false
 
 	for _, t := range cacheCleanTypes {
 		switch t {
@@ -173,6 +202,8 @@ func CleanSingularityCache(cleanAll bool, cacheCleanTypes []string, cacheName st
 			ociClean = true
 		case "blob", "blobs":
 			blobClean = true
+		case "build":
+			buildClean = true
 		case "all":
 			cleanAll = true
 		default:
@@ -214,5 +245,10 @@ func CleanSingularityCache(cleanAll bool, cacheCleanTypes []string, cacheName st
 			return err
 		}
 	}
+	if buildClean {
+		if err := CleanCache("build"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,62 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/events"
+)
+
+// Events writes the events recorded since the given time in the journal
+// of user username to w, the current user journal is used if username
+// is empty. Events are written in JSON format, one per line, if
+// jsonFormat is set. If follow is set Events waits for new events and
+// only returns on error
+func Events(w io.Writer, username string, since time.Time, follow, jsonFormat bool) error {
+	path, err := events.Path(username)
+	if err != nil {
+		return fmt.Errorf("could not determine events journal path: %s", err)
+	}
+
+	err = events.Read(path, since, follow, func(e *events.Event) error {
+		if jsonFormat {
+			b, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(w, string(b))
+			return err
+		}
+		_, err := fmt.Fprintf(w, "%-25s %-8s %-16s %-6s %s\n", e.Time.Format(time.RFC3339), e.Kind, e.ID, e.Type, eventDetails(e))
+		return err
+	})
+	if os.IsNotExist(err) {
+		// no event recorded yet
+		return nil
+	}
+	return err
+}
+
+func eventDetails(e *events.Event) string {
+	var details []string
+
+	if e.Pid != 0 {
+		details = append(details, fmt.Sprintf("pid=%d", e.Pid))
+	}
+	if e.Image != "" {
+		details = append(details, "image="+e.Image)
+	}
+	if e.Details != "" {
+		details = append(details, e.Details)
+	}
+	return strings.Join(details, " ")
+}
@@ -13,7 +13,6 @@ import (
 	"net"
 	"os"
 	osignal "os/signal"
-	"sync"
 	"syscall"
 
 	"github.com/kr/pty"
@@ -21,18 +20,18 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/oci"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/term"
 	"github.com/sylabs/singularity/pkg/ociruntime"
-	"github.com/sylabs/singularity/pkg/util/unix"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
-func resize(controlSocket string, oversized bool) {
-	ctrl := &ociruntime.Control{}
+func resize(engineConfig *oci.EngineConfig, oversized bool) {
+	ctrl := &ociruntime.Control{Version: ociruntime.ControlVersion}
 	ctrl.ConsoleSize = &specs.Box{}
 
-	c, err := unix.Dial(controlSocket)
+	c, err := dialSocket(engineConfig, engineConfig.State.ControlSocket)
 	if err != nil {
-		sylog.Errorf("failed to connect to control socket")
+		sylog.Errorf("failed to connect to control socket: %s", err)
 		return
 	}
 	defer c.Close()
@@ -63,10 +62,12 @@ func resize(controlSocket string, oversized bool) {
 	}
 }
 
-func attach(engineConfig *oci.EngineConfig, run bool) error {
+// attach attaches console to the container process, if detachKeys is
+// not empty, reading this key sequence from standard input detaches the
+// console and leaves the container running
+func attach(engineConfig *oci.EngineConfig, run bool, detachKeys []byte) error {
 	var ostate *terminal.State
 	var conn net.Conn
-	var wg sync.WaitGroup
 
 	state := &engineConfig.State
 
@@ -83,7 +84,7 @@ func attach(engineConfig *oci.EngineConfig, run bool) error {
 	}
 
 	var err error
-	conn, err = unix.Dial(state.AttachSocket)
+	conn, err = dialSocket(engineConfig, state.AttachSocket)
 	if err != nil {
 		return err
 	}
@@ -91,12 +92,10 @@ func attach(engineConfig *oci.EngineConfig, run bool) error {
 
 	if hasTerminal {
 		ostate, _ = terminal.MakeRaw(0)
-		resize(state.ControlSocket, true)
-		resize(state.ControlSocket, false)
+		resize(engineConfig, true)
+		resize(engineConfig, false)
 	}
 
-	wg.Add(1)
-
 	go func() {
 		// catch SIGWINCH signal for terminal resize
 		signals := make(chan os.Signal, 1)
@@ -108,7 +107,7 @@ func attach(engineConfig *oci.EngineConfig, run bool) error {
 			switch s {
 			case syscall.SIGWINCH:
 				if hasTerminal {
-					resize(state.ControlSocket, false)
+					resize(engineConfig, false)
 				}
 			default:
 				syscall.Kill(pid, s.(syscall.Signal))
@@ -117,19 +116,31 @@ func attach(engineConfig *oci.EngineConfig, run bool) error {
 	}()
 
 	if hasTerminal || !run {
+		done := make(chan bool, 2)
+
 		// Pipe session to bash and visa-versa
 		go func() {
 			io.Copy(os.Stdout, conn)
-			wg.Done()
+			done <- false
 		}()
 		go func() {
-			io.Copy(conn, os.Stdin)
+			if err := term.CopyDetach(conn, os.Stdin, detachKeys); err == term.ErrDetached {
+				done <- true
+			}
 		}()
-		wg.Wait()
+		detached := <-done
 
 		if hasTerminal {
 			fmt.Printf("\r")
-			return terminal.Restore(0, ostate)
+			if detached {
+				fmt.Printf("\n")
+			}
+			if err := terminal.Restore(0, ostate); err != nil {
+				return err
+			}
+		}
+		if detached {
+			sylog.Infof("Detached from container %s", engineConfig.State.ID)
 		}
 		return nil
 	}
@@ -138,8 +149,20 @@ func attach(engineConfig *oci.EngineConfig, run bool) error {
 	return nil
 }
 
-// OciAttach attaches console to a running container
-func OciAttach(containerID string) error {
+// OciAttach attaches console to a running container, the console is
+// detached when the key sequence detachKeys is read
+func OciAttach(containerID string, detachKeys string) error {
+	keys, err := term.ParseDetachKeys(detachKeys)
+	if err != nil {
+		return fmt.Errorf("bad detach keys: %s", err)
+	}
+
+	if runtime, err := externalRuntime(); err != nil {
+		return err
+	} else if runtime != "" {
+		return runtimeAttach(runtime, containerID, keys)
+	}
+
 	engineConfig, err := getEngineConfig(containerID)
 	if err != nil {
 		return err
@@ -150,5 +173,5 @@ func OciAttach(containerID string) error {
 
 	defer exitContainer(containerID, false)
 
-	return attach(engineConfig, false)
+	return attach(engineConfig, false, keys)
 }
@@ -11,17 +11,27 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/opencontainers/runtime-tools/generate"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/oci"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
 	"github.com/sylabs/singularity/internal/pkg/util/exec"
+	"github.com/sylabs/singularity/internal/pkg/util/signal"
 )
 
 // OciCreate creates a container from an OCI bundle
 func OciCreate(containerID string, args *OciArgs) error {
+	if runtime, err := externalRuntime(); err != nil {
+		return err
+	} else if runtime != "" {
+		return runtimeCreate(runtime, containerID, args)
+	}
+
 	starter := buildcfg.LIBEXECDIR + "/singularity/bin/starter"
 
 	_, err := getState(containerID)
@@ -36,6 +46,66 @@ func OciCreate(containerID string, args *OciArgs) error {
 		return fmt.Errorf("failed to determine bundle absolute path: %s", err)
 	}
 
+	exitDir := ""
+	if args.ExitDir != "" {
+		exitDir, err = filepath.Abs(args.ExitDir)
+		if err != nil {
+			return fmt.Errorf("failed to determine exit directory absolute path: %s", err)
+		}
+	}
+
+	socketSecret := ""
+	if args.SocketSecretFile != "" {
+		socketSecret, err = filepath.Abs(args.SocketSecretFile)
+		if err != nil {
+			return fmt.Errorf("failed to determine socket secret file absolute path: %s", err)
+		}
+	}
+
+	tmpPolicies, err := config.ParseTmpPolicies(args.TmpPolicy)
+	if err != nil {
+		return err
+	}
+
+	if args.StopSignal != "" {
+		if _, err := signal.Convert(args.StopSignal); err != nil {
+			return err
+		}
+	}
+
+	var socketMode uint64
+	if args.SocketMode != "" {
+		socketMode, err = strconv.ParseUint(args.SocketMode, 8, 32)
+		if err != nil || socketMode&^0777 != 0 {
+			return fmt.Errorf("bad socket mode %s: must be octal permission bits", args.SocketMode)
+		}
+	}
+
+	// patch paths are relative to the current working directory
+	patches := make([][]byte, 0, len(args.OciPatchPaths))
+	for _, path := range args.OciPatchPaths {
+		patch, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read OCI patch file: %s", err)
+		}
+		patches = append(patches, patch)
+	}
+
+	hooksDirs := make([]string, 0, len(args.HooksDirs))
+	for _, dir := range args.HooksDirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to determine hooks directory absolute path: %s", err)
+		}
+		hooksDirs = append(hooksDirs, abs)
+	}
+
+	// environment files are relative to the current working directory too
+	environ, err := env.MergeFiles(nil, args.EnvFiles)
+	if err != nil {
+		return err
+	}
+
 	if err := os.Chdir(absBundle); err != nil {
 		return fmt.Errorf("failed to change directory to %s: %s", absBundle, err)
 	}
@@ -45,7 +115,13 @@ func OciCreate(containerID string, args *OciArgs) error {
 	engineConfig.SetBundlePath(absBundle)
 	engineConfig.SetLogPath(args.LogPath)
 	engineConfig.SetLogFormat(args.LogFormat)
+	engineConfig.SetStderrLogPath(args.StderrLogPath)
+	engineConfig.SetStderrLogFormat(args.StderrLogFormat)
 	engineConfig.SetPidFile(args.PidFile)
+	engineConfig.SetExitDir(exitDir)
+	engineConfig.SetSocketGroup(args.SocketGroup)
+	engineConfig.SetSocketMode(uint32(socketMode))
+	engineConfig.SetSocketSecret(socketSecret)
 
 	// load config.json from bundle path
 	configJSON := filepath.Join(absBundle, "config.json")
@@ -61,11 +137,58 @@ func OciCreate(containerID string, args *OciArgs) error {
 
 	fb.Close()
 
-	if err := json.Unmarshal(data, generator.Config); err != nil {
+	// decoded through engine configuration to keep time offsets
+	if err := json.Unmarshal(data, engineConfig.OciConfig); err != nil {
 		return fmt.Errorf("failed to parse OCI specification file %s: %s", configJSON, err)
 	}
 
-	Env := []string{sylog.GetEnvVar()}
+	for i, patch := range patches {
+		if err := engineConfig.OciConfig.ApplyMergePatch(patch); err != nil {
+			return fmt.Errorf("failed to apply OCI patch file %s: %s", args.OciPatchPaths[i], err)
+		}
+	}
+
+	// variables from environment files take precedence over the ones
+	// set by config.json and OCI patches
+	if len(environ) > 0 && generator.Config.Process != nil {
+		generator.Config.Process.Env = env.Merge(generator.Config.Process.Env, environ)
+	}
+
+	applyTmpPolicies(generator.Config, tmpPolicies)
+
+	if err := engineConfig.OciConfig.InjectHooks(hooksDirs); err != nil {
+		return err
+	}
+
+	if err := oci.ValidateSpec(generator.Config, absBundle); err != nil {
+		return fmt.Errorf("%s: %s", configJSON, err)
+	}
+
+	if args.DryRun {
+		b, err := json.MarshalIndent(generator.Config, "", "\t")
+		if err != nil {
+			return fmt.Errorf("failed to marshal OCI runtime specification: %s", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	for dest, p := range tmpPolicies {
+		if p.Type != config.ScratchPolicy {
+			continue
+		}
+		source := p.Source(dest)
+		if err := os.Mkdir(source, os.ModeSticky|0777); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to create %s: %s", source, err)
+		}
+	}
+	engineConfig.SetTmpPolicy(args.TmpPolicy)
+	engineConfig.SetImageBundle(args.ImageBundle)
+	engineConfig.SetAutoRemove(args.AutoRemove)
+	engineConfig.SetStopSignal(args.StopSignal)
+	engineConfig.SetStopTimeout(int(args.StopTimeout))
+
+	Env := []string{sylog.GetEnvVar(), sylog.GetJSONErrorsEnvVar()}
 
 	engineConfig.EmptyProcess = args.EmptyProcess
 	engineConfig.SyncSocket = args.SyncSocketPath
@@ -92,3 +215,22 @@ func OciCreate(containerID string, args *OciArgs) error {
 
 	return cmd.Run()
 }
+
+// applyTmpPolicies replaces mounts of /tmp, /var/tmp and /dev/shm in the
+// runtime specification by those provided by their policy
+func applyTmpPolicies(spec *specs.Spec, policies map[string]*config.TmpPolicy) {
+	for _, dest := range config.TmpPaths {
+		p, ok := policies[dest]
+		if !ok {
+			continue
+		}
+
+		mounts := make([]specs.Mount, 0, len(spec.Mounts)+1)
+		for _, m := range spec.Mounts {
+			if filepath.Clean(m.Destination) != dest {
+				mounts = append(mounts, m)
+			}
+		}
+		spec.Mounts = append(mounts, p.Mount(dest))
+	}
+}
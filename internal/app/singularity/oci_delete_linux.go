@@ -9,13 +9,19 @@ import (
 	"fmt"
 
 	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/oci"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
-	"github.com/sylabs/singularity/internal/pkg/util/exec"
 	"github.com/sylabs/singularity/pkg/ociruntime"
 )
 
 // OciDelete deletes container resources
 func OciDelete(containerID string) error {
+	if runtime, err := externalRuntime(); err != nil {
+		return err
+	} else if runtime != "" {
+		return runtimeDelete(runtime, containerID)
+	}
+
 	engineConfig, err := getEngineConfig(containerID)
 	if err != nil {
 		return err
@@ -26,7 +32,7 @@ func OciDelete(containerID string) error {
 		return fmt.Errorf("cannot delete '%s', the state of the container must be created or stopped", containerID)
 	case ociruntime.Stopped:
 	case ociruntime.Created:
-		if err := OciKill(containerID, "SIGTERM", 2); err != nil {
+		if err := OciKill(containerID, "SIGTERM", 2, false); err != nil {
 			return err
 		}
 		engineConfig, err = getEngineConfig(containerID)
@@ -35,19 +41,26 @@ func OciDelete(containerID string) error {
 		}
 	}
 
-	hooks := engineConfig.OciConfig.Hooks
-	if hooks != nil {
-		for _, h := range hooks.Poststop {
-			if err := exec.Hook(&h, &engineConfig.State.State); err != nil {
-				sylog.Warningf("%s", err)
-			}
-		}
-	}
-
 	// remove instance files
 	file, err := instance.Get(containerID, instance.OciSubDir)
 	if err != nil {
 		return err
 	}
-	return file.Delete()
+
+	// poststop hooks are executed once the container is deleted, with
+	// its final state, their failures are only reported
+	for _, err := range oci.PoststopHooks(engineConfig, containerID) {
+		sylog.Warningf("poststop hook: %s", err)
+	}
+
+	if err := file.Delete(); err != nil {
+		return err
+	}
+
+	if engineConfig.GetImageBundle() {
+		if err := OciUmount(engineConfig.GetBundlePath()); err != nil {
+			sylog.Warningf("failed to delete bundle %s: %s", engineConfig.GetBundlePath(), err)
+		}
+	}
+	return nil
 }
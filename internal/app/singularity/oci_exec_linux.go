@@ -16,11 +16,18 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/oci"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
 	"github.com/sylabs/singularity/internal/pkg/util/exec"
 )
 
 // OciExec executes a command in a container
-func OciExec(containerID string, cmdArgs []string) error {
+func OciExec(containerID string, cmdArgs []string, args *OciArgs) error {
+	if runtime, err := externalRuntime(); err != nil {
+		return err
+	} else if runtime != "" {
+		return runtimeExec(runtime, containerID, cmdArgs, args)
+	}
+
 	starter := buildcfg.LIBEXECDIR + "/singularity/bin/starter"
 
 	commonConfig, err := getCommonConfig(containerID)
@@ -40,6 +47,14 @@ func OciExec(containerID string, cmdArgs []string) error {
 	engineConfig.Exec = true
 	engineConfig.OciConfig.SetProcessArgs(cmdArgs)
 
+	if len(args.EnvFiles) > 0 && engineConfig.OciConfig.Process != nil {
+		environ, err := env.MergeFiles(engineConfig.OciConfig.Process.Env, args.EnvFiles)
+		if err != nil {
+			return err
+		}
+		engineConfig.OciConfig.Process.Env = environ
+	}
+
 	os.Clearenv()
 
 	configData, err := json.Marshal(commonConfig)
@@ -47,7 +62,7 @@ func OciExec(containerID string, cmdArgs []string) error {
 		sylog.Fatalf("%s", err)
 	}
 
-	Env := []string{sylog.GetEnvVar()}
+	Env := []string{sylog.GetEnvVar(), sylog.GetJSONErrorsEnvVar()}
 
 	procName := fmt.Sprintf("Singularity OCI %s", containerID)
 	return exec.Pipe(starter, []string{procName}, Env, configData)
@@ -11,18 +11,51 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/sylabs/singularity/internal/pkg/cgroups"
+	"github.com/sylabs/singularity/internal/pkg/events"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/oci"
 	"github.com/sylabs/singularity/internal/pkg/util/signal"
 	"github.com/sylabs/singularity/pkg/ociruntime"
-	"github.com/sylabs/singularity/pkg/util/unix"
 )
 
-// OciKill kills container process
-func OciKill(containerID string, killSignal string, killTimeout int) error {
+// killAll sends signal sig to all processes in the container cgroup
+func killAll(engineConfig *oci.EngineConfig, sig syscall.Signal) error {
+	if engineConfig.OciConfig.Linux == nil || engineConfig.OciConfig.Linux.CgroupsPath == "" {
+		return fmt.Errorf("no cgroup found for container")
+	}
+
+	manager := &cgroups.Manager{Path: engineConfig.OciConfig.Linux.CgroupsPath}
+
+	pids, err := manager.Pids()
+	if err != nil {
+		return fmt.Errorf("failed to get container processes: %s", err)
+	}
+
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("failed to send signal to process %d: %s", pid, err)
+		}
+	}
+	return nil
+}
+
+// OciKill kills container process, if all is true the signal is sent
+// to all processes in the container cgroup. An empty killSignal and a
+// negative killTimeout stand for the stop signal and timeout given at
+// container creation
+func OciKill(containerID string, killSignal string, killTimeout int, all bool) error {
+	if runtime, err := externalRuntime(); err != nil {
+		return err
+	} else if runtime != "" {
+		return runtimeKill(runtime, containerID, killSignal, killTimeout, all)
+	}
+
 	// send signal to the instance
-	state, err := getState(containerID)
+	engineConfig, err := getEngineConfig(containerID)
 	if err != nil {
 		return err
 	}
+	state := engineConfig.GetState()
 
 	if state.Status != ociruntime.Created && state.Status != ociruntime.Running {
 		return fmt.Errorf("cannot kill '%s', the state of the container must be created or running", containerID)
@@ -30,6 +63,13 @@ func OciKill(containerID string, killSignal string, killTimeout int) error {
 
 	sig := syscall.SIGTERM
 
+	// signal and timeout given at creation are used by default
+	if killSignal == "" {
+		killSignal = engineConfig.GetStopSignal()
+	}
+	if killTimeout < 0 {
+		killTimeout = engineConfig.GetStopTimeout()
+	}
 	if killSignal != "" {
 		sig, err = signal.Convert(killSignal)
 		if err != nil {
@@ -37,10 +77,23 @@ func OciKill(containerID string, killSignal string, killTimeout int) error {
 		}
 	}
 
+	kill := func(sig syscall.Signal) error {
+		details := signal.Name(sig)
+		if all {
+			details += " sent to all processes"
+		}
+		events.Record(&events.Event{Type: events.Kill, Kind: events.KindOci, ID: containerID, Pid: state.Pid, Details: details})
+
+		if all {
+			return killAll(engineConfig, sig)
+		}
+		return syscall.Kill(state.Pid, sig)
+	}
+
 	if killTimeout > 0 {
-		c, err := unix.Dial(state.ControlSocket)
+		c, err := dialSocket(engineConfig, state.ControlSocket)
 		if err != nil {
-			return fmt.Errorf("failed to connect to control socket")
+			return fmt.Errorf("failed to connect to control socket: %s", err)
 		}
 		defer c.Close()
 
@@ -54,17 +107,17 @@ func OciKill(containerID string, killSignal string, killTimeout int) error {
 			}
 		}()
 
-		if err := syscall.Kill(state.Pid, sig); err != nil {
+		if err := kill(sig); err != nil {
 			return err
 		}
 
 		select {
 		case <-killed:
 		case <-time.After(time.Duration(killTimeout) * time.Second):
-			return syscall.Kill(state.Pid, syscall.SIGKILL)
+			return kill(syscall.SIGKILL)
 		}
 	} else {
-		return syscall.Kill(state.Pid, sig)
+		return kill(sig)
 	}
 
 	return nil
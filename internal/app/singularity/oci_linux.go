@@ -8,27 +8,52 @@ package singularity
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"os"
 
 	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/oci"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/exitcode"
 	"github.com/sylabs/singularity/pkg/ociruntime"
+	"github.com/sylabs/singularity/pkg/util/unix"
 )
 
 // OciArgs contains CLI arguments
 type OciArgs struct {
-	BundlePath     string
-	LogPath        string
-	LogFormat      string
-	SyncSocketPath string
-	PidFile        string
-	FromFile       string
-	KillSignal     string
-	KillTimeout    uint32
-	EmptyProcess   bool
-	ForceKill      bool
+	BundlePath       string
+	LogPath          string
+	LogFormat        string
+	StderrLogPath    string
+	StderrLogFormat  string
+	SyncSocketPath   string
+	PidFile          string
+	ExitDir          string
+	OciPatchPaths    []string
+	EnvFiles         []string
+	HooksDirs        []string
+	TmpPolicy        []string
+	DetachKeys       string
+	KillAll          bool
+	Rootless         bool
+	FromImage        string
+	Image            string
+	ImageBundle      bool
+	SocketGroup      string
+	SocketMode       string
+	SocketSecretFile string
+	FromFile         string
+	KillSignal       string
+	KillTimeout      uint32
+	StopSignal       string
+	StopTimeout      uint32
+	EmptyProcess     bool
+	ForceKill        bool
+	DryRun           bool
+	AutoRemove       bool
+	CgroupNamespace  bool
 }
 
 func getCommonConfig(containerID string) (*config.Common, error) {
@@ -64,6 +89,34 @@ func getState(containerID string) (*ociruntime.State, error) {
 	return &engineConfig.State, nil
 }
 
+// dialSocket connects to a container attach or control socket and sends
+// the shared secret first if the container requires one
+func dialSocket(engineConfig *oci.EngineConfig, path string) (net.Conn, error) {
+	var secret []byte
+
+	if secretFile := engineConfig.GetSocketSecret(); secretFile != "" {
+		var err error
+		secret, err = unix.ReadSecretFile(secretFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := unix.Dial(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret != nil {
+		if err := unix.SendSecret(c, secret); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
 func exitContainer(containerID string, delete bool) {
 	state, err := getState(containerID)
 	if err != nil {
@@ -75,7 +128,7 @@ func exitContainer(containerID string, delete bool) {
 	}
 
 	if state.ExitCode != nil {
-		defer os.Exit(*state.ExitCode)
+		defer os.Exit(containerExitCode(state))
 	}
 
 	if delete {
@@ -84,3 +137,54 @@ func exitContainer(containerID string, delete bool) {
 		}
 	}
 }
+
+// containerExitCode returns the exit code of a stopped container, out of
+// memory kills are reported and mapped to the corresponding exit code
+func containerExitCode(state *ociruntime.State) int {
+	if _, ok := state.Annotations[ociruntime.OOMKilledAnnotation]; ok {
+		sylog.Errorf("Container process was killed by the out of memory killer")
+		return exitcode.OOMKilled
+	}
+	return *state.ExitCode
+}
+
+// controlInfo requests the control protocol version and capabilities
+// of the container engine. Engines predating version negotiation close
+// the connection without reply and are reported with version 0 and
+// legacy capabilities.
+func controlInfo(engineConfig *oci.EngineConfig) (*ociruntime.ControlInfo, error) {
+	c, err := dialSocket(engineConfig, engineConfig.State.ControlSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to control socket: %s", err)
+	}
+	defer c.Close()
+
+	ctrl := &ociruntime.Control{
+		Version: ociruntime.ControlVersion,
+		Hello:   true,
+	}
+	if err := json.NewEncoder(c).Encode(ctrl); err != nil {
+		return nil, err
+	}
+
+	info := &ociruntime.ControlInfo{}
+	if err := json.NewDecoder(c).Decode(info); err == io.EOF {
+		info.Capabilities = ociruntime.LegacyControlCapabilities
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read control protocol information: %s", err)
+	}
+	return info, nil
+}
+
+// checkControl returns an error if the container engine doesn't
+// support the control operation capability
+func checkControl(engineConfig *oci.EngineConfig, capability string) error {
+	info, err := controlInfo(engineConfig)
+	if err != nil {
+		return err
+	}
+	if !info.HasCapability(capability) {
+		return fmt.Errorf("container engine (control protocol version %d) doesn't support %s operation", info.Version, capability)
+	}
+	return nil
+}
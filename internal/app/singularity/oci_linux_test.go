@@ -0,0 +1,128 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/oci"
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+// controlServer accepts a single control connection on path, reads
+// the hello control and replies with reply, the connection is closed
+// without reply if reply is nil like engines predating hello do
+func controlServer(t *testing.T, path string, reply interface{}) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer l.Close()
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		ctrl := &ociruntime.Control{}
+		if err := json.NewDecoder(c).Decode(ctrl); err != nil || !ctrl.Hello {
+			return
+		}
+		if reply != nil {
+			json.NewEncoder(c).Encode(reply)
+		}
+	}()
+}
+
+func TestControlInfo(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "control-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	engineConfig := oci.NewConfig()
+	engineConfig.State.ControlSocket = filepath.Join(dir, "legacy.sock")
+
+	// engines without protocol negotiation close the connection
+	controlServer(t, engineConfig.State.ControlSocket, nil)
+	info, err := controlInfo(engineConfig)
+	if err != nil {
+		t.Fatalf("unexpected error with legacy engine: %s", err)
+	}
+	if info.Version != 0 || !reflect.DeepEqual(info.Capabilities, ociruntime.LegacyControlCapabilities) {
+		t.Errorf("unexpected legacy control information %+v", info)
+	}
+
+	engineConfig.State.ControlSocket = filepath.Join(dir, "current.sock")
+	current := &ociruntime.ControlInfo{Version: ociruntime.ControlVersion, Capabilities: ociruntime.ControlCapabilities}
+	controlServer(t, engineConfig.State.ControlSocket, current)
+	info, err = controlInfo(engineConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(info, current) {
+		t.Errorf("unexpected control information %+v", info)
+	}
+
+	engineConfig.State.ControlSocket = filepath.Join(dir, "bad.sock")
+	controlServer(t, engineConfig.State.ControlSocket, "bad reply")
+	if _, err := controlInfo(engineConfig); err == nil {
+		t.Errorf("unexpected success with a bad reply")
+	}
+
+	engineConfig.State.ControlSocket = filepath.Join(dir, "missing.sock")
+	if _, err := controlInfo(engineConfig); err == nil {
+		t.Errorf("unexpected success without control socket")
+	}
+}
+
+func TestCheckControl(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "control-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	engineConfig := oci.NewConfig()
+
+	tests := []struct {
+		name       string
+		reply      interface{}
+		capability string
+		succeed    bool
+	}{
+		{"legacy pause", nil, ociruntime.ControlPause, true},
+		{"legacy wait", nil, ociruntime.ControlWait, false},
+		{"current wait", &ociruntime.ControlInfo{Version: ociruntime.ControlVersion, Capabilities: ociruntime.ControlCapabilities}, ociruntime.ControlWait, true},
+	}
+	for i, tt := range tests {
+		engineConfig.State.ControlSocket = filepath.Join(dir, strconv.Itoa(i)+".sock")
+		controlServer(t, engineConfig.State.ControlSocket, tt.reply)
+
+		err := checkControl(engineConfig, tt.capability)
+		if tt.succeed && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if !tt.succeed && err == nil {
+			t.Errorf("%s: unexpected success", tt.name)
+		}
+	}
+}
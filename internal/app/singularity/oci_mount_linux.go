@@ -6,16 +6,39 @@
 package singularity
 
 import (
+	"fmt"
+	"runtime"
+
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
 	ocibundle "github.com/sylabs/singularity/pkg/ocibundle/sif"
+	"github.com/sylabs/singularity/pkg/ocibundle/tools"
 )
 
 // OciMount mount a SIF image to create an OCI bundle
-func OciMount(image string, bundle string) error {
+func OciMount(image string, bundle string, args *OciArgs) error {
 	d, err := ocibundle.FromSif(image, bundle, true)
 	if err != nil {
 		return err
 	}
-	return d.Create(nil)
+
+	if len(args.EnvFiles) == 0 {
+		return d.Create(nil)
+	}
+
+	g, err := generate.New(runtime.GOOS)
+	if err != nil {
+		return fmt.Errorf("failed to generate OCI config: %s", err)
+	}
+	g.SetProcessArgs([]string{tools.RunScript})
+
+	environ, err := env.MergeFiles(g.Config.Process.Env, args.EnvFiles)
+	if err != nil {
+		return err
+	}
+	g.Config.Process.Env = environ
+
+	return d.Create(g.Config)
 }
 
 // OciUmount umount SIF and delete OCI bundle
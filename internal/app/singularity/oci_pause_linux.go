@@ -11,15 +11,24 @@ import (
 	"io"
 
 	"github.com/sylabs/singularity/pkg/ociruntime"
-	"github.com/sylabs/singularity/pkg/util/unix"
 )
 
 // OciPauseResume pauses/resumes processes in a container
 func OciPauseResume(containerID string, pause bool) error {
-	state, err := getState(containerID)
+	if runtime, err := externalRuntime(); err != nil {
+		return err
+	} else if runtime != "" {
+		if pause {
+			return runRuntime(runtime, "pause", containerID)
+		}
+		return runRuntime(runtime, "resume", containerID)
+	}
+
+	engineConfig, err := getEngineConfig(containerID)
 	if err != nil {
 		return err
 	}
+	state := engineConfig.GetState()
 
 	if state.ControlSocket == "" {
 		return fmt.Errorf("can't find control socket")
@@ -31,16 +40,22 @@ func OciPauseResume(containerID string, pause bool) error {
 		return fmt.Errorf("container %s is not paused", containerID)
 	}
 
-	ctrl := &ociruntime.Control{}
+	ctrl := &ociruntime.Control{Version: ociruntime.ControlVersion}
+	capability := ociruntime.ControlResume
 	if pause {
 		ctrl.Pause = true
+		capability = ociruntime.ControlPause
 	} else {
 		ctrl.Resume = true
 	}
 
-	c, err := unix.Dial(state.ControlSocket)
+	if err := checkControl(engineConfig, capability); err != nil {
+		return err
+	}
+
+	c, err := dialSocket(engineConfig, state.ControlSocket)
 	if err != nil {
-		return fmt.Errorf("failed to connect to control socket")
+		return fmt.Errorf("failed to connect to control socket: %s", err)
 	}
 	defer c.Close()
 
@@ -11,28 +11,74 @@ import (
 	"os"
 	"path/filepath"
 
-	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/ociruntime"
 	"github.com/sylabs/singularity/pkg/util/unix"
 )
 
-// OciRun runs a container (equivalent to create/start/delete)
-func OciRun(containerID string, args *OciArgs) error {
+// imageBundleDir is the directory where bundles created from images
+// are stored
+var imageBundleDir = filepath.Join(buildcfg.LOCALSTATEDIR, "singularity", "bundles")
+
+// createImageBundle creates the container bundle from a SIF image, the
+// configuration is generated from the image OCI configuration if any
+func createImageBundle(containerID string, args *OciArgs) (string, error) {
+	bundle := filepath.Join(imageBundleDir, containerID)
+	if _, err := os.Stat(bundle); err == nil {
+		return "", fmt.Errorf("bundle %s already exists", bundle)
+	}
+	if err := os.MkdirAll(imageBundleDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %s", imageBundleDir, err)
+	}
+	if err := OciMount(args.Image, bundle, args); err != nil {
+		return "", fmt.Errorf("failed to create bundle from %s: %s", args.Image, err)
+	}
+	return bundle, nil
+}
+
+// OciRun runs a container (equivalent to create/start/delete), it returns
+// the exit code of the container process
+func OciRun(containerID string, args *OciArgs) (exitCode int, err error) {
+	if runtime, err := externalRuntime(); err != nil {
+		return 0, err
+	} else if runtime != "" {
+		return runtimeRun(runtime, containerID, args)
+	}
+
+	if args.Image != "" {
+		if _, err := getState(containerID); err == nil {
+			return 0, fmt.Errorf("%s already exists", containerID)
+		}
+		bundle, err := createImageBundle(containerID, args)
+		if err != nil {
+			return 0, err
+		}
+		args.BundlePath = bundle
+		args.ImageBundle = true
+	}
+
+	if args.DryRun {
+		if args.ImageBundle {
+			defer OciUmount(args.BundlePath)
+		}
+		return 0, OciCreate(containerID, args)
+	}
+
 	dir, err := instance.GetDirPrivileged(containerID, instance.OciSubDir)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+		return 0, err
 	}
 	args.SyncSocketPath = filepath.Join(dir, "run.sock")
 
 	l, err := unix.CreateSocket(args.SyncSocketPath)
 	if err != nil {
 		os.Remove(args.SyncSocketPath)
-		return err
+		return 0, err
 	}
 
 	defer l.Close()
@@ -42,19 +88,40 @@ func OciRun(containerID string, args *OciArgs) error {
 	if err := OciCreate(containerID, args); err != nil {
 		defer os.Remove(args.SyncSocketPath)
 		if _, err1 := getState(containerID); err1 != nil {
-			return err
+			// bundle is deleted along with the container otherwise
+			if args.ImageBundle {
+				OciUmount(args.BundlePath)
+			}
+			return 0, err
 		}
 		if err := OciDelete(containerID); err != nil {
 			sylog.Warningf("can't delete container %s", containerID)
 		}
-		return err
+		return 0, err
 	}
 
-	defer exitContainer(containerID, true)
+	// auto removed containers are deleted by the engine, the exit
+	// code is then taken from the stopped state
+	var stopped *ociruntime.State
+
+	if !args.AutoRemove {
+		defer func() {
+			state, err := getState(containerID)
+			if err != nil {
+				return
+			}
+			if state.ExitCode != nil {
+				exitCode = containerExitCode(state)
+			}
+			if err := OciDelete(containerID); err != nil {
+				sylog.Errorf("%s", err)
+			}
+		}()
+	}
 	defer os.Remove(args.SyncSocketPath)
 
 	go func() {
-		var state specs.State
+		var state ociruntime.State
 
 		for {
 			c, err := l.Accept()
@@ -78,6 +145,7 @@ func OciRun(containerID string, args *OciArgs) error {
 			case ociruntime.Running:
 				status <- state.Status
 			case ociruntime.Stopped:
+				stopped = &state
 				status <- state.Status
 			}
 		}
@@ -86,26 +154,29 @@ func OciRun(containerID string, args *OciArgs) error {
 	// wait running status
 	s := <-status
 	if s != ociruntime.Running {
-		return fmt.Errorf("%s", s)
+		return 0, fmt.Errorf("%s", s)
 	}
 
 	engineConfig, err := getEngineConfig(containerID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	if err := attach(engineConfig, true); err != nil {
+	if err := attach(engineConfig, true, nil); err != nil {
 		// kill container before deletion
 		sylog.Errorf("%s", err)
-		OciKill(containerID, "SIGKILL", 1)
-		return err
+		OciKill(containerID, "SIGKILL", 1, false)
+		return 0, err
 	}
 
 	// wait stopped status
 	s = <-status
 	if s != ociruntime.Stopped {
-		return fmt.Errorf("%s", s)
+		return 0, fmt.Errorf("%s", s)
 	}
 
-	return nil
+	if args.AutoRemove && stopped != nil && stopped.ExitCode != nil {
+		return containerExitCode(stopped), nil
+	}
+	return 0, nil
 }
@@ -0,0 +1,252 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	osignal "os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/kr/pty"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/term"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// consoleSocket receives the terminal master from the runtime
+	consoleSocket = "console.sock"
+	// consoleAttachSocket hands the terminal master over to attach
+	consoleAttachSocket = "attach.sock"
+	// consolePidFile holds the console holder PID
+	consolePidFile = "console.pid"
+)
+
+// runtimeConsoleDir returns the directory holding the console sockets
+// of a container created with the external runtime
+func runtimeConsoleDir(runtime string, containerID string) string {
+	return filepath.Join(buildcfg.RUNSTATEDIR, "singularity", "runtime", filepath.Base(runtime)+"-console", containerID)
+}
+
+// bundleTerminal returns if the bundle process requests a terminal
+func bundleTerminal(bundle string) (bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(bundle, "config.json"))
+	if err != nil {
+		return false, fmt.Errorf("failed to read bundle configuration: %s", err)
+	}
+	spec := &specs.Spec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return false, fmt.Errorf("failed to decode bundle configuration: %s", err)
+	}
+	return spec.Process != nil && spec.Process.Terminal, nil
+}
+
+// startConsole starts the console holder in dir and returns the path
+// of the console socket to pass to the runtime, the holder keeps the
+// terminal master once the runtime exits so attach can use it
+func startConsole(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create console directory: %s", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("could not determine singularity path: %s", err)
+	}
+
+	cmd := exec.Command(exe, "oci", "console", dir)
+	cmd.Dir = "/"
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start console holder: %s", err)
+	}
+
+	// the holder closes its standard output once listening
+	ioutil.ReadAll(stdout)
+
+	socket := filepath.Join(dir, consoleSocket)
+	if _, err := os.Stat(socket); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("console holder failed to start")
+	}
+	return socket, cmd.Process.Release()
+}
+
+// stopConsole terminates the console holder in dir and removes it
+func stopConsole(dir string) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, consolePidFile))
+	if os.IsNotExist(err) {
+		return os.RemoveAll(dir)
+	} else if err != nil {
+		return err
+	}
+	if pid, err := strconv.Atoi(string(data)); err == nil {
+		syscall.Kill(pid, syscall.SIGTERM)
+	}
+	return os.RemoveAll(dir)
+}
+
+// RuntimeConsole runs the console holder of a container created with
+// the external runtime, it receives the terminal master on the console
+// socket of dir and sends it to each client of the attach socket
+func RuntimeConsole(dir string) error {
+	console, err := net.Listen("unix", filepath.Join(dir, consoleSocket))
+	if err != nil {
+		return err
+	}
+	attach, err := net.Listen("unix", filepath.Join(dir, consoleAttachSocket))
+	if err != nil {
+		return err
+	}
+	pid := []byte(strconv.Itoa(os.Getpid()))
+	if err := ioutil.WriteFile(filepath.Join(dir, consolePidFile), pid, 0600); err != nil {
+		return err
+	}
+	os.Stdout.Close()
+
+	c, err := console.Accept()
+	if err != nil {
+		return err
+	}
+	master, err := recvConsole(c.(*net.UnixConn))
+	c.Close()
+	console.Close()
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+
+	for {
+		c, err := attach.Accept()
+		if err != nil {
+			return err
+		}
+		if err := sendConsole(c.(*net.UnixConn), master); err != nil {
+			sylog.Warningf("%s", err)
+		}
+		c.Close()
+	}
+}
+
+// sendConsole sends the terminal master over conn
+func sendConsole(conn *net.UnixConn, master *os.File) error {
+	rights := unix.UnixRights(int(master.Fd()))
+	if _, _, err := conn.WriteMsgUnix([]byte{0}, rights, nil); err != nil {
+		return fmt.Errorf("failed to send console: %s", err)
+	}
+	return nil
+}
+
+// recvConsole receives a terminal master over conn, the runtime sends
+// the terminal path along with it
+func recvConsole(conn *net.UnixConn) (*os.File, error) {
+	buf := make([]byte, 4096)
+	oob := make([]byte, unix.CmsgSpace(4))
+
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive console: %s", err)
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse control message: %s", err)
+	}
+	for _, msg := range msgs {
+		fds, err := unix.ParseUnixRights(&msg)
+		if err != nil || len(fds) != 1 {
+			continue
+		}
+		syscall.CloseOnExec(fds[0])
+		return os.NewFile(uintptr(fds[0]), string(buf[:n])), nil
+	}
+	return nil, fmt.Errorf("no console received")
+}
+
+// runtimeAttach attaches console to a container created with the
+// external runtime and a terminal, if detachKeys is not empty, reading
+// this key sequence from standard input detaches the console
+func runtimeAttach(runtime string, containerID string, detachKeys []byte) error {
+	state, err := runtimeState(runtime, containerID)
+	if err != nil {
+		return err
+	}
+	if state.Status != ociruntime.Running {
+		return fmt.Errorf("could not attach to %s: not in running state", containerID)
+	}
+	if !terminal.IsTerminal(0) {
+		return fmt.Errorf("attach requires a terminal")
+	}
+
+	socket := filepath.Join(runtimeConsoleDir(runtime, containerID), consoleAttachSocket)
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		return fmt.Errorf("attach not available, %s process has no terminal: %s", containerID, err)
+	}
+	console, err := recvConsole(conn)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	defer console.Close()
+
+	ostate, err := terminal.MakeRaw(0)
+	if err != nil {
+		return err
+	}
+	pty.InheritSize(os.Stdin, console)
+
+	go func() {
+		// catch SIGWINCH signal for terminal resize
+		signals := make(chan os.Signal, 1)
+		osignal.Notify(signals, syscall.SIGWINCH)
+		for range signals {
+			pty.InheritSize(os.Stdin, console)
+		}
+	}()
+
+	done := make(chan bool, 2)
+
+	go func() {
+		io.Copy(os.Stdout, console)
+		done <- false
+	}()
+	go func() {
+		if err := term.CopyDetach(console, os.Stdin, detachKeys); err == term.ErrDetached {
+			done <- true
+		}
+	}()
+	detached := <-done
+
+	fmt.Printf("\r")
+	if detached {
+		fmt.Printf("\n")
+	}
+	if err := terminal.Restore(0, ostate); err != nil {
+		return err
+	}
+	if detached {
+		sylog.Infof("Detached from container %s", containerID)
+	}
+	return nil
+}
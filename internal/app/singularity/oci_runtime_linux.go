@@ -0,0 +1,323 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config/oci"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ociRuntime is the external OCI runtime requested on command line
+var ociRuntime string
+
+// SetOciRuntime sets the external OCI runtime (eg: runc, crun) the
+// container lifecycle is delegated to, it overrides the oci runtime
+// directive of singularity.conf
+func SetOciRuntime(runtime string) {
+	ociRuntime = runtime
+}
+
+// externalRuntime returns the path of the external OCI runtime set on
+// command line or in configuration file, an empty string is returned
+// if the built-in OCI engine is used
+func externalRuntime() (string, error) {
+	runtime := ociRuntime
+
+	if runtime == "" {
+		fileConfig := &singularityConfig.FileConfig{}
+		configurationFile := buildcfg.SYSCONFDIR + "/singularity/singularity.conf"
+		if err := config.Parser(configurationFile, fileConfig); err != nil {
+			return "", fmt.Errorf("unable to parse singularity.conf file: %s", err)
+		}
+		runtime = fileConfig.OciRuntime
+	}
+	if runtime == "" || runtime == "singularity" {
+		return "", nil
+	}
+
+	path, err := exec.LookPath(runtime)
+	if err != nil {
+		return "", fmt.Errorf("OCI runtime %s not found: %s", runtime, err)
+	}
+	return path, nil
+}
+
+// runtimeCommand returns the external runtime command executing the
+// subcommand args, container states are stored in a singularity
+// specific root directory to not mix with containers started directly
+// with the runtime
+func runtimeCommand(runtime string, args ...string) *exec.Cmd {
+	cmd := exec.Command(runtime, runtimeArgs(runtime, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// runtimeArgs returns the external runtime arguments executing the
+// subcommand args
+func runtimeArgs(runtime string, args ...string) []string {
+	root := filepath.Join(buildcfg.RUNSTATEDIR, "singularity", "runtime", filepath.Base(runtime))
+	return append([]string{"--root", root}, args...)
+}
+
+// runRuntime executes the external runtime subcommand args
+func runRuntime(runtime string, args ...string) error {
+	if err := runtimeCommand(runtime, args...).Run(); err != nil {
+		return fmt.Errorf("%s %s failed: %s", filepath.Base(runtime), args[0], err)
+	}
+	return nil
+}
+
+// checkRuntimeArgs returns an error if options handled only by the
+// built-in OCI engine are set
+func checkRuntimeArgs(runtime string, args *OciArgs) error {
+	var unsupported []string
+
+	options := map[string]bool{
+		"--log-path":           args.LogPath != "",
+		"--stderr-log-path":    args.StderrLogPath != "",
+		"--exit-dir":           args.ExitDir != "",
+		"--oci-patch":          len(args.OciPatchPaths) > 0,
+		"--hooks-dir":          !reflect.DeepEqual(args.HooksDirs, oci.DefaultHooksDirs),
+		"--env-file":           len(args.EnvFiles) > 0 && args.Image == "",
+		"--tmp-policy":         len(args.TmpPolicy) > 0,
+		"--stop-signal":        args.StopSignal != "",
+		"--stop-timeout":       args.StopTimeout > 0,
+		"--socket-group":       args.SocketGroup != "",
+		"--socket-mode":        args.SocketMode != "",
+		"--socket-secret-file": args.SocketSecretFile != "",
+		"--empty-process":      args.EmptyProcess,
+		"--dry-run":            args.DryRun,
+	}
+	for option, set := range options {
+		if set {
+			unsupported = append(unsupported, option)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("%s not supported with OCI runtime %s", strings.Join(unsupported, ", "), runtime)
+	}
+	return nil
+}
+
+// runtimeState returns the container state reported by the external
+// runtime
+func runtimeState(runtime string, containerID string) (*specs.State, error) {
+	cmd := runtimeCommand(runtime, "state", containerID)
+	cmd.Stdout = nil
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s state: %s", containerID, err)
+	}
+
+	state := &specs.State{}
+	if err := json.Unmarshal(out, state); err != nil {
+		return nil, fmt.Errorf("failed to decode %s state: %s", containerID, err)
+	}
+	return state, nil
+}
+
+func runtimeCreate(runtime string, containerID string, args *OciArgs) error {
+	if err := checkRuntimeArgs(runtime, args); err != nil {
+		return err
+	}
+	if args.AutoRemove {
+		return fmt.Errorf("--rm not supported with OCI runtime %s", runtime)
+	}
+
+	bundle, err := filepath.Abs(args.BundlePath)
+	if err != nil {
+		return fmt.Errorf("failed to determine bundle absolute path: %s", err)
+	}
+
+	// a console holder receives the terminal of the container process
+	// to attach it later
+	socket := ""
+	hasTerminal, err := bundleTerminal(bundle)
+	if err != nil {
+		return err
+	}
+	dir := runtimeConsoleDir(runtime, containerID)
+	if hasTerminal {
+		if socket, err = startConsole(dir); err != nil {
+			return err
+		}
+	}
+
+	if err := runRuntime(runtime, runtimeCreateArgs(containerID, bundle, socket, args)...); err != nil {
+		if hasTerminal {
+			stopConsole(dir)
+		}
+		return err
+	}
+	return nil
+}
+
+// runtimeCreateArgs returns the external runtime create arguments, the
+// terminal master is sent to consoleSocket if not empty
+func runtimeCreateArgs(containerID string, bundle string, consoleSocket string, args *OciArgs) []string {
+	cmdArgs := []string{"create", "--bundle", bundle}
+	if consoleSocket != "" {
+		cmdArgs = append(cmdArgs, "--console-socket", consoleSocket)
+	}
+	if args.PidFile != "" {
+		cmdArgs = append(cmdArgs, "--pid-file", args.PidFile)
+	}
+	return append(cmdArgs, containerID)
+}
+
+// runtimeRun runs the container in foreground with the external runtime
+// and returns the container exit code, the runtime deletes the
+// container once stopped
+func runtimeRun(runtime string, containerID string, args *OciArgs) (int, error) {
+	if err := checkRuntimeArgs(runtime, args); err != nil {
+		return 0, err
+	}
+
+	if args.Image != "" {
+		bundle, err := createImageBundle(containerID, args)
+		if err != nil {
+			return 0, err
+		}
+		args.BundlePath = bundle
+		defer OciUmount(bundle)
+	}
+
+	bundle, err := filepath.Abs(args.BundlePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine bundle absolute path: %s", err)
+	}
+
+	err = runtimeCommand(runtime, runtimeRunArgs(containerID, bundle, args)...).Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus(), nil
+		}
+	}
+	return 0, err
+}
+
+// runtimeRunArgs returns the external runtime run arguments
+func runtimeRunArgs(containerID string, bundle string, args *OciArgs) []string {
+	cmdArgs := []string{"run", "--bundle", bundle}
+	if args.PidFile != "" {
+		cmdArgs = append(cmdArgs, "--pid-file", args.PidFile)
+	}
+	return append(cmdArgs, containerID)
+}
+
+func runtimeDelete(runtime string, containerID string) error {
+	state, err := runtimeState(runtime, containerID)
+	if err != nil {
+		return err
+	}
+	if err := runRuntime(runtime, "delete", containerID); err != nil {
+		return err
+	}
+	if err := stopConsole(runtimeConsoleDir(runtime, containerID)); err != nil {
+		sylog.Warningf("failed to stop %s console holder: %s", containerID, err)
+	}
+	if filepath.Dir(state.Bundle) == imageBundleDir {
+		if err := OciUmount(state.Bundle); err != nil {
+			sylog.Warningf("failed to delete bundle %s: %s", state.Bundle, err)
+		}
+	}
+	return nil
+}
+
+// runtimeKill sends the signal to the container, if a timeout is set
+// the container is killed with SIGKILL if it's still running once
+// timeout expired
+func runtimeKill(runtime string, containerID string, killSignal string, killTimeout int, all bool) error {
+	if err := runRuntime(runtime, runtimeKillArgs(containerID, killSignal, all)...); err != nil {
+		return err
+	}
+	if killTimeout <= 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(time.Duration(killTimeout) * time.Second)
+	for time.Now().Before(deadline) {
+		state, err := runtimeState(runtime, containerID)
+		if err != nil || state.Status == ociruntime.Stopped {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	sylog.Verbosef("Container %s still running after %d seconds, killing it", containerID, killTimeout)
+	return runRuntime(runtime, runtimeKillArgs(containerID, "SIGKILL", all)...)
+}
+
+// runtimeKillArgs returns the external runtime kill arguments, the
+// signal defaults to SIGTERM
+func runtimeKillArgs(containerID string, killSignal string, all bool) []string {
+	if killSignal == "" {
+		killSignal = "SIGTERM"
+	}
+	cmdArgs := []string{"kill"}
+	if all {
+		cmdArgs = append(cmdArgs, "--all")
+	}
+	return append(cmdArgs, containerID, killSignal)
+}
+
+func runtimeExec(runtime string, containerID string, cmdArgs []string, args *OciArgs) error {
+	execArgs, err := runtimeExecArgs(containerID, cmdArgs, args, terminal.IsTerminal(int(os.Stdin.Fd())))
+	if err != nil {
+		return err
+	}
+
+	err = runtimeCommand(runtime, execArgs...).Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			os.Exit(status.ExitStatus())
+		}
+	}
+	return err
+}
+
+// runtimeExecArgs returns the external runtime exec arguments, the
+// environment files are passed as variables
+func runtimeExecArgs(containerID string, cmdArgs []string, args *OciArgs, tty bool) ([]string, error) {
+	execArgs := []string{"exec"}
+
+	if tty {
+		execArgs = append(execArgs, "--tty")
+	}
+	if len(args.EnvFiles) > 0 {
+		environ, err := env.MergeFiles(nil, args.EnvFiles)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range environ {
+			execArgs = append(execArgs, "--env", e)
+		}
+	}
+	execArgs = append(execArgs, containerID)
+	return append(execArgs, cmdArgs...), nil
+}
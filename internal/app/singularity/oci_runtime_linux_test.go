@@ -0,0 +1,236 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config/oci"
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestCheckRuntimeArgs(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		name     string
+		args     OciArgs
+		expected string
+	}{
+		{"defaults", OciArgs{HooksDirs: oci.DefaultHooksDirs}, ""},
+		{"pid file", OciArgs{HooksDirs: oci.DefaultHooksDirs, PidFile: "/pid"}, ""},
+		{"image env file", OciArgs{HooksDirs: oci.DefaultHooksDirs, Image: "image.sif", EnvFiles: []string{"env"}}, ""},
+		{"bundle env file", OciArgs{HooksDirs: oci.DefaultHooksDirs, EnvFiles: []string{"env"}}, "--env-file not supported with OCI runtime runc"},
+		{"hooks dirs", OciArgs{HooksDirs: []string{"/hooks"}}, "--hooks-dir not supported with OCI runtime runc"},
+		{
+			"sorted options",
+			OciArgs{HooksDirs: oci.DefaultHooksDirs, StopTimeout: 10, LogPath: "/log", DryRun: true, TmpPolicy: []string{"tmpfs"}},
+			"--dry-run, --log-path, --stop-timeout, --tmp-policy not supported with OCI runtime runc",
+		},
+	}
+	for _, tt := range tests {
+		err := checkRuntimeArgs("runc", &tt.args)
+		if tt.expected == "" && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if tt.expected != "" && (err == nil || err.Error() != tt.expected) {
+			t.Errorf("%s: unexpected error %v, expected %q", tt.name, err, tt.expected)
+		}
+	}
+}
+
+func TestRuntimeArgs(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	root := filepath.Join(buildcfg.RUNSTATEDIR, "singularity", "runtime", "crun")
+	if args := runtimeArgs("/usr/bin/crun", "state", "c"); !reflect.DeepEqual(args, []string{"--root", root, "state", "c"}) {
+		t.Errorf("unexpected runtime arguments %q", args)
+	}
+
+	args := &OciArgs{}
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{"create", runtimeCreateArgs("c", "/bundle", "", args), []string{"create", "--bundle", "/bundle", "c"}},
+		{
+			"create console",
+			runtimeCreateArgs("c", "/bundle", "/console.sock", &OciArgs{PidFile: "/pid"}),
+			[]string{"create", "--bundle", "/bundle", "--console-socket", "/console.sock", "--pid-file", "/pid", "c"},
+		},
+		{"run", runtimeRunArgs("c", "/bundle", &OciArgs{PidFile: "/pid"}), []string{"run", "--bundle", "/bundle", "--pid-file", "/pid", "c"}},
+		{"kill default", runtimeKillArgs("c", "", false), []string{"kill", "c", "SIGTERM"}},
+		{"kill all", runtimeKillArgs("c", "SIGUSR1", true), []string{"kill", "--all", "c", "SIGUSR1"}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.args, tt.expected) {
+			t.Errorf("%s: unexpected arguments %q, expected %q", tt.name, tt.args, tt.expected)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "runtime-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	envFile := filepath.Join(dir, "env")
+	if err := ioutil.WriteFile(envFile, []byte("A=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	execArgs, err := runtimeExecArgs("c", []string{"ls", "-l"}, &OciArgs{EnvFiles: []string{envFile}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"exec", "--tty", "--env", "A=1", "c", "ls", "-l"}
+	if !reflect.DeepEqual(execArgs, expected) {
+		t.Errorf("unexpected exec arguments %q, expected %q", execArgs, expected)
+	}
+	if _, err := runtimeExecArgs("c", []string{"ls"}, &OciArgs{EnvFiles: []string{filepath.Join(dir, "missing")}}, false); err == nil {
+		t.Errorf("unexpected success with a missing environment file")
+	}
+}
+
+func TestBundleTerminal(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "bundle-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := bundleTerminal(dir); err == nil {
+		t.Errorf("unexpected success without configuration")
+	}
+
+	config := filepath.Join(dir, "config.json")
+	for data, expected := range map[string]bool{
+		`{"process":{"terminal":true}}`: true,
+		`{"process":{}}`:                false,
+		`{}`:                            false,
+	} {
+		if err := ioutil.WriteFile(config, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		terminal, err := bundleTerminal(dir)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %s", data, err)
+		} else if terminal != expected {
+			t.Errorf("unexpected terminal %v for %s", terminal, data)
+		}
+	}
+}
+
+func TestConsoleTransfer(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socket")
+		c, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		conns[i] = c.(*net.UnixConn)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := sendConsole(conns[0], w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	console, err := recvConsole(conns[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := console.Write([]byte("console")); err != nil {
+		t.Fatalf("failed to write to received console: %s", err)
+	}
+	console.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "console" {
+		t.Errorf("unexpected data %q read from console", data)
+	}
+
+	// no descriptor sent
+	conns[0].Write([]byte{0})
+	if _, err := recvConsole(conns[1]); err == nil {
+		t.Errorf("unexpected success without descriptor")
+	}
+}
+
+func TestRuntimeRunExitCode(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "runtime-run-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		script   string
+		exitCode int
+		wantErr  bool
+	}{
+		{"Success", "#!/bin/sh\nexit 0\n", 0, false},
+		{"ExitCode", "#!/bin/sh\nexit 3\n", 3, false},
+		{"MissingRuntime", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := filepath.Join(dir, tt.name)
+			if tt.script != "" {
+				if err := ioutil.WriteFile(runtime, []byte(tt.script), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			args := &OciArgs{HooksDirs: oci.DefaultHooksDirs, BundlePath: dir}
+			exitCode, err := runtimeRun(runtime, "c", args)
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if exitCode != tt.exitCode {
+				t.Errorf("unexpected exit code %d instead of %d", exitCode, tt.exitCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	imageSpecs "github.com/opencontainers/image-spec/specs-go/v1"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/ocibundle/tools"
+)
+
+// OciSpec writes a default config.json in the bundle directory, or in
+// the current directory if none was specified
+func OciSpec(args *OciArgs) error {
+	bundle := args.BundlePath
+	if bundle == "" {
+		bundle = "."
+	}
+	path := tools.Config(bundle).Path()
+
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists, remove it first", path)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to check %s: %s", path, err)
+	}
+
+	g, err := generate.New(runtime.GOOS)
+	if err != nil {
+		return fmt.Errorf("failed to generate OCI config: %s", err)
+	}
+	g.SetRootPath(filepath.Base(tools.RootFs(bundle).Path()))
+	g.SetProcessTerminal(true)
+
+	if args.FromImage != "" {
+		if err := specFromImage(&g, args.FromImage); err != nil {
+			return err
+		}
+	}
+	if args.CgroupNamespace {
+		g.AddOrReplaceLinuxNamespace(string(specs.CgroupNamespace), "")
+	}
+	if args.Rootless {
+		rootlessSpec(&g)
+	}
+
+	if err := g.SaveToFile(path, generate.ExportOptions{}); err != nil {
+		return fmt.Errorf("failed to write %s: %s", path, err)
+	}
+	return nil
+}
+
+// specFromImage sets the process arguments, working directory, environment
+// and user from the OCI image configuration stored in a SIF image, the
+// image runscript is used as process if there is none
+func specFromImage(g *generate.Generator, path string) error {
+	img, err := image.Init(path, false)
+	if err != nil {
+		return fmt.Errorf("failed to open image %s: %s", path, err)
+	}
+	defer img.File.Close()
+
+	if img.Type != image.SIF {
+		return fmt.Errorf("%s is not a SIF image", path)
+	}
+
+	g.SetProcessArgs([]string{tools.RunScript})
+
+	reader, err := image.NewSectionReader(img, "oci-config.json", -1)
+	if err == image.ErrNoSection {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read oci-config.json section: %s", err)
+	}
+
+	var imgConfig imageSpecs.ImageConfig
+
+	if err := json.NewDecoder(reader).Decode(&imgConfig); err != nil {
+		return fmt.Errorf("failed to decode oci-config.json: %s", err)
+	}
+
+	if args := append(imgConfig.Entrypoint, imgConfig.Cmd...); len(args) > 0 {
+		g.SetProcessArgs(args)
+	}
+	if imgConfig.WorkingDir != "" {
+		g.SetProcessCwd(imgConfig.WorkingDir)
+	}
+	for _, e := range imgConfig.Env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			g.AddProcessEnv(kv[0], kv[1])
+		}
+	}
+
+	if imgConfig.User != "" {
+		ids := strings.SplitN(imgConfig.User, ":", 2)
+		uid, err := strconv.ParseUint(ids[0], 10, 32)
+		if err != nil {
+			sylog.Warningf("Ignoring image user %s, only numeric IDs are supported", imgConfig.User)
+			return nil
+		}
+		g.SetProcessUID(uint32(uid))
+		if len(ids) == 2 {
+			gid, err := strconv.ParseUint(ids[1], 10, 32)
+			if err != nil {
+				sylog.Warningf("Ignoring image group %s, only numeric IDs are supported", ids[1])
+				return nil
+			}
+			g.SetProcessGID(uint32(gid))
+		}
+	}
+
+	return nil
+}
+
+// rootlessSpec adjusts the specification to run without privileges: the
+// current user is mapped to root in a user namespace, the network
+// namespace and cgroups resources are removed as they can't be set up
+// by an unprivileged user, /sys is bind mounted read-only and gid mount
+// options are dropped as only the mapped group exists
+func rootlessSpec(g *generate.Generator) {
+	g.RemoveLinuxNamespace(string(specs.NetworkNamespace))
+	g.AddOrReplaceLinuxNamespace(string(specs.UserNamespace), "")
+	g.AddLinuxUIDMapping(uint32(os.Getuid()), 0, 1)
+	g.AddLinuxGIDMapping(uint32(os.Getgid()), 0, 1)
+
+	mounts := g.Mounts()
+	g.ClearMounts()
+
+	for _, m := range mounts {
+		if m.Destination == "/sys" {
+			m.Type = "none"
+			m.Source = "/sys"
+			m.Options = []string{"rbind", "nosuid", "noexec", "nodev", "ro"}
+		} else {
+			options := make([]string, 0, len(m.Options))
+			for _, o := range m.Options {
+				if !strings.HasPrefix(o, "gid=") {
+					options = append(options, o)
+				}
+			}
+			m.Options = options
+		}
+		g.AddMount(m)
+	}
+
+	if g.Config.Linux != nil {
+		g.Config.Linux.Resources = nil
+	}
+}
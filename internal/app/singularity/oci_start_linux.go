@@ -11,15 +11,21 @@ import (
 	"io"
 
 	"github.com/sylabs/singularity/pkg/ociruntime"
-	"github.com/sylabs/singularity/pkg/util/unix"
 )
 
 // OciStart starts a previously create container
 func OciStart(containerID string) error {
-	state, err := getState(containerID)
+	if runtime, err := externalRuntime(); err != nil {
+		return err
+	} else if runtime != "" {
+		return runRuntime(runtime, "start", containerID)
+	}
+
+	engineConfig, err := getEngineConfig(containerID)
 	if err != nil {
 		return err
 	}
+	state := engineConfig.GetState()
 
 	if state.Status != ociruntime.Created {
 		return fmt.Errorf("cannot start '%s', the state of the container must be %s", containerID, ociruntime.Created)
@@ -29,12 +35,16 @@ func OciStart(containerID string) error {
 		return fmt.Errorf("can't find control socket")
 	}
 
-	ctrl := &ociruntime.Control{}
+	if err := checkControl(engineConfig, ociruntime.ControlStartContainer); err != nil {
+		return err
+	}
+
+	ctrl := &ociruntime.Control{Version: ociruntime.ControlVersion}
 	ctrl.StartContainer = true
 
-	c, err := unix.Dial(state.ControlSocket)
+	c, err := dialSocket(engineConfig, state.ControlSocket)
 	if err != nil {
-		return fmt.Errorf("failed to connect to control socket")
+		return fmt.Errorf("failed to connect to control socket: %s", err)
 	}
 	defer c.Close()
 
@@ -14,6 +14,12 @@ import (
 
 // OciState query container state
 func OciState(containerID string, args *OciArgs) error {
+	if runtime, err := externalRuntime(); err != nil {
+		return err
+	} else if runtime != "" {
+		return runRuntime(runtime, "state", containerID)
+	}
+
 	// query instance files and returns state
 	state, err := getState(containerID)
 	if err != nil {
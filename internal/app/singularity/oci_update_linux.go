@@ -19,6 +19,15 @@ import (
 
 // OciUpdate updates container cgroups resources
 func OciUpdate(containerID string, args *OciArgs) error {
+	if runtime, err := externalRuntime(); err != nil {
+		return err
+	} else if runtime != "" {
+		if args.FromFile == "" {
+			return fmt.Errorf("you must specify --from-file")
+		}
+		return runRuntime(runtime, "update", "--resources", args.FromFile, containerID)
+	}
+
 	var reader io.Reader
 
 	state, err := getState(containerID)
@@ -0,0 +1,78 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+// stoppedExitCode returns the exit code of a stopped container
+func stoppedExitCode(containerID string) (int, error) {
+	state, err := getState(containerID)
+	if err != nil {
+		return 0, err
+	}
+	if state.Status != ociruntime.Stopped {
+		return 0, fmt.Errorf("container %s is %s", containerID, state.Status)
+	}
+	if state.ExitCode == nil {
+		return 0, fmt.Errorf("no exit code available for container %s", containerID)
+	}
+	return *state.ExitCode, nil
+}
+
+// OciWait blocks until the container is stopped and returns its exit code
+func OciWait(containerID string) (int, error) {
+	if runtime, err := externalRuntime(); err != nil {
+		return 0, err
+	} else if runtime != "" {
+		return 0, fmt.Errorf("wait is not supported with OCI runtime %s", runtime)
+	}
+
+	engineConfig, err := getEngineConfig(containerID)
+	if err != nil {
+		return 0, err
+	}
+	state := engineConfig.GetState()
+
+	if state.Status == ociruntime.Stopped {
+		return stoppedExitCode(containerID)
+	}
+	if state.ControlSocket == "" {
+		return 0, fmt.Errorf("can't find control socket")
+	}
+	if err := checkControl(engineConfig, ociruntime.ControlWait); err != nil {
+		return 0, err
+	}
+
+	c, err := dialSocket(engineConfig, state.ControlSocket)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to control socket: %s", err)
+	}
+	defer c.Close()
+
+	ctrl := &ociruntime.Control{
+		Version: ociruntime.ControlVersion,
+		Wait:    true,
+	}
+	if err := json.NewEncoder(c).Encode(ctrl); err != nil {
+		return 0, err
+	}
+
+	exit := &ociruntime.ControlExit{}
+	if err := json.NewDecoder(c).Decode(exit); err == io.EOF {
+		// the engine exited without reply, the exit code
+		// is then taken from the stopped state
+		return stoppedExitCode(containerID)
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read container exit code: %s", err)
+	}
+	return exit.ExitCode, nil
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/internal/pkg/pool"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// PoolImport imports the SIF image at path into the storage pool in
+// directory dir under name, the image file name is used if name is empty
+func PoolImport(dir, name, path string) error {
+	p, err := pool.New(dir)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = filepath.Base(path)
+	}
+
+	img, added, err := p.Import(name, path)
+	if err != nil {
+		return err
+	}
+
+	sylog.Infof("Imported %s as %s: %s, %s added to the pool", path, name, findSize(img.Size), findSize(added))
+	fmt.Println(img.Digest)
+	return nil
+}
+
+// PoolExport exports the image stored under name in the storage pool in
+// directory dir at path
+func PoolExport(dir, name, path string) error {
+	p, err := pool.New(dir)
+	if err != nil {
+		return err
+	}
+	if err := p.Export(name, path); err != nil {
+		return err
+	}
+	sylog.Infof("Exported %s to %s", name, path)
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/registry"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// registryShutdownTimeout bounds the time left to requests in progress
+// when the registry stops
+const registryShutdownTimeout = 10 * time.Second
+
+// registry server timeouts, reading and writing a request bound the
+// transfer time of a blob
+const (
+	registryReadHeaderTimeout = 30 * time.Second
+	registryReadTimeout       = 30 * time.Minute
+	registryWriteTimeout      = 30 * time.Minute
+	registryIdleTimeout       = 2 * time.Minute
+)
+
+// RegistryServeConfig holds the options of a registry server
+type RegistryServeConfig struct {
+	// Dir is the directory storing the repositories
+	Dir string
+	// Address is the address the server listens on, a loopback address
+	// is required without Htpasswd
+	Address string
+	// Htpasswd is the htpasswd file of the users allowed to push and
+	// pull, no authentication is required when empty
+	Htpasswd string
+	// TLSCert and TLSKey are the certificate and private key files of
+	// the server, HTTP is served when empty
+	TLSCert string
+	TLSKey  string
+}
+
+// RegistryServe serves the images of c.Dir with the OCI distribution API
+// until it receives SIGINT or SIGTERM
+func RegistryServe(c RegistryServeConfig) error {
+	if c.Htpasswd == "" && !isLoopbackAddress(c.Address) {
+		return fmt.Errorf("listening on %s requires authentication with --htpasswd, only loopback addresses are served without", c.Address)
+	}
+
+	storage, err := registry.NewStorage(c.Dir)
+	if err != nil {
+		return err
+	}
+	handler := &registry.Handler{Storage: storage}
+
+	if c.Htpasswd != "" {
+		handler.Users, err = registry.ReadUsersFile(c.Htpasswd)
+		if err != nil {
+			return fmt.Errorf("could not read users: %s", err)
+		}
+		if c.TLSCert == "" {
+			sylog.Warningf("Passwords are sent in clear text without --tls-cert")
+		}
+	}
+
+	ln, err := net.Listen("tcp", c.Address)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: registryReadHeaderTimeout,
+		ReadTimeout:       registryReadTimeout,
+		WriteTimeout:      registryWriteTimeout,
+		IdleTimeout:       registryIdleTimeout,
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	done := make(chan error, 1)
+	go func() {
+		if c.TLSCert != "" {
+			done <- srv.ServeTLS(ln, c.TLSCert, c.TLSKey)
+		} else {
+			done <- srv.Serve(ln)
+		}
+	}()
+
+	scheme := "http"
+	if c.TLSCert != "" {
+		scheme = "https"
+	}
+	sylog.Infof("Serving %s at %s://%s", c.Dir, scheme, ln.Addr())
+
+	select {
+	case err := <-done:
+		return err
+	case s := <-sig:
+		sylog.Infof("Received %s, stopping registry", s)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), registryShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// isLoopbackAddress returns if the host of the listen address resolves
+// to loopback addresses only, an empty host listens on all interfaces
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return false
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import "testing"
+
+func TestIsLoopbackAddress(t *testing.T) {
+	for address, loopback := range map[string]bool{
+		"127.0.0.1:5000": true,
+		"[::1]:5000":     true,
+		"localhost:5000": true,
+		":5000":          false,
+		"0.0.0.0:5000":   false,
+		"10.0.0.1:5000":  false,
+		"127.0.0.1":      false,
+	} {
+		if isLoopbackAddress(address) != loopback {
+			t.Errorf("%s: expected loopback %v", address, loopback)
+		}
+	}
+}
+
+func TestRegistryServeRequiresAuthentication(t *testing.T) {
+	c := RegistryServeConfig{Dir: "/nonexistent", Address: "0.0.0.0:0"}
+	if err := RegistryServe(c); err == nil {
+		t.Errorf("unexpected success serving a non loopback address without authentication")
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+)
+
+// SifClone duplicates the SIF image src to dst, an existing dst is only
+// overwritten when force is set
+func SifClone(src, dst string, force bool) error {
+	fimg, err := sif.LoadContainer(src, true)
+	if err != nil {
+		return fmt.Errorf("failed to load SIF image %s: %s", src, err)
+	}
+	fimg.UnloadContainer()
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if dfi, err := os.Stat(dst); err == nil {
+		// dst resolving to src, through symbolic or hard links,
+		// would truncate the image before it's copied
+		if os.SameFile(fi, dfi) {
+			return fmt.Errorf("%s and %s are the same image file", src, dst)
+		}
+		if !force {
+			return fmt.Errorf("image file %s already exists, use --force to overwrite it", dst)
+		}
+	}
+	return fs.CopyFile(src, dst, fi.Mode().Perm())
+}
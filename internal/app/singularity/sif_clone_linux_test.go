@@ -0,0 +1,108 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestSifClone(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "sif-clone-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := []byte("bootstrap: scratch\n")
+	src := filepath.Join(dir, "image.sif")
+	cinfo := sif.CreateInfo{
+		Pathname:   src,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{
+			{
+				Datatype: sif.DataDeffile,
+				Groupid:  sif.DescrDefaultGroup,
+				Link:     sif.DescrUnusedLink,
+				Data:     data,
+				Size:     int64(len(data)),
+			},
+		},
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	symlink := filepath.Join(dir, "symlink.sif")
+	if err := os.Symlink(src, symlink); err != nil {
+		t.Fatal(err)
+	}
+	hardlink := filepath.Join(dir, "hardlink.sif")
+	if err := os.Link(src, hardlink); err != nil {
+		t.Fatal(err)
+	}
+	existing := filepath.Join(dir, "existing.sif")
+	if err := ioutil.WriteFile(existing, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dst     string
+		force   bool
+		wantErr bool
+	}{
+		{"Clone", filepath.Join(dir, "clone.sif"), false, false},
+		{"SamePath", src, true, true},
+		{"RelativePath", filepath.Join(dir, ".", "..", filepath.Base(dir), "image.sif"), true, true},
+		{"Symlink", symlink, true, true},
+		{"Hardlink", hardlink, true, true},
+		{"Existing", existing, false, true},
+		{"ExistingForce", existing, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SifClone(src, tt.dst, tt.force)
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			// the source image must be left untouched
+			b, err := ioutil.ReadFile(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, content) {
+				t.Fatalf("source image modified")
+			}
+			if tt.wantErr {
+				return
+			}
+			if b, err := ioutil.ReadFile(tt.dst); err != nil || !bytes.Equal(b, content) {
+				t.Errorf("unexpected clone content: %s", err)
+			}
+		})
+	}
+}
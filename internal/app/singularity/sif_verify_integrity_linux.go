@@ -0,0 +1,54 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+
+	"github.com/sylabs/singularity/internal/pkg/sifcheck"
+)
+
+// SifVerifyIntegrity checks the integrity of the SIF image at path and
+// prints the checks done and problems found, recoverable problems are
+// repaired when repair is set
+func SifVerifyIntegrity(path string, repair bool) error {
+	var r *sifcheck.Report
+	var err error
+
+	if repair {
+		r, err = sifcheck.Repair(path)
+	} else {
+		r, err = sifcheck.Check(path)
+	}
+	if r == nil {
+		return err
+	}
+
+	for _, c := range r.Checks {
+		fmt.Printf("Checked %s\n", c)
+	}
+	for _, p := range r.Problems {
+		if p.Repairable {
+			fmt.Printf("Problem: %s (repairable)\n", p.Description)
+		} else {
+			fmt.Printf("Problem: %s\n", p.Description)
+		}
+	}
+
+	switch {
+	case err != nil:
+		return err
+	case len(r.Problems) == 0:
+		fmt.Printf("No problems found\n")
+	case repair:
+		fmt.Printf("Repaired %d problems\n", len(r.Problems))
+	case r.Repairable():
+		return fmt.Errorf("%d problems found, use --repair to repair them", len(r.Problems))
+	default:
+		return fmt.Errorf("%d problems found", len(r.Problems))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/transfer"
+)
+
+// TransfersList writes the background pulls of the current user to w,
+// in JSON format, one per line, if jsonFormat is set
+func TransfersList(w io.Writer, jsonFormat bool) error {
+	q, err := transfer.DefaultQueue()
+	if err != nil {
+		return fmt.Errorf("could not determine transfer queue: %s", err)
+	}
+	transfers, err := q.List()
+	if err != nil {
+		return err
+	}
+
+	if jsonFormat {
+		for _, t := range transfers {
+			// the environment may hold credentials
+			t.Env = nil
+			b, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintln(w, string(b)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATE\tELAPSED\tSOURCE\tDESTINATION\tDETAILS")
+	for _, t := range transfers {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.State, elapsed(t), t.Source, t.Dest, transferDetails(q, t))
+	}
+	return tw.Flush()
+}
+
+// TransfersClean removes the completed background pulls of the current
+// user and returns how many were removed
+func TransfersClean() (int, error) {
+	q, err := transfer.DefaultQueue()
+	if err != nil {
+		return 0, fmt.Errorf("could not determine transfer queue: %s", err)
+	}
+	return q.Clean()
+}
+
+func elapsed(t *transfer.Transfer) string {
+	switch t.State {
+	case transfer.Running:
+		return time.Since(t.Started).Round(time.Second).String()
+	case transfer.Done, transfer.Failed:
+		if !t.Started.IsZero() {
+			return t.Finished.Sub(t.Started).Round(time.Second).String()
+		}
+	}
+	return "-"
+}
+
+func transferDetails(q *transfer.Queue, t *transfer.Transfer) string {
+	switch t.State {
+	case transfer.Running:
+		return q.Progress(t)
+	case transfer.Failed:
+		return t.Error
+	}
+	return ""
+}
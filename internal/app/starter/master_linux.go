@@ -18,6 +18,7 @@ import (
 
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/exitcode"
 )
 
 // Master initializes a runtime engine and runs it
@@ -144,6 +145,26 @@ func Master(rpcSocket, masterSocket int, isInstance bool, containerPid int, engi
 		sylog.Fatalf("%s", fatal)
 	}
 
+	// engines monitoring the container cgroup report out of memory
+	// kills, the container process is either killed directly or through
+	// the init process exit status
+	if obj, ok := engine.EngineOperations.(interface {
+		OOMKilled() bool
+	}); ok && !isInstance && obj.OOMKilled() {
+		killed := status.Signaled() && status.Signal() == syscall.SIGKILL
+		if killed || status.ExitStatus() == 128+int(syscall.SIGKILL) {
+			sylog.Errorf("Container process was killed by the out of memory killer")
+			os.Exit(exitcode.OOMKilled)
+		}
+	}
+
+	if obj, ok := engine.EngineOperations.(interface {
+		TimedOut() bool
+	}); ok && !isInstance && obj.TimedOut() {
+		sylog.Errorf("Container process was stopped after exceeding its execution timeout")
+		os.Exit(exitcode.TimedOut)
+	}
+
 	if status.Signaled() {
 		sylog.Debugf("Child exited due to signal %d", status.Signal())
 		if isInstance && os.Getppid() == ppid {
@@ -12,6 +12,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines"
 	sarterConfig "github.com/sylabs/singularity/internal/pkg/runtime/engines/config/starter"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/errctx"
 )
 
 // Stage performs container startup.
@@ -34,7 +35,7 @@ func Stage(stage, masterSocket int, sconfig *sarterConfig.Config, engine *engine
 	if stage == 1 {
 		sylog.Debugf("Entering stage 1\n")
 		if err := engine.PrepareConfig(sconfig); err != nil {
-			sylog.Fatalf("%s\n", err)
+			errctx.Fatal(err)
 		}
 		if err := sconfig.Write(engine.Common); err != nil {
 			sylog.Fatalf("%s", err)
@@ -48,7 +49,7 @@ func Stage(stage, masterSocket int, sconfig *sarterConfig.Config, engine *engine
 			if _, err := conn.Write([]byte("f")); err != nil {
 				sylog.Errorf("fail to send data to master: %s", err)
 			}
-			sylog.Fatalf("%s\n", err)
+			errctx.Fatal(err)
 		}
 	}
 }
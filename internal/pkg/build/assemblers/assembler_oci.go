@@ -0,0 +1,328 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containers/image/copy"
+	"github.com/containers/image/docker"
+	ociarchive "github.com/containers/image/oci/archive"
+	oci "github.com/containers/image/oci/layout"
+	"github.com/containers/image/signature"
+	"github.com/containers/image/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	sytypes "github.com/sylabs/singularity/pkg/build/types"
+)
+
+const (
+	// OCIArchivePrefix is the prefix of build destinations written as
+	// OCI archives
+	OCIArchivePrefix = "oci-archive:"
+	// DockerPrefix is the prefix of build destinations pushed to a
+	// docker registry
+	DockerPrefix = "docker://"
+)
+
+// IsOCIDestination returns true if the build destination dest is an
+// OCI archive or a docker registry reference
+func IsOCIDestination(dest string) bool {
+	return strings.HasPrefix(dest, OCIArchivePrefix) || strings.HasPrefix(dest, DockerPrefix)
+}
+
+// OCIAssembler doesnt store anything
+type OCIAssembler struct {
+}
+
+// Assemble creates a single layer OCI image from a Bundle and writes it
+// to an OCI archive or pushes it to a docker registry
+func (a *OCIAssembler) Assemble(b *sytypes.Bundle, path string) error {
+	sylog.Infof("Creating OCI image...")
+
+	var destRef types.ImageReference
+	var err error
+
+	switch {
+	case strings.HasPrefix(path, OCIArchivePrefix):
+		archive := strings.TrimPrefix(path, OCIArchivePrefix)
+		// remove anything that may exist at the build destination
+		os.RemoveAll(strings.SplitN(archive, ":", 2)[0])
+		destRef, err = ociarchive.ParseReference(archive)
+	case strings.HasPrefix(path, DockerPrefix):
+		destRef, err = docker.ParseReference(strings.TrimPrefix(path, "docker:"))
+	default:
+		return fmt.Errorf("unsupported OCI destination %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("While parsing destination %s: %v", path, err)
+	}
+
+	layout := filepath.Join(b.Path, "oci-image")
+	if err := writeOCILayout(b, layout); err != nil {
+		return fmt.Errorf("While creating OCI image: %v", err)
+	}
+	defer os.RemoveAll(layout)
+
+	srcRef, err := oci.ParseReference(layout + ":latest")
+	if err != nil {
+		return fmt.Errorf("While parsing OCI layout reference: %v", err)
+	}
+
+	policy := &signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}}
+	policyCtx, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return err
+	}
+	defer policyCtx.Destroy()
+
+	sysCtx := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: b.Opts.NoHTTPS,
+		DockerAuthConfig:            b.Opts.DockerAuthConfig,
+	}
+
+	err = copy.Image(context.Background(), policyCtx, destRef, srcRef, &copy.Options{
+		ReportWriter:   ioutil.Discard,
+		DestinationCtx: sysCtx,
+	})
+	if err != nil {
+		return fmt.Errorf("While writing OCI image to %s: %v", path, err)
+	}
+	return nil
+}
+
+// writeOCILayout writes the root filesystem of bundle b as the only
+// layer of an image tagged latest in the OCI layout directory dir
+func writeOCILayout(b *sytypes.Bundle, dir string) error {
+	blobs := filepath.Join(dir, "blobs", string(digest.SHA256))
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		return err
+	}
+
+	layer, diffID, err := writeLayer(b.Rootfs(), blobs)
+	if err != nil {
+		return fmt.Errorf("while creating layer: %s", err)
+	}
+
+	created := time.Now().UTC()
+	if b.Opts.Reproducible {
+		created = time.Unix(b.Opts.SourceDateEpoch, 0).UTC()
+	}
+	arch := runtime.GOARCH
+	if b.Arch != "" {
+		arch = b.Arch
+	}
+
+	imgConfig, err := ociImageConfig(b)
+	if err != nil {
+		return err
+	}
+	img := imgspecv1.Image{
+		Created:      &created,
+		Architecture: arch,
+		OS:           "linux",
+		Config:       imgConfig,
+		RootFS: imgspecv1.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{diffID},
+		},
+	}
+	config, err := writeJSONBlob(blobs, imgspecv1.MediaTypeImageConfig, img)
+	if err != nil {
+		return fmt.Errorf("while writing image configuration: %s", err)
+	}
+
+	manifest := imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		Config:    config,
+		Layers:    []imgspecv1.Descriptor{layer},
+	}
+	desc, err := writeJSONBlob(blobs, imgspecv1.MediaTypeImageManifest, manifest)
+	if err != nil {
+		return fmt.Errorf("while writing image manifest: %s", err)
+	}
+	desc.Annotations = map[string]string{imgspecv1.AnnotationRefName: "latest"}
+
+	index := imgspecv1.Index{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		Manifests: []imgspecv1.Descriptor{desc},
+	}
+	if err := writeJSON(filepath.Join(dir, "index.json"), index); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, imgspecv1.ImageLayoutFile), imgspecv1.ImageLayout{Version: imgspecv1.ImageLayoutVersion})
+}
+
+// ociImageConfig returns the execution parameters of the image, the
+// configuration of OCI bootstrap images is kept and the singularity
+// run action becomes the entrypoint
+func ociImageConfig(b *sytypes.Bundle) (imgspecv1.ImageConfig, error) {
+	var c imgspecv1.ImageConfig
+
+	if conf, ok := b.JSONObjects["oci-config"]; ok {
+		if err := json.Unmarshal(conf, &c); err != nil {
+			return c, fmt.Errorf("while reading OCI configuration: %s", err)
+		}
+	}
+	c.Entrypoint = []string{"/.singularity.d/actions/run"}
+	c.Cmd = nil
+	if len(c.Env) == 0 {
+		c.Env = []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"}
+	}
+
+	labels, err := ioutil.ReadFile(filepath.Join(b.Rootfs(), ".singularity.d", "labels.json"))
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(labels, &c.Labels); err != nil {
+		return c, fmt.Errorf("while reading image labels: %s", err)
+	}
+	return c, nil
+}
+
+// writeLayer writes the gzip compressed tar archive of root in the blob
+// directory blobs, it returns the layer descriptor and the digest of the
+// uncompressed archive
+func writeLayer(root, blobs string) (imgspecv1.Descriptor, digest.Digest, error) {
+	var desc imgspecv1.Descriptor
+
+	f, err := ioutil.TempFile(blobs, "layer-")
+	if err != nil {
+		return desc, "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	blobDigester := digest.SHA256.Digester()
+	gz := gzip.NewWriter(io.MultiWriter(f, blobDigester.Hash()))
+	diffDigester := digest.SHA256.Digester()
+	tw := tar.NewWriter(io.MultiWriter(gz, diffDigester.Hash()))
+
+	if err := tarRootfs(tw, root); err != nil {
+		return desc, "", err
+	}
+	if err := tw.Close(); err != nil {
+		return desc, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return desc, "", err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return desc, "", err
+	}
+	desc = imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageLayerGzip,
+		Digest:    blobDigester.Digest(),
+		Size:      fi.Size(),
+	}
+	if err := os.Rename(f.Name(), filepath.Join(blobs, desc.Digest.Hex())); err != nil {
+		return desc, "", err
+	}
+	return desc, diffDigester.Digest(), nil
+}
+
+// tarRootfs adds the files below root to tw in lexical order, files are
+// owned by root when building as a user
+func tarRootfs(tw *tar.Writer, root string) error {
+	links := make(map[uint64]string)
+	asUser := syscall.Getuid() != 0
+
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return fmt.Errorf("%s: %s", rel, err)
+		}
+		hdr.Name = rel
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if asUser {
+			hdr.Uid, hdr.Gid = 0, 0
+			hdr.Uname, hdr.Gname = "", ""
+		}
+
+		// store hard links once
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok && fi.Mode().IsRegular() && st.Nlink > 1 {
+			if target, ok := links[st.Ino]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = target
+				hdr.Size = 0
+			} else {
+				links[st.Ino] = rel
+			}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// writeJSONBlob writes the JSON encoding of v in the blob directory
+// blobs and returns its descriptor
+func writeJSONBlob(blobs, mediaType string, v interface{}) (imgspecv1.Descriptor, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	desc := imgspecv1.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	return desc, ioutil.WriteFile(filepath.Join(blobs, desc.Digest.Hex()), data, 0644)
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
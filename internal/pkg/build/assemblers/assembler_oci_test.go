@@ -0,0 +1,136 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func readBlob(t *testing.T, dir string, d digest.Digest, v interface{}) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "blobs", string(d.Algorithm()), d.Hex()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != digest.FromBytes(b) {
+		t.Fatalf("blob %s has wrong digest", d)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteOCILayout(t *testing.T) {
+	b, err := types.NewBundle("", "sbuild-oci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(b.Path)
+
+	rootfs := b.Rootfs()
+	if err := os.MkdirAll(filepath.Join(rootfs, ".singularity.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, ".singularity.d", "labels.json"), []byte(`{"maintainer": "me"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(rootfs, "file"), filepath.Join(rootfs, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file", filepath.Join(rootfs, "symlink")); err != nil {
+		t.Fatal(err)
+	}
+	b.JSONObjects["oci-config"] = []byte(`{"Env": ["PATH=/bin"], "Cmd": ["sh"], "WorkingDir": "/work"}`)
+
+	dir := filepath.Join(b.Path, "oci-image")
+	if err := writeOCILayout(b, dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var index imgspecv1.Index
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Annotations[imgspecv1.AnnotationRefName] != "latest" {
+		t.Fatalf("unexpected index: %s", data)
+	}
+
+	var manifest imgspecv1.Manifest
+	readBlob(t, dir, index.Manifests[0].Digest, &manifest)
+	var img imgspecv1.Image
+	readBlob(t, dir, manifest.Config.Digest, &img)
+
+	if !reflect.DeepEqual(img.Config.Entrypoint, []string{"/.singularity.d/actions/run"}) || img.Config.Cmd != nil {
+		t.Errorf("unexpected entrypoint %v and command %v", img.Config.Entrypoint, img.Config.Cmd)
+	}
+	if img.Config.WorkingDir != "/work" || !reflect.DeepEqual(img.Config.Env, []string{"PATH=/bin"}) {
+		t.Errorf("base image configuration not kept: %+v", img.Config)
+	}
+	if img.Config.Labels["maintainer"] != "me" {
+		t.Errorf("unexpected labels %v", img.Config.Labels)
+	}
+	if len(manifest.Layers) != 1 || len(img.RootFS.DiffIDs) != 1 {
+		t.Fatalf("expected a single layer")
+	}
+
+	f, err := os.Open(filepath.Join(dir, "blobs", "sha256", manifest.Layers[0].Digest.Hex()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffDigester := digest.SHA256.Digester()
+	tr := tar.NewReader(io.TeeReader(gz, diffDigester.Hash()))
+
+	entries := make(map[string]*tar.Header)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		entries[hdr.Name] = hdr
+		names = append(names, hdr.Name)
+	}
+	io.Copy(ioutil.Discard, gz)
+
+	want := []string{".singularity.d/", ".singularity.d/labels.json", "file", "link", "symlink"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("unexpected layer content %v", names)
+	}
+	if hdr := entries["link"]; hdr == nil || hdr.Typeflag != tar.TypeLink || hdr.Linkname != "file" {
+		t.Errorf("hard link not preserved")
+	}
+	if hdr := entries["symlink"]; hdr == nil || hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "file" {
+		t.Errorf("symbolic link not preserved")
+	}
+	if diffDigester.Digest() != img.RootFS.DiffIDs[0] {
+		t.Errorf("layer diff ID mismatch")
+	}
+}
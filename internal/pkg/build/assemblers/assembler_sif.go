@@ -24,6 +24,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/image"
 	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
 )
 
@@ -31,7 +32,7 @@ import (
 type SIFAssembler struct {
 }
 
-func createSIF(path string, definition, ociConf []byte, squashfile string) (err error) {
+func createSIF(path string, definition, ociConf, seccompProfile []byte, squashfile, arch string) (err error) {
 	// general info for the new SIF file creation
 	cinfo := sif.CreateInfo{
 		Pathname:   path,
@@ -67,6 +68,20 @@ func createSIF(path string, definition, ociConf []byte, squashfile string) (err
 		cinfo.InputDescr = append(cinfo.InputDescr, ociInput)
 	}
 
+	if len(seccompProfile) > 0 {
+		// seccomp profile applied by default at runtime
+		seccompInput := sif.DescriptorInput{
+			Datatype: sif.DataGenericJSON,
+			Groupid:  sif.DescrDefaultGroup,
+			Link:     sif.DescrUnusedLink,
+			Data:     seccompProfile,
+			Fname:    image.SeccompProfileName,
+		}
+		seccompInput.Size = int64(binary.Size(seccompInput.Data))
+
+		cinfo.InputDescr = append(cinfo.InputDescr, seccompInput)
+	}
+
 	// data we need to create a system partition descriptor
 	parinput := sif.DescriptorInput{
 		Datatype: sif.DataPartition,
@@ -90,7 +105,7 @@ func createSIF(path string, definition, ociConf []byte, squashfile string) (err
 	parinput.Fp = fp
 	parinput.Size = fi.Size()
 
-	err = parinput.SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.GetSIFArch(runtime.GOARCH))
+	err = parinput.SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.GetSIFArch(arch))
 	if err != nil {
 		return
 	}
@@ -116,13 +131,7 @@ func createSIF(path string, definition, ociConf []byte, squashfile string) (err
 	return nil
 }
 
-func getMksquashfsPath() (string, error) {
-	// Parse singularity configuration file
-	c := &singularityConfig.FileConfig{}
-	if err := config.Parser(buildcfg.SYSCONFDIR+"/singularity/singularity.conf", c); err != nil {
-		return "", fmt.Errorf("Unable to parse singularity.conf file: %s", err)
-	}
-
+func getMksquashfsPath(c *singularityConfig.FileConfig) (string, error) {
 	// p is either "" or the string value in the conf file
 	p := c.MksquashfsPath
 
@@ -139,7 +148,13 @@ func getMksquashfsPath() (string, error) {
 func (a *SIFAssembler) Assemble(b *types.Bundle, path string) (err error) {
 	sylog.Infof("Creating SIF file...")
 
-	mksquashfs, err := getMksquashfsPath()
+	// Parse singularity configuration file
+	c := &singularityConfig.FileConfig{}
+	if err := config.Parser(buildcfg.SYSCONFDIR+"/singularity/singularity.conf", c); err != nil {
+		return fmt.Errorf("Unable to parse singularity.conf file: %s", err)
+	}
+
+	mksquashfs, err := getMksquashfsPath(c)
 	if err != nil {
 		return fmt.Errorf("While searching for mksquashfs: %v", err)
 	}
@@ -151,14 +166,73 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) (err error) {
 	os.Remove(squashfsPath)
 	defer os.Remove(squashfsPath)
 
-	args := []string{b.Rootfs(), squashfsPath, "-noappend"}
+	opts, tuning, err := mksquashfsOptions(c, b.Opts)
+	if err != nil {
+		return fmt.Errorf("While setting mksquashfs options: %v", err)
+	}
 
 	// build squashfs with all-root flag when building as a user
 	if syscall.Getuid() != 0 {
-		args = append(args, "-all-root")
+		opts = append(opts, "-all-root")
 	}
 
+	if b.Opts.Compression != "" {
+		opts = append(opts, "-comp", b.Opts.Compression)
+	}
+
+	if incremental(b) {
+		err = assembleIncremental(b, mksquashfs, squashfsPath, opts, tuning)
+	} else {
+		var env []string
+		if b.Opts.Reproducible {
+			// mksquashfs sorts directory entries by name, only the
+			// creation time must be fixed
+			env = append(os.Environ(), fmt.Sprintf("SOURCE_DATE_EPOCH=%d", b.Opts.SourceDateEpoch))
+		}
+		args := append([]string{b.Rootfs(), squashfsPath, "-noappend"}, opts...)
+		args = append(args, tuning...)
+		err = runMksquashfs(mksquashfs, args, env)
+	}
+	if err != nil {
+		return err
+	}
+
+	if b.Opts.Reproducible {
+		if err := setSquashfsTime(squashfsPath, b.Opts.SourceDateEpoch); err != nil {
+			return fmt.Errorf("While setting squashfs creation time: %v", err)
+		}
+	}
+
+	// record the architecture of images bootstrapped for another platform
+	arch := runtime.GOARCH
+	if b.Arch != "" {
+		arch = b.Arch
+	}
+
+	err = createSIF(path, b.Recipe.Raw, b.JSONObjects["oci-config"], b.JSONObjects["seccomp"], squashfsPath, arch)
+	if err != nil {
+		return fmt.Errorf("While creating SIF: %v", err)
+	}
+
+	if b.Opts.Reproducible {
+		digest, err := normalizeSIF(path, b.Opts.SourceDateEpoch)
+		if err != nil {
+			return fmt.Errorf("While normalizing SIF: %v", err)
+		}
+		sylog.Infof("Image digest: sha256:%x", digest)
+		if err := checkDigest(digest, b.Opts.ExpectedDigest); err != nil {
+			return err
+		}
+	}
+
+	return
+}
+
+// runMksquashfs runs mksquashfs with args, env is the environment of the
+// process or the current environment when nil
+func runMksquashfs(mksquashfs string, args, env []string) error {
 	mksquashfsCmd := exec.Command(mksquashfs, args...)
+	mksquashfsCmd.Env = env
 	stderr, err := mksquashfsCmd.StderrPipe()
 	if err != nil {
 		return fmt.Errorf("While setting up stderr pipe: %v", err)
@@ -176,13 +250,7 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) (err error) {
 	if err := mksquashfsCmd.Wait(); err != nil {
 		return fmt.Errorf("While running mksquashfs: %v: %s", err, strings.Replace(string(errOut), "\n", " ", -1))
 	}
-
-	err = createSIF(path, b.Recipe.Raw, b.JSONObjects["oci-config"], squashfsPath)
-	if err != nil {
-		return fmt.Errorf("While creating SIF: %v", err)
-	}
-
-	return
+	return nil
 }
 
 // changeOwner check the command being called with sudo with the environment
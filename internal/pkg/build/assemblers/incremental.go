@@ -0,0 +1,343 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/client/cache"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// metadataDir is rewritten by every build, it's always appended to the
+// cached squashfs image
+const metadataDir = ".singularity.d"
+
+// squashfsCacheEntries is the number of squashfs images kept in the build
+// cache, the least recently used are removed first
+const squashfsCacheEntries = 4
+
+// squashfsBase describes a squashfs image of the build cache holding some
+// top level entries of a root filesystem
+type squashfsBase struct {
+	// Options are the mksquashfs options the image was created with
+	Options string `json:"options"`
+	// Entries maps the top level entries of the image to their digest
+	Entries map[string]string `json:"entries"`
+
+	path string
+}
+
+// incremental returns if the squashfs image of bundle b is assembled from
+// the squashfs images cached by previous conversions of the same sandbox
+func incremental(b *types.Bundle) bool {
+	if b.Opts.NoCache || b.Opts.Reproducible {
+		return false
+	}
+	bootstrap := b.Recipe.Header["bootstrap"]
+	return (bootstrap == "localimage" || bootstrap == "sandbox") && fs.IsDir(b.Recipe.Header["from"])
+}
+
+// writeMetadata hashes the metadata of the file name, fi is its lstat
+// information. Contents aren't read: the size, mode, owner and
+// modification time of a file identify its content.
+func writeMetadata(h hash.Hash, name string, fi os.FileInfo) {
+	fmt.Fprintf(h, "%s\x00%o\x00", name, fi.Mode())
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		fmt.Fprintf(h, "%d:%d\x00%d\x00", st.Uid, st.Gid, st.Rdev)
+	}
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		// symlinks created by the build get a new modification time
+		// each time, their target is enough
+		return
+	case fi.Mode().IsRegular():
+		fmt.Fprintf(h, "%d\x00", fi.Size())
+	}
+	fmt.Fprintf(h, "%d\x00", fi.ModTime().UnixNano())
+}
+
+// treeDigest returns the digest of the metadata of path and of the files
+// below it when it's a directory
+func treeDigest(path string) (string, error) {
+	h := sha256.New()
+
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00", target)
+		}
+		writeMetadata(h, rel, fi)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// entryDigests returns the digest of each top level entry of rootfs, the
+// metadata directory is left out
+func entryDigests(rootfs string) (map[string]string, error) {
+	files, err := ioutil.ReadDir(rootfs)
+	if err != nil {
+		return nil, err
+	}
+	digests := make(map[string]string, len(files))
+	for _, f := range files {
+		if f.Name() == metadataDir {
+			continue
+		}
+		d, err := treeDigest(filepath.Join(rootfs, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("while hashing %s: %s", f.Name(), err)
+		}
+		digests[f.Name()] = d
+	}
+
+	// the root directory attributes are those of the cached image
+	fi, err := os.Lstat(rootfs)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%o\x00", fi.Mode())
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		fmt.Fprintf(h, "%d:%d\x00", st.Uid, st.Gid)
+	}
+	digests["/"] = fmt.Sprintf("%x", h.Sum(nil))
+
+	return digests, nil
+}
+
+// key returns the cache key of the squashfs image
+func (s *squashfsBase) key() string {
+	names := make([]string, 0, len(s.Entries))
+	for name := range s.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", s.Options)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%s\x00", name, s.Entries[name])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// matches returns the number of entries of the squashfs image with the
+// same digest in digests, and if all of them are unchanged
+func (s *squashfsBase) matches(digests map[string]string) (int, bool) {
+	n := 0
+	for name, d := range s.Entries {
+		if digests[name] == d {
+			n++
+		}
+	}
+	return n, n == len(s.Entries)
+}
+
+// cachedSquashfsBases returns the squashfs images of the build cache
+// created with options
+func cachedSquashfsBases(dir, options string) []*squashfsBase {
+	indexes, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+
+	var bases []*squashfsBase
+	for _, index := range indexes {
+		b, err := ioutil.ReadFile(index)
+		if err != nil {
+			continue
+		}
+		base := &squashfsBase{}
+		if err := json.Unmarshal(b, base); err != nil || base.Options != options {
+			continue
+		}
+		base.path = strings.TrimSuffix(index, ".json") + ".img"
+		if !fs.IsFile(base.path) {
+			continue
+		}
+		bases = append(bases, base)
+	}
+	return bases
+}
+
+// selectSquashfsBase returns the cached squashfs image holding the most
+// unchanged entries of digests. Without such image, it returns the entries
+// for a new image: the entries unchanged since the closest cached image,
+// so the entries modified between conversions are appended each time, or
+// all entries.
+func selectSquashfsBase(bases []*squashfsBase, digests map[string]string) (*squashfsBase, map[string]string) {
+	var best, closest *squashfsBase
+	bestN, closestN := 0, 0
+
+	for _, base := range bases {
+		n, all := base.matches(digests)
+		if all && n > bestN {
+			best, bestN = base, n
+		} else if !all && n > closestN {
+			closest, closestN = base, n
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+
+	entries := make(map[string]string)
+	if closest != nil && closestN > 1 {
+		for name, d := range closest.Entries {
+			if digests[name] == d {
+				entries[name] = d
+			}
+		}
+	}
+	if _, ok := entries["/"]; !ok {
+		for name, d := range digests {
+			entries[name] = d
+		}
+	}
+	return nil, entries
+}
+
+// pruneSquashfsCache removes the least recently used squashfs images of
+// the build cache beyond squashfsCacheEntries
+func pruneSquashfsCache(dir string) {
+	indexes, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(indexes) <= squashfsCacheEntries {
+		return
+	}
+
+	mtime := make(map[string]time.Time, len(indexes))
+	for _, index := range indexes {
+		if fi, err := os.Stat(index); err == nil {
+			mtime[index] = fi.ModTime()
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return mtime[indexes[i]].After(mtime[indexes[j]])
+	})
+	for _, index := range indexes[squashfsCacheEntries:] {
+		sylog.Debugf("Removing cached squashfs image %s", index)
+		os.Remove(strings.TrimSuffix(index, ".json") + ".img")
+		os.Remove(index)
+	}
+}
+
+// assembleIncremental creates the squashfs image of the root filesystem
+// of bundle b at squashfsPath from a squashfs image cached by a previous
+// conversion. Top level entries whose metadata changed, and the metadata
+// directory, are appended to a copy of the cached image. Only args are
+// part of the cache key, tuning options don't change the image content.
+func assembleIncremental(b *types.Bundle, mksquashfs, squashfsPath string, args, tuning []string) error {
+	rootfs := b.Rootfs()
+	dir := cache.BuildSquashfs()
+	options := strings.Join(args, " ")
+
+	digests, err := entryDigests(rootfs)
+	if err != nil {
+		return fmt.Errorf("while hashing root filesystem: %s", err)
+	}
+
+	base, entries := selectSquashfsBase(cachedSquashfsBases(dir, options), digests)
+	if base == nil {
+		base = &squashfsBase{Options: options, Entries: entries}
+		base.path = filepath.Join(dir, base.key()+".img")
+
+		sylog.Debugf("Creating cached squashfs image %s", base.path)
+		f, err := ioutil.TempFile(dir, "squashfs-")
+		if err != nil {
+			return err
+		}
+		tmp := f.Name()
+		f.Close()
+		defer os.Remove(tmp)
+
+		baseArgs := append([]string{rootfs, tmp, "-noappend"}, args...)
+		for name := range digests {
+			if _, ok := entries[name]; !ok && name != "/" {
+				baseArgs = append(baseArgs, "-e", name)
+			}
+		}
+		baseArgs = append(baseArgs, "-e", metadataDir)
+		baseArgs = append(baseArgs, tuning...)
+		if err := runMksquashfs(mksquashfs, baseArgs, nil); err != nil {
+			return err
+		}
+
+		index, err := json.Marshal(base)
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, base.path); err != nil {
+			return fmt.Errorf("while caching squashfs image: %s", err)
+		}
+		if err := ioutil.WriteFile(strings.TrimSuffix(base.path, ".img")+".json", index, 0644); err != nil {
+			return fmt.Errorf("while caching squashfs image: %s", err)
+		}
+	} else {
+		sylog.Infof("Reusing cached squashfs image of %d unchanged directories", len(base.Entries)-1)
+		now := time.Now()
+		os.Chtimes(strings.TrimSuffix(base.path, ".img")+".json", now, now)
+	}
+	defer pruneSquashfsCache(dir)
+
+	if err := fs.CopyFile(base.path, squashfsPath, 0644); err != nil {
+		return fmt.Errorf("while copying cached squashfs image: %s", err)
+	}
+
+	// appended sources become top level entries of the image
+	var sources []string
+	for name := range digests {
+		if _, ok := base.Entries[name]; !ok {
+			sources = append(sources, filepath.Join(rootfs, name))
+		}
+	}
+	sort.Strings(sources)
+	if fs.IsDir(filepath.Join(rootfs, metadataDir)) {
+		sources = append(sources, filepath.Join(rootfs, metadataDir))
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	sylog.Debugf("Appending %s to squashfs image", strings.Join(sources, " "))
+
+	appendArgs := append(sources, squashfsPath)
+	if len(sources) == 1 {
+		appendArgs = append(appendArgs, "-keep-as-directory")
+	}
+	// the compression and block size of the cached image are kept
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-comp" || args[i] == "-b" {
+			i++
+			continue
+		}
+		appendArgs = append(appendArgs, args[i])
+	}
+	appendArgs = append(appendArgs, tuning...)
+	return runMksquashfs(mksquashfs, appendArgs, nil)
+}
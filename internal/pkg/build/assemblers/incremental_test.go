@@ -0,0 +1,134 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEntryDigests(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "incremental-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	for _, d := range []string{"usr/bin", "opt/app", metadataDir} {
+		if err := os.MkdirAll(filepath.Join(rootfs, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"usr/bin/tool":             "tool",
+		"opt/app/main.py":          "print('hello')",
+		metadataDir + "/runscript": "#!/bin/sh",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(rootfs, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("usr/bin", filepath.Join(rootfs, "bin")); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := entryDigests(rootfs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := before[metadataDir]; ok {
+		t.Errorf("metadata directory unexpectedly hashed")
+	}
+	for _, name := range []string{"/", "usr", "opt", "bin"} {
+		if before[name] == "" {
+			t.Errorf("missing digest of %s", name)
+		}
+	}
+
+	// rewriting the metadata directory doesn't change digests
+	if err := ioutil.WriteFile(filepath.Join(rootfs, metadataDir, "runscript"), []byte("#!/bin/bash"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// only the modified top level directory changes
+	later := time.Now().Add(time.Hour)
+	main := filepath.Join(rootfs, "opt/app/main.py")
+	if err := ioutil.WriteFile(main, []byte("print('world')"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(main, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := entryDigests(rootfs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, name := range []string{"/", "usr", "bin"} {
+		if before[name] != after[name] {
+			t.Errorf("unexpected digest change of %s", name)
+		}
+	}
+	if before["opt"] == after["opt"] {
+		t.Errorf("digest of modified directory opt unchanged")
+	}
+}
+
+func TestSelectSquashfsBase(t *testing.T) {
+	digests := map[string]string{"/": "r", "usr": "u1", "opt": "o2", "etc": "e1"}
+
+	full := &squashfsBase{Entries: map[string]string{"/": "r", "usr": "u1", "opt": "o1", "etc": "e1"}}
+	partial := &squashfsBase{Entries: map[string]string{"/": "r", "usr": "u1"}}
+	other := &squashfsBase{Entries: map[string]string{"/": "x", "usr": "u1", "opt": "o2", "etc": "e1"}}
+
+	// the cached image with the most unchanged entries is reused
+	base, _ := selectSquashfsBase([]*squashfsBase{full, partial, other}, digests)
+	if base != partial {
+		t.Errorf("unexpected base %v", base)
+	}
+
+	// without reusable image, the entries unchanged since the closest
+	// image are cached
+	base, entries := selectSquashfsBase([]*squashfsBase{full}, digests)
+	if base != nil {
+		t.Fatalf("unexpected base %v", base)
+	}
+	expected := map[string]string{"/": "r", "usr": "u1", "etc": "e1"}
+	if len(entries) != len(expected) {
+		t.Errorf("unexpected entries %v", entries)
+	}
+	for name, d := range expected {
+		if entries[name] != d {
+			t.Errorf("unexpected entries %v", entries)
+		}
+	}
+
+	// a root directory change requires caching all entries
+	base, entries = selectSquashfsBase([]*squashfsBase{other}, digests)
+	if base != nil || len(entries) != len(digests) {
+		t.Errorf("unexpected base %v with entries %v", base, entries)
+	}
+	base, entries = selectSquashfsBase(nil, digests)
+	if base != nil || len(entries) != len(digests) {
+		t.Errorf("unexpected base %v with entries %v", base, entries)
+	}
+}
+
+func TestSquashfsBaseKey(t *testing.T) {
+	a := &squashfsBase{Options: "-all-root", Entries: map[string]string{"/": "r", "usr": "u1"}}
+	b := &squashfsBase{Options: "-all-root", Entries: map[string]string{"usr": "u1", "/": "r"}}
+	c := &squashfsBase{Options: "-all-root -comp xz", Entries: map[string]string{"/": "r", "usr": "u1"}}
+
+	if a.key() != b.key() {
+		t.Errorf("key depends on entries order")
+	}
+	if a.key() == c.key() {
+		t.Errorf("key doesn't depend on options")
+	}
+}
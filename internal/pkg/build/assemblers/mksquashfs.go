@@ -0,0 +1,86 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"fmt"
+	"strconv"
+
+	units "github.com/docker/go-units"
+	"github.com/sylabs/singularity/pkg/build/types"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+const (
+	minBlockSize = 4 << 10
+	maxBlockSize = 1 << 20
+)
+
+// ParseBlockSize returns the size in bytes of a squashfs block size with
+// an optional K or M suffix. Block sizes are powers of two between 4K and
+// 1M, larger blocks compress better but slow down random reads.
+func ParseBlockSize(size string) (int64, error) {
+	n, err := units.RAMInBytes(size)
+	if err != nil {
+		return 0, err
+	}
+	if n < minBlockSize || n > maxBlockSize || n&(n-1) != 0 {
+		return 0, fmt.Errorf("block size %s is not a power of two between 4K and 1M", size)
+	}
+	return n, nil
+}
+
+// ParseMksquashfsMem returns the mksquashfs -mem value of a memory size
+// with an optional K, M or G suffix, mksquashfs counts it in megabytes.
+func ParseMksquashfsMem(size string) (string, error) {
+	n, err := units.RAMInBytes(size)
+	if err != nil {
+		return "", err
+	}
+	if n < 1<<20 {
+		return "", fmt.Errorf("mksquashfs memory %s is less than 1M", size)
+	}
+	return fmt.Sprintf("%dM", n>>20), nil
+}
+
+// mksquashfsOptions returns the mksquashfs options changing the image
+// content and the options setting the resources used by mksquashfs. Build
+// options take precedence over the singularity.conf defaults.
+func mksquashfsOptions(c *singularityConfig.FileConfig, o types.Options) (content []string, tuning []string, err error) {
+	blockSize := c.MksquashfsBlockSize
+	if o.SquashfsBlockSize != "" {
+		blockSize = o.SquashfsBlockSize
+	}
+	if blockSize != "" {
+		n, err := ParseBlockSize(blockSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		content = append(content, "-b", strconv.FormatInt(n, 10))
+	}
+
+	procs := c.MksquashfsProcs
+	if o.MksquashfsProcs != 0 {
+		procs = o.MksquashfsProcs
+	}
+	if procs != 0 {
+		tuning = append(tuning, "-processors", strconv.FormatUint(uint64(procs), 10))
+	}
+
+	mem := c.MksquashfsMem
+	if o.MksquashfsMem != "" {
+		mem = o.MksquashfsMem
+	}
+	if mem != "" {
+		m, err := ParseMksquashfsMem(mem)
+		if err != nil {
+			return nil, nil, err
+		}
+		tuning = append(tuning, "-mem", m)
+	}
+
+	return content, tuning, nil
+}
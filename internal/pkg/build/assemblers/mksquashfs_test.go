@@ -0,0 +1,111 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+func TestParseBlockSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		bytes   int64
+		wantErr bool
+	}{
+		{"4K", 4096, false},
+		{"128k", 131072, false},
+		{"1M", 1048576, false},
+		{"65536", 65536, false},
+		{"2K", 0, true},
+		{"2M", 0, true},
+		{"100K", 0, true},
+		{"big", 0, true},
+	}
+	for _, tt := range tests {
+		n, err := ParseBlockSize(tt.size)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("unexpected success for %q", tt.size)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.size, err)
+		} else if n != tt.bytes {
+			t.Errorf("unexpected block size %d for %q", n, tt.size)
+		}
+	}
+}
+
+func TestParseMksquashfsMem(t *testing.T) {
+	tests := []struct {
+		size    string
+		mem     string
+		wantErr bool
+	}{
+		{"512M", "512M", false},
+		{"4G", "4096M", false},
+		{"4g", "4096M", false},
+		{"100K", "", true},
+		{"lots", "", true},
+	}
+	for _, tt := range tests {
+		m, err := ParseMksquashfsMem(tt.size)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("unexpected success for %q", tt.size)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.size, err)
+		} else if m != tt.mem {
+			t.Errorf("unexpected memory %s for %q", m, tt.size)
+		}
+	}
+}
+
+func TestMksquashfsOptions(t *testing.T) {
+	c := &singularityConfig.FileConfig{MksquashfsProcs: 8, MksquashfsMem: "1G", MksquashfsBlockSize: "256K"}
+
+	content, tuning, err := mksquashfsOptions(c, types.Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(content, []string{"-b", "262144"}) {
+		t.Errorf("unexpected content options %v", content)
+	}
+	if !reflect.DeepEqual(tuning, []string{"-processors", "8", "-mem", "1024M"}) {
+		t.Errorf("unexpected tuning options %v", tuning)
+	}
+
+	// build options take precedence
+	o := types.Options{SquashfsBlockSize: "1M", MksquashfsProcs: 64, MksquashfsMem: "16G"}
+	content, tuning, err = mksquashfsOptions(c, o)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(content, []string{"-b", "1048576"}) {
+		t.Errorf("unexpected content options %v", content)
+	}
+	if !reflect.DeepEqual(tuning, []string{"-processors", "64", "-mem", "16384M"}) {
+		t.Errorf("unexpected tuning options %v", tuning)
+	}
+
+	// mksquashfs defaults
+	content, tuning, err = mksquashfsOptions(&singularityConfig.FileConfig{}, types.Options{})
+	if err != nil || len(content) != 0 || len(tuning) != 0 {
+		t.Errorf("unexpected options %v %v: %v", content, tuning, err)
+	}
+
+	if _, _, err := mksquashfsOptions(&singularityConfig.FileConfig{MksquashfsBlockSize: "3K"}, types.Options{}); err == nil {
+		t.Errorf("unexpected success with invalid block size")
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// squashfsMkfsTimeOffset is the offset of the creation time in the
+// squashfs superblock
+const squashfsMkfsTimeOffset = 8
+
+// setSquashfsTime overwrites the creation time recorded in the superblock
+// of the squashfs image at path, mksquashfs only honors SOURCE_DATE_EPOCH
+// starting with version 4.4
+func setSquashfsTime(path string, epoch int64) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(epoch))
+	if _, err := f.WriteAt(b, squashfsMkfsTimeOffset); err != nil {
+		return fmt.Errorf("while writing squashfs superblock: %s", err)
+	}
+	return nil
+}
+
+// normalizeSIF replaces the nondeterministic fields of the SIF image at
+// path: times are set to epoch, owners to root and the image ID is
+// derived from the content of its data objects. It returns the SHA256
+// digest of the resulting image.
+func normalizeSIF(path string, epoch int64) ([]byte, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var header sif.Header
+	if err := binary.Read(f, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("while reading SIF header: %s", err)
+	}
+	descrs := make([]sif.Descriptor, header.Dtotal)
+	if _, err := f.Seek(header.Descroff, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(f, binary.LittleEndian, descrs); err != nil {
+		return nil, fmt.Errorf("while reading SIF descriptors: %s", err)
+	}
+
+	for i := range descrs {
+		if !descrs[i].Used {
+			continue
+		}
+		descrs[i].Ctime = epoch
+		descrs[i].Mtime = epoch
+		descrs[i].UID = 0
+		descrs[i].Gid = 0
+	}
+
+	h := sha256.New()
+	if _, err := f.Seek(header.Dataoff, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("while hashing SIF data: %s", err)
+	}
+	header.ID = uuid.NewV5(uuid.NamespaceOID, fmt.Sprintf("%x", h.Sum(nil)))
+	header.Ctime = epoch
+	header.Mtime = epoch
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(f, binary.LittleEndian, header); err != nil {
+		return nil, fmt.Errorf("while writing SIF header: %s", err)
+	}
+	if _, err := f.Seek(header.Descroff, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(f, binary.LittleEndian, descrs); err != nil {
+		return nil, fmt.Errorf("while writing SIF descriptors: %s", err)
+	}
+
+	h.Reset()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("while hashing SIF image: %s", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// checkDigest returns an error if expected, as sha256:<hex>, is set and
+// isn't the SHA256 digest digest
+func checkDigest(digest []byte, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	if actual := fmt.Sprintf("sha256:%x", digest); actual != expected {
+		return fmt.Errorf("image digest %s doesn't match expected digest %s, the build isn't reproducible", actual, expected)
+	}
+	return nil
+}
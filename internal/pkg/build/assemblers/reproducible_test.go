@@ -0,0 +1,139 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package assemblers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+func createTestSIF(t *testing.T, path string) {
+	data := []byte("bootstrap: scratch\n")
+	cinfo := sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{
+			{
+				Datatype: sif.DataDeffile,
+				Groupid:  sif.DescrDefaultGroup,
+				Link:     sif.DescrUnusedLink,
+				Data:     data,
+				Size:     int64(len(data)),
+			},
+		},
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNormalizeSIF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reproducible-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var images [][]byte
+	var digests [][]byte
+
+	for _, name := range []string{"a.sif", "b.sif"} {
+		path := filepath.Join(dir, name)
+		createTestSIF(t, path)
+
+		digest, err := normalizeSIF(path, 1234)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, b)
+		digests = append(digests, digest)
+	}
+
+	if !bytes.Equal(images[0], images[1]) {
+		t.Errorf("normalized images differ")
+	}
+	if !bytes.Equal(digests[0], digests[1]) {
+		t.Errorf("digests differ: %x %x", digests[0], digests[1])
+	}
+
+	fimg, err := sif.LoadContainer(filepath.Join(dir, "a.sif"), true)
+	if err != nil {
+		t.Fatalf("could not load normalized image: %s", err)
+	}
+	defer fimg.UnloadContainer()
+
+	if fimg.Header.Ctime != 1234 || fimg.Header.Mtime != 1234 {
+		t.Errorf("unexpected header times %d %d", fimg.Header.Ctime, fimg.Header.Mtime)
+	}
+	for _, d := range fimg.DescrArr {
+		if d.Used && (d.Ctime != 1234 || d.UID != 0 || d.Gid != 0) {
+			t.Errorf("descriptor %d not normalized", d.ID)
+		}
+	}
+}
+
+func TestSetSquashfsTime(t *testing.T) {
+	f, err := ioutil.TempFile("", "squashfs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(make([]byte, 96))
+	f.Close()
+
+	if err := setSquashfsTime(f.Name(), 1234); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := binary.LittleEndian.Uint32(b[squashfsMkfsTimeOffset:]); v != 1234 {
+		t.Errorf("unexpected creation time %d", v)
+	}
+}
+
+func TestCheckDigest(t *testing.T) {
+	digest := sha256.Sum256([]byte("image"))
+	expected := fmt.Sprintf("sha256:%x", digest)
+
+	tests := []struct {
+		name     string
+		expected string
+		wantErr  bool
+	}{
+		{"NoExpectedDigest", "", false},
+		{"Match", expected, false},
+		{"Mismatch", fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other"))), true},
+		{"Truncated", expected[:len(expected)-1], true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDigest(digest[:], tt.expected)
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -9,9 +9,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"syscall"
 
@@ -19,6 +21,8 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/build/apps"
 	"github.com/sylabs/singularity/internal/pkg/build/assemblers"
 	"github.com/sylabs/singularity/internal/pkg/build/copy"
+	"github.com/sylabs/singularity/internal/pkg/build/fakeroot"
+	"github.com/sylabs/singularity/internal/pkg/build/optimize"
 	"github.com/sylabs/singularity/internal/pkg/build/sources"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
@@ -26,10 +30,13 @@ import (
 	imgbuildConfig "github.com/sylabs/singularity/internal/pkg/runtime/engines/imgbuild/config"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	syexec "github.com/sylabs/singularity/internal/pkg/util/exec"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/files"
+	"github.com/sylabs/singularity/internal/pkg/util/platform"
 	"github.com/sylabs/singularity/internal/pkg/util/uri"
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/build/types/parser"
 	"github.com/sylabs/singularity/pkg/image"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
 )
 
 // Build is an abstracted way to look at the entire build process.
@@ -41,15 +48,20 @@ import (
 type Build struct {
 	// stages of the build
 	stages []stage
+	// images are the bundles of the images %files sections copy from,
+	// indexed by image reference
+	images map[string]*types.Bundle
 	// Conf contains cross stage build configuration
 	Conf Config
+	// emulators remove the emulators registered for the build
+	emulators []func() error
 }
 
 // Config defines how build is executed, including things like where final image is written.
 type Config struct {
 	// Dest is the location for container after build is complete
 	Dest string
-	// Format is the format of built container, e.g., SIF, sandbox
+	// Format is the format of built container, e.g., SIF, sandbox, OCI
 	Format string
 	// NoCleanUp allows a user to prevent a bundle from being cleaned up after a failed build
 	// useful for debugging
@@ -94,7 +106,8 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 	}
 
 	b := &Build{
-		Conf: conf,
+		Conf:   conf,
+		images: make(map[string]*types.Bundle),
 	}
 
 	// create stages
@@ -132,6 +145,8 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 		b.stages[lastStageIndex].a = &assemblers.SandboxAssembler{}
 	case "sif":
 		b.stages[lastStageIndex].a = &assemblers.SIFAssembler{}
+	case "oci":
+		b.stages[lastStageIndex].a = &assemblers.OCIAssembler{}
 	default:
 		return nil, fmt.Errorf("unrecognized output format %s", conf.Format)
 	}
@@ -145,6 +160,9 @@ func (b Build) cleanUp() {
 	for _, s := range b.stages {
 		bundlePaths = append(bundlePaths, s.b.Path)
 	}
+	for _, i := range b.images {
+		bundlePaths = append(bundlePaths, i.Path)
+	}
 
 	if b.Conf.NoCleanUp {
 		sylog.Infof("Build performed with no clean up option, build bundle(s) located at: %v", bundlePaths)
@@ -158,6 +176,35 @@ func (b Build) cleanUp() {
 
 }
 
+// registerEmulator registers the qemu emulator of the Go architecture arch
+// found in the qemu static path of singularity.conf until the build ends
+func (b *Build) registerEmulator(arch string) {
+	c := &singularityConfig.FileConfig{}
+	if err := config.Parser(buildcfg.SYSCONFDIR+"/singularity/singularity.conf", c); err != nil {
+		sylog.Warningf("Unable to parse singularity.conf file: %s", err)
+		return
+	}
+	unregister, err := platform.RegisterEmulator(arch, c.QemuStaticPath)
+	if err != nil {
+		sylog.Warningf("Unable to register %s emulator: %s", arch, err)
+		return
+	}
+	if unregister != nil {
+		b.emulators = append(b.emulators, unregister)
+	}
+}
+
+// unregisterEmulators removes the emulators registered for the build
+// from binfmt_misc
+func (b *Build) unregisterEmulators() {
+	for _, unregister := range b.emulators {
+		if err := unregister(); err != nil {
+			sylog.Warningf("%s", err)
+		}
+	}
+	b.emulators = nil
+}
+
 // Full runs a standard build from start to finish
 func (b *Build) Full() error {
 	sylog.Infof("Starting build...")
@@ -168,10 +215,16 @@ func (b *Build) Full() error {
 	go func() {
 		<-c
 		b.cleanUp()
+		b.unregisterEmulators()
 		os.Exit(1)
 	}()
 	// clean up build normally
 	defer b.cleanUp()
+	defer b.unregisterEmulators()
+
+	// with --keep-failed a %test failure is reported once the image
+	// is assembled
+	var testErr error
 
 	// build each stage one after the other
 	for i, stage := range b.stages {
@@ -195,14 +248,30 @@ func (b *Build) Full() error {
 			}
 		} else {
 			// regular build or force, start build from scratch
+			want, err := stage.requestedArch()
+			if err != nil {
+				return err
+			}
+			// bootstrap tools like debootstrap already run programs
+			// of the requested architecture
+			if !stage.b.Opts.StrictPlatform {
+				b.registerEmulator(want)
+			}
+
 			if err := stage.c.Get(stage.b); err != nil {
 				return fmt.Errorf("conveyor failed to get: %v", err)
 			}
 
-			_, err := stage.c.Pack()
+			_, err = stage.c.Pack()
 			if err != nil {
 				return fmt.Errorf("packer failed to pack: %v", err)
 			}
+
+			// sources which don't record an architecture bootstrap
+			// images for the host
+			if stage.b.Arch == "" && !platform.ArchCompatible(runtime.GOARCH, want) {
+				return fmt.Errorf("%s bootstrap agent can't build images for %s architecture", stage.b.Recipe.Header["bootstrap"], want)
+			}
 		}
 
 		// create apps in bundle
@@ -214,15 +283,27 @@ func (b *Build) Full() error {
 		a.HandleBundle(stage.b)
 		stage.b.Recipe.BuildData.Post.Script += a.HandlePost()
 
-		if stage.b.RunSection("files") {
-			if err := stage.copyFiles(b); err != nil {
-				return fmt.Errorf("unable to copy files a stage to container fs: %v", err)
+		if engineRequired(stage.b.Recipe) {
+			// build scripts of images for another architecture run
+			// under emulation
+			if !stage.b.Opts.StrictPlatform {
+				b.registerEmulator(stage.b.Arch)
+			}
+			emulated, err := platform.CheckHost(stage.b.Arch, stage.b.Opts.StrictPlatform)
+			if err != nil {
+				return fmt.Errorf("unable to run build scripts: %s", err)
+			}
+			if emulated {
+				sylog.Warningf("Running build scripts of %s image under emulation", stage.b.Arch)
 			}
-		}
 
-		if engineRequired(stage.b.Recipe) {
-			if err := runBuildEngine(stage.b); err != nil {
-				return fmt.Errorf("while running engine: %v", err)
+			// updated containers don't start from the bootstrap source
+			if err := stage.runSections(b, !update); err != nil {
+				if _, ok := err.(*testFailure); !ok || !stage.b.Opts.KeepFailed {
+					return err
+				}
+				sylog.Errorf("%s", err)
+				testErr = err
 			}
 		}
 
@@ -232,11 +313,29 @@ func (b *Build) Full() error {
 		}
 	}
 
+	last := b.stages[len(b.stages)-1]
+	if len(last.b.Opts.OptimizePasses) > 0 {
+		plan := optimize.Plan{Passes: last.b.Opts.OptimizePasses}
+		if err := plan.Run(last.b.Rootfs()); err != nil {
+			return fmt.Errorf("while optimizing image: %s", err)
+		}
+	}
+	if last.b.Opts.Reproducible || last.b.Opts.ResetTimestamps {
+		sylog.Debugf("Clamping file times to %d", last.b.Opts.SourceDateEpoch)
+		if err := clampTimes(last.b.Rootfs(), last.b.Opts.SourceDateEpoch); err != nil {
+			return fmt.Errorf("while normalizing file times: %s", err)
+		}
+	}
+
 	sylog.Debugf("Calling assembler")
-	if err := b.stages[len(b.stages)-1].Assemble(b.Conf.Dest); err != nil {
+	if err := last.Assemble(b.Conf.Dest); err != nil {
 		return err
 	}
 
+	if testErr != nil {
+		return fmt.Errorf("image kept at %s: %s", b.Conf.Dest, testErr)
+	}
+
 	sylog.Infof("Build complete: %s", b.Conf.Dest)
 	return nil
 }
@@ -248,8 +347,15 @@ func engineRequired(def types.Definition) bool {
 
 // runBuildEngine creates an imgbuild engine and creates a container out of our bundle in order to execute %post %setup scripts in the bundle
 func runBuildEngine(b *types.Bundle) error {
-	if syscall.Getuid() != 0 {
-		return fmt.Errorf("Attempted to build with scripts as non-root user")
+	uid := syscall.Getuid()
+	if uid != 0 {
+		switch fakeroot.Mode(b.Opts.FakerootMode) {
+		case fakeroot.UserNamespace:
+		case fakeroot.Fakechroot, fakeroot.Proot:
+			return runFakerootEngine(b)
+		default:
+			return fmt.Errorf("Attempted to build with scripts as non-root user, use --fakeroot to build as a fake root user")
+		}
 	}
 
 	sylog.Debugf("Starting build engine")
@@ -263,12 +369,37 @@ func runBuildEngine(b *types.Bundle) error {
 		OciConfig: ociConfig,
 	}
 
+	// the resolv.conf of DNS servers is kept out of the root filesystem
+	if b.Opts.DNS != "" {
+		content, err := files.ResolvConf(strings.Split(strings.Replace(b.Opts.DNS, " ", "", -1), ","))
+		if err != nil {
+			return err
+		}
+		resolvConf := filepath.Join(b.Path, "resolv.conf")
+		if err := ioutil.WriteFile(resolvConf, content, 0644); err != nil {
+			return fmt.Errorf("while writing resolv.conf: %s", err)
+		}
+		engineConfig.Opts.ResolvConf = resolvConf
+	}
+
 	// surface build specific environment variables for scripts
 	sRootfs := "SINGULARITY_ROOTFS=" + b.Rootfs()
 	sEnvironment := "SINGULARITY_ENVIRONMENT=" + "/.singularity.d/env/91-environment.sh"
 
 	ociConfig.Process = &specs.Process{}
 	ociConfig.Process.Env = append(os.Environ(), sRootfs, sEnvironment)
+	if uid != 0 {
+		// the user is root in the user namespace of the build engine
+		ociConfig.Linux = &specs.Linux{
+			Namespaces:  []specs.LinuxNamespace{{Type: specs.UserNamespace}},
+			UIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: uint32(uid), Size: 1}},
+			GIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: uint32(syscall.Getgid()), Size: 1}},
+		}
+	}
+	if b.Opts.Reproducible {
+		// honored by most tools writing timestamps
+		ociConfig.Process.Env = append(ociConfig.Process.Env, fmt.Sprintf("SOURCE_DATE_EPOCH=%d", b.Opts.SourceDateEpoch))
+	}
 
 	config := &config.Common{
 		EngineName:   imgbuildConfig.Name,
@@ -306,14 +437,22 @@ func getcp(def types.Definition, libraryURL, authToken string) (ConveyorPacker,
 		return &sources.DebootstrapConveyorPacker{}, nil
 	case "arch":
 		return &sources.ArchConveyorPacker{}, nil
-	case "localimage":
+	case "localimage", "sandbox":
 		return &sources.LocalConveyorPacker{}, nil
+	case "instance":
+		return &sources.InstanceConveyorPacker{}, nil
 	case "yum":
 		return &sources.YumConveyorPacker{}, nil
 	case "zypper":
 		return &sources.ZypperConveyorPacker{}, nil
 	case "scratch":
 		return &sources.ScratchConveyorPacker{}, nil
+	case "conda":
+		return &sources.CondaConveyorPacker{}, nil
+	case "nix":
+		return &sources.NixConveyorPacker{}, nil
+	case "guix":
+		return &sources.GuixConveyorPacker{}, nil
 	case "":
 		return nil, fmt.Errorf("no bootstrap specification found")
 	default:
@@ -347,10 +486,15 @@ func makeDef(spec string, remote bool) (types.Definition, error) {
 
 	// must be root to build from a definition
 	if os.Getuid() != 0 && !remote {
-		return types.Definition{}, fmt.Errorf("you must be the root user to build from a definition file")
+		return types.Definition{}, fmt.Errorf("you must be the root user to build from a definition file, or use --fakeroot")
+	}
+
+	r, err := parser.ExpandIncludes(defFile, spec)
+	if err != nil {
+		return types.Definition{}, fmt.Errorf("while including files: %v", err)
 	}
 
-	d, err := parser.ParseDefinitionFile(defFile)
+	d, err := parser.ParseDefinitionFile(r)
 	if err != nil {
 		return types.Definition{}, fmt.Errorf("while parsing definition: %s: %v", spec, err)
 	}
@@ -358,13 +502,16 @@ func makeDef(spec string, remote bool) (types.Definition, error) {
 	return d, nil
 }
 
-// MakeAllDefs gets a definition slice from a spec
-func MakeAllDefs(spec string, remote bool) ([]types.Definition, error) {
-	return makeAllDefs(spec, remote)
+// MakeAllDefs gets a definition slice from a spec, placeholders of a
+// definition file are replaced by the values of buildArgs. Definition
+// files can be read without root privileges for remote and unprivileged
+// builds.
+func MakeAllDefs(spec string, remote, unprivileged bool, buildArgs map[string]string) ([]types.Definition, error) {
+	return makeAllDefs(spec, remote, unprivileged, buildArgs)
 }
 
 // makeAllDef gets a definition object from a spec
-func makeAllDefs(spec string, remote bool) ([]types.Definition, error) {
+func makeAllDefs(spec string, remote, unprivileged bool, buildArgs map[string]string) ([]types.Definition, error) {
 	if ok, err := uri.IsValid(spec); ok && err == nil {
 		// URI passed as spec
 		d, err := types.NewDefinitionFromURI(spec)
@@ -385,11 +532,34 @@ func makeAllDefs(spec string, remote bool) ([]types.Definition, error) {
 	defer defFile.Close()
 
 	// must be root to build from a definition
-	if os.Getuid() != 0 && !remote {
-		return nil, fmt.Errorf("you must be the root user to build from a definition file")
+	if os.Getuid() != 0 && !remote && !unprivileged {
+		return nil, fmt.Errorf("you must be the root user to build from a definition file, or use --fakeroot")
 	}
 
-	d, err := parser.All(defFile)
+	// COPY sources of a Dockerfile are relative to its directory
+	if parser.IsDockerfile(spec) {
+		abs, err := filepath.Abs(spec)
+		if err != nil {
+			return nil, err
+		}
+		d, err := parser.ParseDockerfile(defFile, filepath.Dir(abs), buildArgs)
+		if err != nil {
+			return nil, fmt.Errorf("while translating Dockerfile: %s: %v", spec, err)
+		}
+		return d, nil
+	}
+
+	r, err := parser.ExpandIncludes(defFile, spec)
+	if err != nil {
+		return nil, fmt.Errorf("while including files: %v", err)
+	}
+
+	r, err = parser.ApplyBuildArgs(r, buildArgs)
+	if err != nil {
+		return nil, fmt.Errorf("while applying build arguments: %s: %v", spec, err)
+	}
+
+	d, err := parser.All(r)
 	if err != nil {
 		return nil, fmt.Errorf("while parsing definition: %s: %v", spec, err)
 	}
@@ -407,26 +577,87 @@ func (b *Build) findStageIndex(name string) (int, error) {
 	return -1, fmt.Errorf("stage %s was not found", name)
 }
 
+// filesSource returns the source of the files of a %files section with
+// "from <stage|image> [<src> [<dest>]]" arguments and the file given on
+// the section line, ok is false for files copied from the host
+func filesSource(args string) (source string, inline []types.FileTransport, ok bool) {
+	f := strings.Fields(args)
+	if len(f) < 2 || len(f) > 4 || f[0] != "from" {
+		return "", nil, false
+	}
+	if len(f) > 2 {
+		t := types.FileTransport{Src: f[2]}
+		if len(f) == 4 {
+			t.Dst = f[3]
+		}
+		inline = append(inline, t)
+	}
+	return f[1], inline, true
+}
+
+// filesRoot returns the root filesystem the files of a %files section
+// are copied from, the source is a previous stage name or an image URI
+// or path, images are bootstrapped once for all stages
+func (b *Build) filesRoot(source string) (string, error) {
+	if i, err := b.findStageIndex(source); err == nil {
+		return b.stages[i].b.Rootfs(), nil
+	}
+	if ib, ok := b.images[source]; ok {
+		return ib.Rootfs(), nil
+	}
+
+	var def types.Definition
+	if ok, err := uri.IsValid(source); ok && err == nil {
+		if def, err = types.NewDefinitionFromURI(source); err != nil {
+			return "", err
+		}
+	} else if _, err := image.Init(source, false); err == nil {
+		if def, err = types.NewDefinitionFromURI("localimage" + "://" + source); err != nil {
+			return "", err
+		}
+	} else {
+		return "", fmt.Errorf("stage or image %s was not found", source)
+	}
+
+	c, err := getcp(def, b.Conf.Opts.LibraryURL, b.Conf.Opts.LibraryAuthToken)
+	if err != nil {
+		return "", fmt.Errorf("unable to get conveyorpacker for %s: %s", source, err)
+	}
+	ib, err := types.NewBundle(b.Conf.Opts.TmpDir, "sbuild-files")
+	if err != nil {
+		return "", err
+	}
+	ib.Recipe = def
+	ib.Opts = b.Conf.Opts
+	b.images[source] = ib
+
+	sylog.Infof("Fetching %s to copy files from", source)
+	if err := c.Get(ib); err != nil {
+		return "", fmt.Errorf("conveyor failed to get %s: %v", source, err)
+	}
+	if _, err := c.Pack(); err != nil {
+		return "", fmt.Errorf("packer failed to pack %s: %v", source, err)
+	}
+	return ib.Rootfs(), nil
+}
+
 func (s *stage) copyFiles(b *Build) error {
 	def := s.b.Recipe
 	for _, f := range def.BuildData.Files {
-		if f.Args == "" {
-			continue
-		}
-		args := strings.Fields(f.Args)
-		if len(args) != 2 {
+		source, inline, ok := filesSource(f.Args)
+		if !ok {
 			continue
 		}
 
-		stageIndex, err := b.findStageIndex(args[1])
+		root, err := b.filesRoot(source)
 		if err != nil {
 			return err
 		}
 
-		sylog.Debugf("Copying files from stage: %s", args[1])
+		sylog.Debugf("Copying files from: %s", source)
 
 		// iterate through filetransfers
-		for _, transfer := range f.Files {
+		for _, transfer := range append(inline, f.Files...) {
 			// sanity
 			if transfer.Src == "" {
 				sylog.Warningf("Attempt to copy file with no name, skipping.")
@@ -438,7 +669,7 @@ func (s *stage) copyFiles(b *Build) error {
 			}
 
 			// copy each file into bundle rootfs
-			transfer.Src = filepath.Join(b.stages[stageIndex].b.Rootfs(), transfer.Src)
+			transfer.Src = filepath.Join(root, transfer.Src)
 			transfer.Dst = filepath.Join(s.b.Rootfs(), transfer.Dst)
 			sylog.Infof("Copying %v to %v", transfer.Src, transfer.Dst)
 			if err := copy.Copy(transfer.Src, transfer.Dst); err != nil {
@@ -0,0 +1,273 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/client/cache"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// cacheKeyVersion is hashed first in cache keys, it must be changed when
+// the cache key content or the cached archive format changes
+const cacheKeyVersion = "build-cache-v1"
+
+// digester is implemented by conveyors identifying the exact content of
+// the source they fetched, only stages bootstrapped from such sources
+// have their %files and %post results cached
+type digester interface {
+	Digest() string
+}
+
+// cacheKey returns the key identifying the root filesystem produced by
+// the %files and %post sections of the stage, an empty key is returned
+// when the result can't be cached. Stages running a %setup section are
+// not cached as it can read any host file.
+func (s *stage) cacheKey(b *Build) (string, error) {
+	d, ok := s.c.(digester)
+	if !ok {
+		return "", nil
+	}
+	if s.b.RunSection("setup") && strings.TrimSpace(s.b.Recipe.BuildData.Setup.Script) != "" {
+		return "", nil
+	}
+	digest := d.Digest()
+	if digest == "" {
+		return "", nil
+	}
+
+	def := s.b.Recipe
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%s\x00%s\x00", cacheKeyVersion, digest)
+
+	keys := make([]string, 0, len(def.Header))
+	for k := range def.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "header\x00%s\x00%s\x00", k, def.Header[k])
+	}
+
+	// app sections are written in the root filesystem before %post
+	keys = keys[:0]
+	for k := range def.CustomData {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "custom\x00%s\x00%s\x00", k, def.CustomData[k])
+	}
+
+	for _, section := range []string{"files", "post"} {
+		fmt.Fprintf(h, "run\x00%s\x00%t\x00", section, s.b.RunSection(section))
+	}
+	fmt.Fprintf(h, "post\x00%s\x00%s\x00", def.BuildData.Post.Args, def.BuildData.Post.Script)
+
+	// only secret ids are hashed, their content must not end up in
+	// the cache directory
+	keys = keys[:0]
+	for k := range s.b.Opts.Secrets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "secret\x00%s\x00", k)
+	}
+
+	for _, f := range def.BuildData.Files {
+		fmt.Fprintf(h, "files\x00%s\x00", f.Args)
+
+		// files are copied from the host, a previous stage or an image
+		root := ""
+		files := f.Files
+		if source, inline, ok := filesSource(f.Args); ok {
+			var err error
+			if root, err = b.filesRoot(source); err != nil {
+				return "", err
+			}
+			files = append(inline, files...)
+		}
+		for _, t := range files {
+			fmt.Fprintf(h, "%s\x00%s\x00", t.Src, t.Dst)
+			if t.Src == "" {
+				continue
+			}
+			if err := hashPath(h, filepath.Join(root, t.Src)); err != nil {
+				return "", fmt.Errorf("while hashing %s: %s", t.Src, err)
+			}
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// hashPath writes the relative path, mode and content of path and of
+// the files below it to h, symbolic links are followed like they are
+// when files are copied
+func hashPath(h hash.Hash, path string) error {
+	return filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		fi, err = os.Stat(p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%o\x00", rel, fi.Mode())
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(h, f)
+		return err
+	})
+}
+
+// restoreRootfs replaces the stage root filesystem by the one cached
+// with key, it returns false if no root filesystem is cached. The stage
+// root filesystem is left untouched on failure, so the sections can be
+// run instead.
+func (s *stage) restoreRootfs(key string) (bool, error) {
+	exists, err := cache.BuildRootfsExists(key)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	rootfs := s.b.Rootfs()
+
+	// extract aside to keep the bootstrapped root filesystem on failure
+	tmp, err := ioutil.TempDir(s.b.Path, "rootfs-cache-")
+	if err != nil {
+		return false, err
+	}
+	if err := runTar("-xpf", cache.BuildRootfs(key), "-C", tmp); err != nil {
+		os.RemoveAll(tmp)
+		return false, err
+	}
+	old := tmp + "-bootstrap"
+	if err := os.Rename(rootfs, old); err != nil {
+		os.RemoveAll(tmp)
+		return false, err
+	}
+	if err := os.Rename(tmp, rootfs); err != nil {
+		os.RemoveAll(tmp)
+		if rerr := os.Rename(old, rootfs); rerr != nil {
+			return false, fmt.Errorf("%s, and could not put back %s: %s", err, rootfs, rerr)
+		}
+		return false, err
+	}
+	if err := os.RemoveAll(old); err != nil {
+		sylog.Warningf("Could not remove %s: %s", old, err)
+	}
+	return true, nil
+}
+
+// storeRootfs caches the stage root filesystem with key
+func (s *stage) storeRootfs(key string) error {
+	f, err := ioutil.TempFile(cache.Build(), key+"-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	if err := runTar("-cpf", f.Name(), "-C", s.b.Rootfs(), "."); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	// concurrent builds may store the same key, the rename is atomic
+	if err := os.Rename(f.Name(), cache.BuildRootfs(key)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+func runTar(args ...string) error {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("tar", append([]string{"--numeric-owner", "--xattrs", "--xattrs-include=*"}, args...)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("tar failed: %s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// runSections runs the %setup, %files, %post and %test sections of the
+// stage. When useCache is set and section caching is enabled, the result
+// of %files and %post is restored from the build cache if available, and
+// cached otherwise. A cached result which can't be restored is ignored.
+func (s *stage) runSections(b *Build, useCache bool) error {
+	key := ""
+	if useCache && s.b.Opts.CacheSections && !s.b.Opts.NoCache {
+		var err error
+		if key, err = s.cacheKey(b); err != nil {
+			sylog.Warningf("Build cache disabled for this stage: %s", err)
+			key = ""
+		}
+	}
+
+	if key != "" {
+		restored, err := s.restoreRootfs(key)
+		if err != nil {
+			sylog.Warningf("Could not restore cached root filesystem, running sections: %s", err)
+		} else if restored {
+			sylog.Infof("Using cached result of %%files and %%post sections")
+			return s.runTestSection()
+		}
+	}
+
+	if s.b.RunSection("files") {
+		if err := s.copyFiles(b); err != nil {
+			return fmt.Errorf("unable to copy files a stage to container fs: %v", err)
+		}
+	}
+	removeSecrets, err := prepareSecrets(s.b)
+	if err != nil {
+		return err
+	}
+	// %test runs once the result is cached, like for restored results
+	noTest := s.b.Opts.NoTest
+	s.b.Opts.NoTest = true
+	err = runBuildEngine(s.b)
+	s.b.Opts.NoTest = noTest
+	// secret mount points never reach the cache or the image
+	if rerr := removeSecrets(); rerr != nil {
+		return rerr
+	}
+	if err != nil {
+		return fmt.Errorf("while running engine: %v", err)
+	}
+
+	if key != "" {
+		sylog.Debugf("Caching root filesystem with key %s", key)
+		if err := s.storeRootfs(key); err != nil {
+			sylog.Warningf("Could not cache root filesystem: %s", err)
+		}
+	}
+	return s.runTestSection()
+}
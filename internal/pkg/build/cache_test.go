@@ -0,0 +1,182 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/client/cache"
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// digestCP is a conveyor packer identifying its source by digest
+type digestCP struct {
+	digest string
+}
+
+func (cp *digestCP) Get(*types.Bundle) error      { return nil }
+func (cp *digestCP) Pack() (*types.Bundle, error) { return nil, nil }
+func (cp *digestCP) Digest() string               { return cp.digest }
+
+func TestCacheKey(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "cache-key-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostFile := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(hostFile, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newStage := func(digest string, edit func(*types.Definition)) *stage {
+		def := types.Definition{
+			Header: map[string]string{"bootstrap": "docker", "from": "alpine"},
+		}
+		def.BuildData.Post.Script = "apk add curl"
+		def.BuildData.Files = []types.Files{{Files: []types.FileTransport{{Src: hostFile, Dst: "/opt/file"}}}}
+		if edit != nil {
+			edit(&def)
+		}
+		return &stage{
+			c: &digestCP{digest},
+			b: &types.Bundle{Recipe: def, Opts: types.Options{Sections: []string{"all"}}},
+		}
+	}
+	key := func(s *stage) string {
+		k, err := s.cacheKey(&Build{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return k
+	}
+
+	base := key(newStage("sha256:1", nil))
+	if base == "" {
+		t.Fatalf("unexpected empty cache key")
+	}
+	if k := key(newStage("sha256:1", nil)); k != base {
+		t.Errorf("unexpected different key for the same stage")
+	}
+	if k := key(newStage("", nil)); k != "" {
+		t.Errorf("unexpected key without source digest")
+	}
+
+	// changes of the source, %post and %files change the key
+	changes := map[string]*stage{
+		"source": newStage("sha256:2", nil),
+		"post": newStage("sha256:1", func(d *types.Definition) {
+			d.BuildData.Post.Script = "apk add wget"
+		}),
+		"files destination": newStage("sha256:1", func(d *types.Definition) {
+			d.BuildData.Files[0].Files[0].Dst = "/opt/other"
+		}),
+		"files arguments": newStage("sha256:1", func(d *types.Definition) {
+			d.BuildData.Files[0].Args = "--ignored"
+		}),
+	}
+	for name, s := range changes {
+		if k := key(s); k == base || k == "" {
+			t.Errorf("%s: unexpected key %q", name, k)
+		}
+	}
+
+	// the content of copied files is hashed, also with section arguments
+	withArgs := func(d *types.Definition) { d.BuildData.Files[0].Args = "--ignored" }
+	before := key(newStage("sha256:1", withArgs))
+	if err := ioutil.WriteFile(hostFile, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if k := key(newStage("sha256:1", nil)); k == base {
+		t.Errorf("unexpected same key after changing a copied file")
+	}
+	if k := key(newStage("sha256:1", withArgs)); k == before {
+		t.Errorf("unexpected same key after changing a copied file of a section with arguments")
+	}
+
+	// %setup can read any host file, its result is not cached
+	setup := newStage("sha256:1", func(d *types.Definition) {
+		d.BuildData.Setup.Script = "cp /etc/hosts $SINGULARITY_ROOTFS/etc/hosts"
+	})
+	if k := key(setup); k != "" {
+		t.Errorf("unexpected key %q for a stage with %%setup", k)
+	}
+
+	// missing files disable the cache
+	missing := newStage("sha256:1", func(d *types.Definition) {
+		d.BuildData.Files[0].Files[0].Src = filepath.Join(dir, "missing")
+	})
+	if _, err := missing.cacheKey(&Build{}); err == nil {
+		t.Errorf("unexpected success with a missing file")
+	}
+}
+
+func TestRestoreRootfs(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "cache-restore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv(cache.DirEnv, filepath.Join(dir, "cache"))
+	defer os.Unsetenv(cache.DirEnv)
+
+	b, err := types.NewBundle(dir, "sbuild-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stage{b: b}
+	marker := filepath.Join(b.Rootfs(), "bootstrapped")
+	if err := ioutil.WriteFile(marker, []byte("ok"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a corrupted archive leaves the bootstrapped root filesystem
+	if err := ioutil.WriteFile(cache.BuildRootfs("key"), []byte("not an archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if restored, err := s.restoreRootfs("key"); err == nil || restored {
+		t.Errorf("unexpected restore of a corrupted archive")
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("bootstrapped root filesystem not kept: %s", err)
+	}
+
+	// a cached root filesystem replaces the bootstrapped one
+	cached := filepath.Join(dir, "cached")
+	if err := os.Mkdir(cached, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cached, "built"), []byte("ok"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runTar("-cpf", cache.BuildRootfs("key"), "-C", cached, "."); err != nil {
+		t.Fatal(err)
+	}
+	if restored, err := s.restoreRootfs("key"); err != nil || !restored {
+		t.Fatalf("unexpected restore failure: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(b.Rootfs(), "built")); err != nil {
+		t.Errorf("cached root filesystem not restored: %s", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("bootstrapped root filesystem not replaced")
+	}
+	if entries, _ := ioutil.ReadDir(b.Path); len(entries) != 1 {
+		t.Errorf("unexpected bundle entries %v", entries)
+	}
+}
@@ -15,9 +15,11 @@ import (
 
 // Copy calls cp with src and dst as its arguments
 // checks dst and creates parent directories if they do not exist
-// before calling cp
+// before calling cp. Symbolic links are copied as links and never
+// followed, neither in src nor for dst, so a copy from an image root
+// filesystem can't read host files through its links
 func Copy(src, dst string) error {
-	_, err := os.Stat(dst)
+	_, err := os.Lstat(dst)
 	if os.IsNotExist(err) {
 		// if destination doesn't exist, create parent directories
 		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
@@ -27,7 +29,7 @@ func Copy(src, dst string) error {
 
 	var output, stderr bytes.Buffer
 	// copy each file into bundle rootfs
-	copy := exec.Command("/bin/cp", "-fLr", src, dst)
+	copy := exec.Command("/bin/cp", "-fPr", src, dst)
 	copy.Stdout = &output
 	copy.Stderr = &stderr
 	if err := copy.Run(); err != nil {
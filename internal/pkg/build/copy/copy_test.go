@@ -139,6 +139,85 @@ func TestCopyDir(t *testing.T) {
 	}
 }
 
+func TestCopySymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copy-test-symlink-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the link target stands for a host file outside of an image
+	target := filepath.Join(dir, "hostFile")
+	if err := ioutil.WriteFile(target, []byte(sourceFileContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srcDir := filepath.Join(dir, "sourceDir")
+	if err := os.Mkdir(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	srcLink := filepath.Join(srcDir, "link")
+	if err := os.Symlink(target, srcLink); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		src       string
+		dst       string
+		finalpath string
+	}{
+		{"Link", srcLink, "destLink", "destLink"},
+		{"LinkInDir", srcDir, "destDir", "destDir/link"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dstDir, err := ioutil.TempDir("", "copy-test-dst-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dstDir)
+
+			if err := Copy(tt.src, filepath.Join(dstDir, tt.dst)); err != nil {
+				t.Fatalf("unexpected failure running %s test: %s", t.Name(), err)
+			}
+
+			dstFinal := filepath.Join(dstDir, tt.finalpath)
+			fi, err := os.Lstat(dstFinal)
+			if err != nil {
+				t.Fatalf("failure to correctly copy link %s test: %s", t.Name(), err)
+			}
+			if fi.Mode()&os.ModeSymlink == 0 {
+				t.Errorf("unexpected link target copy for %s test", t.Name())
+			} else if link, _ := os.Readlink(dstFinal); link != target {
+				t.Errorf("unexpected link %s for %s test", link, t.Name())
+			}
+		})
+	}
+
+	t.Run("DanglingDst", func(t *testing.T) {
+		dstDir, err := ioutil.TempDir("", "copy-test-dst-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dstDir)
+
+		// a dangling link must not be written through, nor have
+		// the parent directories of its target created
+		outside := filepath.Join(dir, "outside", "file")
+		dst := filepath.Join(dstDir, "dangling")
+		if err := os.Symlink(outside, dst); err != nil {
+			t.Fatal(err)
+		}
+		if err := Copy(target, dst); err == nil {
+			t.Errorf("unexpected success copying through a dangling link")
+		}
+		if _, err := os.Lstat(filepath.Dir(outside)); !os.IsNotExist(err) {
+			t.Errorf("unexpected file created out of destination")
+		}
+	})
+}
+
 func TestCopyFail(t *testing.T) {
 	// create tmpdir
 	dir, err := ioutil.TempDir("", "copy-test-src")
@@ -0,0 +1,279 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/sylabs/singularity/internal/pkg/build/copy"
+	"github.com/sylabs/singularity/internal/pkg/build/fakeroot"
+	"github.com/sylabs/singularity/internal/pkg/build/proot"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/files"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// WarnFakerootLimitations reports what build scripts can't do in the
+// privilege mode of builds run without root privileges
+func WarnFakerootLimitations(mode fakeroot.Mode) {
+	limitations := mode.Limitations()
+	if len(limitations) == 0 {
+		return
+	}
+	sylog.Warningf("Building without root privileges with %s, build scripts have limitations:", mode)
+	for _, l := range limitations {
+		sylog.Warningf("  - %s", l)
+	}
+}
+
+// scriptCommand returns the command running argv in the root filesystem
+// of a build, the secrets are made available when secrets is set
+type scriptCommand func(argv []string, secrets bool) (*exec.Cmd, error)
+
+// runFakerootEngine runs the %setup, %files, %post and %test sections of
+// bundle b like the build engine, with the fakechroot or proot commands
+// instead of a container
+func runFakerootEngine(b *types.Bundle) error {
+	if !b.Opts.HostNetwork() {
+		return fmt.Errorf("only the host network is available to build scripts run by %s", b.Opts.FakerootMode)
+	}
+
+	// surface build specific environment variables for scripts
+	buildEnv := []string{
+		"SINGULARITY_ROOTFS=" + b.Rootfs(),
+		"SINGULARITY_ENVIRONMENT=/.singularity.d/env/91-environment.sh",
+	}
+	if b.Opts.Reproducible {
+		// honored by most tools writing timestamps
+		buildEnv = append(buildEnv, fmt.Sprintf("SOURCE_DATE_EPOCH=%d", b.Opts.SourceDateEpoch))
+	}
+
+	if b.RunSection("setup") && b.Recipe.BuildData.Setup.Script != "" {
+		argv, script, err := proot.ScriptArgs("setup", b.Recipe.BuildData.Setup)
+		if err != nil {
+			return err
+		}
+		cmd := exec.Command(argv[0], argv[1:]...)
+		cmd.Env = append(os.Environ(), buildEnv...)
+		if err := runFakerootScript("setup", cmd, script, 0); err != nil {
+			return err
+		}
+	}
+
+	if b.RunSection("files") {
+		sylog.Debugf("Copying files from host")
+		if err := copyHostFiles(b); err != nil {
+			return fmt.Errorf("unable to copy files to container fs: %v", err)
+		}
+	}
+
+	// the environment is cleaned like in build containers
+	g := generate.Generator{Config: &specs.Spec{}}
+	env.SetContainerEnv(&g, os.Environ(), true, "/root")
+	scriptEnv := append(g.Config.Process.Env, buildEnv...)
+
+	var command scriptCommand
+	switch fakeroot.Mode(b.Opts.FakerootMode) {
+	case fakeroot.Fakechroot:
+		if len(b.Opts.Secrets) > 0 || b.Opts.DNS != "" || b.Opts.ResolvConf != "" {
+			return fmt.Errorf("--secret, --dns and --resolv-conf are not supported by fakechroot builds")
+		}
+		command = func(argv []string, secrets bool) (*exec.Cmd, error) {
+			args, err := fakeroot.FakechrootArgs(b.Rootfs(), argv...)
+			if err != nil {
+				return nil, err
+			}
+			cmd := exec.Command(args[0], args[1:]...)
+			cmd.Env = fakeroot.FakechrootEnv(scriptEnv)
+			return cmd, nil
+		}
+	case fakeroot.Proot:
+		path, err := proot.Find()
+		if err != nil {
+			return err
+		}
+		c, err := prootConfig(b, path, scriptEnv)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(c.tmpDir)
+
+		command = func(argv []string, secrets bool) (*exec.Cmd, error) {
+			config := c.Config
+			if secrets {
+				config.Binds = append([]proot.Bind{}, c.Binds...)
+				for id, src := range b.Opts.Secrets {
+					config.Binds = append(config.Binds, proot.Bind{Src: src, Dst: filepath.Join(types.SecretsDir, id)})
+				}
+			}
+			return config.Command(argv...), nil
+		}
+	default:
+		return fmt.Errorf("unsupported privilege mode %q to run build scripts", b.Opts.FakerootMode)
+	}
+
+	if b.RunSection("post") && b.Recipe.BuildData.Post.Script != "" {
+		// secrets are only available to %post
+		if err := runFakerootSection(command, "post", b.Recipe.BuildData.Post, true, 0); err != nil {
+			return err
+		}
+	}
+
+	if b.RunSection("test") && !b.Opts.NoTest && b.Recipe.BuildData.Test.Script != "" {
+		opts := b.Opts
+		test := b.Recipe.BuildData.Test
+		err := runFakerootSection(command, "test", test, false, opts.TestTimeout)
+		for retry := 1; err != nil && retry <= opts.TestRetries; retry++ {
+			sylog.Warningf("%s, retrying (%d/%d)", err, retry, opts.TestRetries)
+			err = runFakerootSection(command, "test", test, false, opts.TestTimeout)
+		}
+		return err
+	}
+	return nil
+}
+
+// prootRun is the proot configuration of build scripts with the temporary
+// directory holding the files bound in the root filesystem
+type prootRun struct {
+	proot.Config
+	tmpDir string
+}
+
+// prootConfig returns the proot configuration running the scripts of
+// bundle b with the environment env
+func prootConfig(b *types.Bundle, path string, env []string) (*prootRun, error) {
+	c := &prootRun{
+		Config: proot.Config{
+			Path:   path,
+			Rootfs: b.Rootfs(),
+			Env:    env,
+		},
+	}
+	for _, p := range proot.DefaultBinds {
+		if _, err := os.Stat(p); err == nil {
+			c.Binds = append(c.Binds, proot.Bind{Src: p})
+		}
+	}
+
+	// the resolv.conf of DNS servers is kept out of the root filesystem
+	resolvConf := "/etc/resolv.conf"
+	if b.Opts.ResolvConf != "" {
+		resolvConf = b.Opts.ResolvConf
+	}
+	if b.Opts.DNS != "" {
+		content, err := files.ResolvConf(strings.Split(strings.Replace(b.Opts.DNS, " ", "", -1), ","))
+		if err != nil {
+			return nil, err
+		}
+		c.tmpDir, err = ioutil.TempDir(b.Path, "proot-")
+		if err != nil {
+			return nil, err
+		}
+		resolvConf = filepath.Join(c.tmpDir, "resolv.conf")
+		if err := ioutil.WriteFile(resolvConf, content, 0644); err != nil {
+			os.RemoveAll(c.tmpDir)
+			return nil, fmt.Errorf("while writing resolv.conf: %s", err)
+		}
+	}
+	c.Binds = append(c.Binds, proot.Bind{Src: resolvConf, Dst: "/etc/resolv.conf"})
+	return c, nil
+}
+
+// copyHostFiles copies the files of the %files section without source
+// from the host to the root filesystem of bundle b
+func copyHostFiles(b *types.Bundle) error {
+	for _, f := range b.Recipe.BuildData.Files {
+		if f.Args != "" {
+			continue
+		}
+		for _, transfer := range f.Files {
+			if transfer.Src == "" {
+				sylog.Warningf("Attempt to copy file with no name, skipping.")
+				continue
+			}
+			// dest = source if not specified
+			if transfer.Dst == "" {
+				transfer.Dst = transfer.Src
+			}
+			transfer.Dst = filepath.Join(b.Rootfs(), transfer.Dst)
+			sylog.Infof("Copying %v to %v", transfer.Src, transfer.Dst)
+			if err := copy.Copy(transfer.Src, transfer.Dst); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runFakerootSection runs the script of section name with the command
+// returned by command
+func runFakerootSection(command scriptCommand, name string, s types.Script, secrets bool, timeout time.Duration) error {
+	argv, script, err := proot.ScriptArgs(name, s)
+	if err != nil {
+		return err
+	}
+	cmd, err := command(argv, secrets)
+	if err != nil {
+		return err
+	}
+	return runFakerootScript(name, cmd, script, timeout)
+}
+
+// runFakerootScript pipes script to cmd, the process group of cmd is killed
+// once timeout expired if it's not 0
+func runFakerootScript(name string, cmd *exec.Cmd, script string, timeout time.Duration) error {
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if timeout > 0 {
+		// the script and its children are killed together
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("while creating %s proc pipe: %v", name, err)
+	}
+
+	sylog.Infof("Running %s scriptlet\n", name)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %%%s proc: %v", name, err)
+	}
+
+	var timedOut int32
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		})
+		defer timer.Stop()
+	}
+
+	// pipe in script
+	go func() {
+		defer stdin.Close()
+		io.WriteString(stdin, script)
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		if atomic.LoadInt32(&timedOut) == 1 {
+			return fmt.Errorf("%s proc: killed after %s timeout", name, timeout)
+		}
+		return fmt.Errorf("%s proc: %v", name, err)
+	}
+	return nil
+}
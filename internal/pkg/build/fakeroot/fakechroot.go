@@ -0,0 +1,46 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fakeroot
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// chrootPaths are the usual locations of the chroot command, often not
+// in the PATH of users
+var chrootPaths = []string{"chroot", "/usr/sbin/chroot", "/sbin/chroot"}
+
+// excludedPaths are the host paths kept visible by fakechroot in the
+// root filesystem
+var excludedPaths = []string{"/proc", "/sys", "/dev", "/tmp", "/var/tmp"}
+
+// findChroot returns the path of the chroot command
+func findChroot(lookPath func(string) (string, error)) (string, error) {
+	for _, p := range chrootPaths {
+		if path, err := lookPath(p); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("chroot command not found")
+}
+
+// FakechrootArgs returns the command line running argv in rootfs as a
+// fake root user with fakechroot and fakeroot
+func FakechrootArgs(rootfs string, argv ...string) ([]string, error) {
+	chroot, err := findChroot(exec.LookPath)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{"fakechroot", "fakeroot", chroot, rootfs}, argv...), nil
+}
+
+// FakechrootEnv returns the environment variables of fakechroot added to
+// env
+func FakechrootEnv(env []string) []string {
+	return append(env, "FAKECHROOT_EXCLUDE_PATH="+strings.Join(excludedPaths, ":"))
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package fakeroot selects how users without root privileges build images
+// as a fake root user. Privilege modes are probed in order and the first
+// one available on the host is selected, the reasons why the previous
+// ones were not are kept to be reported.
+package fakeroot
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+
+	"github.com/sylabs/singularity/internal/pkg/build/proot"
+	"github.com/sylabs/singularity/pkg/util/features"
+)
+
+// Mode is a privilege mode of builds run without root privileges
+type Mode string
+
+const (
+	// Setuid runs the build engine through starter-suid
+	Setuid Mode = "setuid"
+	// UserNamespace runs the build engine in an unprivileged user
+	// namespace where the user is mapped to root
+	UserNamespace Mode = "userns"
+	// Fakechroot runs build scripts with the fakeroot command in a
+	// root filesystem emulated by fakechroot
+	Fakechroot Mode = "fakechroot"
+	// Proot runs build scripts with proot
+	Proot Mode = "proot"
+)
+
+// Modes are the privilege modes in the order they are probed
+var Modes = []Mode{Setuid, UserNamespace, Fakechroot, Proot}
+
+// Description returns how build scripts are run in mode m
+func (m Mode) Description() string {
+	switch m {
+	case Setuid:
+		return "build engine started by starter-suid"
+	case UserNamespace:
+		return "build engine in a user namespace mapping the user to root"
+	case Fakechroot:
+		return "fakeroot command in a fakechroot environment"
+	case Proot:
+		return "proot emulating root privileges"
+	}
+	return string(m)
+}
+
+// Limitations returns what build scripts can't do in mode m compared to
+// builds run by root
+func (m Mode) Limitations() []string {
+	switch m {
+	case UserNamespace:
+		return []string{
+			"files are owned by the user, changing their owner to other users or groups fails",
+			"device files can't be created",
+			"only the host network is available",
+		}
+	case Fakechroot:
+		return []string{
+			"statically linked programs escape fakechroot and fakeroot",
+			"root privileges are faked, files are owned by the user and ownership changes are not kept",
+			"setuid and setgid bits and device files are not kept",
+			"mount, network and other privileged operations fail",
+			"--secret, --dns and --resolv-conf are not available",
+			"%setup and %pre run on the host as the user",
+		}
+	case Proot:
+		return proot.Limitations
+	}
+	return nil
+}
+
+// Probe is the result of the probe of a privilege mode, Reason explains
+// why it is not available
+type Probe struct {
+	Mode      Mode
+	Available bool
+	Reason    string
+}
+
+// Selection is the privilege mode selected for a build along with the
+// probes of the modes preceding it
+type Selection struct {
+	Mode   Mode
+	Probes []Probe
+}
+
+// Report returns a readable report of the selected mode and of why the
+// previous modes were not selected
+func (s *Selection) Report() string {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "Building as fake root with %s (%s)", s.Mode, s.Mode.Description())
+	for _, p := range s.Probes {
+		if !p.Available {
+			fmt.Fprintf(&b, "\n  %s not available: %s", p.Mode, p.Reason)
+		}
+	}
+	return b.String()
+}
+
+// Select probes the privilege modes in order and returns the first one
+// available, m is the status of the host privileged features. An error
+// listing why each mode is not available is returned when none is.
+func Select(m features.Matrix) (*Selection, error) {
+	return selectMode(m, exec.LookPath)
+}
+
+// Force returns the selection of mode m if it's available
+func Force(m features.Matrix, mode Mode) (*Selection, error) {
+	p := probe(mode, m, exec.LookPath)
+	if !p.Available {
+		return nil, fmt.Errorf("%s not available: %s", mode, p.Reason)
+	}
+	return &Selection{Mode: mode, Probes: []Probe{p}}, nil
+}
+
+func selectMode(m features.Matrix, lookPath func(string) (string, error)) (*Selection, error) {
+	s := &Selection{}
+	for _, mode := range Modes {
+		p := probe(mode, m, lookPath)
+		s.Probes = append(s.Probes, p)
+		if p.Available {
+			s.Mode = mode
+			return s, nil
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("no way to build without root privileges on this host:")
+	for _, p := range s.Probes {
+		fmt.Fprintf(&b, "\n  %s: %s", p.Mode, p.Reason)
+	}
+	return nil, fmt.Errorf("%s", b.String())
+}
+
+func probe(mode Mode, m features.Matrix, lookPath func(string) (string, error)) Probe {
+	reason := ""
+
+	switch mode {
+	case Setuid:
+		if s := m.Get(features.Setuid); !s.Available {
+			reason = s.Reason
+		} else {
+			// the starter doesn't create user namespaces in the setuid
+			// workflow, build scripts would run with real root privileges
+			reason = "the build engine doesn't allow the setuid workflow, it would grant real root privileges"
+		}
+	case UserNamespace:
+		if s := m.Get(features.UserNamespace); !s.Available {
+			reason = s.Reason
+		}
+	case Fakechroot:
+		for _, name := range []string{"fakechroot", "fakeroot"} {
+			if _, err := lookPath(name); err != nil {
+				reason = fmt.Sprintf("%s command not found in PATH", name)
+				break
+			}
+		}
+		if reason == "" {
+			if _, err := findChroot(lookPath); err != nil {
+				reason = err.Error()
+			}
+		}
+	case Proot:
+		if _, err := lookPath("proot"); err != nil {
+			reason = "proot command not found in PATH"
+		}
+	default:
+		reason = "unknown privilege mode"
+	}
+	return Probe{Mode: mode, Available: reason == "", Reason: reason}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fakeroot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/util/features"
+)
+
+// lookPathIn returns a lookPath function finding only commands
+func lookPathIn(commands ...string) func(string) (string, error) {
+	return func(name string) (string, error) {
+		for _, c := range commands {
+			if c == name {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", fmt.Errorf("%s not found", name)
+	}
+}
+
+func TestSelectMode(t *testing.T) {
+	setuid := features.Status{Feature: features.Setuid, Available: true}
+	noSetuid := features.Status{Feature: features.Setuid, Reason: "starter-suid is not installed"}
+	userns := features.Status{Feature: features.UserNamespace, Available: true}
+	noUserns := features.Status{Feature: features.UserNamespace, Reason: "disabled by user.max_user_namespaces sysctl"}
+
+	tests := []struct {
+		name     string
+		matrix   features.Matrix
+		commands []string
+		mode     Mode
+		reasons  []string
+	}{
+		{
+			name:    "user namespace",
+			matrix:  features.Matrix{setuid, userns},
+			mode:    UserNamespace,
+			reasons: []string{"the build engine doesn't allow the setuid workflow"},
+		},
+		{
+			name:     "fakechroot",
+			matrix:   features.Matrix{noSetuid, noUserns},
+			commands: []string{"fakechroot", "fakeroot", "chroot", "proot"},
+			mode:     Fakechroot,
+			reasons:  []string{"starter-suid is not installed", "disabled by user.max_user_namespaces sysctl"},
+		},
+		{
+			name:     "chroot in sbin",
+			matrix:   features.Matrix{noSetuid, noUserns},
+			commands: []string{"fakechroot", "fakeroot", "/usr/sbin/chroot"},
+			mode:     Fakechroot,
+		},
+		{
+			name:     "proot",
+			matrix:   features.Matrix{noSetuid, noUserns},
+			commands: []string{"fakechroot", "chroot", "proot"},
+			mode:     Proot,
+			reasons:  []string{"fakeroot command not found in PATH"},
+		},
+		{
+			name:     "none",
+			matrix:   features.Matrix{noSetuid, noUserns},
+			commands: []string{"fakeroot"},
+			reasons:  []string{"fakechroot command not found in PATH", "proot command not found in PATH"},
+		},
+	}
+
+	for _, tt := range tests {
+		s, err := selectMode(tt.matrix, lookPathIn(tt.commands...))
+		if tt.mode == "" {
+			if err == nil {
+				t.Errorf("%s: unexpected selection of %s", tt.name, s.Mode)
+				continue
+			}
+			for _, r := range tt.reasons {
+				if !strings.Contains(err.Error(), r) {
+					t.Errorf("%s: %q missing from error %q", tt.name, r, err)
+				}
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if s.Mode != tt.mode {
+			t.Errorf("%s: unexpected mode %s instead of %s", tt.name, s.Mode, tt.mode)
+		}
+		if last := s.Probes[len(s.Probes)-1]; last.Mode != tt.mode || !last.Available {
+			t.Errorf("%s: selected mode is not the last probed", tt.name)
+		}
+		report := s.Report()
+		if !strings.HasPrefix(report, fmt.Sprintf("Building as fake root with %s", tt.mode)) {
+			t.Errorf("%s: unexpected report %q", tt.name, report)
+		}
+		for _, r := range tt.reasons {
+			if !strings.Contains(report, r) {
+				t.Errorf("%s: %q missing from report %q", tt.name, r, report)
+			}
+		}
+	}
+}
+
+func TestLimitations(t *testing.T) {
+	for _, m := range Modes {
+		if m == Setuid {
+			continue
+		}
+		if len(m.Limitations()) == 0 {
+			t.Errorf("no limitations reported for %s", m)
+		}
+		if m.Description() == string(m) {
+			t.Errorf("no description of %s", m)
+		}
+	}
+}
+
+func TestFakechrootEnv(t *testing.T) {
+	env := FakechrootEnv([]string{"PATH=/bin"})
+	if len(env) != 2 || env[1] != "FAKECHROOT_EXCLUDE_PATH=/proc:/sys:/dev:/tmp:/var/tmp" {
+		t.Errorf("unexpected environment %v", env)
+	}
+}
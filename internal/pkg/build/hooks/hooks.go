@@ -0,0 +1,72 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package hooks runs the host scripts configured in singularity.conf
+// before and after builds, so sites can apply scanning, signing or
+// registration policies to built images. Hooks are advisory, they run as
+// the user and only for the build command.
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// Stage is the build stage a hook runs at
+type Stage string
+
+const (
+	// PreBuild hooks run before the bootstrap, the build is aborted when
+	// one of them fails
+	PreBuild Stage = "pre-build"
+	// PostBuild hooks run once the image is created, the build fails when
+	// one of them fails but the image is kept
+	PostBuild Stage = "post-build"
+)
+
+// Build describes the build passed to hooks
+type Build struct {
+	// Definition is the definition file path, or the build source URI
+	Definition string
+	// Dest is the image path, or the destination URI
+	Dest string
+	// Format is the image format: sif, sandbox or oci
+	Format string
+}
+
+// Env returns the environment variables describing the build to a hook
+// of stage
+func (b Build) Env(stage Stage) []string {
+	return []string{
+		"SINGULARITY_BUILD_HOOK=" + string(stage),
+		"SINGULARITY_BUILD_DEFINITION=" + b.Definition,
+		"SINGULARITY_BUILD_DEST=" + b.Dest,
+		"SINGULARITY_BUILD_FORMAT=" + b.Format,
+	}
+}
+
+// Run executes the hook scripts of stage one after the other with the
+// definition and the image as arguments, it stops at the first failure.
+func Run(stage Stage, scripts []string, b Build) error {
+	for _, script := range scripts {
+		if !filepath.IsAbs(script) {
+			return fmt.Errorf("%s hook %s is not an absolute path", stage, script)
+		}
+		sylog.Infof("Running %s hook %s", stage, script)
+
+		cmd := exec.Command(script, b.Definition, b.Dest)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), b.Env(stage)...)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook %s failed: %s", stage, script, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package hooks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeScript(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+content), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooks-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	record := filepath.Join(dir, "record.sh")
+	writeScript(t, record, `echo "$SINGULARITY_BUILD_HOOK $1 $2 $SINGULARITY_BUILD_FORMAT" >> `+out+"\n")
+	fail := filepath.Join(dir, "fail.sh")
+	writeScript(t, fail, "exit 1\n")
+
+	b := Build{Definition: "/tmp/app.def", Dest: "/tmp/app.sif", Format: "sif"}
+	if err := Run(PreBuild, []string{record}, b); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := Run(PostBuild, []string{record, fail, record}, b); err == nil {
+		t.Fatalf("unexpected success with failing hook")
+	}
+
+	// hooks after a failure don't run
+	content, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "pre-build /tmp/app.def /tmp/app.sif sif\npost-build /tmp/app.def /tmp/app.sif sif\n"
+	if string(content) != expected {
+		t.Errorf("unexpected hook output:\n%s", content)
+	}
+
+	if err := Run(PreBuild, []string{"record.sh"}, b); err == nil {
+		t.Errorf("unexpected success with relative hook path")
+	}
+}
@@ -13,11 +13,11 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/image"
 )
 
 func (s *stage) insertMetadata() (err error) {
@@ -63,6 +63,12 @@ func (s *stage) insertMetadata() (err error) {
 		return fmt.Errorf("While inserting test script: %v", err)
 	}
 
+	// record seccomp profile
+	err = insertSeccompProfile(s.b)
+	if err != nil {
+		return fmt.Errorf("While inserting seccomp profile: %v", err)
+	}
+
 	return
 }
 
@@ -204,6 +210,23 @@ func insertDefinition(b *types.Bundle) error {
 	return nil
 }
 
+// insertSeccompProfile stores the seccomp profile copied in the image
+// for the assembler, it's added to SIF images as a JSON data object
+func insertSeccompProfile(b *types.Bundle) error {
+	data, err := ioutil.ReadFile(filepath.Join(b.Rootfs(), image.SeccompProfilePath))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("%s is not a valid JSON document", image.SeccompProfilePath)
+	}
+	sylog.Infof("Adding seccomp profile")
+	b.JSONObjects["seccomp"] = data
+	return nil
+}
+
 func insertLabelsJSON(b *types.Bundle) (err error) {
 	var text []byte
 	labels := make(map[string]string)
@@ -273,7 +296,7 @@ func addBuildLabels(labels map[string]string, b *types.Bundle) error {
 	labels["org.label-schema.schema-version"] = "1.0"
 
 	// build date and time, lots of time formatting
-	currentTime := time.Now()
+	currentTime := buildTime(b)
 	year, month, day := currentTime.Date()
 	date := strconv.Itoa(day) + `_` + month.String() + `_` + strconv.Itoa(year)
 	hour, min, sec := currentTime.Clock()
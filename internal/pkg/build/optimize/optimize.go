@@ -0,0 +1,222 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package optimize implements the optimization passes run on the root
+// filesystem of images before they are assembled, to reduce their size.
+package optimize
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// Pass modifies the root filesystem of an image
+type Pass struct {
+	Name string
+	// Description is displayed by --optimize help
+	Description string
+	Run         func(rootfs string) error
+}
+
+// Plan holds the passes and the squashfs compression selected by an
+// --optimize specification
+type Plan struct {
+	// Passes are the names of the passes to run in registration order
+	Passes []string
+	// Compression is the squashfs compression algorithm, mksquashfs
+	// default is used when empty
+	Compression string
+	// ResetTimestamps clamps file times to SOURCE_DATE_EPOCH like
+	// reproducible builds do, it's selected with reset-timestamps
+	ResetTimestamps bool
+}
+
+// resetTimestamps is the name selecting Plan.ResetTimestamps, file times
+// are clamped by the build once all passes ran
+const resetTimestamps = "reset-timestamps"
+
+// SIFOnly are the passes only run for SIF images, hard links of a
+// sandbox would share modifications of any of the linked files
+var SIFOnly = []string{"dedupe"}
+
+// profile is a named set of passes with a compression algorithm
+type profile struct {
+	name        string
+	description string
+	plan        Plan
+}
+
+// compressions are the squashfs compression algorithms
+var compressions = []string{"gzip", "lzo", "lz4", "xz", "zstd"}
+
+var passes = []Pass{
+	{"strip-docs", "remove documentation, man and info pages except licenses", stripDocs},
+	{"strip-locales", "remove message translations except English", stripLocales},
+	{"dedupe", "replace identical files by hard links, SIF images only", dedupe},
+}
+
+var profiles = []profile{
+	{
+		name:        "safe",
+		description: "keep the image content, normalize it for deduplication",
+		plan:        Plan{Passes: []string{"dedupe"}, ResetTimestamps: true},
+	},
+	{
+		name:        "small",
+		description: "strip documentation and translations, compress with xz",
+		plan: Plan{
+			Passes:          []string{"strip-docs", "strip-locales", "dedupe"},
+			Compression:     "xz",
+			ResetTimestamps: true,
+		},
+	},
+}
+
+// Register adds a pass, the passes registered by plugins run after the
+// built-in ones
+func Register(p Pass) error {
+	if p.Name == "" || p.Name == "help" || p.Name == resetTimestamps || strings.ContainsAny(p.Name, ",=") {
+		return fmt.Errorf("invalid optimization pass name %q", p.Name)
+	}
+	if _, ok := lookup(p.Name); ok {
+		return fmt.Errorf("optimization pass %s already exists", p.Name)
+	}
+	for _, pr := range profiles {
+		if pr.name == p.Name {
+			return fmt.Errorf("optimization pass %s conflicts with a profile name", p.Name)
+		}
+	}
+	passes = append(passes, p)
+	return nil
+}
+
+func lookup(name string) (Pass, bool) {
+	for _, p := range passes {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Pass{}, false
+}
+
+// Parse returns the plan of the comma separated list of profiles, pass
+// names and compress=<algorithm> of spec
+func Parse(spec string) (Plan, error) {
+	var plan Plan
+	selected := make(map[string]bool)
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if strings.HasPrefix(item, "compress=") {
+			c := strings.TrimPrefix(item, "compress=")
+			if !validCompression(c) {
+				return plan, fmt.Errorf("unsupported compression %s, choose between: %s", c, strings.Join(compressions, ", "))
+			}
+			plan.Compression = c
+			continue
+		}
+		if item == resetTimestamps {
+			plan.ResetTimestamps = true
+			continue
+		}
+
+		found := false
+		for _, pr := range profiles {
+			if pr.name != item {
+				continue
+			}
+			for _, p := range pr.plan.Passes {
+				selected[p] = true
+			}
+			if pr.plan.Compression != "" {
+				plan.Compression = pr.plan.Compression
+			}
+			if pr.plan.ResetTimestamps {
+				plan.ResetTimestamps = true
+			}
+			found = true
+		}
+		if _, ok := lookup(item); ok {
+			selected[item] = true
+			found = true
+		}
+		if !found {
+			return plan, fmt.Errorf("unknown optimization profile or pass %s", item)
+		}
+	}
+
+	for _, p := range passes {
+		if selected[p.Name] {
+			plan.Passes = append(plan.Passes, p.Name)
+		}
+	}
+	return plan, nil
+}
+
+func validCompression(c string) bool {
+	for _, v := range compressions {
+		if c == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove removes the pass name from the plan and returns if it was
+// selected
+func (p *Plan) Remove(name string) bool {
+	for i, n := range p.Passes {
+		if n == name {
+			p.Passes = append(p.Passes[:i:i], p.Passes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs the passes of the plan on the root filesystem rootfs
+func (p Plan) Run(rootfs string) error {
+	for _, name := range p.Passes {
+		pass, ok := lookup(name)
+		if !ok {
+			return fmt.Errorf("unknown optimization pass %s", name)
+		}
+		sylog.Infof("Running optimization pass %s", name)
+		if err := pass.Run(rootfs); err != nil {
+			return fmt.Errorf("optimization pass %s failed: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Help returns the description of the profiles and passes
+func Help() string {
+	var b strings.Builder
+
+	b.WriteString("Profiles:\n")
+	for _, pr := range profiles {
+		fmt.Fprintf(&b, "  %-18s %s (%s", pr.name, pr.description, strings.Join(pr.plan.Passes, ", "))
+		if pr.plan.ResetTimestamps {
+			fmt.Fprintf(&b, ", %s", resetTimestamps)
+		}
+		if pr.plan.Compression != "" {
+			fmt.Fprintf(&b, ", compress=%s", pr.plan.Compression)
+		}
+		b.WriteString(")\n")
+	}
+	b.WriteString("Passes:\n")
+	for _, p := range passes {
+		fmt.Fprintf(&b, "  %-18s %s\n", p.Name, p.Description)
+	}
+	fmt.Fprintf(&b, "  %-18s %s\n", resetTimestamps, "clamp file times to SOURCE_DATE_EPOCH like --reproducible, 0 when unset")
+	fmt.Fprintf(&b, "Compression:\n  compress=<alg>     squashfs compression, one of %s\n", strings.Join(compressions, ", "))
+	return b.String()
+}
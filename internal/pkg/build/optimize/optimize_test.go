@@ -0,0 +1,217 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package optimize
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		expected Plan
+		fail     bool
+	}{
+		{"empty", "", Plan{}, false},
+		{"safe", "safe", Plan{Passes: []string{"dedupe"}, ResetTimestamps: true}, false},
+		{"small", "small", Plan{Passes: []string{"strip-docs", "strip-locales", "dedupe"}, Compression: "xz", ResetTimestamps: true}, false},
+		{"small zstd", "small,compress=zstd", Plan{Passes: []string{"strip-docs", "strip-locales", "dedupe"}, Compression: "zstd", ResetTimestamps: true}, false},
+		{"reset timestamps", "reset-timestamps,strip-docs", Plan{Passes: []string{"strip-docs"}, ResetTimestamps: true}, false},
+		{"ordered passes", "dedupe, strip-docs", Plan{Passes: []string{"strip-docs", "dedupe"}}, false},
+		{"compression only", "compress=lz4", Plan{Compression: "lz4"}, false},
+		{"unknown pass", "strip-everything", Plan{}, true},
+		{"unknown compression", "compress=bzip2", Plan{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := Parse(tt.spec)
+			if tt.fail {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(plan, tt.expected) {
+				t.Errorf("unexpected plan %+v (expected %+v)", plan, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	saved := passes
+	defer func() { passes = saved }()
+
+	run := func(string) error { return nil }
+	for _, name := range []string{"", "help", "a,b", "compress=xz", "dedupe", "small", "reset-timestamps"} {
+		if err := Register(Pass{Name: name, Run: run}); err == nil {
+			t.Errorf("unexpected success registering %q", name)
+		}
+	}
+	if err := Register(Pass{Name: "plugin-pass", Run: run}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	plan, err := Parse("plugin-pass,safe")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(plan.Passes, []string{"dedupe", "plugin-pass"}) {
+		t.Errorf("unexpected passes %v", plan.Passes)
+	}
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func TestStrip(t *testing.T) {
+	root, err := ioutil.TempDir("", "optimize-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeFiles(t, root, map[string]string{
+		"usr/share/doc/bash/README":             "readme",
+		"usr/share/doc/bash/copyright":          "copyright",
+		"usr/share/doc/zlib/changelog.gz":       "changes",
+		"usr/share/man/man1/ls.1.gz":            "man",
+		"usr/share/locale/fr/LC_MESSAGES/ls.mo": "fr",
+		"usr/share/locale/en_GB/LC_MESSAGES/ls": "en",
+		"usr/share/locale/locale.alias":         "alias",
+		"usr/bin/ls":                            "ls",
+	})
+
+	// symbolic links are resolved inside the root filesystem and not
+	// followed while removing files
+	outside, err := ioutil.TempDir("", "optimize-outside-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	writeFiles(t, outside, map[string]string{"doc/README": "readme", "locale/fr/ls.mo": "fr"})
+	if err := os.Symlink(filepath.Join(outside, "doc"), filepath.Join(root, "usr/share/doc/outside")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "usr/local/share"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "locale"), filepath.Join(root, "usr/local/share/locale")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stripDocs(root); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := stripLocales(root); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for path, kept := range map[string]bool{
+		"usr/share/doc":                 true,
+		"usr/share/doc/bash/README":     false,
+		"usr/share/doc/bash/copyright":  true,
+		"usr/share/doc/zlib":            false,
+		"usr/share/man/man1":            false,
+		"usr/share/locale/fr":           false,
+		"usr/share/locale/en_GB":        true,
+		"usr/share/locale/locale.alias": true,
+		"usr/bin/ls":                    true,
+	} {
+		if e := exists(filepath.Join(root, path)); e != kept {
+			t.Errorf("%s: exists %v, expected %v", path, e, kept)
+		}
+	}
+	for _, path := range []string{"doc/README", "locale/fr/ls.mo"} {
+		if !exists(filepath.Join(outside, path)) {
+			t.Errorf("%s removed outside of the root filesystem", path)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	plan := Plan{Passes: []string{"strip-docs", "dedupe"}}
+	if !plan.Remove("dedupe") {
+		t.Errorf("selected pass not removed")
+	}
+	if plan.Remove("dedupe") {
+		t.Errorf("unexpected removal of an unselected pass")
+	}
+	if !reflect.DeepEqual(plan.Passes, []string{"strip-docs"}) {
+		t.Errorf("unexpected passes %v", plan.Passes)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	root, err := ioutil.TempDir("", "optimize-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeFiles(t, root, map[string]string{
+		"a":       "same content",
+		"dir/b":   "same content",
+		"c":       "same length!",
+		"empty1":  "",
+		"empty2":  "",
+		"execute": "same content",
+	})
+	if err := os.Chmod(filepath.Join(root, "execute"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dedupe(root); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ino := func(name string) uint64 {
+		fi, err := os.Stat(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Sys().(*syscall.Stat_t).Ino
+	}
+	if ino("a") != ino("dir/b") {
+		t.Errorf("identical files not linked")
+	}
+	if ino("a") == ino("c") {
+		t.Errorf("different files linked")
+	}
+	if ino("a") == ino("execute") {
+		t.Errorf("files with different modes linked")
+	}
+	if ino("empty1") == ino("empty2") {
+		t.Errorf("empty files linked")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(root, "dir/b"))
+	if err != nil || string(data) != "same content" {
+		t.Errorf("unexpected content %q: %v", data, err)
+	}
+}
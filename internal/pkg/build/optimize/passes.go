@@ -0,0 +1,268 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package optimize
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+)
+
+// docDirs hold documentation, only license files are kept in them
+var docDirs = []string{
+	"usr/share/doc",
+	"usr/share/man",
+	"usr/share/info",
+	"usr/share/gtk-doc",
+	"usr/local/share/doc",
+	"usr/local/share/man",
+	"usr/local/share/info",
+}
+
+// localeDirs hold message translations by language
+var localeDirs = []string{
+	"usr/share/locale",
+	"usr/local/share/locale",
+}
+
+// isLicense returns true if the file name is a license or copyright
+// notice which must be redistributed with the software
+func isLicense(name string) bool {
+	n := strings.ToUpper(name)
+	for _, prefix := range []string{"COPYRIGHT", "COPYING", "LICENSE", "LICENCE", "NOTICE"} {
+		if strings.HasPrefix(n, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// rootfsDir returns the path of the directory dir of the root filesystem
+// rootfs with symbolic links resolved inside rootfs, an empty path is
+// returned if it's not a directory
+func rootfsDir(rootfs, dir string) (string, error) {
+	path := filepath.Join(rootfs, fs.EvalRelative("/"+dir, rootfs))
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", nil
+	}
+	return path, nil
+}
+
+// stripDocs removes documentation files except licenses, emptied
+// directories are removed
+func stripDocs(rootfs string) error {
+	for _, d := range docDirs {
+		dir, err := rootfsDir(rootfs, d)
+		if err != nil {
+			return err
+		} else if dir == "" {
+			continue
+		}
+		if err := removeTree(dir, isLicense); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripLocales removes the translations of languages other than English
+func stripLocales(rootfs string) error {
+	for _, d := range localeDirs {
+		dir, err := rootfsDir(rootfs, d)
+		if err != nil {
+			return err
+		} else if dir == "" {
+			continue
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if !e.IsDir() || name == "en" || strings.HasPrefix(name, "en_") || strings.HasPrefix(name, "en@") {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeTree removes the files below dir for which keep returns false
+// and the directories left empty, dir itself is kept. Symbolic links are
+// removed like files and never followed.
+func removeTree(dir string, keep func(name string) bool) error {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.IsDir() {
+			if err := removeTree(path, keep); err != nil {
+				return err
+			}
+			// fails if license files were kept
+			os.Remove(path)
+			continue
+		}
+		if keep(e.Name()) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileKey identifies files which can be hard linked together, the link
+// shares their metadata too
+type fileKey struct {
+	size int64
+	mode os.FileMode
+	uid  uint32
+	gid  uint32
+	dev  uint64
+}
+
+// dedupe replaces regular files having the same content and metadata as
+// a previous file by hard links to it
+func dedupe(rootfs string) error {
+	candidates := make(map[fileKey][]string)
+	seen := make(map[uint64]bool)
+
+	err := filepath.Walk(rootfs, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !fi.Mode().IsRegular() || fi.Size() == 0 || !ok {
+			return nil
+		}
+		// already hard linked files are considered once
+		if seen[st.Ino] {
+			return nil
+		}
+		seen[st.Ino] = true
+		k := fileKey{fi.Size(), fi.Mode(), st.Uid, st.Gid, uint64(st.Dev)}
+		candidates[k] = append(candidates[k], path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var saved int64
+	for k, paths := range candidates {
+		if len(paths) < 2 {
+			continue
+		}
+		digests := make(map[[sha256.Size]byte]string)
+		for _, path := range paths {
+			sum, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			target, ok := digests[sum]
+			if !ok {
+				digests[sum] = path
+				continue
+			}
+			if same, err := sameContent(target, path); err != nil {
+				return err
+			} else if !same {
+				continue
+			}
+			if err := replaceByLink(target, path); err != nil {
+				return err
+			}
+			saved += k.size
+		}
+	}
+	sylog.Debugf("Deduplication saved %d bytes", saved)
+	return nil
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// sameContent compares the content of two files of the same size
+func sameContent(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufa := make([]byte, 64*1024)
+	bufb := make([]byte, 64*1024)
+	for {
+		na, erra := io.ReadFull(fa, bufa)
+		nb, errb := io.ReadFull(fb, bufb)
+		if na != nb || !bytes.Equal(bufa[:na], bufb[:nb]) {
+			return false, nil
+		}
+		if erra == io.EOF || erra == io.ErrUnexpectedEOF {
+			return errb == erra, nil
+		} else if erra != nil {
+			return false, erra
+		} else if errb != nil {
+			return false, errb
+		}
+	}
+}
+
+// replaceByLink atomically replaces path by a hard link to target
+func replaceByLink(target, path string) error {
+	tmp := path + ".dedupe"
+	if err := os.Link(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package proot runs build scripts in a root filesystem with proot, which
+// emulates chroot, bind mounts and root privileges with ptrace. It lets
+// users without root privileges, setuid installation nor user namespaces
+// build simple images.
+package proot
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// Limitations are the differences with builds run by root that build
+// scripts may run into under proot
+var Limitations = []string{
+	"scripts run much slower as every system call is intercepted",
+	"root privileges are faked, files are owned by the user and ownership changes are not kept",
+	"setuid and setgid bits and device files can't be created",
+	"mount, network and other privileged operations fail",
+	"%setup and %pre run on the host as the user",
+}
+
+// DefaultBinds are the host paths bound at the same place in the root
+// filesystem of build scripts, /etc/resolv.conf is bound separately
+var DefaultBinds = []string{"/proc", "/sys", "/dev", "/tmp", "/var/tmp", "/etc/hosts"}
+
+// Find returns the path of the proot executable found in PATH
+func Find() (string, error) {
+	path, err := exec.LookPath("proot")
+	if err != nil {
+		return "", fmt.Errorf("proot is required to build without root privileges, install it in PATH: %s", err)
+	}
+	return path, nil
+}
+
+// Bind is a host path bound in the root filesystem, at the same path when
+// Dst is empty
+type Bind struct {
+	Src string
+	Dst string
+}
+
+// Config describes how commands are run in a root filesystem by proot
+type Config struct {
+	// Path is the path of the proot executable
+	Path string
+	// Rootfs is the root filesystem commands are run in
+	Rootfs string
+	// Binds are the host paths bound in the root filesystem, a later
+	// bind of the same destination overrides previous ones
+	Binds []Bind
+	// Env is the environment of commands
+	Env []string
+}
+
+// Args returns the proot arguments running argv in the root filesystem
+// as a fake root user
+func (c *Config) Args(argv ...string) []string {
+	args := []string{"--kill-on-exit", "-0", "-r", c.Rootfs, "-w", "/"}
+	for _, b := range c.Binds {
+		bind := filepath.Clean(b.Src)
+		if b.Dst != "" && filepath.Clean(b.Dst) != bind {
+			bind += ":" + filepath.Clean(b.Dst)
+		}
+		args = append(args, "-b", bind)
+	}
+	return append(args, argv...)
+}
+
+// Command returns the command running argv in the root filesystem
+func (c *Config) Command(argv ...string) *exec.Cmd {
+	cmd := exec.Command(c.Path, c.Args(argv...)...)
+	cmd.Env = c.Env
+	return cmd
+}
+
+// bashOptions abort scripts run by bash on the first failing command,
+// unset variable or failing pipe element
+var bashOptions = []string{"-eEuo", "pipefail"}
+
+// bashTrap is prepended to the first line of scripts run by bash to
+// report the failing line without shifting line numbers
+const bashTrap = `trap 'echo "%%%s: command failed at line $LINENO with status $?" >&2' ERR; `
+
+// ScriptArgs returns the command line running the script of section name
+// and the script to pipe to it, like the build engine does. Scripts are
+// run by /bin/sh -ex with the section arguments unless an interpreter is
+// selected in the section header with -i <interpreter> [arguments...].
+func ScriptArgs(name string, s types.Script) ([]string, string, error) {
+	// trim potential trailing comment from args
+	args := strings.Fields(strings.Split(s.Args, "#")[0])
+	if len(args) == 0 || args[0] != "-i" {
+		return append([]string{"/bin/sh", "-ex"}, args...), s.Script, nil
+	}
+	if len(args) < 2 {
+		return nil, "", fmt.Errorf("missing interpreter after -i in %%%s section header", name)
+	}
+	argv := []string{args[1]}
+	script := s.Script
+	if filepath.Base(args[1]) == "bash" {
+		argv = append(argv, bashOptions...)
+		script = fmt.Sprintf(bashTrap, name) + script
+	}
+	return append(argv, args[2:]...), script, nil
+}
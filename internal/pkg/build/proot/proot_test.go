@@ -0,0 +1,83 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package proot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestArgs(t *testing.T) {
+	c := &Config{
+		Path:   "/usr/bin/proot",
+		Rootfs: "/tmp/rootfs",
+		Binds: []Bind{
+			{Src: "/proc"},
+			{Src: "/dev/", Dst: "/dev"},
+			{Src: "/tmp/resolv.conf", Dst: "/etc/resolv.conf"},
+		},
+		Env: []string{"PATH=/bin"},
+	}
+	want := []string{
+		"--kill-on-exit", "-0", "-r", "/tmp/rootfs", "-w", "/",
+		"-b", "/proc",
+		"-b", "/dev",
+		"-b", "/tmp/resolv.conf:/etc/resolv.conf",
+		"/bin/sh", "-ex",
+	}
+	if got := c.Args("/bin/sh", "-ex"); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected arguments %v instead of %v", got, want)
+	}
+
+	cmd := c.Command("/bin/true")
+	if cmd.Path != c.Path {
+		t.Errorf("unexpected command path %s", cmd.Path)
+	}
+	if !reflect.DeepEqual(cmd.Env, c.Env) {
+		t.Errorf("unexpected command environment %v", cmd.Env)
+	}
+	if last := cmd.Args[len(cmd.Args)-1]; last != "/bin/true" {
+		t.Errorf("unexpected last argument %s", last)
+	}
+}
+
+func TestScriptArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       string
+		argv       []string
+		trap       bool
+		shouldPass bool
+	}{
+		{"default", "", []string{"/bin/sh", "-ex"}, false, true},
+		{"arguments", "-x # comment", []string{"/bin/sh", "-ex", "-x"}, false, true},
+		{"python", "-i /usr/bin/python3 -u", []string{"/usr/bin/python3", "-u"}, false, true},
+		{"bash", "-i /bin/bash", []string{"/bin/bash", "-eEuo", "pipefail"}, true, true},
+		{"missing interpreter", "-i", nil, false, false},
+	}
+
+	for _, tt := range tests {
+		argv, script, err := ScriptArgs("post", types.Script{Args: tt.args, Script: "echo"})
+		if err != nil && tt.shouldPass {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		} else if err == nil && !tt.shouldPass {
+			t.Errorf("%s: unexpected success", tt.name)
+			continue
+		} else if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(argv, tt.argv) {
+			t.Errorf("%s: unexpected command line %v instead of %v", tt.name, argv, tt.argv)
+		}
+		if trap := strings.HasPrefix(script, "trap "); trap != tt.trap || !strings.HasSuffix(script, "echo") {
+			t.Errorf("%s: unexpected script %q", tt.name, script)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remotebuilder
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	units "github.com/docker/go-units"
+	types "github.com/sylabs/singularity/pkg/build/legacy"
+)
+
+// ContextIgnoreFile lists the patterns of files excluded from the build
+// context, it's read from the context directory
+const ContextIgnoreFile = ".singularityignore"
+
+// DefaultContextLimit is the default size limit of the files of a build
+// context
+const DefaultContextLimit = 128 << 20
+
+// ignoreList holds the patterns of an ignore file
+type ignoreList []string
+
+// readIgnoreFile returns the patterns of the ignore file of directory dir,
+// blank lines and lines starting with # are skipped
+func readIgnoreFile(dir string) (ignoreList, error) {
+	f, err := os.Open(filepath.Join(dir, ContextIgnoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var l ignoreList
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l = append(l, line)
+	}
+	return l, s.Err()
+}
+
+// match returns if the context path name is ignored. Patterns are matched
+// against the whole path, or against the base name when they don't contain
+// a slash, a trailing slash only matches directories and a leading !
+// includes files excluded by previous patterns
+func (l ignoreList) match(name string, isDir bool) bool {
+	ignored := false
+	for _, p := range l {
+		negate := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		if strings.HasSuffix(p, "/") {
+			if !isDir {
+				continue
+			}
+			p = strings.TrimSuffix(p, "/")
+		}
+		p = strings.TrimPrefix(p, "/")
+
+		target := name
+		if !strings.Contains(p, "/") {
+			target = filepath.Base(name)
+		}
+		if ok, _ := filepath.Match(p, target); ok {
+			ignored = !negate
+		}
+	}
+	return ignored
+}
+
+// contextPath returns the path of the host path p in the build context of
+// directory dir, paths outside of dir keep their absolute path without
+// the leading slash, WriteContext refuses sources clashing with them
+func contextPath(dir, p string) string {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	if rel, err := filepath.Rel(dir, p); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+		return rel
+	}
+	return strings.TrimPrefix(filepath.Clean(p), "/")
+}
+
+// WriteContext writes a gzip compressed tar archive of the %files sources
+// of definition d, resolved from directory dir, to w. Files matching the
+// patterns of the ignore file of dir are skipped and the size of archived
+// files can't exceed limit bytes. It returns d with the %files sources
+// rewritten to their path in the archive.
+func WriteContext(w io.Writer, d types.Definition, dir string, limit int64) (types.Definition, error) {
+	ignore, err := readIgnoreFile(dir)
+	if err != nil {
+		return d, fmt.Errorf("while reading %s: %s", ContextIgnoreFile, err)
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	var size int64
+	// written maps context paths to the host path archived there
+	written := make(map[string]string)
+
+	// sources given explicitly are never ignored
+	addFile := func(path string, fi os.FileInfo, explicit bool) error {
+		name := contextPath(dir, path)
+		if src, ok := written[name]; ok {
+			if src != filepath.Clean(path) {
+				return fmt.Errorf("%s and %s are both archived as %s", src, path, name)
+			}
+			return nil
+		}
+		if !explicit && ignore.match(name, fi.IsDir()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			l, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			link = l
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(name)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		// host identity is meaningless for the remote builder
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		written[name] = filepath.Clean(path)
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		if size += fi.Size(); size > limit {
+			return fmt.Errorf("build context exceeds the %s limit, exclude files with %s", units.BytesSize(float64(limit)), ContextIgnoreFile)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	}
+
+	files := make([]types.FileTransport, 0, len(d.BuildData.Files))
+	for _, ft := range d.BuildData.Files {
+		if ft.Src == "" {
+			continue
+		}
+		pattern := ft.Src
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return d, fmt.Errorf("bad %%files source %s: %s", ft.Src, err)
+		}
+		if len(matches) == 0 {
+			return d, fmt.Errorf("%%files source %s not found", ft.Src)
+		}
+		for _, m := range matches {
+			err := filepath.Walk(m, func(path string, fi os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				return addFile(path, fi, path == m)
+			})
+			if err != nil {
+				return d, fmt.Errorf("while adding %s to build context: %s", m, err)
+			}
+		}
+
+		dst := ft.Dst
+		if dst == "" {
+			dst = ft.Src
+		}
+		files = append(files, types.FileTransport{Src: contextPath(dir, ft.Src), Dst: dst})
+	}
+
+	if err := tw.Close(); err != nil {
+		return d, err
+	}
+	if err := gw.Close(); err != nil {
+		return d, err
+	}
+
+	d.BuildData.Files = files
+	return d, nil
+}
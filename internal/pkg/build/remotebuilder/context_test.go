@@ -0,0 +1,151 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remotebuilder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	types "github.com/sylabs/singularity/pkg/build/legacy"
+)
+
+func TestIgnoreMatch(t *testing.T) {
+	l := ignoreList{"*.o", "build/", "docs/*.pdf", "!keep.o"}
+
+	tests := []struct {
+		name    string
+		isDir   bool
+		ignored bool
+	}{
+		{"main.o", false, true},
+		{"src/lib.o", false, true},
+		{"src/keep.o", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"docs/manual.pdf", false, true},
+		{"docs/manual.md", false, false},
+		{"other/docs/manual.pdf", false, false},
+	}
+	for _, tt := range tests {
+		if ignored := l.match(tt.name, tt.isDir); ignored != tt.ignored {
+			t.Errorf("unexpected match result for %s: %v", tt.name, ignored)
+		}
+	}
+}
+
+func contextEntries(t *testing.T, r io.Reader) []string {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("failed to read context: %v", err)
+	}
+	var names []string
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read context: %v", err)
+		}
+		if hdr.Uid != 0 || hdr.Uname != "" {
+			t.Errorf("unexpected owner of %s: %d %s", hdr.Name, hdr.Uid, hdr.Uname)
+		}
+		names = append(names, hdr.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestWriteContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build-context-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"app/main.py":          "print('hello')",
+		"app/cache/data.bin":   "0123456789",
+		"app/notes.tmp":        "notes",
+		"config.yml":           "key: value",
+		"big.tmp":              "ignored but given explicitly",
+		ContextIgnoreFile:      "# generated files\ncache/\n*.tmp\n",
+		"outside/unreferenced": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := types.Definition{}
+	d.BuildData.Files = []types.FileTransport{
+		{Src: "app", Dst: "/opt/app"},
+		{Src: "*.yml", Dst: "/etc/app/"},
+		{Src: "big.tmp"},
+		{Src: filepath.Join(dir, "config.yml"), Dst: "/etc/app.yml"},
+	}
+
+	var buf bytes.Buffer
+	nd, err := WriteContext(&buf, d, dir, DefaultContextLimit)
+	if err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+
+	expected := []string{"app/", "app/main.py", "big.tmp", "config.yml"}
+	if names := contextEntries(t, &buf); !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected context entries %v instead of %v", names, expected)
+	}
+
+	expectedFiles := []types.FileTransport{
+		{Src: "app", Dst: "/opt/app"},
+		{Src: "*.yml", Dst: "/etc/app/"},
+		{Src: "big.tmp", Dst: "big.tmp"},
+		{Src: "config.yml", Dst: "/etc/app.yml"},
+	}
+	if !reflect.DeepEqual(nd.BuildData.Files, expectedFiles) {
+		t.Errorf("unexpected files %v instead of %v", nd.BuildData.Files, expectedFiles)
+	}
+
+	// size limit
+	if _, err := WriteContext(ioutil.Discard, d, dir, 16); err == nil {
+		t.Errorf("unexpected success with size limit")
+	}
+
+	// missing source
+	d.BuildData.Files = []types.FileTransport{{Src: "missing"}}
+	if _, err := WriteContext(ioutil.Discard, d, dir, DefaultContextLimit); err == nil {
+		t.Errorf("unexpected success with missing source")
+	}
+
+	// host path outside of the context archived as a context path
+	outside, err := ioutil.TempDir("", "build-context-outside-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	clash := filepath.Join(dir, strings.TrimPrefix(outside, "/"))
+	if err := os.MkdirAll(clash, 0755); err != nil {
+		t.Fatal(err)
+	}
+	d.BuildData.Files = []types.FileTransport{{Src: outside}, {Src: strings.TrimPrefix(outside, "/")}}
+	if _, err := WriteContext(ioutil.Discard, d, dir, DefaultContextLimit); err == nil {
+		t.Errorf("unexpected success with clashing sources")
+	}
+}
@@ -14,10 +14,15 @@ package remotebuilder
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,6 +39,14 @@ import (
 // CloudURI holds the URI of the Library web front-end.
 const CloudURI = "https://cloud.sylabs.io"
 
+// streamReconnects is the number of reconnections to the build output
+// stream attempted during a build before giving up
+const streamReconnects = 5
+
+// streamReconnectDelay is the delay before the first reconnection to the
+// build output stream, it doubles with each attempt
+var streamReconnectDelay = 2 * time.Second
+
 // RemoteBuilder contains the build request and response
 type RemoteBuilder struct {
 	Client     http.Client
@@ -44,6 +57,11 @@ type RemoteBuilder struct {
 	AuthToken  string
 	Force      bool
 	IsDetached bool
+	// ContextDir is the directory %files sources are read from, they
+	// are uploaded as build context when set
+	ContextDir string
+	// ContextLimit is the size limit of the build context files
+	ContextLimit int64
 }
 
 func (rb *RemoteBuilder) setAuthHeader(h http.Header) {
@@ -63,13 +81,14 @@ func New(imagePath, libraryURL string, d types.Definition, isDetached, force boo
 		Client: http.Client{
 			Timeout: 30 * time.Second,
 		},
-		ImagePath:  imagePath,
-		Force:      force,
-		LibraryURL: libraryURL,
-		Definition: d,
-		IsDetached: isDetached,
-		BuilderURL: builderURL,
-		AuthToken:  authToken,
+		ImagePath:    imagePath,
+		Force:        force,
+		LibraryURL:   libraryURL,
+		Definition:   d,
+		IsDetached:   isDetached,
+		BuilderURL:   builderURL,
+		AuthToken:    authToken,
+		ContextLimit: DefaultContextLimit,
 	}
 
 	return
@@ -84,8 +103,19 @@ func (rb *RemoteBuilder) Build(ctx context.Context) (err error) {
 		libraryRef = rb.ImagePath
 	}
 
+	// Upload local files referenced by the definition
+	def, digest := rb.Definition, ""
+	if rb.ContextDir != "" && len(def.BuildData.Files) > 0 {
+		def, digest, err = rb.uploadContext(ctx)
+		if err != nil {
+			err = errors.Wrap(err, "failed to upload build context to remote build service")
+			sylog.Warningf("%v", err)
+			return err
+		}
+	}
+
 	// Send build request to Remote Build Service
-	rd, err := rb.doBuildRequest(ctx, rb.Definition, libraryRef)
+	rd, err := rb.doBuildRequest(ctx, def, libraryRef, digest)
 	if err != nil {
 		err = errors.Wrap(err, "failed to post request to remote build service")
 		sylog.Warningf("%v", err)
@@ -98,57 +128,129 @@ func (rb *RemoteBuilder) Build(ctx context.Context) (err error) {
 		fmt.Printf("Build submitted! Once it is complete, the image can be retrieved by running:\n")
 		fmt.Printf("\tsingularity pull --library %v library://%v\n\n", rd.LibraryURL, libraryRefRaw)
 		fmt.Printf("Alternatively, you can access it from a browser at:\n\t%v/library/%v\n", CloudURI, libraryRefRaw)
+		return nil
 	}
 
 	// If we're doing an attached build, stream output and then download the resulting file
-	if !rb.IsDetached {
-		err = rb.streamOutput(ctx, rd.WSURL)
+	sylog.Infof("Build ID: %s", rd.ID.Hex())
+	return rb.follow(ctx, rd)
+}
+
+// Attach streams the output of the build id submitted earlier to the
+// remote builder from its start, and downloads the resulting image
+func (rb *RemoteBuilder) Attach(ctx context.Context, id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return fmt.Errorf("invalid build ID %q", id)
+	}
+	rd, err := rb.doStatusRequest(ctx, bson.ObjectIdHex(id))
+	if err != nil {
+		err = errors.Wrap(err, "failed to get status from remote build service")
+		sylog.Warningf("%v", err)
+		return err
+	}
+	return rb.follow(ctx, rd)
+}
+
+// follow streams the output of the build rd, then downloads the image
+// once the build completed
+func (rb *RemoteBuilder) follow(ctx context.Context, rd types.ResponseData) (err error) {
+	err = rb.streamOutput(ctx, rd)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to stream output from remote build service, reattach with 'singularity build --attach %s %s'", rd.ID.Hex(), rb.ImagePath)
+		sylog.Warningf("%v", err)
+		return err
+	}
+
+	// Get build status
+	rd, err = rb.doStatusRequest(ctx, rd.ID)
+	if err != nil {
+		err = errors.Wrap(err, "failed to get status from remote build service")
+		sylog.Warningf("%v", err)
+		return err
+	}
+
+	// Do not try to download image if not complete or image size is 0
+	if !rd.IsComplete {
+		return errors.New("build has not completed")
+	}
+	if rd.ImageSize <= 0 {
+		return errors.New("build image size <= 0")
+	}
+
+	// If image destination is local file, pull image.
+	if !strings.HasPrefix(rb.ImagePath, "library://") {
+		err = client.DownloadImage(rb.ImagePath, rd.LibraryRef, rd.LibraryURL, rb.Force, rb.AuthToken)
 		if err != nil {
-			err = errors.Wrap(err, "failed to stream output from remote build service")
+			err = errors.Wrap(err, "failed to pull image file")
 			sylog.Warningf("%v", err)
 			return err
 		}
+	}
 
-		// Get build status
-		rd, err = rb.doStatusRequest(ctx, rd.ID)
-		if err != nil {
-			err = errors.Wrap(err, "failed to get status from remote build service")
-			sylog.Warningf("%v", err)
+	return nil
+}
+
+// streamOutput streams the output of the build rd to the console. When
+// the connection is lost, it reconnects and resumes the output from the
+// last received offset, unless the build completed in the meantime
+func (rb *RemoteBuilder) streamOutput(ctx context.Context, rd types.ResponseData) error {
+	var offset int64
+	delay := streamReconnectDelay
+
+	for attempt := 1; ; attempt++ {
+		n, retry, err := rb.streamOutputFrom(ctx, rd.WSURL, offset)
+		if err == nil || !retry || ctx.Err() != nil {
 			return err
 		}
-
-		// Do not try to download image if not complete or image size is 0
-		if !rd.IsComplete {
-			return errors.New("build has not completed")
+		if n > 0 {
+			offset += n
+			delay = streamReconnectDelay
 		}
-		if rd.ImageSize <= 0 {
-			return errors.New("build image size <= 0")
+		if attempt > streamReconnects {
+			return err
 		}
 
-		// If image destination is local file, pull image.
-		if !strings.HasPrefix(rb.ImagePath, "library://") {
-			err = client.DownloadImage(rb.ImagePath, rd.LibraryRef, rd.LibraryURL, rb.Force, rb.AuthToken)
-			if err != nil {
-				err = errors.Wrap(err, "failed to pull image file")
-				sylog.Warningf("%v", err)
-				return err
+		if st, serr := rb.doStatusRequest(ctx, rd.ID); serr == nil && st.IsComplete {
+			// fetch the end of the output of the completed build
+			if _, _, err := rb.streamOutputFrom(ctx, st.WSURL, offset); err != nil {
+				sylog.Warningf("Build completed, but the end of its output could not be retrieved: %v", err)
 			}
+			return nil
 		}
-	}
 
-	return nil
+		sylog.Warningf("Lost connection to remote build service (%v), reconnecting in %v", err, delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
 }
 
-// streamOutput attaches via websocket and streams output to the console
-func (rb *RemoteBuilder) streamOutput(ctx context.Context, url string) (err error) {
+// streamOutputFrom attaches via websocket and streams output from offset to
+// the console, it returns the number of bytes received and if the stream
+// can be resumed after an error
+func (rb *RemoteBuilder) streamOutputFrom(ctx context.Context, wsURL string, offset int64) (n int64, retry bool, err error) {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return 0, false, err
+	}
+	if offset > 0 {
+		q := u.Query()
+		q.Set("offset", strconv.FormatInt(offset, 10))
+		u.RawQuery = q.Encode()
+	}
+
 	h := http.Header{}
 	rb.setAuthHeader(h)
 	h.Set("User-Agent", useragent.Value())
 
-	c, resp, err := websocket.DefaultDialer.Dial(url, h)
+	c, resp, err := websocket.DefaultDialer.Dial(u.String(), h)
 	if err != nil {
 		sylog.Debugf("websocket dial err - %s, partial response: %+v", err, resp)
-		return err
+		// requests refused by the service are not retried
+		return 0, resp == nil || resp.StatusCode >= 500, err
 	}
 	defer c.Close()
 
@@ -156,7 +258,7 @@ func (rb *RemoteBuilder) streamOutput(ctx context.Context, url string) (err erro
 		// Check if context has expired
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return n, false, ctx.Err()
 		default:
 		}
 
@@ -164,16 +266,17 @@ func (rb *RemoteBuilder) streamOutput(ctx context.Context, url string) (err erro
 		mt, msg, err := c.ReadMessage()
 		if err != nil {
 			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
-				return nil
+				return n, false, nil
 			}
 			sylog.Debugf("websocket read message err - %s", err)
-			return err
+			return n, true, err
 		}
 
 		// Print to terminal
 		switch mt {
 		case websocket.TextMessage:
 			fmt.Printf("%s", msg)
+			n += int64(len(msg))
 		case websocket.BinaryMessage:
 			fmt.Print("Ignoring binary message")
 		}
@@ -181,7 +284,7 @@ func (rb *RemoteBuilder) streamOutput(ctx context.Context, url string) (err erro
 }
 
 // doBuildRequest creates a new build on a Remote Build Service
-func (rb *RemoteBuilder) doBuildRequest(ctx context.Context, d types.Definition, libraryRef string) (rd types.ResponseData, err error) {
+func (rb *RemoteBuilder) doBuildRequest(ctx context.Context, d types.Definition, libraryRef, contextDigest string) (rd types.ResponseData, err error) {
 	if libraryRef != "" && !client.IsLibraryPushRef(libraryRef) {
 		err = fmt.Errorf("invalid library reference: %v", rb.ImagePath)
 		sylog.Warningf("%v", err)
@@ -189,9 +292,10 @@ func (rb *RemoteBuilder) doBuildRequest(ctx context.Context, d types.Definition,
 	}
 
 	b, err := json.Marshal(types.RequestData{
-		Definition: d,
-		LibraryRef: libraryRef,
-		LibraryURL: rb.LibraryURL,
+		Definition:    d,
+		LibraryRef:    libraryRef,
+		LibraryURL:    rb.LibraryURL,
+		ContextDigest: contextDigest,
 	})
 	if err != nil {
 		return
@@ -221,6 +325,65 @@ func (rb *RemoteBuilder) doBuildRequest(ctx context.Context, d types.Definition,
 	return
 }
 
+// uploadContext packs the %files sources of the definition and uploads
+// them to the Remote Build Service, it returns the definition with
+// sources relative to the context and the context digest
+func (rb *RemoteBuilder) uploadContext(ctx context.Context) (d types.Definition, digest string, err error) {
+	// the context is staged on disk since its digest is part of the
+	// upload URL, then streamed from there
+	f, err := ioutil.TempFile("", "build-context-")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	d, err = WriteContext(io.MultiWriter(f, h), rb.Definition, rb.ContextDir, rb.ContextLimit)
+	if err != nil {
+		return
+	}
+	digest = fmt.Sprintf("sha256:%x", h.Sum(nil))
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPut, rb.BuilderURL.String()+"/v1/build-context/"+digest, f)
+	if err != nil {
+		return
+	}
+	req.ContentLength = size
+	req = req.WithContext(ctx)
+	rb.setAuthHeader(req.Header)
+	req.Header.Set("User-Agent", useragent.Value())
+	req.Header.Set("Content-Type", "application/gzip")
+	sylog.Debugf("Uploading %d bytes build context to %s", size, req.URL.String())
+
+	// large contexts take longer to upload than the timeout of API
+	// requests, the upload is only bounded by ctx
+	c := rb.Client
+	c.Timeout = 0
+
+	res, err := c.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		err = jsonresp.ReadError(res.Body)
+		if err == nil {
+			err = fmt.Errorf("unexpected status %s", res.Status)
+		}
+	}
+	return
+}
+
 // doStatusRequest gets the status of a build from the Remote Build Service
 func (rb *RemoteBuilder) doStatusRequest(ctx context.Context, id bson.ObjectId) (rd types.ResponseData, err error) {
 	req, err := http.NewRequest(http.MethodGet, rb.BuilderURL.String()+"/v1/build/"+id.Hex(), nil)
@@ -7,6 +7,7 @@ package remotebuilder
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -14,6 +15,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -49,6 +51,7 @@ var upgrader = websocket.Upgrader{}
 
 func TestMain(m *testing.M) {
 	useragent.InitValue("singularity", "3.0.0-alpha.1-303-gaed8d30-dirty")
+	streamReconnectDelay = time.Millisecond
 
 	os.Exit(m.Run())
 }
@@ -183,7 +186,8 @@ func TestBuild(t *testing.T) {
 		{"BadLibraryRef", false, "library://bad", "", http.StatusCreated, http.StatusOK, websocket.CloseNormalClosure, http.StatusOK, http.StatusOK, context.Background(), false},
 		{"AddBuildFailure", false, f.Name(), "", http.StatusUnauthorized, http.StatusOK, websocket.CloseNormalClosure, http.StatusOK, http.StatusOK, context.Background(), false},
 		{"WebsocketFailure", false, f.Name(), "", http.StatusCreated, http.StatusUnauthorized, websocket.CloseNormalClosure, http.StatusOK, http.StatusOK, context.Background(), false},
-		{"WebsocketAbnormalClosure", false, f.Name(), "", http.StatusCreated, http.StatusOK, websocket.CloseAbnormalClosure, http.StatusOK, http.StatusOK, context.Background(), false},
+		{"WebsocketAbnormalClosureCompleted", true, f.Name(), "", http.StatusCreated, http.StatusOK, websocket.CloseAbnormalClosure, http.StatusOK, http.StatusOK, context.Background(), false},
+		{"WebsocketAbnormalClosure", false, f.Name(), "", http.StatusCreated, http.StatusOK, websocket.CloseAbnormalClosure, http.StatusUnauthorized, http.StatusOK, context.Background(), false},
 		{"GetStatusFailure", false, f.Name(), "", http.StatusCreated, http.StatusOK, websocket.CloseNormalClosure, http.StatusUnauthorized, http.StatusOK, context.Background(), false},
 		{"GetImageFailure", false, f.Name(), "", http.StatusCreated, http.StatusOK, websocket.CloseNormalClosure, http.StatusOK, http.StatusUnauthorized, context.Background(), false},
 		{"ContextExpired", false, f.Name(), "", http.StatusCreated, http.StatusOK, websocket.CloseNormalClosure, http.StatusOK, http.StatusOK, ctx, false},
@@ -223,6 +227,48 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+func TestAttach(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	f, err := ioutil.TempFile("/tmp", "TestAttach")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	m := mockService{
+		t:                  t,
+		wsResponseCode:     http.StatusOK,
+		wsCloseCode:        websocket.CloseNormalClosure,
+		statusResponseCode: http.StatusOK,
+		imageResponseCode:  http.StatusOK,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", m.ServeHTTP)
+	mux.HandleFunc(wsPath, m.ServeWebsocket)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	m.httpAddr = s.Listener.Addr().String()
+
+	rb, err := New(f.Name(), "", types.Definition{}, false, true, s.URL, authToken)
+	if err != nil {
+		t.Fatalf("failed to get new remote builder: %v", err)
+	}
+
+	if err := rb.Attach(context.Background(), "bad"); err == nil {
+		t.Errorf("unexpected success with invalid build ID")
+	}
+	if err := rb.Attach(context.Background(), bson.NewObjectId().Hex()); err != nil {
+		t.Errorf("unexpected failure: %v", err)
+	}
+	m.statusResponseCode = http.StatusNotFound
+	if err := rb.Attach(context.Background(), bson.NewObjectId().Hex()); err == nil {
+		t.Errorf("unexpected success with unknown build")
+	}
+}
+
 func TestDoBuildRequest(t *testing.T) {
 	// Craft an expired context
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
@@ -263,7 +309,7 @@ func TestDoBuildRequest(t *testing.T) {
 			m.buildResponseCode = tt.responseCode
 
 			// Call the handler
-			rd, err := rb.doBuildRequest(tt.ctx, types.Definition{}, tt.libraryRef)
+			rd, err := rb.doBuildRequest(tt.ctx, types.Definition{}, tt.libraryRef, "")
 
 			if tt.expectSuccess {
 				// Ensure the handler returned no error, and the response is as expected
@@ -360,3 +406,52 @@ func TestDoStatusRequest(t *testing.T) {
 		}))
 	}
 }
+
+func TestUploadContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build-context-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "data"), []byte("context data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var uploaded []byte
+	var uploadPath string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploadPath = r.URL.Path
+		uploaded, _ = ioutil.ReadAll(r.Body)
+		// slower than the timeout of API requests
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer s.Close()
+
+	url, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+
+	d := types.Definition{}
+	d.BuildData.Files = []types.FileTransport{{Src: "data", Dst: "/data"}}
+	rb := RemoteBuilder{
+		Client:       http.Client{Timeout: 10 * time.Millisecond},
+		BuilderURL:   url,
+		Definition:   d,
+		ContextDir:   dir,
+		ContextLimit: DefaultContextLimit,
+	}
+
+	_, digest, err := rb.uploadContext(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected failure: %v", err)
+	}
+	if uploadPath != "/v1/build-context/"+digest {
+		t.Errorf("unexpected upload path %s", uploadPath)
+	}
+	if sum := fmt.Sprintf("sha256:%x", sha256.Sum256(uploaded)); sum != digest {
+		t.Errorf("uploaded context digest %s doesn't match %s", sum, digest)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+	"golang.org/x/sys/unix"
+)
+
+// buildTime returns the build date recorded in image labels, fixed to
+// the source date epoch for reproducible builds
+func buildTime(b *types.Bundle) time.Time {
+	if b.Opts.Reproducible {
+		return time.Unix(b.Opts.SourceDateEpoch, 0).UTC()
+	}
+	return time.Now()
+}
+
+// clampTimes sets the access and modification times of files below root
+// which are newer than epoch to epoch. Symbolic links are not followed.
+func clampTimes(root string, epoch int64) error {
+	ts := []unix.Timespec{
+		unix.NsecToTimespec(epoch * int64(time.Second)),
+		unix.NsecToTimespec(epoch * int64(time.Second)),
+	}
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.ModTime().Unix() <= epoch {
+			return nil
+		}
+		return unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+	})
+}
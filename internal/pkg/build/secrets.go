@@ -0,0 +1,118 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// ParseSecret parses a --secret value of the form id=<id>,src=<path>,
+// the id is the name of the secret file in types.SecretsDir and defaults
+// to the base name of src
+func ParseSecret(s string) (id, src string, err error) {
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return "", "", fmt.Errorf("invalid secret %q, expected id=<id>,src=<path>", s)
+		}
+		switch kv[0] {
+		case "id":
+			id = kv[1]
+		case "src", "source":
+			src = kv[1]
+		default:
+			return "", "", fmt.Errorf("unknown secret option %q", kv[0])
+		}
+	}
+
+	if src == "" {
+		return "", "", fmt.Errorf("missing src of secret %q", s)
+	}
+	if id == "" {
+		id = filepath.Base(src)
+	}
+	if id == "." || id == ".." || strings.ContainsRune(id, '/') {
+		return "", "", fmt.Errorf("invalid secret id %q", id)
+	}
+
+	src, err = filepath.Abs(src)
+	if err != nil {
+		return "", "", err
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return "", "", fmt.Errorf("secret %s: %s", id, err)
+	}
+	if !fi.Mode().IsRegular() {
+		return "", "", fmt.Errorf("secret %s: %s is not a regular file", id, src)
+	}
+	return id, src, nil
+}
+
+// mountsSecrets returns true if the build engine mounts the secrets of
+// bundle b, they are only available to the %post section
+func mountsSecrets(b *types.Bundle) bool {
+	return len(b.Opts.Secrets) > 0 && b.RunSection("post") && b.Recipe.BuildData.Post.Script != ""
+}
+
+// prepareSecrets creates in the root filesystem of bundle b the mount
+// points of the secrets. The returned function removes them along with
+// the directories created, it must be called before the root filesystem
+// is cached or assembled.
+func prepareSecrets(b *types.Bundle) (func() error, error) {
+	if !mountsSecrets(b) {
+		return func() error { return nil }, nil
+	}
+
+	var created []string
+	cleanup := func() error {
+		for i := len(created) - 1; i >= 0; i-- {
+			if err := os.Remove(created[i]); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("while removing secret mount point: %s", err)
+			}
+		}
+		return nil
+	}
+
+	// directories are checked one by one to not follow symbolic links
+	// of the image out of the root filesystem
+	dir := b.Rootfs()
+	for _, d := range strings.Split(strings.Trim(types.SecretsDir, "/"), "/") {
+		dir = filepath.Join(dir, d)
+		fi, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(dir, 0755); err != nil {
+				cleanup()
+				return nil, err
+			}
+			created = append(created, dir)
+		} else if err != nil {
+			cleanup()
+			return nil, err
+		} else if !fi.IsDir() {
+			cleanup()
+			return nil, fmt.Errorf("%s is not a directory in the image, secrets can't be mounted", strings.TrimPrefix(dir, b.Rootfs()))
+		}
+	}
+
+	for id := range b.Opts.Secrets {
+		path := filepath.Join(dir, id)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("while creating mount point of secret %s: %s", id, err)
+		}
+		f.Close()
+		created = append(created, path)
+	}
+
+	return cleanup, nil
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestParseSecret(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "secret-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	token := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(token, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		id      string
+		wantErr bool
+	}{
+		{"id and src", "id=api,src=" + token, "api", false},
+		{"source alias", "id=api,source=" + token, "api", false},
+		{"default id", "src=" + token, "token", false},
+		{"missing src", "id=api", "", true},
+		{"no value", "id=api,src", "", true},
+		{"unknown option", "id=api,src=" + token + ",mode=0400", "", true},
+		{"id with slash", "id=a/b,src=" + token, "", true},
+		{"dot id", "id=..,src=" + token, "", true},
+		{"missing file", "src=" + filepath.Join(dir, "missing"), "", true},
+		{"directory", "id=dir,src=" + dir, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, src, err := ParseSecret(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if id != tt.id || src != token {
+				t.Errorf("unexpected secret %s from %s", id, src)
+			}
+		})
+	}
+}
+
+func TestPrepareSecrets(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	newBundle := func(t *testing.T, secrets map[string]string, post string) *types.Bundle {
+		b, err := types.NewBundle("", "sbuild-secrets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Opts.Secrets = secrets
+		b.Opts.Sections = []string{"all"}
+		b.Recipe.BuildData.Post.Script = post
+		return b
+	}
+	secrets := map[string]string{"api": "/host/api", "token": "/host/token"}
+
+	t.Run("mount points", func(t *testing.T) {
+		b := newBundle(t, secrets, "cat /run/secrets/api")
+		defer os.RemoveAll(b.Path)
+
+		cleanup, err := prepareSecrets(b)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for id := range secrets {
+			fi, err := os.Stat(filepath.Join(b.Rootfs(), types.SecretsDir, id))
+			if err != nil {
+				t.Fatalf("missing mount point: %s", err)
+			}
+			if fi.Mode().Perm() != 0600 || fi.Size() != 0 {
+				t.Errorf("unexpected mount point of %s: %s %d bytes", id, fi.Mode(), fi.Size())
+			}
+		}
+		if err := cleanup(); err != nil {
+			t.Fatalf("unexpected cleanup error: %s", err)
+		}
+		// directories created for the mount points are removed too
+		if _, err := os.Lstat(filepath.Join(b.Rootfs(), "run")); !os.IsNotExist(err) {
+			t.Errorf("mount point directories not removed")
+		}
+	})
+
+	t.Run("existing directories", func(t *testing.T) {
+		b := newBundle(t, secrets, "cat /run/secrets/api")
+		defer os.RemoveAll(b.Path)
+
+		run := filepath.Join(b.Rootfs(), "run")
+		if err := os.Mkdir(run, 0755); err != nil {
+			t.Fatal(err)
+		}
+		cleanup, err := prepareSecrets(b)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := cleanup(); err != nil {
+			t.Fatalf("unexpected cleanup error: %s", err)
+		}
+		if _, err := os.Stat(run); err != nil {
+			t.Errorf("directory of the image removed: %s", err)
+		}
+	})
+
+	t.Run("symlink out of rootfs", func(t *testing.T) {
+		b := newBundle(t, secrets, "cat /run/secrets/api")
+		defer os.RemoveAll(b.Path)
+
+		outside := filepath.Join(b.Path, "outside")
+		if err := os.Mkdir(outside, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(outside, filepath.Join(b.Rootfs(), "run")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := prepareSecrets(b); err == nil {
+			t.Errorf("unexpected success with /run symlink")
+		}
+		if entries, _ := ioutil.ReadDir(outside); len(entries) != 0 {
+			t.Errorf("mount points created out of the root filesystem")
+		}
+	})
+
+	t.Run("no post section", func(t *testing.T) {
+		b := newBundle(t, secrets, "")
+		defer os.RemoveAll(b.Path)
+
+		cleanup, err := prepareSecrets(b)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		cleanup()
+		if _, err := os.Lstat(filepath.Join(b.Rootfs(), "run")); !os.IsNotExist(err) {
+			t.Errorf("unexpected mount points without %%post")
+		}
+	})
+}
@@ -0,0 +1,380 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/bzip2"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/client/cache"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/build/types"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// condaPrefix is the location of the conda environment in the container
+	condaPrefix = "/opt/conda"
+	// defaultCondaBase provides the C library and shell required by conda
+	// packages when no Base header is specified
+	defaultCondaBase = "docker://debian:stable-slim"
+	// micromambaVersion is the micromamba release downloaded when no
+	// MirrorURL header is specified
+	micromambaVersion = "1.5.8"
+	// micromambaURL is the download location of a micromamba release
+	// archive for a conda platform and version
+	micromambaURL = "https://micro.mamba.pm/api/micromamba/%s/%s"
+	// condaEnvShFile activates the conda environment in the container
+	condaEnvShFile = "/.singularity.d/env/80-conda.sh"
+)
+
+// condaPlatforms maps Go architectures to conda platforms
+var condaPlatforms = map[string]string{
+	"amd64":   "linux-64",
+	"arm64":   "linux-aarch64",
+	"ppc64le": "linux-ppc64le",
+}
+
+// sha256Regexp matches the hex encoded sha256 checksum of the
+// MicromambaSHA256 header
+var sha256Regexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// baseConveyorPacker bootstraps the root filesystem the conda
+// environment is installed into
+type baseConveyorPacker interface {
+	Get(*types.Bundle) error
+	Pack() (*types.Bundle, error)
+}
+
+// CondaConveyorPacker installs the conda environment described by an
+// environment file with micromamba on top of a base image
+type CondaConveyorPacker struct {
+	b        *types.Bundle
+	platform string
+	channels []string
+	sum      string
+}
+
+// condaEnvironment holds the parts of a conda environment file used by
+// the conda bootstrap
+type condaEnvironment struct {
+	Channels []string `yaml:"channels"`
+}
+
+// Get bootstraps the base image and creates the conda environment
+// described by the environment file of the From header in it
+func (cp *CondaConveyorPacker) Get(b *types.Bundle) (err error) {
+	cp.b = b
+
+	envFile, ok := b.Recipe.Header["from"]
+	if !ok || envFile == "" {
+		return fmt.Errorf("Invalid conda header, no environment file specified in From")
+	}
+	data, err := ioutil.ReadFile(envFile)
+	if err != nil {
+		return fmt.Errorf("While reading conda environment file: %v", err)
+	}
+	var env condaEnvironment
+	if err := yaml.Unmarshal(data, &env); err != nil {
+		return fmt.Errorf("While parsing conda environment file %s: %v", envFile, err)
+	}
+	cp.channels = condaChannels(b.Recipe.Header["channels"], env.Channels)
+
+	cp.sum = strings.ToLower(strings.TrimPrefix(b.Recipe.Header["micromambasha256"], "sha256:"))
+	if !sha256Regexp.MatchString(cp.sum) {
+		return fmt.Errorf("Invalid conda header, MicromambaSHA256 must hold the sha256 checksum of the micromamba release archive")
+	}
+
+	if err := cp.getBase(); err != nil {
+		return fmt.Errorf("While bootstrapping conda base image: %v", err)
+	}
+
+	arch := runtime.GOARCH
+	if b.Arch != "" {
+		arch = b.Arch
+	}
+	if cp.platform, ok = condaPlatforms[arch]; !ok {
+		return fmt.Errorf("conda bootstrap is not supported on %s", arch)
+	}
+
+	micromamba, err := cp.micromamba()
+	if err != nil {
+		return fmt.Errorf("While getting micromamba: %v", err)
+	}
+
+	prefix := filepath.Join(b.Rootfs(), condaPrefix)
+	args := []string{
+		`create`, `--yes`, `--no-rc`,
+		`--root-prefix`, filepath.Join(b.Path, "conda"),
+		`--prefix`, prefix,
+		// packages are linked as if they were installed in the container
+		`--relocate-prefix`, condaPrefix,
+		`--platform`, cp.platform,
+		`--file`, envFile,
+	}
+	for _, c := range cp.channels {
+		args = append(args, `--channel`, c)
+	}
+
+	cmd := exec.Command(micromamba, args...)
+	// downloaded packages are shared between builds
+	cmd.Env = append(os.Environ(), "CONDA_PKGS_DIRS="+cache.CondaPkgs())
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	sylog.Debugf("\n\tMicromamba Path: %s\n\tPlatform: %s\n\tEnvironment: %s\n\tChannels: %s\n", micromamba, cp.platform, envFile, cp.channels)
+
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("While creating conda environment: %v", err)
+	}
+
+	// micromamba is kept to install packages from %post or in sandboxes
+	if err := copyExecutable(micromamba, filepath.Join(prefix, "bin", "micromamba")); err != nil {
+		return fmt.Errorf("While copying micromamba: %v", err)
+	}
+
+	return nil
+}
+
+// Pack writes the channel configuration and activates the conda
+// environment in the container
+func (cp *CondaConveyorPacker) Pack() (b *types.Bundle, err error) {
+	err = cp.insertCondaRC()
+	if err != nil {
+		return nil, fmt.Errorf("While inserting conda configuration: %v", err)
+	}
+
+	err = cp.insertEnvScript()
+	if err != nil {
+		return nil, fmt.Errorf("While inserting conda environment: %v", err)
+	}
+
+	return cp.b, nil
+}
+
+// getBase bootstraps the root filesystem from the image of the Base
+// header with the conveyor of its transport, other headers are kept for
+// custom registries and libraries
+func (cp *CondaConveyorPacker) getBase() error {
+	base := cp.b.Recipe.Header["base"]
+	if base == "" {
+		base = defaultCondaBase
+	}
+
+	header := make(map[string]string, len(cp.b.Recipe.Header))
+	for k, v := range cp.b.Recipe.Header {
+		header[k] = v
+	}
+
+	var c baseConveyorPacker
+	transport, ref := "", base
+	if i := strings.Index(base, "://"); i >= 0 {
+		transport, ref = base[:i], base[i+3:]
+	}
+	switch transport {
+	case "library":
+		c = &LibraryConveyorPacker{}
+	case "docker", "docker-archive", "docker-daemon", "oci", "oci-archive":
+		c = &OCIConveyorPacker{}
+	case "":
+		if base == "scratch" {
+			c = &ScratchConveyorPacker{}
+		} else {
+			transport = "localimage"
+			c = &LocalConveyorPacker{}
+		}
+	default:
+		return fmt.Errorf("unsupported base image %s", base)
+	}
+	header["bootstrap"] = transport
+	header["from"] = ref
+
+	sylog.Infof("Bootstrapping conda environment on %s", base)
+
+	// the bundle is shared, only the definition header differs
+	bb := *cp.b
+	bb.Recipe.Header = header
+	if err := c.Get(&bb); err != nil {
+		return err
+	}
+	if _, err := c.Pack(); err != nil {
+		return err
+	}
+	cp.b.Arch = bb.Arch
+	return nil
+}
+
+// micromamba returns the path of the micromamba binary extracted from
+// the release archive of the MirrorURL header, or of the pinned release
+// from micro.mamba.pm. The archive must match the MicromambaSHA256 header,
+// verified binaries are cached by checksum.
+func (cp *CondaConveyorPacker) micromamba() (string, error) {
+	path := cache.CondaMicromamba(cp.sum)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	mirrorurl, ok := cp.b.Recipe.Header["mirrorurl"]
+	if !ok {
+		mirrorurl = fmt.Sprintf(micromambaURL, cp.platform, micromambaVersion)
+	}
+
+	sylog.Infof("Downloading micromamba from %s", mirrorurl)
+
+	resp, err := http.Get(mirrorurl)
+	if err != nil {
+		return "", fmt.Errorf("While performing http request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected http status downloading %s: %s", mirrorurl, resp.Status)
+	}
+
+	archive, err := ioutil.TempFile(filepath.Dir(path), "micromamba-archive-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if err := downloadArchive(resp.Body, archive, cp.sum); err != nil {
+		return "", fmt.Errorf("While downloading %s: %v", mirrorurl, err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "micromamba-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := extractMicromamba(archive, f); err != nil {
+		return "", fmt.Errorf("While extracting micromamba: %v", err)
+	}
+	if err := f.Chmod(0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// downloadArchive copies r to f and checks that the content matches the
+// sha256 checksum sum, f is rewound to be read from its beginning
+func downloadArchive(r io.Reader, f *os.File, sum string) error {
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		return fmt.Errorf("sha256 checksum mismatch: expected %s, got %s", sum, got)
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+// extractMicromamba writes the bin/micromamba file of the bzip2
+// compressed release archive read from r to w
+func extractMicromamba(r io.Reader, w io.Writer) error {
+	tr := tar.NewReader(bzip2.NewReader(r))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("bin/micromamba not found in archive")
+		} else if err != nil {
+			return err
+		}
+		if filepath.Clean(hdr.Name) != "bin/micromamba" || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		_, err = io.Copy(w, tr)
+		return err
+	}
+}
+
+// condaChannels returns the channels listed in the Channels header,
+// separated by commas or spaces, followed by the channels of the
+// environment file, duplicates are removed
+func condaChannels(header string, env []string) []string {
+	fields := strings.FieldsFunc(header, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+
+	var channels []string
+	seen := make(map[string]bool)
+	for _, c := range append(fields, env...) {
+		if c == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		channels = append(channels, c)
+	}
+	return channels
+}
+
+// insertCondaRC writes the channels used to create the environment to
+// its .condarc file, so packages installed later come from them
+func (cp *CondaConveyorPacker) insertCondaRC() error {
+	if len(cp.channels) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("channels:\n")
+	for _, c := range cp.channels {
+		fmt.Fprintf(&buf, "  - %s\n", c)
+	}
+	return ioutil.WriteFile(filepath.Join(cp.b.Rootfs(), condaPrefix, ".condarc"), buf.Bytes(), 0644)
+}
+
+func (cp *CondaConveyorPacker) insertEnvScript() error {
+	content := fmt.Sprintf(`#!/bin/sh
+export PATH="%[1]s/bin:$PATH"
+export CONDA_PREFIX="%[1]s"
+export MAMBA_ROOT_PREFIX="%[1]s"
+`, condaPrefix)
+
+	return ioutil.WriteFile(filepath.Join(cp.b.Rootfs(), condaEnvShFile), []byte(content), 0755)
+}
+
+// copyExecutable copies the executable file src to dst
+func copyExecutable(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// CleanUp removes any tmpfs owned by the conveyorPacker on the filesystem
+func (cp *CondaConveyorPacker) CleanUp() {
+	os.RemoveAll(cp.b.Path)
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestCondaChannels(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		env      []string
+		expected []string
+	}{
+		{"none", "", nil, nil},
+		{"header", "conda-forge, bioconda", nil, []string{"conda-forge", "bioconda"}},
+		{"environment", "", []string{"conda-forge", "defaults"}, []string{"conda-forge", "defaults"}},
+		{"both", "bioconda conda-forge", []string{"conda-forge", "defaults"}, []string{"bioconda", "conda-forge", "defaults"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if c := condaChannels(tt.header, tt.env); !reflect.DeepEqual(c, tt.expected) {
+				t.Errorf("unexpected channels %v (expected %v)", c, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExtractMicromamba(t *testing.T) {
+	bzip2, err := exec.LookPath("bzip2")
+	if err != nil {
+		t.Skip("bzip2 not found")
+	}
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, f := range []struct{ name, content string }{
+		{"info/index.json", "{}"},
+		{"bin/micromamba", "micromamba binary"},
+	} {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0755, Size: int64(len(f.content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(f.content))
+	}
+	tw.Close()
+
+	cmd := exec.Command(bzip2, "-c")
+	cmd.Stdin = &archive
+	compressed, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("while compressing archive: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := extractMicromamba(bytes.NewReader(compressed), &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != "micromamba binary" {
+		t.Errorf("unexpected content %q", out.String())
+	}
+
+	cmd = exec.Command(bzip2, "-c")
+	cmd.Stdin = strings.NewReader("")
+	empty, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("while compressing archive: %s", err)
+	}
+	if err := extractMicromamba(bytes.NewReader(empty), &out); err == nil {
+		t.Errorf("unexpected success without micromamba in archive")
+	}
+}
+
+func TestDownloadArchive(t *testing.T) {
+	content := "micromamba archive"
+	sum := sha256.Sum256([]byte(content))
+
+	tests := []struct {
+		name    string
+		sum     string
+		wantErr bool
+	}{
+		{"matching checksum", hex.EncodeToString(sum[:]), false},
+		{"checksum mismatch", strings.Repeat("0", 64), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "micromamba-archive-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+
+			err = downloadArchive(strings.NewReader(content), f, tt.sum)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			// the archive is read again from its beginning
+			b, err := ioutil.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != content {
+				t.Errorf("unexpected content %q", b)
+			}
+		})
+	}
+}
+
+func TestCondaConveyorHeader(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	b, err := types.NewBundle("", "sbuild-conda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(b.Path)
+
+	envFile := filepath.Join(b.Path, "environment.yml")
+	if err := ioutil.WriteFile(envFile, []byte("channels: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	validEnvFile := filepath.Join(b.Path, "valid.yml")
+	if err := ioutil.WriteFile(validEnvFile, []byte("channels: [conda-forge]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+	}{
+		{"no environment file", map[string]string{"bootstrap": "conda"}},
+		{"missing environment file", map[string]string{"bootstrap": "conda", "from": filepath.Join(b.Path, "missing.yml")}},
+		{"invalid environment file", map[string]string{"bootstrap": "conda", "from": envFile}},
+		{"no micromamba checksum", map[string]string{"bootstrap": "conda", "from": validEnvFile}},
+		{"invalid micromamba checksum", map[string]string{"bootstrap": "conda", "from": validEnvFile, "micromambasha256": "sha256:1234"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b.Recipe.Header = tt.header
+			cp := &CondaConveyorPacker{}
+			if err := cp.Get(b); err == nil {
+				t.Errorf("unexpected success")
+			}
+		})
+	}
+}
+
+func TestCondaPacker(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	b, err := types.NewBundle("", "sbuild-conda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(b.Path)
+
+	if err := makeBaseEnv(b.Rootfs()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(b.Rootfs(), condaPrefix), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cp := &CondaConveyorPacker{b: b, channels: []string{"conda-forge", "bioconda"}}
+	if _, err := cp.Pack(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rc, err := ioutil.ReadFile(filepath.Join(b.Rootfs(), condaPrefix, ".condarc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rc) != "channels:\n  - conda-forge\n  - bioconda\n" {
+		t.Errorf("unexpected .condarc content:\n%s", rc)
+	}
+
+	env, err := ioutil.ReadFile(filepath.Join(b.Rootfs(), condaEnvShFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(env), `export PATH="/opt/conda/bin:$PATH"`) {
+		t.Errorf("conda environment not activated:\n%s", env)
+	}
+}
@@ -7,21 +7,27 @@ package sources
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
-	"runtime"
+	"path/filepath"
 	"strings"
 
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/platform"
 	"github.com/sylabs/singularity/pkg/build/types"
 )
 
 // DebootstrapConveyorPacker holds stuff that needs to be packed into the bundle
 type DebootstrapConveyorPacker struct {
-	b         *types.Bundle
-	mirrorurl string
-	osversion string
-	include   string
+	b          *types.Bundle
+	mirrorurl  string
+	osversion  string
+	include    string
+	variant    string
+	components string
+	keyring    string
+	proxy      string
 }
 
 // Get downloads container information from the specified source
@@ -42,12 +48,29 @@ func (cp *DebootstrapConveyorPacker) Get(b *types.Bundle) (err error) {
 		return fmt.Errorf("You must be root to build with debootstrap")
 	}
 
+	// debootstrap runs its second stage under emulation when building
+	// for another architecture
+	want := platform.Host()
+	if cp.b.Opts.Platform != "" {
+		if want, err = platform.Parse(cp.b.Opts.Platform); err != nil {
+			return err
+		}
+	}
+	arch := platform.DebianArch(want)
+	cp.b.Arch = want.Architecture
+
 	// run debootstrap command
-	cmd := exec.Command(debootstrapPath, `--variant=minbase`, `--exclude=openssl,udev,debconf-i18n,e2fsprogs`, `--include=apt,`+cp.include, `--arch=`+runtime.GOARCH, cp.osversion, cp.b.Rootfs(), cp.mirrorurl)
+	cmd := exec.Command(debootstrapPath, cp.args(arch)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	sylog.Debugf("\n\tDebootstrap Path: %s\n\tIncludes: apt(default),%s\n\tDetected Arch: %s\n\tOSVersion: %s\n\tMirrorURL: %s\n", debootstrapPath, cp.include, runtime.GOARCH, cp.osversion, cp.mirrorurl)
+	// debootstrap and apt download packages through the proxy of the
+	// environment, it is not written in the image
+	if cp.proxy != "" {
+		cmd.Env = append(os.Environ(), "http_proxy="+cp.proxy, "https_proxy="+cp.proxy)
+	}
+
+	sylog.Debugf("\n\tDebootstrap Path: %s\n\tIncludes: apt(default),%s\n\tDetected Arch: %s\n\tOSVersion: %s\n\tMirrorURL: %s\n\tVariant: %s\n\tComponents: %s\n\tKeyring: %s\n\tProxy: %s\n", debootstrapPath, cp.include, arch, cp.osversion, cp.mirrorurl, cp.variant, cp.components, cp.keyring, cp.proxy)
 
 	// run debootstrap
 	if err = cmd.Run(); err != nil {
@@ -103,9 +126,50 @@ func (cp *DebootstrapConveyorPacker) getRecipeHeaderInfo() (err error) {
 	//convert Requires string to comma separated list
 	cp.include = strings.Replace(include, ` `, `,`, -1)
 
+	// minbase is the default variant, the buildd, fakechroot and scratchbox
+	// variants are left for debootstrap to check
+	cp.variant = cp.b.Recipe.Header["variant"]
+	if cp.variant == "" {
+		cp.variant = "minbase"
+	}
+	if strings.ContainsAny(cp.variant, " \t,") {
+		return fmt.Errorf("Invalid debootstrap header, Variant must be a single variant name")
+	}
+
+	cp.components = strings.Join(headerFields(cp.b.Recipe.Header["components"]), ",")
+
+	if cp.keyring = cp.b.Recipe.Header["keyring"]; cp.keyring != "" {
+		if !filepath.IsAbs(cp.keyring) {
+			return fmt.Errorf("Invalid debootstrap header, Keyring %s must be an absolute host path", cp.keyring)
+		}
+		if _, err := os.Stat(cp.keyring); err != nil {
+			return fmt.Errorf("Invalid debootstrap header, Keyring: %v", err)
+		}
+	}
+
+	if cp.proxy = cp.b.Recipe.Header["proxy"]; cp.proxy != "" {
+		u, err := url.Parse(cp.proxy)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid debootstrap header, Proxy %s must be an http or https URL", cp.proxy)
+		}
+	}
+
 	return nil
 }
 
+// args returns the debootstrap arguments bootstrapping the rootfs of the
+// bundle for the debian architecture arch
+func (cp *DebootstrapConveyorPacker) args(arch string) []string {
+	args := []string{`--variant=` + cp.variant, `--exclude=openssl,udev,debconf-i18n,e2fsprogs`, `--include=apt,` + cp.include, `--arch=` + arch}
+	if cp.components != "" {
+		args = append(args, `--components=`+cp.components)
+	}
+	if cp.keyring != "" {
+		args = append(args, `--keyring=`+cp.keyring)
+	}
+	return append(args, cp.osversion, cp.b.Rootfs(), cp.mirrorurl)
+}
+
 func (cp *DebootstrapConveyorPacker) insertBaseEnv(b *types.Bundle) (err error) {
 	if err = makeBaseEnv(b.Rootfs()); err != nil {
 		return
@@ -0,0 +1,116 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestDebootstrapHeader(t *testing.T) {
+	if os.Getenv("INCLUDE") != "" {
+		t.Skip("skipping test, INCLUDE environment variable is set")
+	}
+
+	keyring, err := ioutil.TempFile("", "keyring-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring.Close()
+	defer os.Remove(keyring.Name())
+
+	base := map[string]string{
+		"mirrorurl": "http://deb.example.com/debian/",
+		"osversion": "bookworm",
+		"include":   "less",
+	}
+	header := func(extra map[string]string) map[string]string {
+		h := make(map[string]string)
+		for k, v := range base {
+			h[k] = v
+		}
+		for k, v := range extra {
+			h[k] = v
+		}
+		return h
+	}
+
+	tests := []struct {
+		name     string
+		header   map[string]string
+		expected []string
+		proxy    string
+		fail     bool
+	}{
+		{
+			name:     "defaults",
+			header:   header(nil),
+			expected: []string{"--variant=minbase", "--exclude=openssl,udev,debconf-i18n,e2fsprogs", "--include=apt,less", "--arch=amd64", "bookworm", "/rootfs", "http://deb.example.com/debian/"},
+		},
+		{
+			name: "options",
+			header: header(map[string]string{
+				"variant":    "buildd",
+				"components": "main, contrib non-free",
+				"keyring":    keyring.Name(),
+				"proxy":      "http://proxy.example.com:3128",
+			}),
+			expected: []string{"--variant=buildd", "--exclude=openssl,udev,debconf-i18n,e2fsprogs", "--include=apt,less", "--arch=amd64", "--components=main,contrib,non-free", "--keyring=" + keyring.Name(), "bookworm", "/rootfs", "http://deb.example.com/debian/"},
+			proxy:    "http://proxy.example.com:3128",
+		},
+		{
+			name:   "several variants",
+			header: header(map[string]string{"variant": "minbase buildd"}),
+			fail:   true,
+		},
+		{
+			name:   "relative keyring",
+			header: header(map[string]string{"keyring": "keyring.gpg"}),
+			fail:   true,
+		},
+		{
+			name:   "missing keyring",
+			header: header(map[string]string{"keyring": keyring.Name() + ".missing"}),
+			fail:   true,
+		},
+		{
+			name:   "invalid proxy",
+			header: header(map[string]string{"proxy": "socks5://proxy.example.com"}),
+			fail:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := &DebootstrapConveyorPacker{
+				b: &types.Bundle{
+					Recipe:    types.Definition{Header: tt.header},
+					FSObjects: map[string]string{"rootfs": "/rootfs"},
+				},
+			}
+			err := cp.getRecipeHeaderInfo()
+			if tt.fail {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if args := cp.args("amd64"); !reflect.DeepEqual(args, tt.expected) {
+				t.Errorf("unexpected arguments %v (expected %v)", args, tt.expected)
+			}
+			if cp.proxy != tt.proxy {
+				t.Errorf("unexpected proxy %q", cp.proxy)
+			}
+		})
+	}
+}
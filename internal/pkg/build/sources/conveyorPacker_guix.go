@@ -0,0 +1,126 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+const (
+	// guixProfile is the profile of the manifest packages in the container
+	guixProfile = "/var/guix/profiles/default"
+	// guixEnvShFile sources the search paths of the guix profile
+	guixEnvShFile = "/.singularity.d/env/80-guix.sh"
+)
+
+// GuixConveyorPacker installs the packages of a guix manifest in a
+// profile and copies its store closure into the root filesystem
+type GuixConveyorPacker struct {
+	b         *types.Bundle
+	storePath string
+}
+
+// Get creates a profile from the manifest of the From header, with the
+// guix revisions pinned by the channels file of the Channels header, and
+// copies the profile closure into the root filesystem
+func (cp *GuixConveyorPacker) Get(b *types.Bundle) (err error) {
+	cp.b = b
+
+	manifest, ok := b.Recipe.Header["from"]
+	if !ok || manifest == "" {
+		return fmt.Errorf("Invalid guix header, no manifest specified in From")
+	}
+
+	guixPath, err := exec.LookPath("guix")
+	if err != nil {
+		return fmt.Errorf("guix is not in PATH: %v", err)
+	}
+
+	profile := filepath.Join(b.Path, "guix-profile")
+	args := []string{`package`, `--profile=` + profile, `--manifest=` + manifest}
+	if channels := b.Recipe.Header["channels"]; channels != "" {
+		args = append([]string{`time-machine`, `--channels=` + channels, `--`}, args...)
+	}
+
+	cmd := exec.Command(guixPath, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	sylog.Debugf("\n\tGuix Path: %s\n\tManifest: %s\n\tChannels: %s\n", guixPath, manifest, b.Recipe.Header["channels"])
+
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("While installing guix manifest: %v", err)
+	}
+
+	if cp.storePath, err = filepath.EvalSymlinks(profile); err != nil {
+		return fmt.Errorf("While resolving guix profile: %v", err)
+	}
+
+	var out bytes.Buffer
+	cmd = exec.Command(guixPath, `gc`, `--requisites`, cp.storePath)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("While computing guix store closure: %v", err)
+	}
+	closure := strings.Fields(out.String())
+
+	sylog.Infof("Copying %d guix store paths", len(closure))
+	if err := copyStorePaths(b.Rootfs(), closure); err != nil {
+		return fmt.Errorf("While copying guix store closure: %v", err)
+	}
+
+	if err := linkProfile(b.Rootfs(), guixProfile, cp.storePath); err != nil {
+		return fmt.Errorf("While linking guix profile: %v", err)
+	}
+
+	return nil
+}
+
+// Pack puts relevant objects in a Bundle!
+func (cp *GuixConveyorPacker) Pack() (b *types.Bundle, err error) {
+	if err = makeBaseEnv(cp.b.Rootfs()); err != nil {
+		return nil, fmt.Errorf("While inserting base environment: %v", err)
+	}
+
+	if err = cp.insertEnvScript(); err != nil {
+		return nil, fmt.Errorf("While inserting guix environment: %v", err)
+	}
+
+	return cp.b, nil
+}
+
+func (cp *GuixConveyorPacker) insertEnvScript() error {
+	content := fmt.Sprintf(`#!/bin/sh
+GUIX_PROFILE="%s"
+if [ -f "$GUIX_PROFILE/etc/profile" ]; then
+    . "$GUIX_PROFILE/etc/profile"
+fi
+export GUIX_PROFILE
+`, guixProfile)
+
+	return ioutil.WriteFile(filepath.Join(cp.b.Rootfs(), guixEnvShFile), []byte(content), 0755)
+}
+
+// Digest returns the store path of the profile, it's derived from the
+// packages of the manifest and their inputs
+func (cp *GuixConveyorPacker) Digest() string {
+	return cp.storePath
+}
+
+// CleanUp removes any tmpfs owned by the conveyorPacker on the filesystem
+func (cp *GuixConveyorPacker) CleanUp() {
+	os.RemoveAll(cp.b.Path)
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/image"
+	"github.com/sylabs/singularity/pkg/image/unpacker"
+)
+
+// InstanceConveyorPacker snapshots the root filesystem of a running
+// instance, as seen by its processes, into the bundle
+type InstanceConveyorPacker struct {
+	b     *types.Bundle
+	name  string
+	root  string
+	image string
+}
+
+// Get copies the root filesystem of the instance of the From header. The
+// content of the directories mounted in the instance, like /proc, the home
+// directory or bind paths, is not copied. Files mounted in the instance,
+// like /etc/passwd or /etc/resolv.conf, are copied from the instance image
+// rather than as seen by its processes.
+func (cp *InstanceConveyorPacker) Get(b *types.Bundle) (err error) {
+	cp.b = b
+
+	cp.name = instance.ExtractName(b.Recipe.Header["from"])
+	if cp.name == "" {
+		return fmt.Errorf("Invalid instance header, no From specified")
+	}
+
+	// the instances of the user running the build with sudo are
+	// snapshotted rather than the ones of root
+	username := ""
+	if os.Getuid() == 0 {
+		username = os.Getenv("SUDO_USER")
+	}
+	files, err := instance.List(username, cp.name, instance.SingSubDir)
+	if err != nil {
+		return fmt.Errorf("While looking for instance %s: %v", cp.name, err)
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("no instance found with name %s", cp.name)
+	}
+
+	cp.root = fmt.Sprintf("/proc/%d/root", files[0].Pid)
+	cp.image = files[0].Image
+	mounts, err := mountPoints(fmt.Sprintf("/proc/%d/mountinfo", files[0].Pid))
+	if err != nil {
+		return fmt.Errorf("While reading mount points of instance %s: %v", cp.name, err)
+	}
+
+	sylog.Infof("Copying root filesystem of instance %s (%s)", cp.name, files[0].Image)
+	return cp.copyRootfs(mounts)
+}
+
+// Pack puts relevant objects in a Bundle!
+func (cp *InstanceConveyorPacker) Pack() (*types.Bundle, error) {
+	if err := os.Chmod(cp.b.Rootfs(), 0755); err != nil {
+		return nil, fmt.Errorf("While changing bundle rootfs perms: %v", err)
+	}
+	return cp.b, nil
+}
+
+// copyRootfs copies the instance root filesystem with tar excluding the
+// mount points, directory mount points are recreated empty and file mount
+// points are restored from the instance image
+func (cp *InstanceConveyorPacker) copyRootfs(mounts []string) error {
+	args := []string{`--create`, `--file=-`, `--directory=` + cp.root, `--numeric-owner`, `--anchored`, `--no-wildcards`}
+	var dirs, files []string
+	for _, m := range mounts {
+		fi, err := os.Lstat(filepath.Join(cp.root, m))
+		if err != nil {
+			continue
+		}
+		args = append(args, `--exclude=.`+m)
+		if fi.IsDir() {
+			dirs = append(dirs, m)
+		} else if !underDirs(m, dirs) {
+			files = append(files, m)
+		}
+	}
+	args = append(args, `.`)
+
+	var stderr bytes.Buffer
+	create := exec.Command("tar", args...)
+	create.Stderr = &stderr
+	extract := exec.Command("tar", `--extract`, `--file=-`, `--directory=`+cp.b.Rootfs(), `--numeric-owner`, `--same-owner`, `--preserve-permissions`)
+	extract.Stderr = &stderr
+
+	pipe, err := create.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	extract.Stdin = pipe
+
+	sylog.Debugf("Copying %s to %s, excluding %v and %v", cp.root, cp.b.Rootfs(), dirs, files)
+	if err := extract.Start(); err != nil {
+		return fmt.Errorf("While starting tar: %v", err)
+	}
+	if err := create.Run(); err != nil {
+		extract.Wait()
+		return fmt.Errorf("While archiving instance %s root filesystem: %v: %s", cp.name, err, stderr.String())
+	}
+	if err := extract.Wait(); err != nil {
+		return fmt.Errorf("While extracting instance %s root filesystem: %v: %s", cp.name, err, stderr.String())
+	}
+
+	for _, d := range dirs {
+		fi, err := os.Stat(filepath.Join(cp.root, d))
+		if err != nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Join(cp.b.Rootfs(), d), fi.Mode().Perm()); err != nil {
+			return fmt.Errorf("While creating mount point %s: %v", d, err)
+		}
+	}
+	return cp.restoreFiles(files)
+}
+
+// restoreFiles copies the files mounted in the instance from its image,
+// files absent from the image are left out
+func (cp *InstanceConveyorPacker) restoreFiles(files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	img, err := image.Init(cp.image, false)
+	if err != nil {
+		sylog.Warningf("Files mounted in instance %s not restored, could not open image %s: %v", cp.name, cp.image, err)
+		return nil
+	}
+	defer img.File.Close()
+
+	sylog.Debugf("Restoring %v from %s", files, cp.image)
+
+	switch {
+	case img.Type == image.SANDBOX:
+		for _, f := range files {
+			src := filepath.Join(cp.image, f)
+			if _, err := os.Lstat(src); err != nil {
+				continue
+			}
+			var stderr bytes.Buffer
+			cmd := exec.Command("cp", "-a", src, filepath.Join(cp.b.Rootfs(), f))
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("While restoring %s: %v: %s", f, err, stderr.String())
+			}
+		}
+	case len(img.Partitions) > 0 && img.Partitions[0].Type == image.SQUASHFS:
+		reader, err := image.NewPartitionReader(img, "", 0)
+		if err != nil {
+			return fmt.Errorf("While reading image %s: %v", cp.image, err)
+		}
+		paths := make([]string, 0, len(files))
+		for _, f := range files {
+			paths = append(paths, strings.TrimPrefix(f, "/"))
+		}
+		if err := unpacker.NewSquashfs().ExtractFiles(paths, reader, cp.b.Rootfs()); err != nil {
+			return fmt.Errorf("While restoring %v from %s: %v", files, cp.image, err)
+		}
+	default:
+		sylog.Warningf("Files mounted in instance %s not restored, unsupported image format", cp.name)
+	}
+	return nil
+}
+
+// underDirs returns if path is located in one of dirs
+func underDirs(path string, dirs []string) bool {
+	for _, d := range dirs {
+		if strings.HasPrefix(path, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// mountPoints returns the mount points of the mountinfo file at path,
+// except the root filesystem, sorted so parents precede their children
+func mountPoints(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seen := make(map[string]bool)
+	var mounts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		m := unescapeMountPath(fields[4])
+		if m == "/" || seen[m] {
+			continue
+		}
+		seen[m] = true
+		mounts = append(mounts, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(mounts)
+	return mounts, nil
+}
+
+// unescapeMountPath decodes the octal escapes of spaces, tabs, newlines
+// and backslashes in mountinfo paths
+func unescapeMountPath(p string) string {
+	if !strings.Contains(p, `\`) {
+		return p
+	}
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\\' && i+4 <= len(p) {
+			if c, err := strconv.ParseUint(p[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+const instanceMountInfo = `100 90 0:50 / / rw,nosuid,nodev - overlay overlay rw
+101 100 0:4 / /proc rw,nosuid,nodev,noexec - proc proc rw
+102 100 0:51 / /dev rw,nosuid - tmpfs tmpfs rw
+103 102 0:52 / /dev/shm rw,nosuid,nodev - tmpfs tmpfs rw
+104 100 8:1 /home/user /home/user rw,nosuid,nodev - ext4 /dev/sda1 rw
+105 100 8:1 /data/my\040data /mnt/my\040data rw,nosuid,nodev - ext4 /dev/sda1 rw
+106 100 0:51 /hosts /etc/hosts rw,nosuid - tmpfs tmpfs rw
+107 100 0:4 / /proc rw,nosuid,nodev,noexec - proc proc rw
+`
+
+func TestMountPoints(t *testing.T) {
+	f, err := ioutil.TempFile("", "mountinfo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(instanceMountInfo); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	mounts, err := mountPoints(f.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{"/dev", "/dev/shm", "/etc/hosts", "/home/user", "/mnt/my data", "/proc"}
+	if !reflect.DeepEqual(mounts, expected) {
+		t.Errorf("unexpected mount points %q (expected %q)", mounts, expected)
+	}
+
+	if _, err := mountPoints(f.Name() + ".missing"); err == nil {
+		t.Errorf("unexpected success with missing mountinfo")
+	}
+}
+
+func TestInstanceCopyRootfs(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("skipping test, tar not found")
+	}
+
+	dir, err := ioutil.TempDir("", "instance-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	rootfs := filepath.Join(dir, "rootfs")
+	img := filepath.Join(dir, "image")
+	for _, d := range []string{"proc/1", "etc", "home/user/.cache", "opt/app"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"proc/1/status", "etc/hosts", "etc/passwd", "etc/resolv.conf", "home/user/.cache/file", "opt/app/bin"} {
+		if err := ioutil.WriteFile(filepath.Join(root, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// only /etc/passwd exists in the instance image
+	if err := os.MkdirAll(filepath.Join(img, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(img, "etc/passwd"), []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(rootfs, 0755)
+
+	cp := &InstanceConveyorPacker{
+		b: &types.Bundle{
+			FSObjects: map[string]string{"rootfs": rootfs},
+		},
+		name:  "test",
+		root:  root,
+		image: img,
+	}
+	mounts := []string{"/etc/passwd", "/etc/resolv.conf", "/home/user", "/home/user/.cache/file", "/proc", "/sys"}
+	if err := cp.copyRootfs(mounts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, f := range []string{"etc/hosts", "opt/app/bin"} {
+		if _, err := os.Stat(filepath.Join(rootfs, f)); err != nil {
+			t.Errorf("%s not copied: %s", f, err)
+		}
+	}
+
+	// mounted files come from the image
+	if data, err := ioutil.ReadFile(filepath.Join(rootfs, "etc/passwd")); err != nil {
+		t.Errorf("mounted file /etc/passwd not restored: %s", err)
+	} else if string(data) != "image" {
+		t.Errorf("mounted file /etc/passwd copied from the instance: %q", data)
+	}
+	for _, f := range []string{"etc/resolv.conf", "home/user/.cache/file"} {
+		if _, err := os.Stat(filepath.Join(rootfs, f)); err == nil {
+			t.Errorf("mounted file %s copied from the instance", f)
+		}
+	}
+	for _, d := range []string{"proc", "home/user"} {
+		entries, err := ioutil.ReadDir(filepath.Join(rootfs, d))
+		if err != nil {
+			t.Errorf("mount point %s not recreated: %s", d, err)
+		} else if len(entries) != 0 {
+			t.Errorf("content of mount point %s copied", d)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, "sys")); err == nil {
+		t.Errorf("missing mount point /sys created")
+	}
+}
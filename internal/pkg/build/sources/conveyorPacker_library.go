@@ -19,7 +19,8 @@ import (
 // LibraryConveyorPacker only needs to hold a packer to pack the image it pulls
 // as well as extra information about the library it's pulling from
 type LibraryConveyorPacker struct {
-	b *types.Bundle
+	b      *types.Bundle
+	digest string
 	LocalPacker
 }
 
@@ -52,6 +53,7 @@ func (cp *LibraryConveyorPacker) Get(b *types.Bundle) (err error) {
 		return err
 	}
 
+	cp.digest = libraryImage.Hash
 	imageName := uri.GetName(libURI)
 	imagePath := cache.LibraryImage(libraryImage.Hash, imageName)
 
@@ -80,6 +82,11 @@ func (cp *LibraryConveyorPacker) Get(b *types.Bundle) (err error) {
 	return err
 }
 
+// Digest returns the hash of the library image
+func (cp *LibraryConveyorPacker) Digest() string {
+	return cp.digest
+}
+
 // CleanUp removes any tmpfs owned by the conveyorPacker on the filesystem
 func (cp *LibraryConveyorPacker) CleanUp() {
 	os.RemoveAll(cp.b.Path)
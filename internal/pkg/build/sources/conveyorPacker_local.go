@@ -8,9 +8,12 @@ package sources
 import (
 	"fmt"
 	"path/filepath"
+	"runtime"
 
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/build/types"
+	client "github.com/sylabs/singularity/pkg/client/library"
 	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/util/loop"
 )
@@ -46,6 +49,11 @@ func GetLocalPacker(src string, b *types.Bundle) (LocalPacker, error) {
 	case image.SIF:
 		sylog.Debugf("Packing from SIF")
 
+		// keep the architecture of images built for another platform
+		if imageObject.Architecture != runtime.GOARCH {
+			b.Arch = imageObject.Architecture
+		}
+
 		return &SIFPacker{
 			srcfile: src,
 			b:       b,
@@ -93,6 +101,26 @@ func (cp *LocalConveyorPacker) Get(b *types.Bundle) (err error) {
 
 	cp.src = filepath.Clean(b.Recipe.Header["from"])
 
+	// the sandbox bootstrap snapshots a sandbox directory, images are
+	// refused so the definition keeps describing a sandbox
+	if b.Recipe.Header["bootstrap"] == "sandbox" && !fs.IsDir(cp.src) {
+		return fmt.Errorf("sandbox bootstrap requires a sandbox directory, %s is not a directory", cp.src)
+	}
+
 	cp.LocalPacker, err = GetLocalPacker(cp.src, b)
 	return err
 }
+
+// Digest returns the hash of the source image file, sandbox sources
+// have no digest as their content can't be identified cheaply
+func (cp *LocalConveyorPacker) Digest() string {
+	if _, ok := cp.LocalPacker.(*SandboxPacker); ok {
+		return ""
+	}
+	hash, err := client.ImageHash(cp.src)
+	if err != nil {
+		sylog.Debugf("Could not compute hash of %s: %s", cp.src, err)
+		return ""
+	}
+	return hash
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+const (
+	// nixProfile is the profile of the realized flake in the container
+	nixProfile = "/nix/var/nix/profiles/default"
+	// nixFeatures are the experimental features required by flakes
+	nixFeatures = "nix-command flakes"
+)
+
+// NixConveyorPacker realizes a nix flake and copies its store closure
+// into the root filesystem
+type NixConveyorPacker struct {
+	b         *types.Bundle
+	storePath string
+}
+
+// Get realizes the flake of the From header in a profile and copies the
+// profile closure into the root filesystem
+func (cp *NixConveyorPacker) Get(b *types.Bundle) (err error) {
+	cp.b = b
+
+	flake, ok := b.Recipe.Header["from"]
+	if !ok || flake == "" {
+		return fmt.Errorf("Invalid nix header, no flake specified in From")
+	}
+
+	nixPath, err := exec.LookPath("nix")
+	if err != nil {
+		return fmt.Errorf("nix is not in PATH: %v", err)
+	}
+
+	// the profile merges the packages of the flake output in a single
+	// store path
+	profile := filepath.Join(b.Path, "nix-profile")
+	cmd := exec.Command(nixPath, `--extra-experimental-features`, nixFeatures, `profile`, `install`, `--profile`, profile, flake)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	sylog.Debugf("\n\tNix Path: %s\n\tFlake: %s\n", nixPath, flake)
+
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("While realizing nix flake: %v", err)
+	}
+
+	if cp.storePath, err = filepath.EvalSymlinks(profile); err != nil {
+		return fmt.Errorf("While resolving nix profile: %v", err)
+	}
+
+	var out bytes.Buffer
+	cmd = exec.Command(nixPath, `--extra-experimental-features`, nixFeatures, `path-info`, `--recursive`, cp.storePath)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("While computing nix store closure: %v", err)
+	}
+	closure := strings.Fields(out.String())
+
+	sylog.Infof("Copying %d nix store paths", len(closure))
+	if err := copyStorePaths(b.Rootfs(), closure); err != nil {
+		return fmt.Errorf("While copying nix store closure: %v", err)
+	}
+
+	if err := linkProfile(b.Rootfs(), nixProfile, cp.storePath); err != nil {
+		return fmt.Errorf("While linking nix profile: %v", err)
+	}
+
+	return nil
+}
+
+// Pack puts relevant objects in a Bundle!
+func (cp *NixConveyorPacker) Pack() (b *types.Bundle, err error) {
+	if err = makeBaseEnv(cp.b.Rootfs()); err != nil {
+		return nil, fmt.Errorf("While inserting base environment: %v", err)
+	}
+
+	return cp.b, nil
+}
+
+// Digest returns the store path of the realized profile, it's derived
+// from all the inputs of the flake
+func (cp *NixConveyorPacker) Digest() string {
+	return cp.storePath
+}
+
+// CleanUp removes any tmpfs owned by the conveyorPacker on the filesystem
+func (cp *NixConveyorPacker) CleanUp() {
+	os.RemoveAll(cp.b.Path)
+}
+
+// copyStorePaths copies the store paths below the same directory of the
+// root filesystem rootfs, store directories are read-only and are made
+// writable by their owner so the bundle can be removed
+func copyStorePaths(rootfs string, paths []string) error {
+	for _, p := range paths {
+		dir := filepath.Join(rootfs, filepath.Dir(p))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if out, err := exec.Command("cp", "-a", p, dir).CombinedOutput(); err != nil {
+			return fmt.Errorf("while copying %s: %v: %s", p, err, out)
+		}
+		if err := makeDirsWritable(filepath.Join(rootfs, p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeDirsWritable adds the owner write permission to the directories
+// below root
+func makeDirsWritable(root string) error {
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() || fi.Mode().Perm()&0200 != 0 {
+			return nil
+		}
+		return os.Chmod(path, fi.Mode().Perm()|0200)
+	})
+}
+
+// linkProfile links profile to the store path target in rootfs, /bin and
+// /usr/bin/env are linked to the profile when it provides them, so the
+// container has a shell and scripts find their interpreter
+func linkProfile(rootfs, profile, target string) error {
+	if err := os.MkdirAll(filepath.Join(rootfs, filepath.Dir(profile)), 0755); err != nil {
+		return err
+	}
+	if err := os.Symlink(target, filepath.Join(rootfs, profile)); err != nil {
+		return err
+	}
+
+	links := []struct{ path, target string }{
+		{"/bin", filepath.Join(profile, "bin")},
+		{"/usr/bin/env", filepath.Join(profile, "bin", "env")},
+	}
+	for _, l := range links {
+		if _, err := os.Stat(filepath.Join(rootfs, target, strings.TrimPrefix(l.target, profile))); err != nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Join(rootfs, filepath.Dir(l.path)), 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(l.target, filepath.Join(rootfs, l.path)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(rootfs, target, "bin", "sh")); err != nil {
+		sylog.Warningf("%s doesn't provide bin/sh, container actions won't run without a shell", target)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestStoreConveyorHeader(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	b, err := types.NewBundle("", "sbuild-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(b.Path)
+
+	b.Recipe.Header = map[string]string{"bootstrap": "nix"}
+	if err := (&NixConveyorPacker{}).Get(b); err == nil {
+		t.Errorf("unexpected success without flake")
+	}
+	b.Recipe.Header = map[string]string{"bootstrap": "guix"}
+	if err := (&GuixConveyorPacker{}).Get(b); err == nil {
+		t.Errorf("unexpected success without manifest")
+	}
+}
+
+func TestCopyStorePaths(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	store, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	rootfs, err := ioutil.TempDir("", "rootfs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	// a read-only store path providing a shell
+	pkg := filepath.Join(store, "abc-bash")
+	if err := os.MkdirAll(filepath.Join(pkg, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pkg, "bin", "bash"), []byte("#!"), 0555); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bash", filepath.Join(pkg, "bin", "sh")); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(filepath.Join(pkg, "bin"), 0555)
+	os.Chmod(pkg, 0555)
+	defer os.Chmod(pkg, 0755)
+	defer os.Chmod(filepath.Join(pkg, "bin"), 0755)
+
+	if err := copyStorePaths(rootfs, []string{pkg}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fi, err := os.Lstat(filepath.Join(rootfs, pkg, "bin", "sh"))
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symbolic link not copied: %v", err)
+	}
+	fi, err = os.Stat(filepath.Join(rootfs, pkg, "bin"))
+	if err != nil || fi.Mode().Perm() != 0755 {
+		t.Errorf("store directory not writable: %v", err)
+	}
+
+	if err := linkProfile(rootfs, nixProfile, pkg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for link, target := range map[string]string{
+		nixProfile: pkg,
+		"/bin":     filepath.Join(nixProfile, "bin"),
+	} {
+		if l, err := os.Readlink(filepath.Join(rootfs, link)); err != nil || l != target {
+			t.Errorf("%s links to %q, expected %q: %v", link, l, target, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, "usr", "bin", "env")); !os.IsNotExist(err) {
+		t.Errorf("/usr/bin/env linked to a missing file: %v", err)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/containers/image/copy"
@@ -31,6 +32,7 @@ import (
 	imagetools "github.com/opencontainers/image-tools/image"
 	ociclient "github.com/sylabs/singularity/internal/pkg/client/oci"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/platform"
 	"github.com/sylabs/singularity/internal/pkg/util/shell"
 	sytypes "github.com/sylabs/singularity/pkg/build/types"
 )
@@ -56,11 +58,19 @@ func (cp *OCIConveyorPacker) Get(b *sytypes.Bundle) (err error) {
 		return err
 	}
 
+	want := platform.Host()
+	if b.Opts.Platform != "" {
+		if want, err = platform.Parse(b.Opts.Platform); err != nil {
+			return err
+		}
+	}
+
 	cp.sysCtx = &types.SystemContext{
 		OCIInsecureSkipTLSVerify:    cp.b.Opts.NoHTTPS,
 		DockerInsecureSkipTLSVerify: cp.b.Opts.NoHTTPS,
 		DockerAuthConfig:            cp.b.Opts.DockerAuthConfig,
-		OSChoice:                    "linux",
+		OSChoice:                    want.OS,
+		ArchitectureChoice:          want.Architecture,
 	}
 
 	// add registry and namespace to reference if specified
@@ -121,7 +131,7 @@ func (cp *OCIConveyorPacker) Get(b *sytypes.Bundle) (err error) {
 	}
 
 	// Grab the modified source ref from the cache
-	cp.srcRef, err = ociclient.ConvertReference(cp.srcRef, cp.sysCtx)
+	cp.srcRef, err = ociclient.ConvertReference(cp.srcRef, cp.sysCtx, want, b.Opts.StrictPlatform)
 	if err != nil {
 		return err
 	}
@@ -135,14 +145,46 @@ func (cp *OCIConveyorPacker) Get(b *sytypes.Bundle) (err error) {
 		return err
 	}
 
-	cp.imgConfig, err = cp.getConfig()
+	imgSpec, err := cp.getConfig()
 	if err != nil {
 		return err
 	}
+	cp.imgConfig = imgSpec.Config
+
+	return cp.checkPlatform(imgSpec, want)
+}
+
+// checkPlatform verifies the image was built for the requested platform
+// and records its architecture in the bundle
+func (cp *OCIConveyorPacker) checkPlatform(imgSpec imgspecv1.Image, want platform.Platform) error {
+	if imgSpec.Architecture == "" {
+		return nil
+	}
+	got := platform.Platform{OS: imgSpec.OS}
+	got.Architecture, _ = platform.NormalizeArch(imgSpec.Architecture)
 
+	// the image configuration doesn't hold the variant
+	want.Variant = ""
+	if !want.Match(got) {
+		if cp.b.Opts.StrictPlatform {
+			return fmt.Errorf("image platform %s doesn't match the requested platform %s", got, want)
+		}
+		sylog.Warningf("Image platform %s doesn't match the requested platform %s", got, want)
+	}
+	if got.Architecture != runtime.GOARCH {
+		cp.b.Arch = got.Architecture
+	}
 	return nil
 }
 
+// Digest returns the SHA256 sum of the source image manifest
+func (cp *OCIConveyorPacker) Digest() string {
+	if ref, ok := cp.srcRef.(*ociclient.ImageReference); ok {
+		return ref.Digest()
+	}
+	return ""
+}
+
 // Pack puts relevant objects in a Bundle!
 func (cp *OCIConveyorPacker) Pack() (*sytypes.Bundle, error) {
 	err := cp.unpackTmpfs()
@@ -186,19 +228,19 @@ func (cp *OCIConveyorPacker) fetch() (err error) {
 	return nil
 }
 
-func (cp *OCIConveyorPacker) getConfig() (imgspecv1.ImageConfig, error) {
+func (cp *OCIConveyorPacker) getConfig() (imgspecv1.Image, error) {
 	img, err := cp.srcRef.NewImage(context.Background(), cp.sysCtx)
 	if err != nil {
-		return imgspecv1.ImageConfig{}, err
+		return imgspecv1.Image{}, err
 	}
 	defer img.Close()
 
 	imgSpec, err := img.OCIConfig(context.Background())
 	if err != nil {
-		return imgspecv1.ImageConfig{}, err
+		return imgspecv1.Image{}, err
 	}
 
-	return imgSpec.Config, nil
+	return *imgSpec, nil
 }
 
 func (cp *OCIConveyorPacker) insertOCIConfig() error {
@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/sylabs/singularity/internal/pkg/util/platform"
 	"github.com/sylabs/singularity/pkg/build/types"
 )
 
@@ -24,10 +25,18 @@ type ScratchConveyorPacker struct {
 	ScratchConveyor
 }
 
-// Get just stores the source
+// Get just stores the source, an empty image is built for the requested
+// platform whatever the host architecture
 func (c *ScratchConveyor) Get(b *types.Bundle) (err error) {
 	c.b = b
 
+	if b.Opts.Platform != "" {
+		p, err := platform.Parse(b.Opts.Platform)
+		if err != nil {
+			return err
+		}
+		b.Arch = p.Architecture
+	}
 	return nil
 }
 
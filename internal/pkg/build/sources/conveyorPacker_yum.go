@@ -33,7 +33,7 @@ type YumConveyor struct {
 	updateurl string
 	osversion string
 	include   string
-	gpg       string
+	rpm       rpmOptions
 	httpProxy string
 }
 
@@ -159,8 +159,7 @@ func (c *YumConveyor) getRPMPath() (err error) {
 func (c *YumConveyor) getBootstrapOptions() (err error) {
 	var ok bool
 
-	// look for http_proxy and gpg environment vars
-	c.gpg = os.Getenv("GPG")
+	// look for http_proxy environment var
 	c.httpProxy = os.Getenv("http_proxy")
 
 	// get mirrorURL, updateURL, OSVerison, and Includes components to definition
@@ -182,6 +181,13 @@ func (c *YumConveyor) getBootstrapOptions() (err error) {
 		c.updateurl = regex.ReplaceAllString(c.updateurl, c.osversion)
 	}
 
+	// get additional repositories and GPG options, keys of the GPG
+	// environment var are added to the GPGKey ones
+	c.rpm, err = parseRPMOptions(c.b.Recipe.Header, c.b.Recipe.Header["osversion"], false, os.Getenv("GPG"))
+	if err != nil {
+		return fmt.Errorf("Invalid yum header: %v", err)
+	}
+
 	include := c.b.Recipe.Header["include"]
 
 	// check for include environment variable and add it to requires string
@@ -212,11 +218,7 @@ func (c *YumConveyor) genYumConfig() (err error) {
 	fileContent += "exactarch=1\n"
 	fileContent += "obsoletes=1\n"
 	// gpg
-	if c.gpg != "" {
-		fileContent += "gpgcheck=1\n"
-	} else {
-		fileContent += "gpgcheck=0\n"
-	}
+	fileContent += c.gpgOptions()
 	fileContent += "plugins=1\n"
 	fileContent += "reposdir=0\n"
 	fileContent += "deltarpm=0\n"
@@ -228,12 +230,7 @@ func (c *YumConveyor) genYumConfig() (err error) {
 		fileContent += "baseurl=" + c.mirrorurl + "\n"
 	}
 	fileContent += "enabled=1\n"
-	// gpg
-	if c.gpg != "" {
-		fileContent += "gpgcheck=1\n"
-	} else {
-		fileContent += "gpgcheck=0\n"
-	}
+	fileContent += c.gpgOptions()
 
 	// add update section if updateurl is specified
 	if c.updateurl != "" {
@@ -241,12 +238,17 @@ func (c *YumConveyor) genYumConfig() (err error) {
 		fileContent += "name=Linux $releasever - $basearch updates\n"
 		fileContent += "baseurl=" + c.updateurl + "\n"
 		fileContent += "enabled=1\n"
-		// gpg
-		if c.gpg != "" {
-			fileContent += "gpgcheck=1\n"
-		} else {
-			fileContent += "gpgcheck=0\n"
-		}
+		fileContent += c.gpgOptions()
+		fileContent += "\n"
+	}
+
+	// add sections of the repositories of the Repos header
+	for _, r := range c.rpm.repos {
+		fileContent += "[" + r.name + "]\n"
+		fileContent += "name=" + r.name + "\n"
+		fileContent += "baseurl=" + r.url + "\n"
+		fileContent += "enabled=1\n"
+		fileContent += c.gpgOptions()
 		fileContent += "\n"
 	}
 
@@ -260,9 +262,9 @@ func (c *YumConveyor) genYumConfig() (err error) {
 		return fmt.Errorf("While creating %v: %v", filepath.Join(c.b.Rootfs(), yumConf), err)
 	}
 
-	// if gpg key is specified, import it
-	if c.gpg != "" {
-		err = c.importGPGKey()
+	// if gpg keys are specified, import them
+	if len(c.rpm.gpgKeys) > 0 {
+		err = importRPMKeys(c.rpmPath, c.b.Rootfs(), c.rpm.gpgKeys)
 		if err != nil {
 			return fmt.Errorf("While importing GPG key: %v", err)
 		}
@@ -273,36 +275,21 @@ func (c *YumConveyor) genYumConfig() (err error) {
 	return nil
 }
 
-func (c *YumConveyor) importGPGKey() (err error) {
-	sylog.Infof("We have a GPG key!  Preparing RPM database.")
-
-	// make sure gpg is being imported over https
-	if !strings.HasPrefix(c.gpg, "https://") {
-		return fmt.Errorf("GPG key must be fetched with https")
+// gpgOptions returns the gpgcheck and gpgkey options of yum
+// configuration sections
+func (c *YumConveyor) gpgOptions() string {
+	if !c.rpm.gpgCheck {
+		return "gpgcheck=0\n"
 	}
-
-	// make sure curl is installed so rpm can import gpg key
-	if _, err = exec.LookPath("curl"); err != nil {
-		return fmt.Errorf("Neither yum nor dnf in PATH")
-	}
-
-	cmd := exec.Command(c.rpmPath, "--root", c.b.Rootfs(), "--initdb")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err = cmd.Run(); err != nil {
-		return fmt.Errorf("While initializing new rpm db: %v", err)
-	}
-
-	cmd = exec.Command(c.rpmPath, "--root", c.b.Rootfs(), "--import", c.gpg)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err = cmd.Run(); err != nil {
-		return fmt.Errorf("While importing GPG key with rpm: %v", err)
+	options := "gpgcheck=1\n"
+	if len(c.rpm.gpgKeys) > 0 {
+		keys := make([]string, len(c.rpm.gpgKeys))
+		for i, k := range c.rpm.gpgKeys {
+			keys[i] = gpgKeyURL(k)
+		}
+		options += "gpgkey=" + strings.Join(keys, " ") + "\n"
 	}
-
-	sylog.Infof("GPG key import complete!")
-
-	return nil
+	return options
 }
 
 func (c *YumConveyor) copyPseudoDevices() (err error) {
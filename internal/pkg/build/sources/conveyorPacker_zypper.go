@@ -63,6 +63,13 @@ func (cp *ZypperConveyorPacker) Get(b *types.Bundle) (err error) {
 		mirrorurl = regex.ReplaceAllString(mirrorurl, osversion)
 	}
 
+	// get additional repositories and GPG options, zypper checks package
+	// signatures by default
+	opts, err := parseRPMOptions(cp.b.Recipe.Header, cp.b.Recipe.Header["osversion"], true)
+	if err != nil {
+		return fmt.Errorf("Invalid zypper header: %v", err)
+	}
+
 	include := cp.b.Recipe.Header["include"]
 
 	// check for include environment variable and add it to requires string
@@ -85,23 +92,36 @@ func (cp *ZypperConveyorPacker) Get(b *types.Bundle) (err error) {
 		return fmt.Errorf("While copying pseudo devices: %v", err)
 	}
 
-	// Add mirrorURL as repo
-	cmd := exec.Command(zypperPath, `--root`, cp.b.Rootfs(), `ar`, mirrorurl, `repo-oss`)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err = cmd.Run(); err != nil {
-		return fmt.Errorf("While adding zypper mirror: %v", err)
+	// Import the keys of the GPGKey header
+	if err = importRPMKeys("rpm", cp.b.Rootfs(), opts.gpgKeys); err != nil {
+		return fmt.Errorf("While importing GPG key: %v", err)
+	}
+
+	// Add mirrorURL and the repositories of the Repos header
+	repos := append([]rpmRepo{{name: `repo-oss`, url: mirrorurl}}, opts.repos...)
+	for _, r := range repos {
+		cmd := exec.Command(zypperPath, `--root`, cp.b.Rootfs(), `ar`, zypperGPGFlag(opts), r.url, r.name)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err = cmd.Run(); err != nil {
+			return fmt.Errorf("While adding zypper repository %s: %v", r.name, err)
+		}
 	}
 
-	// Refreshing gpg keys
-	cmd = exec.Command(zypperPath, `--root`, cp.b.Rootfs(), `--gpg-auto-import-keys`, `refresh`)
+	// Refreshing gpg keys, only the keys of the GPGKey header are
+	// trusted when it's set
+	args := []string{`--root`, cp.b.Rootfs(), `refresh`}
+	if len(opts.gpgKeys) == 0 {
+		args = []string{`--root`, cp.b.Rootfs(), `--gpg-auto-import-keys`, `refresh`}
+	}
+	cmd := exec.Command(zypperPath, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err = cmd.Run(); err != nil {
 		return fmt.Errorf("While refreshing gpg keys: %v", err)
 	}
 
-	args := []string{`--non-interactive`, `-c`, filepath.Join(cp.b.Rootfs(), zypperConf), `--root`, cp.b.Rootfs(), `--releasever=` + osversion, `-n`, `install`, `--auto-agree-with-licenses`, `--download-in-advance`}
+	args = []string{`--non-interactive`, `-c`, filepath.Join(cp.b.Rootfs(), zypperConf), `--root`, cp.b.Rootfs(), `--releasever=` + osversion, `-n`, `install`, `--auto-agree-with-licenses`, `--download-in-advance`}
 	args = append(args, strings.Fields(include)...)
 
 	// Zypper install command
@@ -182,6 +202,15 @@ func (cp *ZypperConveyorPacker) genZypperConfig() (err error) {
 	return nil
 }
 
+// zypperGPGFlag returns the zypper addrepo flag enabling or disabling the
+// package signature checks of a repository
+func zypperGPGFlag(opts rpmOptions) string {
+	if opts.gpgCheck {
+		return `--gpgcheck`
+	}
+	return `--no-gpgcheck`
+}
+
 func (cp *ZypperConveyorPacker) copyPseudoDevices() (err error) {
 	err = os.Mkdir(filepath.Join(cp.b.Rootfs(), "/dev"), 0775)
 	if err != nil {
@@ -28,7 +28,9 @@ func (p *SandboxPacker) Pack() (*types.Bundle, error) {
 	// copy filesystem into bundle rootfs
 	sylog.Debugf("Copying file system from %s to %s in Bundle\n", rootfs, p.b.Rootfs())
 	var stderr bytes.Buffer
-	cmd := exec.Command("cp", "-r", rootfs+`/.`, p.b.Rootfs())
+	// modification times are kept, they identify unchanged files
+	// when converting the same sandbox again
+	cmd := exec.Command("cp", "-r", "--preserve=timestamps", rootfs+`/.`, p.b.Rootfs())
 	cmd.Stderr = &stderr
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("cp Failed: %v: %v", err, stderr.String())
@@ -0,0 +1,152 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// rpmRepo is an additional repository of the Repos header of yum and
+// zypper bootstraps
+type rpmRepo struct {
+	name string
+	url  string
+}
+
+// rpmOptions are the repository options of yum and zypper bootstraps set
+// by the Repos, GPGKey and GPGCheck headers
+type rpmOptions struct {
+	repos    []rpmRepo
+	gpgKeys  []string
+	gpgCheck bool
+}
+
+// repoNameRegex matches the names allowed for repository sections and
+// aliases
+var repoNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.:-]*$`)
+
+// headerFields returns the values of a header separated by commas or
+// spaces
+func headerFields(header string) []string {
+	return strings.FieldsFunc(header, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// parseRPMOptions returns the repository options of header. Repos lists
+// name=url repositories added to the MirrorURL one, %{OSVERSION} is
+// replaced by osversion in their URLs. GPGKey lists the https URLs or host
+// paths of the keys imported in the rpm database of the image, non empty
+// keys are added to them. GPGCheck enables or disables package signature
+// checks, they are enabled when keys are given or when check is true
+// otherwise.
+func parseRPMOptions(header map[string]string, osversion string, check bool, keys ...string) (rpmOptions, error) {
+	var o rpmOptions
+
+	regex := regexp.MustCompile(`(?i)%{OSVERSION}`)
+	seen := make(map[string]bool)
+	for _, r := range headerFields(header["repos"]) {
+		toks := strings.SplitN(r, "=", 2)
+		if len(toks) != 2 || toks[1] == "" {
+			return o, fmt.Errorf("invalid repository %q in Repos header, expected name=url", r)
+		}
+		if !repoNameRegex.MatchString(toks[0]) {
+			return o, fmt.Errorf("invalid repository name %q in Repos header", toks[0])
+		}
+		if toks[0] == "base" || toks[0] == "updates" || toks[0] == "repo-oss" || seen[toks[0]] {
+			return o, fmt.Errorf("repository name %q of Repos header is already used", toks[0])
+		}
+		seen[toks[0]] = true
+		if regex.MatchString(toks[1]) {
+			if osversion == "" {
+				return o, fmt.Errorf("OSVersion referenced in repository %s but no OSVersion specified", toks[0])
+			}
+			toks[1] = regex.ReplaceAllString(toks[1], osversion)
+		}
+		o.repos = append(o.repos, rpmRepo{name: toks[0], url: toks[1]})
+	}
+
+	for _, k := range append(headerFields(header["gpgkey"]), keys...) {
+		if k == "" {
+			continue
+		}
+		k = strings.TrimPrefix(k, "file://")
+		if !strings.HasPrefix(k, "https://") && !filepath.IsAbs(k) {
+			return o, fmt.Errorf("GPG key %s must be fetched with https or be an absolute host path", k)
+		}
+		o.gpgKeys = append(o.gpgKeys, k)
+	}
+
+	o.gpgCheck = check || len(o.gpgKeys) > 0
+	if v, ok := header["gpgcheck"]; ok {
+		switch strings.ToLower(v) {
+		case "yes", "true", "1":
+			o.gpgCheck = true
+		case "no", "false", "0":
+			o.gpgCheck = false
+		default:
+			return o, fmt.Errorf("invalid GPGCheck header %q, expected yes or no", v)
+		}
+	}
+
+	return o, nil
+}
+
+// gpgKeyURL returns the URL of key for repository definitions
+func gpgKeyURL(key string) string {
+	if filepath.IsAbs(key) {
+		return "file://" + key
+	}
+	return key
+}
+
+// importRPMKeys initializes the rpm database of rootfs and imports keys
+// in it
+func importRPMKeys(rpmPath, rootfs string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	sylog.Infof("We have a GPG key!  Preparing RPM database.")
+
+	for _, k := range keys {
+		if !strings.HasPrefix(k, "https://") {
+			continue
+		}
+		// make sure curl is installed so rpm can import gpg key
+		if _, err := exec.LookPath("curl"); err != nil {
+			return fmt.Errorf("curl is required to import GPG key %s: %v", k, err)
+		}
+		break
+	}
+
+	cmd := exec.Command(rpmPath, "--root", rootfs, "--initdb")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("While initializing new rpm db: %v", err)
+	}
+
+	for _, k := range keys {
+		cmd = exec.Command(rpmPath, "--root", rootfs, "--import", k)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("While importing GPG key %s with rpm: %v", k, err)
+		}
+	}
+
+	sylog.Infof("GPG key import complete!")
+
+	return nil
+}
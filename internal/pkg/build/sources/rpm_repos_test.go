@@ -0,0 +1,134 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRPMOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   map[string]string
+		check    bool
+		keys     []string
+		expected rpmOptions
+		fail     bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:     "default check",
+			check:    true,
+			expected: rpmOptions{gpgCheck: true},
+		},
+		{
+			name: "repos",
+			header: map[string]string{
+				"osversion": "8",
+				"repos":     "appstream=https://mirror.example.com/el%{OSVERSION}/appstream/, internal=http://repo.example.com/",
+			},
+			expected: rpmOptions{repos: []rpmRepo{
+				{name: "appstream", url: "https://mirror.example.com/el8/appstream/"},
+				{name: "internal", url: "http://repo.example.com/"},
+			}},
+		},
+		{
+			name: "keys",
+			header: map[string]string{
+				"gpgkey": "https://mirror.example.com/RPM-GPG-KEY file:///etc/pki/rpm-gpg/RPM-GPG-KEY-internal",
+			},
+			keys: []string{"", "https://example.com/KEY"},
+			expected: rpmOptions{
+				gpgKeys:  []string{"https://mirror.example.com/RPM-GPG-KEY", "/etc/pki/rpm-gpg/RPM-GPG-KEY-internal", "https://example.com/KEY"},
+				gpgCheck: true,
+			},
+		},
+		{
+			name:     "disable check",
+			header:   map[string]string{"gpgkey": "/etc/pki/KEY", "gpgcheck": "no"},
+			check:    true,
+			expected: rpmOptions{gpgKeys: []string{"/etc/pki/KEY"}},
+		},
+		{
+			name:     "enable check",
+			header:   map[string]string{"gpgcheck": "Yes"},
+			expected: rpmOptions{gpgCheck: true},
+		},
+		{
+			name:   "invalid check",
+			header: map[string]string{"gpgcheck": "maybe"},
+			fail:   true,
+		},
+		{
+			name:   "http key",
+			header: map[string]string{"gpgkey": "http://mirror.example.com/RPM-GPG-KEY"},
+			fail:   true,
+		},
+		{
+			name:   "relative key",
+			header: map[string]string{"gpgkey": "RPM-GPG-KEY"},
+			fail:   true,
+		},
+		{
+			name:   "missing url",
+			header: map[string]string{"repos": "internal"},
+			fail:   true,
+		},
+		{
+			name:   "invalid name",
+			header: map[string]string{"repos": "[internal]=https://repo.example.com/"},
+			fail:   true,
+		},
+		{
+			name:   "duplicate name",
+			header: map[string]string{"repos": "a=https://a.example.com/ a=https://b.example.com/"},
+			fail:   true,
+		},
+		{
+			name:   "reserved name",
+			header: map[string]string{"repos": "base=https://repo.example.com/"},
+			fail:   true,
+		},
+		{
+			name:   "missing osversion",
+			header: map[string]string{"repos": "internal=https://repo.example.com/el%{OSVERSION}/"},
+			fail:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := parseRPMOptions(tt.header, tt.header["osversion"], tt.check, tt.keys...)
+			if tt.fail {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(o, tt.expected) {
+				t.Errorf("unexpected options %+v (expected %+v)", o, tt.expected)
+			}
+		})
+	}
+}
+
+func TestYumGPGOptions(t *testing.T) {
+	c := &YumConveyor{}
+	if o := c.gpgOptions(); o != "gpgcheck=0\n" {
+		t.Errorf("unexpected options %q", o)
+	}
+
+	c.rpm = rpmOptions{gpgKeys: []string{"https://example.com/KEY", "/etc/pki/KEY"}, gpgCheck: true}
+	if o := c.gpgOptions(); o != "gpgcheck=1\ngpgkey=https://example.com/KEY file:///etc/pki/KEY\n" {
+		t.Errorf("unexpected options %q", o)
+	}
+}
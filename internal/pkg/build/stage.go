@@ -9,9 +9,11 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"runtime"
 	"syscall"
 
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/platform"
 	"github.com/sylabs/singularity/pkg/build/types"
 )
 
@@ -32,10 +34,23 @@ func (s *stage) Assemble(path string) error {
 	return s.a.Assemble(s.b, path)
 }
 
+// requestedArch returns the Go architecture of the platform requested
+// for the stage, or the host architecture
+func (s *stage) requestedArch() (string, error) {
+	if s.b.Opts.Platform == "" {
+		return runtime.GOARCH, nil
+	}
+	p, err := platform.Parse(s.b.Opts.Platform)
+	if err != nil {
+		return "", err
+	}
+	return p.Architecture, nil
+}
+
 // runPreScript() executes the stages pre script on host
 func (s *stage) runPreScript() error {
 	if s.b.RunSection("pre") && s.b.Recipe.BuildData.Pre.Script != "" {
-		if syscall.Getuid() != 0 {
+		if syscall.Getuid() != 0 && s.b.Opts.FakerootMode == "" {
 			return fmt.Errorf("attempted to build with scripts as non-root user")
 		}
 
@@ -0,0 +1,309 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/build/types/parser"
+)
+
+// StdinSpec is the build spec reading the definition file, or a context
+// archive, from standard input
+const StdinSpec = "-"
+
+// contextDefinitions are the names of the definition file looked up at
+// the root of a context archive, a single .def file is used otherwise
+var contextDefinitions = []string{"Singularity", "Singularity.def"}
+
+// streamSuffixes are the URL path suffixes identifying a definition file
+// or a context archive, other http(s) URLs refer to images
+var streamSuffixes = []string{".def", ".tar", ".tar.gz", ".tgz"}
+
+// streamTimeout is the timeout in seconds of a build spec download
+const streamTimeout = 1800
+
+// IsStreamSpec returns if the build spec is read from standard input or
+// downloaded from an http(s) URL of a definition file or context archive
+func IsStreamSpec(spec string) bool {
+	if spec == StdinSpec {
+		return true
+	}
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	for _, s := range streamSuffixes {
+		if strings.HasSuffix(u.Path, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenStream returns a reader for a build spec identified by IsStreamSpec
+func OpenStream(spec string) (io.ReadCloser, error) {
+	if spec == StdinSpec {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("build spec %s must be downloaded with https", spec)
+	}
+
+	sylog.Verbosef("Downloading build spec %s", spec)
+
+	client := &http.Client{
+		Timeout: streamTimeout * time.Second,
+	}
+	resp, err := client.Get(spec)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("download failed with status %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// MakeAllDefsFromStream gets a definition slice from r holding either a
+// definition file or a tar archive, optionally gzip compressed, of a
+// definition file and the context files it references. Context files
+// are extracted in a temporary directory created in tmpDir and relative
+// host paths of the %files section are resolved from it, the returned
+// directory must be removed by the caller once the build is done.
+// Placeholders of the definition file are replaced by buildArgs values.
+// Context archives are not supported by remote builds, definitions can be
+// read without root privileges for remote and unprivileged builds.
+func MakeAllDefsFromStream(r io.Reader, tmpDir string, remote, unprivileged bool, buildArgs map[string]string) ([]types.Definition, string, error) {
+	br := bufio.NewReader(r)
+
+	// Peek returns the available bytes for short streams
+	magic, _ := br.Peek(262)
+
+	var archive io.Reader
+
+	if len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, "", fmt.Errorf("while reading compressed context archive: %s", err)
+		}
+		defer zr.Close()
+		archive = zr
+	} else if len(magic) == 262 && string(magic[257:262]) == "ustar" {
+		archive = br
+	}
+
+	// must be root to build from a definition
+	if os.Getuid() != 0 && !remote && !unprivileged {
+		return nil, "", fmt.Errorf("you must be the root user to build from a definition file, or use --fakeroot")
+	}
+
+	if archive == nil {
+		def, err := parser.ExpandIncludes(br, "")
+		if err != nil {
+			return nil, "", fmt.Errorf("while including files: %v", err)
+		}
+		def, err = parser.ApplyBuildArgs(def, buildArgs)
+		if err != nil {
+			return nil, "", fmt.Errorf("while applying build arguments: %v", err)
+		}
+		defs, err := parser.All(def)
+		if err != nil {
+			return nil, "", fmt.Errorf("while parsing definition: %v", err)
+		}
+		return defs, "", nil
+	}
+
+	if remote {
+		return nil, "", fmt.Errorf("context archives are not supported by remote builds")
+	}
+
+	dir, err := ioutil.TempDir(tmpDir, "build-context-")
+	if err != nil {
+		return nil, "", fmt.Errorf("could not create context directory: %s", err)
+	}
+
+	defs, err := makeAllDefsFromArchive(archive, dir, buildArgs)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+	return defs, dir, nil
+}
+
+func makeAllDefsFromArchive(archive io.Reader, dir string, buildArgs map[string]string) ([]types.Definition, error) {
+	if err := extractContext(archive, dir); err != nil {
+		return nil, fmt.Errorf("while extracting context archive: %s", err)
+	}
+
+	path, err := findContextDefinition(dir)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	def, err := parser.ExpandIncludes(f, path)
+	if err != nil {
+		return nil, fmt.Errorf("while including files: %v", err)
+	}
+	def, err = parser.ApplyBuildArgs(def, buildArgs)
+	if err != nil {
+		return nil, fmt.Errorf("while applying build arguments: %s: %v", filepath.Base(path), err)
+	}
+	defs, err := parser.All(def)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing definition: %s: %v", filepath.Base(path), err)
+	}
+
+	for i := range defs {
+		for j := range defs[i].BuildData.Files {
+			files := &defs[i].BuildData.Files[j]
+			// files copied from a previous stage are not context files
+			if files.Args != "" {
+				continue
+			}
+			for k := range files.Files {
+				t := &files.Files[k]
+				if t.Src == "" || filepath.IsAbs(t.Src) {
+					continue
+				}
+				if t.Dst == "" {
+					t.Dst = t.Src
+				}
+				t.Src = filepath.Join(dir, t.Src)
+			}
+		}
+	}
+	return defs, nil
+}
+
+// findContextDefinition returns the path of the definition file found
+// at the root of the context directory dir
+func findContextDefinition(dir string) (string, error) {
+	for _, name := range contextDefinitions {
+		path := filepath.Join(dir, name)
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+			return path, nil
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.def"))
+	if len(matches) != 1 {
+		return "", fmt.Errorf("no definition file found in context archive, expected %s or a single .def file", strings.Join(contextDefinitions, ", "))
+	}
+	return matches[0], nil
+}
+
+// extractContext extracts directories, regular files and symbolic links
+// of a tar archive in dir, entries escaping dir directly or through a
+// symbolic link, symbolic links pointing outside of dir and entries
+// replacing a previously extracted one are rejected
+func extractContext(r io.Reader, dir string) error {
+	links := make(map[string]bool)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(hdr.Name)
+		if isOutside(name) {
+			return fmt.Errorf("entry %s is outside of the archive", hdr.Name)
+		}
+		if name == "." {
+			continue
+		}
+		for p := filepath.Dir(name); p != "."; p = filepath.Dir(p) {
+			if links[p] {
+				return fmt.Errorf("entry %s is under symbolic link %s", hdr.Name, p)
+			}
+		}
+
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		fi, err := os.Lstat(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		exists := err == nil
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if exists && !fi.IsDir() {
+				return fmt.Errorf("directory entry %s replaces an existing file", hdr.Name)
+			} else if exists {
+				continue
+			}
+			if err := os.Mkdir(path, os.FileMode(hdr.Mode).Perm()|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if exists {
+				return fmt.Errorf("entry %s replaces an existing file", hdr.Name)
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|syscall.O_NOFOLLOW, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if exists {
+				return fmt.Errorf("symbolic link entry %s replaces an existing file", hdr.Name)
+			}
+			target := filepath.Join(filepath.Dir(name), hdr.Linkname)
+			if filepath.IsAbs(hdr.Linkname) || isOutside(target) {
+				return fmt.Errorf("symbolic link %s points outside of the archive", hdr.Name)
+			}
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return err
+			}
+			links[name] = true
+		default:
+			sylog.Warningf("Skipping unsupported entry %s of context archive", hdr.Name)
+		}
+	}
+}
+
+// isOutside returns if the cleaned relative path name escapes the
+// directory it's relative to
+func isOutside(name string) bool {
+	return filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../")
+}
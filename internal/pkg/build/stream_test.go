@@ -0,0 +1,105 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+// entry is a context archive entry, a symbolic link if link is set, a
+// directory if name ends with a slash and a regular file otherwise
+type entry struct {
+	name    string
+	link    string
+	content string
+}
+
+func makeArchive(t *testing.T, entries []entry) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644}
+		switch {
+		case e.link != "":
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = e.link
+		case e.name[len(e.name)-1] == '/':
+			hdr.Typeflag = tar.TypeDir
+			hdr.Mode = 0755
+		default:
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(e.content))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestExtractContext(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		name    string
+		entries []entry
+		succeed bool
+	}{
+		{"valid", []entry{{name: "dir/"}, {name: "dir/file", content: "data"}, {name: "link", link: "dir/file"}, {name: "dir/up", link: "../link"}}, true},
+		{"absolute entry", []entry{{name: "/etc/passwd", content: "root"}}, false},
+		{"parent entry", []entry{{name: "../file", content: "data"}}, false},
+		{"absolute link", []entry{{name: "a", link: "/etc/passwd"}}, false},
+		{"escaping link", []entry{{name: "dir/a", link: "../../etc/passwd"}}, false},
+		{"file replacing link", []entry{{name: "a", link: "b"}, {name: "a", content: "root::0:0::/root:/bin/sh"}}, false},
+		{"file replacing file", []entry{{name: "a", content: "first"}, {name: "a", content: "second"}}, false},
+		{"directory replacing link", []entry{{name: "a", link: "b"}, {name: "a/"}}, false},
+		{"entry under link", []entry{{name: "b/"}, {name: "a", link: "b"}, {name: "a/file", content: "data"}}, false},
+	}
+
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "context-")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = extractContext(makeArchive(t, tt.entries), dir)
+		if tt.succeed && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if !tt.succeed && err == nil {
+			t.Errorf("%s: unexpected success", tt.name)
+		}
+
+		if tt.succeed {
+			b, err := ioutil.ReadFile(filepath.Join(dir, "link"))
+			if err != nil || string(b) != "data" {
+				t.Errorf("%s: unexpected content of extracted link: %q %v", tt.name, b, err)
+			}
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestOpenStream(t *testing.T) {
+	if _, err := OpenStream("http://example.com/Singularity.def"); err == nil {
+		t.Errorf("unexpected success with an http build spec")
+	}
+}
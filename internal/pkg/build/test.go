@@ -0,0 +1,95 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// testFailure is returned when the %test section of a stage failed, the
+// image is still assembled with --keep-failed
+type testFailure struct {
+	stage string
+	err   error
+}
+
+func (e *testFailure) Error() string {
+	if e.stage != "" {
+		return fmt.Sprintf("%%test of stage %s failed: %v", e.stage, e.err)
+	}
+	return fmt.Sprintf("%%test failed: %v", e.err)
+}
+
+// runTestSection runs only the %test section of the stage
+func (s *stage) runTestSection() error {
+	def := s.b.Recipe
+	if !s.b.RunSection("test") || s.b.Opts.NoTest || def.BuildData.Test.Script == "" {
+		return nil
+	}
+
+	opts := s.b.Opts
+	defer func() {
+		s.b.Opts = opts
+	}()
+	skip, err := s.applyTestHeaders()
+	if err != nil {
+		return err
+	}
+	if skip {
+		sylog.Infof("Skipping %%test section as requested by the TestSkip header")
+		return nil
+	}
+	s.b.Opts.Sections = []string{"test"}
+
+	if err := runBuildEngine(s.b); err != nil {
+		return &testFailure{stage: s.name, err: err}
+	}
+	return nil
+}
+
+// applyTestHeaders sets the test options from the TestTimeout and
+// TestRetries headers of the stage definition when they were not set on
+// the command line, skip is true when the TestSkip header is set
+func (s *stage) applyTestHeaders() (skip bool, err error) {
+	header := s.b.Recipe.Header
+
+	if v := header["testskip"]; v != "" {
+		if skip, err = parseHeaderBool(v); err != nil {
+			return false, fmt.Errorf("invalid TestSkip header %s: %s", v, err)
+		}
+	}
+	if v := header["testtimeout"]; v != "" && s.b.Opts.TestTimeout == 0 {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return false, fmt.Errorf("invalid TestTimeout header %s, expected a duration such as 90s or 30m", v)
+		}
+		s.b.Opts.TestTimeout = d
+	}
+	if v := header["testretries"]; v != "" && s.b.Opts.TestRetries == 0 {
+		n, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return false, fmt.Errorf("invalid TestRetries header %s: %s", v, err)
+		}
+		s.b.Opts.TestRetries = int(n)
+	}
+	return skip, nil
+}
+
+// parseHeaderBool parses the yes/no and true/false values of headers
+func parseHeaderBool(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "yes", "y":
+		return true, nil
+	case "no", "n":
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
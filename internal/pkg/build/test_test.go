@@ -0,0 +1,104 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestApplyTestHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  map[string]string
+		opts    types.Options
+		skip    bool
+		timeout time.Duration
+		retries int
+		wantErr bool
+	}{
+		{"NoHeader", nil, types.Options{}, false, 0, 0, false},
+		{"Headers", map[string]string{"testtimeout": "90s", "testretries": "2"}, types.Options{}, false, 90 * time.Second, 2, false},
+		{"CommandLinePrecedence", map[string]string{"testtimeout": "90s", "testretries": "2"}, types.Options{TestTimeout: time.Minute, TestRetries: 1}, false, time.Minute, 1, false},
+		{"SkipYes", map[string]string{"testskip": "yes"}, types.Options{}, true, 0, 0, false},
+		{"SkipTrue", map[string]string{"testskip": "True"}, types.Options{}, true, 0, 0, false},
+		{"SkipNo", map[string]string{"testskip": "n"}, types.Options{}, false, 0, 0, false},
+		{"BadSkip", map[string]string{"testskip": "maybe"}, types.Options{}, false, 0, 0, true},
+		{"BadTimeout", map[string]string{"testtimeout": "90"}, types.Options{}, false, 0, 0, true},
+		{"NegativeTimeout", map[string]string{"testtimeout": "-1s"}, types.Options{}, false, 0, 0, true},
+		{"BadRetries", map[string]string{"testretries": "-1"}, types.Options{}, false, 0, 0, true},
+		{"TooManyRetries", map[string]string{"testretries": "256"}, types.Options{}, false, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &stage{b: &types.Bundle{Recipe: types.Definition{Header: tt.header}, Opts: tt.opts}}
+
+			skip, err := s.applyTestHeaders()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if skip != tt.skip {
+				t.Errorf("unexpected skip %v", skip)
+			}
+			if s.b.Opts.TestTimeout != tt.timeout || s.b.Opts.TestRetries != tt.retries {
+				t.Errorf("unexpected test options: timeout %s, retries %d", s.b.Opts.TestTimeout, s.b.Opts.TestRetries)
+			}
+		})
+	}
+}
+
+func TestRunTestSectionSkip(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		opts   types.Options
+		header map[string]string
+	}{
+		{"NoScript", "", types.Options{Sections: []string{"all"}}, nil},
+		{"NoTest", "false", types.Options{Sections: []string{"all"}, NoTest: true}, nil},
+		{"OtherSection", "false", types.Options{Sections: []string{"post"}}, nil},
+		{"TestSkip", "false", types.Options{Sections: []string{"all"}}, map[string]string{"testskip": "yes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := types.Definition{Header: tt.header}
+			def.BuildData.Test.Script = tt.script
+			s := &stage{b: &types.Bundle{Recipe: def, Opts: tt.opts}}
+
+			// the build engine isn't started when the test is skipped
+			if err := s.runTestSection(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if len(s.b.Opts.Sections) != len(tt.opts.Sections) || s.b.Opts.Sections[0] != tt.opts.Sections[0] {
+				t.Errorf("unexpected sections %v after skipped test", s.b.Opts.Sections)
+			}
+		})
+	}
+}
+
+func TestTestFailure(t *testing.T) {
+	errTest := errors.New("failure")
+
+	err := &testFailure{stage: "devel", err: errTest}
+	if err.Error() != "%test of stage devel failed: failure" {
+		t.Errorf("unexpected error message %q", err)
+	}
+	err = &testFailure{err: errTest}
+	if err.Error() != "%test failed: failure" {
+		t.Errorf("unexpected error message %q", err)
+	}
+}
@@ -6,9 +6,13 @@
 package cgroups
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/containerd/cgroups"
@@ -133,6 +137,33 @@ func (m *Manager) Remove() error {
 	return m.cgroup.Delete()
 }
 
+// Pids returns the process IDs of all processes in the cgroup and its
+// child cgroups
+func (m *Manager) Pids() ([]int, error) {
+	if m.cgroup == nil {
+		var err error
+		if m.Path != "" {
+			m.cgroup, err = cgroups.Load(cgroups.V1, cgroups.StaticPath(m.Path))
+		} else {
+			err = m.loadFromPid()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	processes, err := m.cgroup.Processes(cgroups.Freezer, true)
+	if err != nil {
+		return nil, err
+	}
+
+	pids := make([]int, 0, len(processes))
+	for _, p := range processes {
+		pids = append(pids, p.Pid)
+	}
+	return pids, nil
+}
+
 // Pause suspends all processes inside the container
 func (m *Manager) Pause() error {
 	if m.cgroup == nil {
@@ -152,3 +183,102 @@ func (m *Manager) Resume() error {
 	}
 	return m.cgroup.Thaw()
 }
+
+// memoryPath returns the memory controller directory of the cgroup
+func (m *Manager) memoryPath() (string, error) {
+	if m.cgroup == nil {
+		return "", fmt.Errorf("no cgroup loaded")
+	}
+	for _, sub := range m.cgroup.Subsystems() {
+		if sub.Name() != cgroups.Memory {
+			continue
+		}
+		if p, ok := sub.(interface{ Path(string) string }); ok {
+			return p.Path(m.Path), nil
+		}
+	}
+	return "", cgroups.ErrMemoryNotSupported
+}
+
+// parseOOMKill returns the oom_kill counter of memory.oom_control content
+func parseOOMKill(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no oom_kill counter found")
+}
+
+// OOMKillCount returns the number of processes of the cgroup killed by
+// the out of memory killer, it requires a kernel reporting oom_kill in
+// memory.oom_control (4.13 or later)
+func (m *Manager) OOMKillCount() (uint64, error) {
+	path, err := m.memoryPath()
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Open(filepath.Join(path, "memory.oom_control"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return parseOOMKill(f)
+}
+
+// OOMEvents returns a channel receiving the out of memory kill counter
+// each time processes of the cgroup are killed by the out of memory
+// killer, the channel is closed once the cgroup is removed
+func (m *Manager) OOMEvents() (<-chan uint64, error) {
+	if m.cgroup == nil {
+		return nil, fmt.Errorf("no cgroup loaded")
+	}
+	last, err := m.OOMKillCount()
+	if err != nil {
+		return nil, err
+	}
+	fd, err := m.cgroup.OOMEventFD()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan uint64)
+
+	go func() {
+		efd := os.NewFile(fd, "oom-eventfd")
+		defer efd.Close()
+		defer close(events)
+
+		buf := make([]byte, 8)
+		for {
+			// event is also triggered when the cgroup is removed
+			if _, err := efd.Read(buf); err != nil {
+				return
+			}
+			count, err := m.OOMKillCount()
+			if err != nil {
+				return
+			}
+			if count > last {
+				last = count
+				events <- count
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// Stats returns the resource usage statistics of the cgroup
+func (m *Manager) Stats() (*cgroups.Metrics, error) {
+	if m.cgroup == nil {
+		return nil, fmt.Errorf("no cgroup loaded")
+	}
+	return m.cgroup.Stat(cgroups.IgnoreNotExist)
+}
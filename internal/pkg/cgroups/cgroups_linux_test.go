@@ -188,3 +188,42 @@ func TestPauseResume(t *testing.T) {
 
 	cmd.Wait()
 }
+
+func TestParseOOMKill(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		name    string
+		content string
+		count   uint64
+		fail    bool
+	}{
+		{
+			name:    "oom kill",
+			content: "oom_kill_disable 0\nunder_oom 0\noom_kill 3\n",
+			count:   3,
+		},
+		{
+			name:    "old kernel",
+			content: "oom_kill_disable 0\nunder_oom 0\n",
+			fail:    true,
+		},
+		{
+			name:    "bad counter",
+			content: "oom_kill x\n",
+			fail:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		count, err := parseOOMKill(strings.NewReader(tt.content))
+		if tt.fail && err == nil {
+			t.Errorf("%s: unexpected success", tt.name)
+		} else if !tt.fail && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if count != tt.count {
+			t.Errorf("%s: got %d instead of %d", tt.name, count, tt.count)
+		}
+	}
+}
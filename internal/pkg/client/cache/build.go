@@ -0,0 +1,51 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	// BuildDir is the directory inside cache.Dir() where root filesystems
+	// resulting from build sections are cached
+	BuildDir = "build"
+	// BuildSquashfsDir is the directory inside the build cache where
+	// squashfs images of sandboxes converted to SIF are cached
+	BuildSquashfsDir = "squashfs"
+)
+
+// Build returns the directory inside cache.Dir() where root filesystems
+// resulting from build sections are cached
+func Build() string {
+	return updateCacheSubdir(BuildDir)
+}
+
+// BuildSquashfs returns the directory inside the build cache where
+// squashfs images of sandboxes converted to SIF are cached
+func BuildSquashfs() string {
+	return updateCacheSubdir(filepath.Join(BuildDir, BuildSquashfsDir))
+}
+
+// BuildRootfs returns the path of the root filesystem archive cached
+// with the given key
+func BuildRootfs(key string) string {
+	return filepath.Join(Build(), key+".tar")
+}
+
+// BuildRootfsExists returns whether a root filesystem archive is cached
+// with the given key
+func BuildRootfsExists(key string) (bool, error) {
+	_, err := os.Stat(BuildRootfs(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		expected string
+	}{
+		{"Default Build", "", filepath.Join(cacheDefault, "build")},
+		{"Custom Build", cacheCustom, filepath.Join(cacheCustom, "build")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer Clean()
+			defer os.Unsetenv(DirEnv)
+
+			os.Setenv(DirEnv, tt.env)
+
+			if r := Build(); r != tt.expected {
+				t.Errorf("Unexpected result: %s (expected %s)", r, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildRootfsExists(t *testing.T) {
+	os.Setenv(DirEnv, cacheCustom)
+	defer os.Unsetenv(DirEnv)
+	defer Clean()
+
+	if exists, err := BuildRootfsExists("key"); err != nil || exists {
+		t.Errorf("Unexpected cached root filesystem: %v %v", exists, err)
+	}
+	if err := ioutil.WriteFile(BuildRootfs("key"), []byte("archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := BuildRootfsExists("key"); err != nil || !exists {
+		t.Errorf("Cached root filesystem not found: %v %v", exists, err)
+	}
+}
+
+func TestBuildSquashfs(t *testing.T) {
+	os.Setenv(DirEnv, cacheCustom)
+	defer os.Unsetenv(DirEnv)
+	defer Clean()
+
+	expected := filepath.Join(cacheCustom, "build", "squashfs")
+	if r := BuildSquashfs(); r != expected {
+		t.Errorf("Unexpected result: %s (expected %s)", r, expected)
+	}
+	if _, err := os.Stat(expected); err != nil {
+		t.Errorf("Squashfs cache directory not created: %s", err)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"path/filepath"
+)
+
+const (
+	// CondaDir is the directory inside cache.Dir() where conda packages
+	// and micromamba binaries used by conda bootstraps are cached
+	CondaDir = "conda"
+)
+
+// Conda returns the directory inside cache.Dir() where conda packages and
+// micromamba binaries used by conda bootstraps are cached
+func Conda() string {
+	return updateCacheSubdir(CondaDir)
+}
+
+// CondaPkgs returns the conda package cache shared by conda bootstraps
+func CondaPkgs() string {
+	return updateCacheSubdir(filepath.Join(CondaDir, "pkgs"))
+}
+
+// CondaMicromamba returns the path of the micromamba binary extracted
+// from the release archive with the sha256 checksum sum
+func CondaMicromamba(sum string) string {
+	return filepath.Join(Conda(), "micromamba-"+sum)
+}
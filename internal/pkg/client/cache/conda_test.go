@@ -0,0 +1,42 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConda(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		expected string
+	}{
+		{"Default Conda", "", filepath.Join(cacheDefault, "conda")},
+		{"Custom Conda", cacheCustom, filepath.Join(cacheCustom, "conda")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer Clean()
+			defer os.Unsetenv(DirEnv)
+
+			os.Setenv(DirEnv, tt.env)
+
+			if r := Conda(); r != tt.expected {
+				t.Errorf("Unexpected result: %s (expected %s)", r, tt.expected)
+			}
+			if r := CondaPkgs(); r != filepath.Join(tt.expected, "pkgs") {
+				t.Errorf("Unexpected package cache: %s", r)
+			}
+			if fi, err := os.Stat(CondaPkgs()); err != nil || !fi.IsDir() {
+				t.Errorf("Package cache directory not created: %v", err)
+			}
+		})
+	}
+}
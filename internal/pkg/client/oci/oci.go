@@ -20,20 +20,28 @@ import (
 	"github.com/containers/image/types"
 	"github.com/sylabs/singularity/internal/pkg/client/cache"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/platform"
 )
 
 // ImageReference wraps containers/image ImageReference type
 type ImageReference struct {
-	source types.ImageReference
+	digest string
+	retry  *retrier
 	types.ImageReference
 }
 
-// ConvertReference converts a source reference into a cache.ImageReference to cache its blobs
-func ConvertReference(src types.ImageReference, sys *types.SystemContext) (types.ImageReference, error) {
+// ConvertReference converts a source reference into a cache.ImageReference to cache its blobs,
+// the image matching platform p is selected when the source is a manifest list
+func ConvertReference(src types.ImageReference, sys *types.SystemContext, p platform.Platform, strict bool) (types.ImageReference, error) {
+	r := newRetrier(src, DefaultRetry())
+	if err := r.resolvePlatform(sys, p, strict); err != nil {
+		return nil, err
+	}
+
 	// Our cache dir is an OCI directory. We are using this as a 'blob pool'
 	// storing all incoming containers under unique tags, which are a hash of
 	// their source URI.
-	cacheTag, err := calculateRefHash(src, sys)
+	cacheTag, err := r.calculateRefHash(sys)
 	if err != nil {
 		return nil, err
 	}
@@ -44,12 +52,18 @@ func ConvertReference(src types.ImageReference, sys *types.SystemContext) (types
 	}
 
 	return &ImageReference{
-		source:         src,
+		digest:         cacheTag,
+		retry:          r,
 		ImageReference: c,
 	}, nil
 
 }
 
+// Digest returns the SHA256 sum of the source image manifest
+func (t *ImageReference) Digest() string {
+	return t.digest
+}
+
 // NewImageSource wraps the cache's oci-layout ref to first download the real source image to the cache
 func (t *ImageReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
 	return t.newImageSource(ctx, sys, sylog.Writer())
@@ -62,10 +76,13 @@ func (t *ImageReference) newImageSource(ctx context.Context, sys *types.SystemCo
 		return nil, err
 	}
 
-	// First we are fetching into the cache
-	err = copy.Image(context.Background(), policyCtx, t.ImageReference, t.source, &copy.Options{
-		ReportWriter: w,
-		SourceCtx:    sys,
+	// First we are fetching into the cache, from a mirror of the source
+	// if the source is rate limited
+	err = t.retry.do(sys, func(src types.ImageReference, sys *types.SystemContext) error {
+		return copy.Image(context.Background(), policyCtx, t.ImageReference, src, &copy.Options{
+			ReportWriter: w,
+			SourceCtx:    sys,
+		})
 	})
 	if err != nil {
 		return nil, err
@@ -81,7 +98,7 @@ func ParseImageName(uri string, sys *types.SystemContext) (types.ImageReference,
 		return nil, fmt.Errorf("Unable to parse image name %v: %v", uri, err)
 	}
 
-	return ConvertReference(ref, sys)
+	return ConvertReference(ref, sys, platform.Host(), false)
 }
 
 func parseURI(uri string) (types.ImageReference, error) {
@@ -102,7 +119,7 @@ func parseURI(uri string) (types.ImageReference, error) {
 
 // TempImageExists returns whether or not the uri exists splatted out in the cache.OciTemp() directory
 func TempImageExists(uri string) (bool, string, error) {
-	sum, err := ImageSHA(uri, nil)
+	sum, err := ImageSHA(uri, nil, platform.Host(), false)
 	if err != nil {
 		return false, "", err
 	}
@@ -116,14 +133,28 @@ func TempImageExists(uri string) (bool, string, error) {
 	return exists, cache.OciTempImage(sum, split[1]), err
 }
 
-// ImageSHA calculates the SHA of a uri's manifest
-func ImageSHA(uri string, sys *types.SystemContext) (string, error) {
+// ImageSHA calculates the SHA of a uri's manifest, or of the manifest of
+// the image matching platform p when uri is a manifest list
+func ImageSHA(uri string, sys *types.SystemContext, p platform.Platform, strict bool) (string, error) {
 	ref, err := parseURI(uri)
 	if err != nil {
 		return "", fmt.Errorf("Unable to parse image name %v: %v", uri, err)
 	}
 
-	return calculateRefHash(ref, sys)
+	r := newRetrier(ref, DefaultRetry())
+	if err := r.resolvePlatform(sys, p, strict); err != nil {
+		return "", err
+	}
+	return r.calculateRefHash(sys)
+}
+
+// calculateRefHash returns the SHA256 sum of the source manifest
+func (r *retrier) calculateRefHash(sys *types.SystemContext) (hash string, err error) {
+	err = r.do(sys, func(ref types.ImageReference, sys *types.SystemContext) error {
+		hash, err = calculateRefHash(ref, sys)
+		return err
+	})
+	return hash, err
 }
 
 func calculateRefHash(ref types.ImageReference, sys *types.SystemContext) (string, error) {
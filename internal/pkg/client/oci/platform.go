@@ -0,0 +1,109 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/containers/image/docker"
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/platform"
+)
+
+// resolvePlatform pins a reference to a manifest list to the image
+// matching the requested platform. Transports other than docker can't
+// reference an image by digest, the platform is selected through the
+// architecture and OS choices of sys instead.
+func (r *retrier) resolvePlatform(sys *types.SystemContext, want platform.Platform, strict bool) error {
+	var man []byte
+	var mime string
+
+	err := r.do(sys, func(ref types.ImageReference, sys *types.SystemContext) error {
+		src, err := ref.NewImageSource(context.TODO(), sys)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		man, mime, err = src.GetManifest(context.TODO(), nil)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	d, p, err := selectManifest(man, mime, want, strict)
+	if err != nil || d == "" {
+		return err
+	}
+	sylog.Verbosef("Selected %s image %s from manifest list", p, d)
+
+	if sys != nil {
+		sys.OSChoice = p.OS
+		sys.ArchitectureChoice = p.Architecture
+	}
+
+	src := r.sources[0]
+	if src.Transport().Name() != docker.Transport.Name() || src.DockerReference() == nil {
+		return nil
+	}
+	named, err := reference.WithDigest(reference.TrimNamed(src.DockerReference()), d)
+	if err != nil {
+		return err
+	}
+	ref, err := docker.NewReference(named)
+	if err != nil {
+		return err
+	}
+
+	authed := r.authed
+	*r = *newRetrier(ref, r.cfg)
+	r.authed = authed
+	return nil
+}
+
+// selectManifest returns the digest and the platform of the image
+// matching want in a manifest list or an OCI index, the digest is
+// empty for the manifest of a single image
+func selectManifest(man []byte, mime string, want platform.Platform, strict bool) (digest.Digest, platform.Platform, error) {
+	if mime == "" {
+		mime = manifest.GuessMIMEType(man)
+	}
+	if mime != manifest.DockerV2ListMediaType && mime != imgspecv1.MediaTypeImageIndex {
+		return "", platform.Platform{}, nil
+	}
+
+	// docker manifest lists and OCI indexes share the same layout
+	var index imgspecv1.Index
+	if err := json.Unmarshal(man, &index); err != nil {
+		return "", platform.Platform{}, fmt.Errorf("while parsing manifest list: %s", err)
+	}
+
+	var digests []digest.Digest
+	var available []platform.Platform
+	for _, m := range index.Manifests {
+		if m.Platform == nil {
+			continue
+		}
+		p := platform.Platform{OS: m.Platform.OS, Variant: m.Platform.Variant}
+		p.Architecture, _ = platform.NormalizeArch(m.Platform.Architecture)
+		digests = append(digests, m.Digest)
+		available = append(available, p)
+	}
+
+	i, err := platform.Select(available, want, strict)
+	if err != nil {
+		return "", platform.Platform{}, err
+	}
+	return digests[i], available[i], nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"testing"
+
+	"github.com/containers/image/manifest"
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/internal/pkg/util/platform"
+)
+
+const testManifestList = `{
+   "schemaVersion": 2,
+   "mediaType": "application/vnd.docker.distribution.manifest.list.v2+json",
+   "manifests": [
+      {
+         "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+         "size": 528,
+         "digest": "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+         "platform": {"architecture": "amd64", "os": "linux"}
+      },
+      {
+         "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+         "size": 528,
+         "digest": "sha256:2222222222222222222222222222222222222222222222222222222222222222",
+         "platform": {"architecture": "arm", "os": "linux", "variant": "v6"}
+      },
+      {
+         "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+         "size": 528,
+         "digest": "sha256:3333333333333333333333333333333333333333333333333333333333333333",
+         "platform": {"architecture": "arm64", "os": "linux", "variant": "v8"}
+      }
+   ]
+}`
+
+func TestSelectManifest(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		want     string
+		strict   bool
+		expected string
+		fail     bool
+	}{
+		{want: "linux/amd64", strict: true, expected: "sha256:1111111111111111111111111111111111111111111111111111111111111111"},
+		{want: "linux/aarch64", strict: true, expected: "sha256:3333333333333333333333333333333333333333333333333333333333333333"},
+		{want: "linux/arm/v7", strict: false, expected: "sha256:2222222222222222222222222222222222222222222222222222222222222222"},
+		{want: "linux/arm/v7", strict: true, fail: true},
+		{want: "linux/ppc64le", strict: false, fail: true},
+	}
+	for _, tt := range tests {
+		want, _ := platform.Parse(tt.want)
+		d, _, err := selectManifest([]byte(testManifestList), manifest.DockerV2ListMediaType, want, tt.strict)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("unexpected success for %s", tt.want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %s: %s", tt.want, err)
+		} else if d.String() != tt.expected {
+			t.Errorf("unexpected digest %s for %s, expected %s", d, tt.want, tt.expected)
+		}
+	}
+
+	// single images are left untouched
+	d, _, err := selectManifest([]byte(`{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.v2+json"}`), "", platform.Host(), true)
+	if d != "" || err != nil {
+		t.Errorf("unexpected selection %q for a single image: %v", d, err)
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/image/docker"
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/transports"
+	"github.com/containers/image/types"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+const (
+	// dockerHub is the domain of Docker Hub references, the only ones
+	// pulled from mirrors
+	dockerHub = "docker.io"
+	// dockerHubRegistry is the Docker Hub registry host
+	dockerHubRegistry = "registry-1.docker.io"
+
+	// retryBackoff is the wait after the first failed attempt, doubled
+	// after each attempt up to maxRetryBackoff
+	retryBackoff    = 5 * time.Second
+	maxRetryBackoff = 2 * time.Minute
+	// maxRetryAfter is the longest Retry-After delay waited for, pulls
+	// are aborted when the registry asks to wait longer
+	maxRetryAfter = 10 * time.Minute
+)
+
+var (
+	// statusPattern matches the HTTP status codes reported in the errors
+	// returned by the containers/image docker transport
+	statusPattern = regexp.MustCompile(`(?i)(?:HTTP status:|HTTP|fetching blob|response code|http code:)\s+(\d{3})\b`)
+	// challengeParam matches the parameters of a WWW-Authenticate challenge
+	challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+	// sleep is replaced by tests
+	sleep = time.Sleep
+)
+
+// Retry configures how requests to docker registries are retried when
+// rate limited or failing with server errors
+type Retry struct {
+	// Attempts is the number of times the registry and its mirrors are
+	// tried
+	Attempts int
+	// Mirrors are Docker Hub mirrors tried in turn after Docker Hub
+	Mirrors []string
+	// AnonymousFirst makes requests anonymous until they are rate
+	// limited or refused, docker credentials are used afterward
+	AnonymousFirst bool
+}
+
+var (
+	defaultRetry     Retry
+	defaultRetryOnce sync.Once
+)
+
+// DefaultRetry returns the retry configuration of singularity.conf
+func DefaultRetry() Retry {
+	defaultRetryOnce.Do(func() {
+		c := &singularityConfig.FileConfig{}
+		if err := config.Parser(buildcfg.SYSCONFDIR+"/singularity/singularity.conf", c); err != nil {
+			sylog.Debugf("Unable to parse singularity.conf file, using default docker pull settings: %s", err)
+			config.Parser("", c)
+		}
+		defaultRetry = Retry{
+			Attempts:       int(c.DockerPullAttempts),
+			Mirrors:        c.DockerMirrors,
+			AnonymousFirst: c.DockerAnonymousFirst,
+		}
+	})
+	return defaultRetry
+}
+
+// retrier runs operations against an image source, or its mirrors,
+// according to a Retry configuration. It remembers the source which
+// last succeeded and whether credentials had to be used, so following
+// operations on the same image start from there.
+type retrier struct {
+	cfg     Retry
+	sources []types.ImageReference
+	current int
+	authed  bool
+	status  int
+}
+
+func newRetrier(src types.ImageReference, cfg Retry) *retrier {
+	r := &retrier{
+		cfg:     cfg,
+		sources: []types.ImageReference{src},
+	}
+	if src.Transport().Name() != docker.Transport.Name() {
+		return r
+	}
+	if named := src.DockerReference(); named == nil || reference.Domain(named) != dockerHub {
+		return r
+	}
+	for _, m := range cfg.Mirrors {
+		ref, err := mirrorReference(src, m)
+		if err != nil {
+			sylog.Warningf("Ignoring docker mirror %s: %s", m, err)
+			continue
+		}
+		r.sources = append(r.sources, ref)
+	}
+	return r
+}
+
+// enabled returns if requests are retried, only docker registries are
+func (r *retrier) enabled() bool {
+	return r.sources[0].Transport().Name() == docker.Transport.Name()
+}
+
+// context returns the system context used for requests to the source i.
+// The docker credentials of sys are only sent to the registry they were
+// given for, never to its mirrors, and are dropped while requests are made
+// anonymously first.
+func (r *retrier) context(sys *types.SystemContext, i int) *types.SystemContext {
+	if sys == nil || sys.DockerAuthConfig == nil {
+		return sys
+	}
+	if i == 0 && (!r.cfg.AnonymousFirst || r.authed) {
+		return sys
+	}
+	anon := *sys
+	anon.DockerAuthConfig = nil
+	return &anon
+}
+
+// do runs op until it succeeds or fails with an error which isn't
+// caused by rate limiting or a server error. Each attempt tries the
+// registry and then its mirrors, waits between attempts honor the
+// Retry-After delay of rate limited requests.
+func (r *retrier) do(sys *types.SystemContext, op func(types.ImageReference, *types.SystemContext) error) error {
+	if !r.enabled() {
+		return op(r.sources[0], sys)
+	}
+
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		for n := 0; n < len(r.sources); n++ {
+			ref := r.sources[r.current]
+			ctx := r.context(sys, r.current)
+
+			if err = op(ref, ctx); err == nil {
+				if r.current != 0 {
+					sylog.Verbosef("Pulled from docker mirror %s", transports.ImageName(ref))
+				}
+				return nil
+			}
+			r.status = errorStatus(err)
+
+			if r.current == 0 && ctx != sys && (r.status == http.StatusTooManyRequests || r.status == http.StatusUnauthorized || r.status == http.StatusForbidden) {
+				sylog.Infof("Anonymous docker requests were refused, retrying with docker credentials")
+				r.authed = true
+				n--
+				continue
+			}
+			if !retryable(r.status) && r.current == 0 {
+				return err
+			}
+
+			sylog.Warningf("Pulling from %s failed: %s", transports.ImageName(ref), err)
+			if r.status == http.StatusTooManyRequests && r.current == 0 && len(r.sources) == 1 {
+				sylog.Warningf("Docker registry rate limit reached, configure a 'docker mirror' in singularity.conf or use --docker-login to raise the limit")
+			}
+			r.current = (r.current + 1) % len(r.sources)
+		}
+
+		if attempt >= r.cfg.Attempts {
+			return fmt.Errorf("giving up after %d attempt(s): %s", attempt, err)
+		}
+
+		delay := r.delay(attempt, sys)
+		if delay > maxRetryAfter {
+			return fmt.Errorf("docker registry rate limit reached, requests are refused for %s: %s", delay, err)
+		}
+		sylog.Infof("Retrying in %s (attempt %d of %d)", delay, attempt+1, r.cfg.Attempts)
+		sleep(delay)
+	}
+}
+
+// delay returns the wait before the next attempt, the Retry-After delay
+// of the registry when rate limited, or an exponential back-off
+func (r *retrier) delay(attempt int, sys *types.SystemContext) time.Duration {
+	if r.status == http.StatusTooManyRequests {
+		if d := retryAfter(r.sources[0], r.context(sys, 0)); d > 0 {
+			return d
+		}
+	}
+	d := retryBackoff << uint(attempt-1)
+	if d > maxRetryBackoff || d <= 0 {
+		d = maxRetryBackoff
+	}
+	return d
+}
+
+// errorStatus returns the HTTP status code reported by err, or 0
+func errorStatus(err error) int {
+	msg := err.Error()
+	if m := statusPattern.FindStringSubmatch(msg); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return code
+	}
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "toomanyrequests"), strings.Contains(lower, "too many requests"):
+		return http.StatusTooManyRequests
+	case strings.Contains(lower, "unavailable:"):
+		return http.StatusServiceUnavailable
+	case strings.Contains(lower, "unauthorized:"), strings.Contains(lower, "authentication required"):
+		return http.StatusUnauthorized
+	case strings.Contains(lower, "denied:"):
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+// retryable returns if requests failing with status are retried
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500 && status < 600
+}
+
+// mirrorReference returns the reference of the Docker Hub image src in
+// the mirror registry
+func mirrorReference(src types.ImageReference, mirror string) (types.ImageReference, error) {
+	host := mirror
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	host = strings.TrimRight(host, "/")
+	if host == "" || strings.Contains(host, "/") {
+		return nil, fmt.Errorf("mirror must be a registry host")
+	}
+
+	named := src.DockerReference()
+	name := host + "/" + reference.Path(named)
+	if d, ok := named.(reference.Digested); ok {
+		name += "@" + d.Digest().String()
+	} else if t, ok := named.(reference.Tagged); ok {
+		name += ":" + t.Tag()
+	}
+	return docker.ParseReference("//" + name)
+}
+
+// retryAfter returns the Retry-After delay of the registry for the
+// manifest of ref, or 0 if it can't be determined. It uses a HEAD
+// request, which doesn't count against Docker Hub pull limits.
+func retryAfter(ref types.ImageReference, sys *types.SystemContext) time.Duration {
+	named := ref.DockerReference()
+	if named == nil {
+		return 0
+	}
+	registry := reference.Domain(named)
+	if registry == dockerHub {
+		registry = dockerHubRegistry
+	}
+	tag := "latest"
+	if d, ok := named.(reference.Digested); ok {
+		tag = d.Digest().String()
+	} else if t, ok := named.(reference.Tagged); ok {
+		tag = t.Tag()
+	}
+	url := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, reference.Path(named), tag)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	if sys != nil && sys.DockerInsecureSkipTLSVerify {
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+
+	resp, err := headManifest(client, url, "")
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		var token string
+		if token, err = bearerToken(client, resp.Header.Get("WWW-Authenticate"), reference.Path(named), sys); err == nil {
+			resp, err = headManifest(client, url, token)
+		}
+	}
+	if err != nil {
+		sylog.Debugf("Could not get Retry-After delay of %s: %s", url, err)
+		return 0
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	return parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+}
+
+func headManifest(client *http.Client, url, token string) (*http.Response, error) {
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// bearerToken requests a pull token for repository from the realm of
+// the bearer challenge
+func bearerToken(client *http.Client, challenge, repository string, sys *types.SystemContext) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	params := make(map[string]string)
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+
+	req, err := http.NewRequest("GET", params["realm"], nil)
+	if err != nil {
+		return "", err
+	}
+	q := req.URL.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", fmt.Sprintf("repository:%s:pull", repository))
+	req.URL.RawQuery = q.Encode()
+	if sys != nil && sys.DockerAuthConfig != nil {
+		req.SetBasicAuth(sys.DockerAuthConfig.Username, sys.DockerAuthConfig.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed with status %s", resp.Status)
+	}
+
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", err
+	}
+	if t.Token != "" {
+		return t.Token, nil
+	}
+	return t.AccessToken, nil
+}
+
+// parseRetryAfter returns the delay of a Retry-After header value given
+// in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(value); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now).Round(time.Second)
+	}
+	return 0
+}
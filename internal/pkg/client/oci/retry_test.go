@@ -0,0 +1,195 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/containers/image/docker"
+	"github.com/containers/image/transports"
+	"github.com/containers/image/types"
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestErrorStatus(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		err    string
+		status int
+	}{
+		{"Error reading manifest latest in docker.io/library/alpine: toomanyrequests: You have reached your pull rate limit", 429},
+		{"Error reading manifest latest in docker.io/library/alpine: received unexpected HTTP status: 503 Service Unavailable", 503},
+		{"Invalid status code returned when fetching blob 502", 502},
+		{"pinging docker registry returned: error pinging registry quay.io, response code 500", 500},
+		{"unexpected http code: 429, URL: https://auth.docker.io/token", 429},
+		{"error parsing HTTP 429 response body: unexpected end of JSON input: \"\"", 429},
+		{"Error reading manifest 1.0 in docker.io/sylabs/private: errors:\ndenied: requested access to the resource is denied\nunauthorized: authentication required\n", 401},
+		{"Error reading manifest nope in docker.io/library/alpine: manifest unknown: manifest unknown", 0},
+	}
+	for _, tt := range tests {
+		if s := errorStatus(fmt.Errorf("%s", tt.err)); s != tt.status {
+			t.Errorf("unexpected status %d for %q, expected %d", s, tt.err, tt.status)
+		}
+	}
+}
+
+func TestMirrorReference(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		ref      string
+		mirror   string
+		expected string
+	}{
+		{"//alpine", "https://mirror.gcr.io", "docker://mirror.gcr.io/library/alpine:latest"},
+		{"//sylabs/test:1.0", "mirror.example.com:5000/", "docker://mirror.example.com:5000/sylabs/test:1.0"},
+		{"//alpine@sha256:769fddc7cc2f0a1c35abb2f91432e8beecf83916c421420e6a6da9f8975464b6", "mirror.gcr.io", "docker://mirror.gcr.io/library/alpine@sha256:769fddc7cc2f0a1c35abb2f91432e8beecf83916c421420e6a6da9f8975464b6"},
+	}
+	for _, tt := range tests {
+		src, err := docker.ParseReference(tt.ref)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", tt.ref, err)
+		}
+		ref, err := mirrorReference(src, tt.mirror)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %s", tt.ref, err)
+		} else if name := transports.ImageName(ref); name != tt.expected {
+			t.Errorf("unexpected mirror reference %s, expected %s", name, tt.expected)
+		}
+	}
+
+	src, _ := docker.ParseReference("//alpine")
+	if _, err := mirrorReference(src, "https://mirror.gcr.io/v2"); err == nil {
+		t.Errorf("unexpected success with a mirror path")
+	}
+
+	// only Docker Hub images are pulled from mirrors
+	src, _ = docker.ParseReference("//quay.io/sylabs/test")
+	if r := newRetrier(src, Retry{Mirrors: []string{"mirror.gcr.io"}}); len(r.sources) != 1 {
+		t.Errorf("unexpected mirrors for a quay.io image")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"Sat, 01 Jun 2019 12:00:30 GMT", 30 * time.Second},
+		{"Sat, 01 Jun 2019 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if d := parseRetryAfter(tt.value, now); d != tt.expected {
+			t.Errorf("unexpected delay %s for %q, expected %s", d, tt.value, tt.expected)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	var delays []time.Duration
+	sleep = func(d time.Duration) { delays = append(delays, d) }
+	defer func() { sleep = time.Sleep }()
+
+	src, _ := docker.ParseReference("//alpine")
+	unavailable := fmt.Errorf("received unexpected HTTP status: 503 Service Unavailable")
+
+	// the registry and its mirror are tried on each attempt, the mirror
+	// which succeeded is used first afterward
+	var pulled []string
+	r := newRetrier(src, Retry{Attempts: 3, Mirrors: []string{"mirror.gcr.io"}})
+	err := r.do(nil, func(ref types.ImageReference, sys *types.SystemContext) error {
+		pulled = append(pulled, transports.ImageName(ref))
+		if len(pulled) < 4 {
+			return unavailable
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pulled) != 4 || pulled[3] != "docker://mirror.gcr.io/library/alpine:latest" || len(delays) != 1 || delays[0] != retryBackoff {
+		t.Errorf("unexpected pulls %v with delays %v", pulled, delays)
+	}
+	pulled = nil
+	r.do(nil, func(ref types.ImageReference, sys *types.SystemContext) error {
+		pulled = append(pulled, transports.ImageName(ref))
+		return nil
+	})
+	if len(pulled) != 1 || pulled[0] != "docker://mirror.gcr.io/library/alpine:latest" {
+		t.Errorf("unexpected pulls %v after a mirror succeeded", pulled)
+	}
+
+	// attempts are limited and other errors aren't retried
+	delays = nil
+	calls := 0
+	r = newRetrier(src, Retry{Attempts: 2})
+	if err := r.do(nil, func(ref types.ImageReference, sys *types.SystemContext) error {
+		calls++
+		return unavailable
+	}); err == nil || calls != 2 || len(delays) != 1 {
+		t.Errorf("unexpected retries: %d calls, %v delays, error %v", calls, delays, err)
+	}
+	calls = 0
+	if err := r.do(nil, func(ref types.ImageReference, sys *types.SystemContext) error {
+		calls++
+		return fmt.Errorf("manifest unknown: manifest unknown")
+	}); err == nil || calls != 1 {
+		t.Errorf("unexpected retries of a not found error: %d calls", calls)
+	}
+
+	// credentials are used once anonymous requests are rate limited
+	sys := &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{Username: "user", Password: "pass"}}
+	var auths []bool
+	r = newRetrier(src, Retry{Attempts: 1, AnonymousFirst: true})
+	err = r.do(sys, func(ref types.ImageReference, sys *types.SystemContext) error {
+		auths = append(auths, sys.DockerAuthConfig != nil)
+		if sys.DockerAuthConfig == nil {
+			return fmt.Errorf("toomanyrequests: too many requests")
+		}
+		return nil
+	})
+	if err != nil || len(auths) != 2 || auths[0] || !auths[1] {
+		t.Errorf("unexpected authentications %v: %v", auths, err)
+	}
+
+	// credentials are never sent to mirrors
+	auths = nil
+	r = newRetrier(src, Retry{Attempts: 1, Mirrors: []string{"mirror.gcr.io"}})
+	err = r.do(sys, func(ref types.ImageReference, sys *types.SystemContext) error {
+		auths = append(auths, sys.DockerAuthConfig != nil)
+		if len(auths) == 1 {
+			return unavailable
+		}
+		return nil
+	})
+	if err != nil || len(auths) != 2 || !auths[0] || auths[1] {
+		t.Errorf("unexpected authentications with mirror %v: %v", auths, err)
+	}
+	auths = nil
+	r.do(sys, func(ref types.ImageReference, sys *types.SystemContext) error {
+		auths = append(auths, sys.DockerAuthConfig != nil)
+		return nil
+	})
+	if len(auths) != 1 || auths[0] {
+		t.Errorf("unexpected authentication %v after a mirror succeeded", auths)
+	}
+}
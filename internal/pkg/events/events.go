@@ -0,0 +1,167 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package events implements a per-user append-only journal of runtime
+// events like instances and OCI containers creation, start, stop, out of
+// memory kills and signals sent to them. The journal is a file of JSON
+// encoded events, one per line, stored in the user home directory and
+// suffixed with the hostname as home directories may be shared between
+// nodes.
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+)
+
+// Type is the type of an event
+type Type string
+
+// Event types
+const (
+	Create Type = "create"
+	Start  Type = "start"
+	Stop   Type = "stop"
+	OOM    Type = "oom"
+	Kill   Type = "kill"
+)
+
+// Kinds of containers reporting events
+const (
+	KindInstance = "instance"
+	KindOci      = "oci"
+)
+
+const journalDir = ".singularity/events"
+
+// pollInterval is the delay between two reads of the journal when
+// following it
+var pollInterval = 500 * time.Millisecond
+
+// Event is a runtime event recorded in the journal
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    Type      `json:"type"`
+	Kind    string    `json:"kind"`
+	ID      string    `json:"id"`
+	Pid     int       `json:"pid,omitempty"`
+	Image   string    `json:"image,omitempty"`
+	Details string    `json:"details,omitempty"`
+}
+
+// Path returns the journal path of user username on this host, the
+// current user journal is returned if username is empty
+func Path(username string) (string, error) {
+	var pw *user.User
+	var err error
+
+	if username == "" {
+		pw, err = user.GetPwUID(uint32(os.Getuid()))
+	} else {
+		pw, err = user.GetPwNam(username)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(pw.Dir, journalDir, hostname+".log"), nil
+}
+
+// Append appends event e to the journal at path
+func Append(path string, e *Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	// a single write keeps concurrent appends from interleaving
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Record appends event e to the current user journal, failures are
+// only reported as the journal must not prevent containers to run
+func Record(e *Event) {
+	path, err := Path("")
+	if err == nil {
+		err = Append(path, e)
+	}
+	if err != nil {
+		sylog.Warningf("could not record %s event for %s %s: %s", e.Type, e.Kind, e.ID, err)
+	}
+}
+
+// Read calls fn for each event of the journal at path that occurred
+// since the given time. When follow is true Read waits for new events
+// until fn returns an error, otherwise it returns once all recorded
+// events were read. Errors returned by fn are returned by Read.
+func Read(path string, since time.Time, follow bool, fn func(*Event) error) error {
+	f, err := os.Open(path)
+	for err != nil {
+		if !os.IsNotExist(err) || !follow {
+			return err
+		}
+		// wait for the first event
+		time.Sleep(pollInterval)
+		f, err = os.Open(path)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	var line []byte
+
+	for {
+		b, err := r.ReadBytes('\n')
+		line = append(line, b...)
+		if err == io.EOF {
+			if !follow {
+				return nil
+			}
+			// keep partially written line for the next read
+			time.Sleep(pollInterval)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		e := &Event{}
+		if err := json.Unmarshal(line, e); err != nil {
+			return fmt.Errorf("failed to decode event %q: %s", line, err)
+		}
+		line = line[:0]
+
+		if e.Time.Before(since) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+var errStop = errors.New("stop")
+
+func TestAppendRead(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tmpdir, err := ioutil.TempDir("", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	path := filepath.Join(tmpdir, "events", "host.log")
+	now := time.Now()
+
+	recorded := []*Event{
+		{Time: now.Add(-time.Hour), Type: Start, Kind: KindInstance, ID: "old", Pid: 42},
+		{Time: now, Type: Create, Kind: KindOci, ID: "oci1"},
+		{Type: OOM, Kind: KindInstance, ID: "mysql", Details: "killed"},
+	}
+	for _, e := range recorded {
+		if err := Append(path, e); err != nil {
+			t.Fatalf("unexpected error while appending event: %s", err)
+		}
+	}
+	if recorded[2].Time.IsZero() {
+		t.Errorf("event time not set")
+	}
+
+	var read []*Event
+	err = Read(path, now.Add(-time.Minute), false, func(e *Event) error {
+		read = append(read, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error while reading events: %s", err)
+	}
+	if len(read) != 2 {
+		t.Fatalf("unexpected number of events: %d", len(read))
+	}
+	if read[0].ID != "oci1" || read[1].ID != "mysql" || read[1].Type != OOM || read[1].Details != "killed" {
+		t.Errorf("unexpected events %+v %+v", read[0], read[1])
+	}
+
+	err = Read(path, time.Time{}, false, func(e *Event) error {
+		return errStop
+	})
+	if err != errStop {
+		t.Errorf("unexpected error returned: %v", err)
+	}
+
+	if err := Read(filepath.Join(tmpdir, "none"), time.Time{}, false, nil); !os.IsNotExist(err) {
+		t.Errorf("unexpected error for non existent journal: %v", err)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tmpdir, err := ioutil.TempDir("", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	pollInterval = 10 * time.Millisecond
+
+	path := filepath.Join(tmpdir, "host.log")
+	ids := make(chan string, 2)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- Read(path, time.Time{}, true, func(e *Event) error {
+			ids <- e.ID
+			if e.Type == Stop {
+				return errStop
+			}
+			return nil
+		})
+	}()
+
+	for _, e := range []*Event{{Type: Start, ID: "first"}, {Type: Stop, ID: "second"}} {
+		time.Sleep(50 * time.Millisecond)
+		if err := Append(path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case err := <-done:
+		if err != errStop {
+			t.Errorf("unexpected error returned: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout while following events")
+	}
+	if first, second := <-ids, <-ids; first != "first" || second != "second" {
+		t.Errorf("unexpected events %s and %s", first, second)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tmpdir, err := ioutil.TempDir("", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	received := make(chan *Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := &Event{}
+		json.NewDecoder(r.Body).Decode(e)
+		received <- e
+	}))
+	defer srv.Close()
+
+	os.Setenv("SINGULARITY_HOOK_TEST", "leaked")
+	defer os.Unsetenv("SINGULARITY_HOOK_TEST")
+
+	out := filepath.Join(tmpdir, "out")
+	env := filepath.Join(tmpdir, "env")
+	h := &Hooks{
+		URLs: []string{srv.URL},
+		Commands: []string{
+			"echo $SINGULARITY_EVENT $SINGULARITY_EVENT_ID > " + out + "; cat >> " + out,
+			"echo $(id -u) $SINGULARITY_HOOK_TEST > " + env,
+			"exit 1",
+		},
+	}
+	h.Fire(&Event{Type: Stop, Kind: KindInstance, ID: "web", Details: "exit code 0"})
+
+	select {
+	case e := <-received:
+		if e.Type != Stop || e.ID != "web" || e.Details != "exit code 0" || e.Time.IsZero() {
+			t.Errorf("unexpected event posted: %+v", e)
+		}
+	default:
+		t.Errorf("no event posted")
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("command not run: %s", err)
+	}
+	lines := strings.SplitN(string(b), "\n", 2)
+	e := &Event{}
+	if lines[0] != "stop web" || json.Unmarshal([]byte(lines[1]), e) != nil || e.ID != "web" {
+		t.Errorf("unexpected command output: %q", b)
+	}
+
+	b, err = ioutil.ReadFile(env)
+	if err != nil {
+		t.Fatalf("command not run: %s", err)
+	}
+	if expected := fmt.Sprintf("%d\n", os.Getuid()); string(b) != expected {
+		t.Errorf("unexpected command credentials or environment %q instead of %q", b, expected)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// hookPath is the PATH of hook commands, they don't inherit the
+// environment of the runtime
+const hookPath = "PATH=/usr/local/bin:/usr/bin:/bin:/usr/local/sbin:/usr/sbin:/sbin"
+
+// hookTimeout bounds the time spent to deliver an event to a hook
+var hookTimeout = 30 * time.Second
+
+// Hooks are notified of the events of a container
+type Hooks struct {
+	// URLs receive a POST request with the event in JSON format
+	URLs []string
+	// Commands are run by /bin/sh -c with the event in JSON format on
+	// their standard input, and its type and container ID in the
+	// SINGULARITY_EVENT and SINGULARITY_EVENT_ID environment variables
+	Commands []string
+}
+
+// Fire delivers event e to all hooks concurrently and waits for them,
+// failures are only reported
+func (h *Hooks) Fire(e *Event) {
+	if len(h.URLs) == 0 && len(h.Commands) == 0 {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		sylog.Warningf("could not encode %s event: %s", e.Type, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, url := range h.URLs {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			if err := post(ctx, url, b); err != nil {
+				sylog.Warningf("could not send %s event to %s: %s", e.Type, url, err)
+			}
+		}(url)
+	}
+	for _, command := range h.Commands {
+		wg.Add(1)
+		go func(command string) {
+			defer wg.Done()
+			if err := run(ctx, command, e, b); err != nil {
+				sylog.Warningf("%s event command %q failed: %s", e.Type, command, err)
+			}
+		}(command)
+	}
+	wg.Wait()
+}
+
+func post(ctx context.Context, url string, b []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	return nil
+}
+
+func run(ctx context.Context, command string, e *Event, b []byte) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Env = []string{hookPath, "SINGULARITY_EVENT=" + string(e.Type), "SINGULARITY_EVENT_ID=" + e.ID}
+	// hooks always run as the user, even when the runtime holds
+	// privileges in its saved set-user-ID
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid:         uint32(os.Getuid()),
+			Gid:         uint32(os.Getgid()),
+			NoSetGroups: true,
+		},
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
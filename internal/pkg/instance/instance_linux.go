@@ -8,6 +8,7 @@ package instance
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -35,6 +36,11 @@ const (
 	unprivPath      = ".singularity/instances"
 	authorizedChars = `^[a-zA-Z0-9._-]+$`
 	prognameFormat  = "Singularity instance: %s [%s]"
+	// annotationsFile is stored next to the instance file and owned by
+	// the instance user, so annotations are updated without privileges
+	annotationsFile = "annotations.json"
+	// maxAnnotationsSize bounds the size of the annotations file read
+	maxAnnotationsSize = 1 << 20
 )
 
 var nsMap = map[specs.LinuxNamespaceType]string{
@@ -57,6 +63,17 @@ type File struct {
 	Image      string `json:"image"`
 	Privileged bool   `json:"privileged"`
 	Config     []byte `json:"config"`
+	// Annotations stores arbitrary key/value pairs attached to
+	// the instance with the instance annotate command
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// StopSignal and StopTimeout store the signal sent to stop
+	// the instance and the grace period in seconds before it
+	// is killed with SIGKILL
+	StopSignal  string `json:"stopSignal,omitempty"`
+	StopTimeout int    `json:"stopTimeout,omitempty"`
+	// TmpPolicy stores policies applied to /tmp, /var/tmp and
+	// /dev/shm indexed by path
+	TmpPolicy map[string]string `json:"tmpPolicy,omitempty"`
 }
 
 // ProcName returns processus name based on instance name
@@ -214,6 +231,9 @@ func List(username string, name string, subDir string) ([]*File, error) {
 			if err := json.Unmarshal(b, f); err != nil {
 				return nil, err
 			}
+			if err := f.loadAnnotations(); err != nil {
+				sylog.Warningf("could not read instance %s annotations: %s", f.Name, err)
+			}
 			list = append(list, f)
 		}
 		privileged = !privileged
@@ -230,6 +250,116 @@ func (i *File) PrivilegedPath() bool {
 	return strings.HasPrefix(i.Path, privPath)
 }
 
+// SetAnnotation sets the annotation key to value, an empty value removes
+// the annotation. Changes are persisted only after a call to Update or
+// UpdateAnnotations
+func (i *File) SetAnnotation(key string, value string) error {
+	if key == "" {
+		return fmt.Errorf("empty annotation key")
+	}
+	if strings.ContainsAny(key, "= \t\n") {
+		return fmt.Errorf("annotation key %q contains invalid characters", key)
+	}
+	if value == "" {
+		delete(i.Annotations, key)
+		return nil
+	}
+	if i.Annotations == nil {
+		i.Annotations = make(map[string]string)
+	}
+	i.Annotations[key] = value
+	return nil
+}
+
+func (i *File) annotationsPath() string {
+	return filepath.Join(filepath.Dir(i.Path), annotationsFile)
+}
+
+// readAnnotations returns the annotations stored in r, nil if r is empty
+func readAnnotations(r io.Reader) (map[string]string, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxAnnotationsSize))
+	if err != nil || len(b) == 0 {
+		return nil, err
+	}
+	annotations := make(map[string]string)
+	if err := json.Unmarshal(b, &annotations); err != nil {
+		return nil, err
+	}
+	return annotations, nil
+}
+
+// loadAnnotations replaces annotations with the content of the
+// annotations file if any
+func (i *File) loadAnnotations() error {
+	f, err := os.OpenFile(i.annotationsPath(), os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	annotations, err := readAnnotations(f)
+	if err != nil {
+		return err
+	}
+	if annotations != nil {
+		i.Annotations = annotations
+	}
+	return nil
+}
+
+// UpdateAnnotations sets the annotations of set, empty values remove
+// them, and stores them in the annotations file. The file is locked
+// during the update so concurrent updates are not lost, and it's owned
+// by the instance user so it doesn't require privileges.
+func (i *File) UpdateAnnotations(set map[string]string) error {
+	f, err := os.OpenFile(i.annotationsPath(), os.O_RDWR|os.O_CREATE|syscall.O_NOFOLLOW, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("could not lock %s: %s", f.Name(), err)
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	annotations, err := readAnnotations(f)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %s", f.Name(), err)
+	}
+	if annotations != nil {
+		i.Annotations = annotations
+	}
+	for k, v := range set {
+		if err := i.SetAnnotation(k, v); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(i.Annotations)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(b, 0); err != nil {
+		return fmt.Errorf("failed to write %s: %s", f.Name(), err)
+	}
+	return f.Sync()
+}
+
+// SetTmpPolicy records the policy applied to a temporary directory path
+func (i *File) SetTmpPolicy(path string, policy string) {
+	if i.TmpPolicy == nil {
+		i.TmpPolicy = make(map[string]string)
+	}
+	i.TmpPolicy[path] = policy
+}
+
 // Delete deletes instance file
 func (i *File) Delete() error {
 	path := filepath.Dir(i.Path)
@@ -270,6 +400,18 @@ func (i *File) Update() error {
 		if err := os.Chown(path, int(pw.UID), 0); err != nil {
 			return err
 		}
+		// the annotations file is created for the user who can't
+		// write in the instance directory
+		a, err := os.OpenFile(i.annotationsPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY|syscall.O_NOFOLLOW, 0644)
+		if err == nil {
+			err = a.Chown(int(pw.UID), int(pw.GID))
+			a.Close()
+			if err != nil {
+				return err
+			}
+		} else if !os.IsExist(err) {
+			return err
+		}
 	}
 	file, err := os.OpenFile(i.Path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
@@ -12,6 +12,7 @@ import (
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
 )
 
 const testSubDir = "testing"
@@ -335,3 +336,90 @@ func TestGet(t *testing.T) {
 		}
 	}
 }
+
+func TestSetAnnotation(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	file := &File{}
+
+	if err := file.SetAnnotation("", "value"); err == nil {
+		t.Errorf("unexpected success with empty key")
+	}
+	if err := file.SetAnnotation("job id", "value"); err == nil {
+		t.Errorf("unexpected success with invalid key")
+	}
+	if err := file.SetAnnotation("jobid", "4242"); err != nil {
+		t.Errorf("unexpected failure while setting annotation: %s", err)
+	}
+	if file.Annotations["jobid"] != "4242" {
+		t.Errorf("unexpected annotation value %q", file.Annotations["jobid"])
+	}
+	if err := file.SetAnnotation("jobid", ""); err != nil {
+		t.Errorf("unexpected failure while removing annotation: %s", err)
+	}
+	if _, ok := file.Annotations["jobid"]; ok {
+		t.Errorf("annotation jobid not removed")
+	}
+}
+
+func TestUpdateAnnotations(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	test.DropPrivilege(t)
+	pw, err := user.GetPwUID(uint32(os.Getuid()))
+	test.ResetPrivilege(t)
+	if err != nil {
+		t.Fatalf("failed to retrieve user information: %s", err)
+	}
+
+	// privileged instance files of the user are written by root in a
+	// directory the user can't write to
+	path, err := getPath(true, pw.Name, testSubDir)
+	if err != nil {
+		t.Fatalf("unexpected failure while getting instance path: %s", err)
+	}
+	file := &File{
+		Path:       filepath.Join(path, "annotated_instance", "annotated_instance.json"),
+		Name:       "annotated_instance",
+		User:       pw.Name,
+		Pid:        os.Getpid(),
+		Privileged: true,
+	}
+	if err := file.Update(); err != nil {
+		t.Fatalf("unexpected failure while creating instance: %s", err)
+	}
+	defer file.Delete()
+
+	test.DropPrivilege(t)
+
+	file, err = Get("annotated_instance", testSubDir)
+	if err != nil {
+		t.Fatalf("unexpected failure while getting instance: %s", err)
+	}
+	if err := file.UpdateAnnotations(map[string]string{"jobid": "4242", "owner": "scheduler"}); err != nil {
+		t.Errorf("unexpected failure while annotating privileged instance: %s", err)
+	}
+	if err := file.UpdateAnnotations(map[string]string{"owner": ""}); err != nil {
+		t.Errorf("unexpected failure while removing annotation: %s", err)
+	}
+	if err := file.UpdateAnnotations(map[string]string{"job id": "4242"}); err == nil {
+		t.Errorf("unexpected success with invalid key")
+	}
+
+	// the instance file itself can't be updated by the user
+	if err := file.Update(); err == nil {
+		t.Errorf("unexpected success while updating privileged instance file")
+	}
+
+	test.ResetPrivilege(t)
+
+	files, err := List(pw.Name, "annotated_instance", testSubDir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("unexpected failure while listing instance: %v", err)
+	}
+	file = files[0]
+	if len(file.Annotations) != 1 || file.Annotations["jobid"] != "4242" {
+		t.Errorf("unexpected annotations %v", file.Annotations)
+	}
+}
@@ -139,6 +139,26 @@ func (l *Logger) scan(stream string, pr *io.PipeReader, pw *io.PipeWriter, dropC
 	pw.Close()
 }
 
+// WriteLines writes each line of data for corresponding stream, unlike
+// NewWriter lines are written before returning.
+func (l *Logger) WriteLines(stream string, data []byte) {
+	l.fileMutex.Lock()
+	defer l.fileMutex.Unlock()
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fmt.Fprint(l.file, l.formatter(stream, scanner.Text()))
+	}
+}
+
+// Close closes the log file.
+func (l *Logger) Close() error {
+	l.fileMutex.Lock()
+	defer l.fileMutex.Unlock()
+
+	return l.file.Close()
+}
+
 // ReOpenFile closes and re-open log file (eg: log rotation).
 func (l *Logger) ReOpenFile() {
 	l.fileMutex.Lock()
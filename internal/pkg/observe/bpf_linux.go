@@ -0,0 +1,359 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package observe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// bpf(2) commands
+const (
+	bpfMapCreate     = 0
+	bpfMapLookupElem = 1
+	bpfMapUpdateElem = 2
+	bpfMapGetNextKey = 4
+	bpfProgLoad      = 5
+)
+
+const (
+	bpfMapTypeHash        = 1
+	bpfProgTypeTracepoint = 5
+
+	// bpfNoExist only creates map elements which don't exist
+	bpfNoExist = 1
+
+	// perfFlagFdCloexec is the PERF_FLAG_FD_CLOEXEC flag of
+	// perf_event_open(2)
+	perfFlagFdCloexec = 8
+)
+
+// instruction classes, sizes, modes and operations
+const (
+	bpfLd    = 0x00
+	bpfLdx   = 0x01
+	bpfSt    = 0x02
+	bpfStx   = 0x03
+	bpfJmp   = 0x05
+	bpfAlu64 = 0x07
+
+	bpfW  = 0x00
+	bpfDW = 0x18
+
+	bpfImm  = 0x00
+	bpfMem  = 0x60
+	bpfXadd = 0xc0
+
+	bpfK = 0x00
+	bpfX = 0x08
+
+	bpfAdd  = 0x00
+	bpfRsh  = 0x70
+	bpfMov  = 0xb0
+	bpfJa   = 0x00
+	bpfJeq  = 0x10
+	bpfJgt  = 0x20
+	bpfJle  = 0xb0
+	bpfJsle = 0xd0
+	bpfJne  = 0x50
+	bpfCall = 0x80
+	bpfExit = 0x90
+
+	// bpfPseudoMapFd marks 64 bits immediate loads of map file descriptors
+	bpfPseudoMapFd = 1
+)
+
+// helper functions
+const (
+	fnMapLookupElem     = 1
+	fnMapUpdateElem     = 2
+	fnMapDeleteElem     = 3
+	fnGetCurrentPidTgid = 14
+	fnProbeReadUser     = 112
+	fnProbeReadUserStr  = 114
+)
+
+// registers
+const (
+	r0 = iota
+	r1
+	r2
+	r3
+	r4
+	r5
+	r6
+	r7
+	r8
+	r9
+	r10
+)
+
+// nativeEndian is the byte order of map keys and values
+var nativeEndian = func() binary.ByteOrder {
+	v := uint16(1)
+	if (*[2]byte)(unsafe.Pointer(&v))[0] == 0 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}()
+
+// insn is an eBPF instruction
+type insn struct {
+	code uint8
+	regs uint8
+	off  int16
+	imm  int32
+}
+
+// asm assembles an eBPF program, jumps refer to labels resolved by
+// assemble
+type asm struct {
+	insns  []insn
+	labels map[string]int
+	jumps  map[int]string
+}
+
+func newAsm() *asm {
+	return &asm{labels: make(map[string]int), jumps: make(map[int]string)}
+}
+
+func (a *asm) emit(code uint8, dst, src int, off int16, imm int32) {
+	// register nibbles follow the bit field order of the host
+	regs := uint8(src<<4 | dst)
+	if nativeEndian == binary.BigEndian {
+		regs = uint8(dst<<4 | src)
+	}
+	a.insns = append(a.insns, insn{code: code, regs: regs, off: off, imm: imm})
+}
+
+func (a *asm) movImm(dst int, imm int32) { a.emit(bpfAlu64|bpfMov|bpfK, dst, 0, 0, imm) }
+func (a *asm) movReg(dst, src int)       { a.emit(bpfAlu64|bpfMov|bpfX, dst, src, 0, 0) }
+func (a *asm) addImm(dst int, imm int32) { a.emit(bpfAlu64|bpfAdd|bpfK, dst, 0, 0, imm) }
+func (a *asm) rshImm(dst int, imm int32) { a.emit(bpfAlu64|bpfRsh|bpfK, dst, 0, 0, imm) }
+func (a *asm) call(fn int32)             { a.emit(bpfJmp|bpfCall, 0, 0, 0, fn) }
+func (a *asm) exit()                     { a.emit(bpfJmp|bpfExit, 0, 0, 0, 0) }
+
+// ldx loads the 32 or 64 bits value at src+off in dst
+func (a *asm) ldx(size uint8, dst, src int, off int16) {
+	a.emit(bpfLdx|bpfMem|size, dst, src, off, 0)
+}
+
+// stx stores the 32 or 64 bits value of src at dst+off
+func (a *asm) stx(size uint8, dst int, off int16, src int) {
+	a.emit(bpfStx|bpfMem|size, dst, src, off, 0)
+}
+
+// st stores imm as a 32 or 64 bits value at dst+off
+func (a *asm) st(size uint8, dst int, off int16, imm int32) {
+	a.emit(bpfSt|bpfMem|size, dst, 0, off, imm)
+}
+
+// xadd atomically adds src to the 64 bits value at dst+off
+func (a *asm) xadd(dst int, off int16, src int) {
+	a.emit(bpfStx|bpfXadd|bpfDW, dst, src, off, 0)
+}
+
+// ldMap loads the map file descriptor fd in dst
+func (a *asm) ldMap(dst int, fd int) {
+	a.emit(bpfLd|bpfImm|bpfDW, dst, bpfPseudoMapFd, 0, int32(fd))
+	a.emit(0, 0, 0, 0, 0)
+}
+
+// jmpImm jumps to label when the comparison op of dst with imm is true,
+// op 0 is an unconditional jump
+func (a *asm) jmpImm(op uint8, dst int, imm int32, label string) {
+	a.jumps[len(a.insns)] = label
+	a.emit(bpfJmp|op|bpfK, dst, 0, 0, imm)
+}
+
+func (a *asm) label(name string) {
+	a.labels[name] = len(a.insns)
+}
+
+// zero sets size bytes of stack at r10+off to zero, size is a multiple
+// of 8
+func (a *asm) zero(off int16, size int) {
+	for i := 0; i < size; i += 8 {
+		a.st(bpfDW, r10, off+int16(i), 0)
+	}
+}
+
+func (a *asm) assemble() ([]insn, error) {
+	for i, label := range a.jumps {
+		target, ok := a.labels[label]
+		if !ok {
+			return nil, fmt.Errorf("undefined label %s", label)
+		}
+		a.insns[i].off = int16(target - i - 1)
+	}
+	return a.insns, nil
+}
+
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	r, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(r), nil
+}
+
+// bpfMap is an eBPF hash map
+type bpfMap struct {
+	fd        int
+	keySize   int
+	valueSize int
+}
+
+func newHashMap(keySize, valueSize, maxEntries int) (*bpfMap, error) {
+	attr := struct {
+		mapType    uint32
+		keySize    uint32
+		valueSize  uint32
+		maxEntries uint32
+		mapFlags   uint32
+	}{bpfMapTypeHash, uint32(keySize), uint32(valueSize), uint32(maxEntries), 0}
+
+	fd, err := bpf(bpfMapCreate, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		return nil, fmt.Errorf("could not create eBPF map: %s", err)
+	}
+	return &bpfMap{fd: fd, keySize: keySize, valueSize: valueSize}, nil
+}
+
+type mapElemAttr struct {
+	mapFd uint32
+	_     uint32
+	key   uint64
+	value uint64
+	flags uint64
+}
+
+func (m *bpfMap) lookup(key, value []byte) error {
+	attr := mapElemAttr{
+		mapFd: uint32(m.fd),
+		key:   uint64(uintptr(unsafe.Pointer(&key[0]))),
+		value: uint64(uintptr(unsafe.Pointer(&value[0]))),
+	}
+	_, err := bpf(bpfMapLookupElem, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	return err
+}
+
+func (m *bpfMap) update(key, value []byte) error {
+	attr := mapElemAttr{
+		mapFd: uint32(m.fd),
+		key:   uint64(uintptr(unsafe.Pointer(&key[0]))),
+		value: uint64(uintptr(unsafe.Pointer(&value[0]))),
+	}
+	_, err := bpf(bpfMapUpdateElem, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	return err
+}
+
+// iterate calls fn with each key and value of the map
+func (m *bpfMap) iterate(fn func(key, value []byte)) error {
+	var prev []byte
+	for {
+		next := make([]byte, m.keySize)
+		attr := mapElemAttr{
+			mapFd: uint32(m.fd),
+			value: uint64(uintptr(unsafe.Pointer(&next[0]))),
+		}
+		if prev != nil {
+			attr.key = uint64(uintptr(unsafe.Pointer(&prev[0])))
+		}
+		if _, err := bpf(bpfMapGetNextKey, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err == unix.ENOENT {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		value := make([]byte, m.valueSize)
+		// the element may be deleted in the meantime
+		if err := m.lookup(next, value); err == nil {
+			fn(next, value)
+		} else if err != unix.ENOENT {
+			return err
+		}
+		prev = next
+	}
+}
+
+func (m *bpfMap) close() {
+	unix.Close(m.fd)
+}
+
+// loadProgram loads a tracepoint program, the verifier log is returned
+// with the error when it's rejected
+func loadProgram(insns []insn) (int, error) {
+	fd, err := load(insns, nil)
+	if err == nil {
+		return fd, nil
+	}
+	// load again to get the verifier log
+	log := make([]byte, 256*1024)
+	if _, err := load(insns, log); err != nil {
+		if msg := strings.TrimRight(string(log), "\x00\n"); msg != "" {
+			return -1, fmt.Errorf("could not load eBPF program: %s: %s", err, msg)
+		}
+	}
+	return -1, fmt.Errorf("could not load eBPF program: %s", err)
+}
+
+func load(insns []insn, log []byte) (int, error) {
+	license := []byte("GPL\x00")
+
+	attr := struct {
+		progType    uint32
+		insnCnt     uint32
+		insns       uint64
+		license     uint64
+		logLevel    uint32
+		logSize     uint32
+		logBuf      uint64
+		kernVersion uint32
+		_           uint32
+	}{
+		progType: bpfProgTypeTracepoint,
+		insnCnt:  uint32(len(insns)),
+		insns:    uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+	}
+	if log != nil {
+		attr.logLevel = 1
+		attr.logSize = uint32(len(log))
+		attr.logBuf = uint64(uintptr(unsafe.Pointer(&log[0])))
+	}
+	return bpf(bpfProgLoad, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+}
+
+// attachTracepoint runs the program prog on each hit of the tracepoint
+// identified by id, the returned perf event must stay open
+func attachTracepoint(id uint64, prog int) (int, error) {
+	attr := unix.PerfEventAttr{
+		Type:   unix.PERF_TYPE_TRACEPOINT,
+		Config: id,
+		Sample: 1,
+		Wakeup: 1,
+	}
+	attr.Size = uint32(unsafe.Sizeof(attr))
+
+	fd, err := unix.PerfEventOpen(&attr, -1, 0, -1, perfFlagFdCloexec)
+	if err != nil {
+		return -1, fmt.Errorf("could not open tracepoint perf event: %s", err)
+	}
+	if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_SET_BPF, prog); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("could not attach eBPF program: %s", err)
+	}
+	if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_ENABLE, 0); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("could not enable tracepoint: %s", err)
+	}
+	return fd, nil
+}
@@ -0,0 +1,364 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package observe
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// sizes of the observer maps
+const (
+	maxPids        = 32768
+	maxSyscalls    = 1024
+	maxFiles       = 8192
+	maxConnections = 4096
+)
+
+const (
+	// pathSize is the size of file paths recorded, longer paths are
+	// truncated
+	pathSize = 256
+	// sockaddrSize is the size of socket addresses recorded, enough
+	// for sockaddr_un
+	sockaddrSize = 112
+)
+
+// stack offsets of the program variables
+const (
+	valueOff    = -8
+	tgidOff     = -4
+	pidOff      = -8
+	pidValueOff = -12
+	syscallOff  = -16
+	pathOff     = valueOff - pathSize
+	sockaddrOff = valueOff - sockaddrSize
+)
+
+// openTracepoints are the open syscall tracepoints with the name of their
+// path argument, tracepoints not provided by the kernel are skipped
+var openTracepoints = []struct {
+	name  string
+	field string
+}{
+	{"sys_enter_open", "filename"},
+	{"sys_enter_creat", "pathname"},
+	{"sys_enter_openat", "filename"},
+	{"sys_enter_openat2", "filename"},
+}
+
+// Observer counts the system calls, file opens and connections of a
+// process tree with eBPF programs attached to kernel tracepoints
+type Observer struct {
+	pids        *bpfMap
+	syscalls    *bpfMap
+	files       *bpfMap
+	connections *bpfMap
+	fds         []int
+}
+
+// Start observes the process pid and its descendants, processes are
+// tracked from their creation so pid must be observed before it starts
+// other processes. It requires the CAP_BPF and CAP_PERFMON capabilities
+// or CAP_SYS_ADMIN.
+func Start(pid int) (*Observer, error) {
+	root, umount, err := mountTracefs()
+	if err != nil {
+		return nil, err
+	}
+	defer umount()
+
+	o := &Observer{}
+	if err := o.start(root, pid); err != nil {
+		o.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *Observer) start(root string, pid int) error {
+	var err error
+
+	if o.pids, err = newHashMap(4, 4, maxPids); err != nil {
+		return err
+	}
+	if o.syscalls, err = newHashMap(4, 8, maxSyscalls); err != nil {
+		return err
+	}
+	if o.files, err = newHashMap(pathSize, 8, maxFiles); err != nil {
+		return err
+	}
+	if o.connections, err = newHashMap(sockaddrSize, 8, maxConnections); err != nil {
+		return err
+	}
+
+	// follow the process tree before adding its root
+	if err := o.attach(root, "sched", "sched_process_fork", o.forkProgram); err != nil {
+		return err
+	}
+	if err := o.attach(root, "sched", "sched_process_exit", o.exitProgram); err != nil {
+		return err
+	}
+	key := make([]byte, 4)
+	value := make([]byte, 4)
+	nativeEndian.PutUint32(key, uint32(pid))
+	nativeEndian.PutUint32(value, 1)
+	if err := o.pids.update(key, value); err != nil {
+		return fmt.Errorf("could not observe process %d: %s", pid, err)
+	}
+
+	if err := o.attach(root, "raw_syscalls", "sys_enter", o.syscallProgram); err != nil {
+		return err
+	}
+	for _, t := range openTracepoints {
+		field := t.field
+		err := o.attach(root, "syscalls", t.name, func(tp *tracepoint) (*asm, error) {
+			return o.openProgram(tp, field)
+		})
+		if err != nil {
+			sylog.Debugf("Not observing %s: %s", t.name, err)
+		}
+	}
+	return o.attach(root, "syscalls", "sys_enter_connect", o.connectProgram)
+}
+
+// attach loads the program returned by build for the tracepoint
+// category:name and attaches it
+func (o *Observer) attach(root, category, name string, build func(*tracepoint) (*asm, error)) error {
+	tp, err := readTracepoint(root, category, name)
+	if err != nil {
+		return err
+	}
+	a, err := build(tp)
+	if err != nil {
+		return fmt.Errorf("tracepoint %s:%s: %s", category, name, err)
+	}
+	insns, err := a.assemble()
+	if err != nil {
+		return err
+	}
+
+	prog, err := loadProgram(insns)
+	if err != nil {
+		return fmt.Errorf("tracepoint %s:%s: %s", category, name, err)
+	}
+	o.fds = append(o.fds, prog)
+
+	event, err := attachTracepoint(tp.id, prog)
+	if err != nil {
+		return fmt.Errorf("tracepoint %s:%s: %s", category, name, err)
+	}
+	o.fds = append(o.fds, event)
+	return nil
+}
+
+// tracked jumps to out when the current process isn't observed, the
+// program context is saved in r6
+func (o *Observer) tracked(a *asm) {
+	a.movReg(r6, r1)
+	a.call(fnGetCurrentPidTgid)
+	a.rshImm(r0, 32)
+	a.stx(bpfW, r10, tgidOff, r0)
+	a.ldMap(r1, o.pids.fd)
+	a.movReg(r2, r10)
+	a.addImm(r2, tgidOff)
+	a.call(fnMapLookupElem)
+	a.jmpImm(bpfJeq, r0, 0, "out")
+}
+
+// count increments the counter of the key at the stack offset off in m
+// and returns
+func count(a *asm, m *bpfMap, off int16) {
+	a.ldMap(r1, m.fd)
+	a.movReg(r2, r10)
+	a.addImm(r2, int32(off))
+	a.call(fnMapLookupElem)
+	a.jmpImm(bpfJeq, r0, 0, "insert")
+	a.movImm(r1, 1)
+	a.xadd(r0, 0, r1)
+	a.jmpImm(bpfJa, r0, 0, "out")
+
+	a.label("insert")
+	a.st(bpfDW, r10, valueOff, 1)
+	a.ldMap(r1, m.fd)
+	a.movReg(r2, r10)
+	a.addImm(r2, int32(off))
+	a.movReg(r3, r10)
+	a.addImm(r3, valueOff)
+	a.movImm(r4, bpfNoExist)
+	a.call(fnMapUpdateElem)
+
+	ret(a)
+}
+
+// ret returns 0 from the out label
+func ret(a *asm) {
+	a.label("out")
+	a.movImm(r0, 0)
+	a.exit()
+}
+
+// forkProgram adds processes and threads created by observed processes
+func (o *Observer) forkProgram(tp *tracepoint) (*asm, error) {
+	childPid, err := tp.field("child_pid")
+	if err != nil {
+		return nil, err
+	}
+	a := newAsm()
+	o.tracked(a)
+	a.ldx(bpfW, r1, r6, childPid)
+	a.stx(bpfW, r10, pidOff, r1)
+	a.st(bpfW, r10, pidValueOff, 1)
+	a.ldMap(r1, o.pids.fd)
+	a.movReg(r2, r10)
+	a.addImm(r2, pidOff)
+	a.movReg(r3, r10)
+	a.addImm(r3, pidValueOff)
+	a.movImm(r4, 0)
+	a.call(fnMapUpdateElem)
+	ret(a)
+	return a, nil
+}
+
+// exitProgram removes exiting threads so their identifier can't be
+// reused by processes outside of the container
+func (o *Observer) exitProgram(tp *tracepoint) (*asm, error) {
+	a := newAsm()
+	a.call(fnGetCurrentPidTgid)
+	a.stx(bpfW, r10, pidOff, r0)
+	a.ldMap(r1, o.pids.fd)
+	a.movReg(r2, r10)
+	a.addImm(r2, pidOff)
+	a.call(fnMapDeleteElem)
+	ret(a)
+	return a, nil
+}
+
+// syscallProgram counts system calls by number
+func (o *Observer) syscallProgram(tp *tracepoint) (*asm, error) {
+	id, err := tp.field("id")
+	if err != nil {
+		return nil, err
+	}
+	a := newAsm()
+	o.tracked(a)
+	a.ldx(bpfDW, r1, r6, id)
+	a.stx(bpfW, r10, syscallOff, r1)
+	count(a, o.syscalls, syscallOff)
+	return a, nil
+}
+
+// openProgram counts opened paths, read from the field argument
+func (o *Observer) openProgram(tp *tracepoint, field string) (*asm, error) {
+	filename, err := tp.field(field)
+	if err != nil {
+		return nil, err
+	}
+	a := newAsm()
+	o.tracked(a)
+	a.zero(pathOff, pathSize)
+	a.movReg(r1, r10)
+	a.addImm(r1, pathOff)
+	a.movImm(r2, pathSize)
+	a.ldx(bpfDW, r3, r6, filename)
+	a.call(fnProbeReadUserStr)
+	a.jmpImm(bpfJsle, r0, 0, "out")
+	count(a, o.files, pathOff)
+	return a, nil
+}
+
+// connectProgram counts connection addresses
+func (o *Observer) connectProgram(tp *tracepoint) (*asm, error) {
+	addr, err := tp.field("uservaddr")
+	if err != nil {
+		return nil, err
+	}
+	addrlen, err := tp.field("addrlen")
+	if err != nil {
+		return nil, err
+	}
+	a := newAsm()
+	o.tracked(a)
+	a.zero(sockaddrOff, sockaddrSize)
+	// read at most sockaddrSize bytes
+	a.ldx(bpfDW, r2, r6, addrlen)
+	a.jmpImm(bpfJle, r2, sockaddrSize, "sized")
+	a.movImm(r2, sockaddrSize)
+	a.label("sized")
+	a.movReg(r1, r10)
+	a.addImm(r1, sockaddrOff)
+	a.ldx(bpfDW, r3, r6, addr)
+	a.call(fnProbeReadUser)
+	a.jmpImm(bpfJne, r0, 0, "out")
+	count(a, o.connections, sockaddrOff)
+	return a, nil
+}
+
+// Report returns the activity observed so far
+func (o *Observer) Report() (*Report, error) {
+	r := newReport()
+
+	order := nativeEndian
+	n := 0
+	err := o.syscalls.iterate(func(key, value []byte) {
+		nr := int(order.Uint32(key))
+		name := seccomp.SyscallName(nr)
+		if name == "" {
+			name = fmt.Sprintf("syscall %d", nr)
+		}
+		r.add(&r.Syscalls, name, order.Uint64(value))
+		n++
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read system calls: %s", err)
+	}
+	r.Truncated = r.Truncated || n >= maxSyscalls
+
+	n = 0
+	err = o.files.iterate(func(key, value []byte) {
+		if i := bytes.IndexByte(key, 0); i >= 0 {
+			key = key[:i]
+		}
+		r.add(&r.Files, string(key), order.Uint64(value))
+		n++
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read opened files: %s", err)
+	}
+	r.Truncated = r.Truncated || n >= maxFiles
+
+	n = 0
+	err = o.connections.iterate(func(key, value []byte) {
+		if addr := sockaddrString(key, order); addr != "" {
+			r.add(&r.Connections, addr, order.Uint64(value))
+		}
+		n++
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read connections: %s", err)
+	}
+	r.Truncated = r.Truncated || n >= maxConnections
+
+	r.sort()
+	return r, nil
+}
+
+// Close detaches the programs and releases the observer resources
+func (o *Observer) Close() {
+	for i := len(o.fds) - 1; i >= 0; i-- {
+		unix.Close(o.fds[i])
+	}
+	o.fds = nil
+	for _, m := range []*bpfMap{o.pids, o.syscalls, o.files, o.connections} {
+		if m != nil {
+			m.close()
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package observe
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"golang.org/x/sys/unix"
+)
+
+// TestVerifier loads the generated programs through the kernel verifier
+// with tracepoint record layouts of x86_64 kernels
+func TestVerifier(t *testing.T) {
+	test.EnsurePrivilege(t)
+
+	o := &Observer{}
+	defer o.Close()
+
+	var err error
+	if o.pids, err = newHashMap(4, 4, maxPids); err != nil {
+		t.Skipf("eBPF maps not supported: %s", err)
+	}
+	if o.syscalls, err = newHashMap(4, 8, maxSyscalls); err != nil {
+		t.Fatal(err)
+	}
+	if o.files, err = newHashMap(pathSize, 8, maxFiles); err != nil {
+		t.Fatal(err)
+	}
+	if o.connections, err = newHashMap(sockaddrSize, 8, maxConnections); err != nil {
+		t.Fatal(err)
+	}
+
+	connect, err := parseFormat(strings.NewReader(connectFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	connect["addrlen"] = 32
+
+	tests := []struct {
+		name   string
+		fields map[string]int16
+		build  func(*tracepoint) (*asm, error)
+	}{
+		{"fork", map[string]int16{"child_pid": 44}, o.forkProgram},
+		{"exit", map[string]int16{}, o.exitProgram},
+		{"syscall", map[string]int16{"id": 8}, o.syscallProgram},
+		{"openat", map[string]int16{"filename": 24}, func(tp *tracepoint) (*asm, error) {
+			return o.openProgram(tp, "filename")
+		}},
+		{"connect", connect, o.connectProgram},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := tt.build(&tracepoint{fields: tt.fields})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			insns, err := a.assemble()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			fd, err := loadProgram(insns)
+			if err != nil {
+				t.Fatalf("program rejected: %s", err)
+			}
+			unix.Close(fd)
+		})
+	}
+}
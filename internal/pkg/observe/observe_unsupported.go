@@ -0,0 +1,28 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package observe
+
+import (
+	"fmt"
+)
+
+// Observer is not supported on this platform
+type Observer struct{}
+
+// Start returns an error on unsupported platforms
+func Start(pid int) (*Observer, error) {
+	return nil, fmt.Errorf("observing processes is not supported by OS")
+}
+
+// Report returns an error on unsupported platforms
+func (o *Observer) Report() (*Report, error) {
+	return nil, fmt.Errorf("observing processes is not supported by OS")
+}
+
+// Close does nothing on unsupported platforms
+func (o *Observer) Close() {}
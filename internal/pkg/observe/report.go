@@ -0,0 +1,167 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package observe summarizes the system calls, file opens and network
+// connections of container processes with eBPF programs attached to
+// kernel tracepoints.
+package observe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// address families decoded in connection reports
+const (
+	afUnix  = 1
+	afInet  = 2
+	afInet6 = 10
+)
+
+// Count is the number of times a system call, a file or an address was
+// used
+type Count struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// Report summarizes the activity of the observed processes, counts are
+// sorted in decreasing order
+type Report struct {
+	Syscalls    []Count `json:"syscalls"`
+	Files       []Count `json:"files"`
+	Connections []Count `json:"connections"`
+	// Truncated is set when the activity exceeded the observer tables,
+	// new system calls, files or addresses were then not recorded
+	Truncated bool `json:"truncated,omitempty"`
+
+	index map[*[]Count]map[string]int
+}
+
+func newReport() *Report {
+	return &Report{
+		Syscalls:    []Count{},
+		Files:       []Count{},
+		Connections: []Count{},
+		index:       make(map[*[]Count]map[string]int),
+	}
+}
+
+// add adds n to the count of name in counts
+func (r *Report) add(counts *[]Count, name string, n uint64) {
+	index, ok := r.index[counts]
+	if !ok {
+		index = make(map[string]int)
+		r.index[counts] = index
+	}
+	if i, ok := index[name]; ok {
+		(*counts)[i].Count += n
+		return
+	}
+	index[name] = len(*counts)
+	*counts = append(*counts, Count{Name: name, Count: n})
+}
+
+func (r *Report) sort() {
+	for _, counts := range [][]Count{r.Syscalls, r.Files, r.Connections} {
+		c := counts
+		sort.Slice(c, func(i, j int) bool {
+			if c[i].Count != c[j].Count {
+				return c[i].Count > c[j].Count
+			}
+			return c[i].Name < c[j].Name
+		})
+	}
+	r.index = nil
+}
+
+// WriteSummary writes the report in a readable format to w, only the
+// limit most used system calls, files and addresses are listed when
+// limit is positive
+func (r *Report) WriteSummary(w io.Writer, limit int) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	sections := []struct {
+		title  string
+		counts []Count
+	}{
+		{"System calls", r.Syscalls},
+		{"Opened files", r.Files},
+		{"Connections", r.Connections},
+	}
+	for i, s := range sections {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%s (%d):\n", s.title, len(s.counts))
+		for j, c := range s.counts {
+			if limit > 0 && j == limit {
+				fmt.Fprintf(tw, "  ...\t%d more\n", len(s.counts)-limit)
+				break
+			}
+			fmt.Fprintf(tw, "  %d\t%s\n", c.Count, c.Name)
+		}
+	}
+	if r.Truncated {
+		fmt.Fprintf(tw, "\nObserver tables were full, some activity wasn't recorded\n")
+	}
+	return tw.Flush()
+}
+
+// sockaddrString returns the address of a socket address structure with
+// its family in byte order, an empty string is returned for AF_UNSPEC
+// used to dissolve associations
+func sockaddrString(b []byte, order binary.ByteOrder) string {
+	if len(b) < 2 {
+		return ""
+	}
+	family := order.Uint16(b)
+
+	switch family {
+	case 0:
+		return ""
+	case afUnix:
+		path := b[2:]
+		if len(path) > 0 && path[0] == 0 {
+			// abstract socket
+			path = path[1:]
+			if i := indexZero(path); i >= 0 {
+				path = path[:i]
+			}
+			return "unix:@" + string(path)
+		}
+		if i := indexZero(path); i >= 0 {
+			path = path[:i]
+		}
+		return "unix:" + string(path)
+	case afInet:
+		if len(b) < 8 {
+			break
+		}
+		port := binary.BigEndian.Uint16(b[2:])
+		return net.JoinHostPort(net.IP(b[4:8]).String(), strconv.Itoa(int(port)))
+	case afInet6:
+		if len(b) < 24 {
+			break
+		}
+		port := binary.BigEndian.Uint16(b[2:])
+		return net.JoinHostPort(net.IP(b[8:24]).String(), strconv.Itoa(int(port)))
+	}
+	return fmt.Sprintf("address family %d", family)
+}
+
+func indexZero(b []byte) int {
+	for i, c := range b {
+		if c == 0 {
+			return i
+		}
+	}
+	return -1
+}
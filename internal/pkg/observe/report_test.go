@@ -0,0 +1,85 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package observe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestSockaddrString(t *testing.T) {
+	inet := make([]byte, sockaddrSize)
+	binary.LittleEndian.PutUint16(inet, afInet)
+	copy(inet[2:], []byte{0x01, 0xbb, 10, 0, 0, 1})
+
+	inet6 := make([]byte, sockaddrSize)
+	binary.LittleEndian.PutUint16(inet6, afInet6)
+	copy(inet6[2:], []byte{0, 53})
+	inet6[23] = 1
+
+	unix := make([]byte, sockaddrSize)
+	binary.LittleEndian.PutUint16(unix, afUnix)
+	copy(unix[2:], "/run/dbus/system_bus_socket")
+
+	abstract := make([]byte, sockaddrSize)
+	binary.LittleEndian.PutUint16(abstract, afUnix)
+	copy(abstract[3:], "/tmp/.X11-unix/X0")
+
+	netlink := make([]byte, sockaddrSize)
+	binary.LittleEndian.PutUint16(netlink, 16)
+
+	tests := []struct {
+		addr []byte
+		str  string
+	}{
+		{inet, "10.0.0.1:443"},
+		{inet6, "[::1]:53"},
+		{unix, "unix:/run/dbus/system_bus_socket"},
+		{abstract, "unix:@/tmp/.X11-unix/X0"},
+		{netlink, "address family 16"},
+		{make([]byte, sockaddrSize), ""},
+	}
+	for _, tt := range tests {
+		if s := sockaddrString(tt.addr, binary.LittleEndian); s != tt.str {
+			t.Errorf("unexpected address %q instead of %q", s, tt.str)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	r := newReport()
+	r.add(&r.Syscalls, "read", 3)
+	r.add(&r.Syscalls, "write", 5)
+	r.add(&r.Syscalls, "close", 3)
+	r.add(&r.Connections, "10.0.0.1:443", 1)
+	// partially read addresses decode to the same string
+	r.add(&r.Connections, "10.0.0.1:443", 2)
+	r.sort()
+
+	expected := []Count{{"write", 5}, {"close", 3}, {"read", 3}}
+	for i, c := range r.Syscalls {
+		if c != expected[i] {
+			t.Errorf("unexpected system call count %v instead of %v", c, expected[i])
+		}
+	}
+	if len(r.Connections) != 1 || r.Connections[0].Count != 3 {
+		t.Errorf("unexpected connections %v", r.Connections)
+	}
+
+	var b bytes.Buffer
+	if err := r.WriteSummary(&b, 2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// columns are aligned with spaces
+	summary := strings.Join(strings.Fields(b.String()), " ")
+	for _, s := range []string{"System calls (3): 5 write 3 close ... 1 more", "Opened files (0):", "Connections (1): 3 10.0.0.1:443"} {
+		if !strings.Contains(summary, s) {
+			t.Errorf("%q not found in summary:\n%s", s, b.String())
+		}
+	}
+}
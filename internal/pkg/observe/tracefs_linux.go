@@ -0,0 +1,164 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package observe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"golang.org/x/sys/unix"
+)
+
+// tracefsBaseDir is the root owned directory holding tracefs mount points
+var tracefsBaseDir = filepath.Join(buildcfg.RUNSTATEDIR, "singularity", "tracefs")
+
+// tracepoint is a kernel tracepoint with the offsets of its record fields
+type tracepoint struct {
+	id     uint64
+	fields map[string]int16
+}
+
+// field returns the offset of the record field name
+func (t *tracepoint) field(name string) (int16, error) {
+	off, ok := t.fields[name]
+	if !ok {
+		return 0, fmt.Errorf("tracepoint has no %s field", name)
+	}
+	return off, nil
+}
+
+// mountTracefs returns the directory where tracefs is mounted, it's
+// mounted in a temporary directory of tracefsBaseDir when not found, the
+// returned function unmounts it.
+func mountTracefs() (string, func(), error) {
+	if f, err := os.Open("/proc/self/mountinfo"); err == nil {
+		point := tracefsMount(f)
+		f.Close()
+		if point != "" {
+			return point, func() {}, nil
+		}
+	}
+
+	if err := os.MkdirAll(tracefsBaseDir, 0700); err != nil {
+		return "", nil, err
+	}
+	// the mount point must not be reachable by users
+	fi, err := os.Lstat(tracefsBaseDir)
+	if err != nil {
+		return "", nil, err
+	}
+	if st := fi.Sys().(*syscall.Stat_t); !fi.IsDir() || st.Uid != 0 || fi.Mode().Perm()&0022 != 0 {
+		return "", nil, fmt.Errorf("%s must be a directory owned by root and writable only by root", tracefsBaseDir)
+	}
+
+	dir, err := ioutil.TempDir(tracefsBaseDir, "tracefs-")
+	if err != nil {
+		return "", nil, err
+	}
+	if err := unix.Mount("tracefs", dir, "tracefs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		os.Remove(dir)
+		return "", nil, fmt.Errorf("could not mount tracefs: %s", err)
+	}
+	return dir, func() {
+		unix.Unmount(dir, unix.MNT_DETACH)
+		os.Remove(dir)
+	}, nil
+}
+
+// tracefsMount returns the first tracefs mount point of a mountinfo file
+func tracefsMount(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// the filesystem type follows the optional fields separator
+		fields := strings.Fields(scanner.Text())
+		for i := 6; i < len(fields)-1; i++ {
+			if fields[i] == "-" {
+				if fields[i+1] == "tracefs" {
+					return fields[4]
+				}
+				break
+			}
+		}
+	}
+	return ""
+}
+
+// readTracepoint reads the identifier and format of the tracepoint
+// category:name of the tracefs mounted at root
+func readTracepoint(root, category, name string) (*tracepoint, error) {
+	dir := filepath.Join(root, "events", category, name)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "id"))
+	if err != nil {
+		return nil, fmt.Errorf("tracepoint %s:%s not available: %s", category, name, err)
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad tracepoint %s:%s identifier: %s", category, name, err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "format"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fields, err := parseFormat(f)
+	if err != nil {
+		return nil, fmt.Errorf("bad tracepoint %s:%s format: %s", category, name, err)
+	}
+	return &tracepoint{id: id, fields: fields}, nil
+}
+
+// parseFormat returns the record field offsets of a tracepoint format
+// file, where fields are described by lines like
+// field:int fd;	offset:16;	size:8;	signed:0;
+func parseFormat(r io.Reader) (map[string]int16, error) {
+	fields := make(map[string]int16)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "field:") {
+			continue
+		}
+		name := ""
+		offset := -1
+		for _, attr := range strings.Split(line, ";") {
+			attr = strings.TrimSpace(attr)
+			switch {
+			case strings.HasPrefix(attr, "field:"):
+				decl := strings.Fields(strings.TrimPrefix(attr, "field:"))
+				if len(decl) == 0 {
+					return nil, fmt.Errorf("bad field %q", line)
+				}
+				name = decl[len(decl)-1]
+				if i := strings.Index(name, "["); i >= 0 {
+					name = name[:i]
+				}
+			case strings.HasPrefix(attr, "offset:"):
+				n, err := strconv.ParseInt(strings.TrimPrefix(attr, "offset:"), 10, 16)
+				if err != nil {
+					return nil, fmt.Errorf("bad field %q", line)
+				}
+				offset = int(n)
+			}
+		}
+		if name == "" || offset < 0 {
+			return nil, fmt.Errorf("bad field %q", line)
+		}
+		fields[name] = int16(offset)
+	}
+	return fields, scanner.Err()
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package observe
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const connectFormat = `name: sys_enter_connect
+ID: 2130
+format:
+	field:unsigned short common_type;	offset:0;	size:2;	signed:0;
+	field:unsigned char common_flags;	offset:2;	size:1;	signed:0;
+	field:unsigned char common_preempt_count;	offset:3;	size:1;	signed:0;
+	field:int common_pid;	offset:4;	size:4;	signed:1;
+
+	field:int __syscall_nr;	offset:8;	size:4;	signed:1;
+	field:int fd;	offset:16;	size:8;	signed:0;
+	field:struct sockaddr * uservaddr;	offset:24;	size:8;	signed:0;
+	field:unsigned long args[6];	offset:32;	size:48;	signed:0;
+
+print fmt: "fd: 0x%08lx", ((unsigned long)(REC->fd))
+`
+
+func TestParseFormat(t *testing.T) {
+	fields, err := parseFormat(strings.NewReader(connectFormat))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]int16{
+		"common_type":          0,
+		"common_flags":         2,
+		"common_preempt_count": 3,
+		"common_pid":           4,
+		"__syscall_nr":         8,
+		"fd":                   16,
+		"uservaddr":            24,
+		"args":                 32,
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("unexpected fields %v", fields)
+	}
+
+	if _, err := parseFormat(strings.NewReader("\tfield:int fd;\toffset:x;\n")); err == nil {
+		t.Errorf("unexpected success with bad offset")
+	}
+}
+
+func TestTracefsMount(t *testing.T) {
+	mountinfo := `22 1 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw
+38 21 0:12 / /sys/kernel/tracing rw,nosuid,nodev,noexec,relatime shared:19 - tracefs tracefs rw
+`
+	if point := tracefsMount(strings.NewReader(mountinfo)); point != "/sys/kernel/tracing" {
+		t.Errorf("unexpected tracefs mount point %q", point)
+	}
+	if point := tracefsMount(strings.NewReader("22 1 0:21 / /proc rw - proc proc rw\n")); point != "" {
+		t.Errorf("unexpected tracefs mount point %q", point)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"fmt"
+
+	pluginapi "github.com/sylabs/singularity/pkg/plugin"
+)
+
+type optimizeRegistry struct {
+	OptimizePasses []pluginapi.OptimizePassHook
+}
+
+// RegisterOptimizePass adds an optimization pass, pass names must be
+// unique
+func (r *optimizeRegistry) RegisterOptimizePass(p pluginapi.OptimizePassHook) error {
+	if p.Name == "" {
+		return fmt.Errorf("optimization pass has no name")
+	}
+	if p.Run == nil {
+		return fmt.Errorf("optimization pass %s has no run function", p.Name)
+	}
+	for _, o := range r.OptimizePasses {
+		if o.Name == p.Name {
+			return fmt.Errorf("optimization pass %s already registered", p.Name)
+		}
+	}
+	r.OptimizePasses = append(r.OptimizePasses, p)
+	return nil
+}
+
+// OptimizePasses returns the optimization passes registered by plugins
+func OptimizePasses() []pluginapi.OptimizePassHook {
+	assertInitialized()
+
+	return reg.OptimizePasses
+}
@@ -9,6 +9,9 @@ import "github.com/spf13/pflag"
 
 type registry struct {
 	*flagRegistry
+	*scratchRegistry
+	*stageRegistry
+	*optimizeRegistry
 }
 
 var reg registry
@@ -19,5 +22,8 @@ func init() {
 			FlagSet: pflag.NewFlagSet("flagRegistrySet", pflag.ExitOnError),
 			Hooks:   []flagHook{},
 		},
+		scratchRegistry:  &scratchRegistry{},
+		stageRegistry:    &stageRegistry{},
+		optimizeRegistry: &optimizeRegistry{},
 	}
 }
@@ -0,0 +1,37 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"fmt"
+
+	pluginapi "github.com/sylabs/singularity/pkg/plugin"
+)
+
+type scratchRegistry struct {
+	Provider *pluginapi.ScratchProviderHook
+}
+
+// RegisterScratchProvider sets the scratch provider, only one provider
+// can be registered
+func (r *scratchRegistry) RegisterScratchProvider(p pluginapi.ScratchProviderHook) error {
+	if r.Provider != nil {
+		return fmt.Errorf("scratch provider %s already registered", r.Provider.Name)
+	}
+	if p.Allocate == nil {
+		return fmt.Errorf("scratch provider %s has no allocate function", p.Name)
+	}
+	r.Provider = &p
+	return nil
+}
+
+// ScratchProvider returns the scratch provider registered by a plugin
+// or nil if there is none
+func ScratchProvider() *pluginapi.ScratchProviderHook {
+	assertInitialized()
+
+	return reg.Provider
+}
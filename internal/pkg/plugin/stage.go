@@ -0,0 +1,37 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"fmt"
+
+	pluginapi "github.com/sylabs/singularity/pkg/plugin"
+)
+
+type stageRegistry struct {
+	StageProvider *pluginapi.StageProviderHook
+}
+
+// RegisterStageProvider sets the stage provider, only one provider can
+// be registered
+func (r *stageRegistry) RegisterStageProvider(p pluginapi.StageProviderHook) error {
+	if r.StageProvider != nil {
+		return fmt.Errorf("stage provider %s already registered", r.StageProvider.Name)
+	}
+	if p.Allocate == nil {
+		return fmt.Errorf("stage provider %s has no allocate function", p.Name)
+	}
+	r.StageProvider = &p
+	return nil
+}
+
+// StageProvider returns the stage provider registered by a plugin or
+// nil if there is none
+func StageProvider() *pluginapi.StageProviderHook {
+	assertInitialized()
+
+	return reg.StageProvider
+}
@@ -0,0 +1,280 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package pool implements a deduplicated storage pool for SIF images.
+// Images are split into segments, one per data object plus the regions
+// holding the header, descriptors and alignment padding, and each
+// distinct segment is stored once in a content addressed blob directory.
+// An index records the segments composing each image so it can be
+// reassembled byte for byte.
+package pool
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/util/fs/lock"
+)
+
+const indexFile = "index.json"
+
+// Segment is a contiguous region of an image stored as a blob
+type Segment struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+// Image describes an image stored in the pool
+type Image struct {
+	Name     string    `json:"name"`
+	Digest   string    `json:"digest"`
+	Size     int64     `json:"size"`
+	Imported time.Time `json:"imported"`
+	Segments []Segment `json:"segments"`
+}
+
+// Index lists images stored in the pool
+type Index struct {
+	Images map[string]*Image `json:"images"`
+}
+
+// Pool is a deduplicated storage pool rooted at a directory
+type Pool struct {
+	root string
+}
+
+// New returns the pool rooted at directory root, the directory is
+// created if it doesn't exist
+func New(root string) (*Pool, error) {
+	if err := os.MkdirAll(filepath.Join(root, "blobs", "sha256"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create pool directory %s: %s", root, err)
+	}
+	return &Pool{root: root}, nil
+}
+
+// blobPath returns the path of the blob with the given digest
+func (p *Pool) blobPath(digest string) string {
+	return filepath.Join(p.root, "blobs", "sha256", digest)
+}
+
+// segments returns the segments covering the whole SIF image, data
+// objects get their own segment so identical partitions of distinct
+// images end up in the same blob
+func segments(fimg *sif.FileImage, size int64) []Segment {
+	var objects []Segment
+
+	for _, d := range fimg.DescrArr {
+		if !d.Used || d.Filelen == 0 {
+			continue
+		}
+		objects = append(objects, Segment{Offset: d.Fileoff, Size: d.Filelen})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Offset < objects[j].Offset })
+
+	var segs []Segment
+	var off int64
+
+	for _, o := range objects {
+		if o.Offset < off {
+			// overlapping objects are kept in the previous segment
+			continue
+		}
+		if o.Offset > off {
+			segs = append(segs, Segment{Offset: off, Size: o.Offset - off})
+		}
+		segs = append(segs, o)
+		off = o.Offset + o.Size
+	}
+	if off < size {
+		segs = append(segs, Segment{Offset: off, Size: size - off})
+	}
+	return segs
+}
+
+// storeSegment stores the image segment as a blob if not already
+// present, it returns the number of bytes added to the pool
+func (p *Pool) storeSegment(f *os.File, s *Segment, whole io.Writer) (int64, error) {
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h, whole), io.NewSectionReader(f, s.Offset, s.Size)); err != nil {
+		return 0, err
+	}
+	s.Digest = hex.EncodeToString(h.Sum(nil))
+
+	path := p.blobPath(s.Digest)
+	if _, err := os.Stat(path); err == nil {
+		return 0, nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".blob-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := fs.CopyRange(tmp, 0, f, s.Offset, s.Size); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Chmod(0444); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return s.Size, os.Rename(tmp.Name(), path)
+}
+
+// Import stores the SIF image at path in the pool under name, it
+// returns the image and the number of bytes added to the pool
+func (p *Pool) Import(name, path string) (*Image, int64, error) {
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load SIF image %s: %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	fi, err := fimg.Fp.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	f, ok := fimg.Fp.(*os.File)
+	if !ok {
+		return nil, 0, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	fd, err := lock.Exclusive(p.root)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to lock pool: %s", err)
+	}
+	defer lock.Release(fd)
+
+	index, err := p.readIndex()
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, ok := index.Images[name]; ok {
+		return nil, 0, fmt.Errorf("image %s already exists in pool", name)
+	}
+
+	img := &Image{
+		Name:     name,
+		Size:     fi.Size(),
+		Imported: time.Now(),
+		Segments: segments(&fimg, fi.Size()),
+	}
+
+	var added int64
+
+	whole := sha256.New()
+	for i := range img.Segments {
+		n, err := p.storeSegment(f, &img.Segments[i], whole)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to store segment at offset %d: %s", img.Segments[i].Offset, err)
+		}
+		added += n
+	}
+	img.Digest = hex.EncodeToString(whole.Sum(nil))
+
+	index.Images[name] = img
+	if err := p.writeIndex(index); err != nil {
+		return nil, 0, err
+	}
+	return img, added, nil
+}
+
+// Export reassembles the image stored under name at path
+func (p *Pool) Export(name, path string) error {
+	img, err := p.Get(name)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, ".export-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, s := range img.Segments {
+		blob, err := os.Open(p.blobPath(s.Digest))
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("missing blob %s: %s", s.Digest, err)
+		}
+		err = fs.CopyRange(tmp, s.Offset, blob, 0, s.Size)
+		blob.Close()
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write segment at offset %d: %s", s.Offset, err)
+		}
+	}
+	if err := tmp.Chmod(0755); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get returns the image stored under name
+func (p *Pool) Get(name string) (*Image, error) {
+	index, err := p.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	img, ok := index.Images[name]
+	if !ok {
+		return nil, fmt.Errorf("no image %s in pool", name)
+	}
+	return img, nil
+}
+
+// readIndex reads the pool index, an empty index is returned if the
+// pool doesn't contain any image yet
+func (p *Pool) readIndex() (*Index, error) {
+	index := &Index{Images: make(map[string]*Image)}
+
+	b, err := ioutil.ReadFile(filepath.Join(p.root, indexFile))
+	if os.IsNotExist(err) {
+		return index, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read pool index: %s", err)
+	}
+	if err := json.Unmarshal(b, index); err != nil {
+		return nil, fmt.Errorf("failed to decode pool index: %s", err)
+	}
+	if index.Images == nil {
+		index.Images = make(map[string]*Image)
+	}
+	return index, nil
+}
+
+// writeIndex atomically replaces the pool index
+func (p *Pool) writeIndex(index *Index) error {
+	b, err := json.MarshalIndent(index, "", "\t")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(p.root, indexFile)
+	if err := ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return fmt.Errorf("failed to write pool index: %s", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pool
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+// createSIF creates a SIF image at path with a data object per element
+// of objects
+func createSIF(t *testing.T, path string, objects ...[]byte) {
+	cinfo := sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+	}
+	for _, data := range objects {
+		cinfo.InputDescr = append(cinfo.InputDescr, sif.DescriptorInput{
+			Datatype: sif.DataGeneric,
+			Groupid:  sif.DescrDefaultGroup,
+			Link:     sif.DescrUnusedLink,
+			Size:     int64(len(data)),
+			Fname:    "data",
+			Fp:       bytes.NewReader(data),
+		})
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatalf("failed to create %s: %s", path, err)
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "pool-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	shared := bytes.Repeat([]byte("shared partition"), 4096)
+
+	first := filepath.Join(dir, "first.sif")
+	second := filepath.Join(dir, "second.sif")
+	createSIF(t, first, shared, []byte("first"))
+	createSIF(t, second, shared, []byte("second"))
+
+	p, err := New(filepath.Join(dir, "pool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := p.Import("first", first); err != nil {
+		t.Fatalf("unexpected import error: %s", err)
+	}
+	img, added, err := p.Import("second", second)
+	if err != nil {
+		t.Fatalf("unexpected import error: %s", err)
+	}
+	if added > img.Size-int64(len(shared)) {
+		t.Errorf("shared partition stored twice: %d bytes added for a %d bytes image", added, img.Size)
+	}
+	if _, _, err := p.Import("second", second); err == nil {
+		t.Errorf("unexpected success while importing an existing image")
+	}
+
+	for name, path := range map[string]string{"first": first, "second": second} {
+		out := filepath.Join(dir, name+".out")
+		if err := p.Export(name, out); err != nil {
+			t.Fatalf("unexpected export error: %s", err)
+		}
+		orig, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exported, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(orig, exported) {
+			t.Errorf("exported image %s differs from the imported one", name)
+		}
+	}
+
+	if err := p.Export("missing", filepath.Join(dir, "missing.sif")); err == nil {
+		t.Errorf("unexpected success while exporting a missing image")
+	}
+}
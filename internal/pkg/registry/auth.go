@@ -0,0 +1,99 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package registry
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// shaPrefix marks the SHA-1 passwords of htpasswd -s
+const shaPrefix = "{SHA}"
+
+// bcryptPrefixes mark the bcrypt passwords of htpasswd -B
+var bcryptPrefixes = []string{"$2a$", "$2b$", "$2y$"}
+
+func isBcrypt(password string) bool {
+	for _, p := range bcryptPrefixes {
+		if strings.HasPrefix(password, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Users maps user names to their password, as stored in an htpasswd file
+type Users map[string]string
+
+// ReadUsers parses the user:password lines of an htpasswd file. Passwords
+// are bcrypt hashes created with htpasswd -B, SHA-1 hashes created with
+// htpasswd -s, or plain text with htpasswd -p, other hash formats aren't
+// supported.
+func ReadUsers(r io.Reader) (Users, error) {
+	users := make(Users)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("line %d: expected user:password", n)
+		}
+		if strings.HasPrefix(fields[1], "$") && !isBcrypt(fields[1]) {
+			return nil, fmt.Errorf("line %d: unsupported password hash for %s, use htpasswd -B", n, fields[0])
+		}
+		users[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("no user found")
+	}
+	return users, nil
+}
+
+// ReadUsersFile parses the htpasswd file path
+func ReadUsersFile(path string) (Users, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users, err := ReadUsers(f)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing %s: %s", path, err)
+	}
+	return users, nil
+}
+
+// Authenticate returns if password is the password of user
+func (u Users) Authenticate(user, password string) bool {
+	stored, ok := u[user]
+	if !ok {
+		return false
+	}
+	if isBcrypt(stored) {
+		hash, err := cryptHash(password, stored)
+		if err != nil {
+			return false
+		}
+		password = hash
+	} else if strings.HasPrefix(stored, shaPrefix) {
+		sum := sha1.Sum([]byte(password))
+		password = shaPrefix + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package registry
+
+/*
+#include <stdlib.h>
+#include <crypt.h>
+*/
+// #cgo LDFLAGS: -lcrypt
+import "C"
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// cryptHash returns the crypt(3) hash of password with the algorithm and
+// salt of setting, a previously computed hash
+func cryptHash(password, setting string) (string, error) {
+	data := (*C.struct_crypt_data)(C.calloc(1, C.sizeof_struct_crypt_data))
+	if data == nil {
+		return "", fmt.Errorf("could not allocate crypt data")
+	}
+	defer C.free(unsafe.Pointer(data))
+
+	cPassword := C.CString(password)
+	defer C.free(unsafe.Pointer(cPassword))
+	cSetting := C.CString(setting)
+	defer C.free(unsafe.Pointer(cSetting))
+
+	hash := C.crypt_r(cPassword, cSetting, data)
+	if hash == nil {
+		return "", fmt.Errorf("unsupported password hash")
+	}
+	// failures are reported by a hash starting with '*'
+	h := C.GoString(hash)
+	if strings.HasPrefix(h, "*") {
+		return "", fmt.Errorf("unsupported password hash")
+	}
+	return h, nil
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package registry
+
+import "fmt"
+
+// cryptHash returns the crypt(3) hash of password with the algorithm and
+// salt of setting, a previously computed hash
+func cryptHash(password, setting string) (string, error) {
+	return "", fmt.Errorf("unsupported on this platform")
+}
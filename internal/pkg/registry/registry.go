@@ -0,0 +1,415 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package registry implements a minimal OCI distribution registry serving
+// the images stored in a directory, for air-gapped clusters and local
+// testing. It supports the API used to push and pull images: manifests
+// by tag or digest, monolithic and chunked blob uploads, tag listing and
+// the catalog.
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// maxManifestSize bounds the size of pushed manifests
+const maxManifestSize = 4 << 20
+
+// ErrDigestMismatch is returned when the content of an upload doesn't
+// match its digest
+var ErrDigestMismatch = errors.New("content doesn't match digest")
+
+// Error codes of the distribution specification
+const (
+	codeBlobUnknown         = "BLOB_UNKNOWN"
+	codeBlobUploadUnknown   = "BLOB_UPLOAD_UNKNOWN"
+	codeDigestInvalid       = "DIGEST_INVALID"
+	codeManifestBlobUnknown = "MANIFEST_BLOB_UNKNOWN"
+	codeManifestInvalid     = "MANIFEST_INVALID"
+	codeManifestUnknown     = "MANIFEST_UNKNOWN"
+	codeNameInvalid         = "NAME_INVALID"
+	codeNameUnknown         = "NAME_UNKNOWN"
+	codeUnauthorized        = "UNAUTHORIZED"
+	codeUnsupported         = "UNSUPPORTED"
+)
+
+// Handler serves the registry API for the repositories of Storage
+type Handler struct {
+	Storage *Storage
+	// Users requires basic authentication with one of its users when
+	// not nil
+	Users Users
+}
+
+// apiError writes an error response of the distribution specification
+func apiError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sylog.Debugf("%s %s", r.Method, r.URL.Path)
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+
+	if h.Users != nil {
+		user, password, ok := r.BasicAuth()
+		if !ok || !h.Users.Authenticate(user, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="singularity"`)
+			apiError(w, http.StatusUnauthorized, codeUnauthorized, "authentication required")
+			return
+		}
+	}
+
+	path := r.URL.Path
+	if !strings.HasPrefix(path, "/v2/") {
+		http.NotFound(w, r)
+		return
+	}
+	path = strings.TrimPrefix(path, "/v2/")
+
+	switch {
+	case path == "":
+		writeJSON(w, struct{}{})
+		return
+	case path == "_catalog":
+		h.catalog(w, r)
+		return
+	}
+
+	// the repository name is the path before the last API element
+	for _, elem := range []string{"/blobs/uploads/", "/blobs/", "/manifests/", "/tags/list"} {
+		i := strings.LastIndex(path, elem)
+		if i < 0 {
+			continue
+		}
+		name, arg := path[:i], path[i+len(elem):]
+		if !ValidName(name) {
+			apiError(w, http.StatusBadRequest, codeNameInvalid, fmt.Sprintf("invalid repository name %q", name))
+			return
+		}
+		switch elem {
+		case "/blobs/uploads/":
+			h.upload(w, r, name, arg)
+		case "/blobs/":
+			h.blob(w, r, name, arg)
+		case "/manifests/":
+			h.manifest(w, r, name, arg)
+		case "/tags/list":
+			h.tags(w, r, name, arg)
+		}
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// catalog lists the repositories
+func (h *Handler) catalog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, http.StatusMethodNotAllowed, codeUnsupported, "unsupported method")
+		return
+	}
+	names, err := h.Storage.Repositories()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	writeJSON(w, map[string][]string{"repositories": names})
+}
+
+// tags lists the tags of the repository name
+func (h *Handler) tags(w http.ResponseWriter, r *http.Request, name, arg string) {
+	if arg != "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		apiError(w, http.StatusMethodNotAllowed, codeUnsupported, "unsupported method")
+		return
+	}
+	tags, err := h.Storage.Tags(name)
+	if os.IsNotExist(err) {
+		apiError(w, http.StatusNotFound, codeNameUnknown, fmt.Sprintf("repository %s not found", name))
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"name": name, "tags": tags})
+}
+
+// manifest pulls or pushes the manifest of the repository name
+// referenced by a tag or a digest
+func (h *Handler) manifest(w http.ResponseWriter, r *http.Request, name, reference string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		desc, err := h.Storage.Manifest(name, reference)
+		if os.IsNotExist(err) {
+			apiError(w, http.StatusNotFound, codeManifestUnknown, fmt.Sprintf("manifest %s:%s not found", name, reference))
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		f, err := h.Storage.Blob(name, desc.Digest)
+		if err != nil {
+			apiError(w, http.StatusNotFound, codeManifestUnknown, fmt.Sprintf("manifest %s:%s not found", name, reference))
+			return
+		}
+		defer f.Close()
+
+		mediaType := desc.MediaType
+		if mediaType == "" {
+			mediaType = imgspecv1.MediaTypeImageManifest
+		}
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Set("Content-Length", strconv.FormatInt(desc.Size, 10))
+		w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			io.Copy(w, f)
+		}
+
+	case http.MethodPut:
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxManifestSize+1))
+		if err != nil {
+			apiError(w, http.StatusBadRequest, codeManifestInvalid, err.Error())
+			return
+		}
+		if len(b) > maxManifestSize {
+			apiError(w, http.StatusRequestEntityTooLarge, codeManifestInvalid, "manifest too large")
+			return
+		}
+		mediaType := r.Header.Get("Content-Type")
+		if err := h.checkManifest(name, b, &mediaType); err != nil {
+			if err == errBlobUnknown {
+				apiError(w, http.StatusBadRequest, codeManifestBlobUnknown, err.Error())
+			} else {
+				apiError(w, http.StatusBadRequest, codeManifestInvalid, err.Error())
+			}
+			return
+		}
+		d, err := h.Storage.PutManifest(name, reference, mediaType, b)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, codeManifestInvalid, err.Error())
+			return
+		}
+		sylog.Infof("Pushed %s:%s (%s)", name, reference, d)
+		w.Header().Set("Location", "/v2/"+name+"/manifests/"+d.String())
+		w.Header().Set("Docker-Content-Digest", d.String())
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		apiError(w, http.StatusMethodNotAllowed, codeUnsupported, "unsupported method")
+	}
+}
+
+// errBlobUnknown is returned for manifests referencing missing blobs
+var errBlobUnknown = errors.New("manifest references unknown blobs")
+
+// checkManifest verifies that the blobs and manifests referenced by the
+// manifest b were pushed, mediaType is set from the manifest content when
+// the client didn't provide it
+func (h *Handler) checkManifest(name string, b []byte, mediaType *string) error {
+	var m struct {
+		MediaType string                 `json:"mediaType"`
+		Config    *imgspecv1.Descriptor  `json:"config"`
+		Layers    []imgspecv1.Descriptor `json:"layers"`
+		Manifests []imgspecv1.Descriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("invalid manifest: %s", err)
+	}
+	if *mediaType == "" || *mediaType == "application/json" {
+		*mediaType = m.MediaType
+	}
+
+	var refs []imgspecv1.Descriptor
+	if m.Config != nil {
+		refs = append(refs, *m.Config)
+	}
+	refs = append(refs, m.Layers...)
+	refs = append(refs, m.Manifests...)
+	for _, ref := range refs {
+		if err := ref.Digest.Validate(); err != nil {
+			return fmt.Errorf("invalid digest %q: %s", ref.Digest, err)
+		}
+		// foreign layers are downloaded from their URLs
+		if len(ref.URLs) > 0 {
+			continue
+		}
+		if !h.Storage.HasBlob(name, ref.Digest) {
+			return errBlobUnknown
+		}
+	}
+	return nil
+}
+
+// blob pulls the blob of the repository name
+func (h *Handler) blob(w http.ResponseWriter, r *http.Request, name, arg string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		apiError(w, http.StatusMethodNotAllowed, codeUnsupported, "unsupported method")
+		return
+	}
+	d, err := digest.Parse(arg)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, codeDigestInvalid, fmt.Sprintf("invalid digest %q", arg))
+		return
+	}
+	f, err := h.Storage.Blob(name, d)
+	if err != nil {
+		apiError(w, http.StatusNotFound, codeBlobUnknown, fmt.Sprintf("blob %s not found", d))
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", d.String())
+	// ranges let clients resume interrupted downloads
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
+
+// uploadStatus writes the location and the received range of the upload
+// id of the repository name
+func uploadStatus(w http.ResponseWriter, name, id string, size int64, status int) {
+	w.Header().Set("Location", "/v2/"+name+"/blobs/uploads/"+id)
+	w.Header().Set("Docker-Upload-UUID", id)
+	// the range is inclusive, 0-0 is returned for empty uploads
+	end := size - 1
+	if end < 0 {
+		end = 0
+	}
+	w.Header().Set("Range", fmt.Sprintf("0-%d", end))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(status)
+}
+
+// upload handles the blob uploads of the repository name, id is empty
+// when an upload starts
+func (h *Handler) upload(w http.ResponseWriter, r *http.Request, name, id string) {
+	if id == "" {
+		if r.Method != http.MethodPost {
+			apiError(w, http.StatusMethodNotAllowed, codeUnsupported, "unsupported method")
+			return
+		}
+		// cross repository mounts aren't supported, clients upload
+		// the blob instead
+		var err error
+		if id, err = h.Storage.StartUpload(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// monolithic upload with a single request
+		if r.URL.Query().Get("digest") != "" {
+			h.finishUpload(w, r, name, id)
+			return
+		}
+		uploadStatus(w, name, id, 0, http.StatusAccepted)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		size, err := h.Storage.UploadSize(id)
+		if err != nil {
+			apiError(w, http.StatusNotFound, codeBlobUploadUnknown, "upload not found")
+			return
+		}
+		uploadStatus(w, name, id, size, http.StatusNoContent)
+
+	case http.MethodPatch:
+		size, err := h.Storage.UploadSize(id)
+		if err != nil {
+			apiError(w, http.StatusNotFound, codeBlobUploadUnknown, "upload not found")
+			return
+		}
+		// chunks must be sent in order
+		if cr := r.Header.Get("Content-Range"); cr != "" {
+			var start, end int64
+			if _, err := fmt.Sscanf(cr, "%d-%d", &start, &end); err != nil || start != size {
+				apiError(w, http.StatusRequestedRangeNotSatisfiable, codeBlobUploadUnknown, "invalid content range")
+				return
+			}
+		}
+		size, err = h.Storage.AppendUpload(id, r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		uploadStatus(w, name, id, size, http.StatusAccepted)
+
+	case http.MethodPut:
+		h.finishUpload(w, r, name, id)
+
+	case http.MethodDelete:
+		if err := h.Storage.CancelUpload(id); err != nil {
+			apiError(w, http.StatusNotFound, codeBlobUploadUnknown, "upload not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		apiError(w, http.StatusMethodNotAllowed, codeUnsupported, "unsupported method")
+	}
+}
+
+// finishUpload appends the request body to the upload id and stores it
+// as a blob of the repository name
+func (h *Handler) finishUpload(w http.ResponseWriter, r *http.Request, name, id string) {
+	d, err := digest.Parse(r.URL.Query().Get("digest"))
+	if err != nil {
+		h.Storage.CancelUpload(id)
+		apiError(w, http.StatusBadRequest, codeDigestInvalid, "missing or invalid digest")
+		return
+	}
+	if _, err := h.Storage.AppendUpload(id, r.Body); os.IsNotExist(err) {
+		apiError(w, http.StatusNotFound, codeBlobUploadUnknown, "upload not found")
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.Storage.FinishUpload(name, id, d); err == ErrDigestMismatch {
+		apiError(w, http.StatusBadRequest, codeDigestInvalid, err.Error())
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/v2/"+name+"/blobs/"+d.String())
+	w.Header().Set("Docker-Content-Digest", d.String())
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusCreated)
+}
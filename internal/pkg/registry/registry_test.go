@@ -0,0 +1,223 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// newTestServer returns a registry server storing its repositories in a
+// temporary directory
+func newTestServer(t *testing.T, users Users) (*httptest.Server, string) {
+	dir, err := ioutil.TempDir("", "registry-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(&Handler{Storage: s, Users: users}), dir
+}
+
+func do(t *testing.T, method, url, contentType string, body []byte) *http.Response {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func expectStatus(t *testing.T, resp *http.Response, status int) []byte {
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != status {
+		t.Fatalf("unexpected status %d for %s %s: %s", resp.StatusCode, resp.Request.Method, resp.Request.URL, b)
+	}
+	return b
+}
+
+func TestPushPull(t *testing.T) {
+	srv, dir := newTestServer(t, nil)
+	defer os.RemoveAll(dir)
+	defer srv.Close()
+
+	repo := srv.URL + "/v2/library/alpine"
+
+	// monolithic upload of the configuration
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	configDigest := digest.FromBytes(config)
+	expectStatus(t, do(t, "POST", repo+"/blobs/uploads/?digest="+configDigest.String(), "application/octet-stream", config), http.StatusCreated)
+
+	// chunked upload of the layer
+	layer := []byte("layer content split in two chunks")
+	layerDigest := digest.FromBytes(layer)
+	resp := do(t, "POST", repo+"/blobs/uploads/", "", nil)
+	expectStatus(t, resp, http.StatusAccepted)
+	location := srv.URL + resp.Header.Get("Location")
+	resp = do(t, "PATCH", location, "application/octet-stream", layer[:10])
+	expectStatus(t, resp, http.StatusAccepted)
+	if r := resp.Header.Get("Range"); r != "0-9" {
+		t.Errorf("unexpected range %s", r)
+	}
+	expectStatus(t, do(t, "PUT", location+"?digest="+layerDigest.String(), "application/octet-stream", layer[10:]), http.StatusCreated)
+
+	// a corrupted upload is rejected
+	expectStatus(t, do(t, "POST", repo+"/blobs/uploads/?digest="+layerDigest.String(), "", []byte("corrupted")), http.StatusBadRequest)
+
+	manifest, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		Config:    imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: configDigest, Size: int64(len(config))},
+		Layers:    []imgspecv1.Descriptor{{MediaType: imgspecv1.MediaTypeImageLayer, Digest: layerDigest, Size: int64(len(layer))}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestDigest := digest.FromBytes(manifest)
+	resp = do(t, "PUT", repo+"/manifests/3.10", imgspecv1.MediaTypeImageManifest, manifest)
+	expectStatus(t, resp, http.StatusCreated)
+	if d := resp.Header.Get("Docker-Content-Digest"); d != manifestDigest.String() {
+		t.Errorf("unexpected manifest digest %s", d)
+	}
+
+	for _, ref := range []string{"3.10", manifestDigest.String()} {
+		resp = do(t, "GET", repo+"/manifests/"+ref, "", nil)
+		b := expectStatus(t, resp, http.StatusOK)
+		if !bytes.Equal(b, manifest) {
+			t.Errorf("unexpected manifest %s", b)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != imgspecv1.MediaTypeImageManifest {
+			t.Errorf("unexpected content type %s", ct)
+		}
+	}
+	if b := expectStatus(t, do(t, "GET", repo+"/blobs/"+layerDigest.String(), "", nil), http.StatusOK); !bytes.Equal(b, layer) {
+		t.Errorf("unexpected layer %s", b)
+	}
+	expectStatus(t, do(t, "HEAD", repo+"/blobs/"+configDigest.String(), "", nil), http.StatusOK)
+	expectStatus(t, do(t, "GET", repo+"/manifests/latest", "", nil), http.StatusNotFound)
+
+	b := expectStatus(t, do(t, "GET", repo+"/tags/list", "", nil), http.StatusOK)
+	if !strings.Contains(string(b), `"tags":["3.10"]`) {
+		t.Errorf("unexpected tags %s", b)
+	}
+	b = expectStatus(t, do(t, "GET", srv.URL+"/v2/_catalog", "", nil), http.StatusOK)
+	if !strings.Contains(string(b), `"repositories":["library/alpine"]`) {
+		t.Errorf("unexpected catalog %s", b)
+	}
+
+	// repositories are OCI image layouts
+	for _, f := range []string{imgspecv1.ImageLayoutFile, indexFile, "blobs/sha256/" + layerDigest.Hex()} {
+		if _, err := os.Stat(filepath.Join(dir, "library/alpine", f)); err != nil {
+			t.Errorf("missing %s in image layout: %s", f, err)
+		}
+	}
+}
+
+func TestPushManifestUnknownBlob(t *testing.T) {
+	srv, dir := newTestServer(t, nil)
+	defer os.RemoveAll(dir)
+	defer srv.Close()
+
+	manifest, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		Config:    imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: digest.FromString("missing"), Size: 7},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := expectStatus(t, do(t, "PUT", srv.URL+"/v2/test/manifests/latest", imgspecv1.MediaTypeImageManifest, manifest), http.StatusBadRequest)
+	if !strings.Contains(string(b), codeManifestBlobUnknown) {
+		t.Errorf("unexpected error %s", b)
+	}
+
+	expectStatus(t, do(t, "GET", srv.URL+"/v2/Invalid/tags/list", "", nil), http.StatusBadRequest)
+	expectStatus(t, do(t, "GET", srv.URL+"/v2/test/blobs/sha256:bad", "", nil), http.StatusBadRequest)
+	expectStatus(t, do(t, "GET", srv.URL+"/v2/test/tags/list", "", nil), http.StatusNotFound)
+}
+
+func TestAuthentication(t *testing.T) {
+	users, err := ReadUsers(strings.NewReader("# users\nalice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\nbob:secret\ncarol:$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	srv, dir := newTestServer(t, users)
+	defer os.RemoveAll(dir)
+	defer srv.Close()
+
+	tests := []struct {
+		user     string
+		password string
+		status   int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"alice", "password", http.StatusOK},
+		{"alice", "secret", http.StatusUnauthorized},
+		{"bob", "secret", http.StatusOK},
+		{"carol", "U*U", http.StatusOK},
+		{"carol", "U*V", http.StatusUnauthorized},
+		{"eve", "secret", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", srv.URL+"/v2/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, tt.password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("unexpected status %d for user %q", resp.StatusCode, tt.user)
+		}
+	}
+
+	if _, err := ReadUsers(strings.NewReader("dave:$apr1$salt$hash\n")); err == nil {
+		t.Errorf("unexpected success with MD5 password")
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"alpine":           true,
+		"library/alpine":   true,
+		"my-org/my_app.v2": true,
+		"Alpine":           false,
+		"../etc":           false,
+		"/alpine":          false,
+		"_uploads":         false,
+		"repo/blobs":       false,
+	} {
+		if ValidName(name) != valid {
+			t.Errorf("unexpected validity of %q", name)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	uuid "github.com/satori/go.uuid"
+)
+
+// indexFile is the index of an OCI image layout
+const indexFile = "index.json"
+
+// uploadsDir is the directory of the storage root holding blob uploads
+// in progress, it's not a valid repository name
+const uploadsDir = "_uploads"
+
+// nameRegexp matches the repository names of the distribution
+// specification
+var nameRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*)*$`)
+
+// tagRegexp matches the tags of the distribution specification
+var tagRegexp = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+
+// Storage stores each repository as an OCI image layout in a directory
+// named after the repository, so repositories can also be used with the
+// oci: transport. Tags are the org.opencontainers.image.ref.name
+// annotations of the index.
+type Storage struct {
+	Root string
+
+	// mu serializes index updates
+	mu sync.Mutex
+}
+
+// NewStorage returns the storage of the directory root, it's created if
+// it doesn't exist
+func NewStorage(root string) (*Storage, error) {
+	if err := os.MkdirAll(filepath.Join(root, uploadsDir), 0755); err != nil {
+		return nil, fmt.Errorf("could not create registry directory: %s", err)
+	}
+	return &Storage{Root: root}, nil
+}
+
+// ValidName returns if name is a valid repository name, the blobs
+// directory of the image layouts can't be a name component
+func ValidName(name string) bool {
+	if len(name) > 255 || !nameRegexp.MatchString(name) {
+		return false
+	}
+	for _, c := range strings.Split(name, "/") {
+		if c == "blobs" {
+			return false
+		}
+	}
+	return true
+}
+
+// repository returns the directory of the repository name
+func (s *Storage) repository(name string) string {
+	return filepath.Join(s.Root, filepath.FromSlash(name))
+}
+
+// blobPath returns the path of blob d in the repository name
+func (s *Storage) blobPath(name string, d digest.Digest) string {
+	return filepath.Join(s.repository(name), "blobs", string(d.Algorithm()), d.Hex())
+}
+
+// Exists returns if the repository name exists
+func (s *Storage) Exists(name string) bool {
+	_, err := os.Stat(filepath.Join(s.repository(name), indexFile))
+	return err == nil
+}
+
+// Repositories returns the sorted names of the repositories
+func (s *Storage) Repositories() ([]string, error) {
+	var names []string
+	err := filepath.Walk(s.Root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Root, path)
+		if err != nil {
+			return err
+		}
+		if rel == uploadsDir || fi.Name() == "blobs" {
+			return filepath.SkipDir
+		}
+		if rel != "." && s.Exists(filepath.ToSlash(rel)) {
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// readIndex returns the index of the repository name
+func (s *Storage) readIndex(name string) (*imgspecv1.Index, error) {
+	b, err := ioutil.ReadFile(filepath.Join(s.repository(name), indexFile))
+	if err != nil {
+		return nil, err
+	}
+	index := &imgspecv1.Index{}
+	if err := json.Unmarshal(b, index); err != nil {
+		return nil, fmt.Errorf("while parsing index of %s: %s", name, err)
+	}
+	return index, nil
+}
+
+// writeIndex replaces the index of the repository name
+func (s *Storage) writeIndex(name string, index *imgspecv1.Index) error {
+	dir := s.repository(name)
+	layout := filepath.Join(dir, imgspecv1.ImageLayoutFile)
+	if _, err := os.Stat(layout); os.IsNotExist(err) {
+		b, err := json.Marshal(imgspecv1.ImageLayout{Version: imgspecv1.ImageLayoutVersion})
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(layout, b, 0644); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "index-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, indexFile))
+}
+
+// Tags returns the sorted tags of the repository name
+func (s *Storage) Tags(name string) ([]string, error) {
+	index, err := s.readIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, m := range index.Manifests {
+		if tag := m.Annotations[imgspecv1.AnnotationRefName]; tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// Manifest returns the descriptor of the manifest of the repository name
+// referenced by a tag or a digest
+func (s *Storage) Manifest(name, reference string) (imgspecv1.Descriptor, error) {
+	if reference == "" {
+		return imgspecv1.Descriptor{}, os.ErrNotExist
+	}
+	index, err := s.readIndex(name)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	for _, m := range index.Manifests {
+		if m.Digest.String() == reference || m.Annotations[imgspecv1.AnnotationRefName] == reference {
+			return m, nil
+		}
+	}
+
+	// manifests whose tag moved are still pulled by digest
+	d, err := digest.Parse(reference)
+	if err != nil {
+		return imgspecv1.Descriptor{}, os.ErrNotExist
+	}
+	b, err := ioutil.ReadFile(s.blobPath(name, d))
+	if err != nil {
+		return imgspecv1.Descriptor{}, os.ErrNotExist
+	}
+	var m struct {
+		MediaType string `json:"mediaType"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return imgspecv1.Descriptor{}, os.ErrNotExist
+	}
+	if m.MediaType == "" {
+		m.MediaType = imgspecv1.MediaTypeImageManifest
+	}
+	return imgspecv1.Descriptor{MediaType: m.MediaType, Digest: d, Size: int64(len(b))}, nil
+}
+
+// PutManifest stores the manifest of the repository name and references
+// it with a tag or its digest, the repository is created if it doesn't
+// exist
+func (s *Storage) PutManifest(name, reference, mediaType string, manifest []byte) (digest.Digest, error) {
+	d := digest.FromBytes(manifest)
+	if ref, err := digest.Parse(reference); err == nil {
+		if ref != d {
+			return "", fmt.Errorf("manifest digest %s doesn't match %s", d, ref)
+		}
+		reference = ""
+	} else if !tagRegexp.MatchString(reference) {
+		return "", fmt.Errorf("invalid tag %q", reference)
+	}
+
+	if err := s.writeBlob(name, d, manifest); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.readIndex(name)
+	if os.IsNotExist(err) {
+		index = &imgspecv1.Index{Versioned: imgspecs.Versioned{SchemaVersion: 2}}
+	} else if err != nil {
+		return "", err
+	}
+
+	desc := imgspecv1.Descriptor{
+		MediaType: mediaType,
+		Digest:    d,
+		Size:      int64(len(manifest)),
+	}
+	if reference != "" {
+		desc.Annotations = map[string]string{imgspecv1.AnnotationRefName: reference}
+	}
+
+	// a tag references a single manifest, manifests pushed by digest
+	// are listed once until they are tagged
+	manifests := index.Manifests[:0]
+	for _, m := range index.Manifests {
+		tag := m.Annotations[imgspecv1.AnnotationRefName]
+		if reference != "" && tag == reference {
+			continue
+		}
+		if tag == "" && m.Digest == d {
+			if reference == "" {
+				return d, nil
+			}
+			continue
+		}
+		manifests = append(manifests, m)
+	}
+	index.Manifests = append(manifests, desc)
+
+	return d, s.writeIndex(name, index)
+}
+
+// Blob opens the blob d of the repository name
+func (s *Storage) Blob(name string, d digest.Digest) (*os.File, error) {
+	return os.Open(s.blobPath(name, d))
+}
+
+// HasBlob returns if the repository name holds the blob d
+func (s *Storage) HasBlob(name string, d digest.Digest) bool {
+	_, err := os.Stat(s.blobPath(name, d))
+	return err == nil
+}
+
+// writeBlob stores data as the blob d of the repository name
+func (s *Storage) writeBlob(name string, d digest.Digest, data []byte) error {
+	id, err := s.StartUpload()
+	if err != nil {
+		return err
+	}
+	if _, err := s.AppendUpload(id, bytes.NewReader(data)); err != nil {
+		s.CancelUpload(id)
+		return err
+	}
+	return s.FinishUpload(name, id, d)
+}
+
+// uploadPath returns the path of the upload id, ids are UUIDs generated
+// by StartUpload
+func (s *Storage) uploadPath(id string) (string, error) {
+	if _, err := uuid.FromString(id); err != nil {
+		return "", os.ErrNotExist
+	}
+	return filepath.Join(s.Root, uploadsDir, id), nil
+}
+
+// StartUpload creates a blob upload and returns its id
+func (s *Storage) StartUpload() (string, error) {
+	id := uuid.NewV4().String()
+	path, _ := s.uploadPath(id)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	return id, f.Close()
+}
+
+// UploadSize returns the number of bytes received by the upload id
+func (s *Storage) UploadSize(id string) (int64, error) {
+	path, err := s.uploadPath(id)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// AppendUpload appends the content of r to the upload id and returns the
+// size of the upload
+func (s *Storage) AppendUpload(id string, r io.Reader) (int64, error) {
+	path, err := s.uploadPath(id)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// FinishUpload verifies that the content of the upload id matches d and
+// moves it to the blobs of the repository name
+func (s *Storage) FinishUpload(name, id string, d digest.Digest) error {
+	path, err := s.uploadPath(id)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	if err := d.Validate(); err != nil {
+		f.Close()
+		return err
+	}
+	verifier := d.Verifier()
+	_, err = io.Copy(verifier, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		os.Remove(path)
+		return ErrDigestMismatch
+	}
+
+	blob := s.blobPath(name, d)
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return err
+	}
+	return os.Rename(path, blob)
+}
+
+// CancelUpload removes the upload id
+func (s *Storage) CancelUpload(id string) error {
+	path, err := s.uploadPath(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// HostHome bind mounts the host home directory
+	HostHome = "host"
+	// TmpfsHome provides an empty tmpfs, optionally limited in size
+	TmpfsHome = "tmpfs"
+	// SkelHome provides a tmpfs populated from /etc/skel of the image
+	SkelHome = "skel"
+	// ImageHome uses the home directory of the image
+	ImageHome = "image"
+)
+
+// HomeMode describes how the home directory is provided to a container
+type HomeMode struct {
+	Type string
+	Size string
+}
+
+// ParseHomeMode parses a mode with the format host, image, tmpfs[:<size>]
+// or skel[:<size>], an empty mode is the host mode
+func ParseHomeMode(mode string) (*HomeMode, error) {
+	if mode == "" {
+		return &HomeMode{Type: HostHome}, nil
+	}
+	splitted := strings.SplitN(mode, ":", 2)
+	m := &HomeMode{Type: splitted[0]}
+
+	switch m.Type {
+	case TmpfsHome, SkelHome:
+		if len(splitted) == 2 {
+			if !tmpfsSize.MatchString(splitted[1]) {
+				return nil, fmt.Errorf("bad home size %q", splitted[1])
+			}
+			m.Size = splitted[1]
+		}
+	case HostHome, ImageHome:
+		if len(splitted) == 2 {
+			return nil, fmt.Errorf("%s home mode doesn't take argument", m.Type)
+		}
+	default:
+		return nil, fmt.Errorf("unknown home mode %q, expected host, image, tmpfs[:<size>] or skel[:<size>]", m.Type)
+	}
+
+	return m, nil
+}
+
+// String returns the home mode string representation
+func (m *HomeMode) String() string {
+	if m.Size != "" {
+		return m.Type + ":" + m.Size
+	}
+	return m.Type
+}
+
+// IsTmpfs returns true if the home directory is a tmpfs
+func (m *HomeMode) IsTmpfs() bool {
+	return m.Type == TmpfsHome || m.Type == SkelHome
+}
+
+// Options returns tmpfs mount options of a home directory owned by uid
+// and gid for tmpfs and skel modes
+func (m *HomeMode) Options(uid, gid int) string {
+	options := fmt.Sprintf("mode=0700,uid=%d,gid=%d", uid, gid)
+	if m.Size != "" {
+		options += ",size=" + m.Size
+	}
+	return options
+}
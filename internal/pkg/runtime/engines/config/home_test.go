@@ -0,0 +1,49 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestParseHomeMode(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		mode    string
+		str     string
+		tmpfs   bool
+		options string
+	}{
+		{"", "host", false, ""},
+		{"host", "host", false, ""},
+		{"image", "image", false, ""},
+		{"tmpfs", "tmpfs", true, "mode=0700,uid=1000,gid=100"},
+		{"skel:1g", "skel:1g", true, "mode=0700,uid=1000,gid=100,size=1g"},
+	}
+	for _, tt := range tests {
+		m, err := ParseHomeMode(tt.mode)
+		if err != nil {
+			t.Errorf("unexpected error with %q: %s", tt.mode, err)
+			continue
+		}
+		if m.String() != tt.str || m.IsTmpfs() != tt.tmpfs {
+			t.Errorf("unexpected home mode %s for %q", m, tt.mode)
+		}
+		if tt.tmpfs && m.Options(1000, 100) != tt.options {
+			t.Errorf("unexpected options %s for %q", m.Options(1000, 100), tt.mode)
+		}
+	}
+
+	for _, mode := range []string{"tmpfs:big", "host:/home", "image:1g", "overlay"} {
+		if _, err := ParseHomeMode(mode); err == nil {
+			t.Errorf("unexpected success with %q", mode)
+		}
+	}
+}
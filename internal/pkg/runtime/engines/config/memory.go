@@ -0,0 +1,151 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// THPNever disables transparent hugepages for the container processes
+	THPNever = "never"
+	// THPMadvise only uses transparent hugepages for memory regions
+	// advised with madvise(MADV_HUGEPAGE)
+	THPMadvise = "madvise"
+)
+
+// maxNumaNode bounds the NUMA node numbers accepted in node lists
+const maxNumaNode = 1023
+
+// ParseTHP checks a transparent hugepage mode, either never or madvise,
+// an empty mode keeps the host setting
+func ParseTHP(mode string) error {
+	switch mode {
+	case "", THPNever, THPMadvise:
+		return nil
+	}
+	return fmt.Errorf("unknown transparent hugepage mode %q, expected never or madvise", mode)
+}
+
+const (
+	// DefaultPolicy is the system default memory policy
+	DefaultPolicy = "default"
+	// LocalPolicy allocates memory on the node of the CPU
+	LocalPolicy = "local"
+	// BindPolicy restricts allocations to a set of nodes
+	BindPolicy = "bind"
+	// InterleavePolicy interleaves allocations over a set of nodes
+	InterleavePolicy = "interleave"
+	// PreferredPolicy allocates memory on a node first
+	PreferredPolicy = "preferred"
+)
+
+// MemPolicy is the NUMA memory policy of the container processes
+type MemPolicy struct {
+	Mode  string
+	Nodes []int
+}
+
+// ParseMemPolicy parses a policy with the format default, local,
+// bind:<nodes>, interleave:<nodes> or preferred:<node>, where nodes is a
+// list like 0,2-3. An empty policy returns nil.
+func ParseMemPolicy(policy string) (*MemPolicy, error) {
+	if policy == "" {
+		return nil, nil
+	}
+	splitted := strings.SplitN(policy, ":", 2)
+	p := &MemPolicy{Mode: splitted[0]}
+
+	switch p.Mode {
+	case DefaultPolicy, LocalPolicy:
+		if len(splitted) == 2 {
+			return nil, fmt.Errorf("%s memory policy doesn't take nodes", p.Mode)
+		}
+	case BindPolicy, InterleavePolicy, PreferredPolicy:
+		if len(splitted) == 1 || splitted[1] == "" {
+			return nil, fmt.Errorf("%s memory policy requires nodes", p.Mode)
+		}
+		nodes, err := ParseNodeList(splitted[1])
+		if err != nil {
+			return nil, err
+		}
+		if p.Mode == PreferredPolicy && len(nodes) != 1 {
+			return nil, fmt.Errorf("preferred memory policy takes a single node")
+		}
+		p.Nodes = nodes
+	default:
+		return nil, fmt.Errorf("unknown memory policy %q, expected default, local, bind:<nodes>, interleave:<nodes> or preferred:<node>", p.Mode)
+	}
+
+	return p, nil
+}
+
+// ParseNodeList parses a NUMA node list like 0,2-3 and returns the
+// sorted node numbers
+func ParseNodeList(list string) ([]int, error) {
+	set := make(map[int]bool)
+	for _, r := range strings.Split(list, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+		first, err := parseNode(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = parseNode(bounds[1]); err != nil {
+				return nil, err
+			}
+			if last < first {
+				return nil, fmt.Errorf("bad node range %q", r)
+			}
+		}
+		for n := first; n <= last; n++ {
+			set[n] = true
+		}
+	}
+
+	nodes := make([]int, 0, len(set))
+	for n := 0; n <= maxNumaNode; n++ {
+		if set[n] {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
+func parseNode(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > maxNumaNode {
+		return 0, fmt.Errorf("bad NUMA node %q", s)
+	}
+	return n, nil
+}
+
+// Nodemask returns the node bitmask passed to set_mempolicy(2)
+func (p *MemPolicy) Nodemask() []uint64 {
+	var mask []uint64
+	for _, n := range p.Nodes {
+		for len(mask) <= n/64 {
+			mask = append(mask, 0)
+		}
+		mask[n/64] |= 1 << uint(n%64)
+	}
+	return mask
+}
+
+// String returns the memory policy string representation
+func (p *MemPolicy) String() string {
+	if len(p.Nodes) == 0 {
+		return p.Mode
+	}
+	nodes := make([]string, len(p.Nodes))
+	for i, n := range p.Nodes {
+		nodes[i] = strconv.Itoa(n)
+	}
+	return p.Mode + ":" + strings.Join(nodes, ",")
+}
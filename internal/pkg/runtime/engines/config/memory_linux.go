@@ -0,0 +1,77 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// memory policy modes of set_mempolicy(2)
+var mpolModes = map[string]uintptr{
+	DefaultPolicy:    0,
+	PreferredPolicy:  1,
+	BindPolicy:       2,
+	InterleavePolicy: 3,
+	LocalPolicy:      4,
+}
+
+// prThpDisableExceptAdvised is the PR_SET_THP_DISABLE flag keeping
+// transparent hugepages for madvised regions, available since Linux 6.18
+const prThpDisableExceptAdvised = 1 << 1
+
+// ApplyTHP sets the transparent hugepage mode of the current process,
+// the mode is inherited by children and preserved across execve(2)
+func ApplyTHP(mode string) error {
+	var flags uintptr
+
+	switch mode {
+	case "":
+		return nil
+	case THPNever:
+	case THPMadvise:
+		flags = prThpDisableExceptAdvised
+	default:
+		return ParseTHP(mode)
+	}
+
+	if err := unix.Prctl(unix.PR_SET_THP_DISABLE, 1, flags, 0, 0); err != nil {
+		if err == unix.EINVAL && mode == THPMadvise {
+			return fmt.Errorf("transparent hugepage mode madvise requires Linux 6.18 or later")
+		}
+		return fmt.Errorf("could not set transparent hugepage mode %s: %s", mode, err)
+	}
+	return nil
+}
+
+// Apply sets the memory policy of the calling thread, the policy is
+// inherited by children and preserved across execve(2). The goroutine
+// stays locked to the thread so processes started from it get the policy.
+func (p *MemPolicy) Apply() error {
+	runtime.LockOSThread()
+
+	var mask unsafe.Pointer
+	var maxnode uintptr
+
+	nodemask := p.Nodemask()
+	if len(nodemask) > 0 {
+		mask = unsafe.Pointer(&nodemask[0])
+		// the kernel ignores the last bit of maxnode
+		maxnode = uintptr(len(nodemask)*64 + 1)
+	}
+
+	_, _, errno := unix.Syscall(unix.SYS_SET_MEMPOLICY, mpolModes[p.Mode], uintptr(mask), maxnode)
+	if errno != 0 {
+		if errno == unix.EINVAL && len(p.Nodes) > 0 {
+			return fmt.Errorf("could not set memory policy %s: nodes are not available", p)
+		}
+		return fmt.Errorf("could not set memory policy %s: %s", p, errno)
+	}
+	return nil
+}
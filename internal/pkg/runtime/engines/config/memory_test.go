@@ -0,0 +1,60 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMemPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		str    string
+		mask   []uint64
+	}{
+		{"default", "default", nil},
+		{"local", "local", nil},
+		{"bind:0", "bind:0", []uint64{1}},
+		{"interleave:3,0-1", "interleave:0,1,3", []uint64{0xb}},
+		{"bind:1,65", "bind:1,65", []uint64{2, 2}},
+		{"preferred:2", "preferred:2", []uint64{4}},
+	}
+	for _, tt := range tests {
+		p, err := ParseMemPolicy(tt.policy)
+		if err != nil {
+			t.Errorf("unexpected error with %q: %s", tt.policy, err)
+			continue
+		}
+		if p.String() != tt.str {
+			t.Errorf("unexpected memory policy %s for %q", p, tt.policy)
+		}
+		if !reflect.DeepEqual(p.Nodemask(), tt.mask) {
+			t.Errorf("unexpected node mask %v for %q", p.Nodemask(), tt.policy)
+		}
+	}
+
+	if p, err := ParseMemPolicy(""); p != nil || err != nil {
+		t.Errorf("unexpected result with empty policy: %v %v", p, err)
+	}
+
+	for _, policy := range []string{"bind", "bind:", "local:0", "preferred:0-1", "interleave:2-1", "bind:a", "bind:-1", "bind:4096", "first-touch"} {
+		if _, err := ParseMemPolicy(policy); err == nil {
+			t.Errorf("unexpected success with %q", policy)
+		}
+	}
+}
+
+func TestParseTHP(t *testing.T) {
+	for _, mode := range []string{"", "never", "madvise"} {
+		if err := ParseTHP(mode); err != nil {
+			t.Errorf("unexpected error with %q: %s", mode, err)
+		}
+	}
+	if err := ParseTHP("always"); err == nil {
+		t.Errorf("unexpected success with always")
+	}
+}
@@ -12,17 +12,49 @@ import (
 	"github.com/opencontainers/runtime-tools/generate"
 )
 
+// TimeNamespace is the time namespace type, not defined by the vendored
+// runtime specification yet
+const TimeNamespace specs.LinuxNamespaceType = "time"
+
+// LinuxTimeOffset specifies the offset of a clock (monotonic or boottime)
+// in the container time namespace
+type LinuxTimeOffset struct {
+	Secs     int64  `json:"secs,omitempty"`
+	Nanosecs uint32 `json:"nanosecs,omitempty"`
+}
+
 // Config is the OCI runtime configuration.
 type Config struct {
 	generate.Generator
 	specs.Spec
+	// TimeOffsets stores linux.timeOffsets of the specification
+	TimeOffsets map[string]LinuxTimeOffset `json:"-"`
 }
 
 // MarshalJSON is for json.Marshaler
 func (c *Config) MarshalJSON() ([]byte, error) {
 	b, err := json.Marshal(&c.Spec)
+	if err != nil || len(c.TimeOffsets) == 0 || c.Spec.Linux == nil {
+		return b, err
+	}
+
+	// add timeOffsets to the linux object
+	spec := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return nil, err
+	}
+	linux := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(spec["linux"], &linux); err != nil {
+		return nil, err
+	}
+	if linux["timeOffsets"], err = json.Marshal(c.TimeOffsets); err != nil {
+		return nil, err
+	}
+	if spec["linux"], err = json.Marshal(linux); err != nil {
+		return nil, err
+	}
 
-	return b, err
+	return json.Marshal(spec)
 }
 
 // UnmarshalJSON is for json.Unmarshaler
@@ -31,5 +63,18 @@ func (c *Config) UnmarshalJSON(b []byte) error {
 		return err
 	}
 	c.Generator = generate.Generator{Config: &c.Spec}
+
+	var spec struct {
+		Linux *struct {
+			TimeOffsets map[string]LinuxTimeOffset `json:"timeOffsets"`
+		} `json:"linux"`
+	}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return err
+	}
+	c.TimeOffsets = nil
+	if spec.Linux != nil {
+		c.TimeOffsets = spec.Linux.TimeOffsets
+	}
 	return nil
 }
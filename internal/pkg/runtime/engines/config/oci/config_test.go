@@ -0,0 +1,50 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestTimeOffsets(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	spec := `{"ociVersion": "1.0.1", "linux": {"namespaces": [{"type": "time"}], "timeOffsets": {"monotonic": {"secs": 86400}, "boottime": {"secs": -10, "nanosecs": 500}}}}`
+
+	c := &Config{}
+	if err := json.Unmarshal([]byte(spec), c); err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if c.Spec.Linux.Namespaces[0].Type != TimeNamespace {
+		t.Errorf("time namespace not decoded")
+	}
+	if c.TimeOffsets["monotonic"].Secs != 86400 || c.TimeOffsets["boottime"].Nanosecs != 500 {
+		t.Errorf("unexpected time offsets: %v", c.TimeOffsets)
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	c2 := &Config{}
+	if err := json.Unmarshal(b, c2); err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if len(c2.TimeOffsets) != 2 || c2.TimeOffsets["boottime"].Secs != -10 {
+		t.Errorf("time offsets lost after marshaling: %s", b)
+	}
+
+	if err := c2.ApplyMergePatch([]byte(`{"linux": {"timeOffsets": {"boottime": null}}}`)); err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+	if len(c2.TimeOffsets) != 1 {
+		t.Errorf("time offsets not patched: %v", c2.TimeOffsets)
+	}
+}
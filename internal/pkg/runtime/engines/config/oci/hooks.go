@@ -0,0 +1,193 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// DefaultHooksDirs lists directories searched for hook definition files,
+// a file in a later directory overrides the file with the same name in
+// an earlier directory
+var DefaultHooksDirs = []string{
+	"/usr/share/containers/oci/hooks.d",
+	"/etc/containers/oci/hooks.d",
+}
+
+// hookWhen holds conditions under which a hook is injected, the hook
+// is injected if any of the conditions matches
+type hookWhen struct {
+	Always        *bool             `json:"always,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+	Commands      []string          `json:"commands,omitempty"`
+	HasBindMounts *bool             `json:"hasBindMounts,omitempty"`
+}
+
+// hookDefinition is the 1.0.0 hook definition file format as used by
+// podman and CRI-O
+type hookDefinition struct {
+	Version string     `json:"version"`
+	Hook    specs.Hook `json:"hook"`
+	When    hookWhen   `json:"when"`
+	Stages  []string   `json:"stages"`
+}
+
+func readHookDefinition(path string) (*hookDefinition, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hook := &hookDefinition{}
+	if err := json.Unmarshal(b, hook); err != nil {
+		return nil, err
+	}
+
+	if hook.Version != "1.0.0" {
+		return nil, fmt.Errorf("unsupported hook version %q", hook.Version)
+	}
+	if !filepath.IsAbs(hook.Hook.Path) {
+		return nil, fmt.Errorf("hook path %q is not absolute", hook.Hook.Path)
+	}
+	if len(hook.Stages) == 0 {
+		return nil, fmt.Errorf("no stages specified")
+	}
+	for _, stage := range hook.Stages {
+		switch stage {
+		case "prestart", "poststart", "poststop":
+		default:
+			return nil, fmt.Errorf("unknown stage %q", stage)
+		}
+	}
+
+	w := hook.When
+	if w.Always == nil && w.HasBindMounts == nil && len(w.Annotations) == 0 && len(w.Commands) == 0 {
+		return nil, fmt.Errorf("no when conditions specified")
+	}
+
+	return hook, nil
+}
+
+// match returns if the hook conditions match the runtime specification
+func (h *hookDefinition) match(spec *specs.Spec) (bool, error) {
+	w := h.When
+
+	if w.Always != nil && *w.Always {
+		return true, nil
+	}
+
+	if w.HasBindMounts != nil && *w.HasBindMounts {
+		for _, m := range spec.Mounts {
+			if m.Type == "bind" {
+				return true, nil
+			}
+			for _, opt := range m.Options {
+				if opt == "bind" || opt == "rbind" {
+					return true, nil
+				}
+			}
+		}
+	}
+
+	for key, value := range w.Annotations {
+		kre, err := regexp.Compile(key)
+		if err != nil {
+			return false, fmt.Errorf("bad annotation key pattern %q: %s", key, err)
+		}
+		vre, err := regexp.Compile(value)
+		if err != nil {
+			return false, fmt.Errorf("bad annotation value pattern %q: %s", value, err)
+		}
+		for k, v := range spec.Annotations {
+			if kre.MatchString(k) && vre.MatchString(v) {
+				return true, nil
+			}
+		}
+	}
+
+	if spec.Process != nil && len(spec.Process.Args) > 0 {
+		for _, command := range w.Commands {
+			re, err := regexp.Compile(command)
+			if err != nil {
+				return false, fmt.Errorf("bad command pattern %q: %s", command, err)
+			}
+			if re.MatchString(spec.Process.Args[0]) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// InjectHooks reads hook definition files (*.json) from dirs and adds
+// hooks whose conditions match the runtime specification. Hooks are
+// added in lexical order of their file names after the hooks already
+// present, missing directories are ignored.
+func (c *Config) InjectHooks(dirs []string) error {
+	files := make(map[string]string)
+
+	for _, dir := range dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to read hooks directory %s: %s", dir, err)
+		}
+		for _, e := range entries {
+			if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+				continue
+			}
+			files[e.Name()] = filepath.Join(dir, e.Name())
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := files[name]
+
+		hook, err := readHookDefinition(path)
+		if err != nil {
+			return fmt.Errorf("invalid hook definition %s: %s", path, err)
+		}
+
+		match, err := hook.match(&c.Spec)
+		if err != nil {
+			return fmt.Errorf("invalid hook definition %s: %s", path, err)
+		} else if !match {
+			continue
+		}
+
+		if c.Spec.Hooks == nil {
+			c.Spec.Hooks = &specs.Hooks{}
+		}
+		for _, stage := range hook.Stages {
+			switch stage {
+			case "prestart":
+				c.Spec.Hooks.Prestart = append(c.Spec.Hooks.Prestart, hook.Hook)
+			case "poststart":
+				c.Spec.Hooks.Poststart = append(c.Spec.Hooks.Poststart, hook.Hook)
+			case "poststop":
+				c.Spec.Hooks.Poststop = append(c.Spec.Hooks.Poststop, hook.Hook)
+			}
+		}
+	}
+
+	return nil
+}
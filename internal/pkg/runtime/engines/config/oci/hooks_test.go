@@ -0,0 +1,72 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestInjectHooks(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	share, err := ioutil.TempDir("", "hooks-share-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(share)
+
+	etc, err := ioutil.TempDir("", "hooks-etc-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(etc)
+
+	files := map[string]string{
+		filepath.Join(share, "01-gpu.json"): `{"version": "1.0.0", "hook": {"path": "/usr/bin/gpu-hook"}, "when": {"annotations": {"^com\\.example\\.gpu$": "^true$"}}, "stages": ["prestart"]}`,
+		filepath.Join(share, "02-mpi.json"): `{"version": "1.0.0", "hook": {"path": "/usr/bin/mpi-hook"}, "when": {"commands": ["mpirun$"]}, "stages": ["prestart", "poststop"]}`,
+		filepath.Join(share, "03-all.json"): `{"version": "1.0.0", "hook": {"path": "/usr/bin/share-hook"}, "when": {"always": true}, "stages": ["poststart"]}`,
+		filepath.Join(etc, "03-all.json"):   `{"version": "1.0.0", "hook": {"path": "/usr/bin/etc-hook"}, "when": {"always": true}, "stages": ["poststart"]}`,
+		filepath.Join(etc, "README"):        `not a hook`,
+	}
+	for path, content := range files {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &Config{}
+	c.Spec.Process = &specs.Process{Args: []string{"/bin/sh"}}
+	c.Spec.Annotations = map[string]string{"com.example.gpu": "true"}
+
+	if err := c.InjectHooks([]string{share, etc, "/non/existent"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(c.Spec.Hooks.Prestart) != 1 || c.Spec.Hooks.Prestart[0].Path != "/usr/bin/gpu-hook" {
+		t.Errorf("unexpected prestart hooks: %v", c.Spec.Hooks.Prestart)
+	}
+	if len(c.Spec.Hooks.Poststart) != 1 || c.Spec.Hooks.Poststart[0].Path != "/usr/bin/etc-hook" {
+		t.Errorf("unexpected poststart hooks: %v", c.Spec.Hooks.Poststart)
+	}
+	if len(c.Spec.Hooks.Poststop) != 0 {
+		t.Errorf("unexpected poststop hooks: %v", c.Spec.Hooks.Poststop)
+	}
+
+	bad := filepath.Join(etc, "04-bad.json")
+	if err := ioutil.WriteFile(bad, []byte(`{"version": "1.0.0", "hook": {"path": "relative"}, "when": {"always": true}, "stages": ["prestart"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InjectHooks([]string{etc}); err == nil {
+		t.Errorf("unexpected success with invalid hook definition")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// mergePatch applies a JSON merge patch as described by RFC 7386
+// to the target document.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// ApplyMergePatch applies a JSON merge patch (RFC 7386) to the
+// runtime specification.
+func (c *Config) ApplyMergePatch(patch []byte) error {
+	var p interface{}
+
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return fmt.Errorf("failed to decode JSON patch: %s", err)
+	}
+	if _, ok := p.(map[string]interface{}); !ok {
+		return fmt.Errorf("JSON patch must be an object")
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+
+	b, err = json.Marshal(mergePatch(doc, p))
+	if err != nil {
+		return err
+	}
+
+	// reset spec in place to keep generator reference valid
+	c.Spec = specs.Spec{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return fmt.Errorf("patched specification is invalid: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	c := &Config{}
+	g := generate.Generator{Config: &c.Spec}
+	g.SetHostname("host")
+	g.SetProcessArgs([]string{"/bin/sh"})
+	g.AddAnnotation("remove", "me")
+
+	patch := `{"hostname": "patched", "annotations": {"remove": null, "add": "value"}, "process": {"noNewPrivileges": true}}`
+	if err := c.ApplyMergePatch([]byte(patch)); err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+
+	if c.Spec.Hostname != "patched" || g.Config.Hostname != "patched" {
+		t.Errorf("hostname not patched")
+	}
+	if _, ok := c.Spec.Annotations["remove"]; ok {
+		t.Errorf("annotation not removed")
+	}
+	if c.Spec.Annotations["add"] != "value" {
+		t.Errorf("annotation not added")
+	}
+	if !c.Spec.Process.NoNewPrivileges || len(c.Spec.Process.Args) != 1 {
+		t.Errorf("process not patched correctly: %+v", c.Spec.Process)
+	}
+
+	for _, p := range []string{`[]`, `{"hostname": 1}`, `not json`} {
+		c := &Config{Spec: specs.Spec{}}
+		if err := c.ApplyMergePatch([]byte(p)); err == nil {
+			t.Errorf("unexpected success with patch %s", p)
+		}
+	}
+}
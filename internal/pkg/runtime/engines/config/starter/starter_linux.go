@@ -17,11 +17,13 @@ import "C"
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"syscall"
 	"unsafe"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config/oci"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/util/capabilities"
 )
@@ -249,6 +251,8 @@ func (c *Config) SetNsFlagsFromSpec(namespaces []specs.LinuxNamespace) {
 				c.config.namespace.flags |= syscall.CLONE_NEWNS
 			case specs.CgroupNamespace:
 				c.config.namespace.flags |= 0x2000000
+			case oci.TimeNamespace:
+				c.config.namespace.flags |= 0x80
 			}
 		}
 	}
@@ -279,6 +283,8 @@ func (c *Config) SetNsPath(nstype specs.LinuxNamespaceType, path string) error {
 		C.memcpy(unsafe.Pointer(&c.config.namespace.mount[0]), cpath, size)
 	case specs.CgroupNamespace:
 		C.memcpy(unsafe.Pointer(&c.config.namespace.cgroup[0]), cpath, size)
+	case oci.TimeNamespace:
+		C.memcpy(unsafe.Pointer(&c.config.namespace.time[0]), cpath, size)
 	}
 
 	C.free(cpath)
@@ -313,6 +319,8 @@ func (c *Config) SetNsPathFromSpec(namespaces []specs.LinuxNamespace) error {
 				C.memcpy(unsafe.Pointer(&c.config.namespace.mount[0]), cpath, size)
 			case specs.CgroupNamespace:
 				C.memcpy(unsafe.Pointer(&c.config.namespace.cgroup[0]), cpath, size)
+			case oci.TimeNamespace:
+				C.memcpy(unsafe.Pointer(&c.config.namespace.time[0]), cpath, size)
 			}
 
 			C.free(cpath)
@@ -322,6 +330,34 @@ func (c *Config) SetNsPathFromSpec(namespaces []specs.LinuxNamespace) error {
 	return nil
 }
 
+// SetTimeOffsets sets the monotonic and boottime clocks offsets applied
+// to the created time namespace
+func (c *Config) SetTimeOffsets(offsets map[string]oci.LinuxTimeOffset) error {
+	clocks := make([]string, 0, len(offsets))
+	for clock := range offsets {
+		clocks = append(clocks, clock)
+	}
+	sort.Strings(clocks)
+
+	timeOffsets := ""
+	for _, clock := range clocks {
+		offset := offsets[clock]
+		timeOffsets += fmt.Sprintf("%s %d %d\n", clock, offset.Secs, offset.Nanosecs)
+	}
+
+	l := len(timeOffsets)
+	if l >= C.MAX_TIME_OFFSETS-1 {
+		return fmt.Errorf("time offsets too big")
+	}
+
+	if l > 0 {
+		cpath := unsafe.Pointer(C.CString(timeOffsets))
+		C.memcpy(unsafe.Pointer(&c.config.namespace.timeOffsets[0]), cpath, C.size_t(l))
+		C.free(cpath)
+	}
+	return nil
+}
+
 // SetCapabilities sets corresponding capability set identified by ctype
 // from a capability string list identified by ctype
 func (c *Config) SetCapabilities(ctype string, caps []string) {
@@ -0,0 +1,154 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// TmpfsPolicy provides a private tmpfs, optionally limited in size
+	TmpfsPolicy = "tmpfs"
+	// HostPolicy bind mounts the host directory
+	HostPolicy = "host"
+	// ScratchPolicy bind mounts a directory created in a job scratch path
+	ScratchPolicy = "scratch"
+)
+
+// TmpPaths lists container paths whose provisioning can be controlled
+// with a policy
+var TmpPaths = []string{"/tmp", "/var/tmp", "/dev/shm"}
+
+var tmpfsSize = regexp.MustCompile(`^[0-9]+[kKmMgG%]?$`)
+
+// TmpPolicy describes how a temporary directory is provided to a
+// container
+type TmpPolicy struct {
+	Type string
+	Size string
+	Path string
+}
+
+// ParseTmpPolicy parses a policy with the format tmpfs[:<size>], host
+// or scratch:<path>
+func ParseTmpPolicy(policy string) (*TmpPolicy, error) {
+	splitted := strings.SplitN(policy, ":", 2)
+	p := &TmpPolicy{Type: splitted[0]}
+
+	switch p.Type {
+	case TmpfsPolicy:
+		if len(splitted) == 2 {
+			if !tmpfsSize.MatchString(splitted[1]) {
+				return nil, fmt.Errorf("bad tmpfs size %q", splitted[1])
+			}
+			p.Size = splitted[1]
+		}
+	case HostPolicy:
+		if len(splitted) == 2 {
+			return nil, fmt.Errorf("host policy doesn't take argument")
+		}
+	case ScratchPolicy:
+		if len(splitted) != 2 || !filepath.IsAbs(splitted[1]) {
+			return nil, fmt.Errorf("scratch policy requires an absolute path")
+		}
+		p.Path = filepath.Clean(splitted[1])
+	default:
+		return nil, fmt.Errorf("unknown policy %q", p.Type)
+	}
+
+	return p, nil
+}
+
+// ParseTmpPolicies parses a list of <path>=<policy> and returns policies
+// indexed by container path, a policy overrides a previous one for the
+// same path
+func ParseTmpPolicies(policies []string) (map[string]*TmpPolicy, error) {
+	m := make(map[string]*TmpPolicy)
+
+	for _, policy := range policies {
+		splitted := strings.SplitN(policy, "=", 2)
+		if len(splitted) != 2 {
+			return nil, fmt.Errorf("policy %q is not in the <path>=<policy> format", policy)
+		}
+		path := filepath.Clean(splitted[0])
+
+		supported := false
+		for _, p := range TmpPaths {
+			if p == path {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return nil, fmt.Errorf("policy can't be applied to %s, supported paths are %s", path, strings.Join(TmpPaths, ", "))
+		}
+
+		p, err := ParseTmpPolicy(splitted[1])
+		if err != nil {
+			return nil, fmt.Errorf("bad policy for %s: %s", path, err)
+		}
+		m[path] = p
+	}
+
+	return m, nil
+}
+
+// String returns the policy string representation
+func (p *TmpPolicy) String() string {
+	switch {
+	case p.Size != "":
+		return p.Type + ":" + p.Size
+	case p.Path != "":
+		return p.Type + ":" + p.Path
+	}
+	return p.Type
+}
+
+// Source returns the host directory bound to dest for host and scratch
+// policies, scratch directories are named after dest like tmp, var_tmp
+// or dev_shm
+func (p *TmpPolicy) Source(dest string) string {
+	switch p.Type {
+	case HostPolicy:
+		return dest
+	case ScratchPolicy:
+		name := strings.Replace(strings.TrimPrefix(dest, "/"), "/", "_", -1)
+		return filepath.Join(p.Path, name)
+	}
+	return ""
+}
+
+// Options returns tmpfs mount options for tmpfs policy
+func (p *TmpPolicy) Options() string {
+	options := "mode=1777"
+	if p.Size != "" {
+		options += ",size=" + p.Size
+	}
+	return options
+}
+
+// Mount returns the OCI mount providing dest according to policy
+func (p *TmpPolicy) Mount(dest string) specs.Mount {
+	if p.Type == TmpfsPolicy {
+		return specs.Mount{
+			Destination: dest,
+			Type:        "tmpfs",
+			Source:      "tmpfs",
+			Options:     append([]string{"nosuid", "nodev"}, strings.Split(p.Options(), ",")...),
+		}
+	}
+	return specs.Mount{
+		Destination: dest,
+		Type:        "bind",
+		Source:      p.Source(dest),
+		Options:     []string{"rbind", "nosuid", "nodev"},
+	}
+}
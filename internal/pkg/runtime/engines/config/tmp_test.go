@@ -0,0 +1,62 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestParseTmpPolicies(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	policies, err := ParseTmpPolicies([]string{
+		"/tmp=tmpfs",
+		"/tmp=tmpfs:512m",
+		"/var/tmp=scratch:/scratch/job1/",
+		"/dev/shm=host",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tmp := policies["/tmp"]
+	if tmp.String() != "tmpfs:512m" || tmp.Options() != "mode=1777,size=512m" {
+		t.Errorf("unexpected /tmp policy %s (%s)", tmp, tmp.Options())
+	}
+	mnt := tmp.Mount("/tmp")
+	if mnt.Type != "tmpfs" || !reflect.DeepEqual(mnt.Options, []string{"nosuid", "nodev", "mode=1777", "size=512m"}) {
+		t.Errorf("unexpected /tmp mount %v", mnt)
+	}
+
+	vartmp := policies["/var/tmp"]
+	if vartmp.String() != "scratch:/scratch/job1" || vartmp.Source("/var/tmp") != "/scratch/job1/var_tmp" {
+		t.Errorf("unexpected /var/tmp policy %s (%s)", vartmp, vartmp.Source("/var/tmp"))
+	}
+
+	shm := policies["/dev/shm"]
+	if mnt := shm.Mount("/dev/shm"); mnt.Source != "/dev/shm" || mnt.Type != "bind" {
+		t.Errorf("unexpected /dev/shm mount %v", mnt)
+	}
+
+	bad := []string{
+		"/tmp",
+		"/opt=tmpfs",
+		"/tmp=tmpfs:big",
+		"/tmp=host:/tmp",
+		"/tmp=scratch",
+		"/tmp=scratch:relative",
+		"/tmp=ramfs",
+	}
+	for _, policy := range bad {
+		if _, err := ParseTmpPolicies([]string{policy}); err == nil {
+			t.Errorf("unexpected success with %q", policy)
+		}
+	}
+}
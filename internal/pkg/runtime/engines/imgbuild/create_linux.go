@@ -13,15 +13,21 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/build/copy"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
 	imgbuildConfig "github.com/sylabs/singularity/internal/pkg/runtime/engines/imgbuild/config"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/singularity/rpc/client"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/network"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
 )
 
 // CreateContainer creates a container
@@ -57,6 +63,13 @@ func (engine *EngineOperations) CreateContainer(pid int, rpcConn net.Conn) error
 	// sensible mount point options to avoid accidental system settings override
 	flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_NODEV | syscall.MS_RDONLY)
 
+	// mounts with submounts locked in a user namespace can only be
+	// bound recursively
+	kernelFlags := flags
+	if engine.userNamespace() {
+		kernelFlags |= syscall.MS_REC
+	}
+
 	sylog.Debugf("Mounting image directory %s\n", rootfs)
 	_, err = rpcOps.Mount(rootfs, sessionPath, "", syscall.MS_BIND, "errors=remount-ro")
 	if err != nil {
@@ -92,7 +105,7 @@ func (engine *EngineOperations) CreateContainer(pid int, rpcConn net.Conn) error
 
 	dest = filepath.Join(sessionPath, "proc")
 	sylog.Debugf("Mounting /proc at %s\n", dest)
-	_, err = rpcOps.Mount("/proc", dest, "", flags, "")
+	_, err = rpcOps.Mount("/proc", dest, "", kernelFlags, "")
 	if err != nil {
 		return fmt.Errorf("mount proc failed: %s", err)
 	}
@@ -103,7 +116,7 @@ func (engine *EngineOperations) CreateContainer(pid int, rpcConn net.Conn) error
 
 	dest = filepath.Join(sessionPath, "sys")
 	sylog.Debugf("Mounting /sys at %s\n", dest)
-	_, err = rpcOps.Mount("/sys", dest, "", flags, "")
+	_, err = rpcOps.Mount("/sys", dest, "", kernelFlags, "")
 	if err != nil {
 		return fmt.Errorf("mount sys failed: %s", err)
 	}
@@ -119,11 +132,15 @@ func (engine *EngineOperations) CreateContainer(pid int, rpcConn net.Conn) error
 		return fmt.Errorf("mount /dev failed: %s", err)
 	}
 
+	resolvConf := "/etc/resolv.conf"
+	if engine.EngineConfig.Opts.ResolvConf != "" {
+		resolvConf = engine.EngineConfig.Opts.ResolvConf
+	}
 	dest = filepath.Join(sessionPath, "etc", "resolv.conf")
-	sylog.Debugf("Mounting /etc/resolv.conf at %s\n", dest)
-	_, err = rpcOps.Mount("/etc/resolv.conf", dest, "", flags, "")
+	sylog.Debugf("Mounting %s at %s\n", resolvConf, dest)
+	_, err = rpcOps.Mount(resolvConf, dest, "", flags, "")
 	if err != nil {
-		return fmt.Errorf("mount /etc/resolv.conf failed: %s", err)
+		return fmt.Errorf("mount %s failed: %s", resolvConf, err)
 	}
 	_, err = rpcOps.Mount("", dest, "", syscall.MS_REMOUNT|flags, "")
 	if err != nil {
@@ -141,6 +158,23 @@ func (engine *EngineOperations) CreateContainer(pid int, rpcConn net.Conn) error
 		return fmt.Errorf("remount /etc/hosts failed: %s", err)
 	}
 
+	// mount points of secrets are created in the image by the build
+	// and removed once the engine exits
+	if engine.mountsSecrets() {
+		for id, src := range engine.EngineConfig.Opts.Secrets {
+			dest = filepath.Join(sessionPath, types.SecretsDir, id)
+			sylog.Debugf("Mounting secret %s at %s\n", id, dest)
+			_, err = rpcOps.Mount(src, dest, "", flags, "")
+			if err != nil {
+				return fmt.Errorf("mount of secret %s failed: %s", id, err)
+			}
+			_, err = rpcOps.Mount("", dest, "", syscall.MS_REMOUNT|flags, "")
+			if err != nil {
+				return fmt.Errorf("remount of secret %s failed: %s", id, err)
+			}
+		}
+	}
+
 	sylog.Debugf("Chdir into %s\n", sessionPath)
 	err = syscall.Chdir(sessionPath)
 	if err != nil {
@@ -163,6 +197,10 @@ func (engine *EngineOperations) CreateContainer(pid int, rpcConn net.Conn) error
 		}
 	}
 
+	if err := engine.setupNetwork(pid); err != nil {
+		return err
+	}
+
 	sylog.Debugf("Chdir into / to avoid errors\n")
 	err = syscall.Chdir("/")
 	if err != nil {
@@ -175,6 +213,50 @@ func (engine *EngineOperations) CreateContainer(pid int, rpcConn net.Conn) error
 	return nil
 }
 
+// setupNetwork configures the CNI networks requested for build scripts in
+// the network namespace of the container process pid, none only keeps the
+// loopback interface
+func (engine *EngineOperations) setupNetwork(pid int) error {
+	opts := engine.EngineConfig.Opts
+	if opts.HostNetwork() || opts.Network == "none" {
+		return nil
+	}
+
+	// hold a reference to container network namespace for cleanup
+	f, err := syscall.Open("/proc/"+strconv.Itoa(pid)+"/ns/net", os.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("can't open network namespace: %s", err)
+	}
+	nspath := fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), f)
+
+	fileConfig := &singularityConfig.FileConfig{}
+	if err := config.Parser(buildcfg.SYSCONFDIR+"/singularity/singularity.conf", fileConfig); err != nil {
+		return fmt.Errorf("unable to parse singularity.conf file: %s", err)
+	}
+	cniPath := &network.CNIPath{
+		Conf:   filepath.Join(buildcfg.SYSCONFDIR, "singularity", "network"),
+		Plugin: filepath.Join(buildcfg.LIBEXECDIR, "singularity", "cni"),
+	}
+	if fileConfig.CniConfPath != "" {
+		cniPath.Conf = fileConfig.CniConfPath
+	}
+	if fileConfig.CniPluginPath != "" {
+		cniPath.Plugin = fileConfig.CniPluginPath
+	}
+
+	sylog.Debugf("Adding %s networks to build container", opts.Network)
+	setup, err := network.NewSetup(strings.Split(opts.Network, ","), strconv.Itoa(pid), nspath, cniPath)
+	if err != nil {
+		return fmt.Errorf("%s", err)
+	}
+	setup.SetEnvPath("/bin:/sbin:/usr/bin:/usr/sbin")
+	if err := setup.AddNetworks(); err != nil {
+		return fmt.Errorf("%s", err)
+	}
+	engine.network = setup
+	return nil
+}
+
 func (engine *EngineOperations) copyFiles() error {
 	files := types.Files{}
 	for _, f := range engine.EngineConfig.Recipe.BuildData.Files {
@@ -204,35 +286,108 @@ func (engine *EngineOperations) copyFiles() error {
 	return nil
 }
 
+// bashOptions abort scripts run by bash on the first failing command,
+// unset variable or failing pipe element
+var bashOptions = []string{"-eEuo", "pipefail"}
+
+// bashTrap is prepended to the first line of scripts run by bash to
+// report the failing line without shifting line numbers
+const bashTrap = `trap 'echo "%%%s: command failed at line $LINENO with status $?" >&2' ERR; `
+
+// scriptCommand returns the command running the script of section name
+// and the script to pipe to it. Scripts are run by /bin/sh -ex with the
+// section arguments unless an interpreter is selected in the section
+// header with -i <interpreter> [interpreter arguments...].
+func scriptCommand(name string, s types.Script) (*exec.Cmd, string, error) {
+	// trim potential trailing comment from args
+	args := strings.Fields(strings.Split(s.Args, "#")[0])
+
+	if len(args) == 0 || args[0] != "-i" {
+		return exec.Command("/bin/sh", append([]string{"-ex"}, args...)...), s.Script, nil
+	}
+	if len(args) < 2 {
+		return nil, "", fmt.Errorf("missing interpreter after -i in %%%s section header", name)
+	}
+
+	interpreter := args[1]
+	args = args[2:]
+	script := s.Script
+	if filepath.Base(interpreter) == "bash" {
+		args = append(bashOptions, args...)
+		script = fmt.Sprintf(bashTrap, name) + script
+	}
+	sylog.Debugf("Running %%%s with interpreter %s %v", name, interpreter, args)
+
+	return exec.Command(interpreter, args...), script, nil
+}
+
 func (engine *EngineOperations) runScriptSection(name string, s types.Script, setEnv bool) {
-	args := []string{"-ex"}
-	// trim potential trailing comment from args and append to args list
-	args = append(args, strings.Fields(strings.Split(s.Args, "#")[0])...)
+	if err := engine.runScript(name, s, setEnv, 0); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+}
 
-	cmd := exec.Command("/bin/sh", args...)
+// runTestSection runs the %test script, it's run again up to TestRetries
+// times when it fails and each attempt is killed after TestTimeout
+func (engine *EngineOperations) runTestSection() error {
+	opts := engine.EngineConfig.Opts
+	test := engine.EngineConfig.Recipe.BuildData.Test
+
+	err := engine.runScript("test", test, false, opts.TestTimeout)
+	for retry := 1; err != nil && retry <= opts.TestRetries; retry++ {
+		sylog.Warningf("%s, retrying (%d/%d)", err, retry, opts.TestRetries)
+		err = engine.runScript("test", test, false, opts.TestTimeout)
+	}
+	return err
+}
+
+// runScript runs the script of section name, the script process group
+// is killed once timeout expired if it's not 0
+func (engine *EngineOperations) runScript(name string, s types.Script, setEnv bool, timeout time.Duration) error {
+	cmd, script, err := scriptCommand(name, s)
+	if err != nil {
+		return err
+	}
 	if setEnv {
 		cmd.Env = engine.EngineConfig.OciConfig.Process.Env
 	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	if timeout > 0 {
+		// the script and its children are killed together
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
-		sylog.Fatalf("while creating %s proc pipe: %v", name, err)
+		return fmt.Errorf("while creating %s proc pipe: %v", name, err)
 	}
 
 	sylog.Infof("Running %s scriptlet\n", name)
 	if err := cmd.Start(); err != nil {
-		sylog.Fatalf("failed to start %%%s proc: %v\n", name, err)
+		return fmt.Errorf("failed to start %%%s proc: %v", name, err)
+	}
+
+	var timedOut int32
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		})
+		defer timer.Stop()
 	}
 
 	// pipe in script
 	go func() {
 		defer stdin.Close()
-		io.WriteString(stdin, s.Script)
+		io.WriteString(stdin, script)
 	}()
 
 	if err := cmd.Wait(); err != nil {
-		sylog.Fatalf("%s proc: %v\n", name, err)
+		if atomic.LoadInt32(&timedOut) == 1 {
+			return fmt.Errorf("%s proc: killed after %s timeout", name, timeout)
+		}
+		return fmt.Errorf("%s proc: %v", name, err)
 	}
+	return nil
 }
@@ -0,0 +1,141 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package imgbuild
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	imgbuildConfig "github.com/sylabs/singularity/internal/pkg/runtime/engines/imgbuild/config"
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestRunTestSection(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "imgbuild-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		script   string
+		timeout  time.Duration
+		retries  int
+		attempts int
+		wantErr  bool
+	}{
+		{"Success", "true", 0, 0, 1, false},
+		{"Failure", "false", 0, 0, 1, true},
+		{"FailureRetried", "false", 0, 2, 3, true},
+		{"SuccessAfterRetry", "[ $(wc -l < %s) -ge 2 ]", 0, 3, 2, false},
+		{"Timeout", "sleep 10", 200 * time.Millisecond, 1, 2, true},
+		// children of the script are killed with it
+		{"TimeoutChild", "sleep 10 & wait", 200 * time.Millisecond, 0, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count := filepath.Join(dir, tt.name)
+			script := fmt.Sprintf("echo attempt >> %s\n", count)
+			if strings.Contains(tt.script, "%s") {
+				script += fmt.Sprintf(tt.script, count)
+			} else {
+				script += tt.script
+			}
+
+			engine := &EngineOperations{EngineConfig: &imgbuildConfig.EngineConfig{}}
+			engine.EngineConfig.Recipe.BuildData.Test.Script = script
+			engine.EngineConfig.Opts.TestTimeout = tt.timeout
+			engine.EngineConfig.Opts.TestRetries = tt.retries
+
+			start := time.Now()
+			err := engine.runTestSection()
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if tt.timeout > 0 && time.Since(start) > 5*time.Second {
+				t.Errorf("script not killed after %s timeout", tt.timeout)
+			}
+
+			b, err := ioutil.ReadFile(count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := strings.Count(string(b), "attempt"); n != tt.attempts {
+				t.Errorf("unexpected number of attempts: %d instead of %d", n, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestScriptCommand(t *testing.T) {
+	const script = "echo test\n"
+	trapped := fmt.Sprintf(bashTrap, "post") + script
+
+	tests := []struct {
+		name    string
+		args    string
+		cmd     []string
+		script  string
+		wantErr bool
+	}{
+		{"Default", "", []string{"/bin/sh", "-ex"}, script, false},
+		{"DefaultArgs", "-c /bin/bash", []string{"/bin/sh", "-ex", "-c", "/bin/bash"}, script, false},
+		{"Comment", "# comment", []string{"/bin/sh", "-ex"}, script, false},
+		{"Interpreter", "-i /usr/bin/python3 -u", []string{"/usr/bin/python3", "-u"}, script, false},
+		{"InterpreterComment", "-i /usr/bin/python3 # comment", []string{"/usr/bin/python3"}, script, false},
+		{"Bash", "-i /bin/bash", []string{"/bin/bash", "-eEuo", "pipefail"}, trapped, false},
+		{"BashArgs", "-i bash -x", []string{"bash", "-eEuo", "pipefail", "-x"}, trapped, false},
+		{"MissingInterpreter", "-i", nil, "", true},
+		{"MissingInterpreterComment", "-i #/bin/bash", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, s, err := scriptCommand("post", types.Script{Args: tt.args, Script: script})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(cmd.Args, tt.cmd) {
+				t.Errorf("unexpected command %v instead of %v", cmd.Args, tt.cmd)
+			}
+			if s != tt.script {
+				t.Errorf("unexpected script %q instead of %q", s, tt.script)
+			}
+		})
+	}
+
+	// bash options must not leak between calls
+	if _, _, err := scriptCommand("post", types.Script{Args: "-i bash -x"}); err != nil {
+		t.Fatal(err)
+	}
+	cmd, _, err := scriptCommand("post", types.Script{Args: "-i bash -v"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"bash", "-eEuo", "pipefail", "-v"}; !reflect.DeepEqual(cmd.Args, expected) {
+		t.Errorf("unexpected command %v instead of %v", cmd.Args, expected)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config/starter"
 	imgbuildConfig "github.com/sylabs/singularity/internal/pkg/runtime/engines/imgbuild/config"
+	"github.com/sylabs/singularity/pkg/network"
 	"github.com/sylabs/singularity/pkg/util/capabilities"
 )
 
@@ -22,6 +23,10 @@ import (
 type EngineOperations struct {
 	CommonConfig *config.Common               `json:"-"`
 	EngineConfig *imgbuildConfig.EngineConfig `json:"engineConfig"`
+
+	// network holds the CNI networks of build scripts, they are
+	// removed once the build container exits
+	network *network.Setup
 }
 
 // InitConfig initializes engines config internals
@@ -39,8 +44,8 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 	e.EngineConfig.OciConfig.SetProcessNoNewPrivileges(true)
 	starterConfig.SetNoNewPrivs(e.EngineConfig.OciConfig.Process.NoNewPrivileges)
 
-	if syscall.Getuid() != 0 {
-		return fmt.Errorf("unable to run imgbuild engine as non-root user")
+	if syscall.Getuid() != 0 && !e.userNamespace() {
+		return fmt.Errorf("unable to run imgbuild engine as non-root user without user namespace")
 	}
 
 	if starterConfig.GetIsSUID() {
@@ -51,8 +56,22 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 
 	e.EngineConfig.OciConfig.AddOrReplaceLinuxNamespace(specs.MountNamespace, "")
 
+	// build scripts get their own network, configured once the
+	// container is created
+	if !e.EngineConfig.Opts.HostNetwork() {
+		e.EngineConfig.OciConfig.AddOrReplaceLinuxNamespace(specs.NetworkNamespace, "")
+		starterConfig.SetBringLoopbackInterface(true)
+	}
+
 	if e.EngineConfig.OciConfig.Linux != nil {
 		starterConfig.SetNsFlagsFromSpec(e.EngineConfig.OciConfig.Linux.Namespaces)
+		// users are mapped to root in the user namespace
+		if err := starterConfig.AddUIDMappings(e.EngineConfig.OciConfig.Linux.UIDMappings); err != nil {
+			return err
+		}
+		if err := starterConfig.AddGIDMappings(e.EngineConfig.OciConfig.Linux.GIDMappings); err != nil {
+			return err
+		}
 	}
 	if e.EngineConfig.OciConfig.Process != nil && e.EngineConfig.OciConfig.Process.Capabilities != nil {
 		starterConfig.SetCapabilities(capabilities.Permitted, e.EngineConfig.OciConfig.Process.Capabilities.Permitted)
@@ -67,3 +86,16 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 
 	return nil
 }
+
+// userNamespace returns true if the build engine runs in a user namespace
+func (e *EngineOperations) userNamespace() bool {
+	if e.EngineConfig.OciConfig.Linux == nil {
+		return false
+	}
+	for _, ns := range e.EngineConfig.OciConfig.Linux.Namespaces {
+		if ns.Type == specs.UserNamespace {
+			return true
+		}
+	}
+	return false
+}
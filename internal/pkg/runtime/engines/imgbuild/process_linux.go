@@ -9,11 +9,14 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"syscall"
 
 	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/env"
+	"github.com/sylabs/singularity/pkg/build/types"
 )
 
 // StartProcess runs the %post script
@@ -27,10 +30,22 @@ func (e *EngineOperations) StartProcess(masterConn net.Conn) error {
 		e.runScriptSection("post", e.EngineConfig.Recipe.BuildData.Post, true)
 	}
 
+	// secrets are only available to %post
+	if e.mountsSecrets() {
+		for id := range e.EngineConfig.Opts.Secrets {
+			path := filepath.Join(types.SecretsDir, id)
+			if err := syscall.Unmount(path, syscall.MNT_DETACH); err != nil {
+				sylog.Fatalf("while unmounting secret %s: %s", id, err)
+			}
+		}
+	}
+
 	if e.EngineConfig.RunSection("test") {
 		if !e.EngineConfig.Opts.NoTest && e.EngineConfig.Recipe.BuildData.Test.Script != "" {
 			// Run %test script
-			e.runScriptSection("test", e.EngineConfig.Recipe.BuildData.Test, false)
+			if err := e.runTestSection(); err != nil {
+				sylog.Fatalf("%s", err)
+			}
 		}
 	}
 
@@ -60,8 +75,13 @@ func (e *EngineOperations) MonitorContainer(pid int, signals chan os.Signal) (sy
 	}
 }
 
-// CleanupContainer _
+// CleanupContainer removes the CNI networks of build scripts
 func (e *EngineOperations) CleanupContainer(fatal error, status syscall.WaitStatus) error {
+	if e.network != nil {
+		if err := e.network.DelNetworks(); err != nil {
+			sylog.Errorf("%s", err)
+		}
+	}
 	return nil
 }
 
@@ -70,6 +90,11 @@ func (e *EngineOperations) PostStartProcess(pid int) error {
 	return nil
 }
 
+// mountsSecrets returns true if secrets are mounted for the %post section
+func (e *EngineOperations) mountsSecrets() bool {
+	return len(e.EngineConfig.Opts.Secrets) > 0 && e.EngineConfig.RunSection("post") && e.EngineConfig.Recipe.BuildData.Post.Script != ""
+}
+
 func (e *EngineOperations) cleanEnv() {
 	generator := generate.Generator{Config: &e.EngineConfig.OciConfig.Spec}
 
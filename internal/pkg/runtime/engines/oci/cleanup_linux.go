@@ -6,18 +6,145 @@
 package oci
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"syscall"
+	"time"
 
+	"github.com/sylabs/singularity/internal/pkg/events"
 	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/exec"
+	ocibundle "github.com/sylabs/singularity/pkg/ocibundle/sif"
 	"github.com/sylabs/singularity/pkg/ociruntime"
 )
 
+// writeExitFile writes the container exit code into <containerID>.exitcode
+// file in the exit directory, and the container termination time in RFC 3339
+// format into <containerID>.finished file, which is written first. The files
+// modification time is also set to the termination time
+func (engine *EngineOperations) writeExitFile(exitDir string) error {
+	state := engine.EngineConfig.GetState()
+	if state.ExitCode == nil {
+		return fmt.Errorf("no exit code available")
+	}
+
+	finished := time.Now()
+	if state.FinishedAt != nil {
+		finished = time.Unix(0, *state.FinishedAt)
+	}
+
+	id := engine.CommonConfig.ContainerID
+	if err := writeExitDirFile(exitDir, id+".finished", finished.UTC().Format(time.RFC3339Nano), finished); err != nil {
+		return err
+	}
+	return writeExitDirFile(exitDir, id+".exitcode", strconv.Itoa(*state.ExitCode), finished)
+}
+
+// writeExitDirFile writes content into name file of the exit directory
+// through a temporary file, so exit file watchers never read a partially
+// written file
+func writeExitDirFile(exitDir, name, content string, mtime time.Time) error {
+	tmp, err := ioutil.TempFile(exitDir, ".exitcode-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chtimes(tmp.Name(), mtime, mtime); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(exitDir, name))
+}
+
+// stderrLogger opens the log file receiving the container standard
+// error, the container log unless a distinct path was given
+func stderrLogger(e *EngineConfig, containerID string) (*instance.Logger, error) {
+	path, format := e.GetStderrLogPath(), e.GetStderrLogFormat()
+	if path == "" {
+		path, format = e.GetLogPath(), ""
+	}
+	if format == "" {
+		format = e.GetLogFormat()
+	}
+	if path == "" {
+		dir, err := instance.GetDirPrivileged(containerID, instance.OciSubDir)
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, containerID+".log")
+	}
+
+	formatter, ok := instance.LogFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("log format %s is not supported", format)
+	}
+	return instance.NewLogger(path, formatter)
+}
+
+// PoststopHooks executes poststop hooks of the container with its final
+// state, hooks standard error is written to the container log. A failing
+// hook doesn't prevent the execution of the next ones, hooks errors are
+// returned.
+func PoststopHooks(e *EngineConfig, containerID string) []error {
+	hooks := e.OciConfig.Hooks
+	if hooks == nil || len(hooks.Poststop) == 0 {
+		return nil
+	}
+
+	state := e.State.State
+	state.Status = ociruntime.Stopped
+
+	logger, err := stderrLogger(e, containerID)
+	if err != nil {
+		sylog.Warningf("poststop hooks standard error won't be logged: %s", err)
+	} else {
+		defer logger.Close()
+	}
+
+	var errs []error
+
+	for _, h := range hooks.Poststop {
+		stderr := new(bytes.Buffer)
+		if err := exec.HookWithStderr(&h, &state, stderr); err != nil {
+			errs = append(errs, err)
+		}
+		if logger != nil && stderr.Len() > 0 {
+			logger.WriteLines("stderr", stderr.Bytes())
+		}
+	}
+	return errs
+}
+
 // CleanupContainer cleans up the container
 func (engine *EngineOperations) CleanupContainer(fatal error, status syscall.WaitStatus) error {
+	var oomKills uint64
+
+	defer engine.closeLoggers()
+
 	if engine.EngineConfig.Cgroups != nil {
+		if count, err := engine.EngineConfig.Cgroups.OOMKillCount(); err == nil {
+			oomKills = count
+		} else {
+			sylog.Debugf("Could not determine out of memory kills: %s", err)
+		}
 		engine.EngineConfig.Cgroups.Remove()
 	}
 
@@ -55,12 +182,30 @@ func (engine *EngineOperations) CleanupContainer(fatal error, status syscall.Wai
 		desc = fmt.Sprintf("exited with code %d", status.ExitStatus())
 	}
 
+	if oomKills > 0 {
+		if engine.EngineConfig.State.Annotations == nil {
+			engine.EngineConfig.State.Annotations = make(map[string]string)
+		}
+		engine.EngineConfig.State.Annotations[ociruntime.OOMKilledAnnotation] = strconv.FormatUint(oomKills, 10)
+		engine.recordEvent(events.OOM, fmt.Sprintf("%d processes killed", oomKills))
+		if fatal == nil {
+			desc = "killed by the out of memory killer"
+		}
+	}
+
 	engine.EngineConfig.State.ExitCode = &exitCode
 	engine.EngineConfig.State.ExitDesc = desc
 
 	if err := engine.updateState(ociruntime.Stopped); err != nil {
 		return err
 	}
+	engine.notifyWaiters()
+
+	if exitDir := engine.EngineConfig.GetExitDir(); exitDir != "" {
+		if err := engine.writeExitFile(exitDir); err != nil {
+			sylog.Warningf("failed to write exit code file: %s", err)
+		}
+	}
 
 	if engine.EngineConfig.State.AttachSocket != "" {
 		os.Remove(engine.EngineConfig.State.AttachSocket)
@@ -69,5 +214,54 @@ func (engine *EngineOperations) CleanupContainer(fatal error, status syscall.Wai
 		os.Remove(engine.EngineConfig.State.ControlSocket)
 	}
 
+	if engine.EngineConfig.GetAutoRemove() {
+		engine.autoRemove()
+	}
+
 	return nil
 }
+
+// closeLoggers closes the container log files
+func (engine *EngineOperations) closeLoggers() {
+	if engine.errLogger != nil && engine.errLogger != engine.logger {
+		if err := engine.errLogger.Close(); err != nil {
+			sylog.Warningf("failed to close standard error log: %s", err)
+		}
+	}
+	if engine.logger != nil {
+		if err := engine.logger.Close(); err != nil {
+			sylog.Warningf("failed to close log: %s", err)
+		}
+	}
+}
+
+// autoRemove executes poststop hooks, as there is no delete for auto
+// removed containers, and deletes instance files of the stopped container
+// and its bundle if it was created from an image
+func (engine *EngineOperations) autoRemove() {
+	name := engine.CommonConfig.ContainerID
+
+	for _, err := range PoststopHooks(engine.EngineConfig, name) {
+		sylog.Warningf("poststop hook: %s", err)
+	}
+
+	file, err := instance.Get(name, instance.OciSubDir)
+	if err != nil {
+		sylog.Warningf("no instance files found for %s: %s", name, err)
+		return
+	}
+	if err := file.Delete(); err != nil {
+		sylog.Warningf("failed to delete instance files: %s", err)
+	}
+
+	if engine.EngineConfig.GetImageBundle() {
+		bundle := engine.EngineConfig.GetBundlePath()
+		d, err := ocibundle.FromSif("", bundle, true)
+		if err == nil {
+			err = d.Delete()
+		}
+		if err != nil {
+			sylog.Warningf("failed to delete bundle %s: %s", bundle, err)
+		}
+	}
+}
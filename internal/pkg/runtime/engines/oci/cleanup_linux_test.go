@@ -0,0 +1,158 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config/oci"
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+func TestPoststopHooks(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "poststop-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "container.log")
+	statePath := filepath.Join(dir, "state.json")
+
+	e := NewConfig()
+	e.SetLogPath(logPath)
+	e.SetLogFormat(instance.BasicLogFormat)
+	e.State.ID = "poststop"
+	e.State.Status = ociruntime.Running
+	e.OciConfig = &oci.Config{
+		Spec: specs.Spec{
+			Hooks: &specs.Hooks{
+				Poststop: []specs.Hook{
+					{Path: "/bin/sh", Args: []string{"sh", "-c", "echo first failed >&2; exit 1"}},
+					{Path: "/bin/sh", Args: []string{"sh", "-c", "cat > " + statePath}},
+				},
+			},
+		},
+	}
+
+	// no hooks
+	if errs := PoststopHooks(NewConfig(), "poststop"); len(errs) != 0 {
+		t.Errorf("unexpected errors without hooks: %v", errs)
+	}
+
+	errs := PoststopHooks(e, "poststop")
+	if len(errs) != 1 {
+		t.Fatalf("unexpected errors %v, expected the first hook failure", errs)
+	}
+
+	// the next hook is executed with the final state
+	data, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		t.Fatalf("second hook wasn't executed: %s", err)
+	}
+	var state specs.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("failed to decode state: %s", err)
+	}
+	if state.ID != "poststop" || state.Status != ociruntime.Stopped {
+		t.Errorf("unexpected state %+v", state)
+	}
+	if e.State.Status != ociruntime.Running {
+		t.Errorf("container state modified to %s", e.State.Status)
+	}
+
+	// hooks standard error goes to the container log
+	data, err = ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log: %s", err)
+	}
+	if !strings.Contains(string(data), "first failed") {
+		t.Errorf("hook standard error not logged: %q", data)
+	}
+
+	// or to the distinct standard error log
+	stderrLogPath := filepath.Join(dir, "stderr.log")
+	e.SetStderrLogPath(stderrLogPath)
+	PoststopHooks(e, "poststop")
+
+	data, err = ioutil.ReadFile(stderrLogPath)
+	if err != nil {
+		t.Fatalf("failed to read standard error log: %s", err)
+	}
+	if !strings.Contains(string(data), "first failed") {
+		t.Errorf("hook standard error not logged: %q", data)
+	}
+}
+
+func TestWriteExitFile(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "exit-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	engine := &EngineOperations{
+		CommonConfig: &config.Common{ContainerID: "exited"},
+		EngineConfig: NewConfig(),
+	}
+
+	if err := engine.writeExitFile(dir); err == nil {
+		t.Errorf("unexpected success without exit code")
+	}
+
+	exitCode := 137
+	finished := time.Date(2019, 6, 1, 12, 30, 15, 500, time.UTC)
+	finishedAt := finished.UnixNano()
+	engine.EngineConfig.State.ExitCode = &exitCode
+	engine.EngineConfig.State.FinishedAt = &finishedAt
+
+	if err := engine.writeExitFile(dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for name, expected := range map[string]string{
+		"exited.exitcode": "137",
+		"exited.finished": "2019-06-01T12:30:15.0000005Z",
+	} {
+		path := filepath.Join(dir, name)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s not written: %s", name, err)
+		}
+		if string(data) != expected {
+			t.Errorf("unexpected %s content %q, expected %q", name, data, expected)
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(finished) {
+			t.Errorf("unexpected %s modification time %s", name, fi.ModTime())
+		}
+	}
+
+	// only the exit files are left in the exit directory
+	if entries, err := ioutil.ReadDir(dir); err != nil || len(entries) != 2 {
+		t.Errorf("unexpected exit directory entries %v (%v)", entries, err)
+	}
+}
@@ -18,22 +18,33 @@ const Name = "oci"
 
 // EngineConfig is the config for the OCI engine.
 type EngineConfig struct {
-	BundlePath    string           `json:"bundlePath"`
-	LogPath       string           `json:"logPath"`
-	LogFormat     string           `json:"logFormat"`
-	PidFile       string           `json:"pidFile"`
-	OciConfig     *oci.Config      `json:"ociConfig"`
-	State         ociruntime.State `json:"state"`
-	MasterPts     int              `json:"masterPts"`
-	SlavePts      int              `json:"slavePts"`
-	OutputStreams [2]int           `json:"outputStreams"`
-	ErrorStreams  [2]int           `json:"errorStreams"`
-	InputStreams  [2]int           `json:"inputStreams"`
-	SyncSocket    string           `json:"syncSocket"`
-	EmptyProcess  bool             `json:"emptyProcess"`
-	Exec          bool             `json:"exec"`
-	Cgroups       *cgroups.Manager `json:"-"`
-	sync.Mutex    `json:"-"`
+	BundlePath      string           `json:"bundlePath"`
+	LogPath         string           `json:"logPath"`
+	LogFormat       string           `json:"logFormat"`
+	StderrLogPath   string           `json:"stderrLogPath,omitempty"`
+	StderrLogFormat string           `json:"stderrLogFormat,omitempty"`
+	PidFile         string           `json:"pidFile"`
+	ExitDir         string           `json:"exitDir,omitempty"`
+	SocketGroup     string           `json:"socketGroup,omitempty"`
+	SocketMode      uint32           `json:"socketMode,omitempty"`
+	SocketSecret    string           `json:"socketSecret,omitempty"`
+	TmpPolicy       []string         `json:"tmpPolicy,omitempty"`
+	ImageBundle     bool             `json:"imageBundle,omitempty"`
+	AutoRemove      bool             `json:"autoRemove,omitempty"`
+	StopSignal      string           `json:"stopSignal,omitempty"`
+	StopTimeout     int              `json:"stopTimeout,omitempty"`
+	OciConfig       *oci.Config      `json:"ociConfig"`
+	State           ociruntime.State `json:"state"`
+	MasterPts       int              `json:"masterPts"`
+	SlavePts        int              `json:"slavePts"`
+	OutputStreams   [2]int           `json:"outputStreams"`
+	ErrorStreams    [2]int           `json:"errorStreams"`
+	InputStreams    [2]int           `json:"inputStreams"`
+	SyncSocket      string           `json:"syncSocket"`
+	EmptyProcess    bool             `json:"emptyProcess"`
+	Exec            bool             `json:"exec"`
+	Cgroups         *cgroups.Manager `json:"-"`
+	sync.Mutex      `json:"-"`
 }
 
 // NewConfig returns an oci.EngineConfig.
@@ -87,6 +98,28 @@ func (e *EngineConfig) GetLogFormat() string {
 	return e.LogFormat
 }
 
+// SetStderrLogPath sets the container standard error log path,
+// if empty standard error is logged along standard output.
+func (e *EngineConfig) SetStderrLogPath(path string) {
+	e.StderrLogPath = path
+}
+
+// GetStderrLogPath returns the container standard error log path.
+func (e *EngineConfig) GetStderrLogPath() string {
+	return e.StderrLogPath
+}
+
+// SetStderrLogFormat sets the container standard error log format,
+// if empty the container log format is used.
+func (e *EngineConfig) SetStderrLogFormat(format string) {
+	e.StderrLogFormat = format
+}
+
+// GetStderrLogFormat returns the container standard error log format.
+func (e *EngineConfig) GetStderrLogFormat() string {
+	return e.StderrLogFormat
+}
+
 // SetPidFile sets the pid file path.
 func (e *EngineConfig) SetPidFile(path string) {
 	e.PidFile = path
@@ -96,3 +129,107 @@ func (e *EngineConfig) SetPidFile(path string) {
 func (e *EngineConfig) GetPidFile() string {
 	return e.PidFile
 }
+
+// SetExitDir sets the directory where the container exit code
+// file is written.
+func (e *EngineConfig) SetExitDir(path string) {
+	e.ExitDir = path
+}
+
+// GetExitDir returns the directory where the container exit code
+// file is written.
+func (e *EngineConfig) GetExitDir() string {
+	return e.ExitDir
+}
+
+// SetSocketGroup sets the group name or ID owning the attach and
+// control sockets.
+func (e *EngineConfig) SetSocketGroup(group string) {
+	e.SocketGroup = group
+}
+
+// GetSocketGroup returns the group name or ID owning the attach
+// and control sockets.
+func (e *EngineConfig) GetSocketGroup() string {
+	return e.SocketGroup
+}
+
+// SetSocketMode sets the attach and control sockets permission
+// bits, if zero sockets are only accessible by owner.
+func (e *EngineConfig) SetSocketMode(mode uint32) {
+	e.SocketMode = mode
+}
+
+// GetSocketMode returns the attach and control sockets permission
+// bits.
+func (e *EngineConfig) GetSocketMode() uint32 {
+	return e.SocketMode
+}
+
+// SetSocketSecret sets the path of the file containing the secret
+// clients must send before using attach and control sockets.
+func (e *EngineConfig) SetSocketSecret(path string) {
+	e.SocketSecret = path
+}
+
+// GetSocketSecret returns the path of the file containing the
+// attach and control sockets shared secret.
+func (e *EngineConfig) GetSocketSecret() string {
+	return e.SocketSecret
+}
+
+// SetTmpPolicy sets the list of <path>=<policy> applied to /tmp,
+// /var/tmp and /dev/shm.
+func (e *EngineConfig) SetTmpPolicy(policies []string) {
+	e.TmpPolicy = policies
+}
+
+// GetTmpPolicy returns the list of <path>=<policy> applied to /tmp,
+// /var/tmp and /dev/shm.
+func (e *EngineConfig) GetTmpPolicy() []string {
+	return e.TmpPolicy
+}
+
+// SetImageBundle sets if the bundle was created from an image, it's
+// then deleted along with the container.
+func (e *EngineConfig) SetImageBundle(imageBundle bool) {
+	e.ImageBundle = imageBundle
+}
+
+// GetImageBundle returns if the bundle was created from an image.
+func (e *EngineConfig) GetImageBundle() bool {
+	return e.ImageBundle
+}
+
+// SetAutoRemove sets if the container is deleted by the engine as
+// soon as it stops.
+func (e *EngineConfig) SetAutoRemove(autoRemove bool) {
+	e.AutoRemove = autoRemove
+}
+
+// GetAutoRemove returns if the container is deleted when it stops.
+func (e *EngineConfig) GetAutoRemove() bool {
+	return e.AutoRemove
+}
+
+// SetStopSignal sets the signal sent by kill when no signal is given.
+func (e *EngineConfig) SetStopSignal(sig string) {
+	e.StopSignal = sig
+}
+
+// GetStopSignal returns the signal sent by kill when no signal is given.
+func (e *EngineConfig) GetStopSignal() string {
+	return e.StopSignal
+}
+
+// SetStopTimeout sets the grace period in seconds before kill sends
+// SIGKILL when no timeout is given.
+func (e *EngineConfig) SetStopTimeout(timeout int) {
+	e.StopTimeout = timeout
+}
+
+// GetStopTimeout returns the grace period in seconds before kill sends
+// SIGKILL when no timeout is given.
+func (e *EngineConfig) GetStopTimeout() int {
+	return e.StopTimeout
+}
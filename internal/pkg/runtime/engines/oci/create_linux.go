@@ -24,11 +24,15 @@ import (
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/cgroups"
+	"github.com/sylabs/singularity/internal/pkg/events"
 	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config/oci"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/oci/rpc/client"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
+	"github.com/sylabs/singularity/internal/pkg/util/retry"
 	"github.com/sylabs/singularity/pkg/util/fs/proc"
 )
 
@@ -174,6 +178,16 @@ func (engine *EngineOperations) createState(pid int) error {
 	file.PPid = os.Getpid()
 	file.Image = filepath.Join(engine.EngineConfig.GetBundlePath(), engine.EngineConfig.OciConfig.Root.Path)
 
+	policies, err := config.ParseTmpPolicies(engine.EngineConfig.GetTmpPolicy())
+	if err != nil {
+		return err
+	}
+	for path, p := range policies {
+		file.SetTmpPolicy(path, p.String())
+	}
+	file.StopSignal = engine.EngineConfig.GetStopSignal()
+	file.StopTimeout = engine.EngineConfig.GetStopTimeout()
+
 	if err := file.Update(); err != nil {
 		return err
 	}
@@ -192,6 +206,18 @@ func (engine *EngineOperations) createState(pid int) error {
 	return nil
 }
 
+// recordEvent records a container lifecycle event in the events journal
+func (engine *EngineOperations) recordEvent(t events.Type, details string) {
+	events.Record(&events.Event{
+		Type:    t,
+		Kind:    events.KindOci,
+		ID:      engine.CommonConfig.ContainerID,
+		Pid:     engine.EngineConfig.State.Pid,
+		Image:   engine.EngineConfig.GetBundlePath(),
+		Details: details,
+	})
+}
+
 func (engine *EngineOperations) updateState(status string) error {
 	engine.EngineConfig.Lock()
 	defer engine.EngineConfig.Unlock()
@@ -233,6 +259,15 @@ func (engine *EngineOperations) updateState(status string) error {
 		return err
 	}
 
+	switch {
+	case status == ociruntime.Created:
+		engine.recordEvent(events.Create, "")
+	case status == ociruntime.Running && oldStatus == ociruntime.Created:
+		engine.recordEvent(events.Start, "")
+	case status == ociruntime.Stopped:
+		engine.recordEvent(events.Stop, engine.EngineConfig.State.ExitDesc)
+	}
+
 	socketPath := engine.EngineConfig.SyncSocket
 
 	if socketPath != "" {
@@ -410,6 +445,7 @@ func (engine *EngineOperations) CreateContainer(pid int, rpcConn net.Conn) error
 		{"cgroup", specs.CgroupNamespace, false},
 		{"net", specs.NetworkNamespace, false},
 		{"user", specs.UserNamespace, true},
+		{"time", oci.TimeNamespace, false},
 	}
 
 	path := fmt.Sprintf("/proc/%d/ns", pid)
@@ -487,7 +523,10 @@ func (c *container) addCgroups(pid int, system *mount.System) error {
 
 	manager := &cgroups.Manager{Path: cgroupsPath, Pid: pid}
 
-	if err := manager.ApplyFromSpec(c.engine.EngineConfig.OciConfig.Linux.Resources); err != nil {
+	err := retry.DefaultPolicy.Do("cgroups setup", func() error {
+		return manager.ApplyFromSpec(c.engine.EngineConfig.OciConfig.Linux.Resources)
+	})
+	if err != nil {
 		return fmt.Errorf("Failed to apply cgroups resources restriction: %s", err)
 	}
 
@@ -6,6 +6,10 @@
 package oci
 
 import (
+	"net"
+	"sync"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
 )
 
@@ -13,6 +17,20 @@ import (
 type EngineOperations struct {
 	CommonConfig *config.Common `json:"-"`
 	EngineConfig *EngineConfig  `json:"engineConfig"`
+
+	// socketSecret is the secret clients must send before
+	// using attach and control sockets
+	socketSecret []byte
+	// logger logs container standard output and errLogger its
+	// standard error, they are the same unless a distinct
+	// standard error log is requested
+	logger    *instance.Logger
+	errLogger *instance.Logger
+	// waiters are control connections waiting for the container
+	// exit, stopped is set once they were notified
+	waitersMutex sync.Mutex
+	waiters      []net.Conn
+	stopped      bool
 }
 
 // InitConfig stores the pointer to config.Common
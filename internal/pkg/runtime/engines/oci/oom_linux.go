@@ -0,0 +1,32 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"fmt"
+
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// watchOOM writes out of memory kills occurring in the container
+// cgroup to the container log
+func (engine *EngineOperations) watchOOM(logger *instance.Logger) {
+	if engine.EngineConfig.Cgroups == nil {
+		return
+	}
+	events, err := engine.EngineConfig.Cgroups.OOMEvents()
+	if err != nil {
+		sylog.Debugf("Out of memory events not available: %s", err)
+		return
+	}
+	go func() {
+		for count := range events {
+			msg := fmt.Sprintf("container process killed by the out of memory killer (%d kills so far)", count)
+			logger.WriteLines("stderr", []byte(msg))
+		}
+	}()
+}
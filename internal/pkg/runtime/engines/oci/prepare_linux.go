@@ -72,6 +72,18 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		return fmt.Errorf("empty OCI linux configuration")
 	}
 
+	e.EngineConfig.OciConfig.Spec.Mounts = dedupeMounts(e.EngineConfig.OciConfig.Spec.Mounts)
+
+	if err := ValidateSpec(&e.EngineConfig.OciConfig.Spec, e.EngineConfig.GetBundlePath()); err != nil {
+		return err
+	}
+	// exec joins the container time namespace, offsets are already applied
+	if !e.EngineConfig.Exec {
+		if err := validateTimeOffsets(e.EngineConfig.OciConfig.TimeOffsets, e.EngineConfig.OciConfig.Linux.Namespaces); err != nil {
+			return err
+		}
+	}
+
 	// reset state config that could be passed to engine
 	e.EngineConfig.State = ociruntime.State{}
 
@@ -105,6 +117,9 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 	if err := starterConfig.SetNsPathFromSpec(e.EngineConfig.OciConfig.Linux.Namespaces); err != nil {
 		return err
 	}
+	if err := starterConfig.SetTimeOffsets(e.EngineConfig.OciConfig.TimeOffsets); err != nil {
+		return err
+	}
 
 	if userNS {
 		if len(e.EngineConfig.OciConfig.Linux.UIDMappings) == 0 {
@@ -17,7 +17,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/sylabs/singularity/pkg/util/copy"
 
@@ -30,6 +32,7 @@ import (
 
 	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/util/exec"
+	"github.com/sylabs/singularity/internal/pkg/util/user"
 
 	"github.com/sylabs/singularity/internal/pkg/security"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
@@ -226,6 +229,10 @@ func (engine *EngineOperations) PreStartProcess(pid int, masterConn net.Conn, fa
 		return err
 	}
 
+	if err := engine.setSocketsPermissions(filepath.Dir(file.Path)); err != nil {
+		return err
+	}
+
 	logPath := engine.EngineConfig.GetLogPath()
 	if logPath == "" {
 		containerID := engine.CommonConfig.ContainerID
@@ -247,6 +254,29 @@ func (engine *EngineOperations) PreStartProcess(pid int, masterConn net.Conn, fa
 		return err
 	}
 
+	// standard error is logged along standard output unless
+	// a distinct log path has been requested
+	errLogger := logger
+
+	if stderrLogPath := engine.EngineConfig.GetStderrLogPath(); stderrLogPath != "" {
+		stderrFormat := engine.EngineConfig.GetStderrLogFormat()
+		if stderrFormat == "" {
+			stderrFormat = format
+		}
+		stderrFormatter, ok := instance.LogFormats[stderrFormat]
+		if !ok {
+			return fmt.Errorf("log format %s is not supported", stderrFormat)
+		}
+		errLogger, err = instance.NewLogger(stderrLogPath, stderrFormatter)
+		if err != nil {
+			return err
+		}
+	}
+
+	engine.logger = logger
+	engine.errLogger = errLogger
+	engine.watchOOM(errLogger)
+
 	pidFile := engine.EngineConfig.GetPidFile()
 	if pidFile != "" {
 		if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(pid)), 0644); err != nil {
@@ -260,7 +290,7 @@ func (engine *EngineOperations) PreStartProcess(pid int, masterConn net.Conn, fa
 
 	start := make(chan bool, 1)
 
-	go engine.handleControl(masterConn, attach, control, logger, start, fatalChan)
+	go engine.handleControl(masterConn, attach, control, logger, errLogger, start, fatalChan)
 
 	hooks := engine.EngineConfig.OciConfig.Hooks
 	if hooks != nil {
@@ -298,7 +328,81 @@ func (engine *EngineOperations) PostStartProcess(pid int) error {
 	return nil
 }
 
-func (engine *EngineOperations) handleStream(l net.Listener, logger *instance.Logger, fatalChan chan error) {
+// setSocketsPermissions applies the requested group ownership and
+// permission bits to the attach and control sockets and loads the
+// shared secret if any
+func (engine *EngineOperations) setSocketsPermissions(dir string) error {
+	sockets := []string{
+		engine.EngineConfig.State.AttachSocket,
+		engine.EngineConfig.State.ControlSocket,
+	}
+
+	if group := engine.EngineConfig.GetSocketGroup(); group != "" {
+		var gid int
+
+		if id, err := strconv.ParseUint(group, 10, 32); err == nil {
+			gid = int(id)
+		} else {
+			gr, err := user.GetGrNam(group)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve group %s: %s", group, err)
+			}
+			gid = int(gr.GID)
+		}
+
+		for _, path := range sockets {
+			if err := os.Lchown(path, -1, gid); err != nil {
+				return fmt.Errorf("failed to change %s group: %s", path, err)
+			}
+		}
+
+		// allow group members to reach sockets in container directory
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if err := os.Chown(dir, -1, gid); err != nil {
+			return fmt.Errorf("failed to change %s group: %s", dir, err)
+		}
+		if err := os.Chmod(dir, fi.Mode().Perm()|0010); err != nil {
+			return fmt.Errorf("failed to change %s permissions: %s", dir, err)
+		}
+	}
+
+	if mode := engine.EngineConfig.GetSocketMode(); mode != 0 {
+		for _, path := range sockets {
+			if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+				return fmt.Errorf("failed to change %s permissions: %s", path, err)
+			}
+		}
+	}
+
+	if path := engine.EngineConfig.GetSocketSecret(); path != "" {
+		secret, err := unix.ReadSecretFile(path)
+		if err != nil {
+			return err
+		}
+		engine.socketSecret = secret
+	}
+
+	return nil
+}
+
+// checkSecret returns if the client connected with c sent the shared
+// secret, connection is closed otherwise
+func (engine *EngineOperations) checkSecret(c net.Conn) bool {
+	if engine.socketSecret == nil {
+		return true
+	}
+	if err := unix.CheckSecret(c, engine.socketSecret, 5*time.Second); err != nil {
+		sylog.Warningf("rejected socket connection: %s", err)
+		c.Close()
+		return false
+	}
+	return true
+}
+
+func (engine *EngineOperations) handleStream(l net.Listener, logger *instance.Logger, errLogger *instance.Logger, fatalChan chan error) {
 	var stdout io.ReadWriteCloser
 	var stderr io.ReadCloser
 	var stdin io.WriteCloser
@@ -331,7 +435,7 @@ func (engine *EngineOperations) handleStream(l net.Listener, logger *instance.Lo
 
 	if stderr != nil {
 		errorWriters = &copy.MultiWriter{}
-		errorWriters.Add(logger.NewWriter("stderr", true))
+		errorWriters.Add(errLogger.NewWriter("stderr", true))
 		errorWriters.Add(os.Stderr)
 	}
 
@@ -344,6 +448,10 @@ func (engine *EngineOperations) handleStream(l net.Listener, logger *instance.Lo
 			}
 
 			go func() {
+				if !engine.checkSecret(c) {
+					return
+				}
+
 				outputWriters.Add(c)
 				if stderr != nil {
 					errorWriters.Add(c)
@@ -383,31 +491,59 @@ func (engine *EngineOperations) handleStream(l net.Listener, logger *instance.Lo
 	}
 }
 
-func (engine *EngineOperations) handleControl(masterConn net.Conn, attach net.Listener, control net.Listener, logger *instance.Logger, start chan bool, fatalChan chan error) {
+func (engine *EngineOperations) handleControl(masterConn net.Conn, attach net.Listener, control net.Listener, logger *instance.Logger, errLogger *instance.Logger, start chan bool, fatalChan chan error) {
 	var master *os.File
+	var mutex sync.Mutex
 	started := false
 
 	if engine.EngineConfig.OciConfig.Process.Terminal {
 		master = os.NewFile(uintptr(engine.EngineConfig.MasterPts), "control-master-pts")
 	}
 
-	for {
-		c, err := control.Accept()
-		if err != nil {
-			fatalChan <- err
+	// each connection is handled in its own goroutine, like attach
+	// connections, so a client slow to send the secret or its message
+	// doesn't block the others
+	handle := func(c net.Conn) {
+		if !engine.checkSecret(c) {
 			return
 		}
 		dec := json.NewDecoder(c)
 		ctrl := &ociruntime.Control{}
 		if err := dec.Decode(ctrl); err != nil {
-			fatalChan <- err
+			// don't let a bad client stop the container
+			sylog.Warningf("failed to decode control message: %s", err)
+			c.Close()
 			return
 		}
 
+		if ctrl.Version > ociruntime.ControlVersion {
+			sylog.Debugf("Control message version %d is newer than %d, unknown operations are ignored", ctrl.Version, ociruntime.ControlVersion)
+		}
+		if ctrl.Hello {
+			info := &ociruntime.ControlInfo{
+				Version:      ociruntime.ControlVersion,
+				Capabilities: ociruntime.ControlCapabilities,
+			}
+			if err := json.NewEncoder(c).Encode(info); err != nil {
+				sylog.Warningf("failed to send control protocol information: %s", err)
+			}
+			c.Close()
+			return
+		}
+		if ctrl.Wait {
+			// connection is closed once the container exit code is sent
+			engine.addWaiter(c)
+			return
+		}
+
+		// operations changing the container state are serialized
+		mutex.Lock()
+		defer mutex.Unlock()
+
 		if ctrl.StartContainer && !started {
 			started = true
 
-			engine.handleStream(attach, logger, fatalChan)
+			engine.handleStream(attach, logger, errLogger, fatalChan)
 
 			// since container process block on read, send it an
 			// ACK so when it will receive data, the container
@@ -435,6 +571,9 @@ func (engine *EngineOperations) handleControl(masterConn net.Conn, attach net.Li
 		}
 		if ctrl.ReopenLog {
 			logger.ReOpenFile()
+			if errLogger != logger {
+				errLogger.ReOpenFile()
+			}
 		}
 		if ctrl.Pause {
 			if err := engine.EngineConfig.Cgroups.Pause(); err != nil {
@@ -459,4 +598,13 @@ func (engine *EngineOperations) handleControl(masterConn net.Conn, attach net.Li
 
 		c.Close()
 	}
+
+	for {
+		c, err := control.Accept()
+		if err != nil {
+			fatalChan <- err
+			return
+		}
+		go handle(c)
+	}
 }
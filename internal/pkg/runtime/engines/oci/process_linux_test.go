@@ -0,0 +1,162 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/instance"
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+	"github.com/sylabs/singularity/pkg/util/unix"
+)
+
+func TestHandleControlConcurrent(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "control-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "control.sock")
+	control, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := &EngineOperations{EngineConfig: NewConfig(), socketSecret: []byte("secret")}
+	engine.EngineConfig.OciConfig.Process = &specs.Process{}
+
+	fatalChan := make(chan error, 1)
+	go engine.handleControl(nil, nil, control, nil, nil, nil, fatalChan)
+
+	// a client which never sends the secret
+	idle, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := unix.SendSecret(c, engine.socketSecret); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(c).Encode(&ociruntime.Control{Hello: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the idle client is rejected after 5 seconds, the reply must
+	// not wait for it
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	info := &ociruntime.ControlInfo{}
+	if err := json.NewDecoder(c).Decode(info); err != nil {
+		t.Fatalf("no control information received: %s", err)
+	}
+	if info.Version != ociruntime.ControlVersion {
+		t.Errorf("unexpected control version %d", info.Version)
+	}
+
+	control.Close()
+	if err := <-fatalChan; err == nil {
+		t.Errorf("unexpected nil error once the control socket is closed")
+	}
+}
+
+// waitLog waits until the log file at path contains s
+func waitLog(path string, s string) bool {
+	for i := 0; i < 50; i++ {
+		if data, _ := ioutil.ReadFile(path); strings.Contains(string(data), s) {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+func TestHandleStreamSplitStderr(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "stream-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "container.log")
+	stderrLogPath := filepath.Join(dir, "stderr.log")
+
+	logger, err := instance.NewLogger(logPath, instance.LogFormats[instance.BasicLogFormat])
+	if err != nil {
+		t.Fatal(err)
+	}
+	errLogger, err := instance.NewLogger(stderrLogPath, instance.LogFormats[instance.BasicLogFormat])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pipes [3][2]*os.File
+	for i := range pipes {
+		if pipes[i][0], pipes[i][1], err = os.Pipe(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stdout, stderr, stdin := pipes[0][1], pipes[1][1], pipes[2][0]
+	defer stdin.Close()
+
+	engine := &EngineOperations{EngineConfig: NewConfig(), logger: logger, errLogger: errLogger}
+	engine.EngineConfig.OciConfig.Process = &specs.Process{}
+	engine.EngineConfig.OutputStreams = [2]int{int(pipes[0][0].Fd()), -1}
+	engine.EngineConfig.ErrorStreams = [2]int{int(pipes[1][0].Fd()), -1}
+	engine.EngineConfig.InputStreams = [2]int{int(pipes[2][1].Fd()), -1}
+
+	attach, err := net.Listen("unix", filepath.Join(dir, "attach.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer attach.Close()
+
+	engine.handleStream(attach, logger, errLogger, make(chan error, 1))
+
+	stdout.WriteString("output line\n")
+	stderr.WriteString("error line\n")
+	stdout.Close()
+	stderr.Close()
+
+	if !waitLog(logPath, "output line") {
+		t.Errorf("standard output not logged in %s", logPath)
+	}
+	if !waitLog(stderrLogPath, "error line") {
+		t.Errorf("standard error not logged in %s", stderrLogPath)
+	}
+	if data, _ := ioutil.ReadFile(logPath); strings.Contains(string(data), "error line") {
+		t.Errorf("standard error logged in %s: %q", logPath, data)
+	}
+
+	// the log files are closed with the container
+	engine.closeLoggers()
+	errLogger.WriteLines("stderr", []byte("after close"))
+	if data, _ := ioutil.ReadFile(stderrLogPath); strings.Contains(string(data), "after close") {
+		t.Errorf("standard error log not closed")
+	}
+}
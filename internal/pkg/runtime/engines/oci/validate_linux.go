@@ -0,0 +1,305 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/hashicorp/go-multierror"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/validate"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config/oci"
+	"github.com/sylabs/singularity/pkg/util/rlimit"
+)
+
+// native seccomp architecture for the running binary
+var seccompNativeArch = map[string]specs.Arch{
+	"386":      specs.ArchX86,
+	"amd64":    specs.ArchX86_64,
+	"arm":      specs.ArchARM,
+	"arm64":    specs.ArchAARCH64,
+	"mips":     specs.ArchMIPS,
+	"mips64":   specs.ArchMIPS64,
+	"mipsle":   specs.ArchMIPSEL,
+	"mips64le": specs.ArchMIPSEL64,
+	"ppc64":    specs.ArchPPC64,
+	"ppc64le":  specs.ArchPPC64LE,
+	"s390x":    specs.ArchS390X,
+}
+
+var seccompArchs = map[specs.Arch]bool{
+	specs.ArchX86:         true,
+	specs.ArchX86_64:      true,
+	specs.ArchX32:         true,
+	specs.ArchARM:         true,
+	specs.ArchAARCH64:     true,
+	specs.ArchMIPS:        true,
+	specs.ArchMIPS64:      true,
+	specs.ArchMIPS64N32:   true,
+	specs.ArchMIPSEL:      true,
+	specs.ArchMIPSEL64:    true,
+	specs.ArchMIPSEL64N32: true,
+	specs.ArchPPC:         true,
+	specs.ArchPPC64:       true,
+	specs.ArchPPC64LE:     true,
+	specs.ArchS390:        true,
+	specs.ArchS390X:       true,
+}
+
+// namespace names as found in /proc/self/ns
+var nsProcName = map[specs.LinuxNamespaceType]string{
+	specs.PIDNamespace:     "pid",
+	specs.UTSNamespace:     "uts",
+	specs.IPCNamespace:     "ipc",
+	specs.MountNamespace:   "mnt",
+	specs.CgroupNamespace:  "cgroup",
+	specs.NetworkNamespace: "net",
+	specs.UserNamespace:    "user",
+	oci.TimeNamespace:      "time",
+}
+
+// SpecError describes a problem found in an OCI runtime specification
+// field, Field is empty for problems reported by the opencontainers
+// validation rules.
+type SpecError struct {
+	Field string
+	Err   error
+}
+
+func (e SpecError) Error() string {
+	if e.Field == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Err)
+}
+
+// SpecErrors holds all problems found by a validation pass.
+type SpecErrors []SpecError
+
+func (e SpecErrors) Error() string {
+	s := "invalid OCI runtime specification:"
+	for _, err := range e {
+		s += "\n\t" + err.Error()
+	}
+	return s
+}
+
+func (e *SpecErrors) add(field string, format string, a ...interface{}) {
+	*e = append(*e, SpecError{Field: field, Err: fmt.Errorf(format, a...)})
+}
+
+// ValidateSpec checks the OCI runtime specification of bundle against
+// the opencontainers validation rules and the engine requirements, all
+// problems are returned at once as SpecErrors.
+func ValidateSpec(spec *specs.Spec, bundle string) error {
+	var errs SpecErrors
+
+	v, err := validate.NewValidator(spec, bundle, true, runtime.GOOS)
+	if err != nil {
+		return err
+	}
+
+	add := func(err error) {
+		if merr, ok := err.(*multierror.Error); ok {
+			for _, e := range merr.Errors {
+				errs = append(errs, SpecError{Err: e})
+			}
+		} else if err != nil {
+			errs = append(errs, SpecError{Err: err})
+		}
+	}
+
+	// validation of remaining fields requires a root
+	add(v.CheckRoot())
+	if spec.Root != nil {
+		add(v.CheckMandatoryFields())
+		// validator semver check only accepts its own spec version
+		if ver, err := semver.Parse(spec.Version); err != nil {
+			errs.add("ociVersion", "%q is not a valid SemVer: %s", spec.Version, err)
+		} else if ver.Major != 1 {
+			errs.add("ociVersion", "%q is not supported, major version must be 1", spec.Version)
+		}
+		add(v.CheckMounts())
+		add(v.CheckProcess())
+		add(v.CheckLinux())
+		add(v.CheckHooks())
+		add(v.CheckAnnotations())
+	}
+
+	if err := validateSpec(spec); err != nil {
+		errs = append(errs, err.(SpecErrors)...)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateSpec checks the OCI runtime specification fields the engine
+// relies on and returns all problems at once as SpecErrors.
+func validateSpec(spec *specs.Spec) error {
+	var errs SpecErrors
+
+	if spec.Process != nil {
+		for i, rl := range spec.Process.Rlimits {
+			if _, _, err := rlimit.Get(rl.Type); err != nil {
+				errs.add(fmt.Sprintf("process.rlimits[%d].type", i), "unknown resource limit %q", rl.Type)
+			}
+			if rl.Soft > rl.Hard {
+				errs.add(fmt.Sprintf("process.rlimits[%d]", i), "soft limit %d is greater than hard limit %d", rl.Soft, rl.Hard)
+			}
+		}
+	}
+
+	if spec.Linux != nil {
+		validateNamespaces(spec.Linux.Namespaces, &errs)
+
+		if p := spec.Linux.CgroupsPath; p != "" {
+			for _, elem := range strings.Split(p, "/") {
+				if elem == ".." {
+					errs.add("linux.cgroupsPath", "path %q must not contain '..' elements", p)
+					break
+				}
+			}
+		}
+
+		if seccomp := spec.Linux.Seccomp; seccomp != nil && len(seccomp.Architectures) > 0 {
+			native, hasNative := seccompNativeArch[runtime.GOARCH]
+			covered := false
+			for i, arch := range seccomp.Architectures {
+				if !seccompArchs[arch] {
+					errs.add(fmt.Sprintf("linux.seccomp.architectures[%d]", i), "unknown architecture %q", arch)
+				}
+				if arch == native {
+					covered = true
+				}
+			}
+			if hasNative && !covered {
+				errs.add("linux.seccomp.architectures", "native architecture %s is not covered by the seccomp profile", native)
+			}
+		}
+	}
+
+	destinations := make(map[string]int)
+	for i, m := range spec.Mounts {
+		field := fmt.Sprintf("mounts[%d].destination", i)
+		if m.Destination == "" {
+			errs.add(field, "empty mount destination")
+			continue
+		}
+		dest := filepath.Clean(m.Destination)
+		if j, ok := destinations[dest]; ok {
+			errs.add(field, "destination %s collides with mounts[%d]", m.Destination, j)
+			continue
+		}
+		destinations[dest] = i
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// dedupeMounts drops mounts identical to a previous one, only the first
+// occurrence is kept, mounts sharing a destination with different
+// settings are left for validateSpec to report
+func dedupeMounts(mounts []specs.Mount) []specs.Mount {
+	deduped := make([]specs.Mount, 0, len(mounts))
+
+	for _, m := range mounts {
+		duplicate := false
+		for _, d := range deduped {
+			if sameMount(m, d) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			deduped = append(deduped, m)
+		}
+	}
+	return deduped
+}
+
+func sameMount(a, b specs.Mount) bool {
+	if filepath.Clean(a.Destination) != filepath.Clean(b.Destination) {
+		return false
+	}
+	if a.Type != b.Type || a.Source != b.Source || len(a.Options) != len(b.Options) {
+		return false
+	}
+	for i := range a.Options {
+		if a.Options[i] != b.Options[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func validateNamespaces(namespaces []specs.LinuxNamespace, errs *SpecErrors) {
+	seen := make(map[specs.LinuxNamespaceType]int)
+
+	for i, ns := range namespaces {
+		field := fmt.Sprintf("linux.namespaces[%d]", i)
+
+		name, ok := nsProcName[ns.Type]
+		if !ok {
+			errs.add(field+".type", "unknown namespace type %q", ns.Type)
+			continue
+		}
+		if j, ok := seen[ns.Type]; ok {
+			errs.add(field+".type", "%s namespace already defined by linux.namespaces[%d]", ns.Type, j)
+			continue
+		}
+		seen[ns.Type] = i
+
+		if _, err := os.Stat(filepath.Join("/proc/self/ns", name)); os.IsNotExist(err) {
+			errs.add(field+".type", "%s namespace is not supported by the kernel", ns.Type)
+		}
+	}
+}
+
+// validateTimeOffsets checks the clock offsets of the time namespace,
+// they can only be applied to a time namespace created for container
+func validateTimeOffsets(offsets map[string]oci.LinuxTimeOffset, namespaces []specs.LinuxNamespace) error {
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	var errs SpecErrors
+
+	created := false
+	for _, ns := range namespaces {
+		if ns.Type == oci.TimeNamespace && ns.Path == "" {
+			created = true
+		}
+	}
+	if !created {
+		errs.add("linux.timeOffsets", "time offsets require a new time namespace")
+	}
+
+	for clock, offset := range offsets {
+		field := fmt.Sprintf("linux.timeOffsets.%s", clock)
+		if clock != "monotonic" && clock != "boottime" {
+			errs.add(field, "unknown clock %q, must be monotonic or boottime", clock)
+		}
+		if offset.Nanosecs >= 1000000000 {
+			errs.add(field+".nanosecs", "%d is out of range", offset.Nanosecs)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config/oci"
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestValidateSpec(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	valid := &specs.Spec{
+		Process: &specs.Process{
+			Rlimits: []specs.POSIXRlimit{
+				{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 1024},
+			},
+		},
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.PIDNamespace},
+				{Type: specs.MountNamespace},
+			},
+			CgroupsPath: "/singularity/test",
+		},
+		Mounts: []specs.Mount{
+			{Destination: "/proc"},
+			{Destination: "/dev"},
+		},
+	}
+	if err := validateSpec(valid); err != nil {
+		t.Errorf("unexpected validation failure: %s", err)
+	}
+
+	invalid := &specs.Spec{
+		Process: &specs.Process{
+			Rlimits: []specs.POSIXRlimit{
+				{Type: "RLIMIT_FOO"},
+				{Type: "RLIMIT_NOFILE", Soft: 2048, Hard: 1024},
+			},
+		},
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.PIDNamespace},
+				{Type: specs.PIDNamespace},
+				{Type: "foo"},
+			},
+			CgroupsPath: "../escape",
+			Seccomp: &specs.LinuxSeccomp{
+				Architectures: []specs.Arch{"SCMP_ARCH_FOO"},
+			},
+		},
+		Mounts: []specs.Mount{
+			{Destination: "/proc"},
+			{Destination: "/proc/", Source: "/proc"},
+			{Destination: ""},
+		},
+	}
+
+	err := validateSpec(invalid)
+	errs, ok := err.(SpecErrors)
+	if !ok {
+		t.Fatalf("unexpected error type returned: %v", err)
+	}
+
+	expected := map[string]bool{
+		"process.rlimits[0].type":        true,
+		"process.rlimits[1]":             true,
+		"linux.namespaces[1].type":       true,
+		"linux.namespaces[2].type":       true,
+		"linux.cgroupsPath":              true,
+		"linux.seccomp.architectures[0]": true,
+		"linux.seccomp.architectures":    true,
+		"mounts[1].destination":          true,
+		"mounts[2].destination":          true,
+	}
+	for _, e := range errs {
+		if !expected[e.Field] {
+			t.Errorf("unexpected error for field %s: %s", e.Field, e.Err)
+		}
+		delete(expected, e.Field)
+	}
+	for field := range expected {
+		t.Errorf("no error reported for field %s", field)
+	}
+}
+
+func TestDedupeMounts(t *testing.T) {
+	mounts := []specs.Mount{
+		{Destination: "/proc", Type: "proc", Source: "proc"},
+		{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid"}},
+		{Destination: "/proc/", Type: "proc", Source: "proc"},
+		{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid"}},
+		{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"noexec"}},
+	}
+
+	deduped := dedupeMounts(mounts)
+	if len(deduped) != 3 {
+		t.Fatalf("unexpected number of mounts: %d instead of 3", len(deduped))
+	}
+	for i, j := range []int{0, 1, 4} {
+		if !sameMount(deduped[i], mounts[j]) {
+			t.Errorf("unexpected mount at index %d: %+v", i, deduped[i])
+		}
+	}
+	if err := validateSpec(&specs.Spec{Mounts: deduped[:2]}); err != nil {
+		t.Errorf("unexpected validation failure: %s", err)
+	}
+}
+
+func TestValidateSpecBundle(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	bundle, err := ioutil.TempDir("", "bundle-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bundle)
+
+	if err := os.Mkdir(filepath.Join(bundle, "rootfs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := generate.New("linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetRootPath("rootfs")
+
+	if err := ValidateSpec(g.Config, bundle); err != nil {
+		t.Errorf("unexpected validation failure: %s", err)
+	}
+
+	// problems found by the opencontainers rules and the engine
+	// checks are reported together
+	g.SetProcessCwd("relative")
+	g.Config.Version = "2.0.0"
+	g.Config.Mounts = append(g.Config.Mounts, g.Config.Mounts[0])
+
+	err = ValidateSpec(g.Config, bundle)
+	errs, ok := err.(SpecErrors)
+	if !ok {
+		t.Fatalf("unexpected error type returned: %v", err)
+	}
+
+	fields := make(map[string]bool)
+	for _, e := range errs {
+		fields[e.Field] = true
+	}
+	for _, field := range []string{"", "ociVersion", "mounts[" + strconv.Itoa(len(g.Config.Mounts)-1) + "].destination"} {
+		if !fields[field] {
+			t.Errorf("no error reported for field %q in %s", field, errs)
+		}
+	}
+
+	// a missing root is reported
+	g.SetRootPath("missing")
+	if err := ValidateSpec(g.Config, bundle); err == nil {
+		t.Errorf("unexpected success with a missing root")
+	}
+}
+
+func TestValidateTimeOffsets(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	created := []specs.LinuxNamespace{{Type: oci.TimeNamespace}}
+	joined := []specs.LinuxNamespace{{Type: oci.TimeNamespace, Path: "/proc/1/ns/time"}}
+
+	valid := map[string]oci.LinuxTimeOffset{
+		"monotonic": {Secs: 3600},
+		"boottime":  {Secs: -60, Nanosecs: 999999999},
+	}
+	if err := validateTimeOffsets(valid, created); err != nil {
+		t.Errorf("unexpected validation failure: %s", err)
+	}
+	if err := validateTimeOffsets(nil, joined); err != nil {
+		t.Errorf("unexpected validation failure: %s", err)
+	}
+	if err := validateTimeOffsets(valid, joined); err == nil {
+		t.Errorf("offsets accepted for a joined time namespace")
+	}
+
+	invalid := map[string]oci.LinuxTimeOffset{
+		"realtime": {Secs: 1},
+		"boottime": {Nanosecs: 1000000000},
+	}
+	err := validateTimeOffsets(invalid, created)
+	errs, ok := err.(SpecErrors)
+	if !ok {
+		t.Fatalf("unexpected error type returned: %v", err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected 2 errors, got %d: %s", len(errs), errs)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"encoding/json"
+	"net"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+// sendExit sends the container exit code to a waiting control connection
+// and closes it
+func (engine *EngineOperations) sendExit(c net.Conn) {
+	defer c.Close()
+
+	state := engine.EngineConfig.GetState()
+	exit := &ociruntime.ControlExit{ExitDesc: state.ExitDesc}
+	if state.ExitCode != nil {
+		exit.ExitCode = *state.ExitCode
+	}
+	if err := json.NewEncoder(c).Encode(exit); err != nil {
+		sylog.Warningf("failed to send container exit code: %s", err)
+	}
+}
+
+// addWaiter registers a control connection waiting for the container
+// exit, it's notified right away if the container already stopped
+func (engine *EngineOperations) addWaiter(c net.Conn) {
+	engine.waitersMutex.Lock()
+	defer engine.waitersMutex.Unlock()
+
+	if engine.stopped {
+		engine.sendExit(c)
+		return
+	}
+	engine.waiters = append(engine.waiters, c)
+}
+
+// notifyWaiters sends the container exit code to waiting control
+// connections, it must be called once the stopped state is written
+func (engine *EngineOperations) notifyWaiters() {
+	engine.waitersMutex.Lock()
+	defer engine.waitersMutex.Unlock()
+
+	engine.stopped = true
+	for _, c := range engine.waiters {
+		engine.sendExit(c)
+	}
+	engine.waiters = nil
+}
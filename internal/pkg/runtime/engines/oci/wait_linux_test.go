@@ -0,0 +1,70 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"encoding/json"
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/ociruntime"
+)
+
+// waitExit registers a waiter and returns a channel receiving the exit
+// code sent by the engine
+func waitExit(t *testing.T, engine *EngineOperations) <-chan ociruntime.ControlExit {
+	server, client := net.Pipe()
+	exits := make(chan ociruntime.ControlExit, 1)
+
+	go func() {
+		var exit ociruntime.ControlExit
+		if err := json.NewDecoder(client).Decode(&exit); err != nil {
+			t.Errorf("failed to decode exit code: %s", err)
+		}
+		client.Close()
+		exits <- exit
+	}()
+
+	// addWaiter replies right away once the container is stopped
+	go engine.addWaiter(server)
+	return exits
+}
+
+func TestWaiters(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	engine := &EngineOperations{EngineConfig: NewConfig()}
+
+	exits := waitExit(t, engine)
+
+	exitCode := 3
+	engine.EngineConfig.State.ExitCode = &exitCode
+	engine.EngineConfig.State.ExitDesc = "exited with code 3"
+
+	// let the waiter be registered before the container stops
+	for {
+		engine.waitersMutex.Lock()
+		n := len(engine.waiters)
+		engine.waitersMutex.Unlock()
+		if n == 1 {
+			break
+		}
+		runtime.Gosched()
+	}
+	engine.notifyWaiters()
+
+	if exit := <-exits; exit.ExitCode != exitCode || exit.ExitDesc != "exited with code 3" {
+		t.Errorf("unexpected exit %+v sent to waiter", exit)
+	}
+
+	// waiters registered after the container stopped
+	if exit := <-waitExit(t, engine); exit.ExitCode != exitCode {
+		t.Errorf("unexpected exit code %d sent to late waiter", exit.ExitCode)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
+)
+
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+	// cgroup2SuperMagic is the filesystem type of a cgroup v2 hierarchy
+	cgroup2SuperMagic = 0x63677270
+)
+
+// cgroupHierarchy describes a cgroup hierarchy mounted below cgroupRoot
+// and the cgroup of a process in this hierarchy
+type cgroupHierarchy struct {
+	dir  string
+	path string
+}
+
+// cgroupHierarchies returns the cgroup hierarchies listed in the cgroup
+// file of a process, the cgroup v2 hierarchy of hybrid systems is
+// mounted in the unified directory like systemd does
+func cgroupHierarchies(path string) ([]cgroupHierarchy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hierarchies []cgroupHierarchy
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		controllers := fields[1]
+		cgroup := filepath.Clean("/" + fields[2])
+
+		switch {
+		case controllers == "":
+			hierarchies = append(hierarchies, cgroupHierarchy{"unified", cgroup})
+		case strings.HasPrefix(controllers, "name="):
+			hierarchies = append(hierarchies, cgroupHierarchy{strings.TrimPrefix(controllers, "name="), cgroup})
+		default:
+			hierarchies = append(hierarchies, cgroupHierarchy{controllers, cgroup})
+		}
+	}
+	return hierarchies, scanner.Err()
+}
+
+// addCgroupMount mounts the container cgroup subtree of each cgroup
+// hierarchy read-only in /sys/fs/cgroup when a cgroup namespace is
+// requested. The container joins its cgroup before the mounts are set
+// and creates the namespace once they are done, the host hierarchies
+// are bound as the mount process isn't in the namespace.
+func (c *container) addCgroupMount(system *mount.System) error {
+	if !c.cgroupNS {
+		return nil
+	}
+	if !c.engine.EngineConfig.File.MountSys {
+		sylog.Verbosef("Skipping %s mount, /sys is not mounted", cgroupRoot)
+		return nil
+	}
+
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+	bindFlags := flags | syscall.MS_BIND | syscall.MS_RDONLY
+
+	hierarchies, err := cgroupHierarchies(c.cgroupInfoPath)
+	if err != nil {
+		return fmt.Errorf("could not determine container cgroups: %s", err)
+	}
+
+	st := &syscall.Statfs_t{}
+	if err := syscall.Statfs(cgroupRoot, st); err != nil {
+		return fmt.Errorf("could not determine %s filesystem type: %s", cgroupRoot, err)
+	}
+	if st.Type == cgroup2SuperMagic {
+		if len(hierarchies) != 1 {
+			return fmt.Errorf("unexpected cgroup hierarchies %v on a cgroup v2 system", hierarchies)
+		}
+		source := filepath.Join(cgroupRoot, hierarchies[0].path)
+		if err := system.Points.AddBind(mount.KernelTag, source, cgroupRoot, bindFlags); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", source, err)
+		}
+		if err := system.Points.AddRemount(mount.KernelTag, cgroupRoot, bindFlags); err != nil {
+			return fmt.Errorf("unable to add %s to remount list: %s", cgroupRoot, err)
+		}
+		sylog.Verbosef("Default mount: cgroup2:%s", cgroupRoot)
+		return nil
+	}
+
+	// hierarchies are mounted on a tmpfs where their mount points are
+	// created once kernel filesystems are mounted, it's remounted
+	// read-only at the end
+	if err := system.Points.AddFS(mount.KernelTag, cgroupRoot, "tmpfs", flags, "mode=755"); err != nil {
+		return fmt.Errorf("unable to add %s to mount list: %s", cgroupRoot, err)
+	}
+	for _, h := range hierarchies {
+		source := filepath.Join(cgroupRoot, h.dir, h.path)
+		dest := filepath.Join(cgroupRoot, h.dir)
+		if err := system.Points.AddBind(mount.OtherTag, source, dest, bindFlags); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", source, err)
+		}
+		if err := system.Points.AddRemount(mount.OtherTag, dest, bindFlags); err != nil {
+			return fmt.Errorf("unable to add %s to remount list: %s", dest, err)
+		}
+	}
+	if err := system.Points.AddRemount(mount.FinalTag, cgroupRoot, flags|syscall.MS_RDONLY); err != nil {
+		return fmt.Errorf("unable to add %s to remount list: %s", cgroupRoot, err)
+	}
+
+	createDirs := func(*mount.System) error {
+		for _, h := range hierarchies {
+			dir := filepath.Join(c.session.FinalPath(), cgroupRoot, h.dir)
+			if _, err := c.rpcOps.Mkdir(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create %s directory: %s", dir, err)
+			}
+		}
+		return nil
+	}
+	if err := system.RunAfterTag(mount.KernelTag, createDirs); err != nil {
+		return err
+	}
+
+	sylog.Verbosef("Default mount: cgroup:%s", cgroupRoot)
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCgroupHierarchies(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []cgroupHierarchy
+	}{
+		{
+			"cgroup v2",
+			"0::/singularity/1234\n",
+			[]cgroupHierarchy{{"unified", "/singularity/1234"}},
+		},
+		{
+			"hybrid",
+			"12:cpu,cpuacct:/singularity/1234\n1:name=systemd:/user.slice/session-1.scope\n0::/user.slice/session-1.scope\n",
+			[]cgroupHierarchy{
+				{"cpu,cpuacct", "/singularity/1234"},
+				{"systemd", "/user.slice/session-1.scope"},
+				{"unified", "/user.slice/session-1.scope"},
+			},
+		},
+		{
+			"escaping path",
+			"0::/../../etc\n",
+			[]cgroupHierarchy{{"unified", "/etc"}},
+		},
+	}
+
+	for _, tt := range tests {
+		f, err := ioutil.TempFile("", "cgroup-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(tt.content)
+		f.Close()
+
+		hierarchies, err := cgroupHierarchies(f.Name())
+		os.Remove(f.Name())
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if !reflect.DeepEqual(hierarchies, tt.expected) {
+			t.Errorf("%s: unexpected hierarchies %v", tt.name, hierarchies)
+		}
+	}
+}
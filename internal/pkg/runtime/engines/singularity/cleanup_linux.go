@@ -8,12 +8,17 @@ package singularity
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"syscall"
 
 	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
 
+	"github.com/sylabs/singularity/internal/pkg/events"
 	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/krb5"
+	"github.com/sylabs/singularity/pkg/util/fs/lock"
 )
 
 /*
@@ -21,6 +26,44 @@ import (
  * we will run step 8/9 there
  */
 
+// exitDetails describes how the container process exited
+func exitDetails(fatal error, status syscall.WaitStatus) string {
+	if fatal != nil {
+		return fatal.Error()
+	} else if status.Signaled() {
+		return fmt.Sprintf("killed by signal %s", status.Signal())
+	}
+	return fmt.Sprintf("exit code %d", status.ExitStatus())
+}
+
+// instanceHooks returns the hooks set with instance start --notify-url
+// and --notify-exec
+func (engine *EngineOperations) instanceHooks() *events.Hooks {
+	return &events.Hooks{
+		URLs:     engine.EngineConfig.GetNotifyURLs(),
+		Commands: engine.EngineConfig.GetNotifyCommands(),
+	}
+}
+
+// releaseStagedImage unregisters the container as user of the shared
+// staged image and removes the image if it was the last one
+func (engine *EngineOperations) releaseStagedImage(user string) {
+	image := engine.EngineConfig.GetImage()
+
+	fd, err := lock.Exclusive(filepath.Dir(image))
+	if err != nil {
+		sylog.Errorf("failed to lock stage directory of %s: %s", image, err)
+		return
+	}
+	defer lock.Release(fd)
+
+	if removed, err := fs.RemoveStageUser(image, user); err != nil {
+		sylog.Errorf("failed to release staged image %s: %s", image, err)
+	} else if removed {
+		sylog.Verbosef("Removed staged image %s", image)
+	}
+}
+
 // CleanupContainer cleans up the container
 func (engine *EngineOperations) CleanupContainer(fatal error, status syscall.WaitStatus) error {
 	sylog.Debugf("Cleanup container")
@@ -34,18 +77,54 @@ func (engine *EngineOperations) CleanupContainer(fatal error, status syscall.Wai
 		}
 	}
 
+	if user := engine.EngineConfig.GetStageUser(); user != "" {
+		engine.releaseStagedImage(user)
+	}
+
+	if dir := engine.EngineConfig.GetAutoScratch(); dir != "" {
+		sylog.Verbosef("Removing scratch directory %s", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			sylog.Errorf("failed to delete scratch directory %s: %s", dir, err)
+		}
+	}
+
+	if engine.EngineConfig.GetKrb5CCacheTemp() {
+		cache := krb5.ParseCache(engine.EngineConfig.GetKrb5CCache())
+		sylog.Verbosef("Removing Kerberos credential cache %s", cache.Residual)
+		if err := os.Remove(cache.Residual); err != nil && !os.IsNotExist(err) {
+			sylog.Errorf("failed to delete Kerberos credential cache %s: %s", cache.Residual, err)
+		}
+	}
+
 	if engine.EngineConfig.Network != nil {
 		if err := engine.EngineConfig.Network.DelNetworks(); err != nil {
 			sylog.Errorf("%s", err)
 		}
 	}
 
+	engine.cleanupNotifySocket()
+
+	// resource usage is only known once the container process is reaped
+	var rusage *rusageSummary
+	if engine.EngineConfig.GetRusage() && fatal == nil && !engine.EngineConfig.GetInstance() {
+		rusage = engine.newRusageSummary()
+	}
+
 	if engine.EngineConfig.Cgroups != nil {
+		engine.checkOOM()
 		if err := engine.EngineConfig.Cgroups.Remove(); err != nil {
 			sylog.Errorf("%s", err)
 		}
 	}
 
+	if rusage != nil {
+		engine.reportRusage(rusage)
+	}
+
+	if engine.observer != nil {
+		engine.reportObserver()
+	}
+
 	if engine.EngineConfig.GetInstance() {
 		uid := os.Getuid()
 
@@ -58,6 +137,20 @@ func (engine *EngineOperations) CleanupContainer(fatal error, status syscall.Wai
 			return nil
 		}
 
+		hooks := engine.instanceHooks()
+		if engine.oomKilled {
+			e := &events.Event{Type: events.OOM, Kind: events.KindInstance, ID: file.Name, Pid: file.Pid, Image: file.Image}
+			events.Record(e)
+			hooks.Fire(e)
+		}
+		details := exitDetails(fatal, status)
+		if engine.timedOut {
+			details = fmt.Sprintf("stopped after %s timeout, %s", engine.EngineConfig.GetTimeout(), details)
+		}
+		e := &events.Event{Type: events.Stop, Kind: events.KindInstance, ID: file.Name, Pid: file.Pid, Image: file.Image, Details: details}
+		events.Record(e)
+		hooks.Fire(e)
+
 		if file.Privileged {
 			var err error
 
@@ -19,14 +19,17 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sylabs/singularity/internal/pkg/buildcfg"
 	"github.com/sylabs/singularity/internal/pkg/cgroups"
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/singularity/rpc/client"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/errctx"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/files"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/layout"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/layout/layer/overlay"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/layout/layer/underlay"
 	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
+	"github.com/sylabs/singularity/internal/pkg/util/retry"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/network"
@@ -39,6 +42,10 @@ import (
 // defaultCNIConfPath is the default directory to CNI network configuration files
 var defaultCNIConfPath = filepath.Join(buildcfg.SYSCONFDIR, "singularity", "network")
 
+// autoScratchDir is where the job scratch directory allocated with
+// --scratch auto is bound inside container
+const autoScratchDir = "/scratch"
+
 // defaultCNIPluginPath is the default directory to CNI plugins executables
 var defaultCNIPluginPath = filepath.Join(buildcfg.LIBEXECDIR, "singularity", "cni")
 
@@ -54,11 +61,14 @@ type container struct {
 	utsNS            bool
 	netNS            bool
 	ipcNS            bool
+	cgroupNS         bool
 	mountInfoPath    string
+	cgroupInfoPath   string
 	skippedMount     []string
 	checkDest        []string
 	suidFlag         uintptr
 	devSourcePath    string
+	tmpPolicy        map[string]*config.TmpPolicy
 }
 
 func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
@@ -70,6 +80,7 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 		sessionLayerType: "none",
 		sessionFsType:    engine.EngineConfig.File.MemoryFSType,
 		mountInfoPath:    fmt.Sprintf("/proc/%d/mountinfo", pid),
+		cgroupInfoPath:   fmt.Sprintf("/proc/%d/cgroup", pid),
 		skippedMount:     make([]string, 0),
 		checkDest:        make([]string, 0),
 		suidFlag:         syscall.MS_NOSUID,
@@ -93,16 +104,40 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 				c.netNS = true
 			case specs.IPCNamespace:
 				c.ipcNS = true
+			case specs.CgroupNamespace:
+				c.cgroupNS = true
 			}
 		}
 	}
 
+	c.tmpPolicy, err = engine.tmpPolicies()
+	if err != nil {
+		return err
+	}
+
 	if os.Geteuid() != 0 {
 		c.sessionSize = int(engine.EngineConfig.File.SessiondirMaxSize)
 	} else if engine.EngineConfig.GetAllowSUID() && !c.userNS {
 		c.suidFlag = 0
 	}
 
+	// the container joins its cgroup before the cgroup mounts are set
+	if os.Geteuid() == 0 {
+		path := engine.EngineConfig.GetCgroupsPath()
+		if path != "" {
+			cgroupPath := filepath.Join("/singularity", strconv.Itoa(pid))
+			manager := &cgroups.Manager{Pid: pid, Path: cgroupPath}
+			err := retry.DefaultPolicy.Do("cgroups setup", func() error {
+				return manager.ApplyFromFile(path)
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to apply cgroups resources restriction: %s", err)
+			}
+			engine.EngineConfig.Cgroups = manager
+			engine.watchOOM()
+		}
+	}
+
 	p := &mount.Points{}
 	system := &mount.System{Points: p, Mount: c.mount}
 
@@ -123,6 +158,9 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 	if err := c.addKernelMount(system); err != nil {
 		return err
 	}
+	if err := c.addCgroupMount(system); err != nil {
+		return err
+	}
 	if err := c.addDevMount(system); err != nil {
 		return err
 	}
@@ -141,21 +179,48 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 	if err := c.addTmpMount(system); err != nil {
 		return err
 	}
+	if err := c.addShmMount(system); err != nil {
+		return err
+	}
 	if err := c.addScratchMount(system); err != nil {
 		return err
 	}
+	if err := c.addAutoScratchMount(system); err != nil {
+		return err
+	}
 	if err := c.addCwdMount(system); err != nil {
 		return err
 	}
+	if err := c.addHostSingularityMount(system); err != nil {
+		return err
+	}
+	if err := c.addXDGRuntimeDirMount(system); err != nil {
+		return err
+	}
+	if err := c.addSessionBusMount(system); err != nil {
+		return err
+	}
+	if err := c.addGUIMount(system); err != nil {
+		return err
+	}
+	if err := c.addMediaMount(system); err != nil {
+		return err
+	}
 	if err := c.addLibsMount(system); err != nil {
 		return err
 	}
+	if err := c.addKrb5Mount(system); err != nil {
+		return err
+	}
 	if err := c.addResolvConfMount(system); err != nil {
 		return err
 	}
 	if err := c.addHostnameMount(system); err != nil {
 		return err
 	}
+	if err := c.addNotifySocketMount(system); err != nil {
+		return err
+	}
 
 	sylog.Debugf("Mount all")
 	if err := system.MountAll(); err != nil {
@@ -172,7 +237,7 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 		}
 	}
 
-	if c.netNS {
+	if c.netNS && engine.EngineConfig.GetNetwork() != "none" {
 		if os.Geteuid() == 0 && !c.userNS {
 			/* hold a reference to container network namespace for cleanup */
 			f, err := syscall.Open("/proc/"+strconv.Itoa(pid)+"/ns/net", os.O_RDONLY, 0)
@@ -211,20 +276,14 @@ func create(engine *EngineOperations, rpcOps *client.RPC, pid int) error {
 			}
 
 			engine.EngineConfig.Network = setup
-		} else if engine.EngineConfig.GetNetwork() != "none" {
+		} else {
 			return fmt.Errorf("Network requires root permissions or --network=none argument as user")
 		}
 	}
 
-	if os.Geteuid() == 0 {
-		path := engine.EngineConfig.GetCgroupsPath()
-		if path != "" {
-			cgroupPath := filepath.Join("/singularity", strconv.Itoa(pid))
-			manager := &cgroups.Manager{Pid: pid, Path: cgroupPath}
-			if err := manager.ApplyFromFile(path); err != nil {
-				return fmt.Errorf("Failed to apply cgroups resources restriction: %s", err)
-			}
-			engine.EngineConfig.Cgroups = manager
+	if engine.EngineConfig.GetObserve() {
+		if err := engine.startObserver(pid); err != nil {
+			return err
 		}
 	}
 
@@ -284,6 +343,15 @@ func (c *container) setupSessionLayout(system *mount.System) error {
 		}
 	}
 
+	if len(c.engine.EngineConfig.GetComposeImage()) > 0 {
+		if !overlayEnabled {
+			return fmt.Errorf("composing images requires overlay support, check 'enable overlay' in singularity.conf, user namespaces don't allow it")
+		}
+		if c.engine.EngineConfig.GetWritableImage() && !writableTmpfs {
+			return fmt.Errorf("images can't be composed on top of a writable container image")
+		}
+	}
+
 	imgObject, err := c.loadImage(c.engine.EngineConfig.GetImage(), true)
 	if err != nil {
 		return fmt.Errorf("while loading image object: %s", err)
@@ -373,20 +441,20 @@ func (c *container) isLayerEnabled() bool {
 func (c *container) mount(point *mount.Point) error {
 	if _, err := mount.GetOffset(point.InternalOptions); err == nil {
 		if err := c.mountImage(point); err != nil {
-			return fmt.Errorf("can't mount image %s: %s", point.Source, err)
+			return errctx.Wrap(err, "can't mount image", point.Source)
 		}
 	} else {
 		if err := c.mountGeneric(point); err != nil {
 			flags, _ := mount.ConvertOptions(point.Options)
 			if flags&syscall.MS_REMOUNT != 0 {
-				return fmt.Errorf("can't remount %s: %s", point.Destination, err)
+				return errctx.Wrap(err, "can't remount", point.Destination)
 			}
 			if point.Type != "" {
 				if point.Source == "devpts" {
 					sylog.Verbosef("Couldn't mount devpts filesystem, continuing with PTY allocation functionality disabled")
 				} else {
 					// mount error for other filesystems is considered fatal
-					return fmt.Errorf("can't mount %s filesystem to %s: %s", point.Type, point.Destination, err)
+					return errctx.Wrap(err, fmt.Sprintf("can't mount %s filesystem to", point.Type), point.Destination)
 				}
 			}
 			sylog.Verbosef("can't mount %s: %s", point.Source, err)
@@ -553,6 +621,17 @@ func (c *container) mountImage(mnt *mount.Point) error {
 	}
 
 	shared := c.engine.EngineConfig.File.SharedLoopDevices
+
+	// loop devices are shared based on the image inode, NFS may
+	// reuse the inode of an image replaced on the server so sharing
+	// could attach a stale image, direct I/O is also never used as
+	// it bypasses the NFS client cache
+	if nfs, err := fs.IsNFS(mnt.Source); err == nil && nfs {
+		sylog.Debugf("Image %s resides on NFS, disabling loop device sharing", mnt.Source)
+		shared = false
+		info.Flags &^= loop.FlagsDirectIO
+	}
+
 	number, err := c.rpcOps.LoopDevice(mnt.Source, attachFlag, *info, maxDevices, shared)
 	if err != nil {
 		return fmt.Errorf("failed to find loop device: %s", err)
@@ -733,6 +812,10 @@ func (c *container) addOverlayMount(system *mount.System) error {
 		hasUpper = true
 	}
 
+	if err := c.addComposeMount(system, ov); err != nil {
+		return err
+	}
+
 	for _, img := range c.engine.EngineConfig.GetOverlayImage() {
 		splitted := strings.SplitN(img, ":", 2)
 
@@ -824,6 +907,92 @@ func (c *container) addOverlayMount(system *mount.System) error {
 	return system.Points.AddPropagation(mount.DevTag, c.session.FinalPath(), syscall.MS_UNBINDABLE)
 }
 
+// addComposeMount mounts the compose images read-only and stacks them in
+// order as overlay lower directories, beneath the overlay images
+func (c *container) addComposeMount(system *mount.System, ov *overlay.Overlay) error {
+	composeImages := c.engine.EngineConfig.GetComposeImage()
+	if len(composeImages) == 0 {
+		return nil
+	}
+
+	for i, img := range composeImages {
+		imageObject, err := c.loadImage(img, false)
+		if err != nil {
+			return fmt.Errorf("failed to open compose image %s: %s", img, err)
+		}
+
+		sessionDest := fmt.Sprintf("/compose-images/%d", i)
+		if err := c.session.AddDir(sessionDest); err != nil {
+			return fmt.Errorf("failed to create session directory for compose image: %s", err)
+		}
+		dst, _ := c.session.GetPath(sessionDest)
+
+		mountType := ""
+		switch imageObject.Partitions[0].Type {
+		case image.SQUASHFS:
+			mountType = "squashfs"
+		case image.EXT3:
+			mountType = "ext3"
+		default:
+			return fmt.Errorf("unsupported root filesystem of compose image %s", img)
+		}
+
+		flags := uintptr(c.suidFlag | syscall.MS_NODEV | syscall.MS_RDONLY)
+		offset := imageObject.Partitions[0].Offset
+		size := imageObject.Partitions[0].Size
+
+		sylog.Debugf("Mounting compose image %s", img)
+		if err := system.Points.AddImage(mount.PreLayerTag, imageObject.Source, dst, mountType, flags, offset, size); err != nil {
+			return fmt.Errorf("while adding compose image %s: %s", img, err)
+		}
+		if err := system.Points.AddPropagation(mount.DevTag, dst, syscall.MS_UNBINDABLE); err != nil {
+			return err
+		}
+		ov.AddLowerDir(dst)
+	}
+
+	return system.RunAfterTag(mount.PreLayerTag, c.reportComposeConflicts)
+}
+
+// reportComposeConflicts reports the paths of the container image and of
+// the compose images shadowed by a compose image stacked on top of them,
+// walking the images is only done on request with --verbose
+func (c *container) reportComposeConflicts(system *mount.System) error {
+	if sylog.GetLevel() < 2 {
+		return nil
+	}
+
+	composeImages := c.engine.EngineConfig.GetComposeImage()
+	names := append([]string{c.engine.EngineConfig.GetImage()}, composeImages...)
+
+	base := c.session.RootFsPath()
+	dirs := make([]string, 0, len(composeImages))
+	for i := range composeImages {
+		dst, _ := c.session.GetPath(fmt.Sprintf("/compose-images/%d", i))
+		dirs = append(dirs, dst)
+	}
+
+	conflicts, err := overlay.FindConflicts(base, dirs)
+	if err != nil {
+		sylog.Warningf("Could not look for conflicts between composed images: %s", err)
+		return nil
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	sylog.Warningf("%d paths are provided by more than one composed image", len(conflicts))
+	for _, conflict := range conflicts {
+		top := conflict.Layers[len(conflict.Layers)-1]
+		shadowed := make([]string, 0, len(conflict.Layers)-1)
+		for _, l := range conflict.Layers[:len(conflict.Layers)-1] {
+			shadowed = append(shadowed, names[l])
+		}
+		sylog.Verbosef("%s from %s shadows the one from %s", conflict.Path, names[top], strings.Join(shadowed, ", "))
+	}
+	return nil
+}
+
 func (c *container) addKernelMount(system *mount.System) error {
 	var err error
 	bindFlags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_REC)
@@ -931,7 +1100,7 @@ func (c *container) addSessionDevMount(system *mount.System) error {
 func (c *container) addDevMount(system *mount.System) error {
 	sylog.Debugf("Checking configuration file for 'mount dev'")
 
-	if c.engine.EngineConfig.File.MountDev == "minimal" || c.engine.EngineConfig.GetContain() {
+	if c.engine.EngineConfig.File.MountDev == "minimal" || c.engine.EngineConfig.GetPrivateDevs() {
 		sylog.Debugf("Creating temporary staged /dev")
 		if err := c.session.AddDir("/dev"); err != nil {
 			return fmt.Errorf("failed to add /dev session directory: %s", err)
@@ -1179,8 +1348,9 @@ func (c *container) getHomePaths() (source string, dest string, err error) {
 	return source, dest, err
 }
 
-// addHomeStagingDir adds and mounts home directory in session staging directory
-func (c *container) addHomeStagingDir(system *mount.System, source string, dest string) (string, error) {
+// addHomeStagingDir adds home directory in session staging directory and
+// mounts the host home directory in it if bind is true
+func (c *container) addHomeStagingDir(system *mount.System, source string, dest string, bind bool) (string, error) {
 	flags := uintptr(syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV | syscall.MS_REC)
 	homeStage := ""
 
@@ -1190,7 +1360,7 @@ func (c *container) addHomeStagingDir(system *mount.System, source string, dest
 
 	homeStage, _ = c.session.GetPath(dest)
 
-	if !c.engine.EngineConfig.GetContain() || c.engine.EngineConfig.GetCustomHome() {
+	if bind && (!c.engine.EngineConfig.GetContain() || c.engine.EngineConfig.GetCustomHome()) {
 		sylog.Debugf("Staging home directory (%v) at %v\n", source, homeStage)
 
 		if err := system.Points.AddBind(mount.HomeTag, source, homeStage, flags); err != nil {
@@ -1246,8 +1416,17 @@ func (c *container) addHomeMount(system *mount.System) error {
 		return nil
 	}
 
+	mode, err := config.ParseHomeMode(c.engine.EngineConfig.GetHomeMode())
+	if err != nil {
+		return err
+	}
+	if mode.Type == config.ImageHome {
+		sylog.Debugf("Using home directory of the image")
+		return nil
+	}
+
 	// check if user attempt to mount a custom home when not allowed to
-	if c.engine.EngineConfig.GetCustomHome() && !c.engine.EngineConfig.File.UserBindControl {
+	if mode.Type == config.HostHome && c.engine.EngineConfig.GetCustomHome() && !c.engine.EngineConfig.File.UserBindControl {
 		return fmt.Errorf("Not mounting user requested home: user bind control is disallowed")
 	}
 
@@ -1256,11 +1435,21 @@ func (c *container) addHomeMount(system *mount.System) error {
 		return fmt.Errorf("unable to get home source/destination: %v", err)
 	}
 
-	stagingDir, err := c.addHomeStagingDir(system, source, dest)
+	stagingDir, err := c.addHomeStagingDir(system, source, dest, mode.Type == config.HostHome)
 	if err != nil {
 		return err
 	}
 
+	if mode.IsTmpfs() {
+		if err := c.addHomeTmpfsMount(system, mode, stagingDir, dest); err != nil {
+			return err
+		}
+		if !c.isLayerEnabled() {
+			return c.addHomeNoLayer(system, stagingDir, dest)
+		}
+		return nil
+	}
+
 	sylog.Debugf("Adding home directory mount [%v:%v] to list using layer: %v\n", stagingDir, dest, c.sessionLayerType)
 	if !c.isLayerEnabled() {
 		return c.addHomeNoLayer(system, stagingDir, dest)
@@ -1299,9 +1488,9 @@ func (c *container) addUserbindsMount(system *mount.System) error {
 		}
 
 		// special case for /dev mount to override default mount behavior
-		// with --contain option or 'mount dev = minimal'
+		// with --private-devs option or 'mount dev = minimal'
 		if strings.HasPrefix(src, devPrefix) {
-			if c.engine.EngineConfig.File.MountDev == "minimal" || c.engine.EngineConfig.GetContain() {
+			if c.engine.EngineConfig.File.MountDev == "minimal" || c.engine.EngineConfig.GetPrivateDevs() {
 				if strings.HasPrefix(src, "/dev/shm/") || strings.HasPrefix(src, "/dev/mqueue/") {
 					sylog.Warningf("Skipping %s bind mount: not allowed", src)
 				} else {
@@ -1355,7 +1544,7 @@ func (c *container) addTmpMount(system *mount.System) error {
 	tmpSource := "/tmp"
 	vartmpSource := "/var/tmp"
 
-	if c.engine.EngineConfig.GetContain() {
+	if c.engine.EngineConfig.GetPrivateTmp() {
 		workdir := c.engine.EngineConfig.GetWorkdir()
 		if workdir != "" {
 			if !c.engine.EngineConfig.File.UserBindControl {
@@ -1402,13 +1591,21 @@ func (c *container) addTmpMount(system *mount.System) error {
 	}
 	flags := uintptr(syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV | syscall.MS_REC)
 
-	if err := system.Points.AddBind(mount.TmpTag, tmpSource, "/tmp", flags); err == nil {
+	if p, ok := c.tmpPolicy["/tmp"]; ok {
+		if err := c.addTmpPolicyMount(system, "/tmp", p); err != nil {
+			return err
+		}
+	} else if err := system.Points.AddBind(mount.TmpTag, tmpSource, "/tmp", flags); err == nil {
 		system.Points.AddRemount(mount.TmpTag, "/tmp", flags)
 		sylog.Verbosef("Default mount: /tmp:/tmp")
 	} else {
 		return fmt.Errorf("could not mount container's /tmp directory: %s %s", err, tmpSource)
 	}
-	if err := system.Points.AddBind(mount.TmpTag, vartmpSource, "/var/tmp", flags); err == nil {
+	if p, ok := c.tmpPolicy["/var/tmp"]; ok {
+		if err := c.addTmpPolicyMount(system, "/var/tmp", p); err != nil {
+			return err
+		}
+	} else if err := system.Points.AddBind(mount.TmpTag, vartmpSource, "/var/tmp", flags); err == nil {
 		system.Points.AddRemount(mount.TmpTag, "/var/tmp", flags)
 		sylog.Verbosef("Default mount: /var/tmp:/var/tmp")
 	} else {
@@ -1417,6 +1614,43 @@ func (c *container) addTmpMount(system *mount.System) error {
 	return nil
 }
 
+// addShmMount provides /dev/shm according to tmp policy if any, otherwise
+// /dev/shm comes with /dev mount
+func (c *container) addShmMount(system *mount.System) error {
+	p, ok := c.tmpPolicy["/dev/shm"]
+	if !ok {
+		return nil
+	}
+	return c.addTmpPolicyMount(system, "/dev/shm", p)
+}
+
+// addTmpPolicyMount provides dest inside container according to policy p
+func (c *container) addTmpPolicyMount(system *mount.System, dest string, p *config.TmpPolicy) error {
+	if p.Type == config.TmpfsPolicy {
+		flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+		if err := system.Points.AddFS(mount.TmpTag, dest, "tmpfs", flags, p.Options()); err != nil {
+			return fmt.Errorf("could not mount container's %s directory: %s", dest, err)
+		}
+		sylog.Verbosef("Tmp policy mount: %s:%s", p, dest)
+		return nil
+	}
+
+	source := p.Source(dest)
+	if p.Type == config.ScratchPolicy {
+		if err := fs.Mkdir(source, os.ModeSticky|0777); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to create %s: %s", source, err)
+		}
+	}
+
+	flags := uintptr(syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV | syscall.MS_REC)
+	if err := system.Points.AddBind(mount.TmpTag, source, dest, flags); err != nil {
+		return fmt.Errorf("could not mount container's %s directory: %s", dest, err)
+	}
+	system.Points.AddRemount(mount.TmpTag, dest, flags)
+	sylog.Verbosef("Tmp policy mount: %s:%s", source, dest)
+	return nil
+}
+
 func (c *container) addScratchMount(system *mount.System) error {
 	hasWorkdir := false
 
@@ -1468,6 +1702,24 @@ func (c *container) addScratchMount(system *mount.System) error {
 	return nil
 }
 
+// addAutoScratchMount binds the job scratch directory allocated with
+// --scratch auto at /scratch
+func (c *container) addAutoScratchMount(system *mount.System) error {
+	dir := c.engine.EngineConfig.GetAutoScratch()
+	if dir == "" {
+		return nil
+	}
+	if !c.engine.EngineConfig.File.UserBindControl {
+		sylog.Verbosef("Not mounting auto scratch: user bind control disabled by system administrator")
+		return nil
+	}
+	flags := uintptr(syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV | syscall.MS_REC)
+	if err := system.Points.AddBind(mount.ScratchTag, dir, autoScratchDir, flags); err != nil {
+		return fmt.Errorf("could not bind scratch directory %s into container: %s", dir, err)
+	}
+	return system.Points.AddRemount(mount.ScratchTag, autoScratchDir, flags)
+}
+
 func (c *container) addCwdMount(system *mount.System) error {
 	cwd := ""
 
@@ -1569,6 +1821,9 @@ func (c *container) addLibsMount(system *mount.System) error {
 
 func (c *container) addIdentityMount(system *mount.System) error {
 	if os.Geteuid() == 0 && c.engine.EngineConfig.GetTargetUID() == 0 {
+		if len(c.engine.EngineConfig.GetPasswdEntries()) > 0 {
+			sylog.Warningf("Ignoring passwd entries, passwd file is not updated when running as root")
+		}
 		sylog.Verbosef("Not updating passwd/group files, running as root!")
 		return nil
 	}
@@ -1587,7 +1842,7 @@ func (c *container) addIdentityMount(system *mount.System) error {
 		if err != nil {
 			sylog.Warningf("%s", err)
 		} else {
-			content, err := files.Passwd(passwd, home, uid)
+			content, err := files.Passwd(passwd, home, uid, c.engine.EngineConfig.GetPasswdEntries())
 			if err != nil {
 				sylog.Warningf("%s", err)
 			} else {
@@ -1605,6 +1860,9 @@ func (c *container) addIdentityMount(system *mount.System) error {
 			}
 		}
 	} else {
+		if len(c.engine.EngineConfig.GetPasswdEntries()) > 0 {
+			sylog.Warningf("Ignoring passwd entries, passwd file update is disabled by configuration")
+		}
 		sylog.Verbosef("Skipping bind of the host's /etc/passwd")
 	}
 
@@ -1709,6 +1967,22 @@ func (c *container) addHostnameMount(system *mount.System) error {
 	return nil
 }
 
+func (c *container) addNotifySocketMount(system *mount.System) error {
+	if c.engine.notifyDir == "" {
+		return nil
+	}
+
+	flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+
+	sylog.Debugf("Adding %s to mount list\n", notifySocketDir)
+	if err := system.Points.AddBind(mount.FilesTag, c.engine.notifyDir, notifySocketDir, flags); err != nil {
+		return fmt.Errorf("unable to add %s to mount list: %s", notifySocketDir, err)
+	}
+	system.Points.AddRemount(mount.FilesTag, notifySocketDir, flags)
+
+	return nil
+}
+
 func (c *container) addActionsMount(system *mount.System) error {
 	hostDir := filepath.Join(buildcfg.SYSCONFDIR, "/singularity/actions")
 	containerDir := "/.singularity.d/actions"
@@ -42,6 +42,12 @@ func (engine *EngineOperations) CreateContainer(pid int, rpcConn net.Conn) error
 		return fmt.Errorf("failed to initialiaze RPC client")
 	}
 
+	if engine.EngineConfig.GetInstance() && engine.EngineConfig.GetNotifySocket() != "" {
+		if err := engine.setupNotifySocket(); err != nil {
+			return err
+		}
+	}
+
 	if engine.EngineConfig.GetInstance() {
 		namespaces := []struct {
 			nstype       string
@@ -0,0 +1,235 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
+	"github.com/sylabs/singularity/internal/pkg/util/gui"
+)
+
+// userOwned returns an error if path is a symlink or isn't owned by the
+// user, the desktop session paths are only bound for their owner
+func userOwned(path string) error {
+	if _, err := os.Lstat(path); err != nil {
+		return err
+	}
+	if fs.IsLink(path) {
+		return fmt.Errorf("%s is a symlink", path)
+	}
+	if !fs.IsOwner(path, uint32(os.Getuid())) {
+		return fmt.Errorf("%s is not owned by user", path)
+	}
+	return nil
+}
+
+// addXDGRuntimeDirMount binds the user runtime directory, which holds
+// the Wayland, PulseAudio and systemd user sockets, at its host location
+func (c *container) addXDGRuntimeDirMount(system *mount.System) error {
+	dir := c.engine.EngineConfig.GetXDGRuntimeDir()
+	if dir == "" {
+		return nil
+	}
+	if !c.engine.EngineConfig.File.AllowXDGRuntimeDir {
+		sylog.Warningf("Not binding %s: disabled by system administrator", dir)
+		return nil
+	}
+	if err := userOwned(dir); err != nil {
+		sylog.Warningf("Not binding user runtime directory: %s", err)
+		return nil
+	}
+
+	flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_REC)
+
+	sylog.Verbosef("Binding user runtime directory %s into container", dir)
+	if err := system.Points.AddBind(mount.BindsTag, dir, dir, flags); err != nil {
+		return fmt.Errorf("unable to add %s to mount list: %s", dir, err)
+	}
+	return system.Points.AddRemount(mount.BindsTag, dir, flags)
+}
+
+// addSessionBusMount binds the session D-Bus socket at its host location,
+// unless it's already provided by the user runtime directory bind
+func (c *container) addSessionBusMount(system *mount.System) error {
+	socket := c.engine.EngineConfig.GetSessionBus()
+	if socket == "" {
+		return nil
+	}
+	if !c.engine.EngineConfig.File.AllowSessionBus {
+		sylog.Warningf("Not binding session D-Bus socket: disabled by system administrator")
+		return nil
+	}
+
+	runtimeDir := c.engine.EngineConfig.GetXDGRuntimeDir()
+	if runtimeDir != "" && c.engine.EngineConfig.File.AllowXDGRuntimeDir {
+		if strings.HasPrefix(socket, filepath.Clean(runtimeDir)+"/") {
+			return nil
+		}
+	}
+	if err := userOwned(socket); err != nil {
+		sylog.Warningf("Not binding session D-Bus socket: %s", err)
+		return nil
+	}
+
+	flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+
+	sylog.Verbosef("Binding session D-Bus socket %s into container", socket)
+	if err := system.Points.AddBind(mount.BindsTag, socket, socket, flags); err != nil {
+		return fmt.Errorf("unable to add %s to mount list: %s", socket, err)
+	}
+	return system.Points.AddRemount(mount.BindsTag, socket, flags)
+}
+
+// addGUIMount binds the X11 and Wayland display sockets at their host
+// location, the X authority file of the user and the direct rendering
+// devices when /dev isn't bound from host
+func (c *container) addGUIMount(system *mount.System) error {
+	if !c.engine.EngineConfig.GetGUI() {
+		return nil
+	}
+	if !c.engine.EngineConfig.File.AllowGUI {
+		sylog.Warningf("Not providing display to container: disabled by system administrator")
+		return nil
+	}
+
+	flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+	var binds [][2]string
+
+	// X11 sockets belong to the user running the X server, only
+	// sockets of the X11 socket directory are bound
+	if socket := c.engine.EngineConfig.GetX11Socket(); socket != "" {
+		fi, err := os.Lstat(socket)
+		if err != nil || filepath.Dir(socket) != gui.X11SocketDir || fi.Mode()&os.ModeSocket == 0 {
+			sylog.Warningf("Not binding %s: not a X11 display socket", socket)
+		} else {
+			binds = append(binds, [2]string{socket, socket})
+		}
+	}
+	if xauth := c.engine.EngineConfig.GetXAuthority(); xauth != "" {
+		if err := userOwned(xauth); err != nil {
+			sylog.Warningf("Not binding X authority file: %s", err)
+		} else {
+			binds = append(binds, [2]string{xauth, gui.ContainerXAuthority})
+		}
+	}
+	if socket := c.engine.EngineConfig.GetWaylandSocket(); socket != "" {
+		if err := userOwned(socket); err != nil {
+			sylog.Warningf("Not binding Wayland display socket: %s", err)
+		} else {
+			binds = append(binds, [2]string{socket, socket})
+		}
+	}
+
+	for _, b := range binds {
+		src, dst := b[0], b[1]
+		sylog.Verbosef("Binding %s into container at %s", src, dst)
+		if err := system.Points.AddBind(mount.BindsTag, src, dst, flags); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", src, err)
+		}
+		if err := system.Points.AddRemount(mount.BindsTag, dst, flags); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", src, err)
+		}
+	}
+
+	if c.engine.EngineConfig.File.MountDev == "minimal" || c.engine.EngineConfig.GetPrivateDevs() {
+		if fs.IsDir(gui.DRIDir) {
+			sylog.Debugf("Adding %s to mount list", gui.DRIDir)
+			if err := c.addSessionDev(gui.DRIDir, system); err != nil {
+				sylog.Warningf("Not binding rendering devices: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// addMediaMount binds the PulseAudio server socket at its host location
+// and the user cookie, and the sound and video devices when /dev isn't
+// bound from host
+func (c *container) addMediaMount(system *mount.System) error {
+	devices := c.engine.EngineConfig.GetMediaDevices()
+	socket := c.engine.EngineConfig.GetPulseSocket()
+	if len(devices) == 0 && socket == "" {
+		return nil
+	}
+
+	allowAudio := c.engine.EngineConfig.File.AllowAudio
+	allowVideo := c.engine.EngineConfig.File.AllowVideo
+
+	if socket != "" && !allowAudio {
+		sylog.Warningf("Not binding PulseAudio socket: disabled by system administrator")
+	} else if socket != "" {
+		flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+		binds := [][2]string{}
+		if err := userOwned(socket); err != nil {
+			sylog.Warningf("Not binding PulseAudio socket: %s", err)
+		} else {
+			binds = append(binds, [2]string{socket, socket})
+			if cookie := c.engine.EngineConfig.GetPulseCookie(); cookie != "" {
+				if err := userOwned(cookie); err != nil {
+					sylog.Warningf("Not binding PulseAudio cookie: %s", err)
+				} else {
+					binds = append(binds, [2]string{cookie, gui.ContainerPulseCookie})
+				}
+			}
+		}
+		for _, b := range binds {
+			src, dst := b[0], b[1]
+			sylog.Verbosef("Binding %s into container at %s", src, dst)
+			if err := system.Points.AddBind(mount.BindsTag, src, dst, flags); err != nil {
+				return fmt.Errorf("unable to add %s to mount list: %s", src, err)
+			}
+			if err := system.Points.AddRemount(mount.BindsTag, dst, flags); err != nil {
+				return fmt.Errorf("unable to add %s to mount list: %s", src, err)
+			}
+		}
+	}
+
+	// with a host /dev the devices are already there, access
+	// is granted by their group membership
+	if c.engine.EngineConfig.File.MountDev != "minimal" && !c.engine.EngineConfig.GetPrivateDevs() {
+		return nil
+	}
+
+	for _, dev := range devices {
+		if !gui.IsMediaDevice(dev) {
+			sylog.Warningf("Not binding %s: not a sound or video device", dev)
+			continue
+		}
+		if dev == gui.SoundDir && !allowAudio {
+			sylog.Warningf("Not binding sound devices: disabled by system administrator")
+			continue
+		} else if dev != gui.SoundDir && !allowVideo {
+			sylog.Warningf("Not binding %s: disabled by system administrator", dev)
+			continue
+		}
+
+		fi, err := os.Lstat(dev)
+		if err != nil {
+			sylog.Warningf("Not binding %s: %s", dev, err)
+			continue
+		}
+		mode := fi.Mode()
+		if (dev == gui.SoundDir && !mode.IsDir()) || (dev != gui.SoundDir && mode&os.ModeCharDevice == 0) {
+			sylog.Warningf("Not binding %s: not a sound or video device", dev)
+			continue
+		}
+
+		sylog.Debugf("Adding %s to mount list", dev)
+		if err := c.addSessionDev(dev, system); err != nil {
+			sylog.Warningf("Not binding %s: %s", dev, err)
+		}
+	}
+
+	return nil
+}
@@ -6,6 +6,10 @@
 package singularity
 
 import (
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/observe"
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
 	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
 )
@@ -14,6 +18,22 @@ import (
 type EngineOperations struct {
 	CommonConfig *config.Common                  `json:"-"`
 	EngineConfig *singularityConfig.EngineConfig `json:"engineConfig"`
+
+	// notifyDir is the host directory holding the notify proxy socket
+	notifyDir string
+	// oomKilled is set when container processes were killed by the
+	// out of memory killer
+	oomKilled bool
+	// timedOut is set when the container process was stopped after
+	// exceeding its execution timeout
+	timedOut bool
+	// started and rusage are the container process monitoring start
+	// time and its resource usage once reaped
+	started time.Time
+	rusage  syscall.Rusage
+	// observer reports the container processes activity on exit with
+	// --observe
+	observer *observe.Observer
 }
 
 // InitConfig stores the pointer to config.Common
@@ -0,0 +1,120 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/shell"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// maxArgStrLen is the maximum length of a single argument or
+	// environment string accepted by execve(2)
+	maxArgStrLen = 32 * 4096
+	// minArgMax is the minimum space for arguments and environment
+	// guaranteed by the kernel whatever the stack limit is
+	minArgMax = 32 * 4096
+	// envFileShell is the shell sourcing the environment file
+	envFileShell = "/bin/sh"
+)
+
+var envNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// execFits returns true if args and env can be passed to execve(2)
+// without E2BIG errors
+func execFits(args, env []string) bool {
+	argMax := uint64(minArgMax)
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_STACK, &rlim); err == nil && rlim.Cur/4 > argMax {
+		argMax = rlim.Cur / 4
+	}
+
+	var size uint64
+	for _, l := range [][]string{args, env} {
+		for _, s := range l {
+			if len(s) >= maxArgStrLen {
+				return false
+			}
+			// string and its pointer
+			size += uint64(len(s)) + 1 + 8
+		}
+	}
+	return size < argMax
+}
+
+// envViaFile writes the environment variables of env to an anonymous
+// file and returns the arguments and environment of a shell sourcing it
+// before executing args, and the file descriptor of the file. Only
+// variables with a name invalid for the shell are kept in the environment,
+// variables too big for execve(2) are not exported by the shell. The file
+// is closed on exec until inheritEnvFile is called.
+func envViaFile(args, env []string) ([]string, []string, int, error) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		return nil, nil, -1, fmt.Errorf("/proc is required in the container to pass the environment via a file")
+	}
+	if _, err := os.Stat(envFileShell); err != nil {
+		return nil, nil, -1, fmt.Errorf("%s is required in the container to pass the environment via a file", envFileShell)
+	}
+
+	var buf bytes.Buffer
+	var kept []string
+
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || !envNameRegexp.MatchString(kv[0]) {
+			kept = append(kept, e)
+			continue
+		}
+		// execve(2) would fail with such variables, they are only
+		// set for the shell instead of aborting the execution
+		export := "export "
+		if len(e) >= maxArgStrLen {
+			sylog.Warningf("Environment variable %s is too big to be exported (%d bytes), it's not passed to the container process", kv[0], len(e))
+			export = ""
+		}
+		fmt.Fprintf(&buf, "%s%s=\"%s\"\n", export, kv[0], shell.Escape(kv[1]))
+	}
+
+	fd, err := unix.MemfdCreate("singularity-env", unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, nil, -1, fmt.Errorf("failed to create environment file: %s", err)
+	}
+	if _, err := syscall.Write(fd, buf.Bytes()); err != nil {
+		syscall.Close(fd)
+		return nil, nil, -1, fmt.Errorf("failed to write environment file: %s", err)
+	}
+
+	path := fmt.Sprintf("/proc/self/fd/%d", fd)
+	script := `. "$SINGULARITY_ENV_FILE"; unset SINGULARITY_ENV_FILE; `
+	// only file descriptors 0 to 9 can be closed by a POSIX shell
+	if fd <= 9 {
+		script += fmt.Sprintf("exec %d<&-; ", fd)
+	}
+	script += `exec "$@"`
+
+	sylog.Debugf("Passing environment via %s", path)
+
+	shellArgs := append([]string{envFileShell, "-c", script, args[0]}, args...)
+	return shellArgs, append(kept, "SINGULARITY_ENV_FILE="+path), fd, nil
+}
+
+// inheritEnvFile lets the shell executed as container process read the
+// environment file fd, it's called right before the execution so the file
+// isn't inherited by other programs
+func inheritEnvFile(fd int) error {
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETFD, 0); err != nil {
+		return fmt.Errorf("failed to pass environment file: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestEnvViaFile(t *testing.T) {
+	args, env, fd, err := envViaFile([]string{"/bin/true", "arg"}, []string{"FOO=bar baz", "BAD-NAME=1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer syscall.Close(fd)
+
+	path := fmt.Sprintf("/proc/self/fd/%d", fd)
+	expectedEnv := []string{"BAD-NAME=1", "SINGULARITY_ENV_FILE=" + path}
+	if !reflect.DeepEqual(env, expectedEnv) {
+		t.Errorf("unexpected environment %v", env)
+	}
+	if len(args) != 6 || args[0] != envFileShell || args[4] != "/bin/true" || args[5] != "arg" {
+		t.Errorf("unexpected arguments %v", args)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "export FOO=") || strings.Contains(string(b), "BAD-NAME") {
+		t.Errorf("unexpected environment file content:\n%s", b)
+	}
+
+	// the file must not leak to programs executed before the container
+	// process
+	flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags&unix.FD_CLOEXEC == 0 {
+		t.Errorf("environment file is not closed on exec")
+	}
+
+	if err := inheritEnvFile(fd); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	flags, err = unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags&unix.FD_CLOEXEC != 0 {
+		t.Errorf("environment file is still closed on exec")
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/nvidia"
+)
+
+const (
+	// cudaLabelsFile stores container labels, images built from
+	// NVIDIA docker images carry the CUDA version in their labels
+	cudaLabelsFile = "/.singularity.d/labels.json"
+	// cudaVersionFile is installed with the CUDA toolkit
+	cudaVersionFile = "/usr/local/cuda/version.txt"
+	// cudaLibDir contains the CUDA runtime library
+	cudaLibDir = "/usr/local/cuda/lib64"
+	// cudaCompatDir contains forward compatibility libraries
+	// installed by the cuda-compat package
+	cudaCompatDir = "/usr/local/cuda/compat"
+)
+
+var cudaVersion = regexp.MustCompile(`([0-9]+\.[0-9]+(\.[0-9]+)?)`)
+
+// containerCudaVersion returns the CUDA version required by container
+// from its labels, the CUDA toolkit version file or the CUDA runtime
+// library, an empty string is returned if none is found
+func containerCudaVersion() string {
+	if data, err := ioutil.ReadFile(cudaLabelsFile); err == nil {
+		labels := make(map[string]string)
+		if err := json.Unmarshal(data, &labels); err == nil {
+			for _, l := range []string{"com.nvidia.cuda.version", "CUDA_VERSION"} {
+				if v := cudaVersion.FindString(labels[l]); v != "" {
+					return v
+				}
+			}
+		}
+	}
+
+	if data, err := ioutil.ReadFile(cudaVersionFile); err == nil {
+		if v := cudaVersion.FindString(string(data)); v != "" {
+			return v
+		}
+	}
+
+	libs, _ := filepath.Glob(filepath.Join(cudaLibDir, "libcudart.so.*.*"))
+	for _, lib := range libs {
+		if v := cudaVersion.FindString(strings.TrimPrefix(filepath.Base(lib), "libcudart.so.")); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// checkCudaCompat compares the CUDA version required by container with
+// the host driver version. If the driver is too old, forward compatibility
+// libraries provided by container are added to LD_LIBRARY_PATH if
+// available, otherwise an error is returned.
+func checkCudaCompat(env []string) ([]string, error) {
+	cuda := containerCudaVersion()
+	if cuda == "" {
+		sylog.Debugf("No CUDA version found in container, skipping driver compatibility check")
+		return env, nil
+	}
+
+	driver, err := nvidia.DriverVersion()
+	if err != nil {
+		sylog.Debugf("Skipping driver compatibility check: %s", err)
+		return env, nil
+	}
+
+	sylog.Debugf("Container requires CUDA %s, host driver version is %s", cuda, driver)
+
+	compatErr := nvidia.CheckCudaCompat(driver, cuda)
+	if compatErr == nil {
+		return env, nil
+	}
+
+	compat, _ := filepath.Glob(filepath.Join(cudaCompatDir, "libcuda.so.*"))
+	if len(compat) == 0 {
+		return nil, fmt.Errorf("%s, update the host driver or use a container built for an older CUDA version", compatErr)
+	}
+
+	sylog.Infof("Host NVIDIA driver %s is too old for CUDA %s, using compatibility libraries from %s", driver, cuda, cudaCompatDir)
+
+	for i, e := range env {
+		if !strings.HasPrefix(e, "LD_LIBRARY_PATH=") {
+			continue
+		}
+		path := cudaCompatDir
+		if v := strings.TrimPrefix(e, "LD_LIBRARY_PATH="); v != "" {
+			path += ":" + v
+		}
+		env[i] = "LD_LIBRARY_PATH=" + path
+		return env, nil
+	}
+	return append(env, "LD_LIBRARY_PATH="+cudaCompatDir), nil
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
+	"golang.org/x/sys/unix"
+)
+
+// skelDir holds the files copied in the home directory with skel mode
+const skelDir = "/etc/skel"
+
+// addHomeTmpfsMount mounts a tmpfs owned by the user as home directory
+// for tmpfs and skel modes, with skel mode it's populated from /etc/skel
+// of the image once mounted. Without layer the tmpfs is mounted on the
+// staging directory whose base is bound in the container.
+func (c *container) addHomeTmpfsMount(system *mount.System, mode *config.HomeMode, stagingDir, dest string) error {
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 && c.engine.EngineConfig.GetTargetUID() != 0 {
+		uid = c.engine.EngineConfig.GetTargetUID()
+	}
+	if gids := c.engine.EngineConfig.GetTargetGID(); gid == 0 && len(gids) > 0 {
+		gid = gids[0]
+	}
+
+	home := stagingDir
+	if c.isLayerEnabled() {
+		home = dest
+	}
+
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+	if err := system.Points.AddFS(mount.HomeTag, home, "tmpfs", flags, mode.Options(uid, gid)); err != nil {
+		return fmt.Errorf("unable to add home to mount list: %s", err)
+	}
+	sylog.Verbosef("Home mode mount: %s:%s", mode, dest)
+
+	if mode.Type != config.SkelHome {
+		return nil
+	}
+
+	populate := func(*mount.System) error {
+		final := c.session.FinalPath()
+		target := home
+		if c.isLayerEnabled() {
+			target = filepath.Join(final, fs.EvalRelative(dest, final))
+		}
+		skel := filepath.Join(final, fs.EvalRelative(skelDir, final))
+		if !fs.IsDir(skel) {
+			sylog.Verbosef("No %s directory in image, home directory is empty", skelDir)
+			return nil
+		}
+		if err := copySkelAs(skel, target, uid, gid); err != nil {
+			sylog.Warningf("Failed to populate home directory from %s: %s", skelDir, err)
+		}
+		return nil
+	}
+	return system.RunAfterTag(mount.HomeTag, populate)
+}
+
+// copySkelAs copies skel into home with the filesystem credentials of
+// uid and gid when running as root, so files of the image are created
+// in the home directory with the user permissions and ownership
+func copySkelAs(skel, home string, uid, gid int) error {
+	if os.Geteuid() != 0 {
+		return copySkel(skel, home)
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		// filesystem IDs are per thread, the thread is never given back
+		// to the scheduler and exits with the goroutine
+		runtime.LockOSThread()
+		if err := syscall.Setfsgid(gid); err != nil {
+			errCh <- fmt.Errorf("failed to set filesystem group ID: %s", err)
+			return
+		}
+		if err := syscall.Setfsuid(uid); err != nil {
+			errCh <- fmt.Errorf("failed to set filesystem user ID: %s", err)
+			return
+		}
+		errCh <- copySkel(skel, home)
+	}()
+
+	return <-errCh
+}
+
+// copySkel copies the directories, regular files and symbolic links of
+// skel into home. Files are opened relative to their parent directory
+// descriptor without following symbolic links, so neither skel nor home
+// can redirect the copy outside of them.
+func copySkel(skel, home string) error {
+	src, err := unix.Open(skel, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %s", skel, err)
+	}
+	defer unix.Close(src)
+
+	dst, err := unix.Open(home, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %s", home, err)
+	}
+	defer unix.Close(dst)
+
+	return copySkelDir(src, dst)
+}
+
+// copySkelDir copies the entries of the directory src into the
+// directory dst
+func copySkelDir(src, dst int) error {
+	// the directory is read from a duplicate as the file closes its
+	// descriptor
+	fd, err := unix.Dup(src)
+	if err != nil {
+		return err
+	}
+	d := os.NewFile(uintptr(fd), "")
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		var st unix.Stat_t
+
+		if err := unix.Fstatat(src, name, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return err
+		}
+		perm := st.Mode & 07777 &^ (unix.S_ISUID | unix.S_ISGID)
+
+		switch st.Mode & unix.S_IFMT {
+		case unix.S_IFDIR:
+			err = copySkelSubdir(src, dst, name, perm)
+		case unix.S_IFLNK:
+			err = copySkelLink(src, dst, name)
+		case unix.S_IFREG:
+			err = copySkelFile(src, dst, name, perm)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not copy %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func copySkelSubdir(src, dst int, name string, perm uint32) error {
+	if err := unix.Mkdirat(dst, name, perm|0700); err != nil {
+		return err
+	}
+	s, err := unix.Openat(src, name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(s)
+
+	d, err := unix.Openat(dst, name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(d)
+
+	if err := copySkelDir(s, d); err != nil {
+		return err
+	}
+	return unix.Fchmod(d, perm)
+}
+
+func copySkelLink(src, dst int, name string) error {
+	buf := make([]byte, unix.PathMax)
+	n, err := unix.Readlinkat(src, name, buf)
+	if err != nil {
+		return err
+	}
+	return unix.Symlinkat(string(buf[:n]), dst, name)
+}
+
+func copySkelFile(src, dst int, name string, perm uint32) error {
+	in, err := unix.Openat(src, name, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	inFile := os.NewFile(uintptr(in), name)
+	defer inFile.Close()
+
+	out, err := unix.Openat(dst, name, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_NOFOLLOW|unix.O_CLOEXEC, perm)
+	if err != nil {
+		return err
+	}
+	outFile := os.NewFile(uintptr(out), name)
+	if _, err := io.Copy(outFile, inFile); err != nil {
+		outFile.Close()
+		return err
+	}
+	return outFile.Close()
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopySkel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skel-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	skel := filepath.Join(dir, "skel")
+	home := filepath.Join(dir, "home")
+	outside := filepath.Join(dir, "outside")
+
+	for _, d := range []string{filepath.Join(skel, ".config"), home, outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(skel, ".bashrc"), []byte("bashrc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(skel, ".config", "app"), []byte("app"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(skel, ".profile")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copySkelAs(skel, home, os.Getuid(), os.Getgid()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(home, ".config", "app")); err != nil || string(b) != "app" {
+		t.Errorf("unexpected content of copied file: %q %v", b, err)
+	}
+	if fi, err := os.Stat(filepath.Join(home, ".config", "app")); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("unexpected mode of copied file: %v", err)
+	}
+	if link, err := os.Readlink(filepath.Join(home, ".profile")); err != nil || link != "/etc/passwd" {
+		t.Errorf("unexpected copied symbolic link: %q %v", link, err)
+	}
+
+	// a home directory replaced by a symbolic link isn't followed
+	linked := filepath.Join(dir, "linked")
+	if err := os.Symlink(outside, linked); err != nil {
+		t.Fatal(err)
+	}
+	if err := copySkelAs(skel, linked, os.Getuid(), os.Getgid()); err == nil {
+		t.Errorf("unexpected success with a symbolic link as home directory")
+	}
+
+	// existing files of the home directory are not written through
+	if err := os.RemoveAll(home); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(home, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(home, ".config")); err != nil {
+		t.Fatal(err)
+	}
+	if err := copySkelAs(skel, home, os.Getuid(), os.Getgid()); err == nil {
+		t.Errorf("unexpected success with an existing symbolic link in home directory")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "app")); err == nil {
+		t.Errorf("file copied through a symbolic link of home directory")
+	}
+}
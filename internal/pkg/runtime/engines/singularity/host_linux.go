@@ -0,0 +1,167 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
+)
+
+// glibcLibs are provided by the container C library and are never bound,
+// mixing them with the container dynamic loader breaks executables
+var glibcLibs = []string{
+	"ld-linux", "libc.so", "libpthread.so", "libdl.so", "librt.so",
+	"libm.so", "libresolv.so", "libutil.so", "libnsl.so",
+}
+
+// ldconfigPaths are the locations where ldconfig is searched, the engine
+// runs with privileges so PATH is never used
+var ldconfigPaths = []string{"/sbin/ldconfig", "/usr/sbin/ldconfig", "/usr/bin/ldconfig"}
+
+var ldCacheEntry = regexp.MustCompile(`(?m)^\s*(\S+)\s*\(.*\)\s*=>\s*(.*)$`)
+
+// hostSingularityLibs returns the shared libraries required by the
+// singularity binary, except the C library ones
+func hostSingularityLibs(binary string) ([]string, error) {
+	f, err := elf.Open(binary)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	needed, err := f.ImportedLibraries()
+	if err != nil {
+		return nil, err
+	}
+
+	var wanted []string
+	for _, lib := range needed {
+		glibc := false
+		for _, prefix := range glibcLibs {
+			if strings.HasPrefix(lib, prefix) {
+				glibc = true
+				break
+			}
+		}
+		if !glibc {
+			wanted = append(wanted, lib)
+		}
+	}
+	if len(wanted) == 0 {
+		return nil, nil
+	}
+
+	ldconfig, err := findLdconfig(ldconfigPaths)
+	if err != nil {
+		return nil, err
+	}
+	out, err := exec.Command(ldconfig, "-p").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not execute ldconfig: %s", err)
+	}
+	cache := make(map[string]string)
+	for _, match := range ldCacheEntry.FindAllSubmatch(out, -1) {
+		name := string(match[1])
+		if _, ok := cache[name]; ok {
+			continue
+		}
+		// skip libraries built for other architectures
+		if lib, err := elf.Open(string(match[2])); err == nil {
+			if lib.Machine == f.Machine {
+				cache[name] = string(match[2])
+			}
+			lib.Close()
+		}
+	}
+
+	libs := make([]string, 0, len(wanted))
+	for _, lib := range wanted {
+		path, ok := cache[lib]
+		if !ok {
+			return nil, fmt.Errorf("library %s not found", lib)
+		}
+		libs = append(libs, path)
+	}
+	return libs, nil
+}
+
+// findLdconfig returns the first executable of the absolute paths
+func findLdconfig(paths []string) (string, error) {
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			continue
+		}
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() && fi.Mode().Perm()&0111 != 0 {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("ldconfig not found in %s", strings.Join(paths, ", "))
+}
+
+// hostSingularityPaths returns the host paths required to run singularity
+// in a container: the singularity binary, its configuration directory
+// and the starter binaries of its libexec directory
+func hostSingularityPaths() []string {
+	return []string{
+		filepath.Join(buildcfg.BINDIR, "singularity"),
+		filepath.Join(buildcfg.SYSCONFDIR, "singularity"),
+		filepath.Join(buildcfg.LIBEXECDIR, "singularity"),
+	}
+}
+
+// addHostSingularityMount binds the host singularity binary, its
+// configuration directory and its libexec directory read-only at their
+// host location, required libraries are added to the container libraries
+func (c *container) addHostSingularityMount(system *mount.System) error {
+	if !c.engine.EngineConfig.GetHostSingularity() {
+		return nil
+	}
+	if !c.engine.EngineConfig.File.AllowHostSingularity {
+		sylog.Warningf("Not binding host singularity: disabled by system administrator")
+		return nil
+	}
+
+	paths := hostSingularityPaths()
+	binary := paths[0]
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			sylog.Warningf("Not binding host singularity: %s", err)
+			return nil
+		}
+	}
+
+	libs, err := hostSingularityLibs(binary)
+	if err != nil {
+		return fmt.Errorf("could not determine %s libraries: %s", binary, err)
+	}
+	if len(libs) > 0 {
+		c.engine.EngineConfig.SetLibrariesPath(append(c.engine.EngineConfig.GetLibrariesPath(), libs...))
+	}
+
+	flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_RDONLY)
+
+	for _, path := range paths {
+		sylog.Verbosef("Binding host %s into container", path)
+		if err := system.Points.AddBind(mount.BindsTag, path, path, flags); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", path, err)
+		}
+		if err := system.Points.AddRemount(mount.BindsTag, path, flags); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+)
+
+func TestHostSingularityPaths(t *testing.T) {
+	libexec := filepath.Join(buildcfg.LIBEXECDIR, "singularity")
+
+	found := false
+	for _, p := range hostSingularityPaths() {
+		if !filepath.IsAbs(p) {
+			t.Errorf("%s is not an absolute path", p)
+		}
+		if p == libexec {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("starter directory %s is not bound", libexec)
+	}
+}
+
+func TestFindLdconfig(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "ldconfig-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	ldconfig := filepath.Join(tmpdir, "ldconfig")
+	if err := ioutil.WriteFile(ldconfig, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// relative paths would be searched in the user's PATH
+	if _, err := findLdconfig([]string{"ldconfig"}); err == nil {
+		t.Errorf("unexpected success with a relative path")
+	}
+	p, err := findLdconfig([]string{filepath.Join(tmpdir, "missing"), ldconfig})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p != ldconfig {
+		t.Errorf("unexpected ldconfig %s instead of %s", p, ldconfig)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/fs/mount"
+	"github.com/sylabs/singularity/internal/pkg/util/krb5"
+)
+
+// krb5ConfDir holds Kerberos configuration snippets included by krb5.conf
+const krb5ConfDir = "/etc/krb5.conf.d"
+
+// addKrb5Mount binds the user Kerberos credential cache at
+// /.singularity.d/krb5cc, or the KCM socket for KCM caches, and the host
+// Kerberos configuration inside container
+func (c *container) addKrb5Mount(system *mount.System) error {
+	name := c.engine.EngineConfig.GetKrb5CCache()
+	if name == "" {
+		return nil
+	}
+
+	sylog.Debugf("Checking for 'user bind control' in configuration file")
+	if !c.engine.EngineConfig.File.UserBindControl {
+		sylog.Warningf("Ignoring Kerberos credentials bind request: user bind control disabled by system administrator")
+		return nil
+	}
+
+	flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV)
+	roFlags := flags | syscall.MS_RDONLY
+
+	cache := krb5.ParseCache(name)
+	switch cache.Type {
+	case krb5.FileCache, krb5.DirCache:
+		// the cache could be a symlink to a file of another user
+		// or not accessible by the user
+		uid := uint32(os.Getuid())
+		if fs.IsLink(cache.Residual) || !fs.IsOwner(cache.Residual, uid) {
+			sylog.Warningf("Ignoring Kerberos credential cache %s: not owned by user", cache.Residual)
+			break
+		}
+		if cache.Type == krb5.DirCache {
+			flags |= syscall.MS_REC
+		}
+		sylog.Debugf("Adding %s to mount list\n", cache.Residual)
+		if err := system.Points.AddBind(mount.FilesTag, cache.Residual, krb5.ContainerCache, flags); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", cache.Residual, err)
+		}
+		system.Points.AddRemount(mount.FilesTag, krb5.ContainerCache, flags)
+	case krb5.KCMCache:
+		if _, err := os.Stat(krb5.KCMSocket); err != nil {
+			sylog.Warningf("Ignoring Kerberos KCM credential cache: %s", err)
+			break
+		}
+		sylog.Debugf("Adding %s to mount list\n", krb5.KCMSocket)
+		if err := system.Points.AddBind(mount.FilesTag, krb5.KCMSocket, krb5.KCMSocket, flags); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", krb5.KCMSocket, err)
+		}
+	}
+
+	conf := c.engine.EngineConfig.GetKrb5Conf()
+	if conf == "" {
+		return nil
+	}
+	sylog.Debugf("Adding %s to mount list\n", conf)
+	if err := system.Points.AddBind(mount.FilesTag, conf, krb5.DefaultConf, roFlags); err != nil {
+		return fmt.Errorf("unable to add %s to mount list: %s", conf, err)
+	}
+	system.Points.AddRemount(mount.FilesTag, krb5.DefaultConf, roFlags)
+
+	if fs.IsDir(krb5ConfDir) {
+		sylog.Debugf("Adding %s to mount list\n", krb5ConfDir)
+		if err := system.Points.AddBind(mount.FilesTag, krb5ConfDir, krb5ConfDir, roFlags|syscall.MS_REC); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", krb5ConfDir, err)
+		}
+		system.Points.AddRemount(mount.FilesTag, krb5ConfDir, roFlags|syscall.MS_REC)
+	}
+
+	return nil
+}
@@ -1,4 +1,4 @@
-// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -9,26 +9,93 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/fs/proc"
 )
 
+// timeoutKillDelay is the delay given to the container process tree to
+// exit after the stop signal before being killed when the execution
+// timeout expires
+const timeoutKillDelay = 10 * time.Second
+
 // MonitorContainer monitors a container
 func (engine *EngineOperations) MonitorContainer(pid int, signals chan os.Signal) (syscall.WaitStatus, error) {
 	var status syscall.WaitStatus
+	var timeout <-chan time.Time
+
+	waitPty, err := engine.copyPty()
+	if err != nil {
+		return status, err
+	}
+	defer waitPty()
+
+	engine.started = time.Now()
+
+	if t := engine.EngineConfig.GetTimeout(); t > 0 {
+		timeout = time.After(t)
+	}
 
 	for {
-		s := <-signals
-		switch s {
-		case syscall.SIGCHLD:
-			if wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); err != nil {
-				return status, fmt.Errorf("error while waiting child: %s", err)
-			} else if wpid != pid {
-				continue
+		select {
+		case s := <-signals:
+			switch s {
+			case syscall.SIGCHLD:
+				if wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, &engine.rusage); err != nil {
+					return status, fmt.Errorf("error while waiting child: %s", err)
+				} else if wpid != pid {
+					continue
+				}
+				return status, nil
+			default:
+				if err := syscall.Kill(pid, s.(syscall.Signal)); err != nil {
+					return status, fmt.Errorf("interrupted by signal %s", s.String())
+				}
 			}
-			return status, nil
-		default:
-			if err := syscall.Kill(pid, s.(syscall.Signal)); err != nil {
-				return status, fmt.Errorf("interrupted by signal %s", s.String())
+		case <-timeout:
+			if !engine.timedOut {
+				sig := engine.stopSignal()
+				sylog.Warningf("Container process exceeded its %s timeout, stopping it with %s", engine.EngineConfig.GetTimeout(), sig)
+				engine.timedOut = true
+				signalTree(pid, sig)
+				timeout = time.After(timeoutKillDelay)
+			} else {
+				sylog.Warningf("Container process still running %s after stop, killing it", timeoutKillDelay)
+				signalTree(pid, syscall.SIGKILL)
+				timeout = nil
 			}
 		}
 	}
 }
+
+// stopSignal returns the signal stopping the container process tree when
+// the execution timeout expires, SIGTERM by default
+func (engine *EngineOperations) stopSignal() syscall.Signal {
+	if sig := engine.EngineConfig.GetStopSignal(); sig > 0 {
+		return syscall.Signal(sig)
+	}
+	return syscall.SIGTERM
+}
+
+// signalTree sends signal sig to the container process and to all its
+// descendants
+func signalTree(pid int, sig syscall.Signal) {
+	pids, err := proc.Descendants(pid)
+	if err != nil {
+		sylog.Debugf("Could not list container processes: %s", err)
+		pids = []int{pid}
+	}
+	for _, p := range pids {
+		if err := syscall.Kill(p, sig); err != nil && err != syscall.ESRCH {
+			sylog.Warningf("failed to send signal %s to process %d: %s", sig, p, err)
+		}
+	}
+}
+
+// TimedOut returns if the container process was stopped because it
+// exceeded its execution timeout, the master process uses it to exit
+// with the corresponding exit code
+func (engine *EngineOperations) TimedOut() bool {
+	return engine.timedOut
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+const (
+	// notifySocketDir is the directory where the notify proxy socket
+	// is bound inside container
+	notifySocketDir = "/run/notify"
+	// notifySocketName is the name of the notify proxy socket
+	notifySocketName = "notify.sock"
+)
+
+// notifyBaseDir returns the directory where notify proxy socket
+// directories are created. With privileges it is a root owned
+// directory rather than the temporary directory of the user's TMPDIR.
+func notifyBaseDir() (string, error) {
+	if os.Geteuid() != 0 {
+		return "", nil
+	}
+
+	base := filepath.Join(buildcfg.RUNSTATEDIR, "singularity", "notify")
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return "", err
+	}
+	fi, err := os.Lstat(base)
+	if err != nil {
+		return "", err
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	if !fi.IsDir() || st.Uid != 0 || fi.Mode().Perm()&0022 != 0 {
+		return "", fmt.Errorf("%s must be a directory owned by root and writable only by root", base)
+	}
+	return base, nil
+}
+
+// checkNotifySocket returns an error if the host notify socket path is
+// not an absolute path of a socket the user is allowed to write to
+func checkNotifySocket(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("notify socket %s must be an absolute path", path)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("notify socket %s: %s", path, err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("notify socket %s is not a socket", path)
+	}
+	// access checks permissions against the real user and group IDs,
+	// those of the user running singularity
+	if err := syscall.Access(path, 0x2); err != nil {
+		return fmt.Errorf("notify socket %s is not writable by the user: %s", path, err)
+	}
+	return nil
+}
+
+// setupNotifySocket creates the notify proxy socket in a temporary
+// host directory later bound to /run/notify inside container, and
+// relays messages received on it to the host NOTIFY_SOCKET
+func (engine *EngineOperations) setupNotifySocket() error {
+	hostSocket := engine.EngineConfig.GetNotifySocket()
+
+	if err := checkNotifySocket(hostSocket); err != nil {
+		return err
+	}
+
+	base, err := notifyBaseDir()
+	if err != nil {
+		return fmt.Errorf("failed to create notify socket directory: %s", err)
+	}
+	dir, err := ioutil.TempDir(base, "singularity-notify-")
+	if err != nil {
+		return fmt.Errorf("failed to create notify socket directory: %s", err)
+	}
+
+	path := filepath.Join(dir, notifySocketName)
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("failed to create notify socket %s: %s", path, err)
+	}
+
+	// container process runs with user identity
+	uid := os.Getuid()
+	gid := os.Getgid()
+	for _, p := range []string{dir, path} {
+		if err := os.Chown(p, uid, gid); err != nil {
+			conn.Close()
+			os.RemoveAll(dir)
+			return fmt.Errorf("failed to change %s ownership: %s", p, err)
+		}
+	}
+
+	engine.notifyDir = dir
+
+	go relayNotify(conn, hostSocket, uid, gid)
+
+	return nil
+}
+
+// relayNotify forwards messages received on the proxy socket to the
+// host notify socket, only the variables of notifyVariables are kept.
+// The READY message is completed with the PID of
+// the instance process (MAINPID) so systemd supervises the instance
+// rather than the command which started it. The host socket is reached
+// with the filesystem credentials of the user uid and gid, so only the
+// sockets the user can write to are reachable.
+func relayNotify(conn *net.UnixConn, hostSocket string, uid, gid int) {
+	defer conn.Close()
+
+	// filesystem IDs are per thread, the thread is never given back to
+	// the scheduler and exits with the goroutine
+	runtime.LockOSThread()
+	if err := syscall.Setfsgid(gid); err != nil {
+		sylog.Warningf("failed to set filesystem group ID: %s", err)
+		return
+	}
+	if err := syscall.Setfsuid(uid); err != nil {
+		sylog.Warningf("failed to set filesystem user ID: %s", err)
+		return
+	}
+
+	addr := &net.UnixAddr{Name: hostSocket, Net: "unixgram"}
+	buf := make([]byte, 4096)
+
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			sylog.Debugf("Stop relaying notify messages: %s", err)
+			return
+		}
+
+		msg := filterNotify(buf[:n], os.Getpid())
+		if len(msg) == 0 {
+			continue
+		}
+
+		host, err := net.DialUnix("unixgram", nil, addr)
+		if err != nil {
+			sylog.Warningf("failed to connect to notify socket %s: %s", hostSocket, err)
+			continue
+		}
+		if _, err := host.Write(msg); err != nil {
+			sylog.Warningf("failed to relay notify message: %s", err)
+		}
+		host.Close()
+	}
+}
+
+// notifyVariables are the notify message variables relayed to the host,
+// the others like MAINPID or FDSTORE could act on other services
+var notifyVariables = []string{"READY=", "STATUS=", "STOPPING=", "RELOADING=", "WATCHDOG="}
+
+// filterNotify returns the lines of msg setting one of notifyVariables,
+// MAINPID is set to pid when the container is ready
+func filterNotify(msg []byte, pid int) []byte {
+	var lines [][]byte
+
+	for _, line := range bytes.Split(msg, []byte("\n")) {
+		for _, v := range notifyVariables {
+			if bytes.HasPrefix(line, []byte(v)) {
+				lines = append(lines, line)
+				break
+			}
+		}
+		if bytes.Equal(line, []byte("READY=1")) {
+			lines = append(lines, []byte(fmt.Sprintf("MAINPID=%d", pid)))
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// notifySocketEnv returns env with NOTIFY_SOCKET pointing to the notify
+// proxy socket inside container
+func notifySocketEnv(env []string) []string {
+	newEnv := make([]string, 0, len(env)+1)
+	for _, e := range env {
+		if !strings.HasPrefix(e, "NOTIFY_SOCKET=") {
+			newEnv = append(newEnv, e)
+		}
+	}
+	return append(newEnv, "NOTIFY_SOCKET="+filepath.Join(notifySocketDir, notifySocketName))
+}
+
+// cleanupNotifySocket removes the notify proxy socket directory
+func (engine *EngineOperations) cleanupNotifySocket() {
+	if engine.notifyDir == "" {
+		return
+	}
+	if err := os.RemoveAll(engine.notifyDir); err != nil {
+		sylog.Warningf("failed to remove notify socket directory %s: %s", engine.notifyDir, err)
+	}
+}
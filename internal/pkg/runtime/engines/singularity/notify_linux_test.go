@@ -0,0 +1,26 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import "testing"
+
+func TestFilterNotify(t *testing.T) {
+	tests := []struct {
+		msg      string
+		expected string
+	}{
+		{"READY=1", "READY=1\nMAINPID=42"},
+		{"STATUS=loading\nWATCHDOG=1", "STATUS=loading\nWATCHDOG=1"},
+		{"MAINPID=1\nREADY=1", "READY=1\nMAINPID=42"},
+		{"FDSTORE=1\nFDNAME=sock", ""},
+		{"RELOADING=1\nEXTEND_TIMEOUT_USEC=1000000\nSTOPPING=1", "RELOADING=1\nSTOPPING=1"},
+	}
+	for _, tt := range tests {
+		if msg := string(filterNotify([]byte(tt.msg), 42)); msg != tt.expected {
+			t.Errorf("unexpected message %q for %q, expected %q", msg, tt.msg, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/observe"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
+)
+
+// observeSummaryLimit is the number of system calls, files and addresses
+// listed in the summary printed on exit
+const observeSummaryLimit = 20
+
+// startObserver starts observing the container process pid, it must be
+// called with root privileges before the container process starts
+func (engine *EngineOperations) startObserver(pid int) error {
+	if !engine.EngineConfig.File.AllowObserve {
+		return fmt.Errorf("--observe is disabled by configuration")
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("--observe requires root privileges or setuid mode")
+	}
+	o, err := observe.Start(pid)
+	if err != nil {
+		return fmt.Errorf("could not observe container: %s", err)
+	}
+	engine.observer = o
+	return nil
+}
+
+// reportObserver prints the observer report on standard error or writes
+// it in JSON format to the file requested with --observe-file
+func (engine *EngineOperations) reportObserver() {
+	var report *observe.Report
+	var err error
+
+	// reading and releasing eBPF maps requires privileges
+	uid := os.Getuid()
+	mainthread.Execute(func() {
+		if os.Geteuid() != 0 {
+			if err = syscall.Setresuid(0, 0, uid); err != nil {
+				err = fmt.Errorf("failed to escalate privileges")
+				return
+			}
+			defer syscall.Setresuid(uid, uid, 0)
+		}
+		report, err = engine.observer.Report()
+		engine.observer.Close()
+	})
+	engine.observer = nil
+	if err != nil {
+		sylog.Warningf("Could not report container activity: %s", err)
+		return
+	}
+
+	if path := engine.EngineConfig.GetObserveFile(); path != "" {
+		b, err := json.MarshalIndent(report, "", "\t")
+		if err == nil {
+			err = ioutil.WriteFile(path, b, 0644)
+		}
+		if err != nil {
+			sylog.Warningf("failed to write container activity to %s: %s", path, err)
+		}
+		return
+	}
+	report.WriteSummary(os.Stderr, observeSummaryLimit)
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// watchOOM logs out of memory kills occurring in the container cgroup
+// while the container is running, for instances messages are written
+// in the instance log
+func (engine *EngineOperations) watchOOM() {
+	events, err := engine.EngineConfig.Cgroups.OOMEvents()
+	if err != nil {
+		sylog.Debugf("Out of memory events not available: %s", err)
+		return
+	}
+	go func() {
+		for count := range events {
+			sylog.Warningf("Container process killed by the out of memory killer (%d kills so far)", count)
+		}
+	}()
+}
+
+// checkOOM records if container processes were killed by the out of
+// memory killer, it must be called before the cgroup removal
+func (engine *EngineOperations) checkOOM() {
+	count, err := engine.EngineConfig.Cgroups.OOMKillCount()
+	if err != nil {
+		sylog.Debugf("Could not determine out of memory kills: %s", err)
+		return
+	}
+	engine.oomKilled = count > 0
+}
+
+// OOMKilled returns if container processes were killed by the out of
+// memory killer, the master process uses it to report the kill and exit
+// with the corresponding exit code
+func (engine *EngineOperations) OOMKilled() bool {
+	return engine.oomKilled
+}
@@ -21,8 +21,12 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
 	"github.com/sylabs/singularity/internal/pkg/syecl"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/errctx"
+	"github.com/sylabs/singularity/internal/pkg/util/exitcode"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
+	"github.com/sylabs/singularity/internal/pkg/util/platform"
+	"github.com/sylabs/singularity/internal/pkg/util/retry"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 	"github.com/sylabs/singularity/pkg/image"
 	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
@@ -347,7 +351,7 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 	// open file descriptors (autofs bug path)
 	e.prepareFd()
 
-	return nil
+	return e.preparePty()
 }
 
 // prepareInstanceJoinConfig is responsible for getting and applying configuration
@@ -507,6 +511,9 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 	}
 
 	if e.EngineConfig.GetInstanceJoin() {
+		if e.EngineConfig.GetPty() {
+			return fmt.Errorf("pseudo-terminal allocation is not supported when joining an instance")
+		}
 		if err := e.prepareInstanceJoinConfig(starterConfig); err != nil {
 			return err
 		}
@@ -547,6 +554,15 @@ func (e *EngineOperations) loadImages() error {
 		return fmt.Errorf("no root filesystem partition found in image %s", e.EngineConfig.GetImage())
 	}
 
+	// images built for another architecture run under emulation
+	emulated, err := platform.CheckHost(img.Architecture, e.EngineConfig.GetStrictPlatform())
+	if err != nil {
+		return errctx.WithHint(err, "use an image built for the host architecture, see --platform")
+	}
+	if emulated {
+		sylog.Warningf("Running %s image %s under emulation", img.Architecture, e.EngineConfig.GetImage())
+	}
+
 	if writable && !img.Writable {
 		sylog.Warningf("Can't set writable flag on image, no write permissions")
 		e.EngineConfig.SetWritableImage(false)
@@ -568,22 +584,36 @@ func (e *EngineOperations) loadImages() error {
 			return fmt.Errorf("path mismatch for sandbox %s != %s", cwd, img.Path)
 		}
 	}
-	if img.Type == image.SIF {
-		// query the ECL module, proceed if an ecl config file is found
-		ecl, err := syecl.LoadConfig(buildcfg.ECL_FILE)
-		if err == nil {
-			if err = ecl.ValidateConfig(); err != nil {
-				return err
-			}
-			_, err := ecl.ShouldRunFp(img.File)
-			if err != nil {
-				return err
-			}
-		}
+	if err := e.checkECL(img); err != nil {
+		return err
+	}
+	if err := e.loadImageSeccomp(img); err != nil {
+		return err
 	}
 	// first image is always the root filesystem
 	images = append(images, *img)
 
+	// load images stacked read-only on top of the root filesystem
+	for _, composeImg := range e.EngineConfig.GetComposeImage() {
+		cimg, err := e.loadImage(composeImg, false)
+		if err != nil {
+			return fmt.Errorf("failed to open compose image %s: %s", composeImg, err)
+		}
+		if cimg.Type != image.SIF && cimg.Type != image.SQUASHFS {
+			return fmt.Errorf("compose image %s is not a SIF or squashfs image", composeImg)
+		}
+		if !cimg.HasRootFs() {
+			return fmt.Errorf("no root filesystem partition found in compose image %s", composeImg)
+		}
+		if cimg.Architecture != "" && img.Architecture != "" && cimg.Architecture != img.Architecture {
+			return fmt.Errorf("compose image %s is built for %s, container image for %s", composeImg, cimg.Architecture, img.Architecture)
+		}
+		if err := e.checkECL(cimg); err != nil {
+			return err
+		}
+		images = append(images, *cimg)
+	}
+
 	// load overlay images
 	for _, overlayImg := range e.EngineConfig.GetOverlayImage() {
 		writable := true
@@ -607,10 +637,44 @@ func (e *EngineOperations) loadImages() error {
 	return nil
 }
 
+// checkECL checks SIF image img against the execution control list, if
+// an ecl config file is found
+func (e *EngineOperations) checkECL(img *image.Image) error {
+	if img.Type != image.SIF {
+		return nil
+	}
+	ecl, err := syecl.LoadConfig(buildcfg.ECL_FILE)
+	if err != nil {
+		return nil
+	}
+	if err := ecl.ValidateConfig(); err != nil {
+		return err
+	}
+	if _, err := ecl.ShouldRunFp(img.File); err != nil {
+		err = errctx.WithHint(err, fmt.Sprintf("image signatures are checked against the execution control list %s", buildcfg.ECL_FILE))
+		return exitcode.Wrap(exitcode.VerificationFailed, err)
+	}
+	return nil
+}
+
 func (e *EngineOperations) loadImage(path string, writable bool) (*image.Image, error) {
-	imgObject, err := image.Init(path, writable)
+	var imgObject *image.Image
+
+	// opening an image residing on NFS may fail with a stale file
+	// handle when the image was replaced on the server
+	err := retry.DefaultPolicy.Do("image open", func() (err error) {
+		imgObject, err = image.Init(path, writable)
+		return err
+	})
+	if e, ok := err.(*retry.Error); ok && !e.Transient {
+		// keep hints attached to non transient errors
+		err = e.Err
+	}
 	if err != nil {
-		return nil, err
+		return nil, errctx.Wrap(err, "failed to load image", path)
+	}
+	if nfs, err := fs.IsNFS(imgObject.Path); err == nil && nfs {
+		sylog.Verbosef("Image %s resides on NFS", imgObject.Path)
 	}
 
 	link, err := mainthread.Readlink(imgObject.Source)
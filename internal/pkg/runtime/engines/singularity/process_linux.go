@@ -17,12 +17,16 @@ import (
 	"syscall"
 	"unsafe"
 
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
 	"github.com/sylabs/singularity/internal/pkg/security"
 
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
+	sigutil "github.com/sylabs/singularity/internal/pkg/util/signal"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sylabs/singularity/internal/pkg/events"
 	"github.com/sylabs/singularity/internal/pkg/instance"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"golang.org/x/crypto/ssh/terminal"
@@ -35,6 +39,10 @@ func (engine *EngineOperations) checkExec() error {
 		shell = "/bin/sh"
 	}
 
+	if err := engine.attachPty(); err != nil {
+		return err
+	}
+
 	args := engine.EngineConfig.OciConfig.Process.Args
 	env := engine.EngineConfig.OciConfig.Process.Env
 
@@ -128,7 +136,7 @@ func (engine *EngineOperations) StartProcess(masterConn net.Conn) error {
 		return err
 	}
 
-	if engine.EngineConfig.File.MountDev == "minimal" || engine.EngineConfig.GetContain() {
+	if engine.EngineConfig.File.MountDev == "minimal" || engine.EngineConfig.GetPrivateDevs() {
 		// If on a terminal, reopen /dev/console so /proc/self/fd/[0-2
 		//   will point to /dev/console.  This is needed so that tty and
 		//   ttyname() on el6 will return the correct answer.  Newer
@@ -163,6 +171,17 @@ func (engine *EngineOperations) StartProcess(masterConn net.Conn) error {
 	args := engine.EngineConfig.OciConfig.Process.Args
 	env := engine.EngineConfig.OciConfig.Process.Env
 
+	if engine.EngineConfig.GetInstance() && engine.EngineConfig.GetNotifySocket() != "" {
+		env = notifySocketEnv(env)
+	}
+
+	if engine.EngineConfig.GetNv() && !engine.EngineConfig.GetInstanceJoin() {
+		var err error
+		if env, err = checkCudaCompat(env); err != nil {
+			return err
+		}
+	}
+
 	if engine.EngineConfig.OciConfig.Linux != nil {
 		namespaces := engine.EngineConfig.OciConfig.Linux.Namespaces
 		for _, ns := range namespaces {
@@ -187,10 +206,32 @@ func (engine *EngineOperations) StartProcess(masterConn net.Conn) error {
 		}
 	}
 
+	envFd := -1
+	if engine.EngineConfig.GetEnvViaFile() || !execFits(args, env) {
+		if !engine.EngineConfig.GetEnvViaFile() {
+			sylog.Verbosef("Environment too big to be passed to %s, passing it via a file", args[0])
+		}
+		var err error
+		if args, env, envFd, err = envViaFile(args, env); err != nil {
+			return err
+		}
+	}
+
+	// set before seccomp filters which may deny set_mempolicy(2)
+	if err := applyMemorySettings(engine.EngineConfig.GetTHP(), engine.EngineConfig.GetMemPolicy()); err != nil {
+		return err
+	}
+
 	if err := security.Configure(&engine.EngineConfig.OciConfig.Spec); err != nil {
 		return fmt.Errorf("failed to apply security configuration: %s", err)
 	}
 
+	if envFd >= 0 {
+		if err := inheritEnvFile(envFd); err != nil {
+			return err
+		}
+	}
+
 	if (!isInstance && !shimProcess) || bootInstance || engine.EngineConfig.GetInstanceJoin() {
 		err := syscall.Exec(args[0], args, env)
 		return fmt.Errorf("exec %s failed: %s", args[0], err)
@@ -204,16 +245,19 @@ func (engine *EngineOperations) StartProcess(masterConn net.Conn) error {
 	cmd.Env = env
 
 	var status syscall.WaitStatus
-	errChan := make(chan error, 1)
 	signals := make(chan os.Signal, 1)
 
+	// Manage all signals, caught before starting the container
+	// process to not miss SIGCHLD if it exits immediately
+	signal.Notify(signals)
+
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("exec %s failed: %s", args[0], err)
 	}
-
-	go func() {
-		errChan <- cmd.Wait()
-	}()
+	pid := cmd.Process.Pid
+	if envFd >= 0 {
+		syscall.Close(envFd)
+	}
 
 	// Modify argv argument and program name shown in /proc/self/comm
 	name := "sinit"
@@ -234,56 +278,59 @@ func (engine *EngineOperations) StartProcess(masterConn net.Conn) error {
 		return syscall.Errno(err)
 	}
 
-	// Manage all signals
-	signal.Notify(signals)
-
 	masterConn.Close()
 
-	for {
-		select {
-		case s := <-signals:
-			sylog.Debugf("Received signal %s", s.String())
-			switch s {
-			case syscall.SIGCHLD:
-				for {
-					wpid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
-					if wpid <= 0 || err != nil {
-						break
-					}
+	for s := range signals {
+		sylog.Debugf("Received signal %s", s.String())
+		switch s {
+		case syscall.SIGCHLD:
+			// reap zombies, the container process included
+			for {
+				wpid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+				if wpid <= 0 || err != nil {
+					break
+				}
+				if wpid != pid {
+					continue
 				}
-			default:
-				signal := s.(syscall.Signal)
-				if isInstance {
-					if err := syscall.Kill(-1, signal); err == syscall.ESRCH {
-						sylog.Debugf("No child process, exiting ...")
-						os.Exit(128 + int(signal))
-					}
-				} else {
-					// kill ourself with SIGKILL whatever signal was received
+				if status.Signaled() {
 					syscall.Kill(syscall.Gettid(), syscall.SIGKILL)
 				}
-			}
-		case err := <-errChan:
-			if e, ok := err.(*exec.ExitError); ok {
-				if status, ok := e.Sys().(syscall.WaitStatus); ok {
-					if status.Signaled() {
-						syscall.Kill(syscall.Gettid(), syscall.SIGKILL)
-					}
+				if status.ExitStatus() != 0 || !isInstance {
 					os.Exit(status.ExitStatus())
 				}
-				return fmt.Errorf("command exit with error: %s", err)
-			} else if e, ok := err.(*os.SyscallError); ok {
-				// handle possible race with Wait4 call above by ignoring ECHILD
-				// error because child process was already catched
-				if e.Err.(syscall.Errno) != syscall.ECHILD {
-					sylog.Fatalf("error while waiting container process: %s", e.Error())
-				}
 			}
-			if !isInstance {
-				os.Exit(0)
+		case syscall.SIGURG:
+			// used internally by Go runtime for goroutine preemption
+		default:
+			signal := s.(syscall.Signal)
+			if isInstance {
+				if err := syscall.Kill(-1, signal); err == syscall.ESRCH {
+					sylog.Debugf("No child process, exiting ...")
+					os.Exit(128 + int(signal))
+				}
+			} else {
+				// kill ourself with SIGKILL whatever signal was received
+				syscall.Kill(syscall.Gettid(), syscall.SIGKILL)
 			}
 		}
 	}
+
+	return fmt.Errorf("signal channel closed unexpectedly")
+}
+
+// applyMemorySettings sets the transparent hugepage mode and the NUMA
+// memory policy inherited by the container process tree
+func applyMemorySettings(thp string, memPolicy string) error {
+	if err := config.ApplyTHP(thp); err != nil {
+		return err
+	}
+	policy, err := config.ParseMemPolicy(memPolicy)
+	if err != nil || policy == nil {
+		return err
+	}
+	sylog.Debugf("Setting memory policy %s", policy)
+	return policy.Apply()
 }
 
 // PostStartProcess will execute code in master context after execution of container
@@ -291,6 +338,14 @@ func (engine *EngineOperations) StartProcess(masterConn net.Conn) error {
 func (engine *EngineOperations) PostStartProcess(pid int) error {
 	sylog.Debugf("Post start process")
 
+	// the staged image is released by this process at exit, the
+	// command line which registered it may be gone for instances
+	if user := engine.EngineConfig.GetStageUser(); user != "" {
+		if err := fs.SetStageUserPid(user, os.Getpid()); err != nil {
+			sylog.Warningf("failed to record process using staged image: %s", err)
+		}
+	}
+
 	if engine.EngineConfig.GetInstance() {
 		uid := os.Getuid()
 		gid := os.Getgid()
@@ -329,6 +384,24 @@ func (engine *EngineOperations) PostStartProcess(pid int) error {
 		file.PPid = os.Getpid()
 		file.Image = engine.EngineConfig.GetImage()
 
+		policies, err := engine.tmpPolicies()
+		if err != nil {
+			return err
+		}
+		for path, p := range policies {
+			file.SetTmpPolicy(path, p.String())
+		}
+
+		// stop parameters are read back by instance stop, the user
+		// can't update privileged instance files
+		if sig := engine.EngineConfig.GetStopSignal(); sig > 0 {
+			file.StopSignal = sigutil.Name(syscall.Signal(sig))
+		}
+		file.StopTimeout = engine.EngineConfig.GetStopTimeout()
+
+		e := &events.Event{Type: events.Start, Kind: events.KindInstance, ID: name, Pid: pid, Image: file.Image}
+		events.Record(e)
+
 		if privileged {
 			var err error
 
@@ -356,14 +429,22 @@ func (engine *EngineOperations) PostStartProcess(pid int) error {
 					return
 				}
 			})
-
-			return err
+			if err != nil {
+				return err
+			}
+		} else {
+			if err := file.Update(); err != nil {
+				return err
+			}
+			if err := file.MountNamespaces(); err != nil {
+				return err
+			}
 		}
 
-		if err := file.Update(); err != nil {
-			return err
-		}
-		return file.MountNamespaces()
+		// hooks are fired once privileges are dropped back, commands
+		// forked during the escalation would run as root. The instance
+		// start command waits for this function to return.
+		go engine.instanceHooks().Fire(e)
 	}
 	return nil
 }
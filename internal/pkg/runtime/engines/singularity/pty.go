@@ -0,0 +1,106 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ptyDrainTimeout is how long the master process waits for remaining
+// pseudo-terminal output once the container process exited, processes
+// left in background may keep the pseudo-terminal open
+const ptyDrainTimeout = 2 * time.Second
+
+// timingWriter writes output to w and records for each write the delay
+// since the previous one and the number of bytes in the scriptreplay
+// timing format
+type timingWriter struct {
+	w      io.Writer
+	timing io.Writer
+	last   time.Time
+}
+
+func (t *timingWriter) Write(p []byte) (int, error) {
+	now := time.Now()
+	n, err := t.w.Write(p)
+	if n > 0 {
+		fmt.Fprintf(t.timing, "%f %d\n", now.Sub(t.last).Seconds(), n)
+		t.last = now
+	}
+	return n, err
+}
+
+// copyPty forwards standard input to the pseudo-terminal and its output
+// to standard output until the container process exits, the returned
+// function waits for the remaining output and restores the terminal
+func (e *EngineOperations) copyPty() (func(), error) {
+	master, slave := e.EngineConfig.GetPtyFd()
+	if master == -1 {
+		return func() {}, nil
+	}
+
+	// only the container process must keep the slave side open to
+	// receive EOF once it exited
+	if err := syscall.Close(slave); err != nil {
+		return nil, err
+	}
+	ptmx := os.NewFile(uintptr(master), "pty-master")
+
+	var out io.Writer = os.Stdout
+	var timing *os.File
+
+	if path := e.EngineConfig.GetPtyTiming(); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create timing file: %s", err)
+		}
+		timing = f
+		out = &timingWriter{w: os.Stdout, timing: timing, last: time.Now()}
+	}
+
+	var oldState *terminal.State
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		var err error
+		if oldState, err = terminal.MakeRaw(int(os.Stdin.Fd())); err != nil {
+			sylog.Warningf("Failed to set terminal in raw mode: %s", err)
+		}
+	}
+
+	go func() {
+		io.Copy(ptmx, os.Stdin)
+		// send EOF to the container process once input is consumed
+		ptmx.Write([]byte{4})
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		// reading the master side returns EIO once all slave
+		// file descriptors are closed
+		io.Copy(out, ptmx)
+		close(done)
+	}()
+
+	return func() {
+		select {
+		case <-done:
+		case <-time.After(ptyDrainTimeout):
+			sylog.Debugf("Pseudo-terminal still open, stop copying output")
+		}
+		if timing != nil {
+			timing.Close()
+		}
+		if oldState != nil {
+			terminal.Restore(int(os.Stdin.Fd()), oldState)
+		}
+	}, nil
+}
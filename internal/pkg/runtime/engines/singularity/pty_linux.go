@@ -0,0 +1,72 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/kr/pty"
+)
+
+// preparePty allocates the pseudo-terminal the container process is
+// attached to, its size is the one of the current terminal if any
+func (e *EngineOperations) preparePty() error {
+	if !e.EngineConfig.GetPty() {
+		return nil
+	}
+	if e.EngineConfig.GetInstance() {
+		return fmt.Errorf("pseudo-terminal allocation is not supported with instances")
+	}
+
+	master, slave, err := pty.Open()
+	if err != nil {
+		return fmt.Errorf("failed to allocate pseudo-terminal: %s", err)
+	}
+
+	size := &pty.Winsize{Rows: 24, Cols: 80}
+	for _, f := range []*os.File{os.Stdin, os.Stdout, os.Stderr} {
+		if s, err := pty.GetsizeFull(f); err == nil {
+			size = s
+			break
+		}
+	}
+	if err := pty.Setsize(slave, size); err != nil {
+		return fmt.Errorf("failed to set pseudo-terminal size: %s", err)
+	}
+
+	e.EngineConfig.SetPtyFd(int(master.Fd()), int(slave.Fd()))
+	return nil
+}
+
+// attachPty makes the pseudo-terminal slave side the standard
+// input/output and the controlling terminal of the container process
+func (e *EngineOperations) attachPty() error {
+	master, slave := e.EngineConfig.GetPtyFd()
+	if master == -1 {
+		return nil
+	}
+
+	for fd := 0; fd <= 2; fd++ {
+		if err := syscall.Dup3(slave, fd, 0); err != nil {
+			return fmt.Errorf("failed to duplicate pseudo-terminal file descriptor: %s", err)
+		}
+	}
+	if err := syscall.Close(master); err != nil {
+		return err
+	}
+	if err := syscall.Close(slave); err != nil {
+		return err
+	}
+	if _, err := syscall.Setsid(); err != nil {
+		return fmt.Errorf("failed to create session: %s", err)
+	}
+	if _, _, err := syscall.Syscall(syscall.SYS_IOCTL, 0, uintptr(syscall.TIOCSCTTY), 1); err != 0 {
+		return fmt.Errorf("failed to set controlling terminal: %s", err.Error())
+	}
+	return nil
+}
@@ -16,6 +16,7 @@ import (
 	args "github.com/sylabs/singularity/internal/pkg/runtime/engines/singularity/rpc"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/mainthread"
+	"github.com/sylabs/singularity/internal/pkg/util/retry"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 	"github.com/sylabs/singularity/pkg/util/fs/proc"
 	"github.com/sylabs/singularity/pkg/util/loop"
@@ -28,10 +29,18 @@ type Methods int
 
 // Mount performs a mount with the specified arguments.
 func (t *Methods) Mount(arguments *args.MountArgs, reply *int) (err error) {
-	mainthread.Execute(func() {
-		err = syscall.Mount(arguments.Source, arguments.Target, arguments.Filesystem, arguments.Mountflags, arguments.Data)
-	})
-	return err
+	mount := func() (err error) {
+		mainthread.Execute(func() {
+			err = syscall.Mount(arguments.Source, arguments.Target, arguments.Filesystem, arguments.Mountflags, arguments.Data)
+		})
+		return err
+	}
+	// a freshly attached loop device may be reported busy for
+	// a short time, other mounts are not retried
+	if strings.HasPrefix(arguments.Source, "/dev/loop") {
+		return retry.DefaultPolicy.Do("mount "+arguments.Source, mount)
+	}
+	return mount()
 }
 
 // Mkdir performs a mkdir with the specified arguments.
@@ -148,7 +157,11 @@ func (t *Methods) LoopDevice(arguments *args.LoopArgs, reply *int) error {
 	defer syscall.Setfsuid(os.Getuid())
 	defer syscall.Setfsgid(os.Getgid())
 
-	err := loopdev.AttachFromFile(image, arguments.Mode, reply)
+	err := retry.DefaultPolicy.Do("loop device attach", func() error {
+		// AttachFromFile may reset the shared flag
+		loopdev.Shared = arguments.Shared
+		return loopdev.AttachFromFile(image, arguments.Mode, reply)
+	})
 	if err != nil {
 		return fmt.Errorf("could not attach image file to loop device: %v", err)
 	}
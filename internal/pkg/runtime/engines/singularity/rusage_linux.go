@@ -0,0 +1,138 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/exitcode"
+)
+
+// rusageSummary is the resource usage of the container process tree
+// reported on exit, times are in seconds and memory sizes in kilobytes.
+// Resource usage of the reaped container process includes all the
+// descendants it waited for, which with a PID namespace are all container
+// processes. Cgroup counters are only set when cgroups were applied and
+// account for all container processes, including those not waited by the
+// container process.
+// ExitReason is the exit status category when the container process was
+// stopped by singularity, like timed-out
+type rusageSummary struct {
+	ExitReason       string  `json:"exitReason,omitempty"`
+	WallTime         float64 `json:"wallTime"`
+	UserTime         float64 `json:"userTime"`
+	SystemTime       float64 `json:"systemTime"`
+	MaxRSS           int64   `json:"maxRSS"`
+	MajorFaults      int64   `json:"majorFaults"`
+	MinorFaults      int64   `json:"minorFaults"`
+	InBlocks         int64   `json:"inBlocks"`
+	OutBlocks        int64   `json:"outBlocks"`
+	ReadBytes        int64   `json:"readBytes"`
+	WriteBytes       int64   `json:"writeBytes"`
+	CgroupCPUTime    float64 `json:"cgroupCPUTime,omitempty"`
+	CgroupMaxMemory  uint64  `json:"cgroupMaxMemory,omitempty"`
+	CgroupReadBytes  uint64  `json:"cgroupReadBytes,omitempty"`
+	CgroupWriteBytes uint64  `json:"cgroupWriteBytes,omitempty"`
+}
+
+// blockSize is the size of the blocks counted by the kernel for the
+// block input and output operations of getrusage
+const blockSize = 512
+
+func timevalSeconds(tv syscall.Timeval) float64 {
+	return time.Duration(tv.Nano()).Seconds()
+}
+
+// newRusageSummary gathers the container process resource usage, it
+// must be called before the cgroup removal
+func (engine *EngineOperations) newRusageSummary() *rusageSummary {
+	ru := &engine.rusage
+
+	s := &rusageSummary{
+		WallTime:    time.Since(engine.started).Seconds(),
+		UserTime:    timevalSeconds(ru.Utime),
+		SystemTime:  timevalSeconds(ru.Stime),
+		MaxRSS:      ru.Maxrss,
+		MajorFaults: ru.Majflt,
+		MinorFaults: ru.Minflt,
+		InBlocks:    ru.Inblock,
+		OutBlocks:   ru.Oublock,
+		ReadBytes:   ru.Inblock * blockSize,
+		WriteBytes:  ru.Oublock * blockSize,
+	}
+
+	if engine.timedOut {
+		s.ExitReason = exitcode.Category(exitcode.TimedOut)
+	}
+
+	if engine.EngineConfig.Cgroups == nil {
+		return s
+	}
+	stats, err := engine.EngineConfig.Cgroups.Stats()
+	if err != nil {
+		sylog.Debugf("Could not gather cgroup statistics: %s", err)
+		return s
+	}
+	if stats.CPU != nil && stats.CPU.Usage != nil {
+		s.CgroupCPUTime = time.Duration(stats.CPU.Usage.Total).Seconds()
+	}
+	if stats.Memory != nil && stats.Memory.Usage != nil {
+		s.CgroupMaxMemory = stats.Memory.Usage.Max / 1024
+	}
+	if stats.Blkio != nil {
+		for _, e := range stats.Blkio.IoServiceBytesRecursive {
+			switch e.Op {
+			case "Read":
+				s.CgroupReadBytes += e.Value
+			case "Write":
+				s.CgroupWriteBytes += e.Value
+			}
+		}
+	}
+	return s
+}
+
+// reportRusage prints the resource usage summary on standard error or
+// writes it in JSON format to the file requested with --usage-file
+func (engine *EngineOperations) reportRusage(s *rusageSummary) {
+	if path := engine.EngineConfig.GetRusageFile(); path != "" {
+		b, err := json.MarshalIndent(s, "", "\t")
+		if err == nil {
+			err = ioutil.WriteFile(path, b, 0644)
+		}
+		if err != nil {
+			sylog.Warningf("failed to write resource usage to %s: %s", path, err)
+		}
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stderr, 0, 0, 1, ' ', 0)
+	if s.ExitReason != "" {
+		fmt.Fprintf(tw, "Exit reason:\t%s\n", s.ExitReason)
+	}
+	fmt.Fprintf(tw, "Elapsed (wall clock) time:\t%.3fs\n", s.WallTime)
+	fmt.Fprintf(tw, "User CPU time:\t%.3fs\n", s.UserTime)
+	fmt.Fprintf(tw, "System CPU time:\t%.3fs\n", s.SystemTime)
+	fmt.Fprintf(tw, "Maximum resident set size:\t%d kB\n", s.MaxRSS)
+	fmt.Fprintf(tw, "Major page faults:\t%d\n", s.MajorFaults)
+	fmt.Fprintf(tw, "Minor page faults:\t%d\n", s.MinorFaults)
+	fmt.Fprintf(tw, "Block input operations:\t%d (%d bytes)\n", s.InBlocks, s.ReadBytes)
+	fmt.Fprintf(tw, "Block output operations:\t%d (%d bytes)\n", s.OutBlocks, s.WriteBytes)
+	if engine.EngineConfig.Cgroups != nil {
+		fmt.Fprintf(tw, "Cgroup CPU time:\t%.3fs\n", s.CgroupCPUTime)
+		fmt.Fprintf(tw, "Cgroup maximum memory usage:\t%d kB\n", s.CgroupMaxMemory)
+		fmt.Fprintf(tw, "Cgroup bytes read:\t%d\n", s.CgroupReadBytes)
+		fmt.Fprintf(tw, "Cgroup bytes written:\t%d\n", s.CgroupWriteBytes)
+	}
+	tw.Flush()
+}
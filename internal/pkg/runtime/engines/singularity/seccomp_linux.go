@@ -0,0 +1,51 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+
+	"github.com/sylabs/singularity/internal/pkg/security"
+	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/errctx"
+	"github.com/sylabs/singularity/pkg/image"
+)
+
+// loadImageSeccomp applies the seccomp profile recommended by image img,
+// unless a profile is given with --security or is already set in the
+// runtime configuration, the user opted out with --no-image-seccomp or
+// image profiles are disabled by the administrator
+func (e *EngineOperations) loadImageSeccomp(img *image.Image) error {
+	if security.GetParam(e.EngineConfig.GetSecurity(), "seccomp") != "" {
+		return nil
+	}
+	if l := e.EngineConfig.OciConfig.Linux; l != nil && l.Seccomp != nil {
+		return nil
+	}
+	if e.EngineConfig.GetNoImageSeccomp() || !e.EngineConfig.File.AllowImageSeccomp {
+		return nil
+	}
+
+	profile, err := image.SeccompProfile(img)
+	if err != nil {
+		return fmt.Errorf("while reading seccomp profile of image %s: %s", img.Path, err)
+	}
+	if profile == nil {
+		return nil
+	}
+	if !seccomp.Enabled() {
+		sylog.Warningf("Seccomp profile of image %s ignored, seccomp is not supported", img.Path)
+		return nil
+	}
+
+	sylog.Verbosef("Applying seccomp profile of image %s", img.Path)
+	if err := seccomp.LoadProfileFromBytes(profile, &e.EngineConfig.OciConfig.Generator); err != nil {
+		err = fmt.Errorf("invalid seccomp profile in image %s: %s", img.Path, err)
+		return errctx.WithHint(err, "use --no-image-seccomp to run the image without its seccomp profile")
+	}
+	return nil
+}
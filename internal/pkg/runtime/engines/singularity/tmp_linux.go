@@ -0,0 +1,28 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// tmpPolicies returns policies controlling how /tmp, /var/tmp and /dev/shm
+// are provided to the container, user policies override those defined
+// in singularity.conf
+func (e *EngineOperations) tmpPolicies() (map[string]*config.TmpPolicy, error) {
+	policies := e.EngineConfig.File.TmpPolicy
+
+	if user := e.EngineConfig.GetTmpPolicy(); len(user) > 0 {
+		if e.EngineConfig.File.UserBindControl {
+			policies = append(append([]string{}, policies...), user...)
+		} else {
+			sylog.Warningf("User bind control is disabled by system administrator, ignoring tmp policies")
+		}
+	}
+
+	return config.ParseTmpPolicies(policies)
+}
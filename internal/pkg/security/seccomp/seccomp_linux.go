@@ -75,6 +75,16 @@ func Enabled() bool {
 	return true
 }
 
+// SyscallName returns the name of the native system call number nr, an
+// empty string is returned for unknown numbers
+func SyscallName(nr int) string {
+	name, err := lseccomp.ScmpSyscall(nr).GetName()
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
 // LoadSeccompConfig loads seccomp configuration filter for the current process
 func LoadSeccompConfig(config *specs.LinuxSeccomp, noNewPrivs bool) error {
 	if err := prctl(syscall.PR_GET_SECCOMP, 0, 0, 0, 0); err == syscall.EINVAL {
@@ -204,6 +214,12 @@ func LoadProfileFromFile(profile string, generator *generate.Generator) error {
 		return err
 	}
 
+	return LoadProfileFromBytes(data, generator)
+}
+
+// LoadProfileFromBytes loads seccomp rules from JSON data and fill in
+// provided OCI configuration
+func LoadProfileFromBytes(data []byte, generator *generate.Generator) error {
 	if generator.Config.Linux == nil {
 		generator.Config.Linux = &specs.Linux{}
 	}
@@ -20,6 +20,12 @@ func Enabled() bool {
 	return false
 }
 
+// SyscallName returns an empty string for unsupported platforms or
+// without seccomp support
+func SyscallName(nr int) string {
+	return ""
+}
+
 // LoadSeccompConfig returns an error for unsupported platforms or without seccomp support
 func LoadSeccompConfig(config *specs.LinuxSeccomp, noNewPrivs bool) error {
 	if runtime.GOOS == "linux" {
@@ -32,3 +38,8 @@ func LoadSeccompConfig(config *specs.LinuxSeccomp, noNewPrivs bool) error {
 func LoadProfileFromFile(profile string, generator *generate.Generator) error {
 	return nil
 }
+
+// LoadProfileFromBytes does nothing for unsupported platforms
+func LoadProfileFromBytes(data []byte, generator *generate.Generator) error {
+	return nil
+}
@@ -0,0 +1,363 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package sifcheck checks the integrity of SIF images: consistency of
+// the global header with the descriptor table, placement of data
+// objects, data objects hashes recorded in signature blocks and health
+// of partition filesystems. Damages left by an interrupted addition of
+// a data object, like a stale global header or unreferenced data at the
+// end of the image, can be repaired.
+package sifcheck
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// offsets of the global header fields updated by repairs, the header
+// is stored packed in little endian
+const (
+	dfreeOffset    = 80
+	descrlenOffset = 104
+	datalenOffset  = 120
+)
+
+// Problem is an integrity problem found in a SIF image
+type Problem struct {
+	Description string
+	Repairable  bool
+	repair      func(f *os.File) error
+}
+
+// Report lists checks done on a SIF image and problems found
+type Report struct {
+	Checks   []string
+	Problems []Problem
+}
+
+// Repairable returns if all problems of the report can be repaired
+func (r *Report) Repairable() bool {
+	for _, p := range r.Problems {
+		if !p.Repairable {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) check(format string, a ...interface{}) {
+	r.Checks = append(r.Checks, fmt.Sprintf(format, a...))
+}
+
+func (r *Report) problem(repair func(f *os.File) error, format string, a ...interface{}) {
+	r.Problems = append(r.Problems, Problem{
+		Description: fmt.Sprintf(format, a...),
+		Repairable:  repair != nil,
+		repair:      repair,
+	})
+}
+
+// writeHeaderField writes value at offset of the global header
+func writeHeaderField(f *os.File, offset int64, value int64) error {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(value))
+	_, err := f.WriteAt(b, offset)
+	return err
+}
+
+// Check checks the integrity of the SIF image at path, partition
+// filesystems are checked with unsquashfs and e2fsck if found
+func Check(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fimg, err := sif.LoadContainerFp(f, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SIF image %s: %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	r := &Report{}
+
+	valid := checkLayout(r, &fimg)
+	if len(valid) == 0 {
+		return r, nil
+	}
+	checkSignatures(r, &fimg, f, valid)
+	checkPartitions(r, f, valid)
+
+	return r, nil
+}
+
+// checkLayout checks the global header and the placement of data
+// objects, it returns the descriptors of data objects lying in the
+// image in descriptor table order
+func checkLayout(r *Report, fimg *sif.FileImage) []*sif.Descriptor {
+	h := &fimg.Header
+
+	r.check("global header")
+	if h.Dtotal <= 0 || h.Dfree < 0 || h.Dfree > h.Dtotal {
+		r.problem(nil, "invalid descriptor count: %d free out of %d", h.Dfree, h.Dtotal)
+		return nil
+	}
+	descrlen := int64(binary.Size(fimg.DescrArr))
+	if h.Descroff+descrlen > h.Dataoff {
+		r.problem(nil, "descriptor table overlaps data section")
+		return nil
+	}
+
+	r.check("descriptor table")
+
+	used := int64(0)
+	end := h.Dataoff
+	ids := make(map[uint32]bool)
+	var valid []*sif.Descriptor
+
+	for i := range fimg.DescrArr {
+		d := &fimg.DescrArr[i]
+		if !d.Used {
+			continue
+		}
+		used++
+
+		if ids[d.ID] {
+			r.problem(nil, "duplicate data object ID %d", d.ID)
+			continue
+		}
+		ids[d.ID] = true
+
+		if d.Filelen < 0 || d.Filelen > d.Storelen || d.Fileoff < h.Dataoff {
+			r.problem(nil, "data object %d has an invalid placement", d.ID)
+			continue
+		}
+		if d.Fileoff+d.Filelen > fimg.Filesize {
+			r.problem(nil, "data object %d is truncated: %d bytes missing", d.ID, d.Fileoff+d.Filelen-fimg.Filesize)
+			continue
+		}
+		if d.Fileoff+d.Filelen > end {
+			end = d.Fileoff + d.Filelen
+		}
+		valid = append(valid, d)
+	}
+
+	objects := append([]*sif.Descriptor{}, valid...)
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Fileoff < objects[j].Fileoff })
+	for i := 1; i < len(objects); i++ {
+		prev := objects[i-1]
+		if prev.Fileoff+prev.Filelen > objects[i].Fileoff {
+			r.problem(nil, "data objects %d and %d overlap", prev.ID, objects[i].ID)
+		}
+	}
+
+	// an addition interrupted after the descriptor table update
+	// leaves the global header with stale counters
+	if free := h.Dtotal - used; h.Dfree != free {
+		r.problem(func(f *os.File) error {
+			return writeHeaderField(f, dfreeOffset, free)
+		}, "global header reports %d free descriptors instead of %d", h.Dfree, free)
+	}
+	if h.Descrlen != descrlen {
+		r.problem(func(f *os.File) error {
+			return writeHeaderField(f, descrlenOffset, descrlen)
+		}, "global header reports a %d bytes descriptor table instead of %d", h.Descrlen, descrlen)
+	}
+
+	datalen := h.Datalen
+	if h.Dataoff+datalen < end {
+		datalen = end - h.Dataoff
+		r.problem(func(f *os.File) error {
+			return writeHeaderField(f, datalenOffset, datalen)
+		}, "global header reports %d bytes of data instead of %d", h.Datalen, datalen)
+	}
+
+	// an addition interrupted before the descriptor table update
+	// leaves unreferenced data at the end of the image
+	if size := h.Dataoff + datalen; fimg.Filesize > size {
+		r.problem(func(f *os.File) error {
+			return f.Truncate(size)
+		}, "%d bytes of unreferenced data at end of image", fimg.Filesize-size)
+	}
+
+	return valid
+}
+
+// checkSignatures compares data objects hashes with hashes recorded in
+// signature blocks, signers are not verified
+func checkSignatures(r *Report, fimg *sif.FileImage, f *os.File, valid []*sif.Descriptor) {
+	readable := make(map[uint32]bool)
+	for _, d := range valid {
+		readable[d.ID] = true
+	}
+
+	for _, sig := range valid {
+		if sig.Datatype != sif.DataSignature {
+			continue
+		}
+		r.check("signature block %d", sig.ID)
+
+		if ht, err := sig.GetHashType(); err != nil || ht != sif.HashSHA384 {
+			r.problem(nil, "signature block %d uses an unsupported hash type", sig.ID)
+			continue
+		}
+		data := make([]byte, sig.Filelen)
+		if _, err := f.ReadAt(data, sig.Fileoff); err != nil {
+			r.problem(nil, "could not read signature block %d: %s", sig.ID, err)
+			continue
+		}
+		block, _ := clearsign.Decode(data)
+		if block == nil {
+			r.problem(nil, "signature block %d is corrupted", sig.ID)
+			continue
+		}
+
+		// signatures are linked either to an object or a group
+		// of objects hashed in descriptor table order
+		var signed []*sif.Descriptor
+		for i := range fimg.DescrArr {
+			d := &fimg.DescrArr[i]
+			if !d.Used {
+				continue
+			}
+			if sig.Link&sif.DescrGroupMask == sif.DescrGroupMask && d.Groupid == sig.Link {
+				signed = append(signed, d)
+			} else if d.ID == sig.Link {
+				signed = append(signed, d)
+			}
+		}
+		if len(signed) == 0 {
+			r.problem(nil, "signature block %d is linked to a missing data object", sig.ID)
+			continue
+		}
+
+		hash := sha512.New384()
+		missing := false
+		for _, d := range signed {
+			if !readable[d.ID] {
+				missing = true
+				break
+			}
+			if _, err := io.Copy(hash, io.NewSectionReader(f, d.Fileoff, d.Filelen)); err != nil {
+				missing = true
+				break
+			}
+		}
+		if missing {
+			r.problem(nil, "data signed by signature block %d can't be read", sig.ID)
+			continue
+		}
+
+		sum := fmt.Sprintf("SIFHASH:\n%x", hash.Sum(nil))
+		if !bytes.Equal(bytes.TrimRight(block.Plaintext, "\n"), []byte(sum)) {
+			r.problem(nil, "data signed by signature block %d doesn't match its hash, data may be corrupted", sig.ID)
+		}
+	}
+}
+
+// checkPartitions checks partition filesystems with unsquashfs or
+// e2fsck, partitions are staged in a temporary file as both tools
+// don't support offsets
+func checkPartitions(r *Report, f *os.File, valid []*sif.Descriptor) {
+	for _, d := range valid {
+		if d.Datatype != sif.DataPartition {
+			continue
+		}
+		fstype, err := d.GetFsType()
+		if err != nil {
+			continue
+		}
+
+		var args []string
+
+		switch fstype {
+		case sif.FsSquash:
+			args = []string{"unsquashfs", "-n", "-l"}
+		case sif.FsExt3:
+			args = []string{"e2fsck", "-n", "-f"}
+		default:
+			continue
+		}
+
+		tool, err := exec.LookPath(args[0])
+		if err != nil {
+			sylog.Warningf("Skipping partition %d check: %s not found", d.ID, args[0])
+			continue
+		}
+		r.check("partition %d filesystem", d.ID)
+
+		if err := checkPartition(f, d, tool, args[1:]); err != nil {
+			r.problem(nil, "partition %d filesystem is damaged: %s", d.ID, err)
+		}
+	}
+}
+
+func checkPartition(f *os.File, d *sif.Descriptor, tool string, args []string) error {
+	tmp, err := ioutil.TempFile("", "sif-partition-")
+	if err != nil {
+		return fmt.Errorf("could not stage partition: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = fs.CopyRange(tmp, 0, f, d.Fileoff, d.Filelen)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("could not stage partition: %s", err)
+	}
+
+	out, err := exec.Command(tool, append(args, tmp.Name())...).CombinedOutput()
+	if err != nil {
+		sylog.Debugf("%s output:\n%s", tool, out)
+		return fmt.Errorf("%s failed: %s", tool, err)
+	}
+	return nil
+}
+
+// Repair checks the SIF image at path and repairs it if all problems
+// found are repairable, the returned report is the report of the image
+// before repair
+func Repair(path string) (*Report, error) {
+	r, err := Check(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Problems) == 0 {
+		return r, nil
+	}
+	if !r.Repairable() {
+		return r, fmt.Errorf("image has problems that can't be repaired")
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return r, err
+	}
+	for _, p := range r.Problems {
+		if err := p.repair(f); err != nil {
+			f.Close()
+			return r, fmt.Errorf("failed to repair %q: %s", p.Description, err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return r, err
+	}
+	return r, f.Close()
+}
@@ -0,0 +1,321 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sifcheck
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// createSIF creates a SIF image at path with a data object per element
+// of objects
+func createSIF(t *testing.T, path string, objects ...[]byte) {
+	cinfo := sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+	}
+	for _, data := range objects {
+		cinfo.InputDescr = append(cinfo.InputDescr, sif.DescriptorInput{
+			Datatype: sif.DataGeneric,
+			Groupid:  sif.DescrDefaultGroup,
+			Link:     sif.DescrUnusedLink,
+			Size:     int64(len(data)),
+			Fname:    "data",
+			Fp:       bytes.NewReader(data),
+		})
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatalf("failed to create %s: %s", path, err)
+	}
+}
+
+func TestCheckRepair(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "sifcheck-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "image.sif")
+	createSIF(t, path, bytes.Repeat([]byte("data"), 1024), []byte("more data"))
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := fi.Size()
+
+	r, err := Check(path)
+	if err != nil {
+		t.Fatalf("unexpected check error: %s", err)
+	}
+	if len(r.Problems) != 0 {
+		t.Fatalf("unexpected problems for a valid image: %+v", r.Problems)
+	}
+
+	// simulate an interrupted addition of a data object
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("partially written object"), size); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeHeaderField(f, dfreeOffset, 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err = Check(path)
+	if err != nil {
+		t.Fatalf("unexpected check error: %s", err)
+	}
+	if len(r.Problems) != 2 || !r.Repairable() {
+		t.Fatalf("unexpected problems for a damaged image: %+v", r.Problems)
+	}
+
+	if _, err := Repair(path); err != nil {
+		t.Fatalf("unexpected repair error: %s", err)
+	}
+	r, err = Check(path)
+	if err != nil {
+		t.Fatalf("unexpected check error: %s", err)
+	}
+	if len(r.Problems) != 0 {
+		t.Errorf("unexpected problems after repair: %+v", r.Problems)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != size {
+		t.Errorf("unexpected image size after repair")
+	}
+
+	// truncated data objects can't be repaired
+	if err := os.Truncate(path, size-4); err != nil {
+		t.Fatal(err)
+	}
+	r, err = Check(path)
+	if err != nil {
+		t.Fatalf("unexpected check error: %s", err)
+	}
+	if len(r.Problems) == 0 || r.Repairable() {
+		t.Errorf("unexpected problems for a truncated image: %+v", r.Problems)
+	}
+	if _, err := Repair(path); err == nil {
+		t.Errorf("unexpected success while repairing a truncated image")
+	}
+}
+
+// corrupt overwrites the start of the data object id of the SIF image
+// at path with data
+func corrupt(t *testing.T, path string, id uint32, data []byte) {
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _, err := fimg.GetFromDescrID(id)
+	fimg.UnloadContainer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(data, d.Fileoff); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckSignatures(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "sifcheck-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entity, err := openpgp.NewEntity("sifcheck", "", "sifcheck@localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("data"), 1024)
+	sum := sha512.Sum384(data)
+
+	tests := []struct {
+		name     string
+		hash     sif.Hashtype
+		link     uint32
+		message  string
+		corrupt  bool
+		problems int
+	}{
+		{"Valid", sif.HashSHA384, 1, fmt.Sprintf("SIFHASH:\n%x", sum), false, 0},
+		{"CorruptedData", sif.HashSHA384, 1, fmt.Sprintf("SIFHASH:\n%x", sum), true, 1},
+		{"WrongHash", sif.HashSHA384, 1, "SIFHASH:\n00", false, 1},
+		{"UnsupportedHash", sif.HashSHA256, 1, fmt.Sprintf("SIFHASH:\n%x", sum), false, 1},
+		{"MissingObject", sif.HashSHA384, 3, fmt.Sprintf("SIFHASH:\n%x", sum), false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".sif")
+			createSIF(t, path, data)
+
+			var signed bytes.Buffer
+			w, err := clearsign.Encode(&signed, entity.PrivateKey, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(tt.message)); err != nil {
+				t.Fatal(err)
+			}
+			w.Close()
+
+			fimg, err := sif.LoadContainer(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			input := sif.DescriptorInput{
+				Datatype: sif.DataSignature,
+				Groupid:  sif.DescrDefaultGroup,
+				Link:     tt.link,
+				Size:     int64(signed.Len()),
+				Fname:    "signature",
+				Data:     signed.Bytes(),
+			}
+			if err := input.SetSignExtra(tt.hash, hex.EncodeToString(entity.PrimaryKey.Fingerprint[:])); err != nil {
+				t.Fatal(err)
+			}
+			err = fimg.AddObject(input)
+			fimg.UnloadContainer()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.corrupt {
+				corrupt(t, path, 1, []byte("corrupted"))
+			}
+
+			r, err := Check(path)
+			if err != nil {
+				t.Fatalf("unexpected check error: %s", err)
+			}
+			if len(r.Problems) != tt.problems {
+				t.Errorf("unexpected problems: %+v", r.Problems)
+			}
+			if r.Repairable() != (tt.problems == 0) {
+				t.Errorf("unexpected repairable signature problems")
+			}
+		})
+	}
+}
+
+func TestCheckPartitions(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	mkfs, err := exec.LookPath("mkfs.ext3")
+	if err != nil {
+		t.Skip("mkfs.ext3 not found")
+	}
+	if _, err := exec.LookPath("e2fsck"); err != nil {
+		t.Skip("e2fsck not found")
+	}
+
+	dir, err := ioutil.TempDir("", "sifcheck-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fsimg := filepath.Join(dir, "ext3.img")
+	if err := ioutil.WriteFile(fsimg, make([]byte, 1024*1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(mkfs, "-q", "-F", fsimg).CombinedOutput(); err != nil {
+		t.Fatalf("mkfs.ext3 failed: %s: %s", err, out)
+	}
+	fsdata, err := ioutil.ReadFile(fsimg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "image.sif")
+	input := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Size:     int64(len(fsdata)),
+		Fname:    "ext3",
+		Fp:       bytes.NewReader(fsdata),
+	}
+	if err := input.SetPartExtra(sif.FsExt3, sif.PartPrimSys, sif.GetSIFArch(runtime.GOARCH)); err != nil {
+		t.Fatal(err)
+	}
+	cinfo := sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{input},
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatalf("failed to create %s: %s", path, err)
+	}
+
+	r, err := Check(path)
+	if err != nil {
+		t.Fatalf("unexpected check error: %s", err)
+	}
+	if len(r.Problems) != 0 {
+		t.Fatalf("unexpected problems for a valid partition: %+v", r.Problems)
+	}
+	checked := false
+	for _, c := range r.Checks {
+		checked = checked || strings.HasPrefix(c, "partition")
+	}
+	if !checked {
+		t.Errorf("partition filesystem not checked: %v", r.Checks)
+	}
+
+	// overwrite the boot sector and the superblock
+	corrupt(t, path, 1, make([]byte, 2048))
+
+	r, err = Check(path)
+	if err != nil {
+		t.Fatalf("unexpected check error: %s", err)
+	}
+	if len(r.Problems) != 1 || r.Repairable() {
+		t.Errorf("unexpected problems for a damaged partition: %+v", r.Problems)
+	}
+	if _, err := Repair(path); err == nil {
+		t.Errorf("unexpected success while repairing a damaged partition")
+	}
+}
@@ -8,6 +8,7 @@
 package sylog
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -65,7 +66,11 @@ var colorReset = "\x1b[0m"
 
 var loggerLevel messageLevel
 
+var jsonErrors bool
+
 func init() {
+	jsonErrors, _ = strconv.ParseBool(os.Getenv("SINGULARITY_JSON_ERRORS"))
+
 	_level, ok := os.LookupEnv("SINGULARITY_MESSAGELEVEL")
 	if !ok {
 		loggerLevel = debug
@@ -120,13 +125,40 @@ func writef(level messageLevel, format string, a ...interface{}) {
 	fmt.Fprintf(os.Stderr, "%s%s\n", prefix(level), message)
 }
 
+// writeJSONError writes a fatal error message on stderr as a JSON
+// object along with the exit code and its category
+func writeJSONError(code int, category string, format string, a ...interface{}) {
+	message := strings.TrimSuffix(fmt.Sprintf(format, a...), "\n")
+	b, _ := json.Marshal(struct {
+		Code     int    `json:"code"`
+		Category string `json:"category"`
+		Message  string `json:"message"`
+	}{code, category, message})
+	fmt.Fprintf(os.Stderr, "%s\n", b)
+}
+
 // Fatalf is equivalent to a call to Errorf followed by os.Exit(255). Code that
 // may be imported by other projects should NOT use Fatalf.
 func Fatalf(format string, a ...interface{}) {
-	writef(fatal, format, a...)
+	if jsonErrors {
+		writeJSONError(255, "internal", format, a...)
+	} else {
+		writef(fatal, format, a...)
+	}
 	os.Exit(255)
 }
 
+// FatalCodef is equivalent to Fatalf but exits with code, category
+// identifies the failure when JSON errors are enabled.
+func FatalCodef(code int, category string, format string, a ...interface{}) {
+	if jsonErrors {
+		writeJSONError(code, category, format, a...)
+	} else {
+		writef(fatal, format, a...)
+	}
+	os.Exit(code)
+}
+
 // Errorf writes an ERROR level message to the log but does not exit. This
 // should be called when an error is being returned to the calling thread
 func Errorf(format string, a ...interface{}) {
@@ -176,6 +208,17 @@ func GetLevel() int {
 	return int(loggerLevel)
 }
 
+// SetJSONErrors enables or disables JSON formatting of fatal errors
+func SetJSONErrors(enable bool) {
+	jsonErrors = enable
+}
+
+// GetJSONErrorsEnvVar returns a formatted environment variable string
+// enabling JSON errors in a child proc
+func GetJSONErrorsEnvVar() string {
+	return fmt.Sprintf("SINGULARITY_JSON_ERRORS=%t", jsonErrors)
+}
+
 // GetEnvVar returns a formatted environment variable string which
 // can later be interpreted by init() in a child proc
 func GetEnvVar() string {
@@ -20,6 +20,12 @@ func Fatalf(format string, a ...interface{}) {
 	os.Exit(255)
 }
 
+// FatalCodef is a dummy function exiting with code. This
+// function must not be used in public packages.
+func FatalCodef(code int, category string, format string, a ...interface{}) {
+	os.Exit(code)
+}
+
 // Errorf is a dummy function doing nothing.
 func Errorf(format string, a ...interface{}) {}
 
@@ -46,6 +52,15 @@ func GetLevel() int {
 	return int(-1)
 }
 
+// SetJSONErrors is a dummy function doing nothing.
+func SetJSONErrors(enable bool) {}
+
+// GetJSONErrorsEnvVar is a dummy function returning environment
+// variable disabling JSON errors.
+func GetJSONErrorsEnvVar() string {
+	return "SINGULARITY_JSON_ERRORS=false"
+}
+
 // GetEnvVar is a dummy function returning environment variable
 // with lowest message level.
 func GetEnvVar() string {
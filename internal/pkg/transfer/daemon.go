@@ -0,0 +1,240 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// pollInterval is the delay between two scans of the queue
+var pollInterval = 2 * time.Second
+
+// notifyTimeout bounds the time spent to deliver a notification
+const notifyTimeout = 30 * time.Second
+
+// Daemon runs the transfers of a queue one at a time
+type Daemon struct {
+	Queue *Queue
+	// Command returns the command executing transfer t, its output
+	// is written to the transfer log
+	Command func(t *Transfer) *exec.Cmd
+	// Notify is called once a transfer completed, Notify is used if nil
+	Notify func(t *Transfer)
+	// Idle is how long the daemon waits for new transfers once the
+	// queue is empty before exiting
+	Idle time.Duration
+	// ID is the transfer run by a daemon started for a transfer which
+	// requires credentials, it's run alongside the queue daemon
+	ID string
+}
+
+// Run runs the queued transfers until the queue stays empty for d.Idle,
+// it returns immediately if another daemon handles the queue. Transfers
+// requiring credentials are left to their own daemon, which runs only
+// transfer d.ID.
+func (d *Daemon) Run() error {
+	if d.ID != "" {
+		return d.runTransfer()
+	}
+
+	locked, err := d.Queue.tryLock()
+	if err != nil {
+		return err
+	}
+	if !locked {
+		sylog.Debugf("Transfer daemon already running for %s", d.Queue.Dir)
+		return nil
+	}
+	defer d.Queue.unlock()
+
+	// transfers left running were interrupted by a previous daemon
+	transfers, err := d.Queue.List()
+	if err != nil {
+		return err
+	}
+	for _, t := range transfers {
+		if t.State == Running {
+			t.State = Failed
+			t.Error = "interrupted"
+			t.Finished = time.Now()
+			d.Queue.Save(t)
+		}
+	}
+
+	idleSince := time.Now()
+	for {
+		t, err := d.next()
+		if err != nil {
+			return err
+		}
+		if t != nil {
+			d.run(t)
+			idleSince = time.Now()
+			continue
+		}
+		if time.Since(idleSince) < d.Idle {
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		// a transfer queued while exiting may have seen the lock
+		// still held, the lock is taken back to run it
+		d.Queue.unlock()
+		if t, err := d.next(); err != nil || t == nil {
+			return err
+		}
+		if locked, err := d.Queue.tryLock(); err != nil || !locked {
+			return err
+		}
+		idleSince = time.Now()
+	}
+}
+
+// next returns the oldest queued transfer or nil
+func (d *Daemon) next() (*Transfer, error) {
+	transfers, err := d.Queue.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range transfers {
+		if t.State == Queued && !t.Credentials {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+// runTransfer runs the transfer d.ID if it's still queued
+func (d *Daemon) runTransfer() error {
+	transfers, err := d.Queue.List()
+	if err != nil {
+		return err
+	}
+	for _, t := range transfers {
+		if t.ID == d.ID && t.State == Queued {
+			d.run(t)
+			return nil
+		}
+	}
+	return fmt.Errorf("no queued transfer %s", d.ID)
+}
+
+// run executes transfer t and notifies its completion
+func (d *Daemon) run(t *Transfer) {
+	err := d.exec(t)
+	t.Finished = time.Now()
+	if err != nil {
+		t.State = Failed
+		// the last output line is the most helpful error message
+		if t.Error = d.Queue.Progress(t); t.Error == "" {
+			t.Error = err.Error()
+		}
+		sylog.Infof("Transfer %s of %s failed: %s", t.ID, t.Source, t.Error)
+	} else {
+		t.State = Done
+		sylog.Infof("Transfer %s of %s completed", t.ID, t.Source)
+	}
+	if err := d.Queue.Save(t); err != nil {
+		sylog.Warningf("Could not save transfer %s: %s", t.ID, err)
+	}
+
+	if d.Notify != nil {
+		d.Notify(t)
+	} else {
+		Notify(t)
+	}
+}
+
+func (d *Daemon) exec(t *Transfer) error {
+	log, err := os.OpenFile(d.Queue.LogPath(t.ID), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	cmd := d.Command(t)
+	cmd.Stdout = log
+	cmd.Stderr = log
+
+	t.State = Running
+	t.Started = time.Now()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	t.Pid = cmd.Process.Pid
+	if err := d.Queue.Save(t); err != nil {
+		sylog.Warningf("Could not save transfer %s: %s", t.ID, err)
+	}
+	return cmd.Wait()
+}
+
+// Message returns the notification message of a completed transfer
+func (t *Transfer) Message() string {
+	if t.State == Failed {
+		return fmt.Sprintf("Pull of %s failed: %s", t.Source, t.Error)
+	}
+	return fmt.Sprintf("Pull of %s to %s completed", t.Source, t.Dest)
+}
+
+// Notify sends a desktop notification of the completion of transfer t
+// if notify-send is available, and posts t to its notification URL
+func Notify(t *Transfer) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	if path, err := exec.LookPath("notify-send"); err == nil {
+		if err := exec.CommandContext(ctx, path, "Singularity", t.Message()).Run(); err != nil {
+			sylog.Debugf("Desktop notification failed: %s", err)
+		}
+	}
+
+	if t.NotifyURL == "" {
+		return
+	}
+	if err := post(ctx, t.NotifyURL, t); err != nil {
+		sylog.Warningf("Could not notify %s of transfer %s: %s", t.NotifyURL, t.ID, err)
+	}
+}
+
+// post sends transfer t in JSON format to url, the environment of the
+// transfer isn't sent as it may hold credentials
+func post(ctx context.Context, url string, t *Transfer) error {
+	n := *t
+	n.Env = nil
+
+	b, err := json.Marshal(struct {
+		*Transfer
+		Message string `json:"message"`
+	}{&n, t.Message()})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package transfer implements a per-user queue of image pulls run in the
+// background, so long transfers don't require to keep a terminal open.
+// Each transfer is a JSON file stored in the user home directory, in a
+// directory suffixed with the hostname as home directories may be shared
+// between nodes. A small daemon is started on demand when a transfer is
+// queued, it runs transfers one at a time, notifies their completion and
+// exits once the queue stays empty.
+package transfer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/util/user"
+)
+
+// State is the state of a transfer
+type State string
+
+// Transfer states
+const (
+	Queued  State = "queued"
+	Running State = "running"
+	Done    State = "done"
+	Failed  State = "failed"
+)
+
+const (
+	queueDir = ".singularity/transfers"
+	lockFile = "daemon.lock"
+	// progressSize is the size of the end of the transfer log read to
+	// report the progress
+	progressSize = 4096
+)
+
+// Transfer is a pull queued for the daemon
+type Transfer struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Dest   string `json:"dest"`
+	// Args are the pull command arguments
+	Args []string `json:"args"`
+	// Env and Cwd are the pull command environment and working directory
+	Env []string `json:"env"`
+	Cwd string   `json:"cwd"`
+	// Credentials is set when the pull requires credentials, they are
+	// not stored in the queue and the transfer is run by a daemon
+	// started for it which holds them in its environment
+	Credentials bool `json:"credentials,omitempty"`
+	// NotifyURL receives a POST request with the transfer in JSON
+	// format once completed
+	NotifyURL string    `json:"notifyURL,omitempty"`
+	State     State     `json:"state"`
+	Pid       int       `json:"pid,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Created   time.Time `json:"created"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+}
+
+// Queue is a transfer queue stored in directory Dir
+type Queue struct {
+	Dir string
+
+	lock *os.File
+}
+
+// DefaultQueue returns the transfer queue of the current user on this host
+func DefaultQueue() (*Queue, error) {
+	pw, err := user.GetPwUID(uint32(os.Getuid()))
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return &Queue{Dir: filepath.Join(pw.Dir, queueDir, hostname)}, nil
+}
+
+func (q *Queue) path(id string) string {
+	return filepath.Join(q.Dir, id+".json")
+}
+
+// LogPath returns the path of the file receiving the output of transfer id
+func (q *Queue) LogPath(id string) string {
+	return filepath.Join(q.Dir, id+".log")
+}
+
+// Add queues transfer t, its ID and creation time are set
+func (q *Queue) Add(t *Transfer) error {
+	if err := os.MkdirAll(q.Dir, 0700); err != nil {
+		return err
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	t.ID = hex.EncodeToString(b)
+	t.State = Queued
+	t.Created = time.Now()
+	return q.Save(t)
+}
+
+// Save writes transfer t to the queue, readers never see a partial file
+func (q *Queue) Save(t *Transfer) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(q.Dir, "."+t.ID+"-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), q.path(t.ID))
+}
+
+// List returns the transfers of the queue by creation time
+func (q *Queue) List() ([]*Transfer, error) {
+	files, err := filepath.Glob(filepath.Join(q.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make([]*Transfer, 0, len(files))
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if os.IsNotExist(err) {
+			// removed by a concurrent clean
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		t := new(Transfer)
+		if err := json.Unmarshal(b, t); err != nil {
+			return nil, fmt.Errorf("while reading %s: %s", f, err)
+		}
+		transfers = append(transfers, t)
+	}
+
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].Created.Before(transfers[j].Created)
+	})
+	return transfers, nil
+}
+
+// Clean removes the completed transfers and their logs, it returns the
+// number of transfers removed
+func (q *Queue) Clean() (int, error) {
+	transfers, err := q.List()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, t := range transfers {
+		if t.State != Done && t.State != Failed {
+			continue
+		}
+		if err := os.Remove(q.path(t.ID)); err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+		os.Remove(q.LogPath(t.ID))
+		n++
+	}
+	return n, nil
+}
+
+// Progress returns the last line written by transfer t
+func (q *Queue) Progress(t *Transfer) string {
+	f, err := os.Open(q.LogPath(t.ID))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	if fi, err := f.Stat(); err == nil && fi.Size() > progressSize {
+		f.Seek(-progressSize, io.SeekEnd)
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return ""
+	}
+
+	// progress bars redraw lines with carriage returns
+	lines := strings.FieldsFunc(string(b), func(r rune) bool {
+		return r == '\n' || r == '\r'
+	})
+	for i := len(lines) - 1; i >= 0; i-- {
+		if l := strings.TrimSpace(lines[i]); l != "" {
+			return l
+		}
+	}
+	return ""
+}
+
+// tryLock takes the daemon lock of the queue, it returns false if
+// another daemon holds it
+func (q *Queue) tryLock() (bool, error) {
+	if err := os.MkdirAll(q.Dir, 0700); err != nil {
+		return false, err
+	}
+	f, err := os.OpenFile(filepath.Join(q.Dir, lockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return false, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == syscall.EWOULDBLOCK {
+		f.Close()
+		return false, nil
+	} else if err != nil {
+		f.Close()
+		return false, err
+	}
+	q.lock = f
+	return true, nil
+}
+
+// unlock releases the daemon lock of the queue
+func (q *Queue) unlock() {
+	if q.lock != nil {
+		q.lock.Close()
+		q.lock = nil
+	}
+}
+
+// StartDaemon executes path with args to start the daemon of the queue,
+// unless a daemon is already running. The daemon is detached from the
+// calling terminal and session.
+func (q *Queue) StartDaemon(path string, args ...string) error {
+	locked, err := q.tryLock()
+	if err != nil {
+		return fmt.Errorf("while checking transfer daemon: %s", err)
+	}
+	if !locked {
+		return nil
+	}
+	q.unlock()
+
+	return q.start(path, os.Environ(), args...)
+}
+
+// StartTransferDaemon executes path with args and environment env to
+// start the daemon running a transfer which requires credentials, they
+// are passed through env. The daemon is detached from the calling
+// terminal and session.
+func (q *Queue) StartTransferDaemon(path string, env []string, args ...string) error {
+	return q.start(path, env, args...)
+}
+
+func (q *Queue) start(path string, env []string, args ...string) error {
+	out, err := os.OpenFile(filepath.Join(q.Dir, "daemon.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Dir = "/"
+	cmd.Env = env
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("while starting transfer daemon: %s", err)
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package transfer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestQueue(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "transfers-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q := &Queue{Dir: dir}
+	first := &Transfer{Source: "docker://alpine", Dest: "alpine.sif"}
+	second := &Transfer{Source: "docker://busybox", Dest: "busybox.sif"}
+	for _, tr := range []*Transfer{first, second} {
+		if err := q.Add(tr); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if first.ID == "" || first.ID == second.ID || first.State != Queued {
+		t.Errorf("unexpected transfers: %+v %+v", first, second)
+	}
+
+	transfers, err := q.List()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(transfers) != 2 || transfers[0].ID != first.ID || transfers[1].ID != second.ID {
+		t.Errorf("unexpected transfer list: %+v", transfers)
+	}
+
+	if err := ioutil.WriteFile(q.LogPath(first.ID), []byte("Copying blob 1\n 10 MiB / 50 MiB\r 20 MiB / 50 MiB\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if p := q.Progress(first); p != "20 MiB / 50 MiB" {
+		t.Errorf("unexpected progress %q", p)
+	}
+
+	first.State = Done
+	if err := q.Save(first); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n, err := q.Clean(); n != 1 || err != nil {
+		t.Errorf("unexpected clean result: %d %v", n, err)
+	}
+	if transfers, _ := q.List(); len(transfers) != 1 || transfers[0].ID != second.ID {
+		t.Errorf("unexpected transfer list after clean: %+v", transfers)
+	}
+	if _, err := os.Stat(q.LogPath(first.ID)); !os.IsNotExist(err) {
+		t.Errorf("log of cleaned transfer not removed")
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "transfers-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pollInterval = 10 * time.Millisecond
+	q := &Queue{Dir: dir}
+
+	ok := &Transfer{Source: "docker://alpine", Dest: "alpine.sif", Args: []string{"echo pulled"}}
+	ko := &Transfer{Source: "docker://nothere", Args: []string{"echo 'FATAL: manifest unknown' >&2; exit 255"}}
+	for _, tr := range []*Transfer{ok, ko} {
+		if err := q.Add(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var notified []string
+	d := &Daemon{
+		Queue: q,
+		Command: func(tr *Transfer) *exec.Cmd {
+			return exec.Command("/bin/sh", "-c", tr.Args[0])
+		},
+		Notify: func(tr *Transfer) {
+			notified = append(notified, tr.Message())
+		},
+	}
+
+	// a second daemon doesn't run transfers of a handled queue
+	other := &Queue{Dir: dir}
+	if locked, err := other.tryLock(); !locked || err != nil {
+		t.Fatalf("failed to lock queue: %v", err)
+	}
+	if err := d.Run(); err != nil || len(notified) != 0 {
+		t.Errorf("unexpected run with a locked queue: %v %v", notified, err)
+	}
+	other.unlock()
+
+	if err := d.Run(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{
+		"Pull of docker://alpine to alpine.sif completed",
+		"Pull of docker://nothere failed: FATAL: manifest unknown",
+	}
+	if len(notified) != 2 || notified[0] != expected[0] || notified[1] != expected[1] {
+		t.Errorf("unexpected notifications: %q", notified)
+	}
+
+	transfers, _ := q.List()
+	if len(transfers) != 2 || transfers[0].State != Done || transfers[1].State != Failed || transfers[0].Pid == 0 {
+		t.Errorf("unexpected transfer states: %+v", transfers)
+	}
+
+	// transfers requiring credentials are only run by their own daemon,
+	// even while the queue is handled
+	private := &Transfer{Source: "docker://private/app", Dest: "app.sif", Args: []string{"echo pulled"}, Credentials: true}
+	if err := q.Add(private); err != nil {
+		t.Fatal(err)
+	}
+	notified = nil
+	if err := d.Run(); err != nil || len(notified) != 0 {
+		t.Errorf("unexpected run of a transfer requiring credentials: %v %v", notified, err)
+	}
+	if locked, err := other.tryLock(); !locked || err != nil {
+		t.Fatalf("failed to lock queue: %v", err)
+	}
+	d.ID = private.ID
+	if err := d.Run(); err != nil || len(notified) != 1 || notified[0] != "Pull of docker://private/app to app.sif completed" {
+		t.Errorf("unexpected run of transfer %s: %q %v", private.ID, notified, err)
+	}
+	other.unlock()
+	if err := d.Run(); err == nil {
+		t.Errorf("unexpected success running a completed transfer")
+	}
+}
+
+func TestNotify(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	received := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&m)
+		received <- m
+	}))
+	defer srv.Close()
+
+	// no desktop notification during tests
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", "")
+	defer os.Setenv("PATH", path)
+
+	Notify(&Transfer{
+		ID:        "1234abcd",
+		Source:    "docker://alpine",
+		Dest:      "alpine.sif",
+		Env:       []string{"SINGULARITY_DOCKER_PASSWORD=secret"},
+		NotifyURL: srv.URL,
+		State:     Done,
+	})
+
+	select {
+	case m := <-received:
+		if m["id"] != "1234abcd" || m["state"] != "done" || m["message"] != "Pull of docker://alpine to alpine.sif completed" || m["env"] != nil {
+			t.Errorf("unexpected notification: %v", m)
+		}
+	default:
+		t.Errorf("no notification received")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"strings"
 
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/opencontainers/runtime-tools/generate"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 )
@@ -31,20 +32,55 @@ var alwaysPassKeys = map[string]bool{
 	"FTP_PROXY":   true,
 }
 
+// processEnv is a process environment list indexed by variable name,
+// unlike Generator.AddProcessEnv setting a variable doesn't scan the
+// list, which matters with the thousands of variables set by module
+// systems
+type processEnv struct {
+	list  []string
+	index map[string]int
+}
+
+func newProcessEnv(env []string, size int) *processEnv {
+	e := &processEnv{
+		list:  make([]string, 0, len(env)+size),
+		index: make(map[string]int, len(env)+size),
+	}
+	for _, v := range env {
+		e.set(strings.SplitN(v, "=", 2)[0], v)
+	}
+	return e
+}
+
+// set sets variable key to the KEY=VALUE pair v
+func (e *processEnv) set(key string, v string) {
+	if i, ok := e.index[key]; ok {
+		e.list[i] = v
+		return
+	}
+	e.index[key] = len(e.list)
+	e.list = append(e.list, v)
+}
+
 // SetContainerEnv cleans environment variables before running the container
 func SetContainerEnv(g *generate.Generator, env []string, cleanEnv bool, homeDest string) {
+	if g.Config.Process == nil {
+		g.Config.Process = &specs.Process{}
+	}
+	penv := newProcessEnv(g.Config.Process.Env, len(env))
+
 	// first deal with special variables that allow user to control $PATH at
 	// runtime (meh... special cases)
 	if prependPath := os.Getenv("SINGULARITYENV_PREPEND_PATH"); prependPath != "" {
-		g.AddProcessEnv("SING_USER_DEFINED_PREPEND_PATH", prependPath)
+		penv.set("SING_USER_DEFINED_PREPEND_PATH", "SING_USER_DEFINED_PREPEND_PATH="+prependPath)
 	}
 
 	if appendPath := os.Getenv("SINGULARITYENV_APPEND_PATH"); appendPath != "" {
-		g.AddProcessEnv("SING_USER_DEFINED_APPEND_PATH", appendPath)
+		penv.set("SING_USER_DEFINED_APPEND_PATH", "SING_USER_DEFINED_APPEND_PATH="+appendPath)
 	}
 
 	if userPath := os.Getenv("SINGULARITYENV_PATH"); userPath != "" {
-		g.AddProcessEnv("SING_USER_DEFINED_PATH", userPath)
+		penv.set("SING_USER_DEFINED_PATH", "SING_USER_DEFINED_PATH="+userPath)
 	}
 
 	for _, env := range env {
@@ -61,19 +97,24 @@ func SetContainerEnv(g *generate.Generator, env []string, cleanEnv bool, homeDes
 			continue
 		}
 
-		// Transpose host env variables into config
-		if addKey, ok := addIfReq(e[0], cleanEnv); ok {
-			g.AddProcessEnv(addKey, e[1])
+		// Transpose host env variables into config, variables with
+		// an unchanged name are kept as is to not copy them
+		if addKey, ok := addIfReq(e[0], cleanEnv); ok && addKey == e[0] {
+			penv.set(addKey, env)
+		} else if ok {
+			penv.set(addKey, addKey+"="+e[1])
 		}
 	}
 
-	g.AddProcessEnv("HOME", homeDest)
-	g.AddProcessEnv("PATH", "/bin:/sbin:/usr/bin:/usr/sbin:/usr/local/bin:/usr/local/sbin")
+	penv.set("HOME", "HOME="+homeDest)
+	penv.set("PATH", "PATH=/bin:/sbin:/usr/bin:/usr/sbin:/usr/local/bin:/usr/local/sbin")
 
 	// Set LANG env
 	if cleanEnv {
-		g.AddProcessEnv("LANG", "C")
+		penv.set("LANG", "LANG=C")
 	}
+
+	g.Config.Process.Env = penv.list
 }
 
 func addIfReq(key string, cleanEnv bool) (string, bool) {
@@ -91,3 +91,29 @@ func equal(a, b []string) bool {
 	}
 	return true
 }
+
+func TestSetContainerEnvLarge(t *testing.T) {
+	ociConfig := &oci.Config{}
+	generator := generate.Generator{Config: &ociConfig.Spec}
+	generator.AddProcessEnv("SINGULARITY_NAME", "old")
+
+	// module systems set thousands of variables
+	value := strings.Repeat("x", 100)
+	env := []string{"SINGULARITYENV_SINGULARITY_NAME=new"}
+	for i := 0; i < 20000; i++ {
+		env = append(env, fmt.Sprintf("VAR%d=%s", i, value))
+	}
+
+	SetContainerEnv(&generator, env, false, "/home/tester")
+
+	// variables plus HOME and PATH
+	if n := len(ociConfig.Process.Env); n != 20003 {
+		t.Fatalf("unexpected number of variables %d", n)
+	}
+	if ociConfig.Process.Env[0] != "SINGULARITY_NAME=new" {
+		t.Errorf("variable not replaced in place: %s", ociConfig.Process.Env[0])
+	}
+	if ociConfig.Process.Env[20000] != "VAR19999="+value {
+		t.Errorf("unexpected variable order")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package env
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadFile reads KEY=VALUE pairs from the environment file path, one
+// per line. Empty lines and lines starting with # are ignored, values
+// are taken verbatim up to the end of line without quote processing.
+func ReadFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open environment file: %s", err)
+	}
+	defer f.Close()
+
+	var environ []string
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimLeft(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		splitted := strings.SplitN(line, "=", 2)
+		if len(splitted) != 2 {
+			return nil, fmt.Errorf("%s:%d: missing '=' in %q", path, n, line)
+		}
+		if splitted[0] == "" || strings.ContainsAny(splitted[0], " \t") {
+			return nil, fmt.Errorf("%s:%d: invalid variable name %q", path, n, splitted[0])
+		}
+		environ = append(environ, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", path, err)
+	}
+
+	return environ, nil
+}
+
+// Merge returns base environment list with variables from environ
+// merged in, a variable from environ replaces the one with the same
+// name in base, otherwise it's appended.
+func Merge(base []string, environ []string) []string {
+	merged := append([]string{}, base...)
+
+	for _, e := range environ {
+		key := strings.SplitN(e, "=", 2)[0] + "="
+		replaced := false
+		for i, b := range merged {
+			if strings.HasPrefix(b, key) {
+				merged[i] = e
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, e)
+		}
+	}
+
+	return merged
+}
+
+// MergeFiles reads environment files in order and merges their
+// variables into base, variables defined in later files take
+// precedence over those defined in earlier files and in base.
+func MergeFiles(base []string, paths []string) ([]string, error) {
+	for _, path := range paths {
+		environ, err := ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		base = Merge(base, environ)
+	}
+	return base, nil
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package env
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestMergeFiles(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		name    string
+		base    []string
+		files   []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "override and append",
+			base:  []string{"PATH=/bin", "HOME=/root"},
+			files: []string{"# comment\n\nHOME=/home/test\nFOO=a=b\n"},
+			want:  []string{"PATH=/bin", "HOME=/home/test", "FOO=a=b"},
+		},
+		{
+			name:  "later file wins",
+			base:  []string{"PATH=/bin"},
+			files: []string{"FOO=first\n", "FOO=second\nBAR=\n"},
+			want:  []string{"PATH=/bin", "FOO=second", "BAR="},
+		},
+		{
+			name:    "missing equal",
+			files:   []string{"FOO\n"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid name",
+			files:   []string{"MY VAR=value\n"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		var paths []string
+
+		for _, content := range tt.files {
+			f, err := ioutil.TempFile("", "envfile-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			f.WriteString(content)
+			f.Close()
+			paths = append(paths, f.Name())
+		}
+
+		got, err := MergeFiles(tt.base, paths)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: unexpected success", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
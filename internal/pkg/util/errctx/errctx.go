@@ -0,0 +1,127 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package errctx attaches operation context (operation, image URI, path)
+// and user-facing remediation hints to errors while retaining their
+// cause chain, so the full chain can be reported down to the syscall.
+package errctx
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/exitcode"
+	"golang.org/x/sys/unix"
+)
+
+// Error wraps an error with the operation and the target (image URI,
+// path ...) it relates to, and an optional remediation hint
+type Error struct {
+	Op     string
+	Target string
+	Hint   string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	msg := e.Op
+	if e.Target != "" {
+		if msg != "" {
+			msg += " "
+		}
+		msg += e.Target
+	}
+	if msg == "" {
+		return e.Err.Error()
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+// Cause returns the wrapped error
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Wrap returns err annotated with the operation and its target,
+// nil is returned if err is nil
+func Wrap(err error, op, target string) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Op: op, Target: target, Err: err}
+}
+
+// WithHint returns err with a remediation hint attached, the error
+// message is left unchanged, nil is returned if err is nil
+func WithHint(err error, hint string) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Hint: hint, Err: err}
+}
+
+// unwrap returns the error wrapped by err if any
+func unwrap(err error) error {
+	switch e := err.(type) {
+	case interface{ Cause() error }:
+		return e.Cause()
+	case *os.PathError:
+		return e.Err
+	case *os.LinkError:
+		return e.Err
+	case *os.SyscallError:
+		return e.Err
+	}
+	return nil
+}
+
+// Hints returns remediation hints attached along the cause chain of err,
+// outermost first
+func Hints(err error) []string {
+	var hints []string
+
+	for ; err != nil; err = unwrap(err) {
+		if e, ok := err.(*Error); ok && e.Hint != "" {
+			hints = append(hints, e.Hint)
+		}
+	}
+	return hints
+}
+
+// Chain returns the messages of each error along the cause chain of err,
+// outermost first, errno are reported with their symbolic name
+func Chain(err error) []string {
+	var chain []string
+
+	for ; err != nil; err = unwrap(err) {
+		msg := err.Error()
+		if errno, ok := err.(syscall.Errno); ok {
+			if name := unix.ErrnoName(errno); name != "" {
+				msg = fmt.Sprintf("%s (%s)", msg, name)
+			}
+		}
+		chain = append(chain, fmt.Sprintf("%T: %s", err, msg))
+	}
+	return chain
+}
+
+// Fatal reports err along with its remediation hints and exits with the
+// exit code associated to err. The full cause chain is reported at debug
+// level.
+func Fatal(err error) {
+	for i, c := range Chain(err) {
+		sylog.Debugf("error chain #%d: %s", i, c)
+	}
+
+	msg := err.Error()
+	if hints := Hints(err); len(hints) > 0 {
+		msg += "\n" + "hint: " + strings.Join(hints, "\nhint: ")
+	}
+
+	exitcode.Fatalf(exitcode.Code(err), "%s", msg)
+}
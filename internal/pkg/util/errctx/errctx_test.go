@@ -0,0 +1,57 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package errctx
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/internal/pkg/util/exitcode"
+)
+
+func TestErrorChain(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	_, cause := os.Open("/non/existent/image.sif")
+
+	err := Wrap(cause, "failed to load image", "library://alpine")
+	err = WithHint(err, "check the image reference")
+	err = exitcode.Wrap(exitcode.ImageNotFound, err)
+	err = Wrap(err, "can't start container", "")
+
+	want := "can't start container: failed to load image library://alpine: open /non/existent/image.sif: no such file or directory"
+	if err.Error() != want {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+
+	if hints := Hints(err); !reflect.DeepEqual(hints, []string{"check the image reference"}) {
+		t.Errorf("unexpected hints %v", hints)
+	}
+
+	if code := exitcode.Code(err); code != exitcode.ImageNotFound {
+		t.Errorf("unexpected exit code %d", code)
+	}
+
+	chain := Chain(err)
+	if len(chain) != 6 {
+		t.Fatalf("unexpected chain length %d: %v", len(chain), chain)
+	}
+	if !strings.HasSuffix(chain[5], "(ENOENT)") {
+		t.Errorf("errno name missing from %q", chain[5])
+	}
+
+	if Wrap(nil, "op", "target") != nil || WithHint(nil, "hint") != nil {
+		t.Errorf("unexpected non nil error")
+	}
+	if e := Wrap(syscall.EPERM, "", ""); e.Error() != syscall.EPERM.Error() {
+		t.Errorf("unexpected message %q", e.Error())
+	}
+}
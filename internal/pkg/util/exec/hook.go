@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os/exec"
 	"time"
 
@@ -18,6 +19,12 @@ import (
 
 // Hook execute an OCI hook command and pass state over stdin.
 func Hook(hook *specs.Hook, state *specs.State) error {
+	return HookWithStderr(hook, state, nil)
+}
+
+// HookWithStderr execute an OCI hook command like Hook and copy the
+// hook standard error to stderr if not nil.
+func HookWithStderr(hook *specs.Hook, state *specs.State, stderr io.Writer) error {
 	var ctx context.Context
 	var cancel context.CancelFunc
 	var timeout time.Duration
@@ -46,6 +53,7 @@ func Hook(hook *specs.Hook, state *specs.State) error {
 	cmd.Stdin = bytes.NewReader(data)
 	cmd.Env = hook.Env
 	cmd.Args = hook.Args
+	cmd.Stderr = stderr
 
 	err = cmd.Start()
 	if err != nil {
@@ -54,7 +62,7 @@ func Hook(hook *specs.Hook, state *specs.State) error {
 
 	err = cmd.Wait()
 	if err != nil {
-		return fmt.Errorf("hook execution failed: %s", err)
+		return fmt.Errorf("hook %s execution failed: %s", hook.Path, err)
 	}
 
 	if ctx != nil && ctx.Err() == context.DeadlineExceeded {
@@ -7,10 +7,12 @@ package exec
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"syscall"
 
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"golang.org/x/sys/unix"
 )
 
 // Pipe execute a command with arguments and pass data over pipe
@@ -46,34 +48,89 @@ func PipeCommand(command string, args []string, env []string, data []byte) (*exe
 	return c, nil
 }
 
-// setPipe sets a pipe communication channel for JSON configuration data and returns
-// the file descriptor of the read side
-func setPipe(data []byte) (int, error) {
-	fd, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+// configFd returns a close-on-exec file descriptor to read JSON
+// configuration data from its beginning. Data are stored in an anonymous
+// memory file so they are never limited by a socket buffer size, a socket
+// pair is used on kernels without memfd_create(2) support.
+func configFd(data []byte) (int, error) {
+	fd, err := unix.MemfdCreate("singularity-config", unix.MFD_CLOEXEC)
+	if err == nil {
+		if err := writeAll(fd, data); err != nil {
+			syscall.Close(fd)
+			return -1, fmt.Errorf("failed to write configuration: %s", err)
+		}
+		if _, err := syscall.Seek(fd, 0, 0); err != nil {
+			syscall.Close(fd)
+			return -1, fmt.Errorf("failed to rewind configuration: %s", err)
+		}
+		return fd, nil
+	} else if err != syscall.ENOSYS && err != syscall.EINVAL {
+		return -1, fmt.Errorf("failed to create configuration file: %s", err)
+	}
+
+	sfd, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
 	if err != nil {
 		return -1, fmt.Errorf("failed to create communication pipe: %s", err)
 	}
+	defer syscall.Close(sfd[0])
 
-	if curSize, err := syscall.GetsockoptInt(fd[0], syscall.SOL_SOCKET, syscall.SO_SNDBUF); err == nil {
-		if curSize <= 65536 {
-			sylog.Warningf("current buffer size is %d, you may encounter some issues", curSize)
-			sylog.Warningf("the minimum recommended value is 65536, you can adjust this value with:")
-			sylog.Warningf("\"echo 65536 > /proc/sys/net/core/wmem_default\"")
-		}
-	} else {
+	// nobody reads the socket before data are written
+	curSize, err := syscall.GetsockoptInt(sfd[0], syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	if err != nil {
+		syscall.Close(sfd[1])
 		return -1, fmt.Errorf("failed to determine current pipe size: %s", err)
 	}
+	if len(data) > curSize {
+		syscall.Close(sfd[1])
+		sylog.Warningf("the minimum recommended value is %d, you can adjust this value with:", len(data))
+		sylog.Warningf("\"echo %d > /proc/sys/net/core/wmem_default\"", len(data))
+		return -1, fmt.Errorf("configuration size %d exceeds pipe buffer size %d", len(data), curSize)
+	}
+
+	if err := writeAll(sfd[0], data); err != nil {
+		syscall.Close(sfd[1])
+		return -1, fmt.Errorf("failed to write data to stdin: %s", err)
+	}
+	return sfd[1], nil
+}
+
+func writeAll(fd int, data []byte) error {
+	for len(data) > 0 {
+		n, err := syscall.Write(fd, data)
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
 
-	pipeFd, err := syscall.Dup(fd[1])
+// ConfigFile returns a file to read JSON configuration data from its
+// beginning, to be passed to the starter
+func ConfigFile(data []byte) (*os.File, error) {
+	fd, err := configFd(data)
 	if err != nil {
-		return -1, fmt.Errorf("failed to duplicate pipe file descriptor: %s", err)
+		return nil, err
 	}
+	return os.NewFile(uintptr(fd), "config"), nil
+}
 
-	if n, err := syscall.Write(fd[0], data); err != nil || n != len(data) {
-		return -1, fmt.Errorf("failed to write data to stdin: %s", err)
+// setPipe sets a communication channel for JSON configuration data and returns
+// the file descriptor of the read side, inherited by executed processes
+func setPipe(data []byte) (int, error) {
+	fd, err := configFd(data)
+	if err != nil {
+		return -1, err
 	}
+	defer syscall.Close(fd)
 
-	return pipeFd, err
+	pipeFd, err := syscall.Dup(fd)
+	if err != nil {
+		return -1, fmt.Errorf("failed to duplicate pipe file descriptor: %s", err)
+	}
+	return pipeFd, nil
 }
 
 // SetPipe sets the PIPE_EXEC_FD environment variable containing the JSON configuration data
@@ -0,0 +1,99 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package exitcode defines the exit status taxonomy of singularity commands.
+//
+// Exit status from 0 to 127 are returned by the user command, 128+N means
+// the user command was terminated by signal N, status from 193 to 196
+// report failures occurring before or around the user command execution
+// and 255 any other singularity failure. Status from 193 are above the
+// signal range and below 255 and the status of commands exiting with
+// small negative values such as -1 or -2.
+package exitcode
+
+import (
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+const (
+	// TimedOut is returned when the container process was stopped
+	// after exceeding its execution timeout
+	TimedOut = 193
+	// OOMKilled is returned when the container process was killed
+	// by the kernel out of memory killer
+	OOMKilled = 194
+	// VerificationFailed is returned when image signature verification
+	// or execution control list checks failed
+	VerificationFailed = 195
+	// ImageNotFound is returned when the container image doesn't exist
+	// locally or in the remote library
+	ImageNotFound = 196
+	// Internal is returned for any other singularity failure
+	Internal = 255
+)
+
+var categories = map[int]string{
+	TimedOut:           "timed-out",
+	OOMKilled:          "oom-killed",
+	VerificationFailed: "verification-failed",
+	ImageNotFound:      "image-not-found",
+	Internal:           "internal",
+}
+
+// Category returns the category name associated to the exit code
+func Category(code int) string {
+	if c, ok := categories[code]; ok {
+		return c
+	}
+	// the highest signal number is 64
+	if code > 128 && code <= 192 {
+		return "signal"
+	}
+	return "command-exit"
+}
+
+// Error associates an exit code to an error
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the underlying error
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Wrap returns err associated to the exit code
+func Wrap(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Code returns the first exit code associated to err or to one of its
+// causes, Internal is returned for errors not created with Wrap
+func Code(err error) int {
+	for err != nil {
+		if e, ok := err.(*Error); ok {
+			return e.Code
+		}
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	return Internal
+}
+
+// Fatalf writes a FATAL level message and exits with the code and its category
+func Fatalf(code int, format string, a ...interface{}) {
+	sylog.FatalCodef(code, Category(code), format, a...)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package exitcode
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestCode(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	err := Wrap(ImageNotFound, fmt.Errorf("no such image"))
+	if c := Code(err); c != ImageNotFound {
+		t.Errorf("unexpected code %d", c)
+	}
+	if err.Error() != "no such image" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	if c := Code(fmt.Errorf("other")); c != Internal {
+		t.Errorf("unexpected code %d for unwrapped error", c)
+	}
+	if Wrap(Internal, nil) != nil {
+		t.Errorf("unexpected non nil error")
+	}
+
+	tests := map[int]string{
+		0:                  "command-exit",
+		1:                  "command-exit",
+		137:                "signal",
+		192:                "signal",
+		254:                "command-exit",
+		TimedOut:           "timed-out",
+		VerificationFailed: "verification-failed",
+		Internal:           "internal",
+	}
+	for code, category := range tests {
+		if c := Category(code); c != category {
+			t.Errorf("unexpected category %q for code %d", c, code)
+		}
+	}
+}
+
+func TestDistinctCodes(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	seen := make(map[int]bool)
+	for _, code := range []int{TimedOut, OOMKilled, VerificationFailed, ImageNotFound, Internal} {
+		if seen[code] {
+			t.Errorf("duplicate exit code %d", code)
+		}
+		seen[code] = true
+
+		// statuses of commands terminated by a signal, the last one
+		// is 128+64, and of commands exiting with -1 to -10 are
+		// not available
+		if code <= 128+64 || (code >= 256-10 && code != Internal) {
+			t.Errorf("exit code %d collides with container command status", code)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"io"
+	"os"
+)
+
+// CopyFile copies the file src to dst, dst is created with mode if it
+// doesn't exist and truncated otherwise
+func CopyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if err := CopyFileContent(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyRangeRW copies size bytes from src at offset srcOff to dst at
+// offset dstOff with regular reads and writes
+func copyRangeRW(dst *os.File, dstOff int64, src *os.File, srcOff int64, size int64) error {
+	buf := make([]byte, 1<<20)
+	for size > 0 {
+		if int64(len(buf)) > size {
+			buf = buf[:size]
+		}
+		n, err := src.ReadAt(buf, srcOff)
+		if n > 0 {
+			if _, err := dst.WriteAt(buf[:n], dstOff); err != nil {
+				return err
+			}
+			srcOff += int64(n)
+			dstOff += int64(n)
+			size -= int64(n)
+		}
+		if err == io.EOF && size > 0 {
+			return io.ErrUnexpectedEOF
+		} else if err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ficlone is the FICLONE ioctl request sharing all data extents of a
+// file with another one on reflink capable filesystems (XFS, Btrfs)
+const ficlone = 0x40049409
+
+// CopyFileContent copies the whole content of src to dst. On reflink
+// capable filesystems both files share the same data extents, making
+// the copy nearly instantaneous whatever the file size. Otherwise
+// copy_file_range lets the kernel copy data without going through user
+// space, a regular copy is done as a last resort
+func CopyFileContent(dst, src *os.File) error {
+	if _, _, err := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd()); err == 0 {
+		return nil
+	}
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	return CopyRange(dst, 0, src, 0, fi.Size())
+}
+
+// CopyRange copies size bytes from src at offset srcOff to dst at offset
+// dstOff, copy_file_range is used when supported which lets reflink
+// capable filesystems share data extents instead of duplicating them
+func CopyRange(dst *os.File, dstOff int64, src *os.File, srcOff int64, size int64) error {
+	for size > 0 {
+		n, err := unix.CopyFileRange(int(src.Fd()), &srcOff, int(dst.Fd()), &dstOff, int(size), 0)
+		if err == syscall.ENOSYS || err == syscall.EXDEV || err == syscall.EINVAL || err == syscall.EOPNOTSUPP {
+			break
+		} else if err != nil {
+			return err
+		} else if n == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		size -= int64(n)
+	}
+	return copyRangeRW(dst, dstOff, src, srcOff, size)
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestCopyFile(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tmpdir, err := ioutil.TempDir("", "copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	content := bytes.Repeat([]byte("singularity"), 1<<17)
+
+	src := filepath.Join(tmpdir, "src")
+	if err := ioutil.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(tmpdir, "dst")
+	if err := ioutil.WriteFile(dst, []byte("previous content longer than nothing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyFile(src, dst, 0644); err != nil {
+		t.Fatalf("unexpected error while copying file: %s", err)
+	}
+	b, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Errorf("copied file content differs from source")
+	}
+
+	if err := CopyFile(filepath.Join(tmpdir, "missing"), dst, 0644); err == nil {
+		t.Errorf("unexpected success while copying a missing file")
+	}
+}
+
+func TestCopyRange(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tmpdir, err := ioutil.TempDir("", "copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	src, err := os.Create(filepath.Join(tmpdir, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if _, err := src.WriteString("0123456789"); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := os.Create(filepath.Join(tmpdir, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	if err := CopyRange(dst, 2, src, 4, 3); err != nil {
+		t.Fatalf("unexpected error while copying range: %s", err)
+	}
+	b, err := ioutil.ReadFile(dst.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte("\x00\x00456")) {
+		t.Errorf("unexpected content %q", b)
+	}
+
+	if err := CopyRange(dst, 0, src, 8, 4); err == nil {
+		t.Errorf("unexpected success while copying past end of file")
+	}
+}
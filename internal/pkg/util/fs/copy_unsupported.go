@@ -0,0 +1,27 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package fs
+
+import (
+	"os"
+)
+
+// CopyFileContent copies the whole content of src to dst
+func CopyFileContent(dst, src *os.File) error {
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	return CopyRange(dst, 0, src, 0, fi.Size())
+}
+
+// CopyRange copies size bytes from src at offset srcOff to dst at offset
+// dstOff
+func CopyRange(dst *os.File, dstOff int64, src *os.File, srcOff int64, size int64) error {
+	return copyRangeRW(dst, dstOff, src, srcOff, size)
+}
@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/sylabs/singularity/internal/pkg/test"
@@ -50,11 +51,11 @@ func TestPasswd(t *testing.T) {
 
 	uid := os.Getuid()
 
-	_, err := Passwd("/fake", "/fake", uid)
+	_, err := Passwd("/fake", "/fake", uid, nil)
 	if err == nil {
 		t.Errorf("should have failed with bad passwd file")
 	}
-	_, err = Passwd("/etc/passwd", "/home", uid)
+	_, err = Passwd("/etc/passwd", "/home", uid, nil)
 	if err != nil {
 		t.Errorf("should have passed with correct passwd file")
 	}
@@ -67,10 +68,27 @@ func TestPasswd(t *testing.T) {
 	defer os.Remove(emptyPasswd)
 	f.Close()
 
-	_, err = Passwd(emptyPasswd, "/home", uid)
+	_, err = Passwd(emptyPasswd, "/home", uid, nil)
 	if err != nil {
 		t.Error(err)
 	}
+
+	// container entries of added users are replaced
+	if err := ioutil.WriteFile(emptyPasswd, []byte("root:x:0:0:root:/root:/bin/sh\nsvc:x:900:900::/:/bin/false"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content, err := Passwd(emptyPasswd, "/home", uid, []string{"root", "svc:x:901:901:service:/srv:/bin/sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "root:x:0:0:") || lines[2] != "svc:x:901:901:service:/srv:/bin/sh" {
+		t.Errorf("unexpected passwd content:\n%s", content)
+	}
+
+	if _, err := Passwd(emptyPasswd, "/home", uid, []string{"svc:x:bad"}); err == nil {
+		t.Errorf("should have failed with bad passwd entry")
+	}
 }
 
 func TestHostname(t *testing.T) {
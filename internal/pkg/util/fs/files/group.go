@@ -1,4 +1,4 @@
-// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
 
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
@@ -16,7 +17,10 @@ import (
 )
 
 // Group creates a group template based on content of file provided in path,
-// updates content with current user information and returns content
+// updates content with current user information and returns content. Groups
+// are resolved by host name services, so groups known only by sssd or LDAP
+// are found. Container entries with the same name or gid as an added group
+// are replaced.
 func Group(path string, uid int, gids []int) (content []byte, err error) {
 	duplicate := false
 	var groups []int
@@ -33,15 +37,11 @@ func Group(path string, uid int, gids []int) (content []byte, err error) {
 	}
 	defer groupFile.Close()
 
-	pwInfo, err := user.GetPwUID(uint32(uid))
+	pwInfo, err := user.GetentPasswd(strconv.Itoa(uid))
 	if err != nil || pwInfo == nil {
 		return content, err
 	}
 	if len(gids) == 0 {
-		grInfo, err := user.GetGrGID(pwInfo.GID)
-		if err != nil || grInfo == nil {
-			return content, err
-		}
 		groups, err = os.Getgroups()
 		if err != nil {
 			return content, err
@@ -65,18 +65,14 @@ func Group(path string, uid int, gids []int) (content []byte, err error) {
 		return content, fmt.Errorf("failed to read group file content in container: %s", err)
 	}
 
-	if len(content) > 0 && content[len(content)-1] != '\n' {
-		content = append(content, '\n')
-	}
-
+	var entries []string
 	for _, gid := range groups {
-		grInfo, err := user.GetGrGID(uint32(gid))
+		grInfo, err := user.GetentGroup(strconv.Itoa(gid))
 		if err != nil || grInfo == nil {
 			sylog.Verbosef("Skipping GID %d as group entry doesn't exist.\n", gid)
 			continue
 		}
-		groupLine := fmt.Sprintf("%s:x:%d:%s\n", grInfo.Name, grInfo.GID, pwInfo.Name)
-		content = append(content, []byte(groupLine)...)
+		entries = append(entries, fmt.Sprintf("%s:x:%d:%s", grInfo.Name, grInfo.GID, pwInfo.Name))
 	}
-	return content, nil
+	return mergeEntries(content, entries, 2), nil
 }
@@ -1,4 +1,4 @@
-// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/sylabs/singularity/internal/pkg/sylog"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
@@ -16,8 +18,12 @@ import (
 )
 
 // Passwd creates a passwd template based on content of file provided in path,
-// updates content with current user information and returns content
-func Passwd(path string, home string, uid int) (content []byte, err error) {
+// updates content with current user information and returns content. User
+// information is resolved by host name services, so users known only by
+// sssd or LDAP are found. Extra entries are either passwd lines or user
+// names and uids resolved on the host. Container entries with the same
+// name or uid as an added entry are replaced.
+func Passwd(path string, home string, uid int, extra []string) (content []byte, err error) {
 	sylog.Verbosef("Checking for template passwd file: %s\n", path)
 	if !fs.IsFile(path) {
 		return content, fmt.Errorf("passwd file doesn't exist in container, not updating")
@@ -35,23 +41,56 @@ func Passwd(path string, home string, uid int) (content []byte, err error) {
 		return content, fmt.Errorf("failed to read passwd file content in container: %s", err)
 	}
 
-	pwInfo, err := user.GetPwUID(uint32(uid))
+	pwInfo, err := user.GetentPasswd(strconv.Itoa(uid))
 	if err != nil {
 		return content, err
 	}
+	entries := []string{pwInfo.PasswdEntry(home)}
 
-	homeDir := pwInfo.Dir
-	if home != "" {
-		homeDir = home
+	for _, e := range extra {
+		var u *user.User
+		if strings.Contains(e, ":") {
+			u, err = user.ParsePasswdEntry(e)
+		} else {
+			u, err = user.GetentPasswd(e)
+		}
+		if err != nil {
+			return content, fmt.Errorf("while adding passwd entry %s: %s", e, err)
+		}
+		entries = append(entries, u.PasswdEntry(""))
 	}
-	userInfo := fmt.Sprintf("%s:x:%d:%d:%s:%s:%s\n", pwInfo.Name, pwInfo.UID, pwInfo.GID, pwInfo.Gecos, homeDir, pwInfo.Shell)
 
-	if len(content) > 0 && content[len(content)-1] != '\n' {
-		content = append(content, '\n')
+	sylog.Verbosef("Creating template passwd file and appending user data: %s\n", path)
+	return mergeEntries(content, entries, 2), nil
+}
+
+// mergeEntries appends entries to the content of a passwd or group file,
+// removing lines of content with the same name or the same identifier,
+// found at index id of colon separated fields, as one of entries
+func mergeEntries(content []byte, entries []string, id int) []byte {
+	names := make(map[string]bool)
+	ids := make(map[string]bool)
+	for _, e := range entries {
+		fields := strings.Split(e, ":")
+		names[fields[0]] = true
+		ids[fields[id]] = true
 	}
 
-	sylog.Verbosef("Creating template passwd file and appending user data: %s\n", path)
-	content = append(content, []byte(userInfo)...)
+	var merged []byte
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) > id && !strings.HasPrefix(fields[0], "#") && (names[fields[0]] || ids[fields[id]]) {
+			sylog.Debugf("Replacing container entry %s", strings.TrimSpace(line))
+			continue
+		}
+		merged = append(merged, line...)
+	}
 
-	return content, nil
+	if len(merged) > 0 && merged[len(merged)-1] != '\n' {
+		merged = append(merged, '\n')
+	}
+	for _, e := range entries {
+		merged = append(merged, e+"\n"...)
+	}
+	return merged
 }
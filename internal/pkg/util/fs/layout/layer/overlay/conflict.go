@@ -0,0 +1,94 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Conflict is a path provided by more than one lower directory, Layers
+// are the indexes of those directories, 0 being the base directory, in
+// order from the lowest to the uppermost one taking precedence
+type Conflict struct {
+	Path   string
+	Layers []int
+}
+
+// lstatLower returns the file info of the relative path p in lower
+// directory dir. Overlay doesn't look beneath files other than directories,
+// so symlinks of parent directories, which could point to host files, are
+// not followed.
+func lstatLower(dir, p string) (os.FileInfo, error) {
+	for _, c := range strings.Split(p, string(os.PathSeparator)) {
+		fi, err := os.Lstat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, os.ErrNotExist
+		}
+		dir = filepath.Join(dir, c)
+	}
+	return os.Lstat(dir)
+}
+
+// FindConflicts returns the paths of lower directories dirs, stacked in
+// order over base, shadowing a path of a directory beneath them. Paths
+// which are directories in all layers are merged by overlay and are not
+// conflicts. Only dirs are walked, base paths are looked up for the
+// paths found in dirs.
+func FindConflicts(base string, dirs []string) ([]Conflict, error) {
+	type entry struct {
+		layers []int
+		dir    bool
+	}
+	paths := make(map[string]*entry)
+
+	for i, d := range dirs {
+		err := filepath.Walk(d, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if path == d {
+					return err
+				}
+				// unreadable directories are skipped
+				return nil
+			}
+			rel, err := filepath.Rel(d, path)
+			if err != nil || rel == "." {
+				return nil
+			}
+			e := paths[rel]
+			if e == nil {
+				e = &entry{dir: true}
+				paths[rel] = e
+			}
+			e.layers = append(e.layers, i+1)
+			e.dir = e.dir && fi.IsDir()
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var conflicts []Conflict
+	for p, e := range paths {
+		if fi, err := lstatLower(base, p); err == nil {
+			e.layers = append([]int{0}, e.layers...)
+			e.dir = e.dir && fi.IsDir()
+		}
+		if len(e.layers) > 1 && !e.dir {
+			conflicts = append(conflicts, Conflict{Path: "/" + p, Layers: e.layers})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Path < conflicts[j].Path
+	})
+	return conflicts, nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package overlay
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func createLayer(t *testing.T, root string, dirs []string, files []string) {
+	for _, d := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range files {
+		p := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindConflicts(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "overlay-conflicts-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	base := filepath.Join(tmp, "base")
+	tools := filepath.Join(tmp, "tools")
+	data := filepath.Join(tmp, "data")
+
+	createLayer(t, base, []string{"opt", "usr/bin"}, []string{"etc/profile", "usr/bin/env"})
+	createLayer(t, tools, []string{"usr/bin"}, []string{"usr/bin/gcc", "etc/profile", "data"})
+	createLayer(t, data, []string{"data", "opt"}, []string{"usr/bin/gcc", "data/set"})
+
+	conflicts, err := FindConflicts(base, []string{tools, data})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []Conflict{
+		{Path: "/data", Layers: []int{1, 2}},
+		{Path: "/etc/profile", Layers: []int{0, 1}},
+		{Path: "/usr/bin/gcc", Layers: []int{1, 2}},
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("unexpected conflicts %v instead of %v", conflicts, expected)
+	}
+
+	// layer directories shadow base symlinks, which are never followed
+	// to host files
+	rootfs := filepath.Join(tmp, "rootfs")
+	layer := filepath.Join(tmp, "layer")
+	createLayer(t, rootfs, nil, []string{"usr/lib/libc.so"})
+	createLayer(t, layer, nil, []string{"lib/libc.so", "hostetc/passwd"})
+	if err := os.Symlink("/usr/lib", filepath.Join(rootfs, "lib")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc", filepath.Join(rootfs, "hostetc")); err != nil {
+		t.Fatal(err)
+	}
+
+	conflicts, err = FindConflicts(rootfs, []string{layer})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = []Conflict{
+		{Path: "/hostetc", Layers: []int{0, 1}},
+		{Path: "/lib", Layers: []int{0, 1}},
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("unexpected conflicts %v instead of %v", conflicts, expected)
+	}
+
+	if _, err := FindConflicts(base, []string{filepath.Join(tmp, "missing")}); err == nil {
+		t.Errorf("unexpected success with a missing layer")
+	}
+}
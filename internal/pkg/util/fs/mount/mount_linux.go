@@ -150,6 +150,7 @@ var authorizedFS = map[string]fsContext{
 	"proc":    {false},
 	"mqueue":  {false},
 	"cgroup":  {false},
+	"cgroup2": {false},
 }
 
 var internalOptions = []string{"loop", "offset", "sizelimit"}
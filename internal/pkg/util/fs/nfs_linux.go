@@ -0,0 +1,22 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"syscall"
+)
+
+// nfsSuperMagic is the filesystem type reported by statfs for NFS
+const nfsSuperMagic = 0x6969
+
+// IsNFS returns whether path resides on a NFS filesystem
+func IsNFS(path string) (bool, error) {
+	st := &syscall.Statfs_t{}
+	if err := syscall.Statfs(path, st); err != nil {
+		return false, err
+	}
+	return st.Type == nfsSuperMagic, nil
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestIsNFS(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	nfs, err := IsNFS("/proc/self")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nfs {
+		t.Errorf("/proc reported as NFS filesystem")
+	}
+	if _, err := IsNFS("/non/existent/path"); err == nil {
+		t.Errorf("no error reported for non existent path")
+	}
+}
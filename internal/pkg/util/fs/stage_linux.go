@@ -0,0 +1,112 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// stageUsersDir returns the directory holding the users of the staged
+// image path
+func stageUsersDir(path string) string {
+	return path + ".users"
+}
+
+// AddStageUser registers a container using the staged image path and
+// returns the user file to pass to RemoveStageUser. The user file holds
+// the PID of the calling process until it's updated by SetStageUserPid,
+// users whose process is gone are pruned. The stage directory must be
+// locked by the caller.
+func AddStageUser(path string) (string, error) {
+	dir := stageUsersDir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if err := pruneStageUsers(dir); err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(dir, "user-")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(strconv.Itoa(os.Getpid()))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// SetStageUserPid records pid as the process using the staged image for
+// user, it's called by the process which releases the image at exit
+func SetStageUserPid(user string, pid int) error {
+	tmp := user + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strconv.Itoa(pid)), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, user)
+}
+
+// pruneStageUsers removes the user files of dir whose process doesn't
+// exist anymore, like containers killed before they released the image
+func pruneStageUsers(dir string) error {
+	users, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if !u.Mode().IsRegular() || !strings.HasPrefix(u.Name(), "user-") {
+			continue
+		}
+		path := filepath.Join(dir, u.Name())
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil || pid <= 0 {
+			continue
+		}
+		if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveStageUser unregisters user of the staged image path and removes
+// the image once it has no user left, it returns true if the image was
+// removed. The stage directory must be locked by the caller.
+func RemoveStageUser(path string, user string) (bool, error) {
+	if err := os.Remove(user); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	dir := stageUsersDir(path)
+	if err := pruneStageUsers(dir); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	users, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if len(users) > 0 {
+		return false, nil
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return false, err
+	}
+	return true, os.RemoveAll(dir)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestStageUsers(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "stage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sha256.digest")
+	if err := ioutil.WriteFile(path, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := AddStageUser(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := AddStageUser(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("same user file %s returned twice", first)
+	}
+
+	if removed, err := RemoveStageUser(path, first); err != nil || removed {
+		t.Errorf("unexpected removal (%v, %v) with a user left", removed, err)
+	}
+	if !IsFile(path) {
+		t.Fatalf("staged image removed with a user left")
+	}
+
+	if removed, err := RemoveStageUser(path, second); err != nil || !removed {
+		t.Errorf("image not removed (%v, %v) once the last user is gone", removed, err)
+	}
+	for _, p := range []string{path, path + ".users"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", p)
+		}
+	}
+
+	// releasing an already removed image
+	if _, err := RemoveStageUser(path, second); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestPruneStageUsers(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "stage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sha256.digest")
+	if err := ioutil.WriteFile(path, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a process which exited
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	dead, err := AddStageUser(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetStageUserPid(dead, cmd.Process.Pid); err != nil {
+		t.Fatal(err)
+	}
+	alive, err := AddStageUser(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dead); !os.IsNotExist(err) {
+		t.Errorf("user %s of an exited process not pruned", dead)
+	}
+	if removed, err := RemoveStageUser(path, alive); err != nil || !removed {
+		t.Errorf("image not removed (%v, %v) once the last live user is gone", removed, err)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package gui locates the X11 and Wayland display sockets, the sound
+// server and the devices of a graphical session, so they can be provided
+// to containers.
+package gui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// X11SocketDir holds the local sockets of X11 servers
+	X11SocketDir = "/tmp/.X11-unix"
+	// ContainerXAuthority is the path where the X authority file of the
+	// user is bound inside containers
+	ContainerXAuthority = "/.singularity.d/Xauthority"
+	// DRIDir holds the direct rendering devices used for hardware
+	// accelerated OpenGL
+	DRIDir = "/dev/dri"
+	// SoundDir holds the ALSA sound devices
+	SoundDir = "/dev/snd"
+	// ContainerPulseCookie is the path where the PulseAudio cookie of the
+	// user is bound inside containers
+	ContainerPulseCookie = "/.singularity.d/pulse-cookie"
+)
+
+// videoDevices matches the video capture and media controller devices
+var videoDevices = regexp.MustCompile(`^/dev/(video|media)[0-9]+$`)
+
+// IsMediaDevice returns if path is the ALSA sound devices directory or a
+// video capture or media controller device.
+func IsMediaDevice(path string) bool {
+	return path == SoundDir || videoDevices.MatchString(path)
+}
+
+// VideoDevices returns the video capture and media controller devices of
+// the host.
+func VideoDevices() []string {
+	var devices []string
+	for _, pattern := range []string{"/dev/video*", "/dev/media*"} {
+		matches, _ := filepath.Glob(pattern)
+		for _, m := range matches {
+			if videoDevices.MatchString(m) {
+				devices = append(devices, m)
+			}
+		}
+	}
+	return devices
+}
+
+// PulseSocket returns the path of the PulseAudio server socket from
+// PULSE_SERVER when it's a local socket, or the native socket of the user
+// runtime directory runtimeDir. An empty string is returned for remote
+// servers.
+func PulseSocket(runtimeDir string) string {
+	servers := strings.Fields(os.Getenv("PULSE_SERVER"))
+	if len(servers) == 0 {
+		return filepath.Join(runtimeDir, "pulse", "native")
+	}
+	// the first server of the list is used
+	server := servers[0]
+	if strings.HasPrefix(server, "unix:") {
+		return strings.TrimPrefix(server, "unix:")
+	}
+	if filepath.IsAbs(server) {
+		return server
+	}
+	return ""
+}
+
+// PulseCookie returns the PulseAudio cookie of the user from PULSE_COOKIE,
+// or the cookie of the configuration directory of the home directory home.
+func PulseCookie(home string) string {
+	if path := os.Getenv("PULSE_COOKIE"); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "pulse", "cookie")
+	}
+	return filepath.Join(home, ".config", "pulse", "cookie")
+}
+
+// Display is an X11 display.
+type Display struct {
+	Host   string
+	Number int
+}
+
+// ParseDisplay parses an X11 display name with the format
+// [host]:number[.screen].
+func ParseDisplay(name string) (Display, error) {
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return Display{}, fmt.Errorf("bad display %q, expected [host]:number[.screen]", name)
+	}
+	number := strings.SplitN(name[i+1:], ".", 2)[0]
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 {
+		return Display{}, fmt.Errorf("bad display number in %q", name)
+	}
+	return Display{Host: name[:i], Number: n}, nil
+}
+
+// IsLocal returns if the display is reached through its local socket
+// rather than TCP.
+func (d Display) IsLocal() bool {
+	return d.Host == "" || d.Host == "unix"
+}
+
+// Socket returns the path of the local socket of the display.
+func (d Display) Socket() string {
+	return filepath.Join(X11SocketDir, "X"+strconv.Itoa(d.Number))
+}
+
+// XAuthority returns the X authority file of the user from XAUTHORITY,
+// or .Xauthority in the home directory home.
+func XAuthority(home string) string {
+	if path := os.Getenv("XAUTHORITY"); path != "" {
+		return path
+	}
+	return filepath.Join(home, ".Xauthority")
+}
+
+// WaylandSocket returns the path of the socket of the Wayland display
+// name, relative names are sockets of the user runtime directory
+// runtimeDir.
+func WaylandSocket(name, runtimeDir string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(runtimeDir, name)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package gui
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseDisplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		display Display
+		local   bool
+		socket  string
+	}{
+		{":0", Display{"", 0}, true, "/tmp/.X11-unix/X0"},
+		{":1.0", Display{"", 1}, true, "/tmp/.X11-unix/X1"},
+		{"unix:2", Display{"unix", 2}, true, "/tmp/.X11-unix/X2"},
+		{"localhost:10.0", Display{"localhost", 10}, false, "/tmp/.X11-unix/X10"},
+		{"[::1]:11", Display{"[::1]", 11}, false, "/tmp/.X11-unix/X11"},
+	}
+	for _, tt := range tests {
+		d, err := ParseDisplay(tt.name)
+		if err != nil {
+			t.Errorf("unexpected failure for %s: %s", tt.name, err)
+			continue
+		}
+		if d != tt.display {
+			t.Errorf("unexpected display for %s: %+v", tt.name, d)
+		}
+		if d.IsLocal() != tt.local {
+			t.Errorf("unexpected IsLocal for %s: %v", tt.name, d.IsLocal())
+		}
+		if d.Socket() != tt.socket {
+			t.Errorf("unexpected socket for %s: %s", tt.name, d.Socket())
+		}
+	}
+
+	for _, name := range []string{"", "0", ":", ":a", "host:-1"} {
+		if _, err := ParseDisplay(name); err == nil {
+			t.Errorf("unexpected success for %q", name)
+		}
+	}
+}
+
+func TestXAuthority(t *testing.T) {
+	env := os.Getenv("XAUTHORITY")
+	defer os.Setenv("XAUTHORITY", env)
+
+	os.Unsetenv("XAUTHORITY")
+	if path := XAuthority("/home/user"); path != "/home/user/.Xauthority" {
+		t.Errorf("unexpected X authority file %s", path)
+	}
+	os.Setenv("XAUTHORITY", "/run/user/1000/gdm/Xauthority")
+	if path := XAuthority("/home/user"); path != "/run/user/1000/gdm/Xauthority" {
+		t.Errorf("unexpected X authority file %s", path)
+	}
+}
+
+func TestWaylandSocket(t *testing.T) {
+	if s := WaylandSocket("wayland-0", "/run/user/1000"); s != "/run/user/1000/wayland-0" {
+		t.Errorf("unexpected Wayland socket %s", s)
+	}
+	if s := WaylandSocket("/tmp/wayland-1", "/run/user/1000"); s != "/tmp/wayland-1" {
+		t.Errorf("unexpected Wayland socket %s", s)
+	}
+}
+
+func TestIsMediaDevice(t *testing.T) {
+	tests := map[string]bool{
+		"/dev/snd":      true,
+		"/dev/video0":   true,
+		"/dev/video12":  true,
+		"/dev/media1":   true,
+		"/dev/snd/pcm":  false,
+		"/dev/video":    false,
+		"/dev/sda":      false,
+		"/dev/../video": false,
+	}
+	for path, want := range tests {
+		if got := IsMediaDevice(path); got != want {
+			t.Errorf("IsMediaDevice(%s) returned %v instead of %v", path, got, want)
+		}
+	}
+}
+
+func TestPulseSocket(t *testing.T) {
+	env := os.Getenv("PULSE_SERVER")
+	defer os.Setenv("PULSE_SERVER", env)
+
+	tests := []struct {
+		server string
+		socket string
+	}{
+		{"", "/run/user/1000/pulse/native"},
+		{"unix:/tmp/pulse.sock", "/tmp/pulse.sock"},
+		{"/tmp/pulse.sock tcp:host", "/tmp/pulse.sock"},
+		{"tcp:host:4713", ""},
+		{"host", ""},
+	}
+	for _, tt := range tests {
+		os.Setenv("PULSE_SERVER", tt.server)
+		if s := PulseSocket("/run/user/1000"); s != tt.socket {
+			t.Errorf("unexpected PulseAudio socket %q for server %q", s, tt.server)
+		}
+	}
+}
+
+func TestPulseCookie(t *testing.T) {
+	cookie := os.Getenv("PULSE_COOKIE")
+	config := os.Getenv("XDG_CONFIG_HOME")
+	defer os.Setenv("PULSE_COOKIE", cookie)
+	defer os.Setenv("XDG_CONFIG_HOME", config)
+
+	os.Unsetenv("PULSE_COOKIE")
+	os.Unsetenv("XDG_CONFIG_HOME")
+	if path := PulseCookie("/home/user"); path != "/home/user/.config/pulse/cookie" {
+		t.Errorf("unexpected PulseAudio cookie %s", path)
+	}
+	os.Setenv("XDG_CONFIG_HOME", "/tmp/config")
+	if path := PulseCookie("/home/user"); path != "/tmp/config/pulse/cookie" {
+		t.Errorf("unexpected PulseAudio cookie %s", path)
+	}
+	os.Setenv("PULSE_COOKIE", "/tmp/cookie")
+	if path := PulseCookie("/home/user"); path != "/tmp/cookie" {
+		t.Errorf("unexpected PulseAudio cookie %s", path)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package krb5 locates the Kerberos credential cache and configuration of
+// a user, so they can be provided to containers.
+package krb5
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FileCache is a credential cache stored in a file
+	FileCache = "FILE"
+	// DirCache is a collection of file credential caches in a directory
+	DirCache = "DIR"
+	// KeyringCache is a credential cache stored in the kernel keyring
+	KeyringCache = "KEYRING"
+	// KCMCache is a credential cache held by a KCM daemon like sssd-kcm
+	KCMCache = "KCM"
+)
+
+// KCMSocket is the socket of the KCM daemon used by MIT and Heimdal
+// Kerberos libraries.
+const KCMSocket = "/var/run/.heim_org.h5l.kcm-socket"
+
+// ContainerCache is the path where file and directory credential caches
+// are bound inside containers.
+const ContainerCache = "/.singularity.d/krb5cc"
+
+// DefaultConf is the Kerberos configuration used when KRB5_CONFIG is
+// not set.
+var DefaultConf = "/etc/krb5.conf"
+
+// Cache is a credential cache name split in its type and residual.
+type Cache struct {
+	Type     string
+	Residual string
+}
+
+// ParseCache parses a credential cache name with the format
+// [TYPE:]residual, a name without type is a file cache.
+func ParseCache(name string) Cache {
+	splitted := strings.SplitN(name, ":", 2)
+	if len(splitted) == 1 || strings.HasPrefix(name, "/") {
+		return Cache{Type: FileCache, Residual: name}
+	}
+	return Cache{Type: strings.ToUpper(splitted[0]), Residual: splitted[1]}
+}
+
+// String returns the credential cache name.
+func (c Cache) String() string {
+	return c.Type + ":" + c.Residual
+}
+
+// IsPath returns if the credential cache is stored in a file or a
+// directory, which can be bound in containers.
+func (c Cache) IsPath() bool {
+	return c.Type == FileCache || c.Type == DirCache
+}
+
+// Conf returns the path of the first existing Kerberos configuration
+// file of KRB5_CONFIG, or DefaultConf, or an empty string if none exist.
+func Conf() string {
+	paths := []string{DefaultConf}
+	if env := os.Getenv("KRB5_CONFIG"); env != "" {
+		paths = filepath.SplitList(env)
+	}
+	for _, p := range paths {
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+			return p
+		}
+	}
+	return ""
+}
+
+// CacheName returns the credential cache name of user uid from
+// KRB5CCNAME, or the default_ccache_name of the Kerberos configuration
+// conf, or the file cache /tmp/krb5cc_<uid>.
+func CacheName(conf string, uid int) string {
+	if name := os.Getenv("KRB5CCNAME"); name != "" {
+		return name
+	}
+	if conf != "" {
+		if name := defaultCacheName(conf); name != "" {
+			return expandCacheName(name, uid)
+		}
+	}
+	return fmt.Sprintf("%s:/tmp/krb5cc_%d", FileCache, uid)
+}
+
+// defaultCacheName returns the default_ccache_name of the libdefaults
+// section of the Kerberos configuration file conf.
+func defaultCacheName(conf string) string {
+	f, err := os.Open(conf)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	section := ""
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if section == "libdefaults" && len(kv) == 2 && strings.TrimSpace(kv[0]) == "default_ccache_name" {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return ""
+}
+
+// expandCacheName replaces the %{uid}, %{euid} and %{USERID} tokens of
+// a cache name by uid.
+func expandCacheName(name string, uid int) string {
+	id := strconv.Itoa(uid)
+	return strings.NewReplacer("%{uid}", id, "%{euid}", id, "%{USERID}", id, "%{EUID}", id).Replace(name)
+}
+
+// Translate copies the credential cache c to a file cache with the
+// translation helper, run as `helper <cache name> <file>`, and returns
+// the name of the file cache. The file is created with a unique name in
+// XDG_RUNTIME_DIR when set, otherwise in the temporary directory, and is
+// only readable by the user, callers remove it once unused.
+func Translate(helper string, c Cache) (Cache, error) {
+	f, err := ioutil.TempFile(os.Getenv("XDG_RUNTIME_DIR"), fmt.Sprintf("krb5cc_%d_singularity_", os.Getuid()))
+	if err != nil {
+		return Cache{}, err
+	}
+	f.Close()
+	path := f.Name()
+
+	out, err := exec.Command(helper, c.String(), path).CombinedOutput()
+	if err != nil {
+		os.Remove(path)
+		return Cache{}, fmt.Errorf("%s failed: %s: %s", helper, err, strings.TrimSpace(string(out)))
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return Cache{}, err
+	}
+	return Cache{Type: FileCache, Residual: path}, nil
+}
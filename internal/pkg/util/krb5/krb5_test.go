@@ -0,0 +1,166 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package krb5
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		cache  Cache
+		isPath bool
+	}{
+		{"/tmp/krb5cc_1000", Cache{FileCache, "/tmp/krb5cc_1000"}, true},
+		{"FILE:/tmp/krb5cc_1000", Cache{FileCache, "/tmp/krb5cc_1000"}, true},
+		{"dir:/run/user/1000/krb5cc", Cache{DirCache, "/run/user/1000/krb5cc"}, true},
+		{"KEYRING:persistent:1000", Cache{KeyringCache, "persistent:1000"}, false},
+		{"KCM:", Cache{KCMCache, ""}, false},
+	}
+
+	for _, tt := range tests {
+		c := ParseCache(tt.name)
+		if c != tt.cache {
+			t.Errorf("unexpected cache for %s: %+v", tt.name, c)
+		}
+		if c.IsPath() != tt.isPath {
+			t.Errorf("unexpected IsPath for %s: %v", tt.name, c.IsPath())
+		}
+	}
+}
+
+func TestCacheName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krb5-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := filepath.Join(dir, "krb5.conf")
+	content := `# default realm
+[libdefaults]
+    default_realm = EXAMPLE.ORG
+    default_ccache_name = KEYRING:persistent:%{uid}
+
+[realms]
+    default_ccache_name = FILE:/wrong
+`
+	if err := ioutil.WriteFile(conf, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := os.Getenv("KRB5CCNAME")
+	defer os.Setenv("KRB5CCNAME", env)
+	os.Unsetenv("KRB5CCNAME")
+
+	if name := CacheName(conf, 1000); name != "KEYRING:persistent:1000" {
+		t.Errorf("unexpected cache name from configuration: %s", name)
+	}
+	if name := CacheName("", 1000); name != "FILE:/tmp/krb5cc_1000" {
+		t.Errorf("unexpected default cache name: %s", name)
+	}
+	os.Setenv("KRB5CCNAME", "DIR:/run/krb5cc")
+	if name := CacheName(conf, 1000); name != "DIR:/run/krb5cc" {
+		t.Errorf("KRB5CCNAME not used: %s", name)
+	}
+}
+
+func TestConf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krb5-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := filepath.Join(dir, "krb5.conf")
+	if err := ioutil.WriteFile(conf, []byte("[libdefaults]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := os.Getenv("KRB5_CONFIG")
+	defer os.Setenv("KRB5_CONFIG", env)
+
+	os.Setenv("KRB5_CONFIG", filepath.Join(dir, "missing")+":"+conf)
+	if c := Conf(); c != conf {
+		t.Errorf("unexpected configuration %q", c)
+	}
+	os.Setenv("KRB5_CONFIG", filepath.Join(dir, "missing"))
+	if c := Conf(); c != "" {
+		t.Errorf("unexpected configuration %q", c)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krb5-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := os.Getenv("XDG_RUNTIME_DIR")
+	defer os.Setenv("XDG_RUNTIME_DIR", env)
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+
+	helper := filepath.Join(dir, "helper")
+	if err := ioutil.WriteFile(helper, []byte("#!/bin/sh\necho \"$1\" > \"$2\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	failing := filepath.Join(dir, "failing")
+	if err := ioutil.WriteFile(failing, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c := Cache{Type: KCMCache, Residual: "1000"}
+
+	first, err := Translate(helper, c)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	second, err := Translate(helper, c)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// concurrent containers must not share the copied cache
+	if first.Residual == second.Residual {
+		t.Errorf("unexpected shared cache %s", first.Residual)
+	}
+
+	for _, cache := range []Cache{first, second} {
+		if cache.Type != FileCache || filepath.Dir(cache.Residual) != dir {
+			t.Errorf("unexpected cache %s", cache)
+		}
+		fi, err := os.Stat(cache.Residual)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Errorf("unexpected cache mode %o", fi.Mode().Perm())
+		}
+		b, err := ioutil.ReadFile(cache.Residual)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != c.String()+"\n" {
+			t.Errorf("unexpected cache content %q", b)
+		}
+	}
+
+	if _, err := Translate(failing, c); err == nil {
+		t.Errorf("unexpected success with failing helper")
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// helper scripts and the two copied caches
+	if len(entries) != 4 {
+		t.Errorf("unexpected %d entries left in %s", len(entries), dir)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package platform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// elfMagic holds the magic and mask matching the ELF header of
+// executables of an architecture, as registered in binfmt_misc by
+// qemu-binfmt-conf.sh.
+var elfMagic = map[string][2]string{
+	"386": {
+		`\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x03\x00`,
+		`\xff\xff\xff\xff\xff\xfe\xfe\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+	"amd64": {
+		`\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x3e\x00`,
+		`\xff\xff\xff\xff\xff\xfe\xfe\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+	"arm": {
+		`\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x28\x00`,
+		`\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+	"arm64": {
+		`\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\xb7\x00`,
+		`\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+	},
+	"ppc64le": {
+		`\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x15\x00`,
+		`\xff\xff\xff\xff\xff\xff\xff\xfc\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\x00`,
+	},
+	"s390x": {
+		`\x7fELF\x02\x02\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x16`,
+		`\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff`,
+	},
+}
+
+// binfmtRegister returns the path of the binfmt_misc registration file.
+func binfmtRegister() string {
+	return filepath.Join(binfmtDir, "register")
+}
+
+// binfmtName returns the name under which the emulator of the qemu
+// architecture name is registered by the current process, removed once
+// the build is done.
+func binfmtName(name string) string {
+	return fmt.Sprintf("singularity-qemu-%s-%d", name, os.Getpid())
+}
+
+// staticEmulator returns the path of the qemu-<arch>-static user mode
+// emulator of the Go architecture arch in dir, which must be absolute.
+func staticEmulator(arch, dir string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("no qemu static path set in singularity.conf")
+	}
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("qemu static path %s in singularity.conf is not an absolute path", dir)
+	}
+	path := filepath.Join(dir, "qemu-"+qemuArch[arch]+"-static")
+	if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("%s not found, install the qemu-user-static package", path)
+	}
+	return path, nil
+}
+
+// RegisterEmulator registers the static qemu user mode emulator of the Go
+// architecture arch found in dir, the qemu static path of singularity.conf,
+// in binfmt_misc when binaries of arch don't run natively on the host and
+// no emulator is registered yet. The emulator is opened at registration
+// (F flag), so it's used in containers which don't provide it. The returned
+// function removes the registration, it's nil when nothing was registered.
+// Registration requires root privileges.
+func RegisterEmulator(arch, dir string) (func() error, error) {
+	if arch == "" || ArchCompatible(runtime.GOARCH, arch) || Emulated(arch) {
+		return nil, nil
+	}
+	magic, ok := elfMagic[arch]
+	if !ok {
+		return nil, fmt.Errorf("emulation of %s architecture is not supported", arch)
+	}
+	emulator, err := staticEmulator(arch, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(binfmtRegister()); os.IsNotExist(err) {
+		if err := syscall.Mount("binfmt_misc", binfmtDir, "binfmt_misc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+			return nil, fmt.Errorf("while mounting binfmt_misc on %s: %s", binfmtDir, err)
+		}
+	}
+
+	name := binfmtName(qemuArch[arch])
+	rule := fmt.Sprintf(":%s:M::%s:%s:%s:F", name, magic[0], magic[1], emulator)
+	if err := ioutil.WriteFile(binfmtRegister(), []byte(rule), 0200); err != nil {
+		return nil, fmt.Errorf("while registering %s in binfmt_misc: %s", emulator, err)
+	}
+
+	unregister := func() error {
+		if err := ioutil.WriteFile(filepath.Join(binfmtDir, name), []byte("-1"), 0200); err != nil {
+			return fmt.Errorf("while unregistering %s from binfmt_misc: %s", emulator, err)
+		}
+		return nil
+	}
+	return unregister, nil
+}
+
+// debianArch maps Go architectures to Debian architecture names when
+// they differ.
+var debianArch = map[string]string{
+	"386":      "i386",
+	"ppc64le":  "ppc64el",
+	"mipsle":   "mipsel",
+	"mips64le": "mips64el",
+}
+
+// DebianArch returns the Debian name of the architecture of platform p.
+func DebianArch(p Platform) string {
+	if p.Architecture == "arm" {
+		if p.Variant == "v5" || p.Variant == "v6" {
+			return "armel"
+		}
+		return "armhf"
+	}
+	if a, ok := debianArch[p.Architecture]; ok {
+		return a
+	}
+	return p.Architecture
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package platform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestRegisterEmulator(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "binfmt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string) { binfmtDir = d }(binfmtDir)
+	binfmtDir = filepath.Join(dir, "binfmt_misc")
+
+	if err := os.Mkdir(binfmtDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(binfmtRegister(), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	foreign := "s390x"
+	if runtime.GOARCH == foreign {
+		foreign = "arm64"
+	}
+
+	if unregister, err := RegisterEmulator(runtime.GOARCH, dir); err != nil || unregister != nil {
+		t.Errorf("unexpected registration for host architecture: %v", err)
+	}
+	if _, err := RegisterEmulator("sparc64", dir); err == nil {
+		t.Errorf("unexpected success with unsupported architecture")
+	}
+	if _, err := RegisterEmulator(foreign, dir); err == nil {
+		t.Errorf("unexpected success without emulator")
+	}
+
+	emulator := filepath.Join(dir, "qemu-"+qemuArch[foreign]+"-static")
+	if err := ioutil.WriteFile(emulator, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RegisterEmulator(foreign, ""); err == nil {
+		t.Errorf("unexpected success without qemu static path")
+	}
+	if _, err := RegisterEmulator(foreign, strings.TrimPrefix(dir, "/")); err == nil {
+		t.Errorf("unexpected success with relative qemu static path")
+	}
+
+	unregister, err := RegisterEmulator(foreign, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := ioutil.ReadFile(binfmtRegister())
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := binfmtName(qemuArch[foreign])
+	rule := string(b)
+	if !strings.HasPrefix(rule, ":"+name+":M::") || !strings.HasSuffix(rule, ":"+emulator+":F") {
+		t.Errorf("unexpected binfmt_misc rule %s", rule)
+	}
+
+	// the kernel creates the entry of the registered emulator
+	entry := filepath.Join(binfmtDir, name)
+	if err := ioutil.WriteFile(entry, []byte("enabled\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !Emulated(foreign) {
+		t.Errorf("registered emulator not found")
+	}
+	if err := unregister(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b, _ := ioutil.ReadFile(entry); string(b) != "-1" {
+		t.Errorf("emulator not unregistered: %q", b)
+	}
+}
+
+func TestDebianArch(t *testing.T) {
+	tests := []struct {
+		platform string
+		arch     string
+	}{
+		{"linux/amd64", "amd64"},
+		{"linux/aarch64", "arm64"},
+		{"linux/arm/v7", "armhf"},
+		{"linux/arm/v6", "armel"},
+		{"linux/ppc64le", "ppc64el"},
+		{"linux/386", "i386"},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.platform)
+		if err != nil {
+			t.Fatalf("unexpected error with %s: %s", tt.platform, err)
+		}
+		if a := DebianArch(p); a != tt.arch {
+			t.Errorf("unexpected architecture %s for %s, expected %s", a, tt.platform, tt.arch)
+		}
+	}
+}
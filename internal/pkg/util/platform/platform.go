@@ -0,0 +1,238 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package platform handles the os/arch/variant triplets identifying
+// which images of a manifest list can run on a host.
+package platform
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Platform identifies the operating system and the CPU architecture
+// an image was built for, using the Go and OCI naming conventions.
+type Platform struct {
+	OS           string
+	Architecture string
+	Variant      string
+}
+
+// archAliases maps the architecture names used by kernels and
+// distributions to their Go names, and an optional variant.
+var archAliases = map[string][2]string{
+	"x86_64":  {"amd64", ""},
+	"x86-64":  {"amd64", ""},
+	"i386":    {"386", ""},
+	"i686":    {"386", ""},
+	"aarch64": {"arm64", ""},
+	"armhf":   {"arm", "v7"},
+	"armel":   {"arm", "v6"},
+	"ppc64el": {"ppc64le", ""},
+}
+
+// qemuArch maps Go architectures to the names of the qemu user mode
+// emulators registered in binfmt_misc.
+var qemuArch = map[string]string{
+	"386":      "i386",
+	"amd64":    "x86_64",
+	"arm":      "arm",
+	"arm64":    "aarch64",
+	"ppc64":    "ppc64",
+	"ppc64le":  "ppc64le",
+	"mips":     "mips",
+	"mipsle":   "mipsel",
+	"mips64":   "mips64",
+	"mips64le": "mips64el",
+	"s390x":    "s390x",
+}
+
+// binfmtDir is where binfmt_misc handlers are registered.
+var binfmtDir = "/proc/sys/fs/binfmt_misc"
+
+// Parse parses a platform specification os/arch[/variant], architecture
+// aliases like x86_64 or aarch64 are accepted.
+func Parse(s string) (Platform, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", s)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", s)
+		}
+	}
+
+	p := Platform{OS: parts[0]}
+	p.Architecture, p.Variant = NormalizeArch(parts[1])
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p.normalize(), nil
+}
+
+// NormalizeArch returns the Go name of an architecture and the variant
+// implied by its alias if any.
+func NormalizeArch(arch string) (string, string) {
+	arch = strings.ToLower(arch)
+	if a, ok := archAliases[arch]; ok {
+		return a[0], a[1]
+	}
+	return arch, ""
+}
+
+// normalize drops the variants which are implied by the architecture.
+func (p Platform) normalize() Platform {
+	if p.Architecture == "arm64" && p.Variant == "v8" {
+		p.Variant = ""
+	}
+	return p
+}
+
+// Host returns the platform of the host.
+func Host() Platform {
+	p := Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+	if p.Architecture == "arm" {
+		p.Variant = armVariant()
+	}
+	return p
+}
+
+// armVariant returns the ARM version of the host CPU read from
+// /proc/cpuinfo, v7 is assumed when it can't be determined.
+func armVariant() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return "v7"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "CPU architecture" {
+			switch v := strings.TrimSpace(kv[1]); v {
+			case "5", "6", "7":
+				return "v" + v
+			}
+			break
+		}
+	}
+	return "v7"
+}
+
+// String returns the os/arch[/variant] representation of a platform.
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// Match returns if platform o is the one requested by p, a variant
+// isn't compared when p doesn't specify one.
+func (p Platform) Match(o Platform) bool {
+	p, o = p.normalize(), o.normalize()
+	if p.OS != o.OS || p.Architecture != o.Architecture {
+		return false
+	}
+	return p.Variant == "" || p.Variant == o.Variant
+}
+
+// Compatible returns if images built for platform o run natively
+// on platform p.
+func (p Platform) Compatible(o Platform) bool {
+	p, o = p.normalize(), o.normalize()
+	if p.OS != o.OS {
+		return false
+	}
+	if !ArchCompatible(p.Architecture, o.Architecture) {
+		return false
+	}
+	if o.Architecture == "arm" && p.Architecture == "arm" && o.Variant != "" && p.Variant != "" {
+		// older ARM versions are supported by newer CPUs
+		return o.Variant <= p.Variant
+	}
+	return true
+}
+
+// ArchCompatible returns if binaries built for the Go architecture
+// arch run natively on a CPU of architecture host.
+func ArchCompatible(host, arch string) bool {
+	switch {
+	case host == arch:
+		return true
+	case host == "amd64" && arch == "386":
+		return true
+	case host == "arm64" && arch == "arm":
+		return true
+	}
+	return false
+}
+
+// Emulated returns if a qemu user mode emulator is registered and
+// enabled in binfmt_misc for the Go architecture arch, by the host or
+// for a running build.
+func Emulated(arch string) bool {
+	name, ok := qemuArch[arch]
+	if !ok {
+		return false
+	}
+	entries, _ := filepath.Glob(filepath.Join(binfmtDir, "singularity-qemu-"+name+"-*"))
+	for _, entry := range append([]string{filepath.Join(binfmtDir, "qemu-"+name)}, entries...) {
+		b, err := ioutil.ReadFile(entry)
+		if err == nil && strings.HasPrefix(string(b), "enabled") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHost returns whether a container for the Go architecture arch
+// runs on the host under emulation, or an error if it can't run at all.
+// Emulation is refused when strict is set.
+func CheckHost(arch string, strict bool) (bool, error) {
+	host := runtime.GOARCH
+	if arch == "" || ArchCompatible(host, arch) {
+		return false, nil
+	}
+	if strict {
+		return false, fmt.Errorf("%s image can't run natively on %s host and strict platform mode refuses emulation", arch, host)
+	}
+	if !Emulated(arch) {
+		return false, fmt.Errorf("%s image can't run on %s host: no emulator registered in binfmt_misc", arch, host)
+	}
+	return true, nil
+}
+
+// Select returns the index of the platform matching want in available.
+// Unless strict is set, the first platform compatible with want is
+// selected when none matches. The error lists the available platforms.
+func Select(available []Platform, want Platform, strict bool) (int, error) {
+	for i, p := range available {
+		if want.Match(p) {
+			return i, nil
+		}
+	}
+	if !strict {
+		for i, p := range available {
+			if want.Compatible(p) {
+				return i, nil
+			}
+		}
+	}
+
+	names := make([]string, len(available))
+	for i, p := range available {
+		names[i] = p.String()
+	}
+	return -1, fmt.Errorf("no image for platform %s in manifest list, available platforms: %s", want, strings.Join(names, ", "))
+}
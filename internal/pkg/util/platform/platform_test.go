@@ -0,0 +1,139 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package platform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestParse(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		in       string
+		expected Platform
+		fail     bool
+	}{
+		{in: "linux/amd64", expected: Platform{"linux", "amd64", ""}},
+		{in: "linux/x86_64", expected: Platform{"linux", "amd64", ""}},
+		{in: "Linux/ARM/v6", expected: Platform{"linux", "arm", "v6"}},
+		{in: "linux/armhf", expected: Platform{"linux", "arm", "v7"}},
+		{in: "linux/aarch64/v8", expected: Platform{"linux", "arm64", ""}},
+		{in: "amd64", fail: true},
+		{in: "linux//v7", fail: true},
+		{in: "linux/arm/v7/extra", fail: true},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.in)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("unexpected success for %q", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.in, err)
+		} else if p != tt.expected {
+			t.Errorf("unexpected platform %s for %q, expected %s", p, tt.in, tt.expected)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	available := []Platform{
+		{"linux", "amd64", ""},
+		{"linux", "arm", "v6"},
+		{"linux", "arm", "v7"},
+		{"linux", "arm64", "v8"},
+		{"linux", "386", ""},
+	}
+
+	tests := []struct {
+		want     string
+		strict   bool
+		expected int
+	}{
+		{"linux/amd64", true, 0},
+		{"linux/arm/v7", true, 2},
+		{"linux/arm", true, 1},
+		{"linux/arm64", true, 3},
+		{"linux/arm/v5", false, -1},
+		{"linux/s390x", false, -1},
+	}
+	for _, tt := range tests {
+		want, _ := Parse(tt.want)
+		i, err := Select(available, want, tt.strict)
+		if i != tt.expected {
+			t.Errorf("unexpected index %d for %s, expected %d", i, tt.want, tt.expected)
+		}
+		if i < 0 && err == nil {
+			t.Errorf("unexpected success for %s", tt.want)
+		}
+	}
+
+	// compatible platforms are only selected in non strict mode
+	available = []Platform{{"linux", "arm", "v6"}, {"linux", "386", ""}}
+	want := Platform{"linux", "arm", "v7"}
+	if i, err := Select(available, want, false); i != 0 || err != nil {
+		t.Errorf("unexpected selection %d: %v", i, err)
+	}
+	if _, err := Select(available, want, true); err == nil || err.Error() != "no image for platform linux/arm/v7 in manifest list, available platforms: linux/arm/v6, linux/386" {
+		t.Errorf("unexpected error in strict mode: %v", err)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "binfmt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string) { binfmtDir = d }(binfmtDir)
+	binfmtDir = dir
+
+	foreign := "s390x"
+	if runtime.GOARCH == foreign {
+		foreign = "amd64"
+	}
+
+	if emulated, err := CheckHost(runtime.GOARCH, true); emulated || err != nil {
+		t.Errorf("unexpected result for host architecture: %v %v", emulated, err)
+	}
+	if _, err := CheckHost(foreign, false); err == nil {
+		t.Errorf("unexpected success without emulator")
+	}
+
+	handler := filepath.Join(dir, "qemu-"+qemuArch[foreign])
+	if err := ioutil.WriteFile(handler, []byte("enabled\ninterpreter /usr/bin/qemu\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if emulated, err := CheckHost(foreign, false); !emulated || err != nil {
+		t.Errorf("unexpected result with emulator: %v %v", emulated, err)
+	}
+	if _, err := CheckHost(foreign, true); err == nil {
+		t.Errorf("unexpected success in strict mode")
+	}
+
+	if err := ioutil.WriteFile(handler, []byte("disabled\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckHost(foreign, false); err == nil {
+		t.Errorf("unexpected success with disabled emulator")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package retry
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/loop"
+)
+
+// Policy describes how an operation failing with a transient
+// error is retried.
+type Policy struct {
+	// Attempts is the maximum number of times the operation is run
+	Attempts int
+	// Delay is the minimal delay between two attempts
+	Delay time.Duration
+	// Jitter is the maximal random delay added to Delay
+	Jitter time.Duration
+}
+
+// DefaultPolicy is the policy used during container startup.
+var DefaultPolicy = Policy{
+	Attempts: 5,
+	Delay:    100 * time.Millisecond,
+	Jitter:   150 * time.Millisecond,
+}
+
+// Error is returned when an operation still fails after all
+// attempts or with a non transient error.
+type Error struct {
+	Op        string
+	Attempts  int
+	Transient bool
+	Err       error
+}
+
+func (e *Error) Error() string {
+	if e.Transient {
+		return fmt.Sprintf("%s failed after %d attempts: %s", e.Op, e.Attempts, e.Err)
+	}
+	return fmt.Sprintf("%s failed: %s", e.Op, e.Err)
+}
+
+// Cause returns the error returned by the last attempt.
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// IsTransient returns if err is a startup failure that may
+// disappear by retrying the same operation a bit later, like loop
+// devices exhaustion, busy mount points, cgroup races or stale NFS
+// file handles.
+func IsTransient(err error) bool {
+	switch e := errors.Cause(err).(type) {
+	case syscall.Errno:
+		return e == syscall.EBUSY || e == syscall.EAGAIN || e == syscall.EINTR || e == syscall.ESTALE
+	case *os.PathError:
+		return IsTransient(e.Err)
+	case *os.SyscallError:
+		return IsTransient(e.Err)
+	case *os.LinkError:
+		return IsTransient(e.Err)
+	}
+	return errors.Cause(err) == loop.ErrNoLoopDevices
+}
+
+// Do runs fn until it succeeds, returns a non transient error or
+// the number of attempts is exhausted. On failure the returned error
+// is an *Error.
+func (p Policy) Do(op string, fn func() error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+
+	for i := 1; i <= attempts; i++ {
+		if err = fn(); err == nil {
+			if i > 1 {
+				sylog.Verbosef("%s succeeded after %d attempts", op, i)
+			}
+			return nil
+		}
+		if !IsTransient(err) {
+			return &Error{Op: op, Attempts: i, Err: err}
+		}
+		if i == attempts {
+			break
+		}
+		delay := p.Delay
+		if p.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(p.Jitter)))
+		}
+		sylog.Verbosef("%s failed with a transient error (attempt %d/%d): %s, retrying in %s", op, i, attempts, err, delay)
+		time.Sleep(delay)
+	}
+
+	return &Error{Op: op, Attempts: attempts, Transient: true, Err: err}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package retry
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/util/loop"
+)
+
+func TestIsTransient(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"EBUSY", syscall.EBUSY, true},
+		{"EAGAIN", syscall.EAGAIN, true},
+		{"ESTALE", syscall.ESTALE, true},
+		{"ENOENT", syscall.ENOENT, false},
+		{"PathError", &os.PathError{Op: "mkdir", Path: "/sys/fs/cgroup", Err: syscall.EBUSY}, true},
+		{"NoLoopDevices", loop.ErrNoLoopDevices, true},
+		{"WrappedNoLoopDevices", errors.Wrap(loop.ErrNoLoopDevices, "attach"), true},
+		{"Generic", fmt.Errorf("generic error"), false},
+	}
+
+	for _, tt := range tests {
+		if IsTransient(tt.err) != tt.transient {
+			t.Errorf("unexpected transient result for %s", tt.name)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	p := Policy{Attempts: 3}
+
+	calls := 0
+	err := p.Do("test", func() error {
+		calls++
+		if calls < 2 {
+			return syscall.EBUSY
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("unexpected result: %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = p.Do("test", func() error {
+		calls++
+		return syscall.EBUSY
+	})
+	if e, ok := err.(*Error); !ok || !e.Transient || e.Attempts != 3 || calls != 3 {
+		t.Errorf("unexpected result: %v after %d calls", err, calls)
+	}
+	if errors.Cause(err) != syscall.EBUSY {
+		t.Errorf("unexpected error cause: %v", errors.Cause(err))
+	}
+
+	calls = 0
+	err = p.Do("test", func() error {
+		calls++
+		return syscall.ENOENT
+	})
+	if e, ok := err.(*Error); !ok || e.Transient || calls != 1 {
+		t.Errorf("unexpected result: %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package scheduler exposes the job of the batch scheduler running
+// singularity through a set of variables common to all schedulers, and
+// expands them in bind paths and environment values.
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Vars are the job variables available to templates as {{.Name}}
+type Vars struct {
+	// Scheduler is slurm, pbs, lsf or sge, empty outside of a job
+	Scheduler string
+	// JobID is the job identifier
+	JobID string
+	// ArrayTaskID is the index of the task in a job array
+	ArrayTaskID string
+	// JobName is the name given to the job
+	JobName string
+	// NodeName is the name of the node running the job
+	NodeName string
+	// TmpDir is the job temporary directory, TMPDIR or /tmp by default
+	TmpDir string
+	// NumTasks is the number of tasks of the job
+	NumTasks string
+	// Rank is the rank of the task within the job
+	Rank string
+}
+
+// scheduler maps Vars fields to the environment variables of a scheduler,
+// the first set variable is used
+type scheduler struct {
+	name    string
+	detect  string
+	vars    map[string][]string
+	tmpVars []string
+}
+
+var schedulers = []scheduler{
+	{
+		name:   "slurm",
+		detect: "SLURM_JOB_ID",
+		vars: map[string][]string{
+			"JobID":       {"SLURM_JOB_ID"},
+			"ArrayTaskID": {"SLURM_ARRAY_TASK_ID"},
+			"JobName":     {"SLURM_JOB_NAME"},
+			"NodeName":    {"SLURMD_NODENAME"},
+			"NumTasks":    {"SLURM_NTASKS"},
+			"Rank":        {"SLURM_PROCID"},
+		},
+		tmpVars: []string{"SLURM_TMPDIR", "TMPDIR"},
+	},
+	{
+		name:   "pbs",
+		detect: "PBS_JOBID",
+		vars: map[string][]string{
+			"JobID":       {"PBS_JOBID"},
+			"ArrayTaskID": {"PBS_ARRAY_INDEX", "PBS_ARRAYID"},
+			"JobName":     {"PBS_JOBNAME"},
+			"NumTasks":    {"PBS_NP"},
+			"Rank":        {"PBS_TASKNUM"},
+		},
+		tmpVars: []string{"PBS_TMPDIR", "TMPDIR"},
+	},
+	{
+		name:   "lsf",
+		detect: "LSB_JOBID",
+		vars: map[string][]string{
+			"JobID":       {"LSB_JOBID"},
+			"ArrayTaskID": {"LSB_JOBINDEX"},
+			"JobName":     {"LSB_JOBNAME"},
+			"NumTasks":    {"LSB_DJOB_NUMPROC"},
+		},
+		tmpVars: []string{"LSF_TMPDIR", "TMPDIR"},
+	},
+	{
+		name:   "sge",
+		detect: "SGE_O_WORKDIR",
+		vars: map[string][]string{
+			"JobID":       {"JOB_ID"},
+			"ArrayTaskID": {"SGE_TASK_ID"},
+			"JobName":     {"JOB_NAME"},
+			"NumTasks":    {"NSLOTS"},
+		},
+		tmpVars: []string{"TMPDIR"},
+	},
+}
+
+// Detect returns the variables of the job of the scheduler identified
+// from the environment returned by getenv
+func Detect(getenv func(string) string) Vars {
+	first := func(keys []string) string {
+		for _, k := range keys {
+			if v := getenv(k); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	v := Vars{
+		TmpDir: first([]string{"TMPDIR"}),
+	}
+	for _, s := range schedulers {
+		if getenv(s.detect) == "" {
+			continue
+		}
+		v.Scheduler = s.name
+		v.JobID = first(s.vars["JobID"])
+		v.ArrayTaskID = first(s.vars["ArrayTaskID"])
+		v.JobName = first(s.vars["JobName"])
+		v.NodeName = first(s.vars["NodeName"])
+		v.NumTasks = first(s.vars["NumTasks"])
+		v.Rank = first(s.vars["Rank"])
+		v.TmpDir = first(s.tmpVars)
+		break
+	}
+	// SGE sets the task ID of jobs which are not array jobs
+	if v.ArrayTaskID == "undefined" {
+		v.ArrayTaskID = ""
+	}
+	if v.NodeName == "" {
+		v.NodeName, _ = os.Hostname()
+	}
+	if v.TmpDir == "" {
+		v.TmpDir = "/tmp"
+	}
+	return v
+}
+
+// Environ returns the job variables to set in the container environment
+// so scripts don't depend on the scheduler
+func (v Vars) Environ() []string {
+	if v.Scheduler == "" {
+		return nil
+	}
+	return []string{
+		"SINGULARITY_SCHEDULER=" + v.Scheduler,
+		"SINGULARITY_JOB_ID=" + v.JobID,
+		"SINGULARITY_JOB_ARRAY_TASK_ID=" + v.ArrayTaskID,
+		"SINGULARITY_JOB_NAME=" + v.JobName,
+		"SINGULARITY_JOB_NODE_NAME=" + v.NodeName,
+		"SINGULARITY_JOB_TMPDIR=" + v.TmpDir,
+		"SINGULARITY_JOB_NUM_TASKS=" + v.NumTasks,
+		"SINGULARITY_JOB_RANK=" + v.Rank,
+	}
+}
+
+// ExpandTemplate replaces the {{.Name}} templates of s by the job
+// variables, s is returned unchanged if it doesn't contain templates
+func (v Vars) ExpandTemplate(s string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	t, err := template.New("").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, v); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// ExpandPath replaces the {{.Name}} templates of the path s by the job
+// variables, and its $VAR and ${VAR} references by the value of
+// environment variables returned by getenv, undefined variables are
+// reported as errors
+func (v Vars) ExpandPath(s string, getenv func(string) string) (string, error) {
+	s, err := v.ExpandTemplate(s)
+	if err != nil {
+		return "", err
+	}
+	var undefined []string
+	s = os.Expand(s, func(key string) string {
+		val := getenv(key)
+		if val == "" {
+			undefined = append(undefined, key)
+		}
+		return val
+	})
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("undefined variable %s", strings.Join(undefined, ", "))
+	}
+	return s, nil
+}
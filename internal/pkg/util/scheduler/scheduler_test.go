@@ -0,0 +1,107 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package scheduler
+
+import (
+	"testing"
+)
+
+func getenv(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want Vars
+	}{
+		{
+			name: "none",
+			env:  map[string]string{},
+			want: Vars{NodeName: "host", TmpDir: "/tmp"},
+		},
+		{
+			name: "slurm",
+			env: map[string]string{
+				"SLURM_JOB_ID":        "42",
+				"SLURM_ARRAY_TASK_ID": "3",
+				"SLURM_JOB_NAME":      "job",
+				"SLURMD_NODENAME":     "node1",
+				"SLURM_TMPDIR":        "/local/42",
+				"TMPDIR":              "/scratch",
+				"SLURM_NTASKS":        "4",
+				"SLURM_PROCID":        "1",
+			},
+			want: Vars{Scheduler: "slurm", JobID: "42", ArrayTaskID: "3", JobName: "job", NodeName: "node1", TmpDir: "/local/42", NumTasks: "4", Rank: "1"},
+		},
+		{
+			name: "pbs",
+			env: map[string]string{
+				"PBS_JOBID":   "7.server",
+				"PBS_ARRAYID": "2",
+				"TMPDIR":      "/scratch",
+			},
+			want: Vars{Scheduler: "pbs", JobID: "7.server", ArrayTaskID: "2", NodeName: "host", TmpDir: "/scratch"},
+		},
+		{
+			name: "sge",
+			env: map[string]string{
+				"SGE_O_WORKDIR": "/home/user",
+				"JOB_ID":        "9",
+				"SGE_TASK_ID":   "undefined",
+			},
+			want: Vars{Scheduler: "sge", JobID: "9", NodeName: "host", TmpDir: "/tmp"},
+		},
+	}
+	for _, tt := range tests {
+		v := Detect(getenv(tt.env))
+		if v.NodeName != "" && tt.want.NodeName == "host" {
+			tt.want.NodeName = v.NodeName
+		}
+		if v != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, v, tt.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	v := Vars{Scheduler: "slurm", JobID: "42", TmpDir: "/local/42"}
+	env := getenv(map[string]string{"SLURM_TMPDIR": "/local/42"})
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "/data:/data", want: "/data:/data"},
+		{path: "{{.TmpDir}}:/scratch", want: "/local/42:/scratch"},
+		{path: "$SLURM_TMPDIR:/scratch", want: "/local/42:/scratch"},
+		{path: "/out/{{.JobID}}-${SLURM_TMPDIR}:/out", want: "/out/42-/local/42:/out"},
+		{path: "$UNDEFINED:/scratch", wantErr: true},
+		{path: "{{.Unknown}}:/scratch", wantErr: true},
+		{path: "{{.JobID:/scratch", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := v.ExpandPath(tt.path, env)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: unexpected success", tt.path)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+
+	// environment values keep their $ references
+	if got, err := v.ExpandTemplate("$HOME/{{.JobID}}"); err != nil || got != "$HOME/42" {
+		t.Errorf("unexpected template expansion %q %v", got, err)
+	}
+}
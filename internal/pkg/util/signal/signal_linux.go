@@ -48,10 +48,13 @@ var signalMap = map[string]syscall.Signal{
 
 const signalMax = syscall.SIGSYS
 
-// Convert converts a signal string to corresponding signal number
+// Convert converts a signal string to corresponding signal number,
+// signal names are case insensitive and may omit the SIG prefix
 func Convert(sig string) (syscall.Signal, error) {
 	var sigNum syscall.Signal
 
+	sig = strings.ToUpper(sig)
+
 	if strings.HasPrefix(sig, "SIG") {
 		if sigNum, ok := signalMap[sig]; ok {
 			return sigNum, nil
@@ -71,3 +74,14 @@ func Convert(sig string) (syscall.Signal, error) {
 
 	return sigNum, fmt.Errorf("can't convert %s to signal number", sig)
 }
+
+// Name returns the name of a signal number, the signal number is
+// returned as string for unknown signals
+func Name(sig syscall.Signal) string {
+	for name, sigNum := range signalMap {
+		if sigNum == sig {
+			return name
+		}
+	}
+	return strconv.Itoa(int(sig))
+}
@@ -28,7 +28,7 @@ var signalOK = []struct {
 	{[]string{"SIGUSR2", "USR2", "12"}, syscall.SIGUSR2},
 	{[]string{"SIGPIPE", "PIPE", "13"}, syscall.SIGPIPE},
 	{[]string{"SIGALRM", "ALRM", "14"}, syscall.SIGALRM},
-	{[]string{"SIGTERM", "TERM", "15"}, syscall.SIGTERM},
+	{[]string{"SIGTERM", "TERM", "15", "term", "SigTerm"}, syscall.SIGTERM},
 	{[]string{"SIGSTKFLT", "STKFLT", "16"}, syscall.SIGSTKFLT},
 	{[]string{"SIGCHLD", "CHLD", "17"}, syscall.SIGCHLD},
 	{[]string{"SIGCONT", "CONT", "18"}, syscall.SIGCONT},
@@ -51,7 +51,7 @@ var signalKO = []struct {
 	tests  []string
 	signal syscall.Signal
 }{
-	{[]string{"SIGNULL", "NULL", "0"}, 0},
+	{[]string{"SIGNULL", "NULL", "0", "sig"}, 0},
 }
 
 func TestConvert(t *testing.T) {
@@ -70,3 +70,14 @@ func TestConvert(t *testing.T) {
 		}
 	}
 }
+
+func TestName(t *testing.T) {
+	for _, test := range signalOK {
+		if name := Name(test.signal); name != test.tests[0] {
+			t.Errorf("unexpected name %s for signal %d", name, test.signal)
+		}
+	}
+	if name := Name(syscall.Signal(64)); name != "64" {
+		t.Errorf("unexpected name %s for signal 64", name)
+	}
+}
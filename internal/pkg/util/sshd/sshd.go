@@ -0,0 +1,200 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package sshd prepares the configuration, host key and command of a user
+// scoped OpenSSH server running inside an instance.
+package sshd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ContainerDir is the path where the server state directory is bound
+// inside containers.
+const ContainerDir = "/.singularity.d/sshd"
+
+const (
+	// ConfigFile is the server configuration of the state directory
+	ConfigFile = "sshd_config"
+	// HostKeyFile is the host private key of the state directory
+	HostKeyFile = "ssh_host_ecdsa_key"
+	// AuthorizedKeysFile is the file of the state directory where the
+	// authorized keys of the user are bound
+	AuthorizedKeysFile = "authorized_keys"
+)
+
+// DefaultAddress is the address the server listens on when none is given,
+// other hosts reach it by jumping through the host.
+const DefaultAddress = "127.0.0.1"
+
+// hostKeyType is the SSH name of the ECDSA P-256 host key
+const hostKeyType = "ecdsa-sha2-nistp256"
+
+// Listen is the address and port the server listens on, a zero port is
+// replaced by a free port of the host.
+type Listen struct {
+	Address string
+	Port    int
+}
+
+// ParseListen parses a listen specification with the format
+// [[address]:]port, an empty specification selects a free port.
+func ParseListen(spec string) (Listen, error) {
+	l := Listen{Address: DefaultAddress}
+	if spec == "" {
+		return l, nil
+	}
+
+	port := spec
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		if addr := strings.Trim(spec[:i], "[]"); addr != "" {
+			if net.ParseIP(addr) == nil {
+				return l, fmt.Errorf("bad sshd address %q", addr)
+			}
+			l.Address = addr
+		}
+		port = spec[i+1:]
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 0 || p > 65535 {
+		return l, fmt.Errorf("bad sshd port %q", port)
+	}
+	l.Port = p
+	return l, nil
+}
+
+// String returns the host:port form of the address
+func (l Listen) String() string {
+	return net.JoinHostPort(l.Address, strconv.Itoa(l.Port))
+}
+
+// Resolve returns l with a free port of the host when it has no port.
+func (l Listen) Resolve() (Listen, error) {
+	if l.Port != 0 {
+		return l, nil
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(l.Address, "0"))
+	if err != nil {
+		return l, fmt.Errorf("while looking for a free port: %s", err)
+	}
+	defer ln.Close()
+	l.Port = ln.Addr().(*net.TCPAddr).Port
+	return l, nil
+}
+
+// WriteConfig writes a server configuration listening on l to w. Only
+// public key authentication is enabled, an unprivileged server can only
+// log in the user running it.
+func WriteConfig(w io.Writer, l Listen) error {
+	_, err := fmt.Fprintf(w, `# generated by singularity instance start --sshd
+ListenAddress %s
+HostKey %s
+AuthorizedKeysFile %s
+PidFile none
+UsePAM no
+PasswordAuthentication no
+ChallengeResponseAuthentication no
+PubkeyAuthentication yes
+AllowTcpForwarding yes
+PrintMotd no
+Subsystem sftp internal-sftp
+`, l.String(), filepath.Join(ContainerDir, HostKeyFile), filepath.Join(ContainerDir, AuthorizedKeysFile))
+	return err
+}
+
+// GenerateHostKey writes an ECDSA host private key to path, unless the
+// file already exists so host keys are stable between instance restarts.
+// It returns the public key in authorized_keys format.
+func GenerateHostKey(path string) (string, error) {
+	if b, err := ioutil.ReadFile(path); err == nil {
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return "", fmt.Errorf("no PEM data found in %s", path)
+		}
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("while parsing host key %s: %s", path, err)
+		}
+		return PublicKey(&key.PublicKey), nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("while generating host key: %s", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	// sshd refuses host keys readable by others
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("while writing host key: %s", err)
+	}
+	return PublicKey(&key.PublicKey), nil
+}
+
+// publicKeyBlob returns the SSH wire format of an ECDSA P-256 public key
+func publicKeyBlob(key *ecdsa.PublicKey) []byte {
+	var b bytes.Buffer
+	for _, s := range [][]byte{
+		[]byte(hostKeyType),
+		[]byte("nistp256"),
+		elliptic.Marshal(key.Curve, key.X, key.Y),
+	} {
+		binary.Write(&b, binary.BigEndian, uint32(len(s)))
+		b.Write(s)
+	}
+	return b.Bytes()
+}
+
+// PublicKey returns an ECDSA P-256 public key in authorized_keys format.
+func PublicKey(key *ecdsa.PublicKey) string {
+	return hostKeyType + " " + base64.StdEncoding.EncodeToString(publicKeyBlob(key))
+}
+
+// Fingerprint returns the SHA256 fingerprint of a public key in
+// authorized_keys format, as printed by ssh.
+func Fingerprint(publicKey string) (string, error) {
+	fields := strings.Fields(publicKey)
+	if len(fields) < 2 {
+		return "", fmt.Errorf("bad public key %q", publicKey)
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("bad public key: %s", err)
+	}
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// Path is the location of the OpenSSH server in the container, it must be
+// absolute for sshd to re-execute itself for each connection
+const Path = "/usr/sbin/sshd"
+
+// Command returns the command running the server in the foreground as the
+// instance process, through the exec action script so the environment of
+// the container is set.
+func Command() []string {
+	return []string{"/.singularity.d/actions/exec", Path, "-D", "-e", "-f", ContainerDir + "/" + ConfigFile}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sshd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseListen(t *testing.T) {
+	tests := []struct {
+		spec    string
+		listen  Listen
+		wantErr bool
+	}{
+		{"", Listen{DefaultAddress, 0}, false},
+		{":0", Listen{DefaultAddress, 0}, false},
+		{"2222", Listen{DefaultAddress, 2222}, false},
+		{":2222", Listen{DefaultAddress, 2222}, false},
+		{"0.0.0.0:2222", Listen{"0.0.0.0", 2222}, false},
+		{"[::1]:2222", Listen{"::1", 2222}, false},
+		{"host:2222", Listen{}, true},
+		{":ssh", Listen{}, true},
+		{"70000", Listen{}, true},
+	}
+	for _, tt := range tests {
+		l, err := ParseListen(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("unexpected success for %q", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.spec, err)
+		} else if l != tt.listen {
+			t.Errorf("unexpected listen %v for %q", l, tt.spec)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	l, err := Listen{Address: DefaultAddress}.Resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if l.Port == 0 {
+		t.Errorf("no free port selected")
+	}
+	if l, _ := (Listen{DefaultAddress, 2222}).Resolve(); l.Port != 2222 {
+		t.Errorf("unexpected port %d", l.Port)
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteConfig(&b, Listen{"::1", 2222}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, line := range []string{
+		"ListenAddress [::1]:2222\n",
+		"HostKey /.singularity.d/sshd/ssh_host_ecdsa_key\n",
+		"AuthorizedKeysFile /.singularity.d/sshd/authorized_keys\n",
+		"PasswordAuthentication no\n",
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("missing %q in configuration:\n%s", line, b.String())
+		}
+	}
+}
+
+func TestGenerateHostKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshd-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, HostKeyFile)
+	pub, err := GenerateHostKey(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(pub, "ecdsa-sha2-nistp256 ") {
+		t.Errorf("unexpected public key %s", pub)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("host key readable by others: %s", fi.Mode())
+	}
+
+	// the existing key is kept
+	again, err := GenerateHostKey(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if again != pub {
+		t.Errorf("host key changed: %s != %s", again, pub)
+	}
+
+	fp, err := Fingerprint(pub)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// SHA256 fingerprints are 43 base64 characters without padding
+	if !strings.HasPrefix(fp, "SHA256:") || len(fp) != len("SHA256:")+43 {
+		t.Errorf("unexpected fingerprint %s", fp)
+	}
+	if _, err := Fingerprint("ecdsa-sha2-nistp256"); err == nil {
+		t.Errorf("unexpected success for key without data")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	expected := []string{"/.singularity.d/actions/exec", "/usr/sbin/sshd", "-D", "-e", "-f", ContainerDir + "/" + ConfigFile}
+	if args := Command(); !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected command %v", args)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package term provides helpers for consoles attached to containers.
+package term
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultDetachKeys is the default key sequence detaching a console
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// ParseDetachKeys parses a comma separated list of keys where a key is
+// either a single character or ctrl-<char> with char in a-z, @, [, \, ],
+// ^ or _. An empty list disables detaching.
+func ParseDetachKeys(keys string) ([]byte, error) {
+	var seq []byte
+
+	if keys == "" {
+		return nil, nil
+	}
+
+	for _, key := range strings.Split(keys, ",") {
+		switch {
+		case len(key) == 1:
+			seq = append(seq, key[0])
+		case len(key) == 6 && strings.HasPrefix(key, "ctrl-"):
+			c := key[5]
+			switch {
+			case c >= 'a' && c <= 'z':
+				seq = append(seq, c-'a'+1)
+			case c >= '@' && c <= '_' && (c < 'A' || c > 'Z'):
+				seq = append(seq, c-'@')
+			default:
+				return nil, fmt.Errorf("unsupported key %q", key)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported key %q", key)
+		}
+	}
+
+	return seq, nil
+}
+
+// ErrDetached is returned by CopyDetach when the detach key sequence
+// has been read
+var ErrDetached = fmt.Errorf("detached")
+
+// CopyDetach copies src to dst like io.Copy until the detach key
+// sequence keys is read from src, in which case ErrDetached is returned.
+// Bytes matching the beginning of the sequence are held until the
+// sequence is either completed or broken.
+func CopyDetach(dst io.Writer, src io.Reader, keys []byte) error {
+	if len(keys) == 0 {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+
+	buf := make([]byte, 4096)
+	matched := 0
+
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			out := make([]byte, 0, n+matched)
+
+			for _, b := range buf[:n] {
+				if b == keys[matched] {
+					matched++
+					if matched == len(keys) {
+						if len(out) > 0 {
+							if _, err := dst.Write(out); err != nil {
+								return err
+							}
+						}
+						return ErrDetached
+					}
+					continue
+				}
+				// sequence broken, release held bytes
+				out = append(out, keys[:matched]...)
+				matched = 0
+				if b == keys[0] {
+					matched = 1
+					continue
+				}
+				out = append(out, b)
+			}
+
+			if len(out) > 0 {
+				if _, err := dst.Write(out); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			if matched > 0 {
+				_, err := dst.Write(keys[:matched])
+				return err
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
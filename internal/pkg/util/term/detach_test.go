@@ -0,0 +1,79 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package term
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestParseDetachKeys(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		keys    string
+		seq     []byte
+		wantErr bool
+	}{
+		{DefaultDetachKeys, []byte{0x10, 0x11}, false},
+		{"ctrl-@,ctrl-[,ctrl-_", []byte{0x00, 0x1b, 0x1f}, false},
+		{"a,b", []byte("ab"), false},
+		{"", nil, false},
+		{"ctrl-A", nil, true},
+		{"ctrl-1", nil, true},
+		{"ab", nil, true},
+	}
+
+	for _, tt := range tests {
+		seq, err := ParseDetachKeys(tt.keys)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("unexpected success with %q", tt.keys)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error with %q: %s", tt.keys, err)
+		} else if !bytes.Equal(seq, tt.seq) {
+			t.Errorf("unexpected sequence %v for %q", seq, tt.keys)
+		}
+	}
+}
+
+func TestCopyDetach(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	keys := []byte{0x10, 0x11}
+
+	tests := []struct {
+		input    string
+		output   string
+		detached bool
+	}{
+		{"hello", "hello", false},
+		{"hello\x10\x11world", "hello", true},
+		{"a\x10b\x10\x10\x11", "a\x10b\x10", true},
+		{"end\x10", "end\x10", false},
+	}
+
+	for _, tt := range tests {
+		out := new(bytes.Buffer)
+		err := CopyDetach(out, strings.NewReader(tt.input), keys)
+		if tt.detached && err != ErrDetached {
+			t.Errorf("expected detach with %q, got %v", tt.input, err)
+		} else if !tt.detached && err != nil {
+			t.Errorf("unexpected error with %q: %s", tt.input, err)
+		}
+		if out.String() != tt.output {
+			t.Errorf("unexpected output %q for %q", out.String(), tt.input)
+		}
+	}
+}
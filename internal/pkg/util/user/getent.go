@@ -0,0 +1,150 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package user
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// getentTimeout bounds the time spent by a getent query, a remote name
+// service may not answer
+const getentTimeout = 10 * time.Second
+
+// getentPaths are the only locations where getent is searched, it may run
+// with privileges so the PATH of the user is never used
+var getentPaths = []string{"/usr/bin/getent", "/bin/getent"}
+
+// getentEnv is the environment of getent, the environment of the user
+// is not inherited
+var getentEnv = []string{"PATH=/usr/bin:/bin", "LANG=C"}
+
+// errNoGetent is returned when getent can't be found on the host
+var errNoGetent = errors.New("getent not found")
+
+// getent returns the entry of key in the name service database as
+// returned by getent(1), which queries all sources of the database
+// configured in nsswitch.conf like sssd or LDAP
+func getent(database, key string) (string, error) {
+	path := ""
+	for _, p := range getentPaths {
+		if _, err := exec.LookPath(p); err == nil {
+			path = p
+			break
+		}
+	}
+	if path == "" {
+		return "", errNoGetent
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), getentTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, database, key)
+	cmd.Env = getentEnv
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// getent exits with status 2 when the key is not found
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 2 {
+				return "", fmt.Errorf("no %s entry found for %s", database, key)
+			}
+		}
+		return "", fmt.Errorf("getent %s %s failed: %s: %s", database, key, err, strings.TrimSpace(stderr.String()))
+	}
+	// multiple sources may return an entry, the first one wins
+	return strings.SplitN(strings.TrimSpace(stdout.String()), "\n", 2)[0], nil
+}
+
+// ParsePasswdEntry returns the User of a passwd line with the format
+// name:password:uid:gid:gecos:dir:shell
+func ParsePasswdEntry(line string) (*User, error) {
+	fields := strings.Split(strings.TrimSpace(line), ":")
+	if len(fields) != 7 || fields[0] == "" {
+		return nil, fmt.Errorf("bad passwd entry %q, expected name:x:uid:gid:gecos:dir:shell", line)
+	}
+	uid, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad uid in passwd entry %q", line)
+	}
+	gid, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad gid in passwd entry %q", line)
+	}
+	return &User{
+		Name:  fields[0],
+		UID:   uint32(uid),
+		GID:   uint32(gid),
+		Gecos: fields[4],
+		Dir:   fields[5],
+		Shell: fields[6],
+	}, nil
+}
+
+// ParseGroupEntry returns the Group of a group line with the format
+// name:password:gid:members, members are ignored
+func ParseGroupEntry(line string) (*Group, error) {
+	fields := strings.Split(strings.TrimSpace(line), ":")
+	if len(fields) != 4 || fields[0] == "" {
+		return nil, fmt.Errorf("bad group entry %q, expected name:x:gid:members", line)
+	}
+	gid, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad gid in group entry %q", line)
+	}
+	return &Group{Name: fields[0], GID: uint32(gid)}, nil
+}
+
+// PasswdEntry returns the passwd line of user u with home as home
+// directory, or its own home directory if empty
+func (u *User) PasswdEntry(home string) string {
+	if home == "" {
+		home = u.Dir
+	}
+	return fmt.Sprintf("%s:x:%d:%d:%s:%s:%s", u.Name, u.UID, u.GID, u.Gecos, home, u.Shell)
+}
+
+// GetentPasswd returns a pointer to User structure associated with the
+// user name or uid key as resolved by host name services, it falls back
+// to GetPwNam or GetPwUID when getent isn't available
+func GetentPasswd(key string) (*User, error) {
+	line, err := getent("passwd", key)
+	if err == errNoGetent {
+		if uid, err := strconv.ParseUint(key, 10, 32); err == nil {
+			return GetPwUID(uint32(uid))
+		}
+		return GetPwNam(key)
+	} else if err != nil {
+		return nil, err
+	}
+	return ParsePasswdEntry(line)
+}
+
+// GetentGroup returns a pointer to Group structure associated with the
+// group name or gid key as resolved by host name services, it falls back
+// to GetGrNam or GetGrGID when getent isn't available
+func GetentGroup(key string) (*Group, error) {
+	line, err := getent("group", key)
+	if err == errNoGetent {
+		if gid, err := strconv.ParseUint(key, 10, 32); err == nil {
+			return GetGrGID(uint32(gid))
+		}
+		return GetGrNam(key)
+	} else if err != nil {
+		return nil, err
+	}
+	return ParseGroupEntry(line)
+}
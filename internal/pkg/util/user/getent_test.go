@@ -0,0 +1,100 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package user
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestParsePasswdEntry(t *testing.T) {
+	u, err := ParsePasswdEntry("svc:x:901:902:service account:/srv:/bin/sh\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if u.Name != "svc" || u.UID != 901 || u.GID != 902 || u.Gecos != "service account" || u.Dir != "/srv" || u.Shell != "/bin/sh" {
+		t.Errorf("unexpected user %+v", u)
+	}
+	if e := u.PasswdEntry("/home/svc"); e != "svc:x:901:902:service account:/home/svc:/bin/sh" {
+		t.Errorf("unexpected passwd entry %s", e)
+	}
+
+	for _, line := range []string{"", "svc:x:901:902", "svc:x:uid:902:::", ":x:901:902:::"} {
+		if _, err := ParsePasswdEntry(line); err == nil {
+			t.Errorf("unexpected success with %q", line)
+		}
+	}
+}
+
+func TestGetentPasswd(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	for _, key := range []string{"0", "root"} {
+		u, err := GetentPasswd(key)
+		if err != nil {
+			t.Fatalf("Failed to retrieve information for %s: %s", key, err)
+		}
+		if u.Name != "root" || u.UID != 0 {
+			t.Errorf("unexpected user %+v for %s", u, key)
+		}
+	}
+	if _, err := GetentPasswd("no-such-user-for-getent"); err == nil {
+		t.Errorf("unexpected success with unknown user")
+	}
+}
+
+func TestGetentGroup(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	g, err := GetentGroup("0")
+	if err != nil {
+		t.Fatalf("Failed to retrieve information for GID 0: %s", err)
+	}
+	if g.GID != 0 {
+		t.Errorf("unexpected group %+v", g)
+	}
+	if _, err := ParseGroupEntry("wheel:x:10"); err == nil {
+		t.Errorf("unexpected success with bad group entry")
+	}
+}
+
+func TestGetentNotInPath(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tmpdir, err := ioutil.TempDir("", "getent-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// a getent found in PATH must never be run
+	fake := "#!/bin/sh\necho fake:x:4242:4242:::\n"
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "getent"), []byte(fake), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", tmpdir+":"+path)
+
+	paths := getentPaths
+	defer func() { getentPaths = paths }()
+	getentPaths = []string{filepath.Join(tmpdir, "missing")}
+
+	u, err := GetentPasswd("0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if u.Name != "root" || u.UID != 0 {
+		t.Errorf("unexpected user %+v", u)
+	}
+}
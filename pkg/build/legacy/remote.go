@@ -13,10 +13,11 @@ import (
 
 // RequestData contains the info necessary for submitting a build to a remote service
 type RequestData struct {
-	Definition  `json:"definition"`
-	LibraryRef  string `json:"libraryRef"`
-	LibraryURL  string `json:"libraryURL"`
-	CallbackURL string `json:"callbackURL"`
+	Definition    `json:"definition"`
+	LibraryRef    string `json:"libraryRef"`
+	LibraryURL    string `json:"libraryURL"`
+	CallbackURL   string `json:"callbackURL"`
+	ContextDigest string `json:"contextDigest,omitempty"`
 }
 
 // ResponseData contains the details of an individual build
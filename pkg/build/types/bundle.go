@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	ocitypes "github.com/containers/image/types"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
@@ -37,6 +38,9 @@ type Bundle struct {
 	BindPath    []string          `json:"bindPath"`
 	Path        string            `json:"bundlePath"`
 	Opts        Options           `json:"opts"`
+	// Arch is the Go architecture of the root filesystem when it
+	// was bootstrapped from an image for another architecture
+	Arch string `json:"arch,omitempty"`
 }
 
 // Options defines build time behavior to be executed on the bundle
@@ -53,6 +57,15 @@ type Options struct {
 	DockerAuthConfig *ocitypes.DockerAuthConfig
 	// noTest indicates if build should skip running the test script
 	NoTest bool `json:"noTest"`
+	// TestTimeout bounds the run time of each attempt of the test
+	// script, 0 means no limit
+	TestTimeout time.Duration `json:"testTimeout,omitempty"`
+	// TestRetries is the number of times the test script is run again
+	// after a failure
+	TestRetries int `json:"testRetries,omitempty"`
+	// KeepFailed assembles the image even if the test script failed,
+	// the build is still reported as failed
+	KeepFailed bool `json:"keepFailed,omitempty"`
 	// force automatically deletes an existing container at build destination while performing build
 	Force bool `json:"force"`
 	// update detects and builds using an existing sandbox container at build destination
@@ -62,8 +75,74 @@ type Options struct {
 	// NoCleanUp allows a user to prevent a bundle from being cleaned up after a failed build
 	// useful for debugging
 	NoCleanUp bool `json:"noCleanUp"`
+	// NoCache disables the caching of root filesystems resulting from
+	// %files and %post sections, and of squashfs images of sandboxes
+	// converted to SIF
+	NoCache bool `json:"noCache"`
+	// CacheSections enables the caching of root filesystems resulting
+	// from %files and %post sections
+	CacheSections bool `json:"cacheSections"`
+	// Platform is the os/arch[/variant] of the image selected from
+	// manifest lists, the host platform is used when empty
+	Platform string `json:"platform"`
+	// StrictPlatform refuses images which don't match exactly the
+	// requested platform and running build scripts under emulation
+	StrictPlatform bool `json:"strictPlatform"`
+	// Secrets maps the id of secret files mounted in SecretsDir during
+	// the %post section to their path on the host, they are never
+	// written to the image
+	Secrets map[string]string `json:"secrets,omitempty"`
+	// Reproducible normalizes file times, labels and SIF metadata so
+	// builds of the same definition produce identical images
+	Reproducible bool `json:"reproducible"`
+	// SourceDateEpoch is the Unix time used by reproducible builds for
+	// the build date and as upper bound of file modification times
+	SourceDateEpoch int64 `json:"sourceDateEpoch"`
+	// ExpectedDigest is the sha256:<hex> digest reproducible SIF images
+	// must have, the build fails when it differs
+	ExpectedDigest string `json:"expectedDigest,omitempty"`
+	// ResetTimestamps clamps file modification times to SourceDateEpoch
+	// without the other normalizations of reproducible builds
+	ResetTimestamps bool `json:"resetTimestamps,omitempty"`
+	// OptimizePasses are the names of the optimization passes run on
+	// the root filesystem of the last stage before it's assembled
+	OptimizePasses []string `json:"optimizePasses,omitempty"`
+	// Compression is the squashfs compression algorithm of SIF images,
+	// mksquashfs default is used when empty
+	Compression string `json:"compression,omitempty"`
+	// SquashfsBlockSize is the block size of the squashfs image of SIF
+	// images with an optional K or M suffix, the singularity.conf
+	// default is used when empty
+	SquashfsBlockSize string `json:"squashfsBlockSize,omitempty"`
+	// MksquashfsProcs is the number of CPUs used by mksquashfs, the
+	// singularity.conf default is used when zero
+	MksquashfsProcs uint `json:"mksquashfsProcs,omitempty"`
+	// MksquashfsMem is the memory used by mksquashfs with an optional
+	// K, M or G suffix, the singularity.conf default is used when empty
+	MksquashfsMem string `json:"mksquashfsMem,omitempty"`
+	// Network is the network of the %post and %test sections: host or
+	// empty shares the host network, none only provides a loopback
+	// interface and other values are comma separated CNI networks
+	Network string `json:"network,omitempty"`
+	// DNS is a comma separated list of DNS servers written to the
+	// resolv.conf of the %post and %test sections
+	DNS string `json:"dns,omitempty"`
+	// ResolvConf is the host file bound at /etc/resolv.conf during the
+	// %post and %test sections, the host /etc/resolv.conf when empty
+	ResolvConf string `json:"resolvConf,omitempty"`
+	// FakerootMode is the privilege mode of builds run by users without
+	// root privileges: userns, fakechroot or proot
+	FakerootMode string `json:"fakerootMode,omitempty"`
 }
 
+// HostNetwork returns if build scripts share the host network
+func (o Options) HostNetwork() bool {
+	return o.Network == "" || o.Network == "host"
+}
+
+// SecretsDir is the directory holding the secret files during %post
+const SecretsDir = "/run/secrets"
+
 // NewBundle creates a Bundle environment
 func NewBundle(bundleDir, bundlePrefix string) (b *Bundle, err error) {
 	b = &Bundle{}
@@ -71,3 +71,21 @@ func TestNewBundle(t *testing.T) {
 		os.RemoveAll(bundle.Path)
 	}
 }
+
+func TestHostNetwork(t *testing.T) {
+	tests := []struct {
+		network string
+		host    bool
+	}{
+		{"", true},
+		{"host", true},
+		{"none", false},
+		{"bridge", false},
+		{"bridge,ptp", false},
+	}
+	for _, tt := range tests {
+		if h := (Options{Network: tt.network}).HostNetwork(); h != tt.host {
+			t.Errorf("unexpected HostNetwork %v for network %q", h, tt.network)
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"sort"
 	"strings"
 )
 
@@ -19,7 +21,7 @@ type Definition struct {
 	ImageData  `json:"imageData"`
 	BuildData  Data              `json:"buildData"`
 	CustomData map[string]string `json:"customData"`
-	Raw        []byte            `json:"raw"`
+	Raw        []byte            `json:"raw,omitempty"`
 }
 
 // ImageData contains any scripts, metadata, etc... that needs to be
@@ -119,22 +121,106 @@ func NewDefinitionFromJSON(r io.Reader) (d Definition, err error) {
 	return d, nil
 }
 
+// NewDefinitionsFromJSON creates the definitions of the stages described
+// by the supplied JSON, either an array of definitions or a single one.
+// As with definition files, the raw data of the last stage holds all the
+// stages.
+func NewDefinitionsFromJSON(r io.Reader) ([]Definition, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("no definition found")
+	} else if trimmed[0] != '[' {
+		d, err := NewDefinitionFromJSON(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return []Definition{d}, nil
+	}
+
+	var defs []Definition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, err
+	}
+	if len(defs) == 0 {
+		return nil, fmt.Errorf("no definition found")
+	}
+	for i := range defs {
+		if len(defs[i].Raw) == 0 {
+			var buf bytes.Buffer
+			populateRaw(&defs[i], &buf)
+			defs[i].Raw = buf.Bytes()
+		}
+	}
+	if len(defs) > 1 {
+		var buf bytes.Buffer
+		WriteDefinitionFile(&buf, defs...)
+		defs[len(defs)-1].Raw = buf.Bytes()
+	}
+	return defs, nil
+}
+
+// headerNames are the canonical names of header keywords, definitions
+// hold them lower cased
+var headerNames = map[string]string{
+	"bootstrap":        "Bootstrap",
+	"from":             "From",
+	"includecmd":       "IncludeCmd",
+	"mirrorurl":        "MirrorURL",
+	"updateurl":        "UpdateURL",
+	"osversion":        "OSVersion",
+	"include":          "Include",
+	"library":          "Library",
+	"registry":         "Registry",
+	"namespace":        "Namespace",
+	"stage":            "Stage",
+	"base":             "Base",
+	"channels":         "Channels",
+	"micromambasha256": "MicromambaSHA256",
+	"repos":            "Repos",
+	"gpgkey":           "GPGKey",
+	"gpgcheck":         "GPGCheck",
+	"variant":          "Variant",
+	"components":       "Components",
+	"keyring":          "Keyring",
+	"proxy":            "Proxy",
+	"testtimeout":      "TestTimeout",
+	"testretries":      "TestRetries",
+	"testskip":         "TestSkip",
+}
+
+// WriteDefinitionFile writes the definition file of the stages defs to w.
+// Header keywords, labels and custom sections are sorted so the output
+// only depends on the content of the definitions.
+func WriteDefinitionFile(w io.Writer, defs ...Definition) error {
+	var buf bytes.Buffer
+	for i := range defs {
+		populateRaw(&defs[i], &buf)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
 func writeSectionIfExists(w io.Writer, ident string, s Script) {
-	if len(s.Script) > 0 {
+	if script := strings.TrimRight(s.Script, "\n"); len(script) > 0 {
 		w.Write([]byte("%"))
 		w.Write([]byte(ident))
 		if len(s.Args) > 0 {
 			w.Write([]byte(" " + s.Args))
 		}
 		w.Write([]byte("\n"))
-		w.Write([]byte(s.Script))
+		w.Write([]byte(script))
 		w.Write([]byte("\n\n"))
 	}
 }
 
 func writeFilesIfExists(w io.Writer, f []Files) {
 	for _, f := range f {
-		if len(f.Files) > 0 {
+		// '%files from' sections may copy a single file given in args
+		if len(f.Files) > 0 || f.Args != "" {
 			w.Write([]byte("%"))
 			w.Write([]byte("files"))
 			if len(f.Args) > 0 {
@@ -143,10 +229,12 @@ func writeFilesIfExists(w io.Writer, f []Files) {
 			w.Write([]byte("\n"))
 
 			for _, ft := range f.Files {
+				// the parser splits source and destination on a space
 				w.Write([]byte("\t"))
 				w.Write([]byte(ft.Src))
-				w.Write([]byte("\t"))
-				w.Write([]byte(ft.Dst))
+				if ft.Dst != "" {
+					w.Write([]byte(" " + ft.Dst))
+				}
 				w.Write([]byte("\n"))
 			}
 			w.Write([]byte("\n"))
@@ -162,11 +250,11 @@ func writeLabelsIfExists(w io.Writer, l map[string]string) {
 		w.Write([]byte("labels"))
 		w.Write([]byte("\n"))
 
-		for k, v := range l {
+		for _, k := range sortedKeys(l) {
 			w.Write([]byte("\t"))
 			w.Write([]byte(k))
 			w.Write([]byte(" "))
-			w.Write([]byte(v))
+			w.Write([]byte(l[k]))
 			w.Write([]byte("\n"))
 		}
 		w.Write([]byte("\n"))
@@ -176,10 +264,20 @@ func writeLabelsIfExists(w io.Writer, l map[string]string) {
 // populateRaw is a helper func to output a Definition struct
 // into a definition file.
 func populateRaw(d *Definition, w io.Writer) {
-	for k, v := range d.Header {
-		w.Write([]byte(k))
+	if b, ok := d.Header["bootstrap"]; ok {
+		w.Write([]byte(headerNames["bootstrap"] + ": " + b + "\n"))
+	}
+	for _, k := range sortedKeys(d.Header) {
+		if k == "bootstrap" {
+			continue
+		}
+		name := headerNames[k]
+		if name == "" {
+			name = k
+		}
+		w.Write([]byte(name))
 		w.Write([]byte(": "))
-		w.Write([]byte(v))
+		w.Write([]byte(d.Header[k]))
 		w.Write([]byte("\n"))
 	}
 	w.Write([]byte("\n"))
@@ -187,12 +285,31 @@ func populateRaw(d *Definition, w io.Writer) {
 	writeLabelsIfExists(w, d.ImageData.Labels)
 	writeFilesIfExists(w, d.BuildData.Files)
 
+	test := d.ImageData.Test
+	if test.Script == "" {
+		test = d.BuildData.Test
+	}
+
 	writeSectionIfExists(w, "help", d.ImageData.Help)
 	writeSectionIfExists(w, "environment", d.ImageData.Environment)
 	writeSectionIfExists(w, "runscript", d.ImageData.Runscript)
-	writeSectionIfExists(w, "test", d.ImageData.Test)
+	writeSectionIfExists(w, "test", test)
 	writeSectionIfExists(w, "startscript", d.ImageData.Startscript)
 	writeSectionIfExists(w, "pre", d.BuildData.Pre)
 	writeSectionIfExists(w, "setup", d.BuildData.Setup)
 	writeSectionIfExists(w, "post", d.BuildData.Post)
+
+	// app and custom sections are stored by section header
+	for _, k := range sortedKeys(d.CustomData) {
+		writeSectionIfExists(w, k, Script{Script: d.CustomData[k]})
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -6,6 +6,8 @@
 package types
 
 import (
+	"bytes"
+	"encoding/json"
 	"os"
 	"strings"
 	"testing"
@@ -78,3 +80,41 @@ func TestNewDefinitionFromJSON(t *testing.T) {
 		t.Fatal("Invalid number of labels")
 	}
 }
+
+func TestNewDefinitionsFromJSON(t *testing.T) {
+	const stage = `{"header":{"bootstrap":"docker","from":"alpine","stage":"%s"},"imageData":{"labels":{"b":"2","a":"1"},"imageScripts":{"runScript":{"script":"exec true\n"}}},"buildData":{"files":[{"args":"from builder","files":[{"source":"/bin","destination":"/opt"}]}]}}`
+
+	defs, err := NewDefinitionsFromJSON(strings.NewReader(strings.Replace(stage, "%s", "one", 1)))
+	if err != nil {
+		t.Fatalf("unexpected error with a single definition: %s", err)
+	}
+	if len(defs) != 1 || defs[0].Header["stage"] != "one" {
+		t.Fatalf("unexpected definitions %v", defs)
+	}
+	const expected = "Bootstrap: docker\nFrom: alpine\nStage: one\n\n%labels\n\ta 1\n\tb 2\n\n%files from builder\n\t/bin /opt\n\n%runscript\nexec true\n\n"
+	if string(defs[0].Raw) != expected {
+		t.Errorf("unexpected raw definition:\n%s", defs[0].Raw)
+	}
+
+	array := "[" + strings.Replace(stage, "%s", "one", 1) + "," + strings.Replace(stage, "%s", "two", 1) + "]"
+	defs, err = NewDefinitionsFromJSON(strings.NewReader(array))
+	if err != nil {
+		t.Fatalf("unexpected error with multiple definitions: %s", err)
+	}
+	if len(defs) != 2 || defs[1].Header["stage"] != "two" {
+		t.Fatalf("unexpected definitions %v", defs)
+	}
+	if !bytes.Contains(defs[1].Raw, []byte("Stage: one")) {
+		t.Errorf("last definition doesn't contain all stages:\n%s", defs[1].Raw)
+	}
+
+	for _, s := range []string{``, `[]`, `"alpine"`, `{"header":`} {
+		if _, err := NewDefinitionsFromJSON(strings.NewReader(s)); err == nil {
+			t.Errorf("unexpected success with %q", s)
+		}
+	}
+
+	if !json.Valid([]byte(DefinitionSchema)) {
+		t.Errorf("definition schema is not valid JSON")
+	}
+}
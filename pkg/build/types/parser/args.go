@@ -0,0 +1,157 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+)
+
+// argumentsSection declares default values of build arguments, it is
+// removed from the definition once placeholders are replaced
+const argumentsSection = "arguments"
+
+var (
+	// placeholder is only replaced in headers, argsPlaceholder in all
+	// the definition, scripts may use {{ }} for other purposes
+	placeholder     = regexp.MustCompile(`{{\s*([A-Za-z_][A-Za-z0-9_]*)\s*}}`)
+	argsPlaceholder = regexp.MustCompile(`{{\s*args\.([A-Za-z_][A-Za-z0-9_]*)\s*}}`)
+	argName         = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	stageHeader     = regexp.MustCompile(`(?i)^bootstrap:`)
+)
+
+// ReadBuildArgs reads build arguments from r, one name=value pair per
+// line, blank lines and lines starting with # are ignored
+func ReadBuildArgs(r io.Reader) (map[string]string, error) {
+	args := make(map[string]string)
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		if err := addBuildArg(args, s.Text()); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+	}
+	return args, s.Err()
+}
+
+// addBuildArg adds the name=value pair of line to args
+func addBuildArg(args map[string]string, line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	kv := strings.SplitN(line, "=", 2)
+	name := strings.TrimSpace(kv[0])
+	if len(kv) != 2 || !argName.MatchString(name) {
+		return fmt.Errorf("invalid build argument %q, expected name=value", line)
+	}
+	args[name] = strings.TrimSpace(kv[1])
+	return nil
+}
+
+// ApplyBuildArgs returns the definition read from r with its {{ name }}
+// header placeholders and its {{ args.name }} placeholders replaced by the
+// value of build argument name, or by its default value declared as a
+// name=value line of an %arguments section. Sections are only searched
+// for {{ args.name }} placeholders. Placeholders without value are reported
+// as errors, arguments not used by the definition are reported as warnings.
+func ApplyBuildArgs(r io.Reader, args map[string]string) (io.Reader, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("while attempting to read in definition: %v", err)
+	}
+
+	defaults, def, err := extractArguments(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	missing := make(map[string]bool)
+
+	replace := func(re *regexp.Regexp, line string) string {
+		return re.ReplaceAllStringFunc(line, func(m string) string {
+			name := re.FindStringSubmatch(m)[1]
+			used[name] = true
+			if v, ok := args[name]; ok {
+				return v
+			} else if v, ok := defaults[name]; ok {
+				return v
+			}
+			missing[name] = true
+			return m
+		})
+	}
+
+	var out bytes.Buffer
+	inHeader := true
+	for _, line := range strings.SplitAfter(string(def), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && strings.HasPrefix(fields[0], "%") {
+			inHeader = false
+		} else if stageHeader.MatchString(strings.TrimSpace(line)) {
+			inHeader = true
+		}
+		line = replace(argsPlaceholder, line)
+		if inHeader {
+			line = replace(placeholder, line)
+		}
+		out.WriteString(line)
+	}
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("missing value for required build argument(s): %s", strings.Join(names, ", "))
+	}
+	for name := range args {
+		if !used[name] {
+			sylog.Warningf("Build argument %s is not used by the definition", name)
+		}
+	}
+
+	return bytes.NewReader(out.Bytes()), nil
+}
+
+// extractArguments returns default values declared in %arguments
+// sections of the definition and the definition without them
+func extractArguments(raw []byte) (map[string]string, []byte, error) {
+	defaults := make(map[string]string)
+	var def bytes.Buffer
+
+	inArguments := false
+
+	for _, line := range strings.SplitAfter(string(raw), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "%") {
+			inArguments = getSectionName(fields[0]) == argumentsSection
+		} else if stageHeader.MatchString(strings.TrimSpace(line)) {
+			inArguments = false
+		}
+
+		if !inArguments {
+			def.WriteString(line)
+			continue
+		}
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "%") {
+			continue
+		}
+		if err := addBuildArg(defaults, line); err != nil {
+			return nil, nil, fmt.Errorf("in %%%s section: %s", argumentsSection, err)
+		}
+	}
+	return defaults, def.Bytes(), nil
+}
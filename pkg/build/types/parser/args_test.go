@@ -0,0 +1,103 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+const argsDefinition = `Bootstrap: docker
+From: nvidia/cuda:{{ CUDA_VERSION }}-{{OS}}
+
+%arguments
+    # defaults
+    OS=ubuntu18.04
+
+%post
+    echo "{{ args.CUDA_VERSION }}" > /version
+    echo '{{ .Name }} {{ OS }}' > /template
+`
+
+func TestApplyBuildArgs(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	tests := []struct {
+		name     string
+		args     map[string]string
+		expected string
+		fail     bool
+	}{
+		{
+			name: "defaults",
+			args: map[string]string{"CUDA_VERSION": "10.1"},
+			expected: `Bootstrap: docker
+From: nvidia/cuda:10.1-ubuntu18.04
+
+%post
+    echo "10.1" > /version
+    echo '{{ .Name }} {{ OS }}' > /template
+`,
+		},
+		{
+			name: "override",
+			args: map[string]string{"CUDA_VERSION": "9.2", "OS": "centos7"},
+			expected: `Bootstrap: docker
+From: nvidia/cuda:9.2-centos7
+
+%post
+    echo "9.2" > /version
+    echo '{{ .Name }} {{ OS }}' > /template
+`,
+		},
+		{
+			name: "missing",
+			args: map[string]string{"OS": "centos7"},
+			fail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		r, err := ApplyBuildArgs(strings.NewReader(argsDefinition), tt.args)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("%s: unexpected success", tt.name)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		b, _ := ioutil.ReadAll(r)
+		if string(b) != tt.expected {
+			t.Errorf("%s: unexpected definition:\n%s", tt.name, b)
+		}
+		if _, err := All(strings.NewReader(string(b))); err != nil {
+			t.Errorf("%s: failed to parse definition: %s", tt.name, err)
+		}
+	}
+}
+
+func TestReadBuildArgs(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	args, err := ReadBuildArgs(strings.NewReader("# comment\n\nA=1\n B = two words \nC=x=y\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(args) != 3 || args["A"] != "1" || args["B"] != "two words" || args["C"] != "x=y" {
+		t.Errorf("unexpected arguments: %v", args)
+	}
+
+	if _, err := ReadBuildArgs(strings.NewReader("A=1\nbad line\n")); err == nil {
+		t.Errorf("unexpected success with invalid argument")
+	}
+}
@@ -513,15 +513,28 @@ var appSections = map[string]bool{
 // validHeaders just contains a list of all the valid headers a definition file
 // could contain. If any others are found, an error will generate
 var validHeaders = map[string]bool{
-	"bootstrap":  true,
-	"from":       true,
-	"includecmd": true,
-	"mirrorurl":  true,
-	"updateurl":  true,
-	"osversion":  true,
-	"include":    true,
-	"library":    true,
-	"registry":   true,
-	"namespace":  true,
-	"stage":      true,
+	"bootstrap":        true,
+	"from":             true,
+	"includecmd":       true,
+	"mirrorurl":        true,
+	"updateurl":        true,
+	"osversion":        true,
+	"include":          true,
+	"library":          true,
+	"registry":         true,
+	"namespace":        true,
+	"stage":            true,
+	"base":             true,
+	"channels":         true,
+	"micromambasha256": true,
+	"repos":            true,
+	"gpgkey":           true,
+	"gpgcheck":         true,
+	"variant":          true,
+	"components":       true,
+	"keyring":          true,
+	"proxy":            true,
+	"testtimeout":      true,
+	"testretries":      true,
+	"testskip":         true,
 }
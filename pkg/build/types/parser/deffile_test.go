@@ -433,3 +433,106 @@ func TestParseAll(t *testing.T) {
 		}))
 	}
 }
+
+func TestWriteDefinitionFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		defPath string
+	}{
+		{"Arch", "testdata_good/arch/arch"},
+		{"BusyBox", "testdata_good/busybox/busybox"},
+		{"Debootstrap", "testdata_good/debootstrap/debootstrap"},
+		{"Docker", "testdata_good/docker/docker"},
+		{"MultipleFiles", "testdata_good/multiplefiles/multiplefiles"},
+		{"MultipleScripts", "testdata_good/multiplescripts/multiplescripts"},
+		{"SectionArgs", "testdata_good/sectionargs/sectionargs"},
+		{"MultiStage", "testdata_multi/simple/simple"},
+	}
+
+	// normalize removes the raw data which is the copy of the parsed
+	// file and the trailing blank lines of scripts which are not kept
+	normalize := func(defs []types.Definition) []types.Definition {
+		for i := range defs {
+			defs[i].Raw = nil
+			for _, s := range []*types.Script{
+				&defs[i].ImageData.Help,
+				&defs[i].ImageData.Environment,
+				&defs[i].ImageData.Runscript,
+				&defs[i].ImageData.Test,
+				&defs[i].ImageData.Startscript,
+				&defs[i].BuildData.Pre,
+				&defs[i].BuildData.Setup,
+				&defs[i].BuildData.Post,
+				&defs[i].BuildData.Test,
+			} {
+				s.Script = strings.TrimRight(s.Script, "\n")
+			}
+		}
+		return defs
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, test.WithoutPrivilege(func(t *testing.T) {
+			defFile, err := os.Open(tt.defPath)
+			if err != nil {
+				t.Fatal("failed to open:", err)
+			}
+			defer defFile.Close()
+
+			defs, err := All(defFile)
+			if err != nil {
+				t.Fatal("failed to parse definition file:", err)
+			}
+
+			// definition file -> JSON -> definition file conversion
+			// must preserve the definitions
+			b, err := json.Marshal(normalize(defs))
+			if err != nil {
+				t.Fatal("failed to convert to JSON:", err)
+			}
+			converted, err := types.NewDefinitionsFromJSON(strings.NewReader(string(b)))
+			if err != nil {
+				t.Fatal("failed to parse JSON:", err)
+			}
+			var buf strings.Builder
+			if err := types.WriteDefinitionFile(&buf, converted...); err != nil {
+				t.Fatal("failed to write definition file:", err)
+			}
+
+			written, err := All(strings.NewReader(buf.String()))
+			if err != nil {
+				t.Fatalf("failed to parse written definition file: %s\n%s", err, buf.String())
+			}
+			if !reflect.DeepEqual(normalize(written), defs) {
+				t.Errorf("written definition file doesn't match the original:\n%s", buf.String())
+			}
+		}))
+	}
+}
+
+func TestDefinitionSchemaHeaders(t *testing.T) {
+	var schema struct {
+		Definitions struct {
+			Definition struct {
+				Properties struct {
+					Header struct {
+						PropertyNames struct {
+							Enum []string `json:"enum"`
+						} `json:"propertyNames"`
+					} `json:"header"`
+				} `json:"properties"`
+			} `json:"definition"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal([]byte(types.DefinitionSchema), &schema); err != nil {
+		t.Fatalf("invalid JSON schema: %s", err)
+	}
+
+	headers := make(map[string]bool)
+	for _, h := range schema.Definitions.Definition.Properties.Header.PropertyNames.Enum {
+		headers[h] = true
+	}
+	if !reflect.DeepEqual(headers, validHeaders) {
+		t.Errorf("JSON schema headers %v don't match valid headers %v", headers, validHeaders)
+	}
+}
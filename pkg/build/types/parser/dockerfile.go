@@ -0,0 +1,686 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/shell"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+// IsDockerfile returns if path names a Dockerfile, either Dockerfile,
+// Dockerfile.<name> or <name>.dockerfile
+func IsDockerfile(path string) bool {
+	base := filepath.Base(path)
+	return base == "Dockerfile" || strings.HasPrefix(base, "Dockerfile.") || strings.HasSuffix(strings.ToLower(base), ".dockerfile")
+}
+
+// dockerStage holds the definition sections of a Dockerfile stage
+type dockerStage struct {
+	name       string
+	from       string
+	workdir    string
+	vars       map[string]string
+	post       []string
+	files      map[string][]string
+	ran        bool
+	staged     int
+	env        []string
+	labels     map[string]string
+	entrypoint []string
+	cmd        []string
+}
+
+// dockerfile holds the state of a Dockerfile translation
+type dockerfile struct {
+	contextDir string
+	buildArgs  map[string]string
+	usedArgs   map[string]bool
+	globalArgs map[string]string
+	stages     []*dockerStage
+}
+
+// ParseDockerfile translates the Dockerfile read from r into definitions,
+// one per stage. FROM, RUN, COPY, ADD, ENV, ARG, WORKDIR, LABEL, ENTRYPOINT
+// and CMD instructions are interpreted, other instructions are ignored with
+// a warning. Relative COPY sources are resolved from contextDir and ARG
+// values are taken from buildArgs. As %files sections are copied before
+// %post sections run, files copied after a RUN instruction are staged in
+// the container and moved to their destination from %post.
+func ParseDockerfile(r io.Reader, contextDir string, buildArgs map[string]string) ([]types.Definition, error) {
+	d := &dockerfile{
+		contextDir: contextDir,
+		buildArgs:  buildArgs,
+		usedArgs:   make(map[string]bool),
+		globalArgs: make(map[string]string),
+	}
+
+	instructions, err := dockerInstructions(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, in := range instructions {
+		if err := d.instruction(in.cmd, in.args); err != nil {
+			return nil, fmt.Errorf("line %d: %s: %s", in.line, in.cmd, err)
+		}
+	}
+	if len(d.stages) == 0 {
+		return nil, fmt.Errorf("no FROM instruction found in Dockerfile")
+	}
+	for name := range d.buildArgs {
+		if !d.usedArgs[name] {
+			sylog.Warningf("Build argument %s is not declared by an ARG instruction", name)
+		}
+	}
+
+	var def bytes.Buffer
+	for _, s := range d.stages {
+		s.write(&def)
+	}
+	sylog.Debugf("Dockerfile translated to definition:\n%s", def.String())
+
+	return All(&def)
+}
+
+type dockerInstruction struct {
+	line int
+	cmd  string
+	args string
+}
+
+// dockerInstructions returns the instructions of a Dockerfile, with
+// continuation lines joined and comments removed
+func dockerInstructions(r io.Reader) ([]dockerInstruction, error) {
+	var instructions []dockerInstruction
+	var current string
+
+	start := 0
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#") || (trimmed == "" && current != "") {
+			continue
+		}
+		if current == "" {
+			start = n
+		}
+		if strings.HasSuffix(trimmed, `\`) {
+			current += strings.TrimSuffix(strings.TrimRight(line, " \t"), `\`)
+			continue
+		}
+		current += line
+		if c := strings.TrimSpace(current); c != "" {
+			fields := strings.SplitN(c, " ", 2)
+			in := dockerInstruction{line: start, cmd: strings.ToUpper(strings.TrimSpace(fields[0]))}
+			if len(fields) == 2 {
+				in.args = strings.TrimSpace(fields[1])
+			}
+			instructions = append(instructions, in)
+		}
+		current = ""
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(current) != "" {
+		return nil, fmt.Errorf("unterminated continuation line at end of Dockerfile")
+	}
+	return instructions, nil
+}
+
+func (d *dockerfile) instruction(cmd, args string) error {
+	if cmd == "FROM" {
+		return d.from(args)
+	}
+	if cmd == "ARG" && len(d.stages) == 0 {
+		return d.arg(d.globalArgs, nil, args)
+	}
+	if len(d.stages) == 0 {
+		return fmt.Errorf("instruction found before the first FROM instruction")
+	}
+
+	s := d.stages[len(d.stages)-1]
+
+	switch cmd {
+	case "ARG":
+		return d.arg(s.vars, s, args)
+	case "RUN":
+		return s.run(args)
+	case "COPY", "ADD":
+		return d.copy(s, cmd, args)
+	case "ENV":
+		return s.setEnv(args)
+	case "WORKDIR":
+		return s.setWorkdir(args)
+	case "LABEL":
+		return s.label(args)
+	case "MAINTAINER":
+		s.labels["maintainer"] = args
+	case "ENTRYPOINT":
+		e, err := execForm(args)
+		s.entrypoint = e
+		return err
+	case "CMD":
+		c, err := execForm(args)
+		s.cmd = c
+		return err
+	default:
+		sylog.Warningf("Ignoring unsupported Dockerfile instruction %s", cmd)
+	}
+	return nil
+}
+
+func (d *dockerfile) from(args string) error {
+	w, err := words(args, d.globalArgs)
+	if err != nil {
+		return err
+	}
+	if len(w) > 0 && strings.HasPrefix(w[0], "--platform=") {
+		w = w[1:]
+	}
+
+	s := &dockerStage{
+		name:    strconv.Itoa(len(d.stages)),
+		workdir: "/",
+		vars:    make(map[string]string),
+		files:   make(map[string][]string),
+		labels:  make(map[string]string),
+	}
+
+	switch {
+	case len(w) == 1:
+	case len(w) == 3 && strings.ToUpper(w[1]) == "AS":
+		s.name = w[2]
+	default:
+		return fmt.Errorf("expected an image and an optional stage name")
+	}
+	s.from = w[0]
+
+	for _, prev := range d.stages {
+		if prev.name == s.from {
+			return fmt.Errorf("building on the previous stage %s is not supported, copy its files with COPY --from=%s instead", s.from, s.from)
+		}
+	}
+
+	d.stages = append(d.stages, s)
+	return nil
+}
+
+// arg declares a build argument in vars, the value given with the build
+// arguments overrides the default value. Arguments declared in a stage
+// are exported to its RUN instructions.
+func (d *dockerfile) arg(vars map[string]string, s *dockerStage, args string) error {
+	w, err := words(args, vars)
+	if err != nil {
+		return err
+	}
+	for _, a := range w {
+		kv := strings.SplitN(a, "=", 2)
+		name := kv[0]
+		value, ok := d.buildArgs[name]
+		if ok {
+			d.usedArgs[name] = true
+		} else if len(kv) == 2 {
+			value, ok = kv[1], true
+		} else if s != nil {
+			// global arguments are inherited by stages redeclaring them
+			value, ok = d.globalArgs[name]
+		}
+		if !ok {
+			continue
+		}
+		vars[name] = value
+		if s != nil {
+			s.post = append(s.post, exportLine(name, value))
+		}
+	}
+	return nil
+}
+
+// run appends the command to the %post section, each command runs in
+// a subshell so directory and variable changes don't persist like with
+// docker
+func (s *dockerStage) run(args string) error {
+	command := args
+	if strings.HasPrefix(args, "[") {
+		e, err := execForm(args)
+		if err != nil {
+			return err
+		}
+		command = shell.ArgsQuoted(e)
+	}
+	s.post = append(s.post, "(", command, ")")
+	s.ran = true
+	return nil
+}
+
+func (s *dockerStage) setEnv(args string) error {
+	w, err := unresolvedWords(args, s.vars)
+	if err != nil {
+		return err
+	}
+	if len(w) > 0 && !strings.Contains(w[0], "=") {
+		// legacy ENV <key> <value> form
+		v, err := unresolvedWords(strings.TrimSpace(strings.TrimPrefix(args, w[0])), s.vars)
+		if err != nil {
+			return err
+		}
+		w = []string{w[0] + "=" + strings.Join(v, " ")}
+	}
+	for _, e := range w {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid environment variable %q", e)
+		}
+		s.vars[kv[0]] = kv[1]
+		line := exportLine(kv[0], kv[1])
+		s.post = append(s.post, line)
+		s.env = append(s.env, line)
+	}
+	return nil
+}
+
+func (s *dockerStage) setWorkdir(args string) error {
+	w, err := words(args, s.vars)
+	if err != nil {
+		return err
+	}
+	if len(w) != 1 {
+		return fmt.Errorf("expected a single directory")
+	}
+	s.workdir = s.resolve(w[0])
+	s.post = append(s.post, fmt.Sprintf(`mkdir -p "%s"`, shell.Escape(s.workdir)), fmt.Sprintf(`cd "%s"`, shell.Escape(s.workdir)))
+	return nil
+}
+
+func (s *dockerStage) label(args string) error {
+	w, err := words(args, s.vars)
+	if err != nil {
+		return err
+	}
+	for _, l := range w {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || strings.ContainsAny(kv[0], " \t") {
+			return fmt.Errorf("invalid label %q", l)
+		}
+		s.labels[kv[0]] = kv[1]
+	}
+	return nil
+}
+
+// resolve returns the absolute container path of p relative to the
+// working directory
+func (s *dockerStage) resolve(p string) string {
+	trailing := strings.HasSuffix(p, "/")
+	if !path.IsAbs(p) {
+		p = path.Join(s.workdir, p)
+	}
+	p = path.Clean(p)
+	if trailing && p != "/" {
+		p += "/"
+	}
+	return p
+}
+
+func (d *dockerfile) copy(s *dockerStage, cmd, args string) error {
+	var w []string
+	var err error
+
+	// flags precede sources in both shell and exec forms
+	from, chown := "", ""
+	for strings.HasPrefix(args, "--") {
+		fields := strings.SplitN(args, " ", 2)
+		switch {
+		case strings.HasPrefix(fields[0], "--from="):
+			from = strings.TrimPrefix(fields[0], "--from=")
+		case strings.HasPrefix(fields[0], "--chown="):
+			chown = strings.TrimPrefix(fields[0], "--chown=")
+		default:
+			return fmt.Errorf("unsupported flag %s", fields[0])
+		}
+		if len(fields) == 1 {
+			args = ""
+		} else {
+			args = strings.TrimSpace(fields[1])
+		}
+	}
+	if strings.HasPrefix(args, "[") {
+		w, err = execForm(args)
+	} else {
+		w, err = words(args, s.vars)
+	}
+	if err != nil {
+		return err
+	}
+	if len(w) < 2 {
+		return fmt.Errorf("expected at least a source and a destination")
+	}
+	srcs, dst := w[:len(w)-1], s.resolve(w[len(w)-1])
+	if len(srcs) > 1 && !strings.HasSuffix(dst, "/") {
+		dst += "/"
+	}
+
+	var lines []string
+	args = ""
+
+	if from != "" {
+		found := false
+		for _, prev := range d.stages[:len(d.stages)-1] {
+			found = found || prev.name == from
+		}
+		args = "from " + from
+		// like docker, a name which is not a previous stage is an image
+		if !found {
+			args = "from docker://" + from
+		}
+		for _, src := range srcs {
+			lines = append(lines, copyLine(src, dst, false))
+		}
+	} else {
+		for _, src := range srcs {
+			if cmd == "ADD" && (strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")) {
+				return fmt.Errorf("remote source %s is not supported", src)
+			}
+			l, err := d.contextFiles(src, dst)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, l...)
+		}
+		if cmd == "ADD" {
+			sylog.Warningf("ADD is handled like COPY, archives are not extracted")
+		}
+	}
+
+	for _, l := range lines {
+		if strings.ContainsAny(l, "\t\n") || len(strings.Fields(l)) != 2 {
+			return fmt.Errorf("paths with whitespace are not supported")
+		}
+	}
+	if s.ran {
+		lines = s.stage(lines)
+	}
+	s.files[args] = append(s.files[args], lines...)
+
+	if chown != "" {
+		s.post = append(s.post, fmt.Sprintf(`chown -R "%s" "%s"`, shell.Escape(chown), shell.Escape(strings.TrimSuffix(dst, "/"))))
+	}
+	return nil
+}
+
+// contextFiles returns the %files lines copying the context files
+// matched by pattern to dst
+func (d *dockerfile) contextFiles(pattern, dst string) ([]string, error) {
+	clean := filepath.Clean(pattern)
+	if filepath.IsAbs(clean) {
+		clean = strings.TrimPrefix(clean, "/")
+	}
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return nil, fmt.Errorf("source %s is outside of the build context", pattern)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(d.contextDir, clean))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("source %s not found in build context %s", pattern, d.contextDir)
+	}
+	if len(matches) > 1 && !strings.HasSuffix(dst, "/") {
+		dst += "/"
+	}
+
+	var lines []string
+	for _, m := range matches {
+		fi, err := os.Stat(m)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, copyLine(m, dst, fi.IsDir()))
+	}
+	return lines, nil
+}
+
+// copyLine returns the %files line copying src to dst like docker does:
+// directory contents are copied and dst ending with / is a directory
+func copyLine(src, dst string, dir bool) string {
+	if dir {
+		return strings.TrimSuffix(src, "/") + "/. " + strings.TrimSuffix(dst, "/")
+	}
+	if strings.HasSuffix(dst, "/") {
+		dst += path.Base(src)
+	}
+	return src + " " + dst
+}
+
+// stage returns the %files lines copying files to a staging directory
+// and appends to %post the commands moving them to their destination,
+// so they are copied after the preceding RUN instructions
+func (s *dockerStage) stage(lines []string) []string {
+	staging := fmt.Sprintf("/.singularity-copy-%d", s.staged)
+	s.staged++
+
+	staged := make([]string, 0, len(lines))
+	for i, l := range lines {
+		f := strings.Fields(l)
+		src, dst := shell.Escape(fmt.Sprintf("%s/%d", staging, i)), shell.Escape(f[1])
+		staged = append(staged, fmt.Sprintf("%s %s/%d", f[0], staging, i))
+		s.post = append(s.post, fmt.Sprintf(
+			`if [ -d "%[1]s" ]; then mkdir -p "%[2]s" && cp -a "%[1]s/." "%[2]s"; else mkdir -p "$(dirname "%[2]s")" && cp -a "%[1]s" "%[2]s"; fi`,
+			src, dst,
+		))
+	}
+	s.post = append(s.post, fmt.Sprintf(`rm -rf "%s"`, staging))
+	return staged
+}
+
+// write writes the definition of the stage to w
+func (s *dockerStage) write(w io.Writer) {
+	if s.from == "scratch" {
+		fmt.Fprintf(w, "Bootstrap: scratch\n")
+	} else {
+		fmt.Fprintf(w, "Bootstrap: docker\nFrom: %s\n", s.from)
+	}
+	fmt.Fprintf(w, "Stage: %s\n\n", s.name)
+
+	args := make([]string, 0, len(s.files))
+	for a := range s.files {
+		args = append(args, a)
+	}
+	sort.Strings(args)
+	for _, a := range args {
+		fmt.Fprintf(w, "%s\n", strings.TrimSpace("%files "+a))
+		for _, l := range s.files[a] {
+			fmt.Fprintf(w, "    %s\n", l)
+		}
+		fmt.Fprintln(w)
+	}
+
+	writeSection(w, "post", s.post)
+	writeSection(w, "environment", s.env)
+
+	if len(s.labels) > 0 {
+		keys := make([]string, 0, len(s.labels))
+		for k := range s.labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(w, "%%labels\n")
+		for _, k := range keys {
+			fmt.Fprintf(w, "    %s %s\n", k, s.labels[k])
+		}
+		fmt.Fprintln(w)
+	}
+
+	if run := s.runscript(); run != "" {
+		writeSection(w, "runscript", strings.Split(run, "\n"))
+	}
+}
+
+// writeSection writes a section with its lines indented, so they can't
+// be mistaken for section or header lines
+func writeSection(w io.Writer, name string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%%%s\n", name)
+	for _, l := range lines {
+		fmt.Fprintf(w, "    %s\n", l)
+	}
+	fmt.Fprintln(w)
+}
+
+// runscript returns the runscript running the entrypoint with the
+// command as default arguments, like docker run does
+func (s *dockerStage) runscript() string {
+	switch {
+	case len(s.entrypoint) > 0 && len(s.cmd) > 0:
+		return fmt.Sprintf("if [ $# -gt 0 ]; then\n    exec %s \"$@\"\nfi\nexec %s %s", shell.ArgsQuoted(s.entrypoint), shell.ArgsQuoted(s.entrypoint), shell.ArgsQuoted(s.cmd))
+	case len(s.entrypoint) > 0:
+		return fmt.Sprintf("exec %s \"$@\"", shell.ArgsQuoted(s.entrypoint))
+	case len(s.cmd) > 0:
+		return fmt.Sprintf("if [ $# -gt 0 ]; then\n    exec \"$@\"\nfi\nexec %s", shell.ArgsQuoted(s.cmd))
+	}
+	return ""
+}
+
+// execForm returns the arguments of the JSON array args, or the shell
+// form args run by /bin/sh -c
+func execForm(args string) ([]string, error) {
+	if !strings.HasPrefix(args, "[") {
+		return []string{"/bin/sh", "-c", args}, nil
+	}
+	var a []string
+	if err := json.Unmarshal([]byte(args), &a); err != nil {
+		return nil, fmt.Errorf("invalid JSON array: %s", err)
+	}
+	return a, nil
+}
+
+// unresolvedVar marks references to variables not declared by the
+// Dockerfile, like those of the base image environment
+var unresolvedVar = regexp.MustCompile("\x00([A-Za-z0-9_]+)\x00")
+
+// words splits s into shell-like words. Variables referenced as $VAR,
+// ${VAR}, ${VAR:-default} or ${VAR:+alternative} outside of single
+// quotes are expanded with vars, undeclared variables are empty.
+func words(s string, vars map[string]string) ([]string, error) {
+	w, err := unresolvedWords(s, vars)
+	for i := range w {
+		w[i] = unresolvedVar.ReplaceAllString(w[i], "")
+	}
+	return w, err
+}
+
+// exportLine returns the shell line exporting the variable name with
+// value, references to undeclared variables are expanded by the shell
+func exportLine(name, value string) string {
+	return fmt.Sprintf(`export %s="%s"`, name, unresolvedVar.ReplaceAllString(shell.Escape(value), "$${$1}"))
+}
+
+// unresolvedWords is like words but marks references to undeclared
+// variables instead of expanding them
+func unresolvedWords(s string, vars map[string]string) ([]string, error) {
+	var w []string
+	var cur strings.Builder
+
+	inWord, single, double := false, false, false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && !single && i+1 < len(s):
+			i++
+			if double && !strings.ContainsRune(`"\$`, rune(s[i])) {
+				cur.WriteByte('\\')
+			}
+			cur.WriteByte(s[i])
+			inWord = true
+		case c == '\'' && !double:
+			single = !single
+			inWord = true
+		case c == '"' && !single:
+			double = !double
+			inWord = true
+		case c == '$' && !single:
+			value, n := expandVar(s[i+1:], vars)
+			cur.WriteString(value)
+			i += n
+			inWord = true
+		case (c == ' ' || c == '\t') && !single && !double:
+			if inWord {
+				w = append(w, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteByte(c)
+			inWord = true
+		}
+	}
+	if single || double {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if inWord {
+		w = append(w, cur.String())
+	}
+	return w, nil
+}
+
+// expandVar returns the value of the variable referenced at the start
+// of s, following a $, and the number of bytes of s it consumed
+func expandVar(s string, vars map[string]string) (string, int) {
+	if strings.HasPrefix(s, "{") {
+		end := strings.Index(s, "}")
+		if end < 0 {
+			return "$", 0
+		}
+		name := s[1:end]
+		if i := strings.Index(name, ":-"); i >= 0 {
+			if v := vars[name[:i]]; v != "" {
+				return v, end + 1
+			}
+			return name[i+2:], end + 1
+		}
+		if i := strings.Index(name, ":+"); i >= 0 {
+			if vars[name[:i]] != "" {
+				return name[i+2:], end + 1
+			}
+			return "", end + 1
+		}
+		return lookupVar(name, vars), end + 1
+	}
+
+	n := 0
+	for n < len(s) && (s[n] == '_' || s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || s[n] >= '0' && s[n] <= '9') {
+		n++
+	}
+	if n == 0 {
+		return "$", 0
+	}
+	return lookupVar(s[:n], vars), n
+}
+
+func lookupVar(name string, vars map[string]string) string {
+	if v, ok := vars[name]; ok {
+		return v
+	}
+	return "\x00" + name + "\x00"
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	"github.com/sylabs/singularity/pkg/build/types"
+)
+
+const testDockerfile = `# syntax comment
+ARG BASE=alpine:3.9
+FROM golang:1.11 AS builder
+WORKDIR /src
+COPY main.go go.mod ./
+RUN go build \
+    -o /hello .
+
+FROM ${BASE}
+ARG GREETING="hello world"
+LABEL org.example.version=1.0 description="test image"
+ENV APP_HOME=/app PATH=/app/bin:$PATH
+COPY --from=builder /hello $APP_HOME/bin/
+COPY --chown=nobody:nobody data $APP_HOME/data
+RUN ["echo", "$GREETING"]
+EXPOSE 8080
+ENTRYPOINT ["/app/bin/hello"]
+CMD ["--verbose"]
+`
+
+func TestParseDockerfile(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "dockerfile-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range []string{"main.go", "go.mod", "data/a.txt"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defs, err := ParseDockerfile(strings.NewReader(testDockerfile), dir, map[string]string{"BASE": "debian:9"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(defs) != 2 {
+		t.Fatalf("unexpected number of stages: %d", len(defs))
+	}
+
+	builder, final := defs[0], defs[1]
+
+	if builder.Header["from"] != "golang:1.11" || builder.Header["stage"] != "builder" {
+		t.Errorf("unexpected builder header: %v", builder.Header)
+	}
+	expectedFiles := []types.Files{{Files: []types.FileTransport{
+		{Src: filepath.Join(dir, "main.go"), Dst: "/src/main.go"},
+		{Src: filepath.Join(dir, "go.mod"), Dst: "/src/go.mod"},
+	}}}
+	if !reflect.DeepEqual(builder.BuildData.Files, expectedFiles) {
+		t.Errorf("unexpected builder files: %+v", builder.BuildData.Files)
+	}
+	if !strings.Contains(builder.BuildData.Post.Script, "cd \"/src\"\n    (\n    go build     -o /hello .\n    )") {
+		t.Errorf("unexpected builder post script:\n%s", builder.BuildData.Post.Script)
+	}
+
+	if final.Header["from"] != "debian:9" || final.Header["stage"] != "1" {
+		t.Errorf("unexpected final header: %v", final.Header)
+	}
+	expectedFiles = []types.Files{
+		{Files: []types.FileTransport{{Src: filepath.Join(dir, "data") + "/.", Dst: "/app/data"}}},
+		{Args: "from builder", Files: []types.FileTransport{{Src: "/hello", Dst: "/app/bin/hello"}}},
+	}
+	if !reflect.DeepEqual(final.BuildData.Files, expectedFiles) {
+		t.Errorf("unexpected final files: %+v", final.BuildData.Files)
+	}
+	for _, s := range []string{
+		`export GREETING="hello world"`,
+		`export PATH="/app/bin:${PATH}"`,
+		`chown -R "nobody:nobody" "/app/data"`,
+		`"echo" "\$GREETING"`,
+	} {
+		if !strings.Contains(final.BuildData.Post.Script, s) {
+			t.Errorf("%s not found in final post script:\n%s", s, final.BuildData.Post.Script)
+		}
+	}
+	if !strings.Contains(final.ImageData.Environment.Script, `export APP_HOME="/app"`) {
+		t.Errorf("unexpected final environment:\n%s", final.ImageData.Environment.Script)
+	}
+	if final.ImageData.Labels["description"] != "test image" || final.ImageData.Labels["org.example.version"] != "1.0" {
+		t.Errorf("unexpected final labels: %v", final.ImageData.Labels)
+	}
+	if !strings.Contains(final.ImageData.Runscript.Script, `exec "/app/bin/hello" "--verbose"`) {
+		t.Errorf("unexpected final runscript:\n%s", final.ImageData.Runscript.Script)
+	}
+}
+
+func TestParseDockerfileCopyFromImage(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	defs, err := ParseDockerfile(strings.NewReader("FROM alpine\nCOPY --from=nginx:latest /etc/nginx /etc/nginx\n"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []types.Files{
+		{Args: "from docker://nginx:latest", Files: []types.FileTransport{{Src: "/etc/nginx", Dst: "/etc/nginx"}}},
+	}
+	if len(defs) != 1 || !reflect.DeepEqual(defs[0].BuildData.Files, expected) {
+		t.Errorf("unexpected files: %+v", defs)
+	}
+}
+
+func TestParseDockerfileCopyAfterRun(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "dockerfile-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "config"), []byte("config"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dockerfile := "FROM alpine\nCOPY config /etc/first\nRUN rm -rf /etc\nCOPY config /etc/\n"
+	defs, err := ParseDockerfile(strings.NewReader(dockerfile), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the copy preceding RUN is direct, the following one is staged
+	expected := []types.Files{{Files: []types.FileTransport{
+		{Src: filepath.Join(dir, "config"), Dst: "/etc/first"},
+		{Src: filepath.Join(dir, "config"), Dst: "/.singularity-copy-0/0"},
+	}}}
+	if len(defs) != 1 || !reflect.DeepEqual(defs[0].BuildData.Files, expected) {
+		t.Fatalf("unexpected files: %+v", defs)
+	}
+
+	script := defs[0].BuildData.Post.Script
+	run := strings.Index(script, "rm -rf /etc")
+	move := strings.Index(script, `cp -a "/.singularity-copy-0/0" "/etc/config"`)
+	cleanup := strings.Index(script, `rm -rf "/.singularity-copy-0"`)
+	if run < 0 || move < run || cleanup < move {
+		t.Errorf("staged copy not moved after RUN in post script:\n%s", script)
+	}
+}
+
+func TestParseDockerfileErrors(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "dockerfile-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name       string
+		dockerfile string
+	}{
+		{"no from", "RUN true\n"},
+		{"outside context", "FROM alpine\nCOPY ../secret /\n"},
+		{"missing source", "FROM alpine\nCOPY missing /\n"},
+		{"previous stage", "FROM alpine AS base\nFROM base\n"},
+		{"remote source", "FROM alpine\nADD https://example.com/file /\n"},
+		{"unterminated quote", "FROM alpine\nENV A=\"b\n"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseDockerfile(strings.NewReader(tt.dockerfile), dir, nil); err == nil {
+			t.Errorf("%s: unexpected success", tt.name)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	vars := map[string]string{"A": "1", "B": "two words"}
+
+	tests := []struct {
+		in       string
+		expected []string
+	}{
+		{`a b  c`, []string{"a", "b", "c"}},
+		{`k="$B" l='$B' m=\$A`, []string{"k=two words", "l=$B", "m=$A"}},
+		{`${A}x ${C:-def} ${A:+alt} ${C:+alt}`, []string{"1x", "def", "alt", ""}},
+		{`"" $ $C`, []string{"", "$", ""}},
+	}
+	for _, tt := range tests {
+		w, err := words(tt.in, vars)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.in, err)
+		} else if !reflect.DeepEqual(w, tt.expected) {
+			t.Errorf("unexpected words %q for %q, expected %q", w, tt.in, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// includeDirective is replaced by the content of the file given as
+// argument, it stands alone and must be followed by a section
+const includeDirective = "include"
+
+// HasIncludes returns if the definition raw has %include lines
+func HasIncludes(raw []byte) bool {
+	for _, line := range strings.Split(string(raw), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.HasPrefix(line, "%") && getSectionName(fields[0]) == includeDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandIncludes returns the definition read from r with its unindented
+// %include lines replaced by the content of the included files, which may include
+// other files. Relative paths are resolved from the directory of the
+// including file, path is the definition file path or an empty string
+// when the definition isn't read from a file, in which case paths are
+// resolved from the current working directory.
+func ExpandIncludes(r io.Reader, path string) (io.Reader, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("while attempting to read in definition: %v", err)
+	}
+
+	var stack []string
+	if path != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, abs)
+		path = abs
+	} else if path, err = filepath.Abs("stdin"); err != nil {
+		return nil, err
+	}
+	// only the directory of path is used to resolve includes
+
+	var def bytes.Buffer
+	if err := expandIncludes(&def, raw, path, stack); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// expandIncludes writes raw, read from path, to w with included files
+// expanded, stack holds the files being included to detect cycles
+func expandIncludes(w *bytes.Buffer, raw []byte, path string, stack []string) error {
+	name := filepath.Base(path)
+	included := false
+
+	for i, line := range strings.SplitAfter(string(raw), "\n") {
+		fields := strings.Fields(line)
+
+		// only unindented lines are section level, indented ones are
+		// part of a section body like a %post script
+		if len(fields) > 0 && strings.HasPrefix(line, "%") {
+			included = getSectionName(fields[0]) == includeDirective
+			if !included {
+				w.WriteString(line)
+				continue
+			}
+			if len(fields) != 2 {
+				return fmt.Errorf("%s: line %d: %%%s expects a single file path", name, i+1, includeDirective)
+			}
+			if err := includeFile(w, fields[1], path, stack); err != nil {
+				return fmt.Errorf("%s: line %d: %s", name, i+1, err)
+			}
+			continue
+		} else if stageHeader.MatchString(strings.TrimSpace(line)) {
+			included = false
+		}
+
+		if included && len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+			return fmt.Errorf("%s: line %d: %%%s must be followed by a section", name, i+1, includeDirective)
+		}
+		w.WriteString(line)
+	}
+	return nil
+}
+
+// includeFile writes the expanded content of the file include, included
+// from the file path, to w
+func includeFile(w *bytes.Buffer, include, path string, stack []string) error {
+	if !filepath.IsAbs(include) {
+		include = filepath.Join(filepath.Dir(path), include)
+	}
+	include = filepath.Clean(include)
+
+	for i, p := range stack {
+		if p == include {
+			cycle := make([]string, 0, len(stack)-i+1)
+			for _, p := range append(stack[i:], include) {
+				cycle = append(cycle, filepath.Base(p))
+			}
+			return fmt.Errorf("include cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	raw, err := ioutil.ReadFile(include)
+	if err != nil {
+		return fmt.Errorf("while including file: %s", err)
+	}
+	if err := expandIncludes(w, raw, include, append(stack[:len(stack):len(stack)], include)); err != nil {
+		return err
+	}
+	if len(raw) > 0 && raw[len(raw)-1] != '\n' {
+		w.WriteString("\n")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestExpandIncludes(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "include-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"common/env.def":    "%environment\n    export LC_ALL=C\n\n%include labels.def\n",
+		"common/labels.def": "%labels\n    site hpc",
+		"cycle/a.def":       "%include b.def\n",
+		"cycle/b.def":       "%include a.def\n",
+		"body.def":          "%include common/labels.def\n    echo\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	def := "Bootstrap: docker\nFrom: alpine\n\n%include common/env.def\n\n%post\n    true\n"
+	expected := "Bootstrap: docker\nFrom: alpine\n\n%environment\n    export LC_ALL=C\n\n%labels\n    site hpc\n\n%post\n    true\n"
+
+	r, err := ExpandIncludes(strings.NewReader(def), filepath.Join(dir, "main.def"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != expected {
+		t.Errorf("unexpected definition:\n%s", b)
+	}
+
+	// script lines of a section are not expanded
+	def = "Bootstrap: docker\nFrom: alpine\n\n%post\n    %include common/env.def\n"
+	r, err = ExpandIncludes(strings.NewReader(def), filepath.Join(dir, "main.def"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b, err = ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != def {
+		t.Errorf("unexpected expansion in section body:\n%s", b)
+	}
+
+	failures := []struct {
+		name string
+		def  string
+		err  string
+	}{
+		{"missing", "%include missing.def\n", "no such file"},
+		{"cycle", "%include cycle/a.def\n", "include cycle detected: a.def -> b.def -> a.def"},
+		{"body", "%include body.def\n", "must be followed by a section"},
+		{"arguments", "%include a.def b.def\n", "expects a single file path"},
+	}
+	for _, tt := range failures {
+		_, err := ExpandIncludes(strings.NewReader(tt.def), filepath.Join(dir, "main.def"))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: unexpected error %v, expected %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestHasIncludes(t *testing.T) {
+	tests := []struct {
+		def      string
+		expected bool
+	}{
+		{"Bootstrap: docker\n%include base.def\n", true},
+		{"Bootstrap: docker\n%post\n    %include base.def\n", false},
+		{"Bootstrap: docker\n%post\n    echo\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if HasIncludes([]byte(tt.def)) != tt.expected {
+			t.Errorf("unexpected result for %q, expected %v", tt.def, tt.expected)
+		}
+	}
+}
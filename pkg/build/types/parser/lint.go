@@ -0,0 +1,367 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Problem is an issue found in a definition file by Lint
+type Problem struct {
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// bootstrapHeaders holds the supported bootstrap agents and the headers
+// they require
+var bootstrapHeaders = map[string][]string{
+	"library":        {"From"},
+	"shub":           {"From"},
+	"docker":         {"From"},
+	"docker-archive": {"From"},
+	"docker-daemon":  {"From"},
+	"oci":            {"From"},
+	"oci-archive":    {"From"},
+	"busybox":        {"MirrorURL"},
+	"debootstrap":    {"MirrorURL", "OSVersion"},
+	"arch":           {},
+	"localimage":     {"From"},
+	"sandbox":        {"From"},
+	"instance":       {"From"},
+	"yum":            {"MirrorURL"},
+	"zypper":         {},
+	"scratch":        {},
+	"conda":          {"From"},
+	"nix":            {"From"},
+	"guix":           {"From"},
+}
+
+// scriptSections are the sections run by a shell
+var scriptSections = map[string]bool{
+	"setup":       true,
+	"post":        true,
+	"test":        true,
+	"environment": true,
+	"runscript":   true,
+	"startscript": true,
+	"appinstall":  true,
+	"appenv":      true,
+	"apptest":     true,
+	"apprun":      true,
+}
+
+// shellError matches the syntax errors reported by sh -n and bash -n,
+// as "sh: 4: message" and "bash: line 4: message"
+var shellError = regexp.MustCompile(`^[^:]*: (?:line )?(\d+): (.*)$`)
+
+type lintLine struct {
+	n    int
+	text string
+}
+
+type lintSection struct {
+	line int
+	name string
+	args string
+	body []lintLine
+}
+
+type linter struct {
+	dir      string
+	problems []Problem
+	// stage is the name of the current stage, stages holds the names of
+	// the previous ones
+	stage  string
+	stages map[string]bool
+}
+
+// Lint checks the definition read from r without building it, it reports
+// invalid headers and sections, missing %files sources and shell syntax
+// errors of scripts with their line number. Relative %files sources are
+// resolved from dir.
+func Lint(r io.Reader, dir string) ([]Problem, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("while attempting to read in definition: %v", err)
+	}
+
+	l := &linter{dir: dir, stages: make(map[string]bool)}
+
+	var header []lintLine
+	var section *lintSection
+	empty := true
+
+	for i, text := range strings.Split(string(raw), "\n") {
+		line := lintLine{i + 1, text}
+		fields := strings.Fields(text)
+
+		if len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+			empty = false
+		}
+
+		switch {
+		case stageHeader.MatchString(strings.TrimSpace(text)):
+			l.checkSection(section)
+			l.checkHeader(header)
+			if l.stage != "" {
+				l.stages[l.stage] = true
+			}
+			l.stage = ""
+			header = []lintLine{line}
+			section = nil
+		case len(fields) > 0 && strings.HasPrefix(fields[0], "%"):
+			l.checkSection(section)
+			if section == nil {
+				l.checkHeader(header)
+				header = nil
+			}
+			section = &lintSection{
+				line: line.n,
+				name: getSectionName(fields[0]),
+				args: strings.Join(fields[1:], " "),
+			}
+		case section != nil:
+			section.body = append(section.body, line)
+		default:
+			header = append(header, line)
+		}
+	}
+	l.checkSection(section)
+	l.checkHeader(header)
+
+	if empty {
+		l.report(1, "empty definition file")
+	}
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		return l.problems[i].Line < l.problems[j].Line
+	})
+	return l.problems, nil
+}
+
+func (l *linter) report(n int, format string, a ...interface{}) {
+	l.problems = append(l.problems, Problem{Line: n, Message: fmt.Sprintf(format, a...)})
+}
+
+// checkHeader checks the keywords of a stage header and the headers
+// required by its bootstrap agent
+func (l *linter) checkHeader(lines []lintLine) {
+	keys := make(map[string]int)
+	values := make(map[string]string)
+	first := 0
+
+	for _, line := range lines {
+		text := strings.TrimSpace(line.text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if first == 0 {
+			first = line.n
+		}
+
+		toks := strings.SplitN(strings.Split(text, "#")[0], ":", 2)
+		if len(toks) == 1 {
+			l.report(line.n, "header key %s has no value", strings.TrimSpace(toks[0]))
+			continue
+		}
+		key, val := strings.ToLower(strings.TrimSpace(toks[0])), strings.TrimSpace(toks[1])
+		if !validHeaders[key] {
+			l.report(line.n, "invalid header keyword %s", strings.TrimSpace(toks[0]))
+			continue
+		}
+		if n, ok := keys[key]; ok {
+			l.report(line.n, "duplicate header keyword %s, already set at line %d", strings.TrimSpace(toks[0]), n)
+		}
+		keys[key] = line.n
+		values[key] = val
+	}
+	if first == 0 {
+		return
+	}
+	l.stage = values["stage"]
+
+	bootstrap, ok := values["bootstrap"]
+	if !ok {
+		l.report(first, "header has no Bootstrap keyword")
+		return
+	}
+	required, ok := bootstrapHeaders[bootstrap]
+	if !ok {
+		l.report(keys["bootstrap"], "invalid bootstrap agent %q", bootstrap)
+		return
+	}
+	for _, h := range required {
+		if values[strings.ToLower(h)] == "" {
+			l.report(keys["bootstrap"], "bootstrap agent %s requires a %s header", bootstrap, h)
+		}
+	}
+}
+
+// checkSection checks the name of a section and its content
+func (l *linter) checkSection(s *lintSection) {
+	if s == nil {
+		return
+	}
+
+	switch {
+	case s.name == argumentsSection:
+		args := make(map[string]string)
+		for _, line := range s.body {
+			text := strings.TrimSpace(line.text)
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			if err := addBuildArg(args, text); err != nil {
+				l.report(line.n, "in %%%s section: %s", argumentsSection, err)
+			}
+		}
+		return
+	case s.name == includeDirective:
+		// included files are checked by ExpandIncludes
+		return
+	case appSections[s.name]:
+		if s.args == "" {
+			l.report(s.line, "app section %%%s has no app name", s.name)
+			return
+		}
+	case !validSections[s.name]:
+		l.report(s.line, "unknown section %%%s", s.name)
+		return
+	}
+
+	if s.name == "files" || s.name == "appfiles" {
+		l.checkFiles(s)
+	}
+	if scriptSections[s.name] {
+		l.checkScript(s)
+	}
+}
+
+// checkFiles checks that the host sources of a %files section exist and
+// that the stage or image of a '%files from' section can be found
+func (l *linter) checkFiles(s *lintSection) {
+	if s.name == "files" && s.args != "" {
+		f := strings.Fields(strings.Split(s.args, "#")[0])
+		if len(f) < 2 || len(f) > 4 || f[0] != "from" {
+			l.report(s.line, "invalid %%files arguments %q, expected from <stage|image> [path [destination]]", s.args)
+			return
+		}
+		src := f[1]
+		if !l.stages[src] && !strings.Contains(src, "://") && !strings.Contains(src, "{{") && !l.exists(src) {
+			l.report(s.line, "%%files source %s is neither a previous stage nor an image", src)
+		}
+		return
+	}
+
+	for _, line := range s.body {
+		text := strings.TrimSpace(line.text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		src := strings.Fields(text)[0]
+		if !strings.Contains(src, "{{") && !l.exists(src) {
+			l.report(line.n, "%%%s source %s doesn't exist", s.name, src)
+		}
+	}
+}
+
+func (l *linter) exists(path string) bool {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(l.dir, path)
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// checkScript checks the syntax of a script with sh -n, or bash -n when
+// the script is run by bash, scripts of other interpreters selected with
+// -i, -c or a shebang line are ignored
+func (l *linter) checkScript(s *lintSection) {
+	interpreter := "/bin/sh"
+	if args := strings.Fields(strings.Split(s.args, "#")[0]); len(args) > 0 && (args[0] == "-i" || args[0] == "-c") {
+		if len(args) < 2 {
+			l.report(s.line, "missing interpreter after %s in %%%s section header", args[0], s.name)
+			return
+		}
+		interpreter = args[1]
+	}
+	for _, line := range s.body {
+		text := strings.TrimSpace(line.text)
+		if text == "" {
+			continue
+		}
+		if f := strings.Fields(strings.TrimPrefix(text, "#!")); strings.HasPrefix(text, "#!") && len(f) > 0 {
+			interpreter = f[0]
+			if filepath.Base(interpreter) == "env" && len(f) > 1 {
+				interpreter = f[1]
+			}
+		}
+		break
+	}
+
+	var shell string
+	switch filepath.Base(interpreter) {
+	case "sh", "dash":
+		shell = "/bin/sh"
+	case "bash":
+		shell = "bash"
+	default:
+		return
+	}
+	path, err := exec.LookPath(shell)
+	if err != nil {
+		return
+	}
+
+	lines := make([]string, 0, len(s.body))
+	last := 0
+	for i, line := range s.body {
+		lines = append(lines, line.text)
+		if strings.TrimSpace(line.text) != "" {
+			last = i + 1
+		}
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, "-n")
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		return
+	}
+
+	found := false
+	for _, msg := range strings.Split(stderr.String(), "\n") {
+		m := shellError.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		// unexpected end of file is reported past the last line
+		n, _ := strconv.Atoi(m[1])
+		if n > last {
+			n = last
+		}
+		l.report(s.line+n, "%%%s: %s", s.name, m[2])
+		found = true
+	}
+	if !found {
+		l.report(s.line, "%%%s: %s", s.name, strings.TrimSpace(stderr.String()))
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestLint(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "lint-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+
+	tests := []struct {
+		name       string
+		definition string
+		expected   []string
+	}{
+		{
+			name: "valid",
+			definition: `Bootstrap: docker
+From: golang:{{ GO_VERSION }}
+Stage: builder
+
+%arguments
+    GO_VERSION=1.21
+
+%files
+    hello.txt /opt/hello.txt
+
+%post
+    if [ -f /opt/hello.txt ]; then
+        cat /opt/hello.txt
+    fi
+
+Bootstrap: library
+From: alpine
+
+%files from builder
+    /opt/hello.txt
+
+%post -i /usr/bin/python3
+    print("not shell"
+
+%apprun hello
+    echo hello
+`,
+		},
+		{
+			name: "header",
+			definition: `Bootstrap: dockerr
+From: alpine
+Form: alpine
+From: debian
+
+Bootstrap: debootstrap
+MirrorURL: http://ftp.debian.org/debian
+`,
+			expected: []string{
+				"line 1: invalid bootstrap agent \"dockerr\"",
+				"line 3: invalid header keyword Form",
+				"line 4: duplicate header keyword From, already set at line 2",
+				"line 6: bootstrap agent debootstrap requires a OSVersion header",
+			},
+		},
+		{
+			name: "sections",
+			definition: `Bootstrap: scratch
+
+%pots
+    true
+%apprun
+    true
+%files from builder
+%files
+    missing.txt /opt
+`,
+			expected: []string{
+				"line 3: unknown section %pots",
+				"line 5: app section %apprun has no app name",
+				"line 7: %files source builder is neither a previous stage nor an image",
+				"line 9: %files source missing.txt doesn't exist",
+			},
+		},
+		{
+			name: "shell",
+			definition: `Bootstrap: scratch
+
+%post
+    echo start
+    if true; then
+        echo $(
+    fi
+
+%test -i /bin/bash
+    for i in 1 2; do
+        echo $i
+`,
+			expected: []string{
+				"line 7: %post: Syntax error: \"fi\" unexpected (expecting \")\")",
+				"line 11: %test: syntax error: unexpected end of file",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		problems, err := Lint(strings.NewReader(tt.definition), dir)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, p := range problems {
+			got = append(got, p.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: unexpected problems:\n%s\nexpected:\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.expected, "\n"))
+		}
+	}
+}
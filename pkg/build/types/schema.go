@@ -0,0 +1,101 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package types
+
+// DefinitionSchema is the JSON schema of definitions serialized to JSON,
+// a definition file is a single definition or an array of definitions,
+// one per stage. Header keywords are lower cased, custom data holds app
+// and custom sections by section header such as "apprun foo".
+const DefinitionSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://sylabs.io/schemas/singularity/definition.json",
+  "title": "Singularity definition file",
+  "oneOf": [
+    {"$ref": "#/definitions/definition"},
+    {"type": "array", "minItems": 1, "items": {"$ref": "#/definitions/definition"}}
+  ],
+  "definitions": {
+    "script": {
+      "type": "object",
+      "properties": {
+        "args": {"type": "string"},
+        "script": {"type": "string"}
+      },
+      "additionalProperties": false
+    },
+    "files": {
+      "type": "object",
+      "properties": {
+        "args": {"type": "string"},
+        "files": {
+          "type": ["array", "null"],
+          "items": {
+            "type": "object",
+            "properties": {
+              "source": {"type": "string"},
+              "destination": {"type": "string"}
+            },
+            "required": ["source"],
+            "additionalProperties": false
+          }
+        }
+      },
+      "additionalProperties": false
+    },
+    "definition": {
+      "type": "object",
+      "properties": {
+        "header": {
+          "type": ["object", "null"],
+          "propertyNames": {
+            "enum": ["bootstrap", "from", "includecmd", "mirrorurl", "updateurl", "osversion", "include", "library", "registry", "namespace", "stage", "base", "channels", "micromambasha256", "repos", "gpgkey", "gpgcheck", "variant", "components", "keyring", "proxy", "testtimeout", "testretries", "testskip"]
+          },
+          "additionalProperties": {"type": "string"}
+        },
+        "imageData": {
+          "type": "object",
+          "properties": {
+            "metadata": {"type": ["string", "null"], "contentEncoding": "base64"},
+            "labels": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+            "imageScripts": {
+              "type": "object",
+              "properties": {
+                "help": {"$ref": "#/definitions/script"},
+                "environment": {"$ref": "#/definitions/script"},
+                "runScript": {"$ref": "#/definitions/script"},
+                "test": {"$ref": "#/definitions/script"},
+                "startScript": {"$ref": "#/definitions/script"}
+              },
+              "additionalProperties": false
+            }
+          },
+          "additionalProperties": false
+        },
+        "buildData": {
+          "type": "object",
+          "properties": {
+            "files": {"type": ["array", "null"], "items": {"$ref": "#/definitions/files"}},
+            "buildScripts": {
+              "type": "object",
+              "properties": {
+                "pre": {"$ref": "#/definitions/script"},
+                "setup": {"$ref": "#/definitions/script"},
+                "post": {"$ref": "#/definitions/script"},
+                "test": {"$ref": "#/definitions/script"}
+              },
+              "additionalProperties": false
+            }
+          },
+          "additionalProperties": false
+        },
+        "customData": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+        "raw": {"type": "string", "contentEncoding": "base64"}
+      },
+      "additionalProperties": false
+    }
+  }
+}
+`
@@ -8,6 +8,7 @@ package client
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -22,6 +23,9 @@ import (
 // HTTP timeout in seconds
 const httpTimeout = 10
 
+// ErrNotFound is returned when the requested image doesn't exist in the library
+var ErrNotFound = errors.New("the requested image was not found in the library")
+
 func getEntity(baseURL string, authToken string, entityRef string) (entity Entity, found bool, err error) {
 	url := (baseURL + "/v1/entities/" + entityRef)
 	entJSON, found, err := apiGet(url, authToken)
@@ -345,7 +349,7 @@ func GetImage(baseURL string, authToken string, imageRef string) (image Image, e
 	if err != nil {
 		return Image{}, err
 	} else if !f {
-		return Image{}, fmt.Errorf("the requested image was not found in the library")
+		return Image{}, ErrNotFound
 	}
 
 	return i, nil
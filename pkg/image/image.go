@@ -12,7 +12,9 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/pkg/errors"
 	"github.com/sylabs/singularity/internal/pkg/sylog"
+	"github.com/sylabs/singularity/internal/pkg/util/errctx"
 	"github.com/sylabs/singularity/internal/pkg/util/user"
 )
 
@@ -44,6 +46,16 @@ var registeredFormats = []struct {
 	{"ext3", &ext3Format{}},
 }
 
+// Formats returns the names of the image formats which can be opened, in
+// the order they are checked
+func Formats() []string {
+	names := make([]string, len(registeredFormats))
+	for i, rf := range registeredFormats {
+		names[i] = rf.name
+	}
+	return names
+}
+
 // format describes the interface that an image format type must implement.
 type format interface {
 	openMode(bool) int
@@ -72,6 +84,8 @@ type Image struct {
 	Writable   bool      `json:"writable"`
 	Partitions []Section `json:"partitions"`
 	Sections   []Section `json:"sections"`
+	// Architecture is the Go architecture recorded in SIF images
+	Architecture string `json:"architecture,omitempty"`
 }
 
 // AuthorizedPath checks if image is in a path supplied in paths
@@ -148,11 +162,15 @@ func (i *Image) HasRootFs() bool {
 func ResolvePath(path string) (string, error) {
 	abspath, err := filepath.Abs(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path: %s", err)
+		return "", errctx.Wrap(err, "failed to get absolute path", "")
 	}
 	resolvedPath, err := filepath.EvalSymlinks(abspath)
 	if err != nil {
-		return "", fmt.Errorf("failed to retrieved path for %s: %s", path, err)
+		err = errctx.Wrap(err, "failed to retrieve path for", path)
+		if os.IsNotExist(errors.Cause(err)) {
+			err = errctx.WithHint(err, "check the image path, remote images must be referenced with their URI (library://, docker://, shub://)")
+		}
+		return "", err
 	}
 	return resolvedPath, nil
 }
@@ -188,6 +206,10 @@ func Init(path string, writable bool) (*Image, error) {
 
 		img.File, err = os.OpenFile(resolvedPath, mode, 0)
 		if err != nil {
+			// report stale NFS file handles so callers can retry
+			if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.ESTALE {
+				return nil, err
+			}
 			continue
 		}
 		fileinfo, err := img.File.Stat()
@@ -211,5 +233,8 @@ func Init(path string, writable bool) (*Image, error) {
 
 		return img, nil
 	}
-	return nil, fmt.Errorf("image format not recognized")
+	return nil, errctx.WithHint(
+		fmt.Errorf("image format not recognized"),
+		"supported formats are SIF, squashfs, ext3 images and sandbox directories",
+	)
 }
@@ -0,0 +1,80 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+const (
+	// SeccompProfilePath is the path of the seccomp profile recommended
+	// by an image in its root filesystem
+	SeccompProfilePath = "/.singularity.d/seccomp.json"
+	// SeccompProfileName is the name of the SIF JSON data object holding
+	// the seccomp profile recommended by an image
+	SeccompProfileName = "seccomp.json"
+)
+
+// maxSeccompProfileSize bounds the size of image seccomp profiles
+const maxSeccompProfileSize = 1 << 20
+
+// SeccompProfile returns the seccomp profile recommended by image img,
+// the profile of a SIF image is stored in a JSON data object named
+// SeccompProfileName, sandbox profiles are read from SeccompProfilePath.
+// Nil is returned if the image doesn't provide a profile.
+func SeccompProfile(img *Image) ([]byte, error) {
+	var r io.Reader
+
+	switch img.Type {
+	case SANDBOX:
+		path := filepath.Join(img.Path, SeccompProfilePath)
+		// the profile must be part of the image
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a regular file", SeccompProfilePath)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	case SIF:
+		for i, s := range img.Sections {
+			if s.Type != uint32(sif.DataGenericJSON) || s.Name != SeccompProfileName {
+				continue
+			}
+			var err error
+			if r, err = NewSectionReader(img, "", i); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if r == nil {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxSeccompProfileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("while reading seccomp profile: %s", err)
+	}
+	if len(data) > maxSeccompProfileSize {
+		return nil, fmt.Errorf("seccomp profile exceeds %d bytes", maxSeccompProfileSize)
+	}
+	return data, nil
+}
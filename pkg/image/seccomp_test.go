@@ -0,0 +1,88 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package image
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+const testProfile = `{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["ptrace"], "action": "SCMP_ACT_ERRNO"}]}`
+
+func TestSeccompProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seccomp-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// sandbox without profile
+	sandbox := filepath.Join(dir, "sandbox")
+	if err := os.MkdirAll(filepath.Join(sandbox, ".singularity.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	img, err := Init(sandbox, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := SeccompProfile(img); p != nil || err != nil {
+		t.Errorf("unexpected profile for sandbox without profile: %q %v", p, err)
+	}
+
+	// profiles must not be symbolic links
+	path := filepath.Join(sandbox, SeccompProfilePath)
+	if err := os.Symlink("/etc/passwd", path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SeccompProfile(img); err == nil {
+		t.Errorf("unexpected success with a symbolic link profile")
+	}
+	os.Remove(path)
+
+	if err := ioutil.WriteFile(path, []byte(testProfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := SeccompProfile(img); string(p) != testProfile || err != nil {
+		t.Errorf("unexpected sandbox profile: %q %v", p, err)
+	}
+	img.File.Close()
+
+	// SIF with a profile data object
+	sifPath := filepath.Join(dir, "image.sif")
+	cinfo := sif.CreateInfo{
+		Pathname:   sifPath,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+	}
+	for name, data := range map[string]string{"oci-config.json": "{}", SeccompProfileName: testProfile} {
+		cinfo.InputDescr = append(cinfo.InputDescr, sif.DescriptorInput{
+			Datatype: sif.DataGenericJSON,
+			Groupid:  sif.DescrDefaultGroup,
+			Link:     sif.DescrUnusedLink,
+			Size:     int64(len(data)),
+			Fname:    name,
+			Fp:       bytes.NewReader([]byte(data)),
+		})
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatal(err)
+	}
+	img, err = Init(sifPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.File.Close()
+	if p, err := SeccompProfile(img); string(p) != testProfile || err != nil {
+		t.Errorf("unexpected SIF profile: %q %v", p, err)
+	}
+}
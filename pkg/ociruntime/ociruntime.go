@@ -22,6 +22,10 @@ const (
 	Paused = "paused"
 )
 
+// OOMKilledAnnotation is the state annotation set to the number of
+// container processes killed by the out of memory killer
+const OOMKilledAnnotation = "io.sylabs.singularity.oom-killed"
+
 // State represents the state of the container
 type State struct {
 	specs.State
@@ -34,12 +38,84 @@ type State struct {
 	ControlSocket string `json:"controlSocket,omitempty"`
 }
 
+// ControlVersion is the version of the control socket protocol, it's
+// increased each time control operations are added: version 1 added
+// Hello negotiation and version 2 added Wait
+const ControlVersion = 2
+
+const (
+	// ControlConsoleSize is the capability to resize terminal
+	ControlConsoleSize = "consoleSize"
+	// ControlReopenLog is the capability to reopen log files
+	ControlReopenLog = "reopenLog"
+	// ControlStartContainer is the capability to start container
+	ControlStartContainer = "startContainer"
+	// ControlPause is the capability to pause container
+	ControlPause = "pause"
+	// ControlResume is the capability to resume container
+	ControlResume = "resume"
+	// ControlWait is the capability to wait for container exit
+	ControlWait = "wait"
+)
+
+// ControlCapabilities lists control operations supported by the
+// current protocol version
+var ControlCapabilities = []string{
+	ControlConsoleSize,
+	ControlReopenLog,
+	ControlStartContainer,
+	ControlPause,
+	ControlResume,
+	ControlWait,
+}
+
+// LegacyControlCapabilities lists control operations supported by
+// engines predating protocol version negotiation (version 0)
+var LegacyControlCapabilities = []string{
+	ControlConsoleSize,
+	ControlReopenLog,
+	ControlStartContainer,
+	ControlPause,
+	ControlResume,
+}
+
 // Control is used to pass information for container control
-// like terminal resize or log file reopen
+// like terminal resize or log file reopen. Hello requests the
+// protocol version and capabilities of the engine, which replies
+// with ControlInfo, unknown operations are ignored by the engine.
+// Wait keeps the connection open until the container stops, the
+// engine then replies with ControlExit.
 type Control struct {
+	Version        int        `json:"version,omitempty"`
+	Hello          bool       `json:"hello,omitempty"`
 	ConsoleSize    *specs.Box `json:"consoleSize,omitempty"`
 	ReopenLog      bool       `json:"reopenLog,omitempty"`
 	StartContainer bool       `json:"startContainer,omitempty"`
 	Pause          bool       `json:"pause,omitempty"`
 	Resume         bool       `json:"resume,omitempty"`
+	Wait           bool       `json:"wait,omitempty"`
+}
+
+// ControlExit is sent by the engine to Wait controls once the
+// container is stopped
+type ControlExit struct {
+	ExitCode int    `json:"exitCode"`
+	ExitDesc string `json:"exitDesc,omitempty"`
+}
+
+// ControlInfo is sent by the engine in reply to a Hello control
+type ControlInfo struct {
+	Version      int      `json:"version"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// HasCapability returns whether the engine supports the control
+// operation capability
+func (i *ControlInfo) HasCapability(capability string) bool {
+	for _, c := range i.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,46 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package ociruntime
+
+import (
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestHasCapability(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	info := &ControlInfo{Version: ControlVersion, Capabilities: ControlCapabilities}
+	legacy := &ControlInfo{Capabilities: LegacyControlCapabilities}
+
+	tests := []struct {
+		name       string
+		info       *ControlInfo
+		capability string
+		expected   bool
+	}{
+		{"current wait", info, ControlWait, true},
+		{"current pause", info, ControlPause, true},
+		{"current unknown", info, "unknown", false},
+		{"legacy wait", legacy, ControlWait, false},
+		{"legacy console size", legacy, ControlConsoleSize, true},
+		{"empty", &ControlInfo{}, ControlStartContainer, false},
+	}
+	for _, tt := range tests {
+		if has := tt.info.HasCapability(tt.capability); has != tt.expected {
+			t.Errorf("%s: unexpected HasCapability(%s) %v", tt.name, tt.capability, has)
+		}
+	}
+
+	// engines only add capabilities
+	for _, c := range LegacyControlCapabilities {
+		if !info.HasCapability(c) {
+			t.Errorf("legacy capability %s missing from current capabilities", c)
+		}
+	}
+}
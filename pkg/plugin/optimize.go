@@ -0,0 +1,19 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+// OptimizePassFn is the callback function type for optimization pass
+// hooks. It is called with the path of the root filesystem of an image
+// before it's assembled and can modify the files below it.
+type OptimizePassFn func(rootfs string) error
+
+// OptimizePassHook provides plugins the ability to add optimization
+// passes selected by name with --optimize. Passes registered by plugins
+// run after the built-in passes.
+type OptimizePassHook struct {
+	Name string
+	Run  OptimizePassFn
+}
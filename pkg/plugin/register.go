@@ -10,4 +10,7 @@ package plugin
 type HookRegistration interface {
 	RegisterStringFlag(StringFlagHook) error
 	RegisterBoolFlag(BoolFlagHook) error
+	RegisterScratchProvider(ScratchProviderHook) error
+	RegisterStageProvider(StageProviderHook) error
+	RegisterOptimizePass(OptimizePassHook) error
 }
@@ -0,0 +1,26 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	singularity "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+// ScratchProviderFn is the callback function type for scratch provider
+// hooks. It is called when --scratch auto is requested and returns the
+// path of the host directory allocated for the job, this directory is
+// bound at /scratch inside the container and removed once the container
+// stopped. The EngineConfig object allows the plugin to inspect the
+// runtime parameters of the container.
+type ScratchProviderFn func(*singularity.EngineConfig) (string, error)
+
+// ScratchProviderHook provides plugins the ability to replace the
+// default allocation of per-job scratch directories. Only one scratch
+// provider can be registered.
+type ScratchProviderHook struct {
+	Name     string
+	Allocate ScratchProviderFn
+}
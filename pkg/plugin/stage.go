@@ -0,0 +1,28 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the URIs of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	singularity "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+// StageProviderFn is the callback function type for stage provider
+// hooks. It is called when --stage-to is requested with the staging
+// directory passed by the user and returns the path of a directory
+// living as long as the job, typically created below the staging
+// directory. Staged images are kept in this directory so later
+// containers of the same job reuse them, the plugin is responsible for
+// removing the directory at job end. The EngineConfig object allows the
+// plugin to inspect the runtime parameters of the container.
+type StageProviderFn func(*singularity.EngineConfig, string) (string, error)
+
+// StageProviderHook provides plugins the ability to tie the lifetime
+// of staged images to the job lifetime. Only one stage provider can be
+// registered.
+type StageProviderHook struct {
+	Name     string
+	Allocate StageProviderFn
+}
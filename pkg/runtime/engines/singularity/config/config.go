@@ -6,6 +6,8 @@
 package singularity
 
 import (
+	"time"
+
 	"github.com/sylabs/singularity/internal/pkg/runtime/engines/config/oci"
 	"github.com/sylabs/singularity/pkg/image"
 )
@@ -33,7 +35,15 @@ type FileConfig struct {
 	AllowContainerExtfs     bool     `default:"yes" authorized:"yes,no" directive:"allow container extfs"`
 	AllowContainerDir       bool     `default:"yes" authorized:"yes,no" directive:"allow container dir"`
 	AlwaysUseNv             bool     `default:"no" authorized:"yes,no" directive:"always use nv"`
+	AllowHostSingularity    bool     `default:"yes" authorized:"yes,no" directive:"allow host singularity"`
+	AllowSessionBus         bool     `default:"yes" authorized:"yes,no" directive:"allow session bus"`
+	AllowXDGRuntimeDir      bool     `default:"yes" authorized:"yes,no" directive:"allow xdg runtime dir"`
+	AllowGUI                bool     `default:"yes" authorized:"yes,no" directive:"allow gui"`
+	AllowAudio              bool     `default:"yes" authorized:"yes,no" directive:"allow audio"`
+	AllowVideo              bool     `default:"yes" authorized:"yes,no" directive:"allow video"`
+	AllowObserve            bool     `default:"no" authorized:"yes,no" directive:"allow observe"`
 	SharedLoopDevices       bool     `default:"no" authorized:"yes,no" directive:"shared loop devices"`
+	CopyNFSImages           bool     `default:"no" authorized:"yes,no" directive:"copy nfs images"`
 	MaxLoopDevices          uint     `default:"256" directive:"max loop devices"`
 	SessiondirMaxSize       uint     `default:"16" directive:"sessiondir max size"`
 	MountDev                string   `default:"yes" authorized:"yes,no,minimal" directive:"mount dev"`
@@ -43,54 +53,124 @@ type FileConfig struct {
 	LimitContainerGroups    []string `directive:"limit container groups"`
 	LimitContainerPaths     []string `directive:"limit container paths"`
 	AutofsBugPath           []string `directive:"autofs bug path"`
+	TmpPolicy               []string `directive:"tmp policy"`
+	ImageLabelFlags         []string `default:"nv" directive:"image label flags"`
+	AllowImageSeccomp       bool     `default:"yes" authorized:"yes,no" directive:"allow image seccomp"`
+	ScratchAutoPath         string   `default:"/tmp" directive:"scratch auto path"`
 	RootDefaultCapabilities string   `default:"full" authorized:"full,file,no" directive:"root default capabilities"`
 	MemoryFSType            string   `default:"tmpfs" authorized:"tmpfs,ramfs" directive:"memory fs type"`
 	CniConfPath             string   `directive:"cni configuration path"`
 	CniPluginPath           string   `directive:"cni plugin path"`
 	MksquashfsPath          string   `directive:"mksquashfs path"`
+	MksquashfsProcs         uint     `default:"0" directive:"mksquashfs procs"`
+	MksquashfsMem           string   `directive:"mksquashfs mem"`
+	MksquashfsBlockSize     string   `directive:"mksquashfs block size"`
+	QemuStaticPath          string   `directive:"qemu static path"`
+	BuildPreHook            []string `directive:"build pre hook"`
+	BuildPostHook           []string `directive:"build post hook"`
+	OciRuntime              string   `directive:"oci runtime"`
+	DockerMirrors           []string `directive:"docker mirror"`
+	DockerPullAttempts      uint     `default:"3" directive:"docker pull attempts"`
+	DockerAnonymousFirst    bool     `default:"no" authorized:"yes,no" directive:"docker anonymous first"`
+	Krb5CCacheHelper        string   `directive:"krb5 ccache helper"`
 }
 
 // JSONConfig stores engine specific confguration that is allowed to be set by the user
 type JSONConfig struct {
-	WritableImage bool          `json:"writableImage,omitempty"`
-	WritableTmpfs bool          `json:"writableTmpfs,omitempty"`
-	Contain       bool          `json:"container,omitempty"`
-	Nv            bool          `json:"nv,omitempty"`
-	CustomHome    bool          `json:"customHome,omitempty"`
-	Instance      bool          `json:"instance,omitempty"`
-	InstanceJoin  bool          `json:"instanceJoin,omitempty"`
-	BootInstance  bool          `json:"bootInstance,omitempty"`
-	RunPrivileged bool          `json:"runPrivileged,omitempty"`
-	AllowSUID     bool          `json:"allowSUID,omitempty"`
-	KeepPrivs     bool          `json:"keepPrivs,omitempty"`
-	NoPrivs       bool          `json:"noPrivs,omitempty"`
-	NoHome        bool          `json:"noHome,omitempty"`
-	NoInit        bool          `json:"noInit,omitempty"`
-	DeleteImage   bool          `json:"deleteImage,omitempty"`
-	Image         string        `json:"image"`
-	OverlayImage  []string      `json:"overlayImage,omitempty"`
-	Workdir       string        `json:"workdir,omitempty"`
-	ScratchDir    []string      `json:"scratchdir,omitempty"`
-	HomeSource    string        `json:"homedir,omitempty"`
-	HomeDest      string        `json:"homeDest,omitempty"`
-	BindPath      []string      `json:"bindpath,omitempty"`
-	Command       string        `json:"command,omitempty"`
-	Shell         string        `json:"shell,omitempty"`
-	TmpDir        string        `json:"tmpdir,omitempty"`
-	AddCaps       string        `json:"addCaps,omitempty"`
-	DropCaps      string        `json:"dropCaps,omitempty"`
-	Hostname      string        `json:"hostname,omitempty"`
-	ImageList     []image.Image `json:"imageList,omitempty"`
-	Network       string        `json:"network,omitempty"`
-	NetworkArgs   []string      `json:"networkArgs,omitempty"`
-	DNS           string        `json:"dns,omitempty"`
-	Cwd           string        `json:"cwd,omitempty"`
-	Security      []string      `json:"security,omitempty"`
-	OpenFd        []int         `json:"openFd,omitempty"`
-	CgroupsPath   string        `json:"cgroupsPath,omitempty"`
-	TargetUID     int           `json:"targetUID,omitempty"`
-	TargetGID     []int         `json:"targetGID,omitempty"`
-	LibrariesPath []string      `json:"librariesPath,omitempty"`
+	WritableImage   bool          `json:"writableImage,omitempty"`
+	WritableTmpfs   bool          `json:"writableTmpfs,omitempty"`
+	Contain         bool          `json:"container,omitempty"`
+	PrivateTmp      bool          `json:"privateTmp,omitempty"`
+	PrivateDevs     bool          `json:"privateDevs,omitempty"`
+	Nv              bool          `json:"nv,omitempty"`
+	HostSingularity bool          `json:"hostSingularity,omitempty"`
+	SessionBus      string        `json:"sessionBus,omitempty"`
+	XDGRuntimeDir   string        `json:"xdgRuntimeDir,omitempty"`
+	GUI             bool          `json:"gui,omitempty"`
+	X11Socket       string        `json:"x11Socket,omitempty"`
+	XAuthority      string        `json:"xAuthority,omitempty"`
+	WaylandSocket   string        `json:"waylandSocket,omitempty"`
+	MediaDevices    []string      `json:"mediaDevices,omitempty"`
+	PulseSocket     string        `json:"pulseSocket,omitempty"`
+	PulseCookie     string        `json:"pulseCookie,omitempty"`
+	CustomHome      bool          `json:"customHome,omitempty"`
+	Instance        bool          `json:"instance,omitempty"`
+	InstanceJoin    bool          `json:"instanceJoin,omitempty"`
+	BootInstance    bool          `json:"bootInstance,omitempty"`
+	RunPrivileged   bool          `json:"runPrivileged,omitempty"`
+	AllowSUID       bool          `json:"allowSUID,omitempty"`
+	KeepPrivs       bool          `json:"keepPrivs,omitempty"`
+	NoPrivs         bool          `json:"noPrivs,omitempty"`
+	NoHome          bool          `json:"noHome,omitempty"`
+	NoInit          bool          `json:"noInit,omitempty"`
+	NotifySocket    string        `json:"notifySocket,omitempty"`
+	DeleteImage     bool          `json:"deleteImage,omitempty"`
+	StageUser       string        `json:"stageUser,omitempty"`
+	Image           string        `json:"image"`
+	OverlayImage    []string      `json:"overlayImage,omitempty"`
+	ComposeImage    []string      `json:"composeImage,omitempty"`
+	Workdir         string        `json:"workdir,omitempty"`
+	ScratchDir      []string      `json:"scratchdir,omitempty"`
+	AutoScratch     string        `json:"autoScratch,omitempty"`
+	TmpPolicy       []string      `json:"tmpPolicy,omitempty"`
+	HomeSource      string        `json:"homedir,omitempty"`
+	HomeDest        string        `json:"homeDest,omitempty"`
+	HomeMode        string        `json:"homeMode,omitempty"`
+	PasswdEntries   []string      `json:"passwdEntries,omitempty"`
+	Krb5CCache      string        `json:"krb5CCache,omitempty"`
+	Krb5CCacheTemp  bool          `json:"krb5CCacheTemp,omitempty"`
+	Krb5Conf        string        `json:"krb5Conf,omitempty"`
+	BindPath        []string      `json:"bindpath,omitempty"`
+	Command         string        `json:"command,omitempty"`
+	Shell           string        `json:"shell,omitempty"`
+	TmpDir          string        `json:"tmpdir,omitempty"`
+	AddCaps         string        `json:"addCaps,omitempty"`
+	DropCaps        string        `json:"dropCaps,omitempty"`
+	Hostname        string        `json:"hostname,omitempty"`
+	ImageList       []image.Image `json:"imageList,omitempty"`
+	Network         string        `json:"network,omitempty"`
+	NetworkArgs     []string      `json:"networkArgs,omitempty"`
+	DNS             string        `json:"dns,omitempty"`
+	Cwd             string        `json:"cwd,omitempty"`
+	Security        []string      `json:"security,omitempty"`
+	OpenFd          []int         `json:"openFd,omitempty"`
+	CgroupsPath     string        `json:"cgroupsPath,omitempty"`
+	TargetUID       int           `json:"targetUID,omitempty"`
+	TargetGID       []int         `json:"targetGID,omitempty"`
+	LibrariesPath   []string      `json:"librariesPath,omitempty"`
+	Invocation      *Invocation   `json:"invocation,omitempty"`
+	Pty             bool          `json:"pty,omitempty"`
+	PtyTiming       string        `json:"ptyTiming,omitempty"`
+	PtyFd           []int         `json:"ptyFd,omitempty"`
+	Rusage          bool          `json:"rusage,omitempty"`
+	RusageFile      string        `json:"rusageFile,omitempty"`
+	Timeout         time.Duration `json:"timeout,omitempty"`
+	StopSignal      int           `json:"stopSignal,omitempty"`
+	StopTimeout     int           `json:"stopTimeout,omitempty"`
+	StrictPlatform  bool          `json:"strictPlatform,omitempty"`
+	NotifyURLs      []string      `json:"notifyURLs,omitempty"`
+	NotifyCommands  []string      `json:"notifyCommands,omitempty"`
+	NoImageSeccomp  bool          `json:"noImageSeccomp,omitempty"`
+	EnvViaFile      bool          `json:"envViaFile,omitempty"`
+	THP             string        `json:"thp,omitempty"`
+	MemPolicy       string        `json:"memPolicy,omitempty"`
+	Observe         bool          `json:"observe,omitempty"`
+	ObserveFile     string        `json:"observeFile,omitempty"`
+}
+
+// Invocation records a container execution so it can be reproduced
+// with singularity rerun
+type Invocation struct {
+	// Args are the singularity command line arguments
+	Args []string `json:"args"`
+	// Env lists SINGULARITY_ and SINGULARITYENV_ variables set at
+	// invocation
+	Env         []string `json:"env,omitempty"`
+	Cwd         string   `json:"cwd"`
+	Image       string   `json:"image"`
+	ImageDigest string   `json:"imageDigest,omitempty"`
+	Binds       []string `json:"binds,omitempty"`
+	Version     string   `json:"version"`
 }
 
 // NewConfig returns singularity.EngineConfig with a parsed FileConfig
@@ -134,6 +214,18 @@ func (e *EngineConfig) GetOverlayImage() []string {
 	return e.JSON.OverlayImage
 }
 
+// SetComposeImage sets the read-only images stacked in order on top of
+// the container image.
+func (e *EngineConfig) SetComposeImage(paths []string) {
+	e.JSON.ComposeImage = paths
+}
+
+// GetComposeImage retrieves the images stacked on top of the container
+// image.
+func (e *EngineConfig) GetComposeImage() []string {
+	return e.JSON.ComposeImage
+}
+
 // SetContain sets contain flag.
 func (e *EngineConfig) SetContain(contain bool) {
 	e.JSON.Contain = contain
@@ -144,6 +236,27 @@ func (e *EngineConfig) GetContain() bool {
 	return e.JSON.Contain
 }
 
+// SetPrivateTmp sets if /tmp and /var/tmp are empty directories, from
+// the workdir or the session, instead of the host directories.
+func (e *EngineConfig) SetPrivateTmp(private bool) {
+	e.JSON.PrivateTmp = private
+}
+
+// GetPrivateTmp returns if /tmp and /var/tmp are empty directories.
+func (e *EngineConfig) GetPrivateTmp() bool {
+	return e.JSON.PrivateTmp
+}
+
+// SetPrivateDevs sets if a minimal /dev is used instead of the host /dev.
+func (e *EngineConfig) SetPrivateDevs(private bool) {
+	e.JSON.PrivateDevs = private
+}
+
+// GetPrivateDevs returns if a minimal /dev is used instead of the host /dev.
+func (e *EngineConfig) GetPrivateDevs() bool {
+	return e.JSON.PrivateDevs
+}
+
 // SetNv sets nv flag to bind cuda libraries into containee.JSON.
 func (e *EngineConfig) SetNv(nv bool) {
 	e.JSON.Nv = nv
@@ -154,6 +267,120 @@ func (e *EngineConfig) GetNv() bool {
 	return e.JSON.Nv
 }
 
+// SetHostSingularity sets if the host singularity binary and
+// configuration are bound into container.
+func (e *EngineConfig) SetHostSingularity(host bool) {
+	e.JSON.HostSingularity = host
+}
+
+// GetHostSingularity returns if the host singularity binary and
+// configuration are bound into container.
+func (e *EngineConfig) GetHostSingularity() bool {
+	return e.JSON.HostSingularity
+}
+
+// SetSessionBus sets the host session D-Bus socket bound into
+// container.
+func (e *EngineConfig) SetSessionBus(path string) {
+	e.JSON.SessionBus = path
+}
+
+// GetSessionBus returns the host session D-Bus socket bound into
+// container.
+func (e *EngineConfig) GetSessionBus() string {
+	return e.JSON.SessionBus
+}
+
+// SetXDGRuntimeDir sets the host user runtime directory bound into
+// container.
+func (e *EngineConfig) SetXDGRuntimeDir(dir string) {
+	e.JSON.XDGRuntimeDir = dir
+}
+
+// GetXDGRuntimeDir returns the host user runtime directory bound into
+// container.
+func (e *EngineConfig) GetXDGRuntimeDir() string {
+	return e.JSON.XDGRuntimeDir
+}
+
+// SetGUI sets if the display sockets and the direct rendering devices
+// are provided to the container.
+func (e *EngineConfig) SetGUI(gui bool) {
+	e.JSON.GUI = gui
+}
+
+// GetGUI returns if the display sockets and the direct rendering devices
+// are provided to the container.
+func (e *EngineConfig) GetGUI() bool {
+	return e.JSON.GUI
+}
+
+// SetX11Socket sets the host X11 display socket bound into container.
+func (e *EngineConfig) SetX11Socket(path string) {
+	e.JSON.X11Socket = path
+}
+
+// GetX11Socket returns the host X11 display socket bound into container.
+func (e *EngineConfig) GetX11Socket() string {
+	return e.JSON.X11Socket
+}
+
+// SetXAuthority sets the host X authority file bound into container.
+func (e *EngineConfig) SetXAuthority(path string) {
+	e.JSON.XAuthority = path
+}
+
+// GetXAuthority returns the host X authority file bound into container.
+func (e *EngineConfig) GetXAuthority() string {
+	return e.JSON.XAuthority
+}
+
+// SetWaylandSocket sets the host Wayland display socket bound into
+// container.
+func (e *EngineConfig) SetWaylandSocket(path string) {
+	e.JSON.WaylandSocket = path
+}
+
+// GetWaylandSocket returns the host Wayland display socket bound into
+// container.
+func (e *EngineConfig) GetWaylandSocket() string {
+	return e.JSON.WaylandSocket
+}
+
+// SetMediaDevices sets the sound and video devices provided to the
+// container.
+func (e *EngineConfig) SetMediaDevices(devices []string) {
+	e.JSON.MediaDevices = devices
+}
+
+// GetMediaDevices returns the sound and video devices provided to the
+// container.
+func (e *EngineConfig) GetMediaDevices() []string {
+	return e.JSON.MediaDevices
+}
+
+// SetPulseSocket sets the host PulseAudio server socket bound into
+// container.
+func (e *EngineConfig) SetPulseSocket(path string) {
+	e.JSON.PulseSocket = path
+}
+
+// GetPulseSocket returns the host PulseAudio server socket bound into
+// container.
+func (e *EngineConfig) GetPulseSocket() string {
+	return e.JSON.PulseSocket
+}
+
+// SetPulseCookie sets the host PulseAudio cookie bound into container.
+func (e *EngineConfig) SetPulseCookie(path string) {
+	e.JSON.PulseCookie = path
+}
+
+// GetPulseCookie returns the host PulseAudio cookie bound into container.
+func (e *EngineConfig) GetPulseCookie() string {
+	return e.JSON.PulseCookie
+}
+
 // SetWorkdir sets a work directory path.
 func (e *EngineConfig) SetWorkdir(name string) {
 	e.JSON.Workdir = name
@@ -174,6 +401,30 @@ func (e *EngineConfig) GetScratchDir() []string {
 	return e.JSON.ScratchDir
 }
 
+// SetAutoScratch sets the host directory allocated for the job
+// scratch, it is removed once the container stopped.
+func (e *EngineConfig) SetAutoScratch(dir string) {
+	e.JSON.AutoScratch = dir
+}
+
+// GetAutoScratch returns the host directory allocated for the job
+// scratch.
+func (e *EngineConfig) GetAutoScratch() string {
+	return e.JSON.AutoScratch
+}
+
+// SetTmpPolicy sets the list of <path>=<policy> controlling how /tmp,
+// /var/tmp and /dev/shm are provided to the container.
+func (e *EngineConfig) SetTmpPolicy(policies []string) {
+	e.JSON.TmpPolicy = policies
+}
+
+// GetTmpPolicy returns the list of <path>=<policy> controlling how /tmp,
+// /var/tmp and /dev/shm are provided to the container.
+func (e *EngineConfig) GetTmpPolicy() []string {
+	return e.JSON.TmpPolicy
+}
+
 // SetHomeSource sets the source home directory path.
 func (e *EngineConfig) SetHomeSource(source string) {
 	e.JSON.HomeSource = source
@@ -194,6 +445,65 @@ func (e *EngineConfig) GetHomeDest() string {
 	return e.JSON.HomeDest
 }
 
+// SetHomeMode sets how the home directory is provided to the container,
+// as host, image, tmpfs[:<size>] or skel[:<size>].
+func (e *EngineConfig) SetHomeMode(mode string) {
+	e.JSON.HomeMode = mode
+}
+
+// GetHomeMode returns how the home directory is provided to the container.
+func (e *EngineConfig) GetHomeMode() string {
+	return e.JSON.HomeMode
+}
+
+// SetPasswdEntries sets the extra entries added to the container passwd
+// file, as user names, uids or passwd lines.
+func (e *EngineConfig) SetPasswdEntries(entries []string) {
+	e.JSON.PasswdEntries = entries
+}
+
+// GetPasswdEntries returns the extra entries added to the container passwd
+// file.
+func (e *EngineConfig) GetPasswdEntries() []string {
+	return e.JSON.PasswdEntries
+}
+
+// SetKrb5CCache sets the name of the Kerberos credential cache provided
+// to the container.
+func (e *EngineConfig) SetKrb5CCache(name string) {
+	e.JSON.Krb5CCache = name
+}
+
+// GetKrb5CCache returns the name of the Kerberos credential cache provided
+// to the container.
+func (e *EngineConfig) GetKrb5CCache() string {
+	return e.JSON.Krb5CCache
+}
+
+// SetKrb5CCacheTemp sets if the Kerberos credential cache is a copy made
+// for the container and must be deleted after use.
+func (e *EngineConfig) SetKrb5CCacheTemp(temp bool) {
+	e.JSON.Krb5CCacheTemp = temp
+}
+
+// GetKrb5CCacheTemp returns if the Kerberos credential cache is a copy
+// made for the container and must be deleted after use.
+func (e *EngineConfig) GetKrb5CCacheTemp() bool {
+	return e.JSON.Krb5CCacheTemp
+}
+
+// SetKrb5Conf sets the host Kerberos configuration file bound in the
+// container.
+func (e *EngineConfig) SetKrb5Conf(path string) {
+	e.JSON.Krb5Conf = path
+}
+
+// GetKrb5Conf returns the host Kerberos configuration file bound in the
+// container.
+func (e *EngineConfig) GetKrb5Conf() string {
+	return e.JSON.Krb5Conf
+}
+
 // SetCustomHome sets if home path is a custom path or not.
 func (e *EngineConfig) SetCustomHome(custom bool) {
 	e.JSON.CustomHome = custom
@@ -354,6 +664,17 @@ func (e *EngineConfig) GetNoInit() bool {
 	return e.JSON.NoInit
 }
 
+// SetNotifySocket sets the host systemd notify socket path where
+// instance READY/WATCHDOG messages are relayed
+func (e *EngineConfig) SetNotifySocket(path string) {
+	e.JSON.NotifySocket = path
+}
+
+// GetNotifySocket returns the host systemd notify socket path
+func (e *EngineConfig) GetNotifySocket() string {
+	return e.JSON.NotifySocket
+}
+
 // SetNetwork sets a list of commas separated networks to configure inside container
 func (e *EngineConfig) SetNetwork(network string) {
 	e.JSON.Network = network
@@ -476,6 +797,104 @@ func (e *EngineConfig) GetLibrariesPath() []string {
 	return e.JSON.LibrariesPath
 }
 
+// SetPty sets if the container process is attached to a pseudo-terminal
+// even if standard input/output are not terminals.
+func (e *EngineConfig) SetPty(pty bool) {
+	e.JSON.Pty = pty
+}
+
+// GetPty returns if the container process is attached to a
+// pseudo-terminal.
+func (e *EngineConfig) GetPty() bool {
+	return e.JSON.Pty
+}
+
+// SetPtyTiming sets the path of the file where pseudo-terminal output
+// timing information are written.
+func (e *EngineConfig) SetPtyTiming(path string) {
+	e.JSON.PtyTiming = path
+}
+
+// GetPtyTiming returns the path of the file where pseudo-terminal output
+// timing information are written.
+func (e *EngineConfig) GetPtyTiming() string {
+	return e.JSON.PtyTiming
+}
+
+// SetPtyFd sets the pseudo-terminal master and slave file descriptors.
+func (e *EngineConfig) SetPtyFd(master int, slave int) {
+	e.JSON.PtyFd = []int{master, slave}
+}
+
+// GetPtyFd returns the pseudo-terminal master and slave file descriptors,
+// -1 is returned for both if no pseudo-terminal was allocated.
+func (e *EngineConfig) GetPtyFd() (int, int) {
+	if len(e.JSON.PtyFd) != 2 {
+		return -1, -1
+	}
+	return e.JSON.PtyFd[0], e.JSON.PtyFd[1]
+}
+
+// SetRusage sets if a resource usage summary of the container process
+// is reported on exit.
+func (e *EngineConfig) SetRusage(rusage bool) {
+	e.JSON.Rusage = rusage
+}
+
+// GetRusage returns if a resource usage summary of the container process
+// is reported on exit.
+func (e *EngineConfig) GetRusage() bool {
+	return e.JSON.Rusage
+}
+
+// SetRusageFile sets the path of the file where the resource usage
+// summary is written in JSON format.
+func (e *EngineConfig) SetRusageFile(path string) {
+	e.JSON.RusageFile = path
+}
+
+// GetRusageFile returns the path of the file where the resource usage
+// summary is written in JSON format.
+func (e *EngineConfig) GetRusageFile() string {
+	return e.JSON.RusageFile
+}
+
+// SetTimeout sets the wall-clock duration after which the container
+// process is stopped, 0 means no timeout.
+func (e *EngineConfig) SetTimeout(timeout time.Duration) {
+	e.JSON.Timeout = timeout
+}
+
+// GetTimeout returns the wall-clock duration after which the container
+// process is stopped, 0 means no timeout.
+func (e *EngineConfig) GetTimeout() time.Duration {
+	return e.JSON.Timeout
+}
+
+// SetStopSignal sets the signal sent to the container process tree
+// when the timeout expires.
+func (e *EngineConfig) SetStopSignal(sig int) {
+	e.JSON.StopSignal = sig
+}
+
+// GetStopSignal returns the signal sent to the container process tree
+// when the timeout expires.
+func (e *EngineConfig) GetStopSignal() int {
+	return e.JSON.StopSignal
+}
+
+// SetStopTimeout sets the grace period in seconds before a stopped
+// instance is killed with SIGKILL.
+func (e *EngineConfig) SetStopTimeout(timeout int) {
+	e.JSON.StopTimeout = timeout
+}
+
+// GetStopTimeout returns the grace period in seconds before a stopped
+// instance is killed with SIGKILL.
+func (e *EngineConfig) GetStopTimeout() int {
+	return e.JSON.StopTimeout
+}
+
 // GetDeleteImage returns if container image must be deleted after use
 func (e *EngineConfig) GetDeleteImage() bool {
 	return e.JSON.DeleteImage
@@ -485,3 +904,129 @@ func (e *EngineConfig) GetDeleteImage() bool {
 func (e *EngineConfig) SetDeleteImage(delete bool) {
 	e.JSON.DeleteImage = delete
 }
+
+// GetStageUser returns the file registering the container as a user
+// of the shared staged image
+func (e *EngineConfig) GetStageUser() string {
+	return e.JSON.StageUser
+}
+
+// SetStageUser sets the file registering the container as a user of
+// the shared staged image, the image is removed after use by its last
+// user
+func (e *EngineConfig) SetStageUser(user string) {
+	e.JSON.StageUser = user
+}
+
+// SetInvocation sets the record of the command line which started
+// the container.
+func (e *EngineConfig) SetInvocation(invocation *Invocation) {
+	e.JSON.Invocation = invocation
+}
+
+// GetInvocation returns the record of the command line which started
+// the container.
+func (e *EngineConfig) GetInvocation() *Invocation {
+	return e.JSON.Invocation
+}
+
+// SetStrictPlatform sets if images built for another architecture
+// are refused instead of running under emulation.
+func (e *EngineConfig) SetStrictPlatform(strict bool) {
+	e.JSON.StrictPlatform = strict
+}
+
+// GetStrictPlatform returns if images built for another architecture
+// are refused instead of running under emulation.
+func (e *EngineConfig) GetStrictPlatform() bool {
+	return e.JSON.StrictPlatform
+}
+
+// SetNotifyURLs sets the URLs receiving the instance lifecycle events
+func (e *EngineConfig) SetNotifyURLs(urls []string) {
+	e.JSON.NotifyURLs = urls
+}
+
+// GetNotifyURLs returns the URLs receiving the instance lifecycle events
+func (e *EngineConfig) GetNotifyURLs() []string {
+	return e.JSON.NotifyURLs
+}
+
+// SetNotifyCommands sets the commands run on instance lifecycle events
+func (e *EngineConfig) SetNotifyCommands(commands []string) {
+	e.JSON.NotifyCommands = commands
+}
+
+// GetNotifyCommands returns the commands run on instance lifecycle events
+func (e *EngineConfig) GetNotifyCommands() []string {
+	return e.JSON.NotifyCommands
+}
+
+// SetNoImageSeccomp sets if the seccomp profile recommended by the
+// image is ignored
+func (e *EngineConfig) SetNoImageSeccomp(noImageSeccomp bool) {
+	e.JSON.NoImageSeccomp = noImageSeccomp
+}
+
+// GetNoImageSeccomp returns if the seccomp profile recommended by the
+// image is ignored
+func (e *EngineConfig) GetNoImageSeccomp() bool {
+	return e.JSON.NoImageSeccomp
+}
+
+// SetEnvViaFile sets if the container process environment is passed
+// through a file read by the container shell instead of execve(2)
+func (e *EngineConfig) SetEnvViaFile(envViaFile bool) {
+	e.JSON.EnvViaFile = envViaFile
+}
+
+// GetEnvViaFile returns if the container process environment is passed
+// through a file read by the container shell instead of execve(2)
+func (e *EngineConfig) GetEnvViaFile() bool {
+	return e.JSON.EnvViaFile
+}
+
+// SetTHP sets the transparent hugepage mode of the container processes,
+// never or madvise
+func (e *EngineConfig) SetTHP(mode string) {
+	e.JSON.THP = mode
+}
+
+// GetTHP returns the transparent hugepage mode of the container processes
+func (e *EngineConfig) GetTHP() string {
+	return e.JSON.THP
+}
+
+// SetMemPolicy sets the NUMA memory policy of the container processes
+func (e *EngineConfig) SetMemPolicy(policy string) {
+	e.JSON.MemPolicy = policy
+}
+
+// GetMemPolicy returns the NUMA memory policy of the container processes
+func (e *EngineConfig) GetMemPolicy() string {
+	return e.JSON.MemPolicy
+}
+
+// SetObserve sets if the system calls, file opens and connections of the
+// container processes are reported on exit
+func (e *EngineConfig) SetObserve(observe bool) {
+	e.JSON.Observe = observe
+}
+
+// GetObserve returns if the system calls, file opens and connections of
+// the container processes are reported on exit
+func (e *EngineConfig) GetObserve() bool {
+	return e.JSON.Observe
+}
+
+// SetObserveFile sets the file where the observer report is written in
+// JSON format
+func (e *EngineConfig) SetObserveFile(path string) {
+	e.JSON.ObserveFile = path
+}
+
+// GetObserveFile returns the file where the observer report is written
+// in JSON format
+func (e *EngineConfig) GetObserveFile() string {
+	return e.JSON.ObserveFile
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"sort"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// KeyConflict reports a key ID identifying keys with different
+// fingerprints across synchronized keyrings
+type KeyConflict struct {
+	KeyID uint64
+	// Fingerprints stores the fingerprint found for the key ID
+	// indexed by keyring name
+	Fingerprints map[string][20]byte
+}
+
+// DiffKeyrings compares keyrings indexed by name and returns the public
+// keys missing from each keyring. Keys whose ID identifies different
+// fingerprints across keyrings are reported as conflicts and are never
+// returned as missing keys.
+func DiffKeyrings(keyrings map[string]openpgp.EntityList) (map[string]openpgp.EntityList, []KeyConflict) {
+	names := make([]string, 0, len(keyrings))
+	for name := range keyrings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ids []uint64
+	entities := make(map[uint64]*openpgp.Entity)
+	fingerprints := make(map[uint64]map[string][20]byte)
+
+	for _, name := range names {
+		for _, e := range keyrings[name] {
+			id := e.PrimaryKey.KeyId
+			if _, ok := fingerprints[id]; !ok {
+				ids = append(ids, id)
+				entities[id] = e
+				fingerprints[id] = make(map[string][20]byte)
+			}
+			fingerprints[id][name] = e.PrimaryKey.Fingerprint
+		}
+	}
+
+	missing := make(map[string]openpgp.EntityList)
+	var conflicts []KeyConflict
+
+	for _, id := range ids {
+		fp := entities[id].PrimaryKey.Fingerprint
+
+		conflict := false
+		for _, f := range fingerprints[id] {
+			if f != fp {
+				conflict = true
+				break
+			}
+		}
+		if conflict {
+			conflicts = append(conflicts, KeyConflict{KeyID: id, Fingerprints: fingerprints[id]})
+			continue
+		}
+
+		for _, name := range names {
+			if _, ok := fingerprints[id][name]; !ok {
+				missing[name] = append(missing[name], entities[id])
+			}
+		}
+	}
+
+	return missing, conflicts
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestDiffKeyrings(t *testing.T) {
+	other, err := openpgp.NewEntity("Other Name", "", "other@test.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+
+	// same key ID with a different fingerprint
+	pk := *testEntity.PrimaryKey
+	pk.Fingerprint[0] ^= 0xff
+	colliding := &openpgp.Entity{PrimaryKey: &pk}
+
+	keyrings := map[string]openpgp.EntityList{
+		"local":  {testEntity},
+		"file":   {other},
+		"server": {},
+	}
+
+	missing, conflicts := DiffKeyrings(keyrings)
+	if len(conflicts) != 0 {
+		t.Errorf("unexpected conflicts: %v", conflicts)
+	}
+	if len(missing["local"]) != 1 || missing["local"][0] != other {
+		t.Errorf("unexpected missing keys for local keyring: %v", missing["local"])
+	}
+	if len(missing["file"]) != 1 || missing["file"][0] != testEntity {
+		t.Errorf("unexpected missing keys for file keyring: %v", missing["file"])
+	}
+	if len(missing["server"]) != 2 {
+		t.Errorf("unexpected missing keys for server keyring: %v", missing["server"])
+	}
+
+	keyrings["server"] = openpgp.EntityList{colliding}
+
+	missing, conflicts = DiffKeyrings(keyrings)
+	if len(conflicts) != 1 {
+		t.Fatalf("expected one conflict, got %v", conflicts)
+	}
+	if conflicts[0].KeyID != testEntity.PrimaryKey.KeyId || len(conflicts[0].Fingerprints) != 2 {
+		t.Errorf("unexpected conflict %v", conflicts[0])
+	}
+	for name, el := range missing {
+		for _, e := range el {
+			if e.PrimaryKey.KeyId == testEntity.PrimaryKey.KeyId {
+				t.Errorf("conflicting key reported missing from %s", name)
+			}
+		}
+	}
+}
@@ -41,6 +41,10 @@ const helpPush = `  4) Push key using "singularity key push %[1]X"
 var errPassphraseMismatch = errors.New("passphrases do not match")
 var errTooManyRetries = errors.New("too many retries while getting a passphrase")
 
+// ErrKeyNotFound is returned by FetchPubkey when the key server has
+// no key matching the fingerprint
+var ErrKeyNotFound = errors.New("no matching keys found for fingerprint")
+
 // AskQuestion prompts the user with a question and return the response
 func AskQuestion(format string, a ...interface{}) (string, error) {
 	fmt.Printf(format, a...)
@@ -584,7 +588,7 @@ func FetchPubkey(fingerprint, keyserverURI, authToken string, noPrompt bool) (op
 			sylog.Infof(helpAuth)
 			return nil, fmt.Errorf("unauthorized or missing token")
 		} else if ok && jerr.Code == http.StatusNotFound {
-			return nil, fmt.Errorf("no matching keys found for fingerprint")
+			return nil, ErrKeyNotFound
 		} else {
 			return nil, fmt.Errorf("failed to get key: %v", err)
 		}
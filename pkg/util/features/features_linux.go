@@ -0,0 +1,177 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package features detects which privileged singularity features are
+// available on the host, so callers can adapt instead of discovering
+// failures while running a container.
+package features
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/security/seccomp"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+	"github.com/sylabs/singularity/pkg/util/fs/proc"
+	"github.com/sylabs/singularity/pkg/util/sysctl"
+)
+
+// Feature is a privileged feature name
+type Feature string
+
+const (
+	// Setuid is the setuid workflow through starter-suid
+	Setuid Feature = "setuid"
+	// UserNamespace is the unprivileged workflow through user namespaces
+	UserNamespace Feature = "userns"
+	// Overlay is the overlay filesystem used for bind points and --overlay
+	Overlay Feature = "overlay"
+	// Seccomp is the seccomp filtering of container system calls
+	Seccomp Feature = "seccomp"
+	// CgroupsV2 is the unified cgroup hierarchy mounted in /sys/fs/cgroup
+	CgroupsV2 Feature = "cgroupsv2"
+)
+
+// Status reports if a feature is available, Reason explains why it is not
+type Status struct {
+	Feature   Feature `json:"feature"`
+	Available bool    `json:"available"`
+	Reason    string  `json:"reason,omitempty"`
+}
+
+// Matrix is the status of all features
+type Matrix []Status
+
+// Get returns the status of feature f
+func (m Matrix) Get(f Feature) Status {
+	for _, s := range m {
+		if s.Feature == f {
+			return s
+		}
+	}
+	return Status{Feature: f, Reason: "unknown feature"}
+}
+
+// Available returns if feature f is available
+func (m Matrix) Available(f Feature) bool {
+	return m.Get(f).Available
+}
+
+var (
+	starterSuid = filepath.Join(buildcfg.LIBEXECDIR, "singularity", "bin", "starter-suid")
+	starter     = filepath.Join(buildcfg.LIBEXECDIR, "singularity", "bin", "starter")
+)
+
+// cgroup2SuperMagic is the filesystem type of a cgroup v2 hierarchy
+const cgroup2SuperMagic = 0x63677270
+
+// Detect returns the features status, configuration directives are
+// taken into account when fileConfig is not nil
+func Detect(fileConfig *singularityConfig.FileConfig) Matrix {
+	return Matrix{
+		status(Setuid, setuidReason(starterSuid, fileConfig)),
+		status(UserNamespace, userNamespaceReason(starter)),
+		status(Overlay, overlayReason(fileConfig)),
+		status(Seccomp, seccompReason(seccomp.Enabled(), "/proc/self/status")),
+		status(CgroupsV2, cgroupsV2Reason("/sys/fs/cgroup")),
+	}
+}
+
+func status(f Feature, reason string) Status {
+	return Status{Feature: f, Available: reason == "", Reason: reason}
+}
+
+// setuidReason returns why the setuid workflow is not available with the
+// starter-suid binary at path, an empty string means it is
+func setuidReason(path string, fileConfig *singularityConfig.FileConfig) string {
+	if fileConfig != nil && !fileConfig.AllowSetuid {
+		return "disabled by 'allow setuid = no' in singularity.conf"
+	}
+
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "starter-suid is not installed"
+	} else if err != nil {
+		return fmt.Sprintf("could not check starter-suid: %s", err)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Uid != 0 || fi.Mode()&os.ModeSetuid == 0 {
+		return "starter-suid is not setuid root"
+	}
+
+	fs := &syscall.Statfs_t{}
+	if err := syscall.Statfs(path, fs); err == nil && fs.Flags&syscall.MS_NOSUID != 0 {
+		return "starter-suid is on a filesystem mounted nosuid"
+	}
+	return ""
+}
+
+// userNamespaceReason returns why unprivileged user namespaces can't be
+// used with the starter binary at path, an empty string means they can
+func userNamespaceReason(path string) string {
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		return "kernel doesn't support user namespaces"
+	}
+	if value, err := sysctl.Get("user.max_user_namespaces"); err == nil && value == "0" {
+		return "disabled by user.max_user_namespaces sysctl"
+	}
+	// Debian and Ubuntu specific
+	if value, err := sysctl.Get("kernel.unprivileged_userns_clone"); err == nil && value == "0" {
+		return "disabled by kernel.unprivileged_userns_clone sysctl"
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "starter is not installed"
+	}
+	return ""
+}
+
+// overlayReason returns why the overlay filesystem can't be used, an
+// empty string means it can
+func overlayReason(fileConfig *singularityConfig.FileConfig) string {
+	if fileConfig != nil && fileConfig.EnableOverlay == "no" {
+		return "disabled by 'enable overlay = no' in singularity.conf"
+	}
+	if has, err := proc.HasFilesystem("overlay"); err != nil {
+		return err.Error()
+	} else if !has {
+		return "kernel doesn't support overlay filesystem"
+	}
+	return ""
+}
+
+// seccompReason returns why seccomp filters can't be applied, enabled is
+// whether singularity was built with seccomp support and status is the
+// path of the status file of a process. An empty string means they can.
+func seccompReason(enabled bool, status string) string {
+	if !enabled {
+		return "singularity was built without seccomp support"
+	}
+	b, err := ioutil.ReadFile(status)
+	if err != nil {
+		return fmt.Sprintf("could not check kernel seccomp support: %s", err)
+	}
+	if !bytes.Contains(b, []byte("\nSeccomp:")) {
+		return "kernel doesn't support seccomp"
+	}
+	return ""
+}
+
+// cgroupsV2Reason returns why the cgroup v2 unified hierarchy can't be
+// used at path, an empty string means it can
+func cgroupsV2Reason(path string) string {
+	st := &syscall.Statfs_t{}
+	if err := syscall.Statfs(path, st); err != nil {
+		return fmt.Sprintf("could not check %s: %s", path, err)
+	}
+	if st.Type != cgroup2SuperMagic {
+		return "host uses the cgroup v1 hierarchies"
+	}
+	return ""
+}
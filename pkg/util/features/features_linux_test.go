@@ -0,0 +1,120 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package features
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+)
+
+func TestSetuidReason(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir, err := ioutil.TempDir("", "features-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "starter-suid")
+	if err := ioutil.WriteFile(path, []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		fileConfig *singularityConfig.FileConfig
+		reason     string
+	}{
+		{
+			name:       "disabled",
+			path:       path,
+			fileConfig: &singularityConfig.FileConfig{AllowSetuid: false},
+			reason:     "disabled by 'allow setuid = no' in singularity.conf",
+		},
+		{
+			name:   "not installed",
+			path:   filepath.Join(dir, "missing"),
+			reason: "starter-suid is not installed",
+		},
+		{
+			name:       "not setuid",
+			path:       path,
+			fileConfig: &singularityConfig.FileConfig{AllowSetuid: true},
+			reason:     "starter-suid is not setuid root",
+		},
+	}
+
+	for _, tt := range tests {
+		if reason := setuidReason(tt.path, tt.fileConfig); reason != tt.reason {
+			t.Errorf("%s: unexpected reason %q instead of %q", tt.name, reason, tt.reason)
+		}
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	m := Detect(&singularityConfig.FileConfig{EnableOverlay: "no"})
+
+	for _, f := range []Feature{Setuid, UserNamespace, Overlay, Seccomp, CgroupsV2} {
+		s := m.Get(f)
+		if s.Feature != f {
+			t.Errorf("feature %s not found", f)
+		}
+		if s.Available != (s.Reason == "") {
+			t.Errorf("feature %s availability inconsistent with reason %q", f, s.Reason)
+		}
+	}
+	if m.Available(Overlay) {
+		t.Errorf("overlay reported as available while disabled by configuration")
+	}
+	if m.Available("unknown") {
+		t.Errorf("unknown feature reported as available")
+	}
+}
+
+func TestSeccompReason(t *testing.T) {
+	dir, err := ioutil.TempDir("", "features-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	supported := filepath.Join(dir, "supported")
+	if err := ioutil.WriteFile(supported, []byte("Name:\tsh\nSeccomp:\t0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unsupported := filepath.Join(dir, "unsupported")
+	if err := ioutil.WriteFile(unsupported, []byte("Name:\tsh\nNoNewPrivs:\t0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		status  string
+		reason  string
+	}{
+		{"available", true, supported, ""},
+		{"not built", false, supported, "singularity was built without seccomp support"},
+		{"kernel", true, unsupported, "kernel doesn't support seccomp"},
+	}
+
+	for _, tt := range tests {
+		if reason := seccompReason(tt.enabled, tt.status); reason != tt.reason {
+			t.Errorf("%s: unexpected reason %q instead of %q", tt.name, reason, tt.reason)
+		}
+	}
+}
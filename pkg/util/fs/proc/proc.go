@@ -8,13 +8,33 @@ package proc
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
+// clockTicks is the number of clock ticks per second used by the kernel
+// to report process times, it's fixed to 100 for userspace
+const clockTicks = 100
+
+// Process holds information about a process read from /proc
+type Process struct {
+	Pid int
+	// NsPid is the process ID in the innermost PID namespace
+	// of the process
+	NsPid   int
+	PPid    int
+	UID     uint32
+	State   string
+	RSS     uint64
+	Time    time.Duration
+	Command string
+}
+
 // HasFilesystem returns whether kernel support filesystem or not
 func HasFilesystem(fs string) (bool, error) {
 	p, err := os.Open("/proc/filesystems")
@@ -207,3 +227,115 @@ func HasNamespace(pid int, nstype string) (bool, error) {
 
 	return has, nil
 }
+
+// GetProcess returns information about process with pid, the resident
+// set size is in kilobytes and time is the user and system CPU time
+func GetProcess(pid int) (*Process, error) {
+	dir := fmt.Sprintf("/proc/%d", pid)
+
+	stat, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	// command name may contain spaces and parenthesis
+	s := string(stat)
+	start := strings.IndexByte(s, '(')
+	end := strings.LastIndexByte(s, ')')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("bad format for %s/stat", dir)
+	}
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("bad format for %s/stat", dir)
+	}
+
+	p := &Process{
+		Pid:     pid,
+		NsPid:   pid,
+		State:   fields[0],
+		Command: s[start+1 : end],
+	}
+	if p.PPid, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, err
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	p.Time = time.Duration(utime+stime) * time.Second / clockTicks
+	rss, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if rss > 0 {
+		p.RSS = uint64(rss) * uint64(os.Getpagesize()) / 1024
+	}
+
+	status, err := os.Open(filepath.Join(dir, "status"))
+	if err != nil {
+		return nil, err
+	}
+	defer status.Close()
+
+	scanner := bufio.NewScanner(status)
+	for scanner.Scan() {
+		f := strings.Fields(scanner.Text())
+		if len(f) < 2 {
+			continue
+		}
+		switch f[0] {
+		case "Uid:":
+			uid, err := strconv.ParseUint(f[1], 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			p.UID = uint32(uid)
+		case "NSpid:":
+			if p.NsPid, err = strconv.Atoi(f[len(f)-1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// kernel threads have an empty command line
+	cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+	if err == nil && len(cmdline) > 0 {
+		p.Command = strings.TrimSpace(strings.Replace(string(cmdline), "\x00", " ", -1))
+	}
+
+	return p, nil
+}
+
+// Descendants returns the process IDs of process with pid and of all
+// its descendants
+func Descendants(pid int) ([]int, error) {
+	if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); os.IsNotExist(err) {
+		return nil, fmt.Errorf("pid %d doesn't exists", pid)
+	}
+
+	childs := make(map[int][]int)
+
+	matches, _ := filepath.Glob(filepath.Join("/proc", "[0-9]*"))
+	for _, path := range matches {
+		p, err := ExtractPid(path)
+		if err != nil {
+			continue
+		}
+		proc, err := GetProcess(int(p))
+		if err != nil {
+			// process may have exited
+			continue
+		}
+		childs[proc.PPid] = append(childs[proc.PPid], proc.Pid)
+	}
+
+	pids := []int{pid}
+	for i := 0; i < len(pids); i++ {
+		pids = append(pids, childs[pids[i]]...)
+	}
+	return pids, nil
+}
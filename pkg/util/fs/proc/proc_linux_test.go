@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 	"testing"
 
@@ -281,3 +282,66 @@ func TestHasNamespace(t *testing.T) {
 
 	cmd.Wait()
 }
+
+func TestGetProcess(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	p, err := GetProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Pid != os.Getpid() || p.PPid != os.Getppid() {
+		t.Errorf("unexpected process IDs %d/%d", p.Pid, p.PPid)
+	}
+	if p.UID != uint32(os.Getuid()) {
+		t.Errorf("unexpected process UID %d", p.UID)
+	}
+	if p.RSS == 0 {
+		t.Errorf("process resident set size is zero")
+	}
+	if p.Command != strings.Join(os.Args, " ") {
+		t.Errorf("unexpected process command %q", p.Command)
+	}
+
+	if _, err := GetProcess(0); err == nil {
+		t.Errorf("no error reported with PID 0")
+	}
+}
+
+func TestDescendants(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	cmd := exec.Command("/bin/cat")
+	pipe, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer pipe.Close()
+
+	pids, err := Descendants(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pids) < 2 || pids[0] != os.Getpid() {
+		t.Fatalf("unexpected descendants %v", pids)
+	}
+	found := false
+	for _, pid := range pids {
+		if pid == cmd.Process.Pid {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("child process %d not found in %v", cmd.Process.Pid, pids)
+	}
+
+	if _, err := Descendants(0); err == nil {
+		t.Errorf("no error reported with PID 0")
+	}
+}
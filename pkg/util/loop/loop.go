@@ -5,6 +5,11 @@
 
 package loop
 
+import "errors"
+
+// ErrNoLoopDevices is returned when all loop devices are in use
+var ErrNoLoopDevices = errors.New("no loop devices available")
+
 // Device describes a loop device
 type Device struct {
 	MaxLoopDevices int
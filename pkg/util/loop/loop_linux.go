@@ -51,7 +51,7 @@ func (loop *Device) AttachFromFile(image *os.File, mode int, number *int) error
 					continue
 				}
 			}
-			return fmt.Errorf("no loop devices available")
+			return ErrNoLoopDevices
 		}
 
 		path = fmt.Sprintf("/dev/loop%d", device)
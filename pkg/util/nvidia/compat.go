@@ -0,0 +1,106 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package nvidia
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// driverVersionFile reports the version of the loaded NVIDIA kernel module
+const driverVersionFile = "/proc/driver/nvidia/version"
+
+// cudaMinDriver lists the minimum Linux driver version required by
+// CUDA toolkit versions
+var cudaMinDriver = map[string]string{
+	"10.2": "440.33",
+	"10.1": "418.39",
+	"10.0": "410.48",
+	"9.2":  "396.26",
+	"9.1":  "390.46",
+	"9.0":  "384.81",
+	"8.0":  "367.48",
+}
+
+var driverVersion = regexp.MustCompile(`NVRM version:.*\s([0-9]+\.[0-9]+(\.[0-9]+)?)\s`)
+
+// DriverVersion returns the version of the NVIDIA driver loaded on host
+func DriverVersion() (string, error) {
+	f, err := os.Open(driverVersionFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read NVIDIA driver version: %s", err)
+	}
+	defer f.Close()
+
+	if v := parseDriverVersion(f); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("no NVIDIA driver version found in %s", driverVersionFile)
+}
+
+// parseDriverVersion returns the driver version found in r with the
+// format of driverVersionFile
+func parseDriverVersion(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if m := driverVersion.FindStringSubmatch(scanner.Text() + " "); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// CompareVersions compares two dotted version strings and returns -1, 0
+// or 1 if a is respectively lower, equal or greater than b
+func CompareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+	}
+	return 0
+}
+
+// MinDriverVersion returns the minimum driver version required by CUDA
+// version cuda, only major and minor numbers are considered
+func MinDriverVersion(cuda string) (string, bool) {
+	splitted := strings.SplitN(cuda, ".", 3)
+	if len(splitted) < 2 {
+		return "", false
+	}
+	driver, ok := cudaMinDriver[splitted[0]+"."+splitted[1]]
+	return driver, ok
+}
+
+// CheckCudaCompat returns an error if driver doesn't support CUDA
+// version cuda, unknown CUDA versions are considered supported
+func CheckCudaCompat(driver, cuda string) error {
+	min, ok := MinDriverVersion(cuda)
+	if !ok {
+		return nil
+	}
+	if CompareVersions(driver, min) < 0 {
+		return fmt.Errorf("container requires CUDA %s which needs NVIDIA driver >= %s, host driver version is %s", cuda, min, driver)
+	}
+	return nil
+}
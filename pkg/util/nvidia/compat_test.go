@@ -0,0 +1,107 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package nvidia
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDriverVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		version string
+	}{
+		{
+			"Proprietary",
+			"NVRM version: NVIDIA UNIX x86_64 Kernel Module  418.87.01  Thu Aug  8 15:35:46 CDT 2019\nGCC version:  gcc version 7.4.0\n",
+			"418.87.01",
+		},
+		{
+			"EndOfLine",
+			"NVRM version: NVIDIA UNIX x86_64 Kernel Module  440.33",
+			"440.33",
+		},
+		{"NoVersion", "GCC version:  gcc version 7.4.0\n", ""},
+		{"Empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v := parseDriverVersion(strings.NewReader(tt.content)); v != tt.version {
+				t.Errorf("unexpected driver version %q instead of %q", v, tt.version)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		cmp  int
+	}{
+		{"418.39", "418.39", 0},
+		{"418.39", "418.39.0", 0},
+		{"418.87.01", "418.39", 1},
+		{"410.48", "418.39", -1},
+		{"1000.1", "999.99", 1},
+		{"10.2", "10.10", -1},
+	}
+
+	for _, tt := range tests {
+		if cmp := CompareVersions(tt.a, tt.b); cmp != tt.cmp {
+			t.Errorf("unexpected comparison of %s and %s: got %d instead of %d", tt.a, tt.b, cmp, tt.cmp)
+		}
+	}
+}
+
+func TestMinDriverVersion(t *testing.T) {
+	tests := []struct {
+		cuda   string
+		driver string
+		ok     bool
+	}{
+		{"10.1", "418.39", true},
+		{"10.1.243", "418.39", true},
+		{"9.0", "384.81", true},
+		{"10", "", false},
+		{"11.0", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		driver, ok := MinDriverVersion(tt.cuda)
+		if driver != tt.driver || ok != tt.ok {
+			t.Errorf("unexpected minimum driver version for CUDA %q: %q %v", tt.cuda, driver, ok)
+		}
+	}
+}
+
+func TestCheckCudaCompat(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		cuda    string
+		wantErr bool
+	}{
+		{"NewerDriver", "440.33", "10.1", false},
+		{"MinimumDriver", "418.39", "10.1.243", false},
+		{"OlderDriver", "410.48", "10.1", true},
+		{"UnknownCuda", "384.81", "11.0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCudaCompat(tt.driver, tt.cuda)
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success with driver %s and CUDA %s", tt.driver, tt.cuda)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package unix
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// maxSecretSize is the maximum size of a shared secret
+const maxSecretSize = 4096
+
+// ReadSecretFile returns the shared secret stored in file at path,
+// leading and trailing white spaces are ignored
+func ReadSecretFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret file %s: %s", path, err)
+	}
+	secret := bytes.TrimSpace(b)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret file %s is empty", path)
+	} else if len(secret) > maxSecretSize {
+		return nil, fmt.Errorf("secret in %s exceeds %d bytes", path, maxSecretSize)
+	} else if bytes.IndexByte(secret, '\n') >= 0 {
+		return nil, fmt.Errorf("secret in %s must be a single line", path)
+	}
+	return secret, nil
+}
+
+// SendSecret sends the shared secret as first message over the
+// connection c, the secret is terminated by a newline
+func SendSecret(c net.Conn, secret []byte) error {
+	if _, err := c.Write(append(secret, '\n')); err != nil {
+		return fmt.Errorf("failed to send secret: %s", err)
+	}
+	return nil
+}
+
+// CheckSecret reads the first message sent over the connection c and
+// compares it with the shared secret, an error is returned if the
+// secret doesn't match or isn't received before timeout
+func CheckSecret(c net.Conn, secret []byte, timeout time.Duration) error {
+	if err := c.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	defer c.SetReadDeadline(time.Time{})
+
+	received := make([]byte, 0, len(secret))
+	b := make([]byte, 1)
+
+	for {
+		if _, err := c.Read(b); err != nil {
+			return fmt.Errorf("failed to receive secret: %s", err)
+		}
+		if b[0] == '\n' {
+			break
+		}
+		if len(received) == maxSecretSize {
+			return fmt.Errorf("secret exceeds %d bytes", maxSecretSize)
+		}
+		received = append(received, b[0])
+	}
+
+	if subtle.ConstantTimeCompare(received, secret) != 1 {
+		return fmt.Errorf("secret mismatch")
+	}
+	return nil
+}
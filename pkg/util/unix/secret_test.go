@@ -0,0 +1,73 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package unix
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/test"
+)
+
+func TestSecret(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	f, err := ioutil.TempFile("", "secret-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("  s3cr3t\n")
+	f.Close()
+
+	secret, err := ReadSecretFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != "s3cr3t" {
+		t.Fatalf("unexpected secret %q", secret)
+	}
+
+	tests := []struct {
+		name    string
+		sent    []byte
+		success bool
+	}{
+		{"match", secret, true},
+		{"mismatch", []byte("wrong"), false},
+		{"prefix", []byte("s3cr3"), false},
+	}
+
+	for _, tt := range tests {
+		server, client := net.Pipe()
+
+		go SendSecret(client, tt.sent)
+
+		err := CheckSecret(server, secret, time.Second)
+		if tt.success && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if !tt.success && err == nil {
+			t.Errorf("%s: unexpected success", tt.name)
+		}
+
+		server.Close()
+		client.Close()
+	}
+
+	// no secret sent before timeout
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	if err := CheckSecret(server, secret, 100*time.Millisecond); err == nil {
+		t.Errorf("unexpected success without secret")
+	}
+}
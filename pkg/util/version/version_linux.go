@@ -0,0 +1,79 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package version reports the version of singularity along with its build
+// options, the features available on the host and the image formats it
+// supports, so orchestrators can adapt their behavior to an installation.
+package version
+
+import (
+	"runtime"
+	"sort"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/pkg/image"
+	pluginapi "github.com/sylabs/singularity/pkg/plugin"
+	singularityConfig "github.com/sylabs/singularity/pkg/runtime/engines/singularity/config"
+	"github.com/sylabs/singularity/pkg/util/features"
+)
+
+// buildTags are the optional build tags singularity was built with, they
+// are registered by files built with each tag
+var buildTags []string
+
+// ImageFormat is an image format singularity can run, Versions are the
+// versions of the format specification supported when it has any
+type ImageFormat struct {
+	Name     string   `json:"name"`
+	Versions []string `json:"versions,omitempty"`
+}
+
+// PluginABI identifies the plugins which can be loaded, they must be
+// built with the same Go version and singularity sources, and export
+// their plugin.Plugin variable as Symbol
+type PluginABI struct {
+	GoVersion string `json:"goVersion"`
+	Version   string `json:"version"`
+	Symbol    string `json:"symbol"`
+}
+
+// Info describes a singularity installation
+type Info struct {
+	Version      string          `json:"version"`
+	BuildTags    []string        `json:"buildTags"`
+	Features     features.Matrix `json:"features"`
+	PluginABI    PluginABI       `json:"pluginABI"`
+	ImageFormats []ImageFormat   `json:"imageFormats"`
+}
+
+// Get returns the description of the installation, configuration
+// directives are taken into account for features when fileConfig is not
+// nil
+func Get(fileConfig *singularityConfig.FileConfig) Info {
+	tags := append([]string{}, buildTags...)
+	sort.Strings(tags)
+
+	var formats []ImageFormat
+	for _, name := range image.Formats() {
+		f := ImageFormat{Name: name}
+		if name == "sif" {
+			f.Versions = []string{sif.HdrVersion}
+		}
+		formats = append(formats, f)
+	}
+
+	return Info{
+		Version:   buildcfg.PACKAGE_VERSION,
+		BuildTags: tags,
+		Features:  features.Detect(fileConfig),
+		PluginABI: PluginABI{
+			GoVersion: runtime.Version(),
+			Version:   buildcfg.PACKAGE_VERSION,
+			Symbol:    pluginapi.PluginSymbol,
+		},
+		ImageFormats: formats,
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package version
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/pkg/util/features"
+)
+
+func TestGet(t *testing.T) {
+	info := Get(nil)
+
+	if info.Version != buildcfg.PACKAGE_VERSION {
+		t.Errorf("unexpected version %s", info.Version)
+	}
+	if info.BuildTags == nil {
+		t.Errorf("nil build tags")
+	}
+	for _, f := range []features.Feature{features.Setuid, features.UserNamespace, features.Overlay, features.Seccomp, features.CgroupsV2} {
+		if s := info.Features.Get(f); s.Feature != f || s.Available != (s.Reason == "") {
+			t.Errorf("unexpected status %+v of feature %s", s, f)
+		}
+	}
+	if info.PluginABI.GoVersion == "" || info.PluginABI.Symbol == "" {
+		t.Errorf("incomplete plugin ABI %+v", info.PluginABI)
+	}
+	if len(info.ImageFormats) == 0 || info.ImageFormats[0].Name != "sif" || len(info.ImageFormats[0].Versions) != 1 {
+		t.Errorf("unexpected image formats %+v", info.ImageFormats)
+	}
+
+	b, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var decoded Info
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decoded.Version != info.Version || len(decoded.Features) != len(info.Features) {
+		t.Errorf("unexpected decoded information %+v", decoded)
+	}
+}